@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/filter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// defaultAlertWindow is the window of an -alert rule that gives none.
+const defaultAlertWindow = time.Minute
+
+// alertRule is one -alert rule: it fires when more than threshold entries
+// satisfying its filters fall within a window of time, and fires again
+// only once the count has dropped back to the threshold.
+type alertRule struct {
+	spec      string
+	match     *filter.CompositeFilter
+	threshold int
+	window    time.Duration
+	// times holds the times of the latest matching entries, at most
+	// threshold+1 of them, which is all it takes to tell whether more than
+	// threshold fall within the window.
+	times  []time.Time
+	firing bool
+}
+
+// parseAlert parses an -alert rule such as "level=error count>50 window=1m":
+// filter expressions, all of which an entry must satisfy to be counted, a
+// threshold given as count>N or count>=N, and an optional window, one
+// minute by default. Timestamps without a UTC offset in the filters are
+// taken to be in loc.
+func parseAlert(spec string, loc *time.Location) (*alertRule, error) {
+	r := &alertRule{spec: spec, threshold: -1, window: defaultAlertWindow}
+	var filters []filter.Filter
+	for _, tok := range strings.Fields(spec) {
+		switch {
+		case strings.HasPrefix(tok, "count>"):
+			s, orEqual := strings.CutPrefix(strings.TrimPrefix(tok, "count>"), "=")
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || (orEqual && n == 0) {
+				return nil, fmt.Errorf("invalid --alert %q: %s needs a positive count", spec, tok)
+			}
+			if orEqual {
+				n--
+			}
+			r.threshold = n
+		case strings.HasPrefix(tok, "window="):
+			d, err := time.ParseDuration(strings.TrimPrefix(tok, "window="))
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid --alert %q: %s needs a positive duration such as 1m", spec, tok)
+			}
+			r.window = d
+		default:
+			f, err := filter.NewFieldFilterIn(tok, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --alert %q: %w", spec, err)
+			}
+			filters = append(filters, f)
+		}
+	}
+	if r.threshold < 0 {
+		return nil, fmt.Errorf("invalid --alert %q: missing a threshold such as count>50", spec)
+	}
+	r.match = filter.NewCompositeFilter(filters...)
+	return r, nil
+}
+
+// add counts an entry matching r at t, and reports how many matching
+// entries fall within the window ending at t when that makes r fire.
+func (r *alertRule) add(t time.Time) (count int, fire bool) {
+	if n := len(r.times); n > 0 && t.Before(r.times[n-1]) {
+		// Keep the window moving forward for entries out of time order.
+		t = r.times[n-1]
+	}
+	if len(r.times) > r.threshold {
+		r.times = append(r.times[:0], r.times[1:]...)
+	}
+	r.times = append(r.times, t)
+	start := t.Add(-r.window)
+	for len(r.times) > 0 && !r.times[0].After(start) {
+		r.times = r.times[1:]
+	}
+	count = len(r.times)
+	if count <= r.threshold {
+		r.firing = false
+		return count, false
+	}
+	if r.firing {
+		return count, false
+	}
+	r.firing = true
+	return count, true
+}
+
+// alerter watches the entries passing through follow for the -alert rules,
+// writing an alert line to w and starting the -alert-exec command, if any,
+// each time one fires.
+type alerter struct {
+	rules     []*alertRule
+	command   string
+	w         io.Writer
+	highlight bool // bold red alert lines, for a terminal
+	loc       *time.Location
+	now       func() time.Time
+	start     func(command string, env []string) error
+}
+
+// newAlerter returns an alerter for the -alert rules specs, or nil when
+// there are none. Alerts are written to stderr.
+func newAlerter(specs []string, command string, loc *time.Location) (*alerter, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	a := &alerter{command: command, w: os.Stderr, highlight: isTerminal(os.Stderr), loc: loc, now: time.Now, start: startCommand}
+	for _, spec := range specs {
+		r, err := parseAlert(spec, loc)
+		if err != nil {
+			return nil, err
+		}
+		a.rules = append(a.rules, r)
+	}
+	return a, nil
+}
+
+// watch returns a channel of every entry from entries, which it checks
+// against the rules on the way through; with a nil alerter it returns
+// entries. The channel is closed once entries is; after ctx is done
+// nothing more is sent, and the rest of entries is drained and released.
+func (a *alerter) watch(ctx context.Context, entries <-chan *parser.LogEntry) <-chan *parser.LogEntry {
+	if a == nil {
+		return entries
+	}
+	out := make(chan *parser.LogEntry)
+	go func() {
+		defer close(out)
+		done := false
+		for entry := range entries {
+			if done {
+				parser.Release(entry)
+				continue
+			}
+			a.observe(entry)
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				parser.Release(entry)
+				done = true
+			}
+		}
+	}()
+	return out
+}
+
+// observe counts entry against each rule it matches and fires the rules
+// whose count it takes over their threshold. Entries without a timestamp
+// are counted at the time they are read.
+func (a *alerter) observe(entry *parser.LogEntry) {
+	var t time.Time
+	for _, r := range a.rules {
+		if !r.match.Match(entry) {
+			continue
+		}
+		if t.IsZero() {
+			if t = parseTimestampForSort(entry, a.loc); t.IsZero() {
+				t = a.now()
+			}
+		}
+		if count, fire := r.add(t); fire {
+			a.fire(r, count, t)
+		}
+	}
+}
+
+// fire writes the alert line for r and starts the -alert-exec command,
+// which learns the rule, count and time from LOGPIPE_ALERT_RULE,
+// LOGPIPE_ALERT_COUNT and LOGPIPE_ALERT_TIME.
+func (a *alerter) fire(r *alertRule, count int, t time.Time) {
+	line := fmt.Sprintf("ALERT %s: %d matching entries within %s, at %s", r.spec, count, r.window, t.In(a.loc).Format(time.RFC3339))
+	if a.highlight {
+		line = "\033[1m\033[31m" + line + "\033[0m"
+	}
+	fmt.Fprintln(a.w, line)
+	if a.command == "" {
+		return
+	}
+	env := []string{
+		"LOGPIPE_ALERT_RULE=" + r.spec,
+		"LOGPIPE_ALERT_COUNT=" + strconv.Itoa(count),
+		"LOGPIPE_ALERT_TIME=" + t.Format(time.RFC3339Nano),
+	}
+	if err := a.start(a.command, env); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: running --alert-exec: %v\n", err)
+	}
+}
+
+// startCommand starts command with the shell, its environment extended by
+// env, and its output going to stderr. It does not wait for the command to
+// finish, but reports on stderr if it fails.
+func startCommand(command string, env []string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --alert-exec: %v\n", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// parseAlert
+// =============================================================================
+
+func TestParseAlert(t *testing.T) {
+	r, err := parseAlert("level=error service=api count>50 window=30s", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.threshold != 50 || r.window != 30*time.Second {
+		t.Errorf("threshold, window = %d, %s; want 50, 30s", r.threshold, r.window)
+	}
+	if !r.match.Match(parser.NewEntry(map[string]any{"level": "error", "service": "api"})) || r.match.Match(parser.NewEntry(map[string]any{"level": "error"})) {
+		t.Error("filters do not require every condition")
+	}
+
+	r, err = parseAlert("count>=5", time.UTC)
+	if err != nil || r.threshold != 4 || r.window != defaultAlertWindow {
+		t.Errorf("count>=5: threshold, window = %d, %s (err %v); want 4, 1m", r.threshold, r.window, err)
+	}
+}
+
+func TestParseAlert_Errors(t *testing.T) {
+	for _, spec := range []string{
+		"level=error",
+		"level=error count>many",
+		"count>=0",
+		"count>5 window=-1m",
+		"count>5 window=soon",
+		"count>5 level",
+	} {
+		if _, err := parseAlert(spec, time.UTC); err == nil {
+			t.Errorf("parseAlert(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+// =============================================================================
+// alerter
+// =============================================================================
+
+func TestAlerter_FiresOncePerBurst(t *testing.T) {
+	r, err := parseAlert("level=error count>2 window=10s", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	var started []string
+	a := &alerter{rules: []*alertRule{r}, command: "notify", w: &buf, loc: time.UTC, now: time.Now,
+		start: func(command string, env []string) error {
+			started = append(started, command+" "+strings.Join(env, " "))
+			return nil
+		}}
+	for _, e := range []struct {
+		sec   int
+		level string
+	}{
+		{0, "error"}, {1, "info"}, {2, "error"}, {3, "error"}, // fires at 3s
+		{4, "error"}, {5, "error"}, // still over the threshold
+		{30, "error"},                               // the window has emptied: rearmed
+		{31, "error"}, {32, "error"}, {33, "error"}, // fires again at 32s
+	} {
+		ts := time.Date(2024, 1, 15, 10, 0, e.sec, 0, time.UTC).Format(time.RFC3339)
+		a.observe(parser.NewEntry(map[string]any{"time": ts, "level": e.level}))
+	}
+	want := `ALERT level=error count>2 window=10s: 3 matching entries within 10s, at 2024-01-15T10:00:03Z
+ALERT level=error count>2 window=10s: 3 matching entries within 10s, at 2024-01-15T10:00:32Z
+`
+	if buf.String() != want {
+		t.Errorf("alerts =\n%s\nwant\n%s", buf.String(), want)
+	}
+	if len(started) != 2 || started[0] != "notify LOGPIPE_ALERT_RULE=level=error count>2 window=10s LOGPIPE_ALERT_COUNT=3 LOGPIPE_ALERT_TIME=2024-01-15T10:00:03Z" {
+		t.Errorf("commands started = %q", started)
+	}
+}
+
+func TestAlerter_SlidingWindow(t *testing.T) {
+	r, err := parseAlert("count>2 window=10s", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	a := &alerter{rules: []*alertRule{r}, w: &buf, loc: time.UTC, now: time.Now}
+	// Never more than two entries within any ten seconds.
+	for _, sec := range []int{0, 6, 12, 18, 24, 30} {
+		ts := time.Date(2024, 1, 15, 10, 0, sec, 0, time.UTC).Format(time.RFC3339)
+		a.observe(parser.NewEntry(map[string]any{"time": ts}))
+	}
+	if buf.Len() != 0 {
+		t.Errorf("alerts = %q, want none", buf.String())
+	}
+}
+
+func TestRun_FollowAlertErrors(t *testing.T) {
+	path := writeLog(t, cliLog)
+	for _, args := range [][]string{
+		{"follow", "-alert", "level=error", path},
+		{"follow", "-alert-exec", "true", path},
+	} {
+		if _, code := runCapture(t, args...); code != 2 {
+			t.Errorf("%v: exit code = %d, want 2", args, code)
+		}
+	}
+}
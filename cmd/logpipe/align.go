@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// alignWindow is how many matching entries -align measures before writing
+// the first, and alignWait how long it waits for them at most, so that a
+// slow stream such as a followed file is not held up.
+const (
+	alignWindow = 200
+	alignWait   = 250 * time.Millisecond
+)
+
+// aligner holds back the first matching entries of a stream until their
+// columns have been measured, so that an aligned text formatter, or a
+// table formatter, pads the first lines as wide as the ones that follow
+// them.
+type aligner struct {
+	f      measurer
+	window int
+	wait   time.Duration
+}
+
+// measurer is a formatter that lays entries out in columns as wide as the
+// entries it has measured: an aligned *formatter.TextFormatter or a
+// *formatter.TableFormatter.
+type measurer interface {
+	formatter.Formatter
+	Measure(entry *parser.LogEntry)
+}
+
+// newAligner returns an aligner that measures entries for f.
+func newAligner(f measurer) *aligner {
+	return &aligner{f: f, window: alignWindow, wait: alignWait}
+}
+
+// aligned returns the entries to format and the filter to apply to them:
+// entries and match, or with an aligner, the entries satisfying match,
+// which need no further filtering.
+//
+// The first window matching entries are measured and held back until
+// there are window of them, entries is closed, or wait has passed since
+// the first; the rest are passed straight on and measured as they are
+// formatted. The channel is closed once entries is; after ctx is done
+// nothing more is sent, and the rest of entries is drained and released.
+func (a *aligner) aligned(ctx context.Context, entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool) (<-chan *parser.LogEntry, func(*parser.LogEntry) bool) {
+	if a == nil {
+		return entries, match
+	}
+	out := make(chan *parser.LogEntry)
+	go func() {
+		defer close(out)
+		ok := true
+		send := func(entry *parser.LogEntry) {
+			if !ok {
+				parser.Release(entry)
+				return
+			}
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				parser.Release(entry)
+				ok = false
+			}
+		}
+
+		held := make([]*parser.LogEntry, 0, a.window)
+		var deadline <-chan time.Time
+	measure:
+		for len(held) < a.window {
+			select {
+			case entry, more := <-entries:
+				if !more {
+					break measure
+				}
+				if !match(entry) {
+					parser.Release(entry)
+					continue
+				}
+				a.f.Measure(entry)
+				held = append(held, entry)
+				if deadline == nil {
+					t := time.NewTimer(a.wait)
+					defer t.Stop()
+					deadline = t.C
+				}
+			case <-deadline:
+				break measure
+			}
+		}
+		for _, entry := range held {
+			send(entry)
+		}
+		for entry := range entries {
+			if match(entry) {
+				send(entry)
+			} else {
+				parser.Release(entry)
+			}
+		}
+	}()
+	return out, func(*parser.LogEntry) bool { return true }
+}
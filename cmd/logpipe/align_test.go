@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// aligner
+// =============================================================================
+
+func TestAligner_MeasuresBeforeSending(t *testing.T) {
+	tf := &formatter.TextFormatter{Align: true}
+	a := &aligner{f: tf, window: 10, wait: time.Hour}
+	in := make(chan *parser.LogEntry, 3)
+	in <- parser.NewEntry(map[string]any{"level": "info", "msg": "short", "k": "v"})
+	in <- parser.NewEntry(map[string]any{"level": "debug", "msg": "skipped by the filter"})
+	in <- parser.NewEntry(map[string]any{"level": "info", "msg": "a longer message", "k": "v"})
+	close(in)
+	entries, match := a.aligned(context.Background(), in, func(e *parser.LogEntry) bool { return e.Fields["level"] == "info" })
+
+	var got []string
+	for entry := range entries {
+		if !match(entry) {
+			t.Fatal("aligned entries should need no further filtering")
+		}
+		got = append(got, formatLine(t, tf, entry))
+	}
+	want := []string{"[INFO ] short            k=v\n", "[INFO ] a longer message k=v\n"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestAligner_StopsWaitingForSlowInput(t *testing.T) {
+	a := &aligner{f: &formatter.TextFormatter{Align: true}, window: 10, wait: 10 * time.Millisecond}
+	in := make(chan *parser.LogEntry, 1)
+	in <- parser.NewEntry(map[string]any{"msg": "first"})
+	entries, _ := a.aligned(context.Background(), in, func(*parser.LogEntry) bool { return true })
+	select {
+	case e := <-entries:
+		if e.Fields["msg"] != "first" {
+			t.Errorf("entry = %v, want the first", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first entry was held back while the input stayed open")
+	}
+	close(in)
+}
+
+// formatLine formats entry with f and returns the text.
+func formatLine(t *testing.T, f formatter.Formatter, entry *parser.LogEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := f.Format(&buf, entry); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
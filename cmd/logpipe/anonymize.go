@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// pseudonymPrefix starts every pseudonym, so that they are recognizable as
+// such in shared logs.
+const pseudonymPrefix = "anon_"
+
+// anonymizer implements -anonymize: it replaces the values of some fields
+// of the matching entries with pseudonyms, an HMAC-SHA256 of the value
+// under a key. The same value always gets the same pseudonym under the
+// same key, whichever field it is in, so entries can still be correlated.
+// The key is random for each run unless it is read from a salt file, which
+// keeps pseudonyms stable from one run to the next.
+type anonymizer struct {
+	fields   []string
+	key      []byte
+	saltPath string // "" for a random key
+}
+
+// newAnonymizer returns the anonymizer for the comma-separated fields,
+// keyed with the contents of the file saltPath or, when it is "", a random
+// key. It returns nil when fields is empty.
+func newAnonymizer(fields, saltPath string) (*anonymizer, error) {
+	if fields == "" {
+		if saltPath != "" {
+			return nil, fmt.Errorf("--anonymize-salt requires --anonymize")
+		}
+		return nil, nil
+	}
+	a := &anonymizer{saltPath: saltPath}
+	for _, f := range strings.Split(fields, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			return nil, fmt.Errorf("invalid --anonymize %q: empty field name", fields)
+		}
+		a.fields = append(a.fields, f)
+	}
+	if saltPath == "" {
+		a.key = make([]byte, 32)
+		if _, err := rand.Read(a.key); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	salt, err := os.ReadFile(saltPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading salt: %w", err)
+	}
+	// A trailing newline left by an editor or echo is not part of the salt.
+	if a.key = bytes.TrimSpace(salt); len(a.key) == 0 {
+		return nil, fmt.Errorf("salt file %s is empty", saltPath)
+	}
+	return a, nil
+}
+
+// pseudonym returns the pseudonym of v: the prefix and the first 16 hex
+// digits of the HMAC of its text.
+func (a *anonymizer) pseudonym(v any) string {
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(s))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// apply replaces the anonymized fields of entry, which has already
+// matched, so filters still see the real values. Fields that are missing
+// or null are left alone. It always keeps entry.
+func (a *anonymizer) apply(entry *parser.LogEntry) bool {
+	for _, f := range a.fields {
+		if v, ok := entry.Fields[f]; ok && v != nil {
+			entry.Fields[f] = a.pseudonym(v)
+		}
+	}
+	return true
+}
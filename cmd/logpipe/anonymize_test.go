@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+const userLog = `{"level":"error","user_id":42,"email":"ann@example.com","msg":"a"}
+{"level":"info","user_id":7,"email":"bob@example.com","msg":"b"}
+{"level":"error","user_id":42,"email":"ann@example.com","msg":"c"}
+`
+
+// writeSalt writes salt to a file in a fresh temporary directory and
+// returns its path.
+func writeSalt(t *testing.T, salt string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "salt")
+	if err := os.WriteFile(path, []byte(salt), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// =============================================================================
+// anonymizer
+// =============================================================================
+
+func TestNewAnonymizer(t *testing.T) {
+	a, err := newAnonymizer("", "")
+	if a != nil || err != nil {
+		t.Errorf("newAnonymizer(\"\") = %v, %v; want nil, nil", a, err)
+	}
+	a, err = newAnonymizer("user_id, email", writeSalt(t, "s3cret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(a.fields, ",") != "user_id,email" || string(a.key) != "s3cret" {
+		t.Errorf("anonymizer = %q, key %q", a.fields, a.key)
+	}
+	for _, tt := range []struct{ fields, salt string }{
+		{"", writeSalt(t, "s3cret")},
+		{"user_id,,email", ""},
+		{"user_id", writeSalt(t, " \n")},
+		{"user_id", filepath.Join(t.TempDir(), "missing")},
+	} {
+		if _, err := newAnonymizer(tt.fields, tt.salt); err == nil {
+			t.Errorf("newAnonymizer(%q, %q): expected error", tt.fields, tt.salt)
+		}
+	}
+}
+
+func TestAnonymizer_Pseudonym(t *testing.T) {
+	salt := writeSalt(t, "s3cret")
+	a, _ := newAnonymizer("user_id", salt)
+	b, _ := newAnonymizer("user_id", salt)
+	got := a.pseudonym("ann@example.com")
+	if !strings.HasPrefix(got, pseudonymPrefix) || len(got) != len(pseudonymPrefix)+16 {
+		t.Errorf("pseudonym = %q", got)
+	}
+	if b.pseudonym("ann@example.com") != got {
+		t.Error("the same salt gave different pseudonyms")
+	}
+	if a.pseudonym("bob@example.com") == got {
+		t.Error("different values gave the same pseudonym")
+	}
+	if a.pseudonym(float64(42)) != a.pseudonym("42") {
+		t.Error("a number and its text gave different pseudonyms")
+	}
+	r, _ := newAnonymizer("user_id", "")
+	if r.pseudonym("ann@example.com") == got {
+		t.Error("a random key gave the salted pseudonym")
+	}
+}
+
+func TestAnonymizer_Apply(t *testing.T) {
+	a, _ := newAnonymizer("user_id,email", writeSalt(t, "s3cret"))
+	cfg := &pipelineConfig{match: func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }, accept: []stage{a.apply}}
+	match := cfg.process
+
+	entry := parser.NewEntry(map[string]any{"level": "error", "user_id": float64(42), "email": nil, "msg": "a"})
+	if !match(entry) {
+		t.Fatal("entry did not match")
+	}
+	if entry.Fields["user_id"] != a.pseudonym(float64(42)) || entry.Fields["email"] != nil || entry.Fields["msg"] != "a" {
+		t.Errorf("entry = %v", entry)
+	}
+	entry = parser.NewEntry(map[string]any{"level": "info", "user_id": float64(7)})
+	if match(entry) || entry.Fields["user_id"] != float64(7) {
+		t.Errorf("entry = %v, want a non-matching entry left alone", entry)
+	}
+}
+
+// =============================================================================
+// -anonymize
+// =============================================================================
+
+func TestRun_Anonymize(t *testing.T) {
+	path := writeLog(t, userLog)
+	salt := writeSalt(t, "s3cret")
+	a, _ := newAnonymizer("user_id,email", salt)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-filter", "user_id=42", "-anonymize", "user_id,email", "-anonymize-salt", salt, path)
+	line := "level=error user_id=" + a.pseudonym("42") + " email=" + a.pseudonym("ann@example.com")
+	if code != 0 || out != line+" msg=a\n"+line+" msg=c\n" {
+		t.Errorf("output (exit %d) =\n%s", code, out)
+	}
+	if strings.Contains(out, "ann@") {
+		t.Errorf("output leaks the email:\n%s", out)
+	}
+
+	// Without a salt the pseudonyms still correlate within the run.
+	out, _ = runCapture(t, "stats", "-field", "user_id", "-anonymize", "user_id", path)
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], pseudonymPrefix) || !strings.HasSuffix(lines[0], ": 2") {
+		t.Errorf("stats output =\n%s", out)
+	}
+
+	if _, code := runCapture(t, "view", "-anonymize-salt", salt, path); code != 1 {
+		t.Errorf("-anonymize-salt alone: exit code = %d, want 1", code)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/internal/avro"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// avroFormatter implements -format avro: it writes entries as records of
+// an Avro object container file at path rather than to the writer it is
+// given, which only ever receives text. The file is created when the
+// first entry is formatted, or by Close when there are none. Without
+// -schema the entries are held until Close, which infers a schema that
+// covers every one of them before writing them all.
+type avroFormatter struct {
+	path       string
+	schemaPath string       // "" to infer the schema
+	schema     *avro.Schema // nil until inferred
+	held       []map[string]any
+	file       *os.File
+	buf        *bufio.Writer
+	w          *avro.Writer
+}
+
+// newAvroFormatter returns the formatter for -format avro writing to path
+// with the schema in the file schemaPath, or an inferred one when it is "".
+func newAvroFormatter(path, schemaPath string) (*avroFormatter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("--format avro requires --output, as Avro is written to a file")
+	}
+	af := &avroFormatter{path: path, schemaPath: schemaPath}
+	if schemaPath != "" {
+		src, err := os.ReadFile(schemaPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading schema: %w", err)
+		}
+		if af.schema, err = avro.Parse(src); err != nil {
+			return nil, fmt.Errorf("%s: %w", schemaPath, err)
+		}
+	}
+	return af, nil
+}
+
+// Format appends entry to the file, or holds a copy of it while the schema
+// is still to be inferred.
+func (a *avroFormatter) Format(_ io.Writer, entry *parser.LogEntry) error {
+	// A copy, as the entry is released once formatted, without the
+	// entry's record of its key order.
+	rec := make(map[string]any, entry.Len())
+	for _, k := range entry.Keys() {
+		rec[k] = entry.Fields[k]
+	}
+	if a.schema == nil {
+		a.held = append(a.held, rec)
+		return nil
+	}
+	if err := a.open(); err != nil {
+		return err
+	}
+	return a.w.Append(rec)
+}
+
+// open creates the file and writes its header, unless that has been done.
+func (a *avroFormatter) open() error {
+	if a.w != nil {
+		return nil
+	}
+	f, err := os.Create(a.path)
+	if err != nil {
+		return err
+	}
+	a.file, a.buf = f, bufio.NewWriter(f)
+	if a.w, err = avro.NewWriter(a.buf, a.schema); err != nil {
+		f.Close()
+		return err
+	}
+	return nil
+}
+
+// Close writes the held entries, if the schema was to be inferred, and
+// the last block of records, and closes the file.
+func (a *avroFormatter) Close() error {
+	if err := a.close(); err != nil {
+		return fmt.Errorf("writing %s: %w", a.path, err)
+	}
+	return nil
+}
+
+// close does the work of Close.
+func (a *avroFormatter) close() error {
+	if a.schema == nil {
+		a.schema = avro.Infer(a.held)
+	}
+	if err := a.open(); err != nil {
+		return err
+	}
+	for _, rec := range a.held {
+		if err := a.w.Append(rec); err != nil {
+			a.file.Close()
+			return err
+		}
+	}
+	a.held = nil
+	err := a.w.Flush()
+	if err == nil {
+		err = a.buf.Flush()
+	}
+	if cerr := a.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sink is a formatter that delivers entries somewhere of its own rather
+// than to the writer it is given, such as a file or a service, and has
+// more to do once the last has been formatted.
+type sink interface {
+	formatter.Formatter
+	Close() error
+}
+
+// closeOutput finishes the output of -format avro, parquet, loki or
+// syslog or of -split-by, and the -output file, if there are any, and returns the exit
+// code for a run that would otherwise exit with code. An -atomic file
+// replaces the one it names only when that code is 0.
+func (cfg *pipelineConfig) closeOutput(code int) int {
+	if cfg.output != nil {
+		if err := cfg.output.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			code = 1
+		}
+	}
+	if err := cfg.file.close(code == 0); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return code
+}
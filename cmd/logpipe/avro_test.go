@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// -format avro
+// =============================================================================
+
+func TestRun_FormatAvro_InferredSchema(t *testing.T) {
+	path := writeLog(t, cliLog)
+	outPath := filepath.Join(t.TempDir(), "out.avro")
+	out, code := runCapture(t, "view", "-format", "avro", "-output", outPath, "-filter", "level=error", path)
+	if code != 0 || out != "" {
+		t.Fatalf("output (exit %d) = %q, want nothing on stdout", code, out)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := `{"type":"record","name":"LogEntry","namespace":"logpipe","fields":[` +
+		`{"name":"level","type":["null","string"],"default":null},` +
+		`{"name":"msg","type":["null","string"],"default":null},` +
+		`{"name":"time","type":["null","string"],"default":null}]}`
+	switch {
+	case !bytes.HasPrefix(data, []byte("Obj\x01")):
+		t.Errorf("file does not start with the Avro magic: %q", data)
+	case !bytes.Contains(data, []byte(schema)):
+		t.Errorf("file has no inferred schema %s:\n%q", schema, data)
+	// Each record is a union index of 2 and a 1-byte string, "b" and "c".
+	case !bytes.Contains(data, []byte("\x02\x02b")) || !bytes.Contains(data, []byte("\x02\x02c")) || bytes.Contains(data, []byte("\x02\x02a")):
+		t.Errorf("file does not hold the matching entries:\n%q", data)
+	}
+}
+
+func TestRun_FormatAvro_Schema(t *testing.T) {
+	path := writeLog(t, cliLog)
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "entry.avsc")
+	os.WriteFile(schemaPath, []byte(`{"type": "record", "name": "Entry", "fields": [
+		{"name": "time", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "msg", "type": "string"}
+	]}`), 0o644)
+	outPath := filepath.Join(dir, "out.avro")
+	if _, code := runCapture(t, "view", "-format", "avro", "-schema", schemaPath, "-output", outPath, path); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	data, _ := os.ReadFile(outPath)
+	if !bytes.Contains(data, []byte(`{"type":"record","name":"Entry","fields":[`)) {
+		t.Errorf("file does not hold the given schema:\n%q", data)
+	}
+
+	// An entry that does not fit the schema fails the run, but the others
+	// are still written.
+	path = writeLog(t, cliLog+`{"time":"2024-01-15T10:00:04Z"}`+"\n")
+	if _, code := runCapture(t, "view", "-format", "avro", "-schema", schemaPath, "-output", outPath, path); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if data, _ := os.ReadFile(outPath); !bytes.Contains(data, []byte("\x02c")) {
+		t.Errorf("file does not hold the entries that fit:\n%q", data)
+	}
+}
+
+func TestRun_FormatAvro_Merge(t *testing.T) {
+	path := writeLog(t, cliLog)
+	outPath := filepath.Join(t.TempDir(), "out.avro")
+	if _, code := runCapture(t, "merge", "-format", "avro", "-output", outPath, path, path); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if data, _ := os.ReadFile(outPath); bytes.Count(data, []byte("\x02\x02a")) != 2 {
+		t.Errorf("file does not hold both copies of the entries:\n%q", data)
+	}
+}
+
+func TestRun_FormatAvro_Errors(t *testing.T) {
+	path := writeLog(t, cliLog)
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "out.avro")
+	badSchema := filepath.Join(dir, "bad.avsc")
+	os.WriteFile(badSchema, []byte(`{"type": "string"}`), 0o644)
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-format", "avro", path}, 1},
+		{[]string{"view", "-schema", badSchema, path}, 1},
+		{[]string{"view", "-format", "avro", "-output", outPath, "-schema", badSchema, path}, 1},
+		{[]string{"view", "-format", "avro", "-output", outPath, "-color-lines", path}, 1},
+		{[]string{"view", "-format", "avro", "-output", outPath, "-listen", "grpc://127.0.0.1:0"}, 1},
+		{[]string{"follow", "-format", "avro", "-output", outPath, path}, 2},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+	if _, err := os.Stat(outPath); err == nil {
+		t.Error("a failed run created the output file")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// benchResult holds the measurements from one benchmark run.
+type benchResult struct {
+	Bytes     int64         // Size of the input in bytes.
+	Entries   int           // Entries parsed successfully.
+	Malformed int           // Lines reported as parse errors.
+	Matched   int           // Entries that passed the filters and were formatted.
+	Elapsed   time.Duration // Wall-clock time of the run.
+	Mallocs   uint64        // Heap objects allocated during the run.
+	Allocated uint64        // Heap bytes allocated during the run.
+	GCs       uint32        // Garbage collections completed during the run.
+}
+
+// Lines returns the number of non-blank input lines the run processed.
+func (r benchResult) Lines() int {
+	return r.Entries + r.Malformed
+}
+
+// runBench implements "logpipe bench [flags] file": it runs the normal
+// parse, filter and format pipeline over the file with output discarded and
+// reports throughput and allocation figures. It returns the process exit
+// code.
+func runBench(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	g.register(fs)
+	g.registerSinks(fs)
+	filePath := fs.String("file", "", "Path to the log file to benchmark (required)")
+	cpuProfile := fs.String("cpuprofile", "", "Write a CPU profile of the run to this file")
+	memProfile := fs.String("memprofile", "", "Write a heap profile taken after the run to this file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe bench [flags] file\n\n")
+		fmt.Fprintf(fs.Output(), "Runs the parse, filter and format pipeline over a file with output\ndiscarded and reports throughput and allocation statistics.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	path, err := fileArg(fs, *filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if path == "" {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if cfg.file != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output with --format %s cannot be used with bench, which discards the formatted entries\n", g.format)
+		return 2
+	}
+
+	f, err := input.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: opening file: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: opening file: %v\n", err)
+		return 1
+	}
+
+	r, p, inFormat, err := cfg.parserFor(f, g.input, cfg.readOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *cpuProfile != "" {
+		stop, err := startCPUProfile(*cpuProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting CPU profile: %v\n", err)
+			return 1
+		}
+		defer stop()
+	}
+
+	res := bench(r, p, cfg.process, cfg.formatter)
+	if code := cfg.closeOutput(0); code != 0 {
+		return code
+	}
+	res.Bytes = info.Size()
+	fmt.Printf("file:       %s (%s)\n", path, inFormat)
+	printBench(os.Stdout, res)
+
+	if *memProfile != "" {
+		if err := writeHeapProfile(*memProfile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing heap profile: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// bench drains every entry p parses from r through match and f, discarding
+// the formatted output, and returns the counts, elapsed time and allocation
+// deltas for the run. The Bytes field is left for the caller to fill in.
+func bench(r io.Reader, p parser.Parser, match func(*parser.LogEntry) bool, f formatter.Formatter) benchResult {
+	var res benchResult
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	entries, errs := p.Parse(r)
+	errsDone := make(chan struct{})
+	go func() {
+		defer close(errsDone)
+		for err := range errs {
+			var lineErr *parser.LineError
+			if errors.As(err, &lineErr) {
+				res.Malformed++
+			}
+		}
+	}()
+	for entry := range entries {
+		res.Entries++
+		if match(entry) {
+			if err := f.Format(io.Discard, entry); err == nil {
+				res.Matched++
+			}
+		}
+		parser.Release(entry)
+	}
+	<-errsDone
+
+	res.Elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	res.Mallocs = after.Mallocs - before.Mallocs
+	res.Allocated = after.TotalAlloc - before.TotalAlloc
+	res.GCs = after.NumGC - before.NumGC
+	return res
+}
+
+// printBench writes the human-readable benchmark report for res to w.
+func printBench(w io.Writer, res benchResult) {
+	secs := res.Elapsed.Seconds()
+	if secs <= 0 {
+		secs = 1e-9
+	}
+	const mb = 1 << 20
+	fmt.Fprintf(w, "size:       %.1f MB\n", float64(res.Bytes)/mb)
+	fmt.Fprintf(w, "lines:      %d (%d entries, %d malformed)\n", res.Lines(), res.Entries, res.Malformed)
+	fmt.Fprintf(w, "matched:    %d\n", res.Matched)
+	fmt.Fprintf(w, "elapsed:    %s\n", res.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput: %.0f lines/sec, %.1f MB/sec\n", float64(res.Lines())/secs, float64(res.Bytes)/mb/secs)
+	perLine := 0.0
+	if n := res.Lines(); n > 0 {
+		perLine = float64(res.Mallocs) / float64(n)
+	}
+	fmt.Fprintf(w, "allocs:     %d (%.1f per line), %.1f MB allocated, %d GCs\n", res.Mallocs, perLine, float64(res.Allocated)/mb, res.GCs)
+}
+
+// startCPUProfile starts writing a CPU profile to path and returns a
+// function that stops it and closes the file.
+func startCPUProfile(path string) (stop func(), err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		f.Close()
+	}, nil
+}
+
+// writeHeapProfile writes a heap profile, taken after a full collection, to
+// path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
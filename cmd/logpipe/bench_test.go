@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+func TestBench_CountsEntriesMalformedAndMatches(t *testing.T) {
+	input := `{"level":"error"}` + "\n" +
+		`not json` + "\n" +
+		"\n" +
+		`{"level":"info"}` + "\n" +
+		`{"level":"error"}` + "\n"
+	isError := func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }
+	res := bench(strings.NewReader(input), parser.NewJSONParser(), isError, &formatter.TextFormatter{})
+	if res.Entries != 3 || res.Malformed != 1 || res.Matched != 2 {
+		t.Errorf("entries=%d malformed=%d matched=%d, want 3 1 2", res.Entries, res.Malformed, res.Matched)
+	}
+	if res.Lines() != 4 {
+		t.Errorf("Lines() = %d, want 4", res.Lines())
+	}
+	if res.Elapsed <= 0 {
+		t.Errorf("Elapsed = %v, want > 0", res.Elapsed)
+	}
+}
+
+func TestPrintBench_ReportsThroughput(t *testing.T) {
+	res := benchResult{Bytes: 2 << 20, Entries: 1000, Elapsed: time.Second, Mallocs: 5000}
+	var out strings.Builder
+	printBench(&out, res)
+	for _, want := range []string{
+		"throughput: 1000 lines/sec, 2.0 MB/sec",
+		"allocs:     5000 (5.0 per line)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPrintBench_EmptyRun(t *testing.T) {
+	var out strings.Builder
+	printBench(&out, benchResult{}) // must not divide by zero
+	if !strings.Contains(out.String(), "lines:      0") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
+
+func TestRunBench_RequiresFile(t *testing.T) {
+	if code := runBench(newGlobalFlags(), []string{}); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestRunBench_WritesProfiles(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(log, []byte("level=info msg=hi\nlevel=error msg=boom\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cpu := filepath.Join(dir, "cpu.out")
+	mem := filepath.Join(dir, "mem.out")
+
+	var code int
+	out := captureStdout(t, func() {
+		code = runBench(newGlobalFlags(), []string{"-cpuprofile", cpu, "-memprofile", mem, log})
+	})
+	if !strings.Contains(out, "(logfmt)") {
+		t.Errorf("report does not name the detected format:\n%s", out)
+	}
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	for _, path := range []string{cpu, mem} {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("profile %s missing or empty (err=%v)", path, err)
+		}
+	}
+}
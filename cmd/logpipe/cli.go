@@ -0,0 +1,1302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tylermac92/logpipe/filter"
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// version is the release reported by -version. Release builds set it with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+// globalFlags holds the flags shared by every subcommand. They may be given
+// before the subcommand name (logpipe -input logfmt view ...) as well as
+// after it, and are also accepted when no subcommand is used at all.
+type globalFlags struct {
+	input       string
+	maxLineSize byteSize
+	onOversize  string
+	onError     string
+	keepRaw     bool
+	duplicates  string
+	numbers     string
+	strictFmt   bool
+	lineNumbers bool
+	mlStart     string
+	mlCont      string
+	csvColumns  string
+	assumeTZ    string
+	strict      strictMode
+	filters     multiFlag
+	query       string
+	jq          string
+	since       string
+	until       string
+	minLevel    string
+	validate    string
+	onInvalid   string
+	levelMap    string
+	every       int
+	everyKey    string
+	anonymize   string
+	anonSalt    string
+	flatten     bool
+	format      string
+	template    string
+	output      string
+	appendOut   bool
+	atomic      bool
+	splitBy     string
+	outputDir   string
+	avroSchema  string
+	lokiURL     string
+	lokiLabels  string
+	lokiTenant  string
+	lokiBatch   int
+	syslogAddr  string
+	syslogFac   string
+	syslogMap   string
+	pretty      bool
+	keyOrder    string
+	color       autoBool
+	colorLines  bool
+	wrap        bool
+	truncate    bool
+	width       int
+	maxWidth    int
+	truncField  string
+	noTruncate  bool
+	align       bool
+	icons       iconsMode
+	foldStacks  int
+	sanitize    autoBool
+	fields      string
+	values      multiFlag
+	rebaseTime  bool
+	timeDisplay string
+	timeFormat  string
+	tz          string
+	markGaps    time.Duration
+	noProgress  bool
+	plugins     multiFlag
+}
+
+// newGlobalFlags returns the global flags set to their defaults.
+func newGlobalFlags() *globalFlags {
+	return &globalFlags{
+		input:       "auto",
+		maxLineSize: byteSize(parser.DefaultMaxLineSize),
+		onOversize:  "skip",
+		onError:     "skip",
+		duplicates:  "last",
+		numbers:     "exact",
+		assumeTZ:    "UTC",
+		onInvalid:   "report",
+		format:      "text",
+		lokiBatch:   1000,
+		syslogFac:   "user",
+		timeDisplay: string(timeAbsolute),
+		keyOrder:    "input",
+	}
+}
+
+// registerInput defines the flags that control how input is parsed on fs.
+func (g *globalFlags) registerInput(fs *flag.FlagSet) {
+	fs.StringVar(&g.input, "input", g.input, "Input format: json, gcp (Google Cloud Logging), syslog (RFC 5424), syslog-bsd (RFC 3164), logfmt, csv, tsv, auto (default: auto)")
+	fs.Var(&g.maxLineSize, "max-line-size", "Longest input line to parse, in bytes (accepts K, M and G suffixes)")
+	fs.StringVar(&g.onOversize, "on-oversize", g.onOversize, "What to do with lines longer than --max-line-size: skip, truncate or error")
+	fs.StringVar(&g.onError, "on-error", g.onError, "What to do with lines that cannot be parsed: skip, raw (emit them as entries with a _raw field) or fail")
+	fs.BoolVar(&g.keepRaw, "keep-raw", g.keepRaw, "Also emit lines that cannot be parsed as entries with _raw and _source fields, whatever --on-error says")
+	fs.StringVar(&g.duplicates, "duplicate-keys", g.duplicates, "What to do with a key repeated in a logfmt line: keep the first or last value, or collect them all")
+	fs.StringVar(&g.numbers, "numbers", g.numbers, "How to decode JSON numbers: exact (keeping every digit) or float (as float64, rounding large integers)")
+	fs.StringVar(&g.assumeTZ, "assume-tz", g.assumeTZ, "Time zone of timestamps without a UTC offset, for merging and time filters: UTC, Local, an offset such as +02:00, or a zone name such as Europe/Paris")
+	fs.BoolVar(&g.strictFmt, "strict-logfmt", g.strictFmt, "Treat logfmt lines that are not well formed (bare keys, stray quotes or '=') as malformed, reporting the column of the problem")
+	fs.BoolVar(&g.lineNumbers, "line-numbers", g.lineNumbers, "Record the line number and byte offset each entry was read from as _line and _offset, and start text lines with the line number")
+	fs.StringVar(&g.mlStart, "multiline-start", g.mlStart, "Regular expression matching the first line of each entry; other lines are joined to the entry before them, for entries that span several lines")
+	fs.StringVar(&g.mlCont, "multiline-cont", g.mlCont, "Regular expression matching the lines that continue the entry before them; other lines start an entry of their own")
+	fs.StringVar(&g.csvColumns, "csv-columns", g.csvColumns, "Comma-separated names of the columns of --input csv or tsv, for files without a header row")
+	fs.StringVar(&g.levelMap, "level-map", g.levelMap, "Comma-separated spelling=level pairs mapping other level names and numbers to trace, debug, info, warn, error or fatal, such as notice=info,panic=fatal,30=info")
+	fs.Var(&g.strict, "strict", "Fail the run if any line cannot be parsed and report how many were skipped; -strict=stop also stops at the first such line")
+	fs.Var(&g.plugins, "plugin", "WebAssembly module providing parse, transform or format hooks (repeatable)")
+}
+
+// registerFilter defines the flags that select entries on fs.
+func (g *globalFlags) registerFilter(fs *flag.FlagSet) {
+	fs.Var(&g.filters, "filter", "Filter expression (e.g. level=error, time>=2024-01-01T00:00:00Z)")
+	fs.StringVar(&g.query, "query", g.query, "Filter query combining expressions with and, or, not and parentheses, such as '(level=error or level=warn) and service!=cron'; entries must also satisfy any -filter")
+	fs.StringVar(&g.jq, "jq", g.jq, "jq expression run on each matching entry, such as '.level==\"error\" and (.latency|tonumber)>1': true keeps the entry, false or null drops it, and an object replaces its fields")
+	fs.StringVar(&g.minLevel, "min-level", g.minLevel, "Keep only entries at least this severe: trace, debug, info, warn, error or fatal, counting aliases such as warning and crit and pino's numeric levels")
+	fs.StringVar(&g.since, "since", g.since, "Keep only entries timestamped at or after this time: a timestamp such as 2024-01-15T10:00:00Z, or a duration before now such as 15m, 2h or 7d")
+	fs.StringVar(&g.until, "until", g.until, "Keep only entries timestamped before this time: a timestamp, or a duration before now such as 15m, 2h or 7d")
+	fs.StringVar(&g.validate, "validate", g.validate, "JSON Schema file to check each matching entry against, reporting violations on stderr")
+	fs.StringVar(&g.onInvalid, "on-invalid", g.onInvalid, "What to do with entries that fail --validate: report (and keep them), drop, or only (keep only them)")
+	fs.IntVar(&g.every, "every", g.every, "Keep only the first matching entry and every Nth one after it, a reproducible alternative to sampling")
+	fs.StringVar(&g.everyKey, "every-key", g.everyKey, "Field whose values --every counts separately, keeping every Nth entry of each")
+	fs.StringVar(&g.anonymize, "anonymize", g.anonymize, "Comma-separated fields whose values are replaced with keyed-hash pseudonyms in matching entries, the same for the same value, such as user_id,email")
+	fs.StringVar(&g.anonSalt, "anonymize-salt", g.anonSalt, "File whose contents key the --anonymize pseudonyms, so they stay the same from run to run (default: a random key per run)")
+}
+
+// registerOutput defines the flags that control output formatting on fs.
+func (g *globalFlags) registerOutput(fs *flag.FlagSet) {
+	fs.StringVar(&g.format, "format", g.format, "Output format: text, json, logfmt, table (aligned columns of --fields under a header row), template, avro or parquet (to --output), loki (pushed to --loki-url) or syslog (sent to --syslog-addr)")
+	fs.StringVar(&g.template, "template", g.template, "Go text/template that --format template writes each entry with, such as '{{.time}} {{.level}} {{.msg}}'")
+	fs.BoolVar(&g.pretty, "pretty", g.pretty, "Pretty-print JSON output (json format only)")
+	fs.StringVar(&g.keyOrder, "key-order", g.keyOrder, "Order of the members of JSON output: input (as they were read), canonical (time, level and message first, then alphabetical), alphabetical, or comma-separated fields to put first, such as time,level,msg,service, the rest following alphabetically (json format only)")
+	fs.Var(&g.color, "color", "Color output: auto, which colors it when writing to a terminal and NO_COLOR is not set, always or never; -color alone is always (text and table formats)")
+	fs.BoolVar(&g.colorLines, "color-lines", g.colorLines, "Color each whole line by its level: dim for debug, yellow for warnings, red for errors (text format only)")
+	fs.BoolVar(&g.wrap, "wrap", g.wrap, "Wrap lines wider than the terminal at spaces, indenting the continuations to where the message starts (text format only)")
+	fs.BoolVar(&g.truncate, "truncate", g.truncate, "Cut lines wider than the terminal short with an ellipsis (text format only)")
+	fs.Var(&g.icons, "icons", "Mark each level with a symbol, such as ✖ for errors and ⚠ for warnings, before the bracketed level; -icons=only shows the symbol alone (text format only)")
+	fs.BoolVar(&g.align, "align", g.align, "Pad the time, level, _source and --fields of text lines into columns that line up from one entry to the next")
+	fs.IntVar(&g.foldStacks, "fold-stacks", g.foldStacks, "Cut stack traces in multi-line messages and error and stack fields down to this many frames and a count of the rest (text format only)")
+	fs.IntVar(&g.width, "width", g.width, "Width to --wrap or --truncate lines to, instead of the terminal's")
+	fs.IntVar(&g.maxWidth, "max-width", g.maxWidth, "Cut the message and field values of text lines longer than this many characters short with an ellipsis (text format only)")
+	fs.StringVar(&g.truncField, "truncate-field", g.truncField, "Comma-separated field=N pairs cutting the named fields short at N characters instead of --max-width, 0 for never, such as msg=200,stack=0 (text format only)")
+	fs.BoolVar(&g.noTruncate, "no-truncate", g.noTruncate, "Cut nothing short, whatever --truncate, --max-width and --truncate-field, such as from a profile or the environment, say")
+	fs.Var(&g.sanitize, "sanitize", "Escape control characters in field values: true, false or auto, which escapes them when writing to a terminal (text and table formats)")
+	fs.StringVar(&g.fields, "fields", g.fields, "Comma-separated list of fields to display (text and table formats)")
+	fs.BoolVar(&g.flatten, "flatten", g.flatten, "Replace nested objects with their members under dotted names, such as meta.host=srv1, so that each is shown, and chosen with --fields, as a field of its own")
+	fs.Var(&g.values, "value", "Print only the raw value of this field, one entry per line, instead of formatting entries (repeatable; several values are separated by tabs)")
+	fs.BoolVar(&g.rebaseTime, "rebase-time", g.rebaseTime, "Rewrite each entry's timestamp as its offset from the first entry's, such as +1.532s")
+	fs.StringVar(&g.timeDisplay, "time-display", g.timeDisplay, "How text lines show timestamps: absolute (the time of day), relative (how long before now, such as 3m ago) or elapsed (the offset from the first entry, such as +00:02:15)")
+	fs.StringVar(&g.timeFormat, "time-format", g.timeFormat, "Layout text lines show timestamps with: a Go layout such as '2006-01-02 15:04:05.000', or strftime such as '%F %T' (default: 15:04:05)")
+	fs.StringVar(&g.tz, "tz", g.tz, "Time zone text lines show timestamps in: UTC, Local, an offset such as +02:00, or a zone name such as America/Chicago (default: UTC)")
+	fs.DurationVar(&g.markGaps, "mark-gaps", g.markGaps, "Write a separator line, such as \"―――― 42s gap ――――\", between consecutive entries whose timestamps are farther apart than this, such as 5s (text format only)")
+	fs.BoolVar(&g.noProgress, "no-progress", g.noProgress, "Never show a progress bar on stderr while reading a file")
+}
+
+// registerSinks defines -output, which writes results to a file, and the
+// flags that -format avro, parquet, loki and syslog deliver entries with on
+// fs. They are not global flags, as sql and report have an -output of
+// their own.
+func (g *globalFlags) registerSinks(fs *flag.FlagSet) {
+	fs.StringVar(&g.output, "output", g.output, "File to write output to instead of stdout, replacing it; required with --format avro and parquet, as they are binary")
+	fs.BoolVar(&g.appendOut, "append", g.appendOut, "Add to the --output file, or the --split-by files, instead of replacing them")
+	fs.BoolVar(&g.atomic, "atomic", g.atomic, "Write the --output file to a temporary file beside it that replaces it only once the run has succeeded, so it is never seen half written")
+	fs.StringVar(&g.splitBy, "split-by", g.splitBy, "Field whose value picks the file in --output-dir each entry is written to, such as service for out/checkout.log")
+	fs.StringVar(&g.outputDir, "output-dir", g.outputDir, "Directory to write the --split-by files to, created if need be")
+	fs.StringVar(&g.avroSchema, "schema", g.avroSchema, "Avro schema (.avsc) to write --format avro records with (default: inferred from the entries)")
+	fs.StringVar(&g.lokiURL, "loki-url", g.lokiURL, "Grafana Loki to push --format loki entries to, such as http://localhost:3100, or the full URL of its push API")
+	fs.StringVar(&g.lokiLabels, "loki-labels", g.lokiLabels, "Comma-separated fields whose values label the Loki streams of --format loki entries, and constant labels such as job=backfill")
+	fs.StringVar(&g.lokiTenant, "loki-tenant", g.lokiTenant, "Tenant to push --format loki entries as, sent as the X-Scope-OrgID header")
+	fs.IntVar(&g.lokiBatch, "loki-batch", g.lokiBatch, "Entries to push to Loki in each request with --format loki")
+	fs.StringVar(&g.syslogAddr, "syslog-addr", g.syslogAddr, "Syslog collector to send --format syslog entries to as RFC 5424 messages: udp://, tcp:// or tls:// and host[:port]")
+	fs.StringVar(&g.syslogFac, "syslog-facility", g.syslogFac, "Facility of the messages --format syslog sends, such as local0")
+	fs.StringVar(&g.syslogMap, "syslog-fields", g.syslogMap, "Comma-separated part=field pairs naming the fields --format syslog takes the level, msg, host, app, procid and msgid of its messages from, such as msg=message,app=service")
+}
+
+// fitLines sets up f, which must be a text formatter, to fit its lines to
+// the terminal, or to -width, for -wrap and -truncate. Output that is not
+// to a terminal is left alone unless -width is given, and -no-truncate
+// turns -truncate off.
+func (g *globalFlags) fitLines(f formatter.Formatter) error {
+	truncate := g.truncate && !g.noTruncate
+	switch {
+	case g.width < 0:
+		return fmt.Errorf("--width must not be negative")
+	case g.wrap && truncate:
+		return fmt.Errorf("--wrap cannot be combined with --truncate")
+	case !g.wrap && !truncate:
+		if g.width > 0 && !g.noTruncate {
+			return fmt.Errorf("--width requires --wrap or --truncate")
+		}
+		return nil
+	}
+	tf, ok := f.(*formatter.TextFormatter)
+	if !ok {
+		if g.wrap {
+			return fmt.Errorf("--wrap requires text output")
+		}
+		return fmt.Errorf("--truncate requires text output")
+	}
+	tf.Width = g.width
+	if tf.Width == 0 && g.toTerminal() {
+		tf.Width = terminalWidth(os.Stdout)
+	}
+	tf.Wrap = g.wrap
+	return nil
+}
+
+// limitValues sets up f, which must be a text formatter, to cut long
+// messages and field values short for -max-width and -truncate-field,
+// unless -no-truncate turns them off.
+func (g *globalFlags) limitValues(f formatter.Formatter) error {
+	if g.maxWidth < 0 {
+		return fmt.Errorf("--max-width must not be negative")
+	}
+	limits, err := parseFieldLimits(g.truncField)
+	if err != nil {
+		return err
+	}
+	if g.noTruncate || (g.maxWidth == 0 && limits == nil) {
+		return nil
+	}
+	tf, ok := f.(*formatter.TextFormatter)
+	if !ok {
+		if g.maxWidth > 0 {
+			return fmt.Errorf("--max-width requires text output")
+		}
+		return fmt.Errorf("--truncate-field requires text output")
+	}
+	tf.MaxValue, tf.Limits = g.maxWidth, limits
+	return nil
+}
+
+// parseFieldLimits parses the -truncate-field spec: comma-separated
+// field=N pairs, such as msg=200, each giving the most characters of the
+// field to write, or 0 for no limit. It returns nil for an empty spec.
+func parseFieldLimits(spec string) (map[string]int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(spec, ",") {
+		field, n, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		limit, err := strconv.Atoi(n)
+		if !ok || field == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid --truncate-field %q (want field=N pairs, such as msg=200)", pair)
+		}
+		limits[field] = limit
+	}
+	return limits, nil
+}
+
+// parseKeyOrder parses the -key-order spec into the KeyOrder of a
+// formatter.JSONFormatter: canonical for formatter.CanonicalKeys,
+// alphabetical for none, or the comma-separated fields to put first.
+func parseKeyOrder(spec string) ([]string, error) {
+	switch spec {
+	case "canonical":
+		return formatter.CanonicalKeys, nil
+	case "alphabetical":
+		return []string{}, nil
+	}
+	var keys []string
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || slices.Contains(keys, field) {
+			return nil, fmt.Errorf("invalid --key-order %q (want input, canonical, alphabetical or distinct comma-separated fields)", spec)
+		}
+		keys = append(keys, field)
+	}
+	return keys, nil
+}
+
+// toTerminal reports whether output is written to a terminal: to stdout,
+// rather than to an -output or -split-by file, with stdout a terminal.
+func (g *globalFlags) toTerminal() bool {
+	return g.output == "" && g.splitBy == "" && isTerminal(os.Stdout)
+}
+
+// useColor resolves -color: auto colors output written to a terminal,
+// unless the NO_COLOR environment variable is set to anything but the
+// empty string, as https://no-color.org asks.
+func (g *globalFlags) useColor() bool {
+	return g.color.resolve(g.toTerminal() && os.Getenv("NO_COLOR") == "")
+}
+
+// registerProfile defines the -profile flag on fs.
+func (g *globalFlags) registerProfile(fs *flag.FlagSet) {
+	fs.Var(&profileValue{g: g}, "profile", "Apply the flags saved under this name with 'logpipe profile save'")
+}
+
+// register defines every global flag on fs.
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	g.registerInput(fs)
+	g.registerFilter(fs)
+	g.registerOutput(fs)
+	g.registerProfile(fs)
+}
+
+// pipelineConfig is the validated form of the global flags.
+type pipelineConfig struct {
+	readOpts      parser.ReadOptions
+	columns       []string // -csv-columns
+	strict        bool
+	progress      bool
+	location      *time.Location // zone of timestamps without a UTC offset
+	filters       []filter.Filter
+	transforms    []stage                     // run on every entry before match: plugin transform hooks, then -level-map
+	match         func(*parser.LogEntry) bool // the filters, which only test the entry
+	accept        []stage                     // run on the matching entries: -validate, -jq, -every, -flatten, then -anonymize
+	jq            *jqProgram                  // nil without -jq
+	validator     *validator                  // nil without -validate
+	levels        *levelMap                   // nil without -level-map
+	sampler       *sampler                    // nil without -every
+	anonymizer    *anonymizer                 // nil without -anonymize
+	flatten       flattener
+	formatter     formatter.Formatter
+	plugins       *pluginHooks
+	dedupe        *deduper           // nil without -dedupe or -dedupe-window; set by the commands that take it
+	alerts        *alerter           // nil without -alert; set by follow
+	replay        *pacer             // nil without -replay; set by the commands that take it
+	compare       []compareColumn    // -compare columns of a stats table
+	statsFormat   string             // -stats-format of a stats table
+	statsTemplate *template.Template // -stats-template of a stats table, or nil
+	align         *aligner           // nil without -align
+	output        sink               // nil unless -format avro, parquet, loki or syslog, or -split-by; see closeOutput
+	file          *outputFile        // nil unless -output names a file for a format written to stdout; see openOutput
+}
+
+// stage is a step of the entry pipeline. It may rewrite the entry in place
+// and reports whether to keep it.
+type stage func(*parser.LogEntry) bool
+
+// process runs entry through cfg's pipeline: the transforms, then match,
+// then the stages for matching entries. It reports whether entry made it
+// through, by which point it has been rewritten as those stages say.
+func (cfg *pipelineConfig) process(entry *parser.LogEntry) bool {
+	for _, s := range cfg.transforms {
+		if !s(entry) {
+			return false
+		}
+	}
+	if !cfg.match(entry) {
+		return false
+	}
+	for _, s := range cfg.accept {
+		if !s(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// deduped returns the entries to format and the filter to apply to them:
+// entries and cfg.process, or with -dedupe or -dedupe-window, the
+// processed entries cfg.dedupe lets through, which need no further
+// filtering.
+func (cfg *pipelineConfig) deduped(ctx context.Context, entries <-chan *parser.LogEntry) (<-chan *parser.LogEntry, func(*parser.LogEntry) bool) {
+	if cfg.dedupe == nil {
+		return entries, cfg.process
+	}
+	return cfg.dedupe.run(ctx, entries, cfg.process), func(*parser.LogEntry) bool { return true }
+}
+
+// config validates g and builds the read options, filters and formatter it
+// describes.
+func (g *globalFlags) config() (*pipelineConfig, error) {
+	oversize, err := parser.ParseOversizePolicy(g.onOversize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --on-oversize: %w", err)
+	}
+	onError, err := parser.ParseErrorPolicy(g.onError)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --on-error: %w", err)
+	}
+	if g.strict == strictStop {
+		if onError == parser.ErrorRaw {
+			return nil, fmt.Errorf("--strict=stop cannot be combined with --on-error raw")
+		}
+		onError = parser.ErrorFail
+	}
+	duplicates, err := parser.ParseDuplicatePolicy(g.duplicates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --duplicate-keys: %w", err)
+	}
+	numbers, err := parser.ParseNumberMode(g.numbers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --numbers: %w", err)
+	}
+
+	var mlStart, mlCont *regexp.Regexp
+	if g.mlStart != "" {
+		if mlStart, err = regexp.Compile(g.mlStart); err != nil {
+			return nil, fmt.Errorf("invalid --multiline-start: %w", err)
+		}
+	}
+	if g.mlCont != "" {
+		if mlCont, err = regexp.Compile(g.mlCont); err != nil {
+			return nil, fmt.Errorf("invalid --multiline-cont: %w", err)
+		}
+	}
+
+	var columns []string
+	if g.csvColumns != "" {
+		if g.input != "csv" && g.input != "tsv" {
+			return nil, fmt.Errorf("--csv-columns requires --input csv or --input tsv")
+		}
+		for _, c := range strings.Split(g.csvColumns, ",") {
+			if c = strings.TrimSpace(c); c == "" {
+				return nil, fmt.Errorf("invalid --csv-columns %q: empty column name", g.csvColumns)
+			}
+			columns = append(columns, c)
+		}
+	}
+
+	loc, err := parseZone(g.assumeTZ)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --assume-tz: %w", err)
+	}
+
+	// Parse each -filter flag into a FieldFilter and combine them with AND
+	// semantics using a CompositeFilter.
+	var filters []filter.Filter
+	for _, expr := range g.filters {
+		f, err := filter.NewFieldFilterIn(expr, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		filters = append(filters, f)
+	}
+	if g.query != "" {
+		f, err := filter.ParseQueryIn(g.query, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --query: %w", err)
+		}
+		filters = append(filters, f)
+	}
+	ml, err := newMinLevel(g.minLevel)
+	if err != nil {
+		return nil, err
+	}
+	if ml != nil {
+		filters = append(filters, ml)
+	}
+	tr, err := newTimeRange(g.since, g.until, time.Now(), loc)
+	if err != nil {
+		return nil, err
+	}
+	if tr != nil {
+		filters = append(filters, tr)
+	}
+
+	jq, err := newJQ(g.jq)
+	if err != nil {
+		return nil, err
+	}
+
+	onInvalid, err := parseInvalidPolicy(g.onInvalid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --on-invalid: %w", err)
+	}
+	var v *validator
+	if g.validate != "" {
+		if v, err = loadValidator(g.validate, onInvalid); err != nil {
+			return nil, err
+		}
+	}
+
+	levels, err := parseLevelMap(g.levelMap)
+	if err != nil {
+		return nil, err
+	}
+	sample, err := newSampler(g.every, g.everyKey)
+	if err != nil {
+		return nil, err
+	}
+	anon, err := newAnonymizer(g.anonymize, g.anonSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	if g.fields != "" {
+		fields = strings.Split(g.fields, ",")
+	}
+	var f formatter.Formatter
+	var output sink
+	switch {
+	case g.avroSchema != "" && g.format != "avro":
+		err = fmt.Errorf("--schema requires --format avro")
+	case g.atomic && g.output == "":
+		err = fmt.Errorf("--atomic requires --output")
+	case g.appendOut && g.output == "" && g.splitBy == "":
+		err = fmt.Errorf("--append requires --output or --split-by")
+	case (g.splitBy == "") != (g.outputDir == ""):
+		err = fmt.Errorf("--split-by and --output-dir must be given together")
+	case g.splitBy != "" && g.output != "":
+		err = fmt.Errorf("--split-by cannot be combined with --output, as it writes to files in --output-dir")
+	case g.splitBy != "" && (g.format == "table" || g.format == "avro" || g.format == "parquet" || g.format == "loki" || g.format == "syslog"):
+		err = fmt.Errorf("--split-by cannot be used with --format %s", g.format)
+	case g.splitBy != "" && g.markGaps > 0:
+		err = fmt.Errorf("--mark-gaps cannot be combined with --split-by, as the gaps between entries of different files would be marked")
+	case g.appendOut && g.atomic:
+		err = fmt.Errorf("--append cannot be combined with --atomic")
+	case (g.appendOut || g.atomic) && (g.format == "avro" || g.format == "parquet"):
+		err = fmt.Errorf("--append and --atomic cannot be used with --format %s, whose file is written whole", g.format)
+	case g.output != "" && (g.format == "loki" || g.format == "syslog"):
+		err = fmt.Errorf("--output cannot be used with --format %s, which sends entries rather than writing them", g.format)
+	case (g.lokiURL != "" || g.lokiLabels != "" || g.lokiTenant != "") && g.format != "loki":
+		err = fmt.Errorf("--loki-url, --loki-labels and --loki-tenant require --format loki")
+	case (g.syslogAddr != "" || g.syslogFac != "user" || g.syslogMap != "") && g.format != "syslog":
+		err = fmt.Errorf("--syslog-addr, --syslog-facility and --syslog-fields require --format syslog")
+	case g.template != "" && g.format != "template":
+		err = fmt.Errorf("--template requires --format template")
+	case g.format == "avro":
+		var af *avroFormatter
+		if af, err = newAvroFormatter(g.output, g.avroSchema); err == nil {
+			f, output = af, af
+		}
+	case g.format == "parquet":
+		var pf *parquetFormatter
+		if pf, err = newParquetFormatter(g.output); err == nil {
+			f, output = pf, pf
+		}
+	case g.format == "loki":
+		var lf *lokiFormatter
+		if lf, err = newLokiFormatter(g.lokiURL, g.lokiLabels, g.lokiTenant, g.lokiBatch, loc); err == nil {
+			f, output = lf, lf
+		}
+	case g.format == "syslog":
+		var sf *syslogFormatter
+		if sf, err = newSyslogFormatter(g.syslogAddr, g.syslogFac, g.syslogMap, loc); err == nil {
+			f, output = sf, sf
+		}
+	case g.format == "template":
+		if g.template == "" {
+			return nil, fmt.Errorf("--format template requires --template")
+		}
+		if f, err = formatter.NewTemplateFormatter(g.template); err != nil {
+			err = fmt.Errorf("invalid --template: %w", err)
+		}
+	default:
+		f, err = newFormatter(g.format, g.pretty, g.useColor(), g.sanitize.resolve(g.toTerminal()), fields)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(g.values) > 0 {
+		switch {
+		case g.format != "text":
+			return nil, fmt.Errorf("--value cannot be combined with --format %s", g.format)
+		case g.fields != "":
+			return nil, fmt.Errorf("--value cannot be combined with --fields")
+		}
+		f = &formatter.ValueFormatter{Fields: g.values}
+	}
+	if g.keyOrder != "input" {
+		jf, ok := f.(*formatter.JSONFormatter)
+		if !ok {
+			return nil, fmt.Errorf("--key-order requires --format json")
+		}
+		if jf.KeyOrder, err = parseKeyOrder(g.keyOrder); err != nil {
+			return nil, err
+		}
+	}
+	if g.colorLines {
+		tf, ok := f.(*formatter.TextFormatter)
+		if !ok {
+			return nil, fmt.Errorf("--color-lines requires text output")
+		}
+		tf.ColorLines = true
+	}
+	if err := g.fitLines(f); err != nil {
+		return nil, err
+	}
+	if err := g.limitValues(f); err != nil {
+		return nil, err
+	}
+	if g.icons != iconsMode(formatter.IconsOff) {
+		tf, ok := f.(*formatter.TextFormatter)
+		if !ok {
+			return nil, fmt.Errorf("--icons requires text output")
+		}
+		tf.Icons = formatter.LevelIcons(g.icons)
+	}
+	if g.foldStacks != 0 {
+		tf, ok := f.(*formatter.TextFormatter)
+		switch {
+		case g.foldStacks < 0:
+			return nil, fmt.Errorf("--fold-stacks must not be negative")
+		case !ok:
+			return nil, fmt.Errorf("--fold-stacks requires text output")
+		}
+		tf.FoldStacks = g.foldStacks
+	}
+	var align *aligner
+	if g.align {
+		tf, ok := f.(*formatter.TextFormatter)
+		if !ok {
+			return nil, fmt.Errorf("--align requires text output")
+		}
+		tf.Align = true
+		align = newAligner(tf)
+	}
+	if tf, ok := f.(*formatter.TableFormatter); ok {
+		align = newAligner(tf)
+	}
+
+	display, err := parseTimeDisplay(g.timeDisplay)
+	if err != nil {
+		return nil, err
+	}
+	if display != timeAbsolute {
+		switch _, ok := f.(*formatter.TextFormatter); {
+		case !ok:
+			return nil, fmt.Errorf("--time-display %s requires text output", display)
+		case g.rebaseTime:
+			return nil, fmt.Errorf("--time-display %s cannot be combined with --rebase-time", display)
+		}
+	}
+	if g.timeFormat != "" || g.tz != "" {
+		tf, ok := f.(*formatter.TextFormatter)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("--time-format and --tz require text output")
+		case display != timeAbsolute:
+			return nil, fmt.Errorf("--time-format and --tz cannot be combined with --time-display %s", display)
+		}
+		if g.timeFormat != "" {
+			if tf.TimeLayout, err = parseTimeFormat(g.timeFormat); err != nil {
+				return nil, err
+			}
+		}
+		if g.tz != "" {
+			if tf.Location, err = parseZone(g.tz); err != nil {
+				return nil, fmt.Errorf("invalid --tz: %w", err)
+			}
+		}
+	}
+
+	if tf, ok := f.(*formatter.TextFormatter); ok {
+		// Read naive timestamps in the zone they are sorted in.
+		tf.AssumeLocation = loc
+	}
+
+	if g.markGaps != 0 {
+		switch _, ok := f.(*formatter.TextFormatter); {
+		case g.markGaps < 0:
+			return nil, fmt.Errorf("--mark-gaps must not be negative")
+		case !ok:
+			return nil, fmt.Errorf("--mark-gaps requires text output")
+		}
+	}
+
+	plugins, err := loadPlugins(g.plugins)
+	if err != nil {
+		return nil, err
+	}
+	if plugins.parser() != nil && g.input != "auto" {
+		return nil, fmt.Errorf("--input %s cannot be combined with plugin %s, which parses input", g.input, plugins.parse.Name())
+	}
+	if plugins.format != nil && output != nil {
+		return nil, fmt.Errorf("--format %s cannot be combined with plugin %s, which formats output", g.format, plugins.format.Name())
+	}
+	var file *outputFile
+	if g.output != "" && output == nil {
+		file = &outputFile{path: g.output, appending: g.appendOut, atomic: g.atomic}
+	}
+	f = plugins.formatter(f)
+	if g.rebaseTime {
+		f = &rebasedFormatter{f: f, loc: loc}
+	}
+	if display != timeAbsolute {
+		f = &relativeFormatter{f: f, display: display, loc: loc, now: time.Now}
+	}
+	if g.markGaps > 0 {
+		// Outside the rebasing, which rewrites the timestamps it compares.
+		f = &gapFormatter{f: f, min: g.markGaps, loc: loc, color: g.useColor()}
+	}
+	if g.splitBy != "" {
+		sp := newSplitFormatter(f, g.splitBy, g.outputDir, g.appendOut)
+		f, output = sp, sp
+	}
+
+	var transforms, accept []stage
+	if plugins.transformsEntries() {
+		transforms = append(transforms, plugins.transform)
+	}
+	if levels != nil {
+		transforms = append(transforms, levels.rewrite)
+	}
+	if v != nil {
+		accept = append(accept, v.check)
+	}
+	if jq != nil {
+		accept = append(accept, jq.keep)
+	}
+	if sample != nil {
+		accept = append(accept, sample.keep)
+	}
+	if g.flatten {
+		accept = append(accept, flattener(g.flatten).apply)
+	}
+	if anon != nil {
+		accept = append(accept, anon.apply)
+	}
+
+	return &pipelineConfig{
+		readOpts: parser.ReadOptions{
+			MaxLineSize:  int(g.maxLineSize),
+			Oversize:     oversize,
+			OnError:      onError,
+			KeepRaw:      g.keepRaw,
+			Duplicates:   duplicates,
+			Numbers:      numbers,
+			StrictLogfmt: g.strictFmt,
+			Positions:    g.lineNumbers,
+			// Grouping lines happens before anything else reads them.
+			MultilineStart: mlStart,
+			MultilineCont:  mlCont,
+			// Repeated keys only matter when they can fail the run.
+			ReportDuplicates: g.strict != strictOff,
+		},
+		columns:    columns,
+		strict:     g.strict != strictOff,
+		progress:   !g.noProgress,
+		location:   loc,
+		filters:    filters,
+		transforms: transforms,
+		match:      filter.NewCompositeFilter(filters...).Match,
+		accept:     accept,
+		jq:         jq,
+		validator:  v,
+		levels:     levels,
+		sampler:    sample,
+		anonymizer: anon,
+		flatten:    flattener(g.flatten),
+		formatter:  f,
+		plugins:    plugins,
+		align:      align,
+		output:     output,
+		file:       file,
+	}, nil
+}
+
+// windowFlags holds the -head, -limit and -tail flags, which restrict
+// output to the first or last matching entries.
+type windowFlags struct {
+	head, limit, tail int
+}
+
+// register defines the window flags on fs.
+func (w *windowFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&w.head, "head", 0, "Print only the first N matching entries, then stop reading (0 means all)")
+	fs.IntVar(&w.limit, "limit", 0, "Same as -head")
+	fs.IntVar(&w.tail, "tail", 0, "Print only the last N matching entries (0 means all)")
+}
+
+// window validates the flags and returns the window they select.
+func (w *windowFlags) window() (window, error) {
+	switch {
+	case w.head < 0:
+		return window{}, fmt.Errorf("--head must not be negative")
+	case w.limit < 0:
+		return window{}, fmt.Errorf("--limit must not be negative")
+	case w.tail < 0:
+		return window{}, fmt.Errorf("--tail must not be negative")
+	case w.head > 0 && w.limit > 0 && w.head != w.limit:
+		return window{}, fmt.Errorf("--head and --limit are aliases; give only one")
+	}
+	head := max(w.head, w.limit)
+	if head > 0 && w.tail > 0 {
+		return window{}, fmt.Errorf("--head and --tail are mutually exclusive")
+	}
+	return window{head: head, tail: w.tail}, nil
+}
+
+// quietFlag defines -quiet and its shorthand -q on fs.
+func quietFlag(fs *flag.FlagSet) *bool {
+	quiet := fs.Bool("quiet", false, "Print nothing; exit 0 at the first matching entry, or 1 if none match")
+	fs.BoolVar(quiet, "q", false, "Shorthand for -quiet")
+	return quiet
+}
+
+// grepExitFlag defines -grep-exit on fs.
+func grepExitFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("grep-exit", false, "Exit 0 if any entry matched, 1 if none did and 2 on errors, like grep")
+}
+
+// grepExit maps a command's exit code to grep's conventions for -grep-exit:
+// 0 when at least one entry matched, 1 when none did and 2 when the run
+// failed. A nil *grepExit leaves exit codes unchanged.
+type grepExit struct {
+	matched bool
+}
+
+// newGrepExit returns a grepExit when enabled is set, and nil otherwise.
+func newGrepExit(enabled bool) *grepExit {
+	if !enabled {
+		return nil
+	}
+	return &grepExit{}
+}
+
+// watch adds a last stage to cfg's pipeline that records whether any
+// entry made it through.
+func (ge *grepExit) watch(cfg *pipelineConfig) {
+	if ge == nil {
+		return
+	}
+	cfg.accept = append(cfg.accept, func(*parser.LogEntry) bool {
+		ge.matched = true
+		return true
+	})
+}
+
+// status returns the exit code for a run that would otherwise exit with
+// code.
+func (ge *grepExit) status(code int) int {
+	switch {
+	case ge == nil:
+		return code
+	case code != 0:
+		return 2
+	case !ge.matched:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// skipsLine reports whether err, as received from a parser configured by
+// cfg, means that an input line produced no entry. Oversized lines that
+// were truncated, and lines repeating a key, are still parsed.
+func (cfg *pipelineConfig) skipsLine(err error) bool {
+	var lineErr *parser.LineError
+	if !errors.As(err, &lineErr) || errors.Is(err, parser.ErrDuplicateKey) {
+		return false
+	}
+	return cfg.readOpts.Oversize != parser.OversizeTruncate || !errors.Is(err, parser.ErrLineTooLong)
+}
+
+// readOptsFor returns the read options for the file at path, which name
+// the file as the source of raw entries. path is empty for stdin.
+func (cfg *pipelineConfig) readOptsFor(path string) parser.ReadOptions {
+	opts := cfg.readOpts
+	if path != "" {
+		opts.Source = filepath.Base(path)
+	}
+	return opts
+}
+
+// multiline reports whether cfg groups input lines into entries with
+// --multiline-start or --multiline-cont.
+func (cfg *pipelineConfig) multiline() bool {
+	return cfg.readOpts.MultilineStart != nil || cfg.readOpts.MultilineCont != nil
+}
+
+// readsHeader reports whether input in inputFormat names its fields in a
+// header row, which must be read before any other: CSV or TSV without
+// --csv-columns.
+func (cfg *pipelineConfig) readsHeader(inputFormat string) bool {
+	return (inputFormat == "csv" || inputFormat == "tsv") && len(cfg.columns) == 0
+}
+
+// withColumns gives p, when it parses CSV or TSV, the names of
+// --csv-columns, and returns it.
+func (cfg *pipelineConfig) withColumns(p parser.ContextParser) parser.ContextParser {
+	if cp, ok := p.(*parser.CSVParser); ok {
+		cp.Columns = cfg.columns
+	}
+	return p
+}
+
+// stopsRun reports whether err, as received from a parser configured by
+// cfg, means that parsing stopped early: at an oversized line under
+// --on-oversize=error or at a malformed line under --on-error=fail. Either
+// makes the run fail.
+func (cfg *pipelineConfig) stopsRun(err error) bool {
+	var lineErr *parser.LineError
+	if !errors.As(err, &lineErr) || errors.Is(err, parser.ErrDuplicateKey) {
+		return false
+	}
+	if errors.Is(err, parser.ErrLineTooLong) {
+		return cfg.readOpts.Oversize == parser.OversizeError
+	}
+	return cfg.readOpts.OnError == parser.ErrorFail
+}
+
+// command is a logpipe subcommand.
+type command struct {
+	name    string
+	summary string
+	// run executes the command with the global flags parsed so far and the
+	// arguments following the command name, and returns the exit code.
+	run func(g *globalFlags, args []string) int
+}
+
+// commands lists the subcommands in the order they appear in usage output.
+var commands = []command{
+	{"view", "Filter and format log entries (the default)", runView},
+	{"stats", "Print a frequency table of a field's values", runStats},
+	{"patterns", "Group messages into templates and count them", runPatterns},
+	{"sql", "Run a SQL query over the entries", runSQL},
+	{"merge", "Interleave several files by timestamp", runMerge},
+	{"validate", "Report malformed lines and fail above an error rate", runValidate},
+	{"report", "Write a self-contained HTML report for a postmortem", runReport},
+	{"follow", "Keep reading a file as it grows, like tail -f", runFollow},
+	{"bench", "Measure parsing throughput and allocations", runBench},
+	{"index", "Write sidecar indexes for faster filtered reads", runIndex},
+	{"profile", "List, save or delete named flag profiles", runProfile},
+	{"completion", "Print a shell completion script (bash, zsh or fish)", runCompletion},
+}
+
+// lookupCommand returns the subcommand called name, or nil.
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// run executes logpipe with the given command-line arguments (excluding the
+// program name) and returns the process exit code.
+func run(args []string) int {
+	g := newGlobalFlags()
+	if err := g.applyEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if len(args) > 0 {
+		if args[0] == completeCommand {
+			return runComplete(args[1:])
+		}
+		if cmd := lookupCommand(args[0]); cmd != nil {
+			return cmd.run(g, args[1:])
+		}
+	}
+	return runLegacy(g, args)
+}
+
+// runLegacy implements the original flat command line, in which the mode is
+// selected by flags (-stats, -merge) rather than a subcommand. Global flags
+// followed by a subcommand name are handed on to that subcommand.
+func runLegacy(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("logpipe", flag.ContinueOnError)
+	g.register(fs)
+	g.registerSinks(fs)
+	filePath := fs.String("file", "", "Path or glob pattern of the log file (default: stdin)")
+	statsField := fs.String("stats", "", "Print a frequency table of values for the named field instead of formatting entries")
+	var compare multiFlag
+	compareFlag(fs, &compare)
+	statsFormat := statsFormatFlag(fs)
+	statsTemplate := statsTemplateFlag(fs)
+	groupBy := groupByFlag(fs)
+	var dd dedupeFlags
+	dd.register(fs)
+	var sf slowestFlags
+	sf.register(fs)
+	var rf replayFlags
+	rf.register(fs)
+	patterns := fs.Bool("patterns", false, "Print the message templates of the entries and their counts instead of formatting entries")
+	versionFlag := fs.Bool("version", false, "Print version and exit")
+	noIndex := fs.Bool("no-index", false, "Ignore the sidecar index written by 'logpipe index' and read the whole file")
+	follow := followFlag(fs)
+	var wf windowFlags
+	wf.register(fs)
+	quiet := quietFlag(fs)
+	grepExitSet := grepExitFlag(fs)
+	explainSet := explainFlag(fs)
+	var mergeFiles multiFlag
+	fs.Var(&mergeFiles, "merge", "File or glob pattern of files to include in merged timestamp-sorted output (repeatable)")
+	mergeDir := fs.String("merge-dir", "", "Directory whose logs and rotated generations (app.log, app.log.1, app.log.2.gz, ...) are all included in merged output")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: logpipe [flags] [file...]\n       logpipe [global flags] <command> [flags] [args]\n\nWith no command, logpipe reads its file, or merges several by timestamp.\n\nCommands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+		}
+		fmt.Fprintf(out, "\nRun 'logpipe <command> -help' for a command's flags.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	ge := newGrepExit(*grepExitSet && !*quiet)
+
+	if fs.NArg() > 0 {
+		cmd := lookupCommand(fs.Arg(0))
+		if cmd == nil && !looksLikeFile(fs.Arg(0)) {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n", fs.Arg(0))
+			fs.Usage()
+			return 2
+		}
+		if cmd != nil {
+			if name := nonGlobalFlag(fs); name != "" {
+				fmt.Fprintf(os.Stderr, "-%s is not a global flag; give it after %q\n", name, cmd.name)
+				return 2
+			}
+			return cmd.run(g, fs.Args()[1:])
+		}
+		// The arguments are the input: one file is read like -file,
+		// several are merged like -merge.
+		if *filePath != "" || len(mergeFiles) > 0 || *mergeDir != "" {
+			fmt.Fprintf(os.Stderr, "Error: give the files either with -file, -merge and -merge-dir or as arguments, not both\n")
+			return ge.status(1)
+		}
+		files, err := mergePaths(fs.Args())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+		if len(files) == 1 {
+			*filePath = files[0]
+		} else {
+			mergeFiles = files
+		}
+	}
+
+	if *groupBy != "" {
+		if err := checkGroupBy(wf, *quiet, false, g.splitBy != ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+	}
+	if err := dd.check(*quiet, *groupBy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := sf.check(wf, *quiet, *groupBy, dd.flag(), false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := rf.check(wf, *quiet, *groupBy, sf.n > 0, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := checkMarkGaps(g.markGaps, *groupBy, sf.n > 0); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if *follow && len(mergeFiles) == 0 && *mergeDir == "" {
+		if err := checkFollow(*filePath, wf, *quiet, *groupBy, sf.n > 0, false, g); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+	}
+	if *versionFlag {
+		fmt.Printf("logpipe %s\n", version)
+		return 0
+	}
+	var err error
+	if *filePath, err = globFile(*filePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if mergeFiles, err = expandGlobs(mergeFiles); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if *mergeDir != "" {
+		files, err := rotatedFiles(*mergeDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+		mergeFiles = append(mergeFiles, files...)
+	}
+	if *filePath != "" && len(mergeFiles) > 0 {
+		fmt.Fprintf(os.Stderr, "--file and --merge are mutually exclusive\n")
+		return ge.status(1)
+	}
+	win, err := wf.window()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg.dedupe = newDeduper(dd, cfg.location)
+	cfg.replay = newPacer(rf, cfg.location)
+	if cfg.compare, err = parseCompare(compare, cfg.location); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := checkStatsFormat(*statsFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg.statsFormat = *statsFormat
+	if cfg.statsTemplate, err = loadStatsTemplate(*statsTemplate, *statsFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	ge.watch(cfg)
+
+	switch {
+	case dd.flag() != "" && (*statsField != "" || len(mergeFiles) > 0 || *patterns):
+		fmt.Fprintf(os.Stderr, "%s cannot be combined with --stats, --merge or --patterns\n", dd.flag())
+		return ge.status(1)
+	case *groupBy != "" && (*statsField != "" || *patterns):
+		fmt.Fprintf(os.Stderr, "--group-by cannot be combined with --stats or --patterns\n")
+		return ge.status(1)
+	case sf.n > 0 && (*statsField != "" || *patterns):
+		fmt.Fprintf(os.Stderr, "--slowest cannot be combined with --stats or --patterns\n")
+		return ge.status(1)
+	case rf.on && (*statsField != "" || *patterns):
+		fmt.Fprintf(os.Stderr, "--replay cannot be combined with --stats or --patterns\n")
+		return ge.status(1)
+	case g.splitBy != "" && (*statsField != "" || *patterns):
+		fmt.Fprintf(os.Stderr, "--split-by cannot be combined with --stats or --patterns\n")
+		return ge.status(1)
+	case *follow && (*statsField != "" || len(mergeFiles) > 0 || *patterns):
+		fmt.Fprintf(os.Stderr, "--follow cannot be combined with --stats, --merge or --patterns\n")
+		return ge.status(1)
+	case *patterns && (*statsField != "" || len(mergeFiles) > 0 || *quiet || *explainSet):
+		fmt.Fprintf(os.Stderr, "--patterns cannot be combined with --stats, --merge, --quiet or --explain\n")
+		return ge.status(1)
+	case len(compare) > 0 && *statsField == "":
+		fmt.Fprintf(os.Stderr, "--compare requires --stats\n")
+		return ge.status(1)
+	case *statsFormat != "plain" && *statsField == "":
+		fmt.Fprintf(os.Stderr, "--stats-format requires --stats\n")
+		return ge.status(1)
+	case *statsTemplate != "" && *statsField == "":
+		fmt.Fprintf(os.Stderr, "--stats-template requires --stats\n")
+		return ge.status(1)
+	case *quiet && *statsField != "":
+		fmt.Fprintf(os.Stderr, "--quiet cannot be combined with --stats\n")
+		return ge.status(1)
+	case *explainSet && len(mergeFiles) > 0:
+		explain(os.Stdout, cfg, plan{inputFormat: g.input, paths: mergeFiles, merge: true, statsField: *statsField, quiet: *quiet, groupBy: *groupBy, slowest: sf, win: win})
+		return 0
+	case *explainSet:
+		explain(os.Stdout, cfg, plan{inputFormat: g.input, paths: pathList(*filePath), useIndex: !*noIndex, statsField: *statsField, quiet: *quiet, groupBy: *groupBy, slowest: sf, follow: *follow, win: win})
+		return 0
+	case *quiet && len(mergeFiles) > 0:
+		return quietMergeMode(cfg, g.input, mergeFiles)
+	case *quiet:
+		return quietMode(cfg, g.input, *filePath, !*noIndex)
+	}
+	if err := cfg.openOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	switch {
+	case *follow:
+		return ge.status(cfg.closeOutput(followViewMode(cfg, g.input, *filePath, win)))
+	case len(mergeFiles) > 0 && *statsField != "":
+		return ge.status(cfg.closeOutput(mergeMode(cfg, g.input, mergeFiles, *statsField, "", slowestFlags{}, win)))
+	case len(mergeFiles) > 0:
+		return ge.status(cfg.closeOutput(mergeMode(cfg, g.input, mergeFiles, "", *groupBy, sf, win)))
+	case *statsField != "":
+		return ge.status(cfg.closeOutput(statsMode(cfg, g.input, *filePath, *statsField, !*noIndex)))
+	case *groupBy != "":
+		return ge.status(cfg.closeOutput(groupMode(cfg, g.input, *filePath, *groupBy, !*noIndex)))
+	case sf.n > 0:
+		return ge.status(cfg.closeOutput(slowestMode(cfg, g.input, *filePath, sf, !*noIndex)))
+	case *patterns:
+		return ge.status(cfg.closeOutput(patternsMode(cfg, g.input, *filePath, defaultPatternOptions(), !*noIndex)))
+	default:
+		return ge.status(cfg.closeOutput(viewMode(cfg, g.input, *filePath, win, !*noIndex)))
+	}
+}
+
+// isGlobalFlag reports whether name is one of the global flags.
+func isGlobalFlag(name string) bool {
+	globals := flag.NewFlagSet("", flag.ContinueOnError)
+	newGlobalFlags().register(globals)
+	return globals.Lookup(name) != nil
+}
+
+// looksLikeFile reports whether arg, which names no command, is rather a
+// file to read: one that exists, or a name with an extension, a directory
+// or a glob pattern in it. Anything else is taken for a mistyped command.
+func looksLikeFile(arg string) bool {
+	if _, err := os.Stat(arg); err == nil {
+		return true
+	}
+	return strings.ContainsAny(arg, "./*?["+string(filepath.Separator))
+}
+
+// nonGlobalFlag returns the name of a flag set on fs that is not one of the
+// global flags, or "" if there is none.
+func nonGlobalFlag(fs *flag.FlagSet) string {
+	var name string
+	fs.Visit(func(f *flag.Flag) {
+		if name == "" && !isGlobalFlag(f.Name) {
+			name = f.Name
+		}
+	})
+	return name
+}
+
+// pathList returns path as a list of input files, which is empty for
+// stdin.
+func pathList(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return []string{path}
+}
+
+// fileArg returns the input file named either by the -file flag (flagValue)
+// or by the single positional argument of fs, expanded by globFile. It
+// reports an error if both, or more than one positional argument, are
+// given.
+func fileArg(fs *flag.FlagSet, flagValue string) (string, error) {
+	switch {
+	case fs.NArg() > 1:
+		return "", fmt.Errorf("expected at most one file, got %d", fs.NArg())
+	case fs.NArg() == 1 && flagValue != "":
+		return "", fmt.Errorf("give the file either with -file or as an argument, not both")
+	case fs.NArg() == 1:
+		return globFile(fs.Arg(0))
+	default:
+		return globFile(flagValue)
+	}
+}
+
+// globFile returns the single file matching the glob pattern path, or ""
+// for "". It reports an error when the pattern matches several files, which
+// only merge can read together.
+func globFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	paths, err := expandGlob(path)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) > 1 {
+		return "", fmt.Errorf("%q matches %d files; merge them with -merge or the merge command", path, len(paths))
+	}
+	return paths[0], nil
+}
+
+// expandGlobs returns the files matching each of the glob patterns, in
+// turn, as expandGlob finds them.
+func expandGlobs(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := expandGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// expandGlob returns the files matching the glob pattern, in lexical order,
+// for a shell that has not expanded it, as when it is quoted or given to
+// -file or -merge. A pattern without the metacharacters "*?[", or naming an
+// existing file as it is, stands for itself. A pattern matching no file is
+// an error.
+func expandGlob(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	if _, err := os.Stat(pattern); err == nil {
+		return []string{pattern}, nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %q", pattern)
+	}
+	return matches, nil
+}
@@ -0,0 +1,2070 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tylermac92/logpipe/internal/forward"
+	"github.com/tylermac92/logpipe/internal/gelf"
+	"github.com/tylermac92/logpipe/internal/logstream"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// captureStdout runs fn with os.Stdout redirected to a temporary file and
+// returns what it wrote.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = stdout }()
+	fn()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// writeLog writes contents to app.log in a fresh temporary directory and
+// returns its path.
+func writeLog(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCapture runs logpipe with args and returns its stdout and exit code.
+func runCapture(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	var code int
+	out := captureStdout(t, func() { code = run(args) })
+	return out, code
+}
+
+const cliLog = `{"time":"2024-01-15T10:00:02Z","level":"error","msg":"b"}
+{"time":"2024-01-15T10:00:01Z","level":"info","msg":"a"}
+{"time":"2024-01-15T10:00:03Z","level":"error","msg":"c"}
+`
+
+// =============================================================================
+// run
+// =============================================================================
+
+func TestRun_LegacyFlags(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "-file", path, "-filter", "level=error", "-format", "logfmt")
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := "time=2024-01-15T10:00:02Z level=error msg=b\ntime=2024-01-15T10:00:03Z level=error msg=c\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestRun_ViewSubcommand_PositionalFile(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-filter", "msg=a", "-format", "logfmt", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if out != "time=2024-01-15T10:00:01Z level=info msg=a\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_GlobalFlagsBeforeSubcommand(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "-format", "logfmt", "-filter", "level=error", "view", "-limit", "1", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if out != "time=2024-01-15T10:00:02Z level=error msg=b\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_FiltersBeforeAndAfterSubcommandCombine(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "-filter", "level=error", "view", "-filter", "msg=c", "-format", "logfmt", path)
+	if out != "time=2024-01-15T10:00:03Z level=error msg=c\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_ViewSubcommand_Tail(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-tail", "2", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := "time=2024-01-15T10:00:01Z level=info msg=a\ntime=2024-01-15T10:00:03Z level=error msg=c\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestRun_MergeSubcommand_Head(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "merge", "-fields", "msg", "-head", "1", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if !strings.Contains(out, "msg=a") || strings.Contains(out, "msg=b") {
+		t.Errorf("output = %q, want only the earliest entry", out)
+	}
+}
+
+func TestRun_MergeGlob(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"app-1.log": `{"time":"2024-01-15T10:00:02Z","msg":"b"}` + "\n",
+		"app-2.log": `{"time":"2024-01-15T10:00:01Z","msg":"a"}` + "\n",
+		"other.log": `{"time":"2024-01-15T10:00:00Z","msg":"c"}` + "\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pattern := filepath.Join(dir, "app-*.log")
+	for _, args := range [][]string{
+		{"-format", "logfmt", "-merge", pattern},
+		{"merge", "-format", "logfmt", pattern},
+	} {
+		out, code := runCapture(t, args...)
+		if want := "time=2024-01-15T10:00:01Z msg=a _source=app-2.log\ntime=2024-01-15T10:00:02Z msg=b _source=app-1.log\n"; code != 0 || out != want {
+			t.Errorf("%v: exit code %d, output %q, want %q", args, code, out, want)
+		}
+	}
+
+	out, code := runCapture(t, "-file", filepath.Join(dir, "o*.log"), "-format", "logfmt")
+	if want := "time=2024-01-15T10:00:00Z msg=c\n"; code != 0 || out != want {
+		t.Errorf("-file: exit code %d, output %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "-file", pattern); code != 1 {
+		t.Errorf("-file matching two files: exit code %d, want 1", code)
+	}
+	if _, code := runCapture(t, "-merge", filepath.Join(dir, "none-*.log")); code != 1 {
+		t.Errorf("-merge matching nothing: exit code %d, want 1", code)
+	}
+}
+
+func TestRun_HeadAndTailExclusive(t *testing.T) {
+	if _, code := runCapture(t, "view", "-head", "1", "-tail", "1", os.DevNull); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_Quiet(t *testing.T) {
+	path := writeLog(t, cliLog)
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"view", "-q", "-filter", "level=error", path}, 0},
+		{[]string{"view", "-quiet", "-filter", "level=fatal", path}, 1},
+		{[]string{"-q", "-filter", "msg=a", "-file", path}, 0},
+		{[]string{"merge", "-q", "-filter", "msg=c", path}, 0},
+		{[]string{"merge", "-q", "-filter", "msg=z", path}, 1},
+		{[]string{"view", "-q", filepath.Join(t.TempDir(), "missing.log")}, 2},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		if code != tt.want {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.want)
+		}
+		if out != "" {
+			t.Errorf("%v: output = %q, want none", tt.args, out)
+		}
+	}
+}
+
+func TestRun_GrepExit(t *testing.T) {
+	path := writeLog(t, cliLog)
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"view", "-grep-exit", "-filter", "level=error", path}, 0},
+		{[]string{"view", "-grep-exit", "-filter", "level=fatal", path}, 1},
+		{[]string{"view", "-filter", "level=fatal", path}, 0},
+		{[]string{"view", "-grep-exit", filepath.Join(t.TempDir(), "missing.log")}, 2},
+		{[]string{"view", "-grep-exit", "-filter", "nooperator", path}, 2},
+		{[]string{"stats", "-grep-exit", "-field", "level", "-filter", "msg=z", path}, 1},
+		{[]string{"merge", "-grep-exit", "-filter", "msg=a", path}, 0},
+		{[]string{"-grep-exit", "-filter", "msg=z", "-file", path}, 1},
+	}
+	for _, tt := range tests {
+		if _, code := runCapture(t, tt.args...); code != tt.want {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.want)
+		}
+	}
+}
+
+// TestRun_GrepExitConfigError checks that a configuration error, whether
+// found by the checks of a command's own flags or by building the pipeline,
+// keeps its exit code 1 unless -grep-exit asks for grep's 2.
+func TestRun_GrepExitConfigError(t *testing.T) {
+	path := writeLog(t, cliLog)
+	tmpl := filepath.Join(t.TempDir(), "missing.tmpl")
+	tests := [][]string{
+		// Building the pipeline.
+		{"view", "-filter", "nooperator", path},
+		{"view", "-format", "bogus", path},
+		{"view", "-tz", "Nowhere/Town", path},
+		{"stats", "-field", "level", "-filter", "nooperator", path},
+		{"merge", "-filter", "nooperator", path},
+		{"-filter", "nooperator", "-file", path},
+		// The commands' own checks.
+		{"view", "-group-by", "msg", "-head", "1", path},
+		{"view", "-dedupe-window", "-1s", path},
+		{"view", "-slowest", "2", path},
+		{"view", "-speed", "10x", path},
+		{"view", "-mark-gaps", "5s", "-group-by", "msg", path},
+		{"view", "-listen", "tcp://127.0.0.1:0"},
+		{"stats", "-field", "level", "-stats-format", "bogus", path},
+		{"stats", "-field", "level", "-stats-template", tmpl, path},
+		{"stats", "-field", "level", "-compare", "service=api", path},
+		{"stats", "-field", "level", "-file", path, path, path},
+		{"merge", "-slowest", "2", path, path},
+		{"merge", "-source-breaks", "-format", "json", path, path},
+		{"-stats", "level", "-stats-format", "bogus", "-file", path},
+		{"-stats-template", tmpl, "-file", path},
+		{"-compare", "service=api", "-file", path},
+		{"-dedupe-window", "5s", "-stats", "msg", "-file", path},
+		{"-group-by", "msg", "-stats", "msg", "-file", path},
+		{"-slowest", "2", "-by", "n", "-stats", "msg", "-file", path},
+		{"-replay", "-stats", "msg", "-file", path},
+		{"-file", path, "-merge", path},
+	}
+	for _, args := range tests {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+		// -grep-exit goes after the command name, when there is one.
+		withGrep := []string{"-grep-exit"}
+		if !strings.HasPrefix(args[0], "-") {
+			withGrep = []string{args[0], "-grep-exit"}
+			args = args[1:]
+		}
+		withGrep = append(withGrep, args...)
+		if _, code := runCapture(t, withGrep...); code != 2 {
+			t.Errorf("%v: exit code = %d, want 2", withGrep, code)
+		}
+	}
+}
+
+func TestRun_FilterKeywordsAreLiteral(t *testing.T) {
+	path := writeLog(t, `{"level":"error","msg":"LEFT OR RIGHT"}
+{"level":"warn","msg":"NOT FOUND"}
+{"level":"info","msg":"LEFT"}
+`)
+	// OR and NOT are part of the value in -filter; -query combines.
+	out, code := runCapture(t, "view", "-format", "logfmt", "-filter", "msg~LEFT OR RIGHT", path)
+	if want := "level=error msg=\"LEFT OR RIGHT\"\n"; code != 0 || out != want {
+		t.Errorf("OR: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-format", "logfmt", "-filter", "msg=NOT FOUND", path)
+	if want := "level=warn msg=\"NOT FOUND\"\n"; code != 0 || out != want {
+		t.Errorf("NOT: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-format", "logfmt", "-query", "level=error or not msg~FOUND", path)
+	if want := "level=error msg=\"LEFT OR RIGHT\"\nlevel=info msg=LEFT\n"; code != 0 || out != want {
+		t.Errorf("-query: exit code %d, output %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_PresenceFilter(t *testing.T) {
+	path := writeLog(t, `{"level":"error","trace_id":"t1","msg":"a"}
+{"level":"error","msg":"b"}
+{"level":"info","trace_id":"","msg":"c"}
+`)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-filter", "trace_id?", path)
+	if want := "level=error trace_id=t1 msg=a\nlevel=info trace_id= msg=c\n"; code != 0 || out != want {
+		t.Errorf("present: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-format", "logfmt", "-query", "level=error and !trace_id", path)
+	if want := "level=error msg=b\n"; code != 0 || out != want {
+		t.Errorf("absent: exit code %d, output %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_ContainsFilter(t *testing.T) {
+	path := writeLog(t, `{"level":"error","msg":"upstream Timeout"}
+{"level":"error","msg":"disk full"}
+{"level":"warn","msg":"TIMEOUT retrying"}
+`)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-filter", "msg*=timeout", path)
+	if want := "level=error msg=\"upstream Timeout\"\nlevel=warn msg=\"TIMEOUT retrying\"\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_NestedFields(t *testing.T) {
+	path := writeLog(t, `{"level":"error","msg":"a","meta":{"host":"srv1","tags":["x","y"]}}
+{"level":"info","msg":"b","meta":{"host":"srv2"}}
+{"level":"error","msg":"c","meta":{"host":"srv1"}}
+`)
+	out, code := runCapture(t, "view", "-value", "msg", "-value", "meta.tags.1", "-filter", "meta.host=srv1", path)
+	if want := "a\ty\nc\t\n"; code != 0 || out != want {
+		t.Errorf("filter: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-fields", "meta.host", "-filter", "level=info", path)
+	if code != 0 || !strings.Contains(out, " b meta.host=srv2\n") {
+		t.Errorf("-fields: exit code %d, output %q", code, out)
+	}
+	out, code = runCapture(t, "-stats", "meta.host", path)
+	if want := "srv1: 2\nsrv2: 1\n"; code != 0 || out != want {
+		t.Errorf("-stats: exit code %d, output %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_NetworkFilter(t *testing.T) {
+	path := writeLog(t, `{"client_ip":"10.0.0.5","msg":"a"}
+{"client_ip":"192.168.0.7","msg":"b"}
+{"client_ip":"10.20.30.40:5123","msg":"c"}
+{"msg":"d"}
+`)
+	out, code := runCapture(t, "view", "-value", "msg", "-filter", "client_ip=cidr:10.0.0.0/8", path)
+	if want := "a\nc\n"; code != 0 || out != want {
+		t.Errorf("=: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-value", "msg", "-query", "client_ip!=cidr:10.0.0.0/8", path)
+	if want := "b\n"; code != 0 || out != want {
+		t.Errorf("!=: exit code %d, output %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "view", "-filter", "client_ip=cidr:10.0.0/8", path); code != 1 {
+		t.Errorf("invalid network: exit code %d, want 1", code)
+	}
+}
+
+func TestRun_DurationFilter(t *testing.T) {
+	path := writeLog(t, `{"latency":"1.2s","msg":"a"}
+{"latency":0.3,"msg":"b"}
+{"latency":"90ms","msg":"c"}
+{"latency":"n/a","msg":"d"}
+`)
+	out, code := runCapture(t, "view", "-value", "msg", "-filter", "latency>250ms", path)
+	if want := "a\nb\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_Query(t *testing.T) {
+	path := writeLog(t, `{"level":"error","service":"api","msg":"a"}
+{"level":"warn","service":"cron","msg":"b"}
+{"level":"info","service":"api","msg":"c"}
+{"level":"warn","service":"web","msg":"d"}
+`)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-query", "(level=error or level=warn) and service!=cron", path)
+	if want := "level=error service=api msg=a\nlevel=warn service=web msg=d\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-format", "logfmt", "-query", "level=error or level=warn", "-filter", "service=web", path)
+	if want := "level=warn service=web msg=d\n"; code != 0 || out != want {
+		t.Errorf("with -filter: exit code %d, output %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "view", "-query", "(level=error", path); code != 1 {
+		t.Errorf("unbalanced query: exit code %d, want 1", code)
+	}
+}
+
+func TestRun_Strict(t *testing.T) {
+	path := writeLog(t, cliLog+"not json\n"+`{"time":"2024-01-15T10:00:04Z","level":"info","msg":"d"}`+"\n")
+	tests := []struct {
+		args      []string
+		wantCode  int
+		wantLines int
+	}{
+		{[]string{"view", path}, 0, 4},
+		{[]string{"view", "-strict", path}, 1, 4},
+		{[]string{"view", "-strict=stop", path}, 1, 3},
+		{[]string{"-strict", "merge", path}, 1, 4},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		if code != tt.wantCode {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.wantCode)
+		}
+		if n := strings.Count(out, "\n"); n != tt.wantLines {
+			t.Errorf("%v: %d lines of output, want %d", tt.args, n, tt.wantLines)
+		}
+	}
+}
+
+func TestRun_OnError(t *testing.T) {
+	path := writeLog(t, `{"msg":"a"}`+"\npanic: boom\n"+`{"msg":"b"}`+"\n")
+	tests := []struct {
+		policy   string
+		wantCode int
+		wantOut  string
+	}{
+		{"skip", 0, "msg=a\nmsg=b\n"},
+		{"raw", 0, "msg=a\n_raw=\"panic: boom\" _source=app.log\nmsg=b\n"},
+		{"fail", 1, "msg=a\n"},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, "view", "-format", "logfmt", "-on-error", tt.policy, path)
+		if code != tt.wantCode {
+			t.Errorf("%s: exit code = %d, want %d", tt.policy, code, tt.wantCode)
+		}
+		if out != tt.wantOut {
+			t.Errorf("%s: output = %q, want %q", tt.policy, out, tt.wantOut)
+		}
+	}
+}
+
+func TestRun_DuplicateKeys(t *testing.T) {
+	path := writeLog(t, "msg=a tag=x tag=y\nmsg=b tag=z\n")
+	tests := []struct {
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{[]string{"view", "-format", "json", path}, 0, `{"msg":"a","tag":"y"}` + "\n" + `{"msg":"b","tag":"z"}` + "\n"},
+		{[]string{"view", "-format", "json", "-duplicate-keys", "first", path}, 0, `{"msg":"a","tag":"x"}` + "\n" + `{"msg":"b","tag":"z"}` + "\n"},
+		{[]string{"view", "-format", "json", "-duplicate-keys", "collect", path}, 0, `{"msg":"a","tag":["x","y"]}` + "\n" + `{"msg":"b","tag":"z"}` + "\n"},
+		// Under -strict the line is still written, but the run fails.
+		{[]string{"view", "-format", "json", "-strict", path}, 1, `{"msg":"a","tag":"y"}` + "\n" + `{"msg":"b","tag":"z"}` + "\n"},
+		{[]string{"view", "-format", "json", "-strict=stop", path}, 1, `{"msg":"a","tag":"y"}` + "\n" + `{"msg":"b","tag":"z"}` + "\n"},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		if code != tt.wantCode {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.wantCode)
+		}
+		if out != tt.wantOut {
+			t.Errorf("%v: output = %q, want %q", tt.args, out, tt.wantOut)
+		}
+	}
+}
+
+func TestRun_StrictLogfmt(t *testing.T) {
+	path := writeLog(t, "level=info msg=a\nlevel=warn retrying now\nlevel=error msg=c\n")
+	tests := []struct {
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{[]string{"view", "-format", "json", path}, 0, `{"level":"info","msg":"a"}` + "\n" + `{"level":"warn","retrying now":true}` + "\n" + `{"level":"error","msg":"c"}` + "\n"},
+		{[]string{"view", "-format", "json", "-strict-logfmt", path}, 0, `{"level":"info","msg":"a"}` + "\n" + `{"level":"error","msg":"c"}` + "\n"},
+		{[]string{"view", "-format", "json", "-strict-logfmt", "-strict", path}, 1, `{"level":"info","msg":"a"}` + "\n" + `{"level":"error","msg":"c"}` + "\n"},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		if code != tt.wantCode {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.wantCode)
+		}
+		if out != tt.wantOut {
+			t.Errorf("%v: output = %q, want %q", tt.args, out, tt.wantOut)
+		}
+	}
+}
+
+func TestRun_WindowsLineEndingsAndBOM(t *testing.T) {
+	path := writeLog(t, "\ufeff{\"level\":\"info\",\"msg\":\"a\"}\r\n{\"level\":\"warn\",\"msg\":\"b\"}\r\n")
+	out, code := runCapture(t, "view", "-format", "logfmt", path)
+	if want := "level=info msg=a\nlevel=warn msg=b\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_Compressed(t *testing.T) {
+	const contents = `{"level":"info","msg":"a"}` + "\n" + `{"level":"error","msg":"b"}` + "\n"
+	var gz, zst bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(contents))
+	gw.Close()
+	zw, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write([]byte(contents))
+	zw.Close()
+
+	for name, data := range map[string][]byte{"gzip": gz.Bytes(), "zstd": zst.Bytes()} {
+		path := writeLog(t, string(data))
+		out, code := runCapture(t, "view", "-format", "logfmt", "-filter", "level=error", path)
+		if want := "level=error msg=b\n"; code != 0 || out != want {
+			t.Errorf("%s: exit code %d, output %q, want %q", name, code, out, want)
+		}
+		// A compressed file cannot be read backwards, so -tail reads it
+		// from the start.
+		out, code = runCapture(t, "view", "-format", "logfmt", "-tail", "1", path)
+		if want := "level=error msg=b\n"; code != 0 || out != want {
+			t.Errorf("%s: -tail: exit code %d, output %q, want %q", name, code, out, want)
+		}
+	}
+
+	path := writeLog(t, "\x1f\x8b\x08garbage")
+	if _, code := runCapture(t, "view", path); code != 1 {
+		t.Errorf("corrupt gzip: exit code %d, want 1", code)
+	}
+}
+
+func TestRun_Sanitize(t *testing.T) {
+	path := writeLog(t, "{\"level\":\"info\",\"msg\":\"\\u001b[2Jhidden\"}\n")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		// Output is captured in a file, so auto leaves it alone.
+		{[]string{"view", "-fields", "none", path}, "\x1b[2Jhidden"},
+		{[]string{"view", "-fields", "none", "-sanitize", path}, `\x1b[2Jhidden`},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		if code != 0 || !strings.HasSuffix(out, "[INFO ] "+tt.want+"\n") {
+			t.Errorf("%v: exit code %d, output %q, want it to end with %q", tt.args, code, out, tt.want)
+		}
+	}
+}
+
+func TestRun_Color(t *testing.T) {
+	path := writeLog(t, `{"level":"error","msg":"x"}`+"\n")
+	t.Setenv("NO_COLOR", "1")
+	tests := []struct {
+		args  []string
+		color bool
+	}{
+		// Output is captured in a file, so auto leaves it uncolored.
+		{[]string{"view", "-fields", "none", path}, false},
+		{[]string{"view", "-fields", "none", "-color=auto", path}, false},
+		{[]string{"view", "-fields", "none", "-color=never", path}, false},
+		// NO_COLOR only changes what auto does.
+		{[]string{"view", "-fields", "none", "-color", path}, true},
+		{[]string{"view", "-fields", "none", "-color=always", path}, true},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		// The entry has no timestamp, whose placeholder must not be grayed
+		// either.
+		if code != 0 || strings.Contains(out, "\x1b[31m") != tt.color || !tt.color && strings.Contains(out, "\x1b[") {
+			t.Errorf("%v: exit code %d, output %q, want color %v", tt.args, code, out, tt.color)
+		}
+	}
+	if _, code := runCapture(t, "view", "-color=sometimes", path); code != 2 {
+		t.Errorf("-color=sometimes: exit code %d, want 2", code)
+	}
+}
+
+func TestRun_MaxWidth(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","level":"info","msg":"a very long message","user":"alice"}`+"\n")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"view", "-max-width", "8", path}, "10:00:00 [INFO ] a very … user=alice\n"},
+		{[]string{"view", "-truncate-field", "msg=4,user=2", path}, "10:00:00 [INFO ] a v… user=a…\n"},
+		{[]string{"view", "-max-width", "8", "-truncate-field", "msg=0", path}, "10:00:00 [INFO ] a very long message user=alice\n"},
+		{[]string{"view", "-max-width", "8", "-truncate", "-width", "20", "-no-truncate", path}, "10:00:00 [INFO ] a very long message user=alice\n"},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		if code != 0 || out != tt.want {
+			t.Errorf("%v: exit code %d, output %q, want %q", tt.args, code, out, tt.want)
+		}
+	}
+	for _, args := range [][]string{
+		{"view", "-max-width", "-1", path},
+		{"view", "-truncate-field", "msg", path},
+		{"view", "-truncate-field", "msg=-5", path},
+		{"view", "-max-width", "10", "-format", "json", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_GCPExport(t *testing.T) {
+	path := writeLog(t, `{"jsonPayload":{"message":"charge failed","user":"u1"},"severity":"ERROR","timestamp":"2024-01-15T10:00:00Z","logName":"projects/p/logs/app"}
+{"textPayload":"started","severity":"INFO","timestamp":"2024-01-15T09:59:00Z","logName":"projects/p/logs/app"}
+`)
+	out, code := runCapture(t, "view", "-filter", "level=error", "-fields", "user", path)
+	if want := "10:00:00 [ERROR] charge failed user=u1\n"; code != 0 || out != want {
+		t.Errorf("output = %q (exit %d), want %q", out, code, want)
+	}
+}
+
+func TestRun_Patterns(t *testing.T) {
+	path := writeLog(t, `{"level":"error","msg":"connection to 10.0.0.5:5432 failed after 350ms"}
+{"level":"info","msg":"user alice logged in"}
+{"level":"error","msg":"connection to db-primary failed after 12ms"}
+{"level":"info","msg":"user bob logged in"}
+{"level":"error","msg":"connection to 10.0.0.7 failed after 1200ms"}
+{"level":"info","note":"no message"}
+`)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"patterns", path}, "3  connection to <*> failed after <*>ms\n2  user <*> logged in\n"},
+		{[]string{"patterns", "-top", "1", path}, "3  connection to <*> failed after <*>ms\n"},
+		{[]string{"patterns", "-filter", "level=info", path}, "2  user <*> logged in\n"},
+		{[]string{"patterns", "-field", "level", path}, "3  error\n3  info\n"},
+		{[]string{"-patterns", "-file", path, "-filter", "level=error"}, "3  connection to <*> failed after <*>ms\n"},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, tt.args...)
+		if code != 0 || out != tt.want {
+			t.Errorf("%v: output = %q (exit %d), want %q", tt.args, out, code, tt.want)
+		}
+	}
+	for _, args := range [][]string{
+		{"patterns", "-similarity", "1.5", path},
+		{"patterns", "-depth", "2", path},
+	} {
+		if _, code := runCapture(t, args...); code != 2 {
+			t.Errorf("%v: exit code = %d, want 2", args, code)
+		}
+	}
+	if _, code := runCapture(t, "-patterns", "-stats", "level", "-file", path); code != 1 {
+		t.Errorf("-patterns with -stats: exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_Numbers(t *testing.T) {
+	path := writeLog(t, `{"trace":1704067200123456789,"ratio":0.50}`+"\n")
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"exact", "trace=1704067200123456789 ratio=0.50\n"},
+		{"float", "trace=1.7040672001234568e+18 ratio=0.5\n"},
+	}
+	for _, tt := range tests {
+		out, code := runCapture(t, "view", "-format", "logfmt", "-numbers", tt.mode, path)
+		if code != 0 || out != tt.want {
+			t.Errorf("%s: output = %q (exit %d), want %q", tt.mode, out, code, tt.want)
+		}
+	}
+	if _, code := runCapture(t, "view", "-numbers", "int", path); code != 1 {
+		t.Errorf("unknown mode: exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_MergeKeepRaw_KeepsPosition(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	os.WriteFile(a, []byte(`{"time":"2024-01-15T10:00:01Z","msg":"a1"}`+"\npanic: boom\n"+`{"time":"2024-01-15T10:00:03Z","msg":"a3"}`+"\n"), 0o644)
+	os.WriteFile(b, []byte(`{"time":"2024-01-15T10:00:02Z","msg":"b2"}`+"\n"), 0o644)
+
+	out, code := runCapture(t, "merge", "-keep-raw", "-format", "json", a, b)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := `{"time":"2024-01-15T10:00:01Z","msg":"a1","_source":"a.log"}
+{"_raw":"panic: boom","_source":"a.log"}
+{"time":"2024-01-15T10:00:02Z","msg":"b2","_source":"b.log"}
+{"time":"2024-01-15T10:00:03Z","msg":"a3","_source":"a.log"}
+`
+	if out != want {
+		t.Errorf("output =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestRun_Strict_CleanInputSucceeds(t *testing.T) {
+	path := writeLog(t, cliLog)
+	if _, code := runCapture(t, "stats", "-strict", "-field", "level", path); code != 0 {
+		t.Errorf("exit code = %d, want 0", code)
+	}
+}
+
+func TestRun_NonGlobalFlagBeforeSubcommand(t *testing.T) {
+	if _, code := runCapture(t, "-limit", "1", "view"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	if _, code := runCapture(t, "frobnicate"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestRun_PositionalFiles(t *testing.T) {
+	a := writeLog(t, `{"time":"2024-01-15T10:00:02Z","level":"error","msg":"b"}`+"\n")
+	b := writeLog(t, `{"time":"2024-01-15T10:00:01Z","level":"error","msg":"a"}`+"\n")
+
+	out, code := runCapture(t, "-format", "logfmt", "-filter", "level=error", a)
+	if want := "time=2024-01-15T10:00:02Z level=error msg=b\n"; code != 0 || out != want {
+		t.Errorf("one file: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "-format", "logfmt", a, b)
+	if want := "time=2024-01-15T10:00:01Z level=error msg=a _source=app.log\ntime=2024-01-15T10:00:02Z level=error msg=b _source=app.log\n"; code != 0 || out != want {
+		t.Errorf("two files: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "-stats", "level", a, b)
+	if want := "error: 2\n"; code != 0 || out != want {
+		t.Errorf("-stats: exit code %d, output %q, want %q", code, out, want)
+	}
+
+	if _, code := runCapture(t, "-file", a, b); code != 1 {
+		t.Errorf("-file and an argument: exit code %d, want 1", code)
+	}
+	if _, code := runCapture(t, "missing.log"); code != 1 {
+		t.Errorf("missing file: exit code %d, want 1", code)
+	}
+}
+
+func TestRun_TemplateFormat(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-format", "template", "-template", "{{.level}}|{{.msg}}", "-filter", "level=error", path)
+	if want := "error|b\nerror|c\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+	for _, args := range [][]string{
+		{"view", "-format", "template", path},
+		{"view", "-template", "{{.msg}}", path},
+		{"view", "-format", "template", "-template", "{{.msg", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code %d, want 1", args, code)
+		}
+	}
+}
+func TestRun_KeyOrder(t *testing.T) {
+	path := writeLog(t, `{"msg":"a","service":"api","level":"info","time":"2024-01-15T10:00:00Z"}
+{"service":"db","level":"warn","time":"2024-01-15T10:00:01Z","msg":"b"}
+`)
+	out, code := runCapture(t, "view", "-format", "json", "-key-order", "canonical", path)
+	want := `{"time":"2024-01-15T10:00:00Z","level":"info","msg":"a","service":"api"}
+{"time":"2024-01-15T10:00:01Z","level":"warn","msg":"b","service":"db"}
+`
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-key-order", "canonical", path},
+		{"view", "-format", "json", "-key-order", "msg,,level", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_TableFormat(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-format", "table", "-fields", "level,msg", "-filter", "level=error", path)
+	if want := "level  msg\nerror  b\nerror  c\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_Version(t *testing.T) {
+	out, code := runCapture(t, "-version")
+	if code != 0 || !strings.HasPrefix(out, "logpipe ") {
+		t.Errorf("-version: code %d, output %q", code, out)
+	}
+}
+
+func TestRun_InvalidFilter(t *testing.T) {
+	if _, code := runCapture(t, "view", "-filter", "nooperator", os.DevNull); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_StatsSubcommand(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "stats", "-field", "level", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if out != "error: 2\ninfo: 1\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_StatsSubcommand_MultipleFiles(t *testing.T) {
+	a := writeLog(t, cliLog)
+	b := writeLog(t, `{"level":"warn"}`+"\n")
+	out, _ := runCapture(t, "stats", "-field", "level", a, b)
+	if out != "error: 2\ninfo: 1\nwarn: 1\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_StatsSubcommand_RequiresField(t *testing.T) {
+	if _, code := runCapture(t, "stats", os.DevNull); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+// stackLog holds two Java traces raised in the same frame and a Python one.
+const stackLog = `{"level":"error","msg":"query failed","stack":"java.lang.IllegalStateException: pool exhausted\n\tat com.example.db.Pool.acquire(Pool.java:88)\n\tat com.example.db.Client.query(Client.java:41)\n\tat com.example.api.Handler.get(Handler.java:17)"}
+{"level":"info","msg":"ok"}
+{"level":"error","msg":"query failed","stack":"java.lang.IllegalStateException: pool exhausted\n\tat com.example.db.Pool.acquire(Pool.java:88)\n\tat com.example.db.Client.query(Client.java:41)"}
+{"level":"error","msg":"Traceback (most recent call last):\n  File \"app.py\", line 25, in main\n    handle(request)\n  File \"handlers.py\", line 12, in handle\n    user = users[request.user_id]\nKeyError: 42"}
+`
+
+func TestRun_StatsSubcommand_TopFrame(t *testing.T) {
+	path := writeLog(t, stackLog)
+	out, code := runCapture(t, "stats", "-top-frame", "-filter", "level=error", path)
+	if want := "com.example.db.Pool.acquire(Pool.java:88): 2\nhandle (handlers.py:12): 1\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "stats", "-top-frame", "-field", "level", path); code != 1 {
+		t.Errorf("-top-frame with -field: exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_FoldStacks(t *testing.T) {
+	path := writeLog(t, stackLog)
+	out, code := runCapture(t, "view", "-fold-stacks", "1", "-filter", "level=error", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	for _, want := range []string{
+		"\tat com.example.db.Pool.acquire(Pool.java:88)\n    \t... 2 more frames\n",
+		"\tat com.example.db.Pool.acquire(Pool.java:88)\n    \t... 1 more frame\n",
+		"Traceback (most recent call last):\n  ... 1 more frame\n  File \"handlers.py\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Client.query") {
+		t.Errorf("output = %q, want the second frames folded", out)
+	}
+	for _, args := range [][]string{
+		{"view", "-fold-stacks", "-1", path},
+		{"view", "-fold-stacks", "2", "-format", "json", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_LineNumbers(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-line-numbers", "-filter", "level=error", "-fields", "none", path)
+	if want := "1: 10:00:02 [ERROR] b\n3: 10:00:03 [ERROR] c\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+	out, _ = runCapture(t, "view", "-line-numbers", "-format", "logfmt", "-filter", "msg=c", path)
+	if !strings.Contains(out, "_line=3 _offset=") {
+		t.Errorf("logfmt output = %q, want _line and _offset", out)
+	}
+	if _, code := runCapture(t, "follow", "-line-numbers", path); code != 2 {
+		t.Errorf("follow -line-numbers without -from-start: exit code = %d, want 2", code)
+	}
+}
+
+func TestRun_Multiline(t *testing.T) {
+	path := writeLog(t, "{\n  \"level\": \"error\",\n  \"msg\": \"b\"\n}\n{\"level\":\"info\",\"msg\":\"a\"}\n")
+	out, code := runCapture(t, "view", "-input", "json", "-multiline-start", `^\{`, "-line-numbers", "-format", "logfmt", path)
+	if want := "level=error msg=b _line=1 _offset=0\nlevel=info msg=a _line=5 _offset=37\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	path = writeLog(t, "2024-01-15 ERROR boom\n  at main.go:12\n2024-01-15 INFO ok\n")
+	out, _ = runCapture(t, "view", "-strict-logfmt", "-on-error", "raw", "-multiline-cont", `^\s`, "-format", "json", path)
+	if want := `"_raw":"2024-01-15 ERROR boom\n  at main.go:12"`; !strings.Contains(out, want) || strings.Count(out, "\n") != 2 {
+		t.Errorf("output = %q, want two entries, the first %s", out, want)
+	}
+
+	path = writeLog(t, "{\"level\":\"error\",\"msg\":\"boom\"}\njava.lang.IllegalStateException: boom\n\tat com.example.A.run(A.java:12)\n")
+	out, code = runCapture(t, "view", "-input", "json", "-multiline-start", `^\{`, "-format", "json", path)
+	if want := `{"level":"error","msg":"boom\njava.lang.IllegalStateException: boom\n\tat com.example.A.run(A.java:12)"}` + "\n"; code != 0 || out != want {
+		t.Errorf("stack trace output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	for _, flag := range []string{"-multiline-start", "-multiline-cont"} {
+		if _, code := runCapture(t, "view", flag, "(", path); code != 1 {
+			t.Errorf("%s with an invalid pattern: exit code = %d, want 1", flag, code)
+		}
+	}
+}
+
+func TestRun_LegacyStatsFlag(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "-file", path, "-stats", "level")
+	if out != "error: 2\ninfo: 1\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_MergeSubcommand_SortsByTime(t *testing.T) {
+	a := writeLog(t, `{"time":"2024-01-15T10:00:03Z","msg":"third"}`+"\n"+`{"time":"2024-01-15T10:00:01Z","msg":"first"}`+"\n")
+	b := writeLog(t, "time=2024-01-15T10:00:02Z msg=second\n")
+	out, code := runCapture(t, "merge", "-format", "logfmt", "-fields", "msg", a, b)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		for _, kv := range strings.Fields(line) {
+			if strings.HasPrefix(kv, "msg=") {
+				msgs = append(msgs, strings.TrimPrefix(kv, "msg="))
+			}
+		}
+	}
+	if got := strings.Join(msgs, ","); got != "first,second,third" {
+		t.Errorf("merge order = %s, want first,second,third\n%s", got, out)
+	}
+}
+
+func TestRun_MergeSubcommand_MixedOffsets(t *testing.T) {
+	a := writeLog(t, `{"time":"2024-01-15T11:00:00+02:00","msg":"a"}`+"\n") // 09:00 UTC
+	b := writeLog(t, `{"time":"2024-01-15 08:30:00","msg":"b"}`+"\n")
+	c := writeLog(t, `{"time":"2024-01-15T04:45:00-05:00","msg":"c"}`+"\n") // 09:45 UTC
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "b,a,c"},
+		{[]string{"-assume-tz", "-01:00"}, "a,b,c"},
+		{[]string{"-filter", "time>=2024-01-15T09:00:00Z"}, "a,c"},
+		{[]string{"-assume-tz", "-01:00", "-filter", "time>=2024-01-15T09:00:00Z"}, "a,b,c"},
+	}
+	for _, tt := range tests {
+		args := append(append([]string{"merge", "-format", "logfmt"}, tt.args...), a, b, c)
+		out, code := runCapture(t, args...)
+		if code != 0 {
+			t.Fatalf("%v: exit code = %d", tt.args, code)
+		}
+		var msgs []string
+		for _, kv := range strings.Fields(out) {
+			if strings.HasPrefix(kv, "msg=") {
+				msgs = append(msgs, strings.TrimPrefix(kv, "msg="))
+			}
+		}
+		if got := strings.Join(msgs, ","); got != tt.want {
+			t.Errorf("%v: merge order = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRun_AssumeTZ_Invalid(t *testing.T) {
+	if _, code := runCapture(t, "view", "-assume-tz", "+25:00", os.DevNull); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_MergeSubcommand_SourceBreaks(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	os.WriteFile(a, []byte(`{"time":"2024-01-15T10:00:00Z","msg":"a1"}
+{"time":"2024-01-15T10:00:01Z","msg":"a2"}
+`), 0o644)
+	os.WriteFile(b, []byte(`{"time":"2024-01-15T10:00:02Z","msg":"b1"}
+`), 0o644)
+	out, code := runCapture(t, "merge", "-source-breaks", "-fields", "none", a, b)
+	want := "―――― a.log ――――\n10:00:00 [     ] a1\n10:00:01 [     ] a2\n―――― b.log ――――\n10:00:02 [     ] b1\n"
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "merge", "-source-breaks", "-format", "json", a, b); code != 1 {
+		t.Errorf("-format json: exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_MergeSubcommand_RequiresFiles(t *testing.T) {
+	if _, code := runCapture(t, "merge"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestRun_LegacyFileAndMergeExclusive(t *testing.T) {
+	if _, code := runCapture(t, "-file", "a", "-merge", "b"); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_CSV(t *testing.T) {
+	path := writeLog(t, "time,level,msg\n2024-01-15T10:00:01Z,info,a\n2024-01-15T10:00:02Z,error,\"b, c\"\n2024-01-15T10:00:03Z,error,d\n")
+	out, code := runCapture(t, "view", "-input", "csv", "-filter", "level=error", "-format", "logfmt", path)
+	if want := "time=2024-01-15T10:00:02Z level=error msg=\"b, c\"\ntime=2024-01-15T10:00:03Z level=error msg=d\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+	// The header is at the start of the file, so -tail reads it forwards.
+	if out, _ := runCapture(t, "view", "-input", "csv", "-tail", "1", "-format", "logfmt", path); out != "time=2024-01-15T10:00:03Z level=error msg=d\n" {
+		t.Errorf("-tail output = %q", out)
+	}
+
+	path = writeLog(t, "2024-01-15T10:00:01Z\twarn\tdisk low\n")
+	out, _ = runCapture(t, "view", "-input", "tsv", "-csv-columns", "time, level,msg", "-format", "logfmt", path)
+	if want := "time=2024-01-15T10:00:01Z level=warn msg=\"disk low\"\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	for _, args := range [][]string{
+		{"view", "-csv-columns", "a,b", path},
+		{"view", "-input", "csv", "-csv-columns", "a,,b", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestHeaderLine(t *testing.T) {
+	for _, tt := range []struct{ data, want string }{
+		{"\na,b\n1,2\n", "a,b\n"},
+		{"a,b", ""},
+		{"", ""},
+	} {
+		if got, err := headerLine(writeLog(t, tt.data)); got != tt.want || err != nil {
+			t.Errorf("headerLine(%q) = %q, %v; want %q", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestRun_Follow_ReadsAppendedEntries(t *testing.T) {
+	path := writeLog(t, cliLog)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		f.WriteString(`{"time":"2024-01-15T10:00:09Z","level":"error","msg":"appended"}` + "\n")
+	}()
+	// -head ends the run once the appended entry has been printed.
+	out, code := runCapture(t, "view", "-f", "-filter", "level=error", "-head", "3", "-format", "logfmt", path)
+	want := "time=2024-01-15T10:00:02Z level=error msg=b\ntime=2024-01-15T10:00:03Z level=error msg=c\ntime=2024-01-15T10:00:09Z level=error msg=appended\n"
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_Follow_InvalidCombinations(t *testing.T) {
+	path := writeLog(t, cliLog)
+	for _, args := range [][]string{
+		{"view", "-follow"},
+		{"view", "-f", "-tail", "2", path},
+		{"view", "-f", "-quiet", path},
+		{"view", "-f", "-group-by", "level", path},
+		{"view", "-f", "-slowest", "2", path},
+		{"view", "-f", "-format", "avro", path},
+		{"-f", "-stats", "level", "-file", path},
+		{"-f", "-tail", "2", "-file", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_FollowSubcommand_RequiresFile(t *testing.T) {
+	if _, code := runCapture(t, "follow"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+// =============================================================================
+// globalFlags
+// =============================================================================
+
+func TestGlobalFlags_Config_Defaults(t *testing.T) {
+	cfg, err := newGlobalFlags().config()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	if len(cfg.filters) != 0 || cfg.formatter == nil || cfg.match == nil {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestGlobalFlags_Config_InvalidOversize(t *testing.T) {
+	g := newGlobalFlags()
+	g.onOversize = "explode"
+	if _, err := g.config(); err == nil {
+		t.Error("expected an error for an unknown oversize policy")
+	}
+}
+
+func TestGlobalFlags_Config_InvalidFormat(t *testing.T) {
+	g := newGlobalFlags()
+	g.format = "xml"
+	if _, err := g.config(); err == nil {
+		t.Error("expected an error for an unknown output format")
+	}
+}
+
+func TestNonGlobalFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	newGlobalFlags().register(fs)
+	fs.Int("limit", 0, "")
+	if err := fs.Parse([]string{"-format", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	if name := nonGlobalFlag(fs); name != "" {
+		t.Errorf("nonGlobalFlag = %q, want none", name)
+	}
+	if err := fs.Parse([]string{"-limit", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if name := nonGlobalFlag(fs); name != "limit" {
+		t.Errorf("nonGlobalFlag = %q, want limit", name)
+	}
+}
+
+func TestPipelineConfig_SkipsLine(t *testing.T) {
+	tooLong := &parser.LineError{Line: 1, Err: fmt.Errorf("%w; truncated", parser.ErrLineTooLong)}
+	malformed := &parser.LineError{Line: 2, Err: errors.New("bad")}
+	truncating := &pipelineConfig{readOpts: parser.ReadOptions{Oversize: parser.OversizeTruncate}}
+	skipping := &pipelineConfig{}
+	if truncating.skipsLine(tooLong) {
+		t.Error("truncated line counted as skipped")
+	}
+	if !skipping.skipsLine(tooLong) {
+		t.Error("skipped oversized line not counted")
+	}
+	if !truncating.skipsLine(malformed) {
+		t.Error("malformed line not counted")
+	}
+	if skipping.skipsLine(&parser.LineError{Line: 3, Err: fmt.Errorf("%w \"a\"", parser.ErrDuplicateKey)}) {
+		t.Error("line repeating a key counted as skipped")
+	}
+	if skipping.skipsLine(errors.New("reading input: EOF")) {
+		t.Error("read error counted as a skipped line")
+	}
+}
+
+func TestGlobalFlags_Config_OnError(t *testing.T) {
+	g := newGlobalFlags()
+	g.onError = "raw"
+	cfg, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.readOpts.OnError != parser.ErrorRaw {
+		t.Errorf("OnError = %v, want raw", cfg.readOpts.OnError)
+	}
+
+	g.onError = "ignore"
+	if _, err := g.config(); err == nil {
+		t.Error("expected error for unknown --on-error policy")
+	}
+}
+
+func TestGlobalFlags_Config_DuplicateKeys(t *testing.T) {
+	g := newGlobalFlags()
+	g.duplicates = "collect"
+	cfg, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.readOpts.Duplicates != parser.DuplicateCollect || cfg.readOpts.ReportDuplicates {
+		t.Errorf("Duplicates = %v, ReportDuplicates = %v; want collect, false", cfg.readOpts.Duplicates, cfg.readOpts.ReportDuplicates)
+	}
+
+	g.strict = strictOn
+	if cfg, err = g.config(); err != nil || !cfg.readOpts.ReportDuplicates {
+		t.Errorf("ReportDuplicates under --strict = false (err %v), want true", err)
+	}
+
+	g.duplicates = "merge"
+	if _, err := g.config(); err == nil {
+		t.Error("expected error for unknown --duplicate-keys policy")
+	}
+}
+
+func TestGlobalFlags_Config_StrictStop(t *testing.T) {
+	g := newGlobalFlags()
+	g.strict = strictStop
+	cfg, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.readOpts.OnError != parser.ErrorFail || !cfg.strict {
+		t.Errorf("OnError = %v, strict = %v; want fail, true", cfg.readOpts.OnError, cfg.strict)
+	}
+
+	g.onError = "raw"
+	if _, err := g.config(); err == nil {
+		t.Error("expected error combining --strict=stop with --on-error raw")
+	}
+}
+
+func TestPipelineConfig_StopsRun(t *testing.T) {
+	tooLong := &parser.LineError{Line: 1, Err: fmt.Errorf("%w; stopping", parser.ErrLineTooLong)}
+	malformed := &parser.LineError{Line: 2, Err: errors.New("bad")}
+	duplicate := &parser.LineError{Line: 3, Err: fmt.Errorf("%w \"a\"", parser.ErrDuplicateKey)}
+	tests := []struct {
+		opts parser.ReadOptions
+		err  error
+		want bool
+	}{
+		{parser.ReadOptions{}, tooLong, false},
+		{parser.ReadOptions{}, malformed, false},
+		{parser.ReadOptions{Oversize: parser.OversizeError}, tooLong, true},
+		{parser.ReadOptions{Oversize: parser.OversizeError}, malformed, false},
+		{parser.ReadOptions{OnError: parser.ErrorFail}, malformed, true},
+		{parser.ReadOptions{OnError: parser.ErrorFail}, tooLong, false},
+		{parser.ReadOptions{OnError: parser.ErrorFail}, duplicate, false},
+	}
+	for i, tt := range tests {
+		cfg := &pipelineConfig{readOpts: tt.opts}
+		if got := cfg.stopsRun(tt.err); got != tt.want {
+			t.Errorf("case %d: stopsRun = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+// =============================================================================
+// grepExit
+// =============================================================================
+
+func TestGrepExit_Status(t *testing.T) {
+	cfg := &pipelineConfig{match: func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }}
+	ge := newGrepExit(true)
+	ge.watch(cfg)
+	if got := ge.status(0); got != 1 {
+		t.Errorf("status(0) before a match = %d, want 1", got)
+	}
+	cfg.process(parser.NewEntry(map[string]any{"level": "info"}))
+	if got := ge.status(0); got != 1 {
+		t.Errorf("status(0) after a non-match = %d, want 1", got)
+	}
+	cfg.process(parser.NewEntry(map[string]any{"level": "error"}))
+	if got := ge.status(0); got != 0 {
+		t.Errorf("status(0) after a match = %d, want 0", got)
+	}
+	if got := ge.status(1); got != 2 {
+		t.Errorf("status(1) = %d, want 2", got)
+	}
+}
+
+func TestGrepExit_Disabled_KeepsCode(t *testing.T) {
+	ge := newGrepExit(false)
+	cfg := &pipelineConfig{match: matchAll}
+	ge.watch(cfg)
+	for _, code := range []int{0, 1, 2} {
+		if got := ge.status(code); got != code {
+			t.Errorf("status(%d) = %d, want unchanged", code, got)
+		}
+	}
+}
+
+// =============================================================================
+// windowFlags
+// =============================================================================
+
+func TestWindowFlags_Window(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    window
+		wantErr bool
+	}{
+		{nil, window{}, false},
+		{[]string{"-head", "3"}, window{head: 3}, false},
+		{[]string{"-limit", "3"}, window{head: 3}, false},
+		{[]string{"-head", "3", "-limit", "3"}, window{head: 3}, false},
+		{[]string{"-tail", "4"}, window{tail: 4}, false},
+		{[]string{"-head", "3", "-limit", "4"}, window{}, true},
+		{[]string{"-limit", "3", "-tail", "4"}, window{}, true},
+		{[]string{"-head", "-1"}, window{}, true},
+		{[]string{"-tail", "-1"}, window{}, true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var wf windowFlags
+		wf.register(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		got, err := wf.window()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%v: window() = %+v, %v; want %+v, error %v", tt.args, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// =============================================================================
+// fileArg
+// =============================================================================
+
+func TestFileArg(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a-1.log", "b-1.log", "b-2.log", "c[1].log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		args    []string
+		flag    string
+		want    string
+		wantErr bool
+	}{
+		{nil, "", "", false},
+		{nil, "a.log", "a.log", false},
+		{[]string{"b.log"}, "", "b.log", false},
+		{[]string{"b.log"}, "a.log", "", true},
+		{[]string{"b.log", "c.log"}, "", "", true},
+		{nil, filepath.Join(dir, "a-*.log"), filepath.Join(dir, "a-1.log"), false},
+		{[]string{filepath.Join(dir, "a-?.log")}, "", filepath.Join(dir, "a-1.log"), false},
+		{nil, filepath.Join(dir, "c[1].log"), filepath.Join(dir, "c[1].log"), false},
+		{nil, filepath.Join(dir, "b-*.log"), "", true},
+		{nil, filepath.Join(dir, "d-*.log"), "", true},
+		{nil, filepath.Join(dir, "[.log"), "", true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		got, err := fileArg(fs, tt.flag)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("fileArg(%v, %q) = %q, %v; want %q, error %v", tt.args, tt.flag, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRun_Listen_Invalid(t *testing.T) {
+	path := writeLog(t, cliLog)
+	for _, args := range [][]string{
+		{"view", "-listen", "tcp://127.0.0.1:24224"},
+		{"view", "-listen", "forward://"},
+		{"view", "-listen", "grpc://"},
+		{"view", "-listen", "gelf://127.0.0.1:12201"},
+		{"view", "-listen", "gelf+udp://127.0.0.1:0", path},
+		{"view", "-listen", "grpc://127.0.0.1:0", path},
+		{"view", "-listen", "forward://127.0.0.1:0", path},
+		{"view", "-listen", "forward://127.0.0.1:0", "-tail", "1"},
+		{"view", "-listen", "forward://127.0.0.1:0", "-q"},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestReceiveStream_FormatsMatchingEvents(t *testing.T) {
+	srv, err := forward.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGlobalFlags()
+	g.format = "json"
+	g.filters = multiFlag{"level=error"}
+	cfg, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// [tag, time, record] messages in MessagePack, the first an info entry.
+	message := func(level string) []byte {
+		return append([]byte{0x93, 0xa3, 'a', 'p', 'p', 0x01, 0x81, 0xa5, 'l', 'e', 'v', 'e', 'l', 0xa0 | byte(len(level))}, level...)
+	}
+	c.Write(append(append(message("info"), message("error")...), message("error")...))
+
+	var code int
+	out := captureStdout(t, func() { code = receiveStream(cfg, srv, window{head: 1}) })
+	if want := `{"time":"1970-01-01T00:00:01Z","level":"error","_tag":"app"}` + "\n"; code != 0 || out != want {
+		t.Errorf("output = %q (exit %d), want %q", out, code, want)
+	}
+}
+
+func TestReceiveStream_GRPC(t *testing.T) {
+	srv, err := logstream.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGlobalFlags()
+	g.format = "json"
+	g.filters = multiFlag{"level=error"}
+	cfg, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Length-prefixed LogRecords with a level (field 2) and a message
+	// (field 3), the first an info entry.
+	var body bytes.Buffer
+	for _, r := range [][2]string{{"info", "a"}, {"error", "b"}} {
+		rec := append([]byte{0x12, byte(len(r[0]))}, r[0]...)
+		rec = append(append(rec, 0x1a, byte(len(r[1]))), r[1]...)
+		body.Write([]byte{0, 0, 0, 0, byte(len(rec))})
+		body.Write(rec)
+	}
+	go func() {
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+		resp, err := client.Post("http://"+srv.Addr().String()+logstream.PushPath, "application/grpc", &body)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+
+	var code int
+	out := captureStdout(t, func() { code = receiveStream(cfg, srv, window{head: 1}) })
+	if want := `{"level":"error","msg":"b"}` + "\n"; code != 0 || out != want {
+		t.Errorf("output = %q (exit %d), want %q", out, code, want)
+	}
+}
+
+func TestReceiveStream_GELF(t *testing.T) {
+	srv, err := gelf.Listen("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGlobalFlags()
+	g.format = "json"
+	g.filters = multiFlag{"level=error"}
+	cfg, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.Dial("udp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// Syslog levels 6 and 3: info and error.
+	c.Write([]byte(`{"version":"1.1","host":"web-1","short_message":"a","timestamp":1,"level":6}`))
+	c.Write([]byte(`{"version":"1.1","host":"web-1","short_message":"b","timestamp":2,"level":3,"_user":"ann"}`))
+
+	var code int
+	out := captureStdout(t, func() { code = receiveStream(cfg, srv, window{head: 1}) })
+	if want := `{"time":"1970-01-01T00:00:02Z","level":"error","msg":"b","host":"web-1","user":"ann"}` + "\n"; code != 0 || out != want {
+		t.Errorf("output = %q (exit %d), want %q", out, code, want)
+	}
+}
+
+func TestRun_GroupBy(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:02Z","trace_id":"b","msg":"b start"}
+{"time":"2024-01-15T10:00:01Z","trace_id":"a","msg":"a start"}
+{"time":"2024-01-15T10:00:03Z","trace_id":"b","msg":"b end"}
+{"time":"2024-01-15T10:00:04Z","msg":"no trace"}
+{"time":"2024-01-15T10:00:05Z","trace_id":"a","msg":"a end"}
+`)
+	out, code := runCapture(t, "view", "-group-by", "trace_id", "-fields", "none", path)
+	want := `=== trace_id=a (2 entries) ===
+10:00:01 [     ] a start
+10:00:05 [     ] a end
+
+=== trace_id=b (2 entries) ===
+10:00:02 [     ] b start
+10:00:03 [     ] b end
+
+=== trace_id=(none) (1 entry) ===
+10:00:04 [     ] no trace
+`
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	out, code = runCapture(t, "-group-by", "trace_id", "-format", "logfmt", "-filter", "msg~end", "-file", path)
+	if want := "time=2024-01-15T10:00:03Z trace_id=b msg=\"b end\"\ntime=2024-01-15T10:00:05Z trace_id=a msg=\"a end\"\n"; code != 0 || out != want {
+		t.Errorf("logfmt output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-group-by", "trace_id", "-head", "1", path},
+		{"view", "-group-by", "trace_id", "-q", path},
+		{"-group-by", "trace_id", "-stats", "msg", "-file", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_GroupByMerged(t *testing.T) {
+	dir := t.TempDir()
+	api := filepath.Join(dir, "api.log")
+	db := filepath.Join(dir, "db.log")
+	if err := os.WriteFile(api, []byte(`{"time":"2024-01-15T10:00:02Z","trace_id":"b","msg":"api b"}
+{"time":"2024-01-15T10:00:04Z","trace_id":"a","msg":"api a"}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db, []byte(`{"time":"2024-01-15T10:00:01Z","trace_id":"a","msg":"db a"}
+{"time":"2024-01-15T10:00:03Z","trace_id":"b","msg":"db b"}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := `=== trace_id=a (2 entries) ===
+10:00:01 [     ] db a
+10:00:04 [     ] api a
+
+=== trace_id=b (2 entries) ===
+10:00:02 [     ] api b
+10:00:03 [     ] db b
+`
+	for _, args := range [][]string{
+		{"-group-by", "trace_id", "-fields", "none", api, db},
+		{"-group-by", "trace_id", "-fields", "none", "-merge", api, "-merge", db},
+		{"merge", "-group-by", "trace_id", "-fields", "none", api, db},
+	} {
+		if out, code := runCapture(t, args...); code != 0 || out != want {
+			t.Errorf("%v: output (exit %d) =\n%s\nwant\n%s", args, code, out, want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"merge", "-group-by", "trace_id", "-head", "1", api, db},
+		{"merge", "-group-by", "trace_id", "-source-breaks", api, db},
+		{"merge", "-group-by", "trace_id", "-mark-gaps", "1s", api, db},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_DedupeWindow(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","msg":"connection refused, retrying"}
+{"time":"2024-01-15T10:00:01Z","msg":"request served"}
+{"time":"2024-01-15T10:00:02Z","msg":"connection refused, retrying"}
+{"time":"2024-01-15T10:00:03Z","msg":"connection refused, retrying"}
+{"time":"2024-01-15T10:00:04Z","msg":"request served"}
+{"time":"2024-01-15T10:00:06Z","msg":"cache warmed"}
+{"time":"2024-01-15T10:00:07Z","msg":"connection refused, retrying"}
+{"time":"2024-01-15T10:00:08Z","msg":"connection refused, retrying"}
+`)
+	out, code := runCapture(t, "view", "-dedupe-window", "5s", "-fields", "none", path)
+	want := `10:00:00 [     ] connection refused, retrying
+10:00:01 [     ] request served
+10:00:03 [     ] suppressed 2 duplicates of msg="connection refused, retrying" within 5s
+10:00:04 [     ] suppressed 1 duplicate of msg="request served" within 5s
+10:00:06 [     ] cache warmed
+10:00:07 [     ] connection refused, retrying
+10:00:08 [     ] suppressed 1 duplicate of msg="connection refused, retrying" within 5s
+`
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	out, code = runCapture(t, "-dedupe-window", "1m", "-format", "json", "-filter", "msg~retrying", "-file", path)
+	want = `{"time":"2024-01-15T10:00:00Z","msg":"connection refused, retrying"}
+{"time":"2024-01-15T10:00:08Z","msg":"suppressed 4 duplicates of msg=\"connection refused, retrying\" within 1m0s","_suppressed":4}
+`
+	if code != 0 || out != want {
+		t.Errorf("json output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-dedupe-key", "msg", path},
+		{"view", "-dedupe-window", "-1s", path},
+		{"view", "-dedupe-window", "5s", "-q", path},
+		{"view", "-dedupe-window", "5s", "-group-by", "msg", path},
+		{"-dedupe-window", "5s", "-stats", "msg", "-file", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_DedupeFields(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","level":"error","msg":"disk full"}
+{"time":"2024-01-15T10:00:01Z","level":"warn","msg":"disk full"}
+{"time":"2024-01-15T10:00:02Z","level":"error","msg":"disk full"}
+{"time":"2024-01-15T10:05:00Z","msg":"disk full"}
+{"time":"2024-01-15T10:09:00Z","level":"error","msg":"disk full"}
+{"time":"2024-01-15T10:09:30Z","msg":"disk full"}
+{"time":"2024-01-15T10:10:00Z","other":"x"}
+`)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-dedupe", "msg,level", path)
+	want := `time=2024-01-15T10:00:00Z level=error msg="disk full"
+time=2024-01-15T10:00:01Z level=warn msg="disk full"
+time=2024-01-15T10:05:00Z msg="disk full"
+time=2024-01-15T10:10:00Z other=x
+time=2024-01-15T10:09:00Z msg="suppressed 2 duplicates of msg=\"disk full\" level=\"error\"" _suppressed=2
+time=2024-01-15T10:09:30Z msg="suppressed 1 duplicate of msg=\"disk full\"" _suppressed=1
+`
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	out, code = runCapture(t, "view", "-value", "msg", "-dedupe", "msg,level", "-dedupe-window", "5m", "-filter", "level=error", path)
+	want = `disk full
+suppressed 1 duplicate of msg="disk full" level="error" within 5m0s
+disk full
+`
+	if code != 0 || out != want {
+		t.Errorf("windowed output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-dedupe", "msg,", path},
+		{"view", "-dedupe", "msg", "-dedupe-window", "5s", "-dedupe-key", "msg", path},
+		{"view", "-dedupe", "msg", "-q", path},
+		{"-dedupe", "msg", "-stats", "msg", "-file", path},
+		{"view", "-dedupe", "msg", "-slowest", "1", "-by", "n", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_Slowest(t *testing.T) {
+	path := writeLog(t, `{"path":"/a","duration_ms":120}
+{"path":"/b","duration_ms":"950"}
+{"path":"/c"}
+{"path":"/d","duration_ms":40}
+{"path":"/e","duration_ms":120}
+{"path":"/f","duration_ms":700}
+{"path":"/g","duration_ms":"slow"}
+`)
+	out, code := runCapture(t, "view", "-slowest", "3", "-by", "duration_ms", "-format", "json", path)
+	want := `{"path":"/b","duration_ms":"950"}
+{"path":"/f","duration_ms":700}
+{"path":"/a","duration_ms":120}
+`
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	out, code = runCapture(t, "-slowest", "2", "-by", "duration_ms", "-filter", "duration_ms<500", "-value", "path", "-file", path)
+	if want := "/a\n/e\n"; code != 0 || out != want {
+		t.Errorf("filtered output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-slowest", "3", path},
+		{"view", "-by", "duration_ms", path},
+		{"view", "-slowest", "-1", "-by", "duration_ms", path},
+		{"view", "-slowest", "3", "-by", "duration_ms", "-tail", "2", path},
+		{"view", "-slowest", "3", "-by", "duration_ms", "-group-by", "path", path},
+		{"-slowest", "3", "-by", "duration_ms", "-stats", "path", "-file", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_Slowest_Merged(t *testing.T) {
+	dir := t.TempDir()
+	api := filepath.Join(dir, "api.log")
+	db := filepath.Join(dir, "db.log")
+	if err := os.WriteFile(api, []byte(`{"time":"2024-01-15T10:00:01Z","path":"/a","duration_ms":120}
+{"time":"2024-01-15T10:00:04Z","path":"/b","duration_ms":950}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db, []byte(`{"time":"2024-01-15T10:00:02Z","path":"/c","duration_ms":700}
+{"time":"2024-01-15T10:00:03Z","path":"/d","duration_ms":40}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-slowest", "2", "-by", "duration_ms", "-value", "path", api, db},
+		{"-slowest", "2", "-by", "duration_ms", "-value", "path", "-merge", api, "-merge", db},
+		{"merge", "-slowest", "2", "-by", "duration_ms", "-value", "path", api, db},
+	} {
+		if out, code := runCapture(t, args...); code != 0 || out != "/b\n/c\n" {
+			t.Errorf("%v: output (exit %d) = %q, want %q", args, code, out, "/b\n/c\n")
+		}
+	}
+
+	for _, args := range [][]string{
+		{"merge", "-slowest", "2", api, db},
+		{"merge", "-slowest", "2", "-by", "duration_ms", "-tail", "1", api, db},
+		{"merge", "-slowest", "2", "-by", "duration_ms", "-group-by", "path", api, db},
+		{"merge", "-slowest", "2", "-by", "duration_ms", "-source-breaks", api, db},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_Slowest_ByAfterPipeline(t *testing.T) {
+	path := writeLog(t, `{"path":"/a","s":0.12}
+{"path":"/b"}
+{"path":"/c","s":0.95}
+{"path":"/d","s":0.7}
+`)
+	// -by reads the field -jq adds, not the entry as it was read.
+	out, code := runCapture(t, "view", "-slowest", "2", "-by", "ms", "-jq", ".ms = .s * 1000", "-value", "path", path)
+	if want := "/c\n/d\n"; code != 0 || out != want {
+		t.Errorf("-jq output (exit %d) = %q, want %q", code, out, want)
+	}
+	// -every counts every matching entry, with the field or without.
+	out, code = runCapture(t, "view", "-slowest", "3", "-by", "s", "-every", "2", "-value", "path", path)
+	if want := "/c\n/a\n"; code != 0 || out != want {
+		t.Errorf("-every output (exit %d) = %q, want %q", code, out, want)
+	}
+}
+
+func TestRun_Slowest_Durations(t *testing.T) {
+	path := writeLog(t, `{"path":"/a","d":"1.2s"}
+{"path":"/b","d":"20ms"}
+{"path":"/c","d":0.3}
+{"path":"/d","d":"slow"}
+`)
+	out, code := runCapture(t, "view", "-slowest", "2", "-by", "d", "-value", "path", path)
+	if want := "/a\n/c\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+}
+
+func TestTopEntries_CountsSkipped(t *testing.T) {
+	ch := make(chan *parser.LogEntry, 5)
+	for _, d := range []any{"1.2s", "slow", nil, float64(2), true} {
+		e := parser.NewEntry(map[string]any{"msg": "x"})
+		if d != nil {
+			e.Fields["d"] = d
+		}
+		ch <- e
+	}
+	close(ch)
+	top, skipped := topEntries(ch, matchAll, "d", 3)
+	// The entry without the field is left out without being counted.
+	if len(top) != 2 || top[0].Fields["d"] != float64(2) || top[1].Fields["d"] != "1.2s" || skipped != 2 {
+		t.Errorf("topEntries = %v, %d skipped; want [2 1.2s], 2 skipped", top, skipped)
+	}
+}
+
+func TestRun_Replay(t *testing.T) {
+	path := writeLog(t, cliLog)
+	start := time.Now()
+	out, code := runCapture(t, "view", "-replay", "-speed", "20x", "-value", "msg", path)
+	if want := "b\na\nc\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+	// b to c is one second apart at 20 times the recorded pace.
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("replay took %s, want at least 50ms", elapsed)
+	}
+
+	out, code = runCapture(t, "merge", "-replay", "-speed", "1000x", "-value", "msg", path)
+	if want := "a\nb\nc\n"; code != 0 || out != want {
+		t.Errorf("merge output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-speed", "10x", path},
+		{"view", "-replay", "-speed", "0x", path},
+		{"view", "-replay", "-tail", "2", path},
+		{"-replay", "-stats", "level", "-file", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_RebaseTime(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	os.WriteFile(a, []byte(`{"time":"2024-01-15T10:00:00.250Z","msg":"a1"}
+{"time":"2024-01-15T10:00:03.782Z","msg":"a2"}
+`), 0o644)
+	os.WriteFile(b, []byte(`{"ts":"2024-01-15T10:00:01Z","msg":"b1"}
+{"msg":"b2"}
+`), 0o644)
+	out, code := runCapture(t, "merge", "-rebase-time", "-format", "logfmt", a, b)
+	want := `msg=b2 _source=b.log
+time=+0.000s msg=a1 _source=a.log
+ts=+0.750s msg=b1 _source=b.log
+time=+3.532s msg=a2 _source=a.log
+`
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	out, _ = runCapture(t, "-rebase-time", "-file", a)
+	if want := "+0.000s [     ] a1\n+3.532s [     ] a2\n"; out != want {
+		t.Errorf("text output = %q, want %q", out, want)
+	}
+}
+
+func TestRun_ValidateCommand(t *testing.T) {
+	path := writeLog(t, `{"level":"info"}
+not json
+[1,2]
+
+{"level":
+{"level":"warn"}
+{"level":"error"}
+`)
+	out, code := runCapture(t, "validate", "-examples", "1", path)
+	want := path + ` (json): 6 lines, 3 valid entries, 3 invalid (50.00%)
+
+invalid JSON: 2
+  line 2: invalid character 'o' in literal null (expecting 'u')
+
+not a JSON object: 1
+  line 3: json: cannot unmarshal array into Go value of type map[string]interface {}
+`
+	if code != 1 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant (exit 1)\n%s", code, out, want)
+	}
+	if _, code := runCapture(t, "validate", "-max-error-rate", "50", path); code != 0 {
+		t.Errorf("-max-error-rate 50: exit code = %d, want 0", code)
+	}
+
+	path = writeLog(t, "a=1 b=\"x\nk=v k=w\nok=1\n")
+	out, code = runCapture(t, "-input", "logfmt", "validate", "-file", path)
+	if want := "(logfmt): 3 lines, 1 valid entries, 2 invalid (66.67%)\n"; code != 1 || !strings.Contains(out, want) {
+		t.Errorf("logfmt output (exit %d) missing %q:\n%s", code, want, out)
+	}
+	if !strings.Contains(out, "\ninvalid logfmt: 1\n") || !strings.Contains(out, "\nduplicate key: 1\n") {
+		t.Errorf("logfmt output missing an error type:\n%s", out)
+	}
+
+	for _, args := range [][]string{
+		{"validate", "-max-error-rate", "101", path},
+		{"validate", "-examples", "-1", path},
+	} {
+		if _, code := runCapture(t, args...); code != 2 {
+			t.Errorf("%v: exit code = %d, want 2", args, code)
+		}
+	}
+}
+
+func TestRun_MarkGaps(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","msg":"a"}
+{"time":"2024-01-15T10:00:01Z","msg":"b"}
+{"time":"2024-01-15T10:00:43Z","msg":"c"}
+`)
+	out, code := runCapture(t, "view", "-mark-gaps", "5s", path)
+	if want := "10:00:00 [     ] a\n10:00:01 [     ] b\n―――― 42s gap ――――\n10:00:43 [     ] c\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+	out, _ = runCapture(t, "view", "-mark-gaps", "5s", "-head", "2", path)
+	if strings.Contains(out, "gap") {
+		t.Errorf("-head 2 output = %q, want no gap marked past the limit", out)
+	}
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-mark-gaps", "-1s", path}, 1},
+		{[]string{"view", "-mark-gaps", "5s", "-format", "json", path}, 1},
+		{[]string{"view", "-mark-gaps", "5s", "-group-by", "msg", path}, 1},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+func TestRun_StatsCompare(t *testing.T) {
+	path := writeLog(t, `{"level":"error","service":"api"}
+{"level":"info","service":"api"}
+{"level":"error","service":"worker"}
+{"level":"error","service":"api"}
+{"service":"worker"}
+{"level":"info","service":"db"}
+`)
+	want := `level   service=api  service=worker
+error   2            1
+(none)  0            1
+info    1            0
+`
+	out, code := runCapture(t, "-stats", "level", "-compare", "service=api", "-compare", "service=worker", "-file", path)
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	out, code = runCapture(t, "stats", "-field", "level", "-compare", "service=api", "-compare", "service=worker", path, path)
+	want = `level   service=api  service=worker
+error   4            2
+(none)  0            2
+info    2            0
+`
+	if code != 0 || out != want {
+		t.Errorf("merged output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"stats", "-field", "level", "-compare", "service=api", path},
+		{"stats", "-field", "level", "-compare", "service", "-compare", "service=api", path},
+		{"-compare", "service=api", "-compare", "service=worker", "-file", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_ColorLines(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-color-lines", "-filter", "level=error", "-fields", "none", path)
+	want := "\033[31m10:00:02 [ERROR] b\033[0m\n\033[31m10:00:03 [ERROR] c\033[0m\n"
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "view", "-color-lines", "-format", "json", path); code != 1 {
+		t.Errorf("-color-lines -format json: exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_WrapAndTruncate(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","level":"info","msg":"the connection pool was exhausted after three retries"}
+`)
+	out, code := runCapture(t, "view", "-truncate", "-width", "30", path)
+	if want := "10:00:00 [INFO ] the connecti…\n"; code != 0 || out != want {
+		t.Errorf("-truncate: output (exit %d) = %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-wrap", "-width", "40", path)
+	want := "10:00:00 [INFO ] the connection pool was\n                 exhausted after three\n                 retries\n"
+	if code != 0 || out != want {
+		t.Errorf("-wrap: output (exit %d) = %q, want %q", code, out, want)
+	}
+	for _, args := range [][]string{
+		{"view", "-wrap", "-truncate", path},
+		{"view", "-width", "40", path},
+		{"view", "-truncate", "-format", "json", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_Align(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","level":"info","msg":"started","user":"alice"}
+{"time":"2024-01-15T10:00:01Z","level":"warning","msg":"slow request","user":"bob","dur":1500}
+`)
+	out, code := runCapture(t, "view", "-align", "-fields", "dur,user", path)
+	want := "10:00:00 [INFO ]   started               user=alice\n" +
+		"10:00:01 [WARNING] slow request dur=1500 user=bob\n"
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+	if _, code := runCapture(t, "view", "-align", "-format", "json", path); code != 1 {
+		t.Errorf("-align -format json: exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_Icons(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-icons", "-filter", "level=error", "-fields", "none", path)
+	if want := "10:00:02 ✖ [ERROR] b\n10:00:03 ✖ [ERROR] c\n"; code != 0 || out != want {
+		t.Errorf("-icons: output (exit %d) = %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-icons=only", "-filter", "level=error", "-fields", "none", path)
+	if want := "10:00:02 ✖ b\n10:00:03 ✖ c\n"; code != 0 || out != want {
+		t.Errorf("-icons=only: output (exit %d) = %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "view", "-icons=sometimes", path); code != 2 {
+		t.Errorf("-icons=sometimes: exit code = %d, want 2", code)
+	}
+	if _, code := runCapture(t, "view", "-icons", "-format", "json", path); code != 1 {
+		t.Errorf("-icons -format json: exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_Value(t *testing.T) {
+	path := writeLog(t, `{"level":"error","user":"alice","path":"/pay","msg":"declined"}
+{"level":"info","msg":"startup"}
+{"level":"error","user":"bob","msg":"timeout"}
+`)
+	out, code := runCapture(t, "view", "-value", "user", "-filter", "level=error", path)
+	if want := "alice\nbob\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	out, code = runCapture(t, "-value", "user", "-value", "path", "-file", path)
+	if want := "alice\t/pay\nbob\t\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	out, _ = runCapture(t, "view", "-explain", "-value", "user", path)
+	if want := "Formatter: raw values of user\n"; !strings.Contains(out, want) {
+		t.Errorf("explain output missing %q:\n%s", want, out)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-value", "user", "-format", "json", path},
+		{"view", "-value", "user", "-fields", "msg", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+func TestRun_SQL(t *testing.T) {
+	path := writeLog(t, `{"level":"error","service":"api","msg":"timeout"}
+{"level":"info","service":"api","msg":"served"}
+{"level":"error","service":"worker","msg":"job failed"}
+{"level":"error","service":"api","msg":"timeout"}
+`)
+	out, code := runCapture(t, "sql", `SELECT service, count(*) FROM logs WHERE level="error" GROUP BY service ORDER BY 2 DESC`, path)
+	if want := "service  count(*)\napi      2\nworker   1\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	out, code = runCapture(t, "sql", "-output", "csv", "-filter", "service=api", "SELECT *, upper(level) AS lvl LIMIT 2", path)
+	if want := "level,service,msg,lvl\nerror,api,timeout,ERROR\ninfo,api,served,INFO\n"; code != 0 || out != want {
+		t.Errorf("csv output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	out, code = runCapture(t, "sql", "-output", "json", "SELECT msg, count(*) AS n GROUP BY msg HAVING n > 1", path)
+	if want := `{"msg":"timeout","n":2}` + "\n"; code != 0 || out != want {
+		t.Errorf("json output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	// logfmt values are text: those spelling a number are summed, the rest
+	// only counted.
+	logfmt := writeLog(t, "latency=7 msg=a\nlatency=n/a msg=b\nmsg=c\nlatency=3 msg=d\n")
+	out, code = runCapture(t, "sql", "-output", "csv", "SELECT sum(latency), avg(latency), count(latency), count(*)", logfmt)
+	if want := "sum(latency),avg(latency),count(latency),count(*)\n10,5,3,4\n"; code != 0 || out != want {
+		t.Errorf("logfmt output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"sql", path},
+		{"sql", "SELECT msg FROM events", path},
+		{"sql", "SELECT msg WHERE count(*) > 1", path},
+		{"sql", "-output", "xml", "SELECT msg", path},
+		{"sql", "SELECT msg", path, path},
+	} {
+		if _, code := runCapture(t, args...); code != 2 {
+			t.Errorf("%v: exit code = %d, want 2", args, code)
+		}
+	}
+}
+
+func TestGroupHeader_QuotesOddValues(t *testing.T) {
+	tests := []struct {
+		g    entryGroup
+		want string
+	}{
+		{entryGroup{value: "abc", entries: make([]*parser.LogEntry, 3)}, "=== id=abc (3 entries) ==="},
+		{entryGroup{value: "two words", entries: make([]*parser.LogEntry, 1)}, `=== id="two words" (1 entry) ===`},
+		{entryGroup{value: "\x1b[2J", entries: make([]*parser.LogEntry, 1)}, `=== id="\x1b[2J" (1 entry) ===`},
+		{entryGroup{value: "", entries: make([]*parser.LogEntry, 1)}, `=== id="" (1 entry) ===`},
+	}
+	for _, tt := range tests {
+		if got := groupHeader("id", &tt.g); got != tt.want {
+			t.Errorf("groupHeader(%q) = %q, want %q", tt.g.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/tylermac92/logpipe/filter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// compareFlag defines -compare on fs.
+func compareFlag(fs *flag.FlagSet, exprs *multiFlag) {
+	fs.Var(exprs, "compare", "Filter expression whose matching entries get their own column of counts in the stats table (repeatable; give at least two)")
+}
+
+// compareColumn is one -compare column of a stats table: the counts of the
+// entries that satisfy its filter.
+type compareColumn struct {
+	expr string
+	f    *filter.FieldFilter
+}
+
+// parseCompare parses the -compare expressions, of which there must be
+// none or at least two. Timestamps without a UTC offset are taken to be in
+// loc.
+func parseCompare(exprs []string, loc *time.Location) ([]compareColumn, error) {
+	if len(exprs) == 1 {
+		return nil, fmt.Errorf("--compare needs at least two filter expressions, one per column")
+	}
+	cols := make([]compareColumn, 0, len(exprs))
+	for _, expr := range exprs {
+		f, err := filter.NewFieldFilterIn(expr, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --compare: %w", err)
+		}
+		cols = append(cols, compareColumn{expr: expr, f: f})
+	}
+	return cols, nil
+}
+
+// comparedStat is a row of a stats table with -compare columns: a value
+// of the field and how often it occurs in each column.
+type comparedStat struct {
+	Value  string
+	Counts []int
+	total  int
+}
+
+// collectComparedStats drains entries and counts the values of field
+// among those satisfying match, once for each column whose filter they
+// also satisfy. Rows are ordered by their total count, most frequent
+// first, then by value.
+func collectComparedStats(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, field string, cols []compareColumn) []comparedStat {
+	rows := make(comparedCounts)
+	for entry := range entries {
+		if match(entry) {
+			rows.add(entry, field, cols)
+		}
+		parser.Release(entry)
+	}
+	return rows.sorted()
+}
+
+// comparedCounts tallies the rows of a stats table with -compare columns,
+// by value of the field.
+type comparedCounts map[string]*comparedStat
+
+// add counts the value of field in entry once for each column whose filter
+// entry satisfies.
+func (c comparedCounts) add(entry *parser.LogEntry, field string, cols []compareColumn) {
+	var row *comparedStat
+	for i, col := range cols {
+		if !col.f.Match(entry) {
+			continue
+		}
+		if row == nil {
+			key := statValue(entry, field)
+			if row = c[key]; row == nil {
+				row = &comparedStat{Value: key, Counts: make([]int, len(cols))}
+				c[key] = row
+			}
+		}
+		row.Counts[i]++
+		row.total++
+	}
+}
+
+// sorted returns the rows ordered by their total count, most frequent
+// first, then by value. The rows are copies, unaffected by later counts.
+func (c comparedCounts) sorted() []comparedStat {
+	result := make([]comparedStat, 0, len(c))
+	for _, row := range c {
+		r := *row
+		r.Counts = slices.Clone(row.Counts)
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].total != result[j].total {
+			return result[i].total > result[j].total
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
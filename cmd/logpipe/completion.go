@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// completeCommand is the hidden command the completion scripts run to
+// obtain candidates: "logpipe __complete word..." prints the completions
+// for the last word, one per line, given the words before it.
+const completeCommand = "__complete"
+
+// fieldSniffBytes bounds how much of a file is parsed to discover its field
+// names for completion.
+const fieldSniffBytes = 64 << 10
+
+// errInspected is returned by parseFlags while inspectFlags is set.
+var errInspected = errors.New("flags inspected")
+
+// inspectFlags, when non-nil, is called by parseFlags with a command's
+// fully defined flag set instead of parsing it, and the command then exits
+// without doing anything. Completion uses it to list each command's flags.
+var inspectFlags func(fs *flag.FlagSet)
+
+// valueCompletions lists the fixed choices offered for flag values.
+var valueCompletions = map[string][]string{
+	"format":          {"text", "json", "logfmt", "table", "template", "avro", "parquet", "loki", "syslog"},
+	"input":           {"auto", "json", "gcp", "syslog", "syslog-bsd", "logfmt", "csv", "tsv"},
+	"on-oversize":     {"skip", "truncate", "error"},
+	"on-error":        {"skip", "raw", "fail"},
+	"duplicate-keys":  {"first", "last", "collect"},
+	"numbers":         {"exact", "float"},
+	"on-invalid":      {"report", "drop", "only"},
+	"output":          {"table", "csv", "json"},
+	"stats-format":    statsFormats,
+	"syslog-facility": syslogFacilities,
+	"time-display":    {"absolute", "relative", "elapsed"},
+	"key-order":       {"input", "canonical", "alphabetical"},
+}
+
+// fieldFlags are the flags whose values are (or begin with) field names.
+var fieldFlags = map[string]bool{"fields": true, "filter": true, "query": true, "stats": true, "field": true, "value": true, "by": true, "compare": true, "every-key": true, "dedupe": true, "anonymize": true}
+
+// completionScripts holds the script printed by "logpipe completion" for
+// each supported shell.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for logpipe; load with: source <(logpipe completion bash)
+_logpipe() {
+    local IFS=$'\n'
+    COMPREPLY=($(logpipe __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _logpipe logpipe
+`,
+	"zsh": `#compdef logpipe
+# zsh completion for logpipe; load with: source <(logpipe completion zsh)
+_logpipe() {
+    local -a candidates
+    candidates=("${(@f)$(logpipe __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ -n ${candidates[1]} ]]; then
+        compadd -- $candidates
+    else
+        _files
+    fi
+}
+compdef _logpipe logpipe
+`,
+	"fish": `# fish completion for logpipe; load with: logpipe completion fish | source
+function __logpipe_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    logpipe __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c logpipe -a '(__logpipe_complete)'
+`,
+}
+
+// runCompletion implements "logpipe completion bash|zsh|fish".
+func runCompletion(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe completion bash|zsh|fish\n\nPrints a completion script for the shell. For example:\n\n  source <(logpipe completion bash)\n  source <(logpipe completion zsh)\n  logpipe completion fish | source\n")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	script, ok := completionScripts[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unsupported shell %q (want bash, zsh or fish)\n", fs.Arg(0))
+		return 2
+	}
+	fmt.Print(script)
+	return 0
+}
+
+// runComplete implements the hidden __complete command.
+func runComplete(args []string) int {
+	for _, c := range complete(args) {
+		fmt.Println(c)
+	}
+	return 0
+}
+
+// commandFlags returns the flag set of the named command, or of the flat
+// command line when name is empty.
+func commandFlags(name string) *flag.FlagSet {
+	var fs *flag.FlagSet
+	inspectFlags = func(s *flag.FlagSet) { fs = s }
+	defer func() { inspectFlags = nil }()
+
+	g := newGlobalFlags()
+	if cmd := lookupCommand(name); cmd != nil {
+		cmd.run(g, nil)
+	} else {
+		runLegacy(g, nil)
+	}
+	if fs == nil {
+		fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	}
+	return fs
+}
+
+// complete returns the completions for the last of words, the arguments
+// typed so far after the program name.
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	done := words[:len(words)-1]
+
+	// Walk the completed words to find the command, the files named so far
+	// and whether the word being completed is a flag's value.
+	cmdName := ""
+	fs := commandFlags("")
+	var files []string
+	var pending *flag.Flag
+	for _, w := range done {
+		if pending != nil {
+			if pending.Name == "file" || pending.Name == "merge" {
+				files = append(files, w)
+			}
+			pending = nil
+			continue
+		}
+		if strings.HasPrefix(w, "-") && w != "-" {
+			name, value, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+			f := fs.Lookup(name)
+			switch {
+			case f == nil:
+			case hasValue:
+				if name == "file" || name == "merge" {
+					files = append(files, value)
+				}
+			case !isBoolFlag(f):
+				pending = f
+			}
+			continue
+		}
+		if cmdName == "" && lookupCommand(w) != nil {
+			cmdName = w
+			fs = commandFlags(w)
+			continue
+		}
+		files = append(files, w)
+	}
+
+	var candidates []string
+	switch {
+	case pending != nil && cmdName != "sql" && pending.Name == "output":
+		// A file to write, left to the shell.
+	case pending != nil:
+		candidates = valueCandidates(pending.Name, cur, files)
+	case strings.HasPrefix(cur, "-"):
+		fs.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, "-"+f.Name)
+		})
+		if strings.HasPrefix(cur, "--") {
+			for i, c := range candidates {
+				candidates[i] = "-" + c
+			}
+		}
+	case cmdName == "" && len(files) == 0:
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	case cmdName == "profile" && len(files) == 0:
+		candidates = []string{"list", "save", "delete"}
+	case cmdName == "profile" && len(files) == 1 && files[0] == "delete":
+		candidates = savedProfiles()
+	}
+	return withPrefix(candidates, cur)
+}
+
+// valueCandidates returns the completions for the value of the named flag,
+// given the files named on the command line so far.
+func valueCandidates(name, cur string, files []string) []string {
+	if choices, ok := valueCompletions[name]; ok {
+		return choices
+	}
+	if name == "profile" {
+		return savedProfiles()
+	}
+	if !fieldFlags[name] || len(files) == 0 {
+		// Let the shell fall back to completing file names.
+		return nil
+	}
+	fields := sniffFields(files[len(files)-1])
+	if name != "fields" {
+		return fields
+	}
+	// Complete the last element of a comma-separated list, offering only
+	// fields that are not in the list already.
+	i := strings.LastIndexByte(cur, ',')
+	if i < 0 {
+		return fields
+	}
+	listed := make(map[string]bool)
+	for _, f := range strings.Split(cur[:i], ",") {
+		listed[f] = true
+	}
+	var out []string
+	for _, f := range fields {
+		if !listed[f] {
+			out = append(out, cur[:i+1]+f)
+		}
+	}
+	return out
+}
+
+// sniffFields returns the sorted field names found in the first
+// fieldSniffBytes of the file at path, or nil if it cannot be read.
+func sniffFields(path string) []string {
+	f, err := input.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if f, err = input.Decompress(f); err != nil {
+		return nil
+	}
+	r, p, _, err := detectParser(io.LimitReader(f, fieldSniffBytes), "auto", parser.ReadOptions{})
+	if err != nil {
+		return nil
+	}
+	entries, errs := p.Parse(r)
+	go func() {
+		for range errs {
+		}
+	}()
+	seen := make(map[string]bool)
+	for entry := range entries {
+		for _, k := range entry.Keys() {
+			seen[k] = true
+		}
+		parser.Release(entry)
+	}
+	fields := make([]string, 0, len(seen))
+	for k := range seen {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// savedProfiles returns the names of the saved profiles, or nil if the
+// configuration file cannot be read.
+func savedProfiles() []string {
+	c, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+	return profileNames(c)
+}
+
+// isBoolFlag reports whether f is a boolean flag, which takes no separate
+// value argument.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// withPrefix returns the candidates that start with prefix.
+func withPrefix(candidates []string, prefix string) []string {
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
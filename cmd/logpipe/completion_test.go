@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const completionLog = `{"time":"2024-01-15T10:00:00Z","level":"info","msg":"hi","user":"bob"}
+{"level":"error","msg":"boom","code":500}
+`
+
+func TestComplete_CommandNames(t *testing.T) {
+	got := complete([]string{"st"})
+	if !reflect.DeepEqual(got, []string{"stats"}) {
+		t.Errorf("complete(st) = %v, want [stats]", got)
+	}
+}
+
+func TestComplete_EmptyListsAllCommands(t *testing.T) {
+	got := complete(nil)
+	if len(got) != len(commands) {
+		t.Errorf("complete() = %v, want every command", got)
+	}
+}
+
+func TestComplete_LegacyFlags(t *testing.T) {
+	got := complete([]string{"-mer"})
+	if !reflect.DeepEqual(got, []string{"-merge", "-merge-dir"}) {
+		t.Errorf("complete(-mer) = %v, want [-merge -merge-dir]", got)
+	}
+}
+
+func TestComplete_SubcommandFlags(t *testing.T) {
+	got := complete([]string{"follow", "-"})
+	for _, want := range []string{"-from-start", "-poll", "-filter", "-format"} {
+		if !contains(got, want) {
+			t.Errorf("follow flags %v missing %s", got, want)
+		}
+	}
+	if contains(got, "-merge") {
+		t.Errorf("follow flags %v include the legacy -merge flag", got)
+	}
+}
+
+func TestComplete_DoubleDashFlags(t *testing.T) {
+	got := complete([]string{"--pre"})
+	if !reflect.DeepEqual(got, []string{"--pretty"}) {
+		t.Errorf("complete(--pre) = %v, want [--pretty]", got)
+	}
+}
+
+func TestComplete_FormatValues(t *testing.T) {
+	got := complete([]string{"view", "-format", "j"})
+	if !reflect.DeepEqual(got, []string{"json"}) {
+		t.Errorf("complete(-format j) = %v, want [json]", got)
+	}
+}
+
+func TestComplete_GlobalFlagValueBeforeCommand(t *testing.T) {
+	got := complete([]string{"-input", ""})
+	if !reflect.DeepEqual(got, []string{"auto", "json", "gcp", "syslog", "syslog-bsd", "logfmt", "csv", "tsv"}) {
+		t.Errorf("complete(-input) = %v", got)
+	}
+}
+
+func TestComplete_BoolFlagTakesNoValue(t *testing.T) {
+	// After a boolean flag the next word is a command, not the flag's value.
+	got := complete([]string{"-color", "vi"})
+	if !reflect.DeepEqual(got, []string{"view"}) {
+		t.Errorf("complete(-color vi) = %v, want [view]", got)
+	}
+}
+
+func TestComplete_FieldNamesFromFile(t *testing.T) {
+	path := writeLog(t, completionLog)
+	got := complete([]string{"-file", path, "-filter", ""})
+	want := []string{"code", "level", "msg", "time", "user"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("complete(-filter) = %v, want %v", got, want)
+	}
+}
+
+func TestComplete_FieldNamesFromPositionalFile(t *testing.T) {
+	path := writeLog(t, completionLog)
+	got := complete([]string{"stats", path, "-field", "u"})
+	if !reflect.DeepEqual(got, []string{"user"}) {
+		t.Errorf("complete(-field u) = %v, want [user]", got)
+	}
+}
+
+func TestComplete_FieldsList(t *testing.T) {
+	path := writeLog(t, completionLog)
+	got := complete([]string{"-file=" + path, "-fields", "user,"})
+	want := []string{"user,code", "user,level", "user,msg", "user,time"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("complete(-fields user,) = %v, want %v", got, want)
+	}
+}
+
+func TestComplete_FieldNamesWithoutFile(t *testing.T) {
+	if got := complete([]string{"-filter", ""}); len(got) != 0 {
+		t.Errorf("complete(-filter) without a file = %v, want none", got)
+	}
+}
+
+func TestComplete_FileValueFallsBackToShell(t *testing.T) {
+	if got := complete([]string{"-file", "ap"}); len(got) != 0 {
+		t.Errorf("complete(-file ap) = %v, want none", got)
+	}
+}
+
+func TestSniffFields_MissingFile(t *testing.T) {
+	if got := sniffFields("/nonexistent/app.log"); got != nil {
+		t.Errorf("sniffFields = %v, want nil", got)
+	}
+}
+
+func TestCommandFlags_DoesNotRunCommand(t *testing.T) {
+	out := captureStdout(t, func() {
+		for _, c := range commands {
+			if fs := commandFlags(c.name); fs == nil {
+				t.Errorf("commandFlags(%q) = nil", c.name)
+			}
+		}
+	})
+	if out != "" {
+		t.Errorf("inspecting flags wrote output: %q", out)
+	}
+	if inspectFlags != nil {
+		t.Error("inspectFlags left set")
+	}
+}
+
+func TestRunCompletion_Scripts(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var code int
+		out := captureStdout(t, func() { code = run([]string{"completion", shell}) })
+		if code != 0 || !strings.Contains(out, "logpipe __complete") {
+			t.Errorf("completion %s: code %d, script:\n%s", shell, code, out)
+		}
+	}
+}
+
+func TestRunCompletion_UnknownShell(t *testing.T) {
+	if code := run([]string{"completion", "tcsh"}); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestRun_HiddenCompleteCommand(t *testing.T) {
+	out, code := runCapture(t, completeCommand, "me")
+	if code != 0 || out != "merge\n" {
+		t.Errorf("__complete me: code %d, output %q", code, out)
+	}
+}
+
+// contains reports whether list includes s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// dedupeFlags holds the -dedupe, -dedupe-window and -dedupe-key flags,
+// which suppress entries repeating one output before.
+type dedupeFlags struct {
+	fields string
+	window time.Duration
+	key    string
+}
+
+// register defines the dedupe flags on fs.
+func (d *dedupeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&d.fields, "dedupe", "", "Suppress entries whose values of these comma-separated fields, such as msg,level, were already output, within --dedupe-window if it is set, and write how many were suppressed at the end")
+	fs.DurationVar(&d.window, "dedupe-window", 0, "Suppress entries whose --dedupe-key value, or --dedupe fields, were already output within this long, such as 5s, and write how many were suppressed when the window closes")
+	fs.StringVar(&d.key, "dedupe-key", "", "Field compared by --dedupe-window (default: the message, from message, msg or text)")
+}
+
+// flag returns the flag that turns deduplication on, for error messages:
+// "--dedupe", "--dedupe-window", or "" when neither is set.
+func (d dedupeFlags) flag() string {
+	switch {
+	case d.fields != "":
+		return "--dedupe"
+	case d.window > 0:
+		return "--dedupe-window"
+	}
+	return ""
+}
+
+// check reports an error if the flags are invalid or combined with -quiet
+// or -group-by, which output no stream of entries to suppress them from.
+func (d dedupeFlags) check(quiet bool, groupBy string) error {
+	switch {
+	case d.window < 0:
+		return fmt.Errorf("--dedupe-window must not be negative")
+	case d.key != "" && d.window == 0:
+		return fmt.Errorf("--dedupe-key requires --dedupe-window")
+	case d.key != "" && d.fields != "":
+		return fmt.Errorf("--dedupe-key cannot be combined with --dedupe, which names the fields compared")
+	case d.fields != "" && slices.Contains(strings.Split(d.fields, ","), ""):
+		return fmt.Errorf("invalid --dedupe %q: empty field name", d.fields)
+	case d.flag() != "" && quiet:
+		return fmt.Errorf("%s cannot be combined with --quiet", d.flag())
+	case d.flag() != "" && groupBy != "":
+		return fmt.Errorf("%s cannot be combined with --group-by", d.flag())
+	}
+	return nil
+}
+
+// dedupeWindow is the time after an entry is output during which entries
+// with the same key value are suppressed.
+type dedupeWindow struct {
+	key        string // the key fields and their values, as the summary shows them
+	value      string
+	start      time.Time // time of the entry that opened the window
+	last       time.Time // time of the latest entry suppressed
+	suppressed int
+}
+
+// deduper suppresses entries whose key value was output within the last
+// window, or at all when the window is zero, wherever they fall in the
+// stream, so that a retry storm interleaved with other logs is shown once
+// per window. An entry's time is its timestamp, with timestamps lacking a
+// UTC offset taken to be in loc, or the time it was read when it has none.
+type deduper struct {
+	window  time.Duration
+	fields  []string // key fields
+	combine bool     // whether the key is the values of all fields present, rather than of the first
+	loc     *time.Location
+	now     func() time.Time
+
+	open  map[string]*dedupeWindow
+	queue []*dedupeWindow // open windows in the order they were opened
+}
+
+// newDeduper returns a deduper for the flags d, or nil when neither -dedupe
+// nor -dedupe-window is set.
+func newDeduper(d dedupeFlags, loc *time.Location) *deduper {
+	dd := &deduper{window: d.window, fields: messageFields, loc: loc, now: time.Now, open: make(map[string]*dedupeWindow)}
+	switch {
+	case d.fields != "":
+		dd.fields, dd.combine = strings.Split(d.fields, ","), true
+	case d.window == 0:
+		return nil
+	case d.key != "":
+		dd.fields = []string{d.key}
+	}
+	return dd
+}
+
+// run returns a channel of the entries from entries that satisfy match,
+// less those d suppresses. When a window in which entries were suppressed
+// closes, an entry counting them is sent in their place: at the first
+// entry read after the window ends, or at the end of the input. Entries
+// without any key field are never suppressed. The channel is closed once
+// entries is; after ctx is done nothing more is sent, and the rest of
+// entries is drained and released.
+func (d *deduper) run(ctx context.Context, entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool) <-chan *parser.LogEntry {
+	out := make(chan *parser.LogEntry)
+	send := func(entry *parser.LogEntry) bool {
+		select {
+		case out <- entry:
+			return true
+		case <-ctx.Done():
+			parser.Release(entry)
+			return false
+		}
+	}
+	go func() {
+		defer close(out)
+		ok := true
+		for entry := range entries {
+			if !ok || !match(entry) {
+				parser.Release(entry)
+				continue
+			}
+			ok = d.add(entry, send)
+		}
+		if ok {
+			d.flush(send)
+		}
+	}()
+	return out
+}
+
+// add sends entry unless it is suppressed, after the counts of the windows
+// that have closed by its time. It reports false once send does.
+func (d *deduper) add(entry *parser.LogEntry, send func(*parser.LogEntry) bool) bool {
+	key, value, ok := d.key(entry)
+	if !ok {
+		return send(entry)
+	}
+	t := parseTimestampForSort(entry, d.loc)
+	if t.IsZero() {
+		t = d.now()
+	}
+	for len(d.queue) > 0 && d.ended(d.queue[0], t) {
+		w := d.queue[0]
+		d.queue = d.queue[1:]
+		if d.open[w.value] == w {
+			delete(d.open, w.value)
+		}
+		if !d.close(w, send) {
+			parser.Release(entry)
+			return false
+		}
+	}
+	if w := d.open[value]; w != nil {
+		if !d.ended(w, t) {
+			w.suppressed++
+			w.last = t
+			parser.Release(entry)
+			return true
+		}
+		// Entries out of time order can leave an ended window behind
+		// the head of the queue.
+		if !d.close(w, send) {
+			parser.Release(entry)
+			return false
+		}
+	}
+	w := &dedupeWindow{key: key, value: value, start: t}
+	d.open[value] = w
+	d.queue = append(d.queue, w)
+	return send(entry)
+}
+
+// ended reports whether w has ended by t. Without a window, none ever
+// does.
+func (d *deduper) ended(w *dedupeWindow, t time.Time) bool {
+	return d.window > 0 && t.Sub(w.start) >= d.window
+}
+
+// flush sends the counts of the windows still open, at the end of the
+// input.
+func (d *deduper) flush(send func(*parser.LogEntry) bool) {
+	for _, w := range d.queue {
+		if !d.close(w, send) {
+			return
+		}
+	}
+	d.queue = nil
+	clear(d.open)
+}
+
+// close sends the count of the entries w suppressed, if there were any,
+// and resets it. It reports false if send does.
+func (d *deduper) close(w *dedupeWindow, send func(*parser.LogEntry) bool) bool {
+	if w.suppressed == 0 {
+		return true
+	}
+	summary := parser.NewOrderedEntry()
+	summary.Set("time", w.last.Format(time.RFC3339Nano))
+	noun := "duplicates"
+	if w.suppressed == 1 {
+		noun = "duplicate"
+	}
+	msg := fmt.Sprintf("suppressed %d %s of %s", w.suppressed, noun, w.key)
+	if d.window > 0 {
+		msg += " within " + d.window.String()
+	}
+	summary.Set("msg", msg)
+	summary.Set("_suppressed", w.suppressed)
+	w.suppressed = 0
+	return send(summary)
+}
+
+// key returns the key of entry, as field="value" pairs, and the value that
+// identifies it, or false if entry has none of the key fields. Without
+// combine, the value of the first key field present is the identifying
+// value, so that entries with the same message in a msg or message field
+// are duplicates; with it, the pairs of all the key fields present are.
+func (d *deduper) key(entry *parser.LogEntry) (key, value string, ok bool) {
+	var pairs []string
+	for _, f := range d.fields {
+		v, ok := entry.Lookup(f)
+		if !ok {
+			continue
+		}
+		s := fmt.Sprintf("%v", v)
+		if !d.combine {
+			return f + "=" + strconv.Quote(s), s, true
+		}
+		pairs = append(pairs, f+"="+strconv.Quote(s))
+	}
+	if len(pairs) == 0 {
+		return "", "", false
+	}
+	key = strings.Join(pairs, " ")
+	return key, key, true
+}
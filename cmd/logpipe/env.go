@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix is prepended to a flag's name, upper-cased and with dashes
+// turned into underscores, to form the environment variable that supplies
+// the flag's default (LOGPIPE_FORMAT, LOGPIPE_MAX_LINE_SIZE, ...).
+const envPrefix = "LOGPIPE_"
+
+// noEnvFlags are flags that are never taken from the environment.
+var noEnvFlags = map[string]bool{"version": true}
+
+// envName returns the environment variable for the flag called name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag of fs for which skip returns false from its
+// environment variable, when that variable is set. The values become the
+// flags' defaults: they are shown as such by -help, and a flag given on the
+// command line overrides them, except that repeatable flags such as -filter
+// add to them. skip may be nil.
+func applyEnv(fs *flag.FlagSet, skip func(name string) bool) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || noEnvFlags[f.Name] || (skip != nil && skip(f.Name)) {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid %s=%q: %v", envName(f.Name), value, setErr)
+			return
+		}
+		f.DefValue = f.Value.String()
+	})
+	return err
+}
+
+// applyEnv loads the global flags' defaults from the environment.
+func (g *globalFlags) applyEnv() error {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	g.register(fs)
+	return applyEnv(fs, nil)
+}
+
+// parseFlags applies environment defaults to the command-specific flags of
+// fs and then parses args. Global flags are skipped here because run has
+// already loaded them, and they may since have been set on the command line
+// before the subcommand name. Errors are reported on stderr.
+//
+// While inspectFlags is set, parseFlags hands it fs and returns
+// errInspected without parsing anything.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if inspectFlags != nil {
+		inspectFlags(fs)
+		return errInspected
+	}
+	if err := applyEnv(fs, isGlobalFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+	return fs.Parse(args)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"format":        "LOGPIPE_FORMAT",
+		"max-line-size": "LOGPIPE_MAX_LINE_SIZE",
+		"no-index":      "LOGPIPE_NO_INDEX",
+	}
+	for name, want := range tests {
+		if got := envName(name); got != want {
+			t.Errorf("envName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyEnv_SetsDefaults(t *testing.T) {
+	t.Setenv("LOGPIPE_FORMAT", "json")
+	t.Setenv("LOGPIPE_COLOR", "true")
+	t.Setenv("LOGPIPE_MAX_LINE_SIZE", "2K")
+	g := newGlobalFlags()
+	if err := g.applyEnv(); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if g.format != "json" || !g.color.resolve(false) || g.maxLineSize != 2048 {
+		t.Errorf("format=%q color=%v max-line-size=%d", g.format, g.color, g.maxLineSize)
+	}
+}
+
+func TestApplyEnv_InvalidValue(t *testing.T) {
+	t.Setenv("LOGPIPE_COLOR", "maybe")
+	err := newGlobalFlags().applyEnv()
+	if err == nil || !strings.Contains(err.Error(), "LOGPIPE_COLOR") {
+		t.Errorf("applyEnv error = %v, want one naming LOGPIPE_COLOR", err)
+	}
+}
+
+func TestApplyEnv_Skip(t *testing.T) {
+	t.Setenv("LOGPIPE_LIMIT", "5")
+	t.Setenv("LOGPIPE_FORMAT", "json")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	g := newGlobalFlags()
+	g.register(fs)
+	limit := fs.Int("limit", 0, "")
+	if err := applyEnv(fs, isGlobalFlag); err != nil {
+		t.Fatal(err)
+	}
+	if *limit != 5 {
+		t.Errorf("limit = %d, want 5", *limit)
+	}
+	if g.format != "text" {
+		t.Errorf("global flag format = %q, want it left alone", g.format)
+	}
+}
+
+func TestApplyEnv_UpdatesHelpDefault(t *testing.T) {
+	t.Setenv("LOGPIPE_LIMIT", "7")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("limit", 0, "")
+	if err := applyEnv(fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Lookup("limit").DefValue; got != "7" {
+		t.Errorf("DefValue = %q, want 7", got)
+	}
+}
+
+func TestApplyEnv_VersionIgnored(t *testing.T) {
+	t.Setenv("LOGPIPE_VERSION", "true")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	v := fs.Bool("version", false, "")
+	if err := applyEnv(fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if *v {
+		t.Error("-version was taken from the environment")
+	}
+}
+
+func TestRun_EnvDefault_CommandLineOverrides(t *testing.T) {
+	path := writeLog(t, `{"level":"info","msg":"hi"}`+"\n")
+	t.Setenv("LOGPIPE_FORMAT", "logfmt")
+	out, _ := runCapture(t, "-file", path)
+	if out != "level=info msg=hi\n" {
+		t.Errorf("env default: output = %q", out)
+	}
+	out, _ = runCapture(t, "-file", path, "-format", "json")
+	if out != `{"level":"info","msg":"hi"}`+"\n" {
+		t.Errorf("command-line override: output = %q", out)
+	}
+}
+
+func TestRun_EnvDefault_FlagBeforeSubcommandWins(t *testing.T) {
+	path := writeLog(t, `{"level":"info","msg":"hi"}`+"\n")
+	t.Setenv("LOGPIPE_FORMAT", "json")
+	out, _ := runCapture(t, "-format", "logfmt", "view", path)
+	if out != "level=info msg=hi\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_EnvFilterCombinesWithCommandLine(t *testing.T) {
+	path := writeLog(t, "level=error msg=a\nlevel=info msg=b\nlevel=error msg=c\n")
+	t.Setenv("LOGPIPE_FILTER", "level=error")
+	out, _ := runCapture(t, "view", "-format", "logfmt", "-filter", "msg=c", path)
+	if out != "level=error msg=c\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRun_EnvInvalidValue(t *testing.T) {
+	t.Setenv("LOGPIPE_PRETTY", "sometimes")
+	if _, code := runCapture(t, "-version"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
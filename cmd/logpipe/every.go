@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// sampler implements -every: it keeps the first matching entry and every
+// nth one after it, counting either all matching entries together or,
+// with -every-key, those with each value of a field separately. Unlike
+// random sampling, the same input always gives the same entries.
+type sampler struct {
+	n     int
+	key   string         // "" to count all entries together
+	seen  map[string]int // matching entries so far, by key value
+	total int            // matching entries so far, without a key
+}
+
+// newSampler returns the sampler keeping every nth entry, per value of
+// the field key when it is not "". It returns nil when n is 0.
+func newSampler(n int, key string) (*sampler, error) {
+	switch {
+	case n < 0:
+		return nil, fmt.Errorf("--every must not be negative")
+	case n == 0 && key != "":
+		return nil, fmt.Errorf("--every-key requires --every")
+	case n == 0:
+		return nil, nil
+	}
+	s := &sampler{n: n, key: key}
+	if key != "" {
+		s.seen = make(map[string]int)
+	}
+	return s, nil
+}
+
+// keep reports whether entry, which matched, is one to keep.
+func (s *sampler) keep(entry *parser.LogEntry) bool {
+	if s.key == "" {
+		s.total++
+		return (s.total-1)%s.n == 0
+	}
+	// Entries without the field are counted together, as if it were "".
+	value := ""
+	if v, ok := entry.Fields[s.key]; ok && v != nil {
+		value = fmt.Sprintf("%v", v)
+	}
+	s.seen[value]++
+	return (s.seen[value]-1)%s.n == 0
+}
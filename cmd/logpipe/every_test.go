@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// sampler
+// =============================================================================
+
+func TestNewSampler(t *testing.T) {
+	if s, err := newSampler(0, ""); s != nil || err != nil {
+		t.Errorf("newSampler(0) = %v, %v; want nil, nil", s, err)
+	}
+	for _, tt := range []struct {
+		n   int
+		key string
+	}{{-1, ""}, {0, "service"}} {
+		if _, err := newSampler(tt.n, tt.key); err == nil {
+			t.Errorf("newSampler(%d, %q): expected error", tt.n, tt.key)
+		}
+	}
+}
+
+func TestSampler_AfterMatch(t *testing.T) {
+	s, _ := newSampler(3, "")
+	cfg := &pipelineConfig{match: func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }, accept: []stage{s.keep}}
+	match := cfg.process
+	var kept []int
+	for i := range 10 {
+		// Every other entry matches, so the sampler sees entries 0, 2, 4...
+		level := "error"
+		if i%2 == 1 {
+			level = "info"
+		}
+		if match(parser.NewEntry(map[string]any{"level": level})) {
+			kept = append(kept, i)
+		}
+	}
+	if fmt.Sprint(kept) != "[0 6]" {
+		t.Errorf("kept entries %v, want [0 6]", kept)
+	}
+}
+
+func TestSampler_Key(t *testing.T) {
+	s, _ := newSampler(2, "service")
+	var kept []string
+	for i, svc := range []any{"api", "api", "worker", "api", nil, "worker", nil, "worker"} {
+		e := parser.NewEntry(map[string]any{"n": i})
+		if svc != nil {
+			e.Fields["service"] = svc
+		}
+		if s.keep(e) {
+			kept = append(kept, fmt.Sprint(i))
+		}
+	}
+	if got := strings.Join(kept, ","); got != "0,2,3,4,7" {
+		t.Errorf("kept entries %s, want 0,2,3,4,7", got)
+	}
+}
+
+// =============================================================================
+// -every
+// =============================================================================
+
+func TestRun_Every(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-every", "2", path)
+	want := "time=2024-01-15T10:00:02Z level=error msg=b\ntime=2024-01-15T10:00:03Z level=error msg=c\n"
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) =\n%s", code, out)
+	}
+	out, _ = runCapture(t, "stats", "-field", "level", "-every", "2", "-every-key", "level", path)
+	if out != "error: 1\ninfo: 1\n" {
+		t.Errorf("stats output =\n%s", out)
+	}
+	if _, code := runCapture(t, "view", "-every-key", "level", path); code != 1 {
+		t.Errorf("-every-key alone: exit code = %d, want 1", code)
+	}
+}
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/filter"
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/internal/forward"
+	"github.com/tylermac92/logpipe/internal/index"
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/internal/logstream"
+	"github.com/tylermac92/logpipe/internal/plugin"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// explainFlag defines -explain on fs.
+func explainFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("explain", false, "Print the pipeline the other flags describe and exit without reading any entries")
+}
+
+// plan describes a view, stats or merge run for -explain.
+type plan struct {
+	inputFormat string    // -input: a format name or "auto"
+	paths       []string  // input files; none means stdin
+	listen      listenURL // -listen: where events are received
+	merge       bool      // entries of paths are interleaved by timestamp
+	useIndex    bool      // sidecar indexes may be used
+	statsField  string    // set when a frequency table is printed instead of entries
+	groupBy     string    // -group-by: field the entries are grouped by
+	slowest     slowestFlags
+	quiet       bool // -quiet: only the exit status reports a match
+	follow      bool // -follow: the file is read on as it grows
+	win         window
+}
+
+// operatorNames describes each filter operator for -explain.
+var operatorNames = map[string]string{
+	"=":  "equals",
+	"!=": "does not equal",
+	"~":  "matches the regular expression",
+	"*=": "contains, ignoring case",
+	">":  "sorts after",
+	"<":  "sorts before",
+	">=": "sorts at or after",
+	"<=": "sorts at or before",
+}
+
+// instantNames describes the operators of a filter that compares
+// timestamps for -explain.
+var instantNames = map[string]string{
+	">":  "later than",
+	"<":  "earlier than",
+	">=": "at or after",
+	"<=": "at or before",
+}
+
+// durationNames describes the operators of a filter that compares
+// durations for -explain.
+var durationNames = map[string]string{
+	">":  "longer than",
+	"<":  "shorter than",
+	">=": "at least",
+	"<=": "at most",
+}
+
+// explain writes to w a description of what running p with cfg would do:
+// the inputs and their formats, the parser's options, the filters, and how
+// matching entries are output. Input files are only opened to detect their
+// format and to check their indexes.
+func explain(w io.Writer, cfg *pipelineConfig, p plan) {
+	row := func(label, value string) {
+		if label != "" {
+			label += ":"
+		}
+		fmt.Fprintf(w, "%-10s %s\n", label, value)
+	}
+
+	parsePlugin := cfg.plugins.parser()
+	if p.listen.scheme == "grpc" {
+		row("Input", "gRPC on "+p.listen.addr)
+		row("Format", "records pushed to "+logstream.PushPath)
+	} else if network, ok := strings.CutPrefix(p.listen.scheme, "gelf+"); ok {
+		row("Input", "GELF over "+strings.ToUpper(network)+" on "+p.listen.addr)
+		row("Format", "GELF messages; chunked and compressed ones over UDP")
+	} else if p.listen.addr != "" {
+		row("Input", "forward protocol on "+p.listen.addr)
+		row("Format", "Fluentd events, tagged with "+forward.TagField)
+	} else if len(p.paths) == 0 {
+		row("Input", "stdin")
+		if parsePlugin != nil {
+			row("Format", "plugin "+parsePlugin.Name())
+		} else {
+			row("Format", explainFormat(p.inputFormat, ""))
+		}
+	}
+	for _, path := range p.paths {
+		compression := fileCompression(path)
+		if compression != "" {
+			row("Input", path+" ("+compression+"-compressed)")
+		} else {
+			row("Input", path)
+		}
+		indexDesc, indexFormat := "not used (-no-index)", ""
+		switch {
+		case parsePlugin != nil:
+			indexDesc = "not used with a parser plugin"
+		case p.merge:
+			indexDesc = "not used when merging"
+		case p.follow:
+			indexDesc = "not used with -follow"
+		case p.useIndex && compression != "":
+			indexDesc = "not used with a compressed file"
+		case p.useIndex && cfg.readOpts.Positions:
+			indexDesc = "not used with -line-numbers"
+		case p.useIndex && cfg.levels != nil:
+			indexDesc = "not used with -level-map"
+		case p.useIndex && cfg.plugins.transformsEntries():
+			indexDesc = "not used with a transform plugin"
+		case p.useIndex && cfg.multiline():
+			indexDesc = "not used with -multiline-start or -multiline-cont"
+		case p.useIndex && cfg.readsHeader(p.inputFormat):
+			indexDesc = "not used with a header row; give -csv-columns instead"
+		case p.useIndex && cfg.strict:
+			indexDesc = "not used with -strict"
+		case p.useIndex:
+			indexDesc, indexFormat = explainIndex(path, cfg.filters)
+		}
+		if parsePlugin != nil {
+			row("Format", "plugin "+parsePlugin.Name())
+		} else if indexFormat != "" && p.inputFormat == "auto" {
+			row("Format", indexFormat+" (recorded in the index)")
+		} else {
+			row("Format", explainFormat(p.inputFormat, path))
+		}
+		row("Index", indexDesc)
+	}
+
+	opts := cfg.readOpts
+	limit := opts.MaxLineSize
+	if limit == 0 {
+		limit = parser.DefaultMaxLineSize
+	}
+	malformed := opts.OnError.String()
+	if opts.KeepRaw {
+		malformed += ", also kept as _raw entries"
+	}
+	if opts.StrictLogfmt {
+		malformed += ", including logfmt lines that are not well formed"
+	}
+	parse := fmt.Sprintf("lines up to %d bytes; longer lines: %s; malformed lines: %s; repeated logfmt keys: %s; JSON numbers: %s", limit, opts.Oversize, malformed, opts.Duplicates, opts.Numbers)
+	if opts.Positions {
+		parse += "; line numbers and offsets recorded as _line and _offset"
+	}
+	if cfg.multiline() {
+		row("Lines", explainMultiline(opts.MultilineStart, opts.MultilineCont))
+	}
+	switch {
+	case len(cfg.columns) > 0:
+		row("Columns", strings.Join(cfg.columns, ", "))
+	case cfg.readsHeader(p.inputFormat):
+		row("Columns", "named by the first row")
+	}
+	row("Parser", parse)
+	if cfg.strict {
+		strict := "the run fails if any line cannot be parsed or repeats a logfmt key"
+		if cfg.validator != nil {
+			strict += ", or if any entry fails validation"
+		}
+		row("Strict", strict)
+	}
+
+	if cfg.plugins != nil {
+		for _, t := range cfg.plugins.transforms {
+			row("Transform", "plugin "+t.Name())
+		}
+	}
+	if lm := cfg.levels; lm != nil {
+		aliases := make([]string, len(lm.aliases))
+		for i, a := range lm.aliases {
+			aliases[i] = a.from + " as " + a.to
+		}
+		row("Levels", strings.Join(aliases, ", "))
+	}
+	if len(cfg.filters) == 0 {
+		row("Filter", "none; every entry matches")
+	}
+	for _, f := range cfg.filters {
+		row("Filter", explainFilter(f))
+	}
+	if len(cfg.filters) > 0 {
+		compared := "values are compared as text"
+		var negated, absent, durations bool
+		for _, f := range cfg.filters {
+			walkFilter(f, func(f filter.Filter) {
+				switch f := f.(type) {
+				case *filter.FieldFilter:
+					if _, timed := f.Time(); timed {
+						compared = fmt.Sprintf("values are compared as text, timestamps as instants (those without a UTC offset in %s)", cfg.location)
+					}
+					if _, durational := f.Duration(); durational {
+						durations = true
+					}
+					absent = absent || f.Operator == "!"
+				case *filter.NotFilter:
+					negated = true
+				}
+			})
+		}
+		missing := "entries without a filtered field never match"
+		switch {
+		case negated && absent:
+			missing = "entries without a filtered field never match it, unless it is negated or tested for absence"
+		case negated:
+			missing = "entries without a filtered field never match it, unless it is negated"
+		case absent:
+			missing = "entries without a filtered field never match it, unless it is tested for absence"
+		}
+		if durations {
+			compared += ", durations by length (plain numbers as seconds)"
+		}
+		row("", missing+"; "+compared)
+	}
+	if j := cfg.jq; j != nil {
+		row("jq", j.src+"; of its first output, true keeps a matching entry, false, null or none drops it, and an object replaces its fields")
+	}
+	if v := cfg.validator; v != nil {
+		row("Validate", fmt.Sprintf("matching entries against the JSON Schema %s; invalid entries are %s", v.path, explainInvalid(v.policy)))
+	}
+	if s := cfg.sampler; s != nil {
+		of := "matching entries"
+		if s.key != "" {
+			of = "matching entries with each value of " + s.key
+		}
+		row("Sample", fmt.Sprintf("1 in every %d %s is kept, starting with the first", s.n, of))
+	}
+	if cfg.flatten {
+		row("Flatten", "nested objects of matching entries replaced by their members under dotted names, such as meta.host")
+	}
+	if a := cfg.anonymizer; a != nil {
+		key := "a random key for this run"
+		if a.saltPath != "" {
+			key = "the salt in " + a.saltPath
+		}
+		row("Anonymize", fmt.Sprintf("%s of matching entries replaced with pseudonyms keyed with %s", strings.Join(a.fields, ", "), key))
+	}
+	if d := cfg.dedupe; d != nil {
+		key := strings.Join(d.fields, ", ") + " repeats that"
+		if d.combine && len(d.fields) > 1 {
+			key = strings.Join(d.fields, ", ") + " repeat those"
+		}
+		if d.window > 0 {
+			row("Dedupe", fmt.Sprintf("entries whose %s of an entry output within the last %s are suppressed; a count replaces them when the window closes", key, d.window))
+		} else {
+			row("Dedupe", fmt.Sprintf("entries whose %s of an entry output before are suppressed; counts of them follow at the end of the input", key))
+		}
+	}
+	if r := cfg.replay; r != nil {
+		pace := "at the recorded pace"
+		if r.speed != 1 {
+			pace = "at " + strconv.FormatFloat(r.speed, 'g', -1, 64) + "x the recorded pace"
+		}
+		row("Replay", "matching entries are written with the gaps between their timestamps, "+pace)
+	}
+
+	switch {
+	case p.quiet:
+		row("Mode", "quiet: exit 0 at the first matching entry, 1 if none match")
+	case p.statsField != "":
+		mode := fmt.Sprintf("frequency table of %q over the matching entries", p.statsField)
+		if p.statsField == topFrameField {
+			mode = "frequency table of the frames stack traces were raised in, over the matching entries"
+		}
+		if len(cfg.compare) > 0 {
+			exprs := make([]string, len(cfg.compare))
+			for i, c := range cfg.compare {
+				exprs[i] = c.expr
+			}
+			mode += ", with a column of counts for each of " + strings.Join(exprs, "; ")
+		}
+		switch {
+		case cfg.statsTemplate != nil:
+			mode += ", rendered with the template in " + cfg.statsTemplate.Name()
+		case cfg.statsFormat == "table":
+			if len(cfg.compare) == 0 {
+				mode += ", as a table with percentages and bars"
+			}
+		case cfg.statsFormat == "json":
+			mode += ", as one JSON object per row"
+		case cfg.statsFormat == "csv":
+			mode += ", as CSV"
+		}
+		row("Mode", mode)
+	default:
+		mode := "every matching entry"
+		if p.slowest.n > 0 {
+			mode = fmt.Sprintf("the %d matching entries with the largest %q, largest first, once the input has been read; entries without a numeric %[2]q are skipped", p.slowest.n, p.slowest.by)
+		} else if p.win.head > 0 {
+			mode = fmt.Sprintf("the first %d matching entries, then stop reading", p.win.head)
+		} else if p.win.tail > 0 {
+			mode = fmt.Sprintf("the last %d matching entries", p.win.tail)
+			if len(p.paths) == 1 && !p.merge && p.groupBy == "" && cfg.readsBackward() && !cfg.readsHeader(p.inputFormat) && fileCompression(p.paths[0]) == "" {
+				mode += ", read backwards from the end of the file"
+			}
+		}
+		if p.merge {
+			mode += ", merged by timestamp"
+		}
+		if p.groupBy != "" {
+			mode += fmt.Sprintf(", grouped by %q, groups ordered by their earliest timestamp", p.groupBy)
+		}
+		if p.follow {
+			mode += ", then those appended to the file as it is written, until interrupted"
+		}
+		row("Mode", mode)
+		row("Formatter", explainFormatter(cfg.formatter))
+	}
+	if sp, ok := cfg.output.(*splitFormatter); ok && !p.quiet {
+		out := "a file in " + sp.dir + " for each value of " + sp.field + ", named after it, and " + splitMissing + ".log for entries without one"
+		if sp.appending {
+			out += ", appended to"
+		}
+		row("Output", out)
+	} else if !p.quiet {
+		row("Output", explainOutput(cfg.file))
+	}
+}
+
+// explainOutput describes where the -output file o, if any, has output
+// written.
+func explainOutput(o *outputFile) string {
+	switch {
+	case o == nil:
+		return "stdout"
+	case o.appending:
+		return o.path + ", appended to"
+	case o.atomic:
+		return o.path + ", replaced by a temporary file written beside it once the run has succeeded"
+	}
+	return o.path + ", replaced"
+}
+
+// explainMultiline describes how the -multiline-start and -multiline-cont
+// patterns start and cont group input lines into entries.
+func explainMultiline(start, cont *regexp.Regexp) string {
+	switch {
+	case cont == nil:
+		return fmt.Sprintf("an entry starts at each line matching %s; other lines continue it", start)
+	case start == nil:
+		return fmt.Sprintf("lines matching %s continue the entry before them; other lines start one", cont)
+	}
+	return fmt.Sprintf("an entry starts at each line matching %s and continues with the lines matching %s; other lines stand alone", start, cont)
+}
+
+// explainFormat describes the input format of the file at path (stdin when
+// path is empty) for the -input value inputFormat.
+func explainFormat(inputFormat, path string) string {
+	switch {
+	case inputFormat != "auto":
+		return inputFormat
+	case path == "":
+		return "auto: detected from the first non-empty line"
+	}
+	detected, err := sniffFile(path)
+	if err != nil {
+		return fmt.Sprintf("auto: cannot detect (%v)", err)
+	}
+	return detected + " (detected)"
+}
+
+// fileCompression returns the compression of the file at path, as named by
+// input.Compression, or "" when it is not compressed or cannot be read.
+func fileCompression(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(f, head)
+	return input.Compression(head[:n])
+}
+
+// explainIndex describes whether the sidecar index of the file at path would
+// be used with filters, mirroring indexedReader without its notes. It also
+// returns the input format recorded in a usable index.
+func explainIndex(path string, filters []filter.Filter) (desc, format string) {
+	ixPath := index.Path(path)
+	ix, err := index.Load(ixPath)
+	switch {
+	case os.IsNotExist(err):
+		return "none", ""
+	case err != nil:
+		return fmt.Sprintf("%s cannot be used: %v", ixPath, err), ""
+	case len(filters) == 0:
+		return fmt.Sprintf("%s not used without filters", ixPath), ""
+	}
+	info, err := os.Stat(path)
+	if err != nil || !ix.Fresh(info) {
+		return fmt.Sprintf("%s is stale; the whole file is read", ixPath), ""
+	}
+	blocks := ix.Candidates(indexPredicates(filters))
+	return fmt.Sprintf("%s: %d of %d blocks may match", ixPath, len(blocks), len(ix.Blocks)), ix.Format
+}
+
+// explainFilter describes a compiled filter, e.g. `level = "error" (equals)`.
+func explainFilter(f filter.Filter) string {
+	// Operands are parenthesized as their String forms are.
+	grouped := func(f filter.Filter, parens bool) string {
+		if parens {
+			return "(" + explainFilter(f) + ")"
+		}
+		return explainFilter(f)
+	}
+	switch f := f.(type) {
+	case *minLevel:
+		return fmt.Sprintf("level, lvl or severity at least %s (%s and their aliases)", canonicalLevels[f.rank], strings.Join(canonicalLevels[f.rank:], ", "))
+	case *timeRange:
+		var bounds []string
+		if !f.since.IsZero() {
+			bounds = append(bounds, "at or after "+f.since.UTC().Format(time.RFC3339Nano))
+		}
+		if !f.until.IsZero() {
+			bounds = append(bounds, "before "+f.until.UTC().Format(time.RFC3339Nano))
+		}
+		return "time, ts or timestamp " + strings.Join(bounds, " and ") + " (compared as instants)"
+	case *filter.CompositeFilter:
+		if len(f.Filters()) == 0 {
+			return f.String()
+		}
+		parts := make([]string, len(f.Filters()))
+		for i, child := range f.Filters() {
+			_, or := child.(*filter.OrFilter)
+			parts[i] = grouped(child, or)
+		}
+		return strings.Join(parts, " AND ")
+	case *filter.OrFilter:
+		parts := make([]string, len(f.Filters()))
+		for i, child := range f.Filters() {
+			parts[i] = explainFilter(child)
+		}
+		return strings.Join(parts, " OR ")
+	case *filter.NotFilter:
+		switch f.Filter().(type) {
+		case *filter.OrFilter, *filter.CompositeFilter:
+			return "NOT " + grouped(f.Filter(), true)
+		}
+		return "NOT " + explainFilter(f.Filter())
+	}
+	ff, ok := f.(*filter.FieldFilter)
+	if !ok {
+		if s, ok := f.(fmt.Stringer); ok {
+			return s.String()
+		}
+		return fmt.Sprintf("%T", f)
+	}
+	switch ff.Operator {
+	case "?":
+		return fmt.Sprintf("%s (is present)", ff)
+	case "!":
+		return fmt.Sprintf("%s (is absent)", ff)
+	}
+	if network, ok := ff.Network(); ok {
+		if ff.Operator == "!=" {
+			return fmt.Sprintf("%s %s %q (is an IP address outside %s)", ff.Field, ff.Operator, ff.Value, network)
+		}
+		return fmt.Sprintf("%s %s %q (is an IP address inside %s)", ff.Field, ff.Operator, ff.Value, network)
+	}
+	value := fmt.Sprintf("%q", ff.Value)
+	if ff.Operator == "~" {
+		value = "/" + ff.Value + "/"
+	}
+	if at, ok := ff.Time(); ok {
+		return fmt.Sprintf("%s %s %s (%s %s)", ff.Field, ff.Operator, value, instantNames[ff.Operator], at.UTC().Format(time.RFC3339Nano))
+	}
+	if d, ok := ff.Duration(); ok {
+		return fmt.Sprintf("%s %s %s (lasts %s %s)", ff.Field, ff.Operator, value, durationNames[ff.Operator], d)
+	}
+	return fmt.Sprintf("%s %s %s (%s)", ff.Field, ff.Operator, value, operatorNames[ff.Operator])
+}
+
+// walkFilter calls fn for f and, when it combines others, for each of
+// them in turn.
+func walkFilter(f filter.Filter, fn func(filter.Filter)) {
+	fn(f)
+	switch f := f.(type) {
+	case *filter.CompositeFilter:
+		for _, child := range f.Filters() {
+			walkFilter(child, fn)
+		}
+	case *filter.OrFilter:
+		for _, child := range f.Filters() {
+			walkFilter(child, fn)
+		}
+	case *filter.NotFilter:
+		walkFilter(f.Filter(), fn)
+	}
+}
+
+// explainFormatter describes f and its options.
+func explainFormatter(f formatter.Formatter) string {
+	switch f := f.(type) {
+	case *formatter.TextFormatter:
+		fields := "all fields"
+		if len(f.Fields) > 0 {
+			fields = "fields " + strings.Join(f.Fields, ",")
+		}
+		color := "no color"
+		if f.Color {
+			color = "color"
+		}
+		desc := fmt.Sprintf("text, %s, %s", fields, color)
+		if f.ColorLines {
+			desc += ", lines colored by level"
+		}
+		if f.Sanitize {
+			desc += ", control characters escaped"
+		}
+		switch f.Icons {
+		case formatter.IconsBeside:
+			desc += ", level icons"
+		case formatter.IconsOnly:
+			desc += ", level icons instead of levels"
+		}
+		if f.FoldStacks > 0 {
+			desc += fmt.Sprintf(", stack traces folded to %d frames", f.FoldStacks)
+		}
+		if f.Align {
+			desc += ", aligned in columns"
+		}
+		if f.TimeLayout != "" || f.Location != nil {
+			layout, zone := f.TimeLayout, "UTC"
+			if layout == "" {
+				layout = "15:04:05"
+			}
+			if f.Location != nil {
+				zone = f.Location.String()
+			}
+			desc += fmt.Sprintf(", times as %s in %s", layout, zone)
+		}
+		if f.MaxValue > 0 {
+			desc += fmt.Sprintf(", values cut to %d characters", f.MaxValue)
+		}
+		if len(f.Limits) > 0 {
+			limits := make([]string, 0, len(f.Limits))
+			for _, k := range slices.Sorted(maps.Keys(f.Limits)) {
+				if n := f.Limits[k]; n > 0 {
+					limits = append(limits, fmt.Sprintf("%s to %d", k, n))
+				} else {
+					limits = append(limits, k+" uncut")
+				}
+			}
+			desc += ", " + strings.Join(limits, ", ")
+		}
+		if f.Width > 0 {
+			fit := "truncated"
+			if f.Wrap {
+				fit = "wrapped"
+			}
+			desc += fmt.Sprintf(", lines %s to %d columns", fit, f.Width)
+		}
+		return desc
+	case *formatter.JSONFormatter:
+		desc := "json, one object per line"
+		if f.Pretty {
+			desc = "json, indented"
+		}
+		switch {
+		case f.KeyOrder == nil:
+			return desc
+		case len(f.KeyOrder) == 0:
+			return desc + ", members in alphabetical order"
+		}
+		return desc + ", members in the order " + strings.Join(f.KeyOrder, ", ") + ", then alphabetical"
+	case *formatter.LogfmtFormatter:
+		return "logfmt"
+	case *formatter.TableFormatter:
+		columns := "columns time, level, message"
+		if len(f.Fields) > 0 {
+			columns = "columns " + strings.Join(f.Fields, ",")
+		}
+		desc := "table, " + columns
+		if f.Color {
+			desc += ", bold header"
+		}
+		if f.Sanitize {
+			desc += ", control characters escaped"
+		}
+		return desc
+	case *formatter.TemplateFormatter:
+		return "template " + strconv.Quote(f.Text())
+	case *formatter.ValueFormatter:
+		if len(f.Fields) == 1 {
+			return "raw values of " + f.Fields[0]
+		}
+		return "raw values of " + strings.Join(f.Fields, ", ") + ", tab-separated"
+	case *plugin.Formatter:
+		return "plugin " + f.Plugin.Name()
+	case *avroFormatter:
+		if f.schemaPath == "" {
+			return "avro, written to " + f.path + " with a schema inferred from every entry, which are held until the end"
+		}
+		return "avro, written to " + f.path + " with the schema in " + f.schemaPath
+	case *parquetFormatter:
+		return "parquet, written to " + f.path + " with a schema inferred from every entry, which are held until the end"
+	case *lokiFormatter:
+		desc := fmt.Sprintf("loki, pushed to %s in batches of %d", f.url, f.batch)
+		if len(f.labels) > 0 {
+			labels := make([]string, len(f.labels))
+			for i, l := range f.labels {
+				labels[i] = l.name
+				if l.field == "" {
+					labels[i] += "=" + strconv.Quote(l.value)
+				} else if l.name != l.field {
+					labels[i] += " (from " + l.field + ")"
+				}
+			}
+			desc += " with labels " + strings.Join(labels, ", ")
+		} else {
+			desc += ` with the label job="logpipe"`
+		}
+		if f.tenant != "" {
+			desc += " as tenant " + f.tenant
+		}
+		return desc
+	case *syslogFormatter:
+		return fmt.Sprintf("syslog, sent to %s://%s as facility %s", f.scheme, f.addr, syslogFacilities[f.facility])
+	case *rebasedFormatter:
+		return explainFormatter(f.f) + ", timestamps rewritten as offsets from the first entry's"
+	case *relativeFormatter:
+		if f.display == timeRelative {
+			return explainFormatter(f.f) + ", timestamps shown as how long before now they were"
+		}
+		return explainFormatter(f.f) + ", timestamps shown as offsets from the first entry's"
+	case *gapFormatter:
+		return explainFormatter(f.f) + ", gaps longer than " + f.min.String() + " marked"
+	case *splitFormatter:
+		return explainFormatter(f.f)
+	case *sourceFormatter:
+		return explainFormatter(f.f) + ", a separator where the source file changes"
+	default:
+		return fmt.Sprintf("%T", f)
+	}
+}
+
+// explainInvalid describes what happens to entries that fail validation
+// under policy.
+func explainInvalid(policy invalidPolicy) string {
+	switch policy {
+	case invalidDrop:
+		return "reported and dropped"
+	case invalidOnly:
+		return "reported and the only entries kept"
+	default:
+		return "reported and kept"
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/filter"
+	"github.com/tylermac92/logpipe/formatter"
+)
+
+// =============================================================================
+// -explain
+// =============================================================================
+
+func TestExplain_View(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-explain", "-filter", "level=error", "-head", "2", "-format", "json", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	for _, want := range []string{
+		"Input:     " + path + "\n",
+		"Format:    json (detected)\n",
+		"Index:     none\n",
+		"Filter:    level = \"error\" (equals)\n",
+		"Mode:      the first 2 matching entries, then stop reading\n",
+		"Formatter: json, one object per line\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `"msg"`) {
+		t.Errorf("-explain printed entries:\n%s", out)
+	}
+}
+
+func TestExplain_OrNotFilter(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-query", "level=error or not msg~^health", path)
+	for _, want := range []string{
+		"Filter:    level = \"error\" (equals) OR NOT msg ~ /^health/ (matches the regular expression)\n",
+		"           entries without a filtered field never match it, unless it is negated; values are compared as text\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_PresenceFilter(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-filter", "trace_id?", "-filter", "!user", path)
+	for _, want := range []string{
+		"Filter:    trace_id? (is present)\n",
+		"Filter:    !user (is absent)\n",
+		"           entries without a filtered field never match it, unless it is tested for absence; values are compared as text\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_ContainsFilter(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-filter", "msg*=Timeout", path)
+	if want := "Filter:    msg *= \"Timeout\" (contains, ignoring case)\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_NetworkFilter(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-filter", "client_ip=cidr:10.1.0.0/8", path)
+	if want := "Filter:    client_ip = \"cidr:10.1.0.0/8\" (is an IP address inside 10.0.0.0/8)\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_DurationFilter(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-filter", "latency>=1m30s", path)
+	for _, want := range []string{
+		"Filter:    latency >= \"1m30s\" (lasts at least 1m30s)\n",
+		"; values are compared as text, durations by length (plain numbers as seconds)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_JQ(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-jq", `select(.level == "error") | {msg}`, path)
+	if want := "jq:        select(.level == \"error\") | {msg}; of its first output, true keeps a matching entry, false, null or none drops it, and an object replaces its fields\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Query(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-query", "(level=error or level=warn) and not service=cron", path)
+	if want := "Filter:    (level = \"error\" (equals) OR level = \"warn\" (equals)) AND NOT service = \"cron\" (equals)\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_SinceUntil(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-since", "2024-01-15T10:00:00+01:00", "-until", "2024-01-16", path)
+	if want := "Filter:    time, ts or timestamp at or after 2024-01-15T09:00:00Z and before 2024-01-16T00:00:00Z (compared as instants)\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_MinLevel(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-min-level", "warning", path)
+	if want := "Filter:    level, lvl or severity at least warn (warn, error, fatal and their aliases)\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Listen(t *testing.T) {
+	out, code := runCapture(t, "view", "-explain", "-listen", "forward://0.0.0.0:24224")
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	for _, want := range []string{
+		"Input:     forward protocol on 0.0.0.0:24224\n",
+		"Format:    Fluentd events, tagged with _tag\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_ListenGRPC(t *testing.T) {
+	out, code := runCapture(t, "view", "-explain", "-listen", "grpc://0.0.0.0:50051")
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	for _, want := range []string{
+		"Input:     gRPC on 0.0.0.0:50051\n",
+		"Format:    records pushed to /logpipe.v1.LogStream/Push\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_ListenGELF(t *testing.T) {
+	out, code := runCapture(t, "view", "-explain", "-listen", "gelf+udp://0.0.0.0:12201")
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	for _, want := range []string{
+		"Input:     GELF over UDP on 0.0.0.0:12201\n",
+		"Format:    GELF messages; chunked and compressed ones over UDP\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_GroupBy(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-group-by", "trace_id", path)
+	if want := "Mode:      every matching entry, grouped by \"trace_id\", groups ordered by their earliest timestamp\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Dedupe(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-dedupe-window", "5s", "-dedupe-key", "err", path)
+	if want := "Dedupe:    entries whose err repeats that of an entry output within the last 5s are suppressed; a count replaces them when the window closes\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_DedupeFields(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-dedupe", "msg,level", path)
+	if want := "Dedupe:    entries whose msg, level repeat those of an entry output before are suppressed; counts of them follow at the end of the input\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Slowest(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-slowest", "20", "-by", "duration_ms", path)
+	if want := "Mode:      the 20 matching entries with the largest \"duration_ms\", largest first"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Replay(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-replay", "-speed", "10x", path)
+	if want := "Replay:    matching entries are written with the gaps between their timestamps, at 10x the recorded pace\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_StatsCompare(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "stats", "-explain", "-field", "level", "-compare", "service=api", "-compare", "service=worker", path)
+	if want := "Mode:      frequency table of \"level\" over the matching entries, with a column of counts for each of service=api; service=worker\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_StatsFormat(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "stats", "-explain", "-field", "level", "-stats-format", "table", path)
+	if want := "Mode:      frequency table of \"level\" over the matching entries, as a table with percentages and bars\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_StatsTemplate(t *testing.T) {
+	path := writeLog(t, cliLog)
+	tmplPath := filepath.Join(t.TempDir(), "wiki.tmpl")
+	os.WriteFile(tmplPath, []byte("{{.Total}}"), 0o644)
+	out, _ := runCapture(t, "stats", "-explain", "-field", "level", "-stats-template", tmplPath, path)
+	if want := "over the matching entries, rendered with the template in " + tmplPath + "\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_UsesIndex(t *testing.T) {
+	path := writeLog(t, cliLog)
+	if _, code := runCapture(t, "index", path); code != 0 {
+		t.Fatalf("index: exit code = %d", code)
+	}
+	out, _ := runCapture(t, "-explain", "-file", path, "-filter", "level=warn")
+	if !strings.Contains(out, "Format:    json (recorded in the index)\n") || !strings.Contains(out, ": 0 of 1 blocks may match\n") {
+		t.Errorf("output:\n%s", out)
+	}
+	out, _ = runCapture(t, "view", "-explain", "-no-index", "-filter", "level=warn", path)
+	if !strings.Contains(out, "Index:     not used (-no-index)\n") {
+		t.Errorf("output with -no-index:\n%s", out)
+	}
+}
+
+func TestExplain_MergeAndStats(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "merge", "-explain", "-input", "json", path, path)
+	if strings.Count(out, "Input:") != 2 || !strings.Contains(out, "merged by timestamp") || !strings.Contains(out, "Format:    json\n") {
+		t.Errorf("merge output:\n%s", out)
+	}
+	out, _ = runCapture(t, "stats", "-explain", "-field", "level", path)
+	if !strings.Contains(out, `Mode:      frequency table of "level"`) || strings.Contains(out, "Formatter:") {
+		t.Errorf("stats output:\n%s", out)
+	}
+}
+
+func TestExplain_Validate(t *testing.T) {
+	path := writeLog(t, cliLog)
+	schemaPath := writeSchema(t, levelSchema)
+	out, _ := runCapture(t, "view", "-explain", "-strict", "-validate", schemaPath, "-on-invalid", "only", path)
+	for _, want := range []string{
+		"Validate:  matching entries against the JSON Schema " + schemaPath + "; invalid entries are reported and the only entries kept\n",
+		", or if any entry fails validation\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_LevelMap(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-level-map", "notice=info,30=info", path)
+	for _, want := range []string{
+		"Index:     not used with -level-map\n",
+		"Levels:    notice as info, 30 as info\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_Multiline(t *testing.T) {
+	path := writeLog(t, cliLog)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-multiline-start", `^\d`}, "Lines:     an entry starts at each line matching ^\\d; other lines continue it\n"},
+		{[]string{"-multiline-cont", `^\s`}, "Lines:     lines matching ^\\s continue the entry before them; other lines start one\n"},
+		{[]string{"-multiline-start", "^BEGIN", "-multiline-cont", `^\s`}, "Lines:     an entry starts at each line matching ^BEGIN and continues with the lines matching ^\\s; other lines stand alone\n"},
+	}
+	for _, tt := range tests {
+		out, _ := runCapture(t, append(append([]string{"view", "-explain"}, tt.args...), path)...)
+		for _, want := range []string{tt.want, "Index:     not used with -multiline-start or -multiline-cont\n"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%v: output missing %q:\n%s", tt.args, want, out)
+			}
+		}
+	}
+}
+
+func TestExplain_TailBackward(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-tail", "5", path)
+	if want := "Mode:      the last 5 matching entries, read backwards from the end of the file\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+	out, _ = runCapture(t, "view", "-explain", "-tail", "5", "-every", "2", path)
+	if !strings.Contains(out, "Mode:      the last 5 matching entries\n") {
+		t.Errorf("-every should read forwards:\n%s", out)
+	}
+}
+
+func TestExplain_Follow(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-follow", path)
+	for _, want := range []string{
+		"Index:     not used with -follow\n",
+		"Mode:      every matching entry, then those appended to the file as it is written, until interrupted\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_CSV(t *testing.T) {
+	path := writeLog(t, "level,msg\ninfo,a\n")
+	out, _ := runCapture(t, "view", "-explain", "-input", "csv", "-tail", "5", path)
+	for _, want := range []string{
+		"Index:     not used with a header row; give -csv-columns instead\n",
+		"Columns:   named by the first row\n",
+		"Mode:      the last 5 matching entries\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	out, _ = runCapture(t, "view", "-explain", "-input", "tsv", "-csv-columns", "level,msg", path)
+	if want := "Columns:   level, msg\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Compressed(t *testing.T) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(cliLog))
+	zw.Close()
+	path := writeLog(t, b.String())
+	out, _ := runCapture(t, "view", "-explain", "-tail", "5", "-filter", "level=error", path)
+	for _, want := range []string{
+		"Input:     " + path + " (gzip-compressed)\n",
+		"Format:    json (detected)\n",
+		"Index:     not used with a compressed file\n",
+		"Mode:      the last 5 matching entries\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain_Every(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-every", "100", "-every-key", "service", path)
+	if want := "Sample:    1 in every 100 matching entries with each value of service is kept, starting with the first\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Anonymize(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-anonymize", "user_id,email", path)
+	if want := "Anonymize: user_id, email of matching entries replaced with pseudonyms keyed with a random key for this run\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_Flatten(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, _ := runCapture(t, "view", "-explain", "-flatten", path)
+	if want := "Flatten:   nested objects of matching entries replaced by their members under dotted names, such as meta.host\n"; !strings.Contains(out, want) {
+		t.Errorf("output missing %q:\n%s", want, out)
+	}
+}
+
+func TestExplain_InvalidConfig(t *testing.T) {
+	if _, code := runCapture(t, "view", "-explain", "-filter", "nooperator"); code == 0 {
+		t.Error("expected -explain to fail for an invalid filter")
+	}
+}
+
+func TestExplainFilter(t *testing.T) {
+	f, _ := filter.NewFieldFilter("msg~time(out)?")
+	if got := explainFilter(f); got != "msg ~ /time(out)?/ (matches the regular expression)" {
+		t.Errorf("explainFilter = %q", got)
+	}
+	f, _ = filter.NewFieldFilter("status>=500")
+	if got := explainFilter(f); got != `status >= "500" (sorts at or after)` {
+		t.Errorf("explainFilter = %q", got)
+	}
+	f, _ = filter.NewFieldFilter("time<2024-01-15T12:00:00+02:00")
+	if got := explainFilter(f); got != `time < "2024-01-15T12:00:00+02:00" (earlier than 2024-01-15T10:00:00Z)` {
+		t.Errorf("explainFilter = %q", got)
+	}
+}
+
+func TestExplainFormatter(t *testing.T) {
+	tests := []struct {
+		f    formatter.Formatter
+		want string
+	}{
+		{&formatter.TextFormatter{Fields: []string{"time", "msg"}, Color: true}, "text, fields time,msg, color"},
+		{&formatter.TextFormatter{}, "text, all fields, no color"},
+		{&formatter.TextFormatter{Sanitize: true}, "text, all fields, no color, control characters escaped"},
+		{&formatter.TextFormatter{Icons: formatter.IconsOnly}, "text, all fields, no color, level icons instead of levels"},
+		{&formatter.TextFormatter{Align: true}, "text, all fields, no color, aligned in columns"},
+		{&formatter.TextFormatter{FoldStacks: 3}, "text, all fields, no color, stack traces folded to 3 frames"},
+		{&formatter.TextFormatter{Width: 80, Wrap: true}, "text, all fields, no color, lines wrapped to 80 columns"},
+		{&formatter.TextFormatter{MaxValue: 100, Limits: map[string]int{"stack": 0, "msg": 200}}, "text, all fields, no color, values cut to 100 characters, msg to 200, stack uncut"},
+		{&formatter.TextFormatter{TimeLayout: "2006-01-02 15:04:05"}, "text, all fields, no color, times as 2006-01-02 15:04:05 in UTC"},
+		{&formatter.JSONFormatter{Pretty: true}, "json, indented"},
+		{&formatter.JSONFormatter{KeyOrder: []string{"time", "msg"}}, "json, one object per line, members in the order time, msg, then alphabetical"},
+		{&formatter.LogfmtFormatter{}, "logfmt"},
+		{&gapFormatter{f: &formatter.TextFormatter{}, min: 5 * time.Second}, "text, all fields, no color, gaps longer than 5s marked"},
+		{&relativeFormatter{f: &formatter.TextFormatter{}, display: timeElapsed}, "text, all fields, no color, timestamps shown as offsets from the first entry's"},
+		{&avroFormatter{path: "out.avro", schemaPath: "entry.avsc"}, "avro, written to out.avro with the schema in entry.avsc"},
+		{&parquetFormatter{path: "out.parquet"}, "parquet, written to out.parquet with a schema inferred from every entry, which are held until the end"},
+		{&lokiFormatter{url: "http://loki:3100/loki/api/v1/push", batch: 1000, labels: []lokiLabel{{name: "level", field: "level"}, {name: "meta_host", field: "meta.host"}, {name: "job", value: "backfill"}}, tenant: "team-a"},
+			`loki, pushed to http://loki:3100/loki/api/v1/push in batches of 1000 with labels level, meta_host (from meta.host), job="backfill" as tenant team-a`},
+		{&lokiFormatter{url: "http://loki:3100/loki/api/v1/push", batch: 10}, `loki, pushed to http://loki:3100/loki/api/v1/push in batches of 10 with the label job="logpipe"`},
+		{&syslogFormatter{scheme: "tcp", addr: "collector:601", facility: 16}, "syslog, sent to tcp://collector:601 as facility local0"},
+	}
+	for _, tt := range tests {
+		if got := explainFormatter(tt.f); got != tt.want {
+			t.Errorf("explainFormatter(%T) = %q, want %q", tt.f, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "github.com/tylermac92/logpipe/parser"
+
+// flattener implements -flatten when set: it replaces the nested objects
+// of the matching entries with their members under dotted names, such as
+// meta.host, so that text, logfmt and table output show each member as a
+// field of its own.
+type flattener bool
+
+// apply flattens entry, which has already matched, so filters and -jq
+// still see the nested objects. It always keeps entry.
+func (fl flattener) apply(entry *parser.LogEntry) bool {
+	entry.Flatten()
+	return true
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// -flatten
+// =============================================================================
+
+func TestRun_Flatten(t *testing.T) {
+	path := writeLog(t, `{"level":"info","msg":"a","meta":{"host":"srv1","user":{"email":"ann@example.com"}},"status":200}
+{"level":"error","msg":"b","meta":{"host":"srv2"}}
+`)
+	out, code := runCapture(t, "view", "-flatten", "-format", "logfmt", "-filter", "meta.host=srv1", path)
+	if want := "level=info msg=a meta.host=srv1 meta.user.email=ann@example.com status=200\n"; code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	out, _ = runCapture(t, "view", "-flatten", "-fields", "meta.host", "-format", "table", path)
+	if want := "meta.host\nsrv1\nsrv2\n"; out != want {
+		t.Errorf("table output = %q, want %q", out, want)
+	}
+
+	// Anonymizing sees the flattened names.
+	out, _ = runCapture(t, "view", "-flatten", "-anonymize", "meta.user.email", "-format", "logfmt", path)
+	if strings.Contains(out, "ann@") || !strings.Contains(out, "meta.user.email="+pseudonymPrefix) {
+		t.Errorf("anonymized output =\n%s", out)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/internal/input"
+)
+
+// runFollow implements "logpipe follow [flags] file": like view, but at the
+// end of the file it waits for more entries to be appended, as tail -f
+// does. It runs until interrupted.
+func runFollow(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("follow", flag.ContinueOnError)
+	g.register(fs)
+	g.registerSinks(fs)
+	filePath := fs.String("file", "", "Path to the log file to follow (required)")
+	fromStart := fs.Bool("from-start", false, "Print the entries already in the file before following it")
+	interval := fs.Duration("poll", input.DefaultPollInterval, "How often to check the file for new data")
+	var dd dedupeFlags
+	dd.register(fs)
+	var alerts multiFlag
+	fs.Var(&alerts, "alert", "Alert when more entries than a threshold match within a sliding window, such as 'level=error count>50 window=1m' (repeatable)")
+	alertExec := fs.String("alert-exec", "", "Shell command to run each time an --alert fires, given LOGPIPE_ALERT_RULE, LOGPIPE_ALERT_COUNT and LOGPIPE_ALERT_TIME")
+	statsField := fs.String("stats", "", "Redraw a frequency table of the named field's values among the matching entries seen so far, every --refresh, instead of formatting entries")
+	refresh := fs.Duration("refresh", 2*time.Second, "How often --stats redraws its table")
+	var compare multiFlag
+	compareFlag(fs, &compare)
+	statsFormat := statsFormatFlag(fs)
+	statsTemplate := statsTemplateFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe follow [flags] file\n\nFilters and formats entries as they are appended to a file, like tail -f.\nBy default only entries written after logpipe starts are shown.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	path, err := fileArg(fs, *filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if path == "" {
+		fs.Usage()
+		return 2
+	}
+	if err := dd.check(false, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if g.lineNumbers && !*fromStart {
+		fmt.Fprintf(os.Stderr, "Error: --line-numbers requires --from-start, as the lines already in the file are not counted\n")
+		return 2
+	}
+	if g.format == "avro" || g.format == "parquet" || g.format == "loki" {
+		fmt.Fprintf(os.Stderr, "Error: --format %s cannot be used with follow, which runs until interrupted\n", g.format)
+		return 2
+	}
+	if g.atomic {
+		fmt.Fprintf(os.Stderr, "Error: --atomic cannot be used with follow, which runs until interrupted\n")
+		return 2
+	}
+	if *alertExec != "" && len(alerts) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: --alert-exec requires --alert\n")
+		return 2
+	}
+	if err := checkLiveStats(*statsField, *refresh, dd, compare, *statsFormat, *statsTemplate); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	cfg.dedupe = newDeduper(dd, cfg.location)
+	if cfg.alerts, err = newAlerter(alerts, *alertExec, cfg.location); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if cfg.compare, err = parseCompare(compare, cfg.location); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	cfg.statsFormat = *statsFormat
+	if cfg.statsTemplate, err = loadStatsTemplate(*statsTemplate, *statsFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	src, err := openFollow(cfg, g.input, path, *fromStart, *interval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer src.close()
+	if err := cfg.openOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer cfg.file.close(true)
+	if *statsField != "" {
+		return liveStatsMode(cfg, src, *statsField, *refresh)
+	}
+	return formatStream(cfg, src, window{})
+}
+
+// followFlag defines -follow and its shorthand -f on fs, which make view
+// read on as its file grows instead of stopping at its end.
+func followFlag(fs *flag.FlagSet) *bool {
+	follow := fs.Bool("follow", false, "Keep reading the file after its end, printing entries as they are appended, like tail -f; runs until interrupted")
+	fs.BoolVar(follow, "f", false, "Shorthand for -follow")
+	return follow
+}
+
+// checkFollow checks the view flags used with -follow, which needs a file
+// to read and cannot be combined with anything that waits for the end of
+// the input, since a followed file has none.
+func checkFollow(path string, wf windowFlags, quiet bool, groupBy string, slowest, listen bool, g *globalFlags) error {
+	switch {
+	case listen:
+		return fmt.Errorf("--follow cannot be combined with --listen")
+	case path == "":
+		return fmt.Errorf("--follow requires a file")
+	case wf.tail > 0:
+		return fmt.Errorf("--follow cannot be combined with --tail")
+	case quiet:
+		return fmt.Errorf("--follow cannot be combined with --quiet")
+	case groupBy != "":
+		return fmt.Errorf("--follow cannot be combined with --group-by")
+	case slowest:
+		return fmt.Errorf("--follow cannot be combined with --slowest")
+	case g.format == "avro" || g.format == "parquet" || g.format == "loki":
+		return fmt.Errorf("--format %s cannot be combined with --follow, which runs until interrupted", g.format)
+	case g.atomic:
+		return fmt.Errorf("--atomic cannot be combined with --follow, which runs until interrupted")
+	}
+	return nil
+}
+
+// followViewMode implements view -follow: it formats the matching entries
+// of the file at path within win from its start, then those appended to it,
+// until interrupted or, with -head, until enough have been printed.
+func followViewMode(cfg *pipelineConfig, inputFormat, path string, win window) int {
+	src, err := openFollow(cfg, inputFormat, path, true, input.DefaultPollInterval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer src.close()
+	return formatStream(cfg, src, win)
+}
+
+// openFollow opens the file at path to be followed, from its start when
+// fromStart is set and otherwise from its end, checking it for new data
+// every interval, and returns it with the parser for inputFormat.
+func openFollow(cfg *pipelineConfig, inputFormat, path string, fromStart bool, interval time.Duration) (*source, error) {
+	fl, err := input.Follow(path, fromStart, interval)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+
+	if inputFormat == "auto" && !fromStart {
+		// Detect the format from the lines already in the file rather than
+		// waiting for the first new one.
+		if detected, err := sniffFile(path); err == nil {
+			inputFormat = detected
+		}
+	}
+	var fr io.Reader = fl
+	if cfg.readsHeader(inputFormat) && !fromStart {
+		// The rows appended are named by the header already in the file.
+		header, err := headerLine(path)
+		if err != nil {
+			fl.Close()
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+		fr = io.MultiReader(strings.NewReader(header), fl)
+	}
+	r, p, _, err := cfg.parserFor(fr, inputFormat, cfg.readOptsFor(path))
+	if err != nil {
+		fl.Close()
+		return nil, err
+	}
+	return &source{r: r, p: p, closeFn: fl.Close, follow: true}, nil
+}
+
+// headerLine returns the first non-blank line of the file at path, with its
+// newline, or "" when it has none yet.
+func headerLine(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadString('\n')
+		if strings.TrimSpace(line) != "" && err == nil {
+			return line, nil
+		}
+		if err == io.EOF {
+			// A header still being written is read with the rows.
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// sniffFile detects the input format of the file at path from its first
+// non-empty line. It fails for an empty file.
+func sniffFile(path string) (string, error) {
+	f, err := input.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	if f, err = input.Decompress(f); err != nil {
+		return "", err
+	}
+	format, _, err := sniffFormat(f)
+	return format, err
+}
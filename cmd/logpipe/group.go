@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// groupByFlag defines -group-by on fs.
+func groupByFlag(fs *flag.FlagSet) *string {
+	return fs.String("group-by", "", "Print the matching entries grouped under a header per value of this field, such as trace_id, the groups ordered by their earliest timestamp (buffers the whole input)")
+}
+
+// checkGroupBy reports an error if -group-by is combined with flags it
+// cannot honour: -head and -tail, -quiet, or -listen, whose input never
+// ends.
+func checkGroupBy(wf windowFlags, quiet, listen, split bool) error {
+	switch {
+	case wf.head > 0 || wf.limit > 0 || wf.tail > 0:
+		return fmt.Errorf("--group-by cannot be combined with --head or --tail")
+	case quiet:
+		return fmt.Errorf("--group-by cannot be combined with --quiet")
+	case listen:
+		return fmt.Errorf("--group-by cannot be combined with --listen, whose input never ends")
+	case split:
+		return fmt.Errorf("--group-by cannot be combined with --split-by")
+	}
+	return nil
+}
+
+// entryGroup is the entries sharing one value of the -group-by field.
+type entryGroup struct {
+	value   string // the field's value; empty when missing is set
+	missing bool   // the entries lack the field
+	first   time.Time
+	entries []*parser.LogEntry
+}
+
+// groupEntries drains entries and returns those that satisfy match grouped
+// by their value of field, each group in input order. Groups are ordered by
+// their earliest timestamp, with timestamps lacking a UTC offset taken to
+// be in loc; groups without a timestamp follow in the order they first
+// appeared, and the entries without the field come last.
+func groupEntries(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, field string, loc *time.Location) []*entryGroup {
+	var groups []*entryGroup
+	byValue := make(map[string]*entryGroup)
+	var missing *entryGroup
+	for entry := range entries {
+		if !match(entry) {
+			parser.Release(entry)
+			continue
+		}
+		var g *entryGroup
+		if v, ok := entry.Fields[field]; ok {
+			value := fmt.Sprintf("%v", v)
+			if g = byValue[value]; g == nil {
+				g = &entryGroup{value: value}
+				byValue[value] = g
+				groups = append(groups, g)
+			}
+		} else {
+			if missing == nil {
+				missing = &entryGroup{missing: true}
+			}
+			g = missing
+		}
+		if t := parseTimestampForSort(entry, loc); !t.IsZero() && (g.first.IsZero() || t.Before(g.first)) {
+			g.first = t
+		}
+		g.entries = append(g.entries, entry)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i].first, groups[j].first
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+	if missing != nil {
+		groups = append(groups, missing)
+	}
+	return groups
+}
+
+// writeGroups formats the entries of groups to w with f, releasing them.
+// For text output each group is preceded by a header naming field's value
+// and the number of entries, and groups are separated by blank lines;
+// JSON and logfmt output carry no headers, so that they stay parseable. It
+// reports whether any entry failed to format.
+func writeGroups(w io.Writer, groups []*entryGroup, field string, f formatter.Formatter) (failed bool) {
+	_, headers := f.(*formatter.TextFormatter)
+	for i, g := range groups {
+		if headers {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, groupHeader(field, g))
+		}
+		for _, entry := range g.entries {
+			err := f.Format(w, entry)
+			parser.Release(entry)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error formatting log: %v\n", err)
+				failed = true
+			}
+		}
+	}
+	return failed
+}
+
+// groupHeader returns the header line of g, such as
+// "=== trace_id=abc123 (3 entries) ===". A value that is empty or holds
+// spaces or unprintable characters is quoted.
+func groupHeader(field string, g *entryGroup) string {
+	value := "(none)"
+	if !g.missing {
+		value = g.value
+		if value == "" || strings.ContainsFunc(value, func(r rune) bool { return !unicode.IsPrint(r) || r == ' ' }) {
+			value = strconv.Quote(value)
+		}
+	}
+	noun := "entries"
+	if len(g.entries) == 1 {
+		noun = "entry"
+	}
+	return fmt.Sprintf("=== %s=%s (%d %s) ===", field, value, len(g.entries), noun)
+}
+
+// groupMode formats the entries of path (stdin when empty) that match cfg's
+// filters to stdout, grouped by their value of field.
+func groupMode(cfg *pipelineConfig, inputFormat, path, field string, useIndex bool) int {
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	entries, errs := src.p.Parse(src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+	groups := groupEntries(entries, cfg.process, field, cfg.location)
+	failed := wait()
+	src.close()
+	if writeGroups(os.Stdout, groups, field, cfg.formatter) {
+		failed = true
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tylermac92/logpipe/filter"
+	"github.com/tylermac92/logpipe/internal/index"
+)
+
+// runIndex implements "logpipe index [flags] file...": it builds a sidecar
+// index next to each named file and returns the process exit code.
+func runIndex(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	g.registerInput(fs)
+	g.registerProfile(fs)
+	blockSize := byteSize(index.DefaultBlockSize)
+	fs.Var(&blockSize, "block-size", "Target size of an index block (accepts K, M and G suffixes)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe index [flags] file...\n\n")
+		fmt.Fprintf(fs.Output(), "Writes a sidecar index (file%s) that later filtered runs with -file use\nto skip blocks that cannot match.\n\n", index.Suffix)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	exitCode := 0
+	for _, path := range fs.Args() {
+		ix, err := buildIndex(cfg, path, g.input, int(blockSize))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error indexing %s: %v\n", path, err)
+			exitCode = 1
+			continue
+		}
+		out := index.Path(path)
+		if err := ix.Write(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", out, err)
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%s: %d entries in %d blocks -> %s\n", path, ix.Entries, len(ix.Blocks), out)
+	}
+	return exitCode
+}
+
+// buildIndex parses the file at path in the given input format ("auto" to
+// detect it) as cfg reads input and returns its index.
+func buildIndex(cfg *pipelineConfig, path, format string, blockSize int) (*index.Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r, p, format, err := detectParser(f, format, cfg.readOpts)
+	if err != nil {
+		return nil, err
+	}
+	return index.Build(r, cfg.withColumns(p), format, info, blockSize)
+}
+
+// indexPredicates converts the field filters in filters into predicates the
+// index can evaluate. Tests for an absent field are left out, since the
+// index records only the values that are present, as are comparisons of
+// durations, which the index does not know how to order.
+func indexPredicates(filters []filter.Filter) []index.Predicate {
+	var preds []index.Predicate
+	for _, f := range filters {
+		ff, ok := f.(*filter.FieldFilter)
+		if !ok || ff.Operator == "!" {
+			continue
+		}
+		if _, durational := ff.Duration(); durational {
+			continue
+		}
+		pred := index.Predicate{Field: ff.Field, Op: ff.Operator, Value: ff.Value}
+		if at, ok := ff.Time(); ok {
+			pred.Time = at
+		}
+		preds = append(preds, pred)
+	}
+	return preds
+}
+
+// indexedReader returns a reader over just the blocks of the file at path
+// that may match filters, using the file's sidecar index, together with the
+// input format recorded in the index. It returns ok=false, after printing a
+// note when the index exists but cannot be used, if the whole file should
+// be read instead.
+func indexedReader(path string, f io.Reader, filters []filter.Filter) (r io.Reader, format string, ok bool) {
+	ra, isReaderAt := f.(io.ReaderAt)
+	if len(filters) == 0 || !isReaderAt {
+		return nil, "", false
+	}
+	ix, err := index.Load(index.Path(path))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Ignoring index: %v\n", err)
+		}
+		return nil, "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !ix.Fresh(info) {
+		fmt.Fprintf(os.Stderr, "Ignoring stale index %s; rebuild it with: logpipe index %s\n", index.Path(path), path)
+		return nil, "", false
+	}
+	blocks := ix.Candidates(indexPredicates(filters))
+	return index.Reader(ra, blocks), ix.Format, true
+}
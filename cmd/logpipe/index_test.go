@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/filter"
+	"github.com/tylermac92/logpipe/internal/index"
+)
+
+// writeIndexedLog writes a log with one error far from the start, indexes
+// it with small blocks, and returns its path.
+func writeIndexedLog(t *testing.T) string {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		level := "info"
+		if i == 150 {
+			level = "error"
+		}
+		b.WriteString(`{"level":"` + level + `","msg":"entry"}` + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := newGlobalFlags().config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := buildIndex(cfg, path, "auto", 512)
+	if err != nil {
+		t.Fatalf("buildIndex: %v", err)
+	}
+	if err := ix.Write(index.Path(path)); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// mustFilter parses a filter expression or fails the test.
+func mustFilter(t *testing.T, expr string) filter.Filter {
+	t.Helper()
+	f, err := filter.NewFieldFilter(expr)
+	if err != nil {
+		t.Fatalf("NewFieldFilter(%q): %v", expr, err)
+	}
+	return f
+}
+
+func TestBuildIndex_DetectsFormat(t *testing.T) {
+	path := writeIndexedLog(t)
+	ix, err := index.Load(index.Path(path))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if ix.Format != "json" || ix.Entries != 200 {
+		t.Errorf("format = %q, entries = %d", ix.Format, ix.Entries)
+	}
+}
+
+func TestIndexPredicates(t *testing.T) {
+	preds := indexPredicates([]filter.Filter{mustFilter(t, "level=error"), mustFilter(t, "time>=x")})
+	if len(preds) != 2 || preds[0] != (index.Predicate{Field: "level", Op: "=", Value: "error"}) {
+		t.Errorf("unexpected predicates: %+v", preds)
+	}
+}
+
+func TestIndexPredicates_Timestamp(t *testing.T) {
+	preds := indexPredicates([]filter.Filter{mustFilter(t, "time>=2024-01-15T12:00:00+02:00")})
+	if len(preds) != 1 || !preds[0].Time.Equal(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected predicates: %+v", preds)
+	}
+}
+
+func TestIndexedReader_ReadsOnlyCandidateBlocks(t *testing.T) {
+	path := writeIndexedLog(t)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, format, ok := indexedReader(path, f, []filter.Filter{mustFilter(t, "level=error")})
+	if !ok {
+		t.Fatal("expected the index to be used")
+	}
+	if format != "json" {
+		t.Errorf("format = %q, want json", format)
+	}
+	data, _ := io.ReadAll(r)
+	info, _ := os.Stat(path)
+	if int64(len(data)) >= info.Size() {
+		t.Errorf("indexed reader returned %d of %d bytes; expected blocks to be skipped", len(data), info.Size())
+	}
+	if !strings.Contains(string(data), `"level":"error"`) {
+		t.Error("indexed reader dropped the matching entry")
+	}
+}
+
+func TestIndexedReader_NoFilters_NotUsed(t *testing.T) {
+	path := writeIndexedLog(t)
+	f, _ := os.Open(path)
+	defer f.Close()
+	if _, _, ok := indexedReader(path, f, nil); ok {
+		t.Error("index should not be used without filters")
+	}
+}
+
+func TestIndexedReader_StaleIndex_NotUsed(t *testing.T) {
+	path := writeIndexedLog(t)
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	if _, _, ok := indexedReader(path, f, []filter.Filter{mustFilter(t, "level=error")}); ok {
+		t.Error("a stale index must not be used")
+	}
+}
+
+func TestIndexedReader_MissingIndex_NotUsed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.log")
+	os.WriteFile(path, []byte(`{"level":"info"}`+"\n"), 0o644)
+	f, _ := os.Open(path)
+	defer f.Close()
+	if _, _, ok := indexedReader(path, f, []filter.Filter{mustFilter(t, "level=error")}); ok {
+		t.Error("expected no index to be used")
+	}
+}
+
+func TestRun_StrictSkipsIndex(t *testing.T) {
+	// The malformed line is in a block without errors, which the index
+	// would skip.
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		switch {
+		case i == 10:
+			b.WriteString("{not json\n")
+		case i == 150:
+			b.WriteString(`{"level":"error","msg":"entry"}` + "\n")
+		default:
+			b.WriteString(`{"level":"info","msg":"entry"}` + "\n")
+		}
+	}
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := newGlobalFlags().config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := buildIndex(cfg, path, "json", 512)
+	if err != nil {
+		t.Fatalf("buildIndex: %v", err)
+	}
+	if err := ix.Write(index.Path(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, code := runCapture(t, "view", "-filter", "level=error", path); code != 0 {
+		t.Errorf("without -strict: exit code = %d, want 0", code)
+	}
+	if _, code := runCapture(t, "view", "-strict", "-filter", "level=error", path); code != 1 {
+		t.Errorf("-strict: exit code = %d, want 1", code)
+	}
+	out, _ := runCapture(t, "view", "-explain", "-strict", "-filter", "level=error", path)
+	if !strings.Contains(out, "Index:     not used with -strict\n") {
+		t.Errorf("explain output:\n%s", out)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+
+	"github.com/itchyny/gojq"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// jqProgram implements -jq: a jq expression run on each matching entry,
+// as a JSON object, whose first output decides what becomes of it. True
+// keeps the entry as it is; false, null or no output at all drops it; an
+// object replaces its fields. Any other output, or an error, drops the
+// entry with a message on stderr.
+type jqProgram struct {
+	src  string
+	code *gojq.Code
+}
+
+// newJQ compiles the -jq expression src, returning nil when it is empty.
+// The expression can read the environment as $ENV and with env.
+func newJQ(src string) (*jqProgram, error) {
+	if src == "" {
+		return nil, nil
+	}
+	q, err := gojq.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --jq: %w", err)
+	}
+	code, err := gojq.Compile(q, gojq.WithEnvironLoader(os.Environ))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --jq: %w", err)
+	}
+	return &jqProgram{src: src, code: code}, nil
+}
+
+// keep runs the program on entry, which has already matched, so that
+// filters and the program alike see the entry as it was read, and reports
+// whether to keep it. A failure is reported on stderr and drops entry.
+func (j *jqProgram) keep(entry *parser.LogEntry) bool {
+	keep, err := j.apply(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error evaluating --jq: %v\n", err)
+		return false
+	}
+	return keep
+}
+
+// apply runs the program on entry, replacing its fields when the program
+// outputs an object, and reports whether entry is kept.
+func (j *jqProgram) apply(entry *parser.LogEntry) (bool, error) {
+	v, ok := j.code.Run(toJQ(entry)).Next()
+	if !ok {
+		return false, nil
+	}
+	switch v := v.(type) {
+	case error:
+		return false, v
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case map[string]any:
+		reshape(entry, v)
+		return true, nil
+	default:
+		return false, fmt.Errorf("output %s is not an object or a boolean", jqString(v))
+	}
+}
+
+// reshape replaces the fields of entry with those of obj. Fields entry
+// already had keep their place in its field order; new ones follow in
+// alphabetical order.
+func reshape(entry *parser.LogEntry, obj map[string]any) {
+	for _, k := range entry.Keys() {
+		if _, ok := obj[k]; !ok {
+			delete(entry.Fields, k)
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		entry.Set(k, fromJQ(obj[k]))
+	}
+}
+
+// toJQ converts a field value, or a whole entry, into the types gojq
+// works with: numbers become ints, floats or, beyond the range of an int,
+// big integers, and nested entries plain maps. Values of other types are
+// given as their text.
+func toJQ(v any) any {
+	switch v := v.(type) {
+	case nil, bool, int, float64, string:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		if n, ok := new(big.Int).SetString(string(v), 10); ok {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return string(v)
+	case *parser.LogEntry:
+		m := make(map[string]any, v.Len())
+		for _, k := range v.Keys() {
+			m[k] = toJQ(v.Fields[k])
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = toJQ(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i] = toJQ(e)
+		}
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// fromJQ converts a value output by gojq back into a field value, giving
+// big integers as json.Number so that they print in full.
+func fromJQ(v any) any {
+	switch v := v.(type) {
+	case *big.Int:
+		return json.Number(v.String())
+	case map[string]any:
+		for k, e := range v {
+			v[k] = fromJQ(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = fromJQ(e)
+		}
+	}
+	return v
+}
+
+// jqString returns v as jq would print it, for error messages.
+func jqString(v any) string {
+	b, err := gojq.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+func TestNewJQ(t *testing.T) {
+	if j, err := newJQ(""); j != nil || err != nil {
+		t.Errorf(`newJQ("") = %v, %v, want nil, nil`, j, err)
+	}
+	for _, src := range []string{".level ==", "undefined_function(1)"} {
+		if _, err := newJQ(src); err == nil || !strings.HasPrefix(err.Error(), "invalid --jq: ") {
+			t.Errorf("newJQ(%q) error = %v, want an invalid --jq error", src, err)
+		}
+	}
+}
+
+func TestJQProgram_Apply(t *testing.T) {
+	tests := []struct {
+		src     string
+		keep    bool
+		want    string // the entry afterwards, as JSON
+		wantErr string
+	}{
+		{src: `.level == "error" and (.latency | tonumber) > 1`, keep: true, want: `{"level":"error","latency":"1.5","n":12345678901234567890,"meta":{"host":"a"}}`},
+		{src: `.level == "info"`, keep: false},
+		{src: `null`, keep: false},
+		{src: `empty`, keep: false},
+		{src: `{msg: "x", host: .meta.host, n}`, keep: true, want: `{"n":12345678901234567890,"host":"a","msg":"x"}`},
+		{src: `del(.meta) | .extra = 1`, keep: true, want: `{"level":"error","latency":"1.5","n":12345678901234567890,"extra":1}`},
+		{src: `.level`, wantErr: `output "error" is not an object or a boolean`},
+		{src: `.level | tonumber`, wantErr: "tonumber"},
+	}
+	for _, tt := range tests {
+		j, err := newJQ(tt.src)
+		if err != nil {
+			t.Fatalf("newJQ(%q): %v", tt.src, err)
+		}
+		var entry *parser.LogEntry
+		if err := json.Unmarshal([]byte(`{"level":"error","latency":"1.5","n":12345678901234567890,"meta":{"host":"a"}}`), &entry); err != nil {
+			t.Fatal(err)
+		}
+		keep, err := j.apply(entry)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.src, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || keep != tt.keep {
+			t.Errorf("%s: apply = %v, %v, want %v", tt.src, keep, err, tt.keep)
+			continue
+		}
+		if tt.want != "" {
+			if got, _ := json.Marshal(entry); string(got) != tt.want {
+				t.Errorf("%s: entry = %s, want %s", tt.src, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRun_JQ(t *testing.T) {
+	path := writeLog(t, `{"level":"error","msg":"a","latency":"1.5"}
+{"level":"error","msg":"b","latency":"0.2"}
+{"level":"info","msg":"c","latency":"3"}
+`)
+	out, code := runCapture(t, "view", "-format", "json", "-jq", `.level == "error" and (.latency | tonumber) > 1`, path)
+	if want := `{"level":"error","msg":"a","latency":"1.5"}` + "\n"; code != 0 || out != want {
+		t.Errorf("filter: exit code %d, output %q, want %q", code, out, want)
+	}
+	out, code = runCapture(t, "view", "-format", "json", "-filter", "level=error", "-jq", `{msg, latency: (.latency | tonumber)}`, path)
+	if want := `{"msg":"a","latency":1.5}` + "\n" + `{"msg":"b","latency":0.2}` + "\n"; code != 0 || out != want {
+		t.Errorf("reshape: exit code %d, output %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "view", "-jq", ".level ==", path); code != 1 {
+		t.Errorf("invalid expression: exit code %d, want 1", code)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// canonicalLevels are the severities -level-map maps level spellings to,
+// least severe first.
+var canonicalLevels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// levelAlias is one "spelling=level" pair of -level-map.
+type levelAlias struct {
+	from, to string
+}
+
+// levelMap implements -level-map: it rewrites the level of each entry,
+// from whichever of levelFields it is in, to the canonical severity its
+// spelling is mapped to, before the entry is filtered, counted or
+// formatted, so that every part of the pipeline sees the same levels.
+type levelMap struct {
+	aliases []levelAlias      // in flag order, for -explain
+	to      map[string]string // lowercased spelling to canonical level
+}
+
+// parseLevelMap parses a -level-map value: comma-separated pairs such as
+// "notice=info,panic=fatal,30=info". Spellings are matched without regard
+// to case, and numbers by their text. It returns nil when spec is empty.
+func parseLevelMap(spec string) (*levelMap, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	lm := &levelMap{to: make(map[string]string)}
+	for _, pair := range strings.Split(spec, ",") {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.ToLower(strings.TrimSpace(from)), strings.ToLower(strings.TrimSpace(to))
+		switch {
+		case !ok || from == "":
+			return nil, fmt.Errorf("invalid --level-map %q: want spelling=level pairs such as notice=info", pair)
+		case !slices.Contains(canonicalLevels, to):
+			return nil, fmt.Errorf("invalid --level-map %q: unknown level %q (want %s)", pair, to, strings.Join(canonicalLevels, ", "))
+		}
+		if _, dup := lm.to[from]; dup {
+			return nil, fmt.Errorf("invalid --level-map: %q is mapped twice", from)
+		}
+		lm.to[from] = to
+		lm.aliases = append(lm.aliases, levelAlias{from, to})
+	}
+	return lm, nil
+}
+
+// canonical returns the level that level is mapped to, or level itself
+// when it is not mapped. lm may be nil.
+func (lm *levelMap) canonical(level string) string {
+	if lm != nil {
+		if to, ok := lm.to[strings.ToLower(level)]; ok {
+			return to
+		}
+	}
+	return level
+}
+
+// rewrite rewrites entry's level as lm maps it, before the entry is
+// matched. It always keeps entry.
+func (lm *levelMap) rewrite(entry *parser.LogEntry) bool {
+	for _, f := range levelFields {
+		if v, ok := entry.Fields[f]; ok && v != nil {
+			if level := fmt.Sprintf("%v", v); lm.canonical(level) != level {
+				entry.Fields[f] = lm.canonical(level)
+			}
+			break
+		}
+	}
+	return true
+}
+
+// levelAliases are the other spellings of the canonical levels that
+// -min-level understands without a -level-map, the same the text formatter
+// colors by.
+var levelAliases = map[string]string{
+	"trc": "trace", "dbg": "debug", "information": "info", "informational": "info",
+	"notice": "info", "warning": "warn", "err": "error", "crit": "fatal",
+	"critical": "fatal", "alert": "fatal", "emergency": "fatal", "emerg": "fatal",
+	"panic": "fatal",
+}
+
+// levelRank returns the position of level among canonicalLevels, taking
+// the aliases of levelAliases, in any case, and the numeric levels of pino
+// and bunyan, from 10 for trace to 60 for fatal, into account. ok is false
+// for a level it does not know.
+func levelRank(level string) (rank int, ok bool) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if to, ok := levelAliases[level]; ok {
+		level = to
+	}
+	if i := slices.Index(canonicalLevels, level); i >= 0 {
+		return i, true
+	}
+	if n, err := strconv.ParseFloat(level, 64); err == nil && n >= 10 {
+		// 35 is between info and warn: count it as info.
+		return min(int(n)/10, len(canonicalLevels)) - 1, true
+	}
+	return 0, false
+}
+
+// minLevel implements -min-level: it matches the entries whose level, in
+// whichever of levelFields it is found first, is at least as severe as
+// min. Entries without a level, or with one levelRank does not know, do
+// not match; -level-map can name the latter.
+type minLevel struct {
+	rank int
+}
+
+// newMinLevel returns the filter for the -min-level value name, or nil
+// when name is empty.
+func newMinLevel(name string) (*minLevel, error) {
+	if name == "" {
+		return nil, nil
+	}
+	rank, ok := levelRank(name)
+	if !ok {
+		return nil, fmt.Errorf("invalid --min-level %q: want one of %s", name, strings.Join(canonicalLevels, ", "))
+	}
+	return &minLevel{rank: rank}, nil
+}
+
+// Match reports whether the level of entry is at least ml's.
+func (ml *minLevel) Match(entry *parser.LogEntry) bool {
+	for _, f := range levelFields {
+		if v, ok := entry.Fields[f]; ok && v != nil {
+			rank, ok := levelRank(fmt.Sprintf("%v", v))
+			return ok && rank >= ml.rank
+		}
+	}
+	return false
+}
+
+// String describes the filter in the terms of -min-level.
+func (ml *minLevel) String() string {
+	return "level>=" + canonicalLevels[ml.rank]
+}
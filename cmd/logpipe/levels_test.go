@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// levelMap
+// =============================================================================
+
+func TestParseLevelMap(t *testing.T) {
+	if lm, err := parseLevelMap(""); lm != nil || err != nil {
+		t.Errorf("parseLevelMap(\"\") = %v, %v; want nil, nil", lm, err)
+	}
+	lm, err := parseLevelMap("Notice=info, panic = FATAL,30=info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for from, want := range map[string]string{"notice": "info", "NOTICE": "info", "panic": "fatal", "30": "info", "warn": "warn"} {
+		if got := lm.canonical(from); got != want {
+			t.Errorf("canonical(%q) = %q, want %q", from, got, want)
+		}
+	}
+	for _, spec := range []string{"notice", "=info", "notice=verbose", "notice=info,notice=warn"} {
+		if _, err := parseLevelMap(spec); err == nil {
+			t.Errorf("parseLevelMap(%q): expected error", spec)
+		}
+	}
+}
+
+func TestLevelMap_BeforeMatch(t *testing.T) {
+	lm, _ := parseLevelMap("notice=info,30=info,50=error")
+	var seen []any
+	cfg := &pipelineConfig{transforms: []stage{lm.rewrite}, match: func(e *parser.LogEntry) bool {
+		seen = append(seen, e.Fields["level"], e.Fields["severity"])
+		return e.Fields["level"] == "info" || e.Fields["severity"] == "error"
+	}}
+	match := cfg.process
+	tests := []struct {
+		entry *parser.LogEntry
+		want  bool
+	}{
+		{parser.NewEntry(map[string]any{"level": "notice"}), true},
+		{parser.NewEntry(map[string]any{"level": float64(30)}), true},
+		{parser.NewEntry(map[string]any{"severity": "50"}), true},
+		{parser.NewEntry(map[string]any{"level": "debug"}), false},
+		// Only the field the level is taken from is mapped.
+		{parser.NewEntry(map[string]any{"level": "debug", "severity": "50"}), false},
+	}
+	for _, tt := range tests {
+		if got := match(tt.entry); got != tt.want {
+			t.Errorf("match(%v) = %v, want %v", tt.entry, got, tt.want)
+		}
+	}
+	if seen[0] != "info" || seen[2] != "info" || seen[5] != "error" {
+		t.Errorf("match saw levels %v", seen)
+	}
+	var none *levelMap
+	if none.canonical("notice") != "notice" {
+		t.Error("nil levelMap mapped a level")
+	}
+}
+
+// =============================================================================
+// -level-map
+// =============================================================================
+
+func TestRun_LevelMap(t *testing.T) {
+	path := writeLog(t, `{"level":"notice","msg":"a"}
+{"level":30,"msg":"b"}
+{"level":"panic","msg":"c"}
+`)
+	out, code := runCapture(t, "stats", "-field", "level", "-level-map", "notice=info,30=info,panic=fatal", path)
+	if want := "info: 2\nfatal: 1\n"; code != 0 || out != want {
+		t.Errorf("stats output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+	out, _ = runCapture(t, "view", "-format", "logfmt", "-filter", "level=info", "-level-map", "notice=info,30=info", path)
+	if want := "level=info msg=a\nlevel=info msg=b\n"; out != want {
+		t.Errorf("view output =\n%s\nwant\n%s", out, want)
+	}
+	if _, code := runCapture(t, "view", "-level-map", "notice=verbose", path); code != 1 {
+		t.Errorf("invalid level: exit code = %d, want 1", code)
+	}
+}
+
+// =============================================================================
+// -min-level
+// =============================================================================
+
+func TestLevelRank(t *testing.T) {
+	tests := []struct {
+		level string
+		want  string // canonical level, or "" when unknown
+	}{
+		{"trace", "trace"},
+		{"DEBUG", "debug"},
+		{"Warning", "warn"},
+		{"err", "error"},
+		{"crit", "fatal"},
+		{"notice", "info"},
+		{"10", "trace"},
+		{"30", "info"},
+		{"35", "info"},
+		{"50", "error"},
+		{"60", "fatal"},
+		{"70", "fatal"},
+		{"5", ""},
+		{"verbose", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		rank, ok := levelRank(tt.level)
+		got := ""
+		if ok {
+			got = canonicalLevels[rank]
+		}
+		if got != tt.want {
+			t.Errorf("levelRank(%q) = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestMinLevel_Match(t *testing.T) {
+	ml, err := newMinLevel("warning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		entry *parser.LogEntry
+		want  bool
+	}{
+		{parser.NewEntry(map[string]any{"level": "warn"}), true},
+		{parser.NewEntry(map[string]any{"level": "ERROR"}), true},
+		{parser.NewEntry(map[string]any{"lvl": "crit"}), true},
+		{parser.NewEntry(map[string]any{"severity": "info"}), false},
+		{parser.NewEntry(map[string]any{"level": json.Number("40")}), true},
+		{parser.NewEntry(map[string]any{"level": float64(30)}), false},
+		{parser.NewEntry(map[string]any{"level": "verbose"}), false},
+		{parser.NewEntry(map[string]any{"msg": "no level"}), false},
+	}
+	for _, tt := range tests {
+		if got := ml.Match(tt.entry); got != tt.want {
+			t.Errorf("Match(%v) = %v, want %v", tt.entry, got, tt.want)
+		}
+	}
+	if _, err := newMinLevel("loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestRun_MinLevel(t *testing.T) {
+	path := writeLog(t, `{"level":"info","msg":"a"}
+{"level":"warning","msg":"b"}
+{"level":50,"msg":"c"}
+{"level":"notice","msg":"d"}
+{"msg":"e"}
+`)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-min-level", "warn", path)
+	if want := "level=warning msg=b\nlevel=50 msg=c\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+	// -level-map applies first.
+	out, code = runCapture(t, "view", "-format", "logfmt", "-min-level", "warn", "-level-map", "notice=warn", path)
+	if want := "level=warning msg=b\nlevel=50 msg=c\nlevel=warn msg=d\n"; code != 0 || out != want {
+		t.Errorf("with -level-map: exit code %d, output %q, want %q", code, out, want)
+	}
+	if _, code := runCapture(t, "view", "-min-level", "loud", path); code != 1 {
+		t.Errorf("unknown level: exit code %d, want 1", code)
+	}
+}
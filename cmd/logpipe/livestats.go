@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// clearScreen moves the cursor to the top left of the terminal and erases
+// it, so that each table follow -stats draws replaces the one before.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// checkLiveStats checks the follow flags of a live stats table: -stats
+// names the field, -refresh how often it is redrawn, and -compare,
+// -stats-format and -stats-template shape it as they do for stats.
+func checkLiveStats(field string, refresh time.Duration, dd dedupeFlags, compare []string, format, tmpl string) error {
+	if err := checkStatsFormat(format); err != nil {
+		return err
+	}
+	switch {
+	case refresh <= 0:
+		return fmt.Errorf("--refresh must be positive")
+	case field != "" && dd.flag() != "":
+		return fmt.Errorf("%s cannot be combined with --stats", dd.flag())
+	case field != "":
+		return nil
+	case len(compare) > 0:
+		return fmt.Errorf("--compare requires --stats")
+	case format != "plain":
+		return fmt.Errorf("--stats-format requires --stats")
+	case tmpl != "":
+		return fmt.Errorf("--stats-template requires --stats")
+	}
+	return nil
+}
+
+// liveStatsMode implements follow -stats: it counts the values of field
+// among the matching entries of src as they are appended and redraws the
+// table of the counts so far every refresh, until the file can no longer
+// be read.
+func liveStatsMode(cfg *pipelineConfig, src *source, field string, refresh time.Duration) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries, errs := src.p.ParseContext(ctx, src.r)
+	wait := drainErrors(cfg, errs, os.Stderr)
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	exitCode := 0
+	if err := liveStats(os.Stdout, cfg, field, cfg.alerts.watch(ctx, entries), ticker.C, isTerminal(os.Stdout)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exitCode = 1
+		cancel()
+	}
+	if wait() {
+		exitCode = 1
+	}
+	return exitCode
+}
+
+// liveStats counts the values of field among the entries that satisfy
+// cfg.process as they arrive, in cfg.compare columns when there are any, and
+// writes the table of the counts so far to w at each tick when they have
+// changed, and once more when entries is closed. On a terminal each table
+// replaces the last under a line giving the time and the number of entries
+// counted; otherwise the tables follow one another, separated by blank
+// lines.
+func liveStats(w io.Writer, cfg *pipelineConfig, field string, entries <-chan *parser.LogEntry, ticks <-chan time.Time, terminal bool) error {
+	counts := make(statCounts)
+	compared := make(comparedCounts)
+	total := 0
+	// An empty table is drawn at the first tick on a terminal, to show
+	// that logpipe is waiting.
+	changed, drawn := terminal, false
+	draw := func() error {
+		var buf bytes.Buffer
+		if terminal {
+			fmt.Fprintf(&buf, "%s%s: %d matching entries at %s\n\n", clearScreen, field, total, time.Now().Format(time.TimeOnly))
+		} else if drawn {
+			buf.WriteByte('\n')
+		}
+		var err error
+		if len(cfg.compare) > 0 {
+			err = cfg.writeComparedStats(&buf, field, compared.sorted())
+		} else {
+			err = cfg.writeStats(&buf, field, counts.sorted())
+		}
+		if err != nil {
+			return err
+		}
+		changed, drawn = false, true
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				if changed {
+					return draw()
+				}
+				return nil
+			}
+			if cfg.process(entry) {
+				if len(cfg.compare) > 0 {
+					compared.add(entry, field, cfg.compare)
+				} else {
+					counts[statValue(entry, field)]++
+				}
+				total++
+				changed = true
+			}
+			parser.Release(entry)
+		case <-ticks:
+			if changed {
+				if err := draw(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// runLiveStats runs liveStats over the events, each either a level for an
+// entry or "tick", and returns what it wrote. The channels are unbuffered,
+// so each event is handled before the next is sent.
+func runLiveStats(t *testing.T, cfg *pipelineConfig, terminal bool, events ...string) string {
+	t.Helper()
+	entries := make(chan *parser.LogEntry)
+	ticks := make(chan time.Time)
+	var buf bytes.Buffer
+	done := make(chan error)
+	go func() { done <- liveStats(&buf, cfg, "level", entries, ticks, terminal) }()
+	for _, ev := range events {
+		if ev == "tick" {
+			ticks <- time.Now()
+			continue
+		}
+		entries <- parser.NewEntry(map[string]any{"level": ev})
+	}
+	close(entries)
+	if err := <-done; err != nil {
+		t.Fatalf("liveStats: %v", err)
+	}
+	return buf.String()
+}
+
+// liveConfig returns the configuration of follow -stats with the -filter
+// expressions.
+func liveConfig(t *testing.T, filters ...string) *pipelineConfig {
+	t.Helper()
+	g := newGlobalFlags()
+	g.filters = filters
+	cfg, err := g.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.statsFormat = "plain"
+	return cfg
+}
+
+func TestLiveStats_RedrawsWhenChanged(t *testing.T) {
+	cfg := liveConfig(t, "level!=debug")
+	got := runLiveStats(t, cfg, false, "error", "info", "debug", "tick", "tick", "error", "debug", "tick", "warn")
+	want := "error: 1\ninfo: 1\n\nerror: 2\ninfo: 1\n\nerror: 2\ninfo: 1\nwarn: 1\n"
+	if got != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLiveStats_Terminal(t *testing.T) {
+	cfg := liveConfig(t)
+	got := runLiveStats(t, cfg, true, "tick", "error", "tick")
+	frames := strings.Split(got, clearScreen)
+	if len(frames) != 3 || frames[0] != "" {
+		t.Fatalf("output = %q, want two frames each starting with a clear", got)
+	}
+	if !strings.HasPrefix(frames[1], "level: 0 matching entries at ") {
+		t.Errorf("first frame = %q, want an empty table under a header", frames[1])
+	}
+	if !strings.HasPrefix(frames[2], "level: 1 matching entries at ") || !strings.HasSuffix(frames[2], "\n\nerror: 1\n") {
+		t.Errorf("second frame = %q", frames[2])
+	}
+}
+
+func TestLiveStats_Compare(t *testing.T) {
+	cfg := liveConfig(t)
+	var err error
+	if cfg.compare, err = parseCompare([]string{"level=error", "level!=error"}, cfg.location); err != nil {
+		t.Fatal(err)
+	}
+	cfg.statsFormat = "csv"
+	got := runLiveStats(t, cfg, false, "error", "info", "error")
+	if want := "level,level=error,level!=error\nerror,2,0\ninfo,0,1\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestCheckLiveStats(t *testing.T) {
+	tests := []struct {
+		field   string
+		refresh time.Duration
+		dd      dedupeFlags
+		compare []string
+		format  string
+		tmpl    string
+		want    string
+	}{
+		{field: "level", refresh: time.Second, format: "table"},
+		{refresh: time.Second, format: "plain"},
+		{field: "level", refresh: 0, format: "plain", want: "--refresh must be positive"},
+		{field: "level", refresh: time.Second, dd: dedupeFlags{window: time.Second}, format: "plain", want: "cannot be combined with --stats"},
+		{refresh: time.Second, compare: []string{"a=1", "a=2"}, format: "plain", want: "--compare requires --stats"},
+		{refresh: time.Second, format: "csv", want: "--stats-format requires --stats"},
+		{refresh: time.Second, format: "plain", tmpl: "t.tmpl", want: "--stats-template requires --stats"},
+		{field: "level", refresh: time.Second, format: "xml", want: "invalid --stats-format"},
+	}
+	for _, tt := range tests {
+		err := checkLiveStats(tt.field, tt.refresh, tt.dd, tt.compare, tt.format, tt.tmpl)
+		if tt.want == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tt, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%+v: error = %v, want %q", tt, err, tt.want)
+		}
+	}
+}
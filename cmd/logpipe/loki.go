@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// lokiPushPath is the path of Loki's push API, which -loki-url is taken to
+// be the base of when it has no path of its own.
+const lokiPushPath = "/loki/api/v1/push"
+
+// lokiRetries are how long a push that Loki turns away for the time being,
+// with a 429 or 5xx status, or that fails to reach it, waits before each
+// further attempt.
+var lokiRetries = []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+
+// lokiFormatter implements -format loki: it pushes entries to Grafana Loki
+// rather than writing them to the writer it is given, in batches of up to
+// batch entries, each pushed once it is full and the last one by Close.
+// Each entry is sent as its JSON line at its timestamp, or the time it is
+// pushed when it has none, in the stream of its labels: the -loki-labels
+// fields it has, with their values, and the constant ones. An entry with
+// no labels at all goes in the stream {job="logpipe"}, as Loki requires a
+// label on every stream.
+type lokiFormatter struct {
+	url     string // of the push API
+	labels  []lokiLabel
+	tenant  string // X-Scope-OrgID of a multi-tenant Loki, or ""
+	batch   int
+	loc     *time.Location
+	client  *http.Client
+	retries []time.Duration
+	now     func() time.Time
+
+	streams map[string]*lokiStream // of the held entries, by labels
+	order   []string               // keys of streams, in the order seen
+	held    int
+}
+
+// lokiLabel is one of the -loki-labels: a label taking its value from an
+// entry's field, or a constant one when field is "".
+type lokiLabel struct {
+	name, field, value string
+}
+
+// lokiStream is a stream of a push request: its labels and its entries'
+// timestamps, as Unix nanoseconds, and lines.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// newLokiFormatter returns the formatter for -format loki pushing to the
+// Loki at rawURL, which is its base URL or the full URL of its push API,
+// with the -loki-labels spec, the -loki-tenant and batches of batch.
+func newLokiFormatter(rawURL, spec, tenant string, batch int, loc *time.Location) (*lokiFormatter, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("--format loki requires --loki-url")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --loki-url %q (want an http or https URL, such as http://localhost:3100)", rawURL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	if batch <= 0 {
+		return nil, fmt.Errorf("--loki-batch must be positive")
+	}
+	labels, err := parseLokiLabels(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &lokiFormatter{
+		url:     u.String(),
+		labels:  labels,
+		tenant:  tenant,
+		batch:   batch,
+		loc:     loc,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		retries: lokiRetries,
+		now:     time.Now,
+	}, nil
+}
+
+// parseLokiLabels parses the -loki-labels spec: comma-separated field
+// names, which may be dotted paths into nested objects, and constant
+// labels written name=value. A field's label is named after the field,
+// with the characters Loki does not allow in label names replaced by
+// underscores, so that meta.host becomes meta_host.
+func parseLokiLabels(spec string) ([]lokiLabel, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var labels []lokiLabel
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		var l lokiLabel
+		if name, value, ok := strings.Cut(item, "="); ok {
+			if !validLabelName(name) {
+				return nil, fmt.Errorf("invalid --loki-labels: %q is not a valid label name", name)
+			}
+			l = lokiLabel{name: name, value: value}
+		} else {
+			if item == "" {
+				return nil, fmt.Errorf("invalid --loki-labels %q: empty field name", spec)
+			}
+			l = lokiLabel{name: labelName(item), field: item}
+		}
+		if seen[l.name] {
+			return nil, fmt.Errorf("invalid --loki-labels: label %s given twice", l.name)
+		}
+		seen[l.name] = true
+		labels = append(labels, l)
+	}
+	return labels, nil
+}
+
+// validLabelName reports whether Loki accepts name as the name of a label.
+func validLabelName(name string) bool {
+	return name != "" && labelName(name) == name
+}
+
+// labelName returns field with the characters a label name cannot hold
+// replaced by underscores, and an underscore before a leading digit.
+func labelName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Format adds entry to the batch, pushing the batch once it is full.
+func (l *lokiFormatter) Format(_ io.Writer, entry *parser.LogEntry) error {
+	var line bytes.Buffer
+	if err := (&formatter.JSONFormatter{}).Format(&line, entry); err != nil {
+		return err
+	}
+	_, t := timestampField(entry, l.loc)
+	if t.IsZero() {
+		t = l.now()
+	}
+
+	stream := make(map[string]string, len(l.labels))
+	var key strings.Builder
+	for _, lb := range l.labels {
+		value := lb.value
+		if lb.field != "" {
+			v, ok := entry.Lookup(lb.field)
+			if !ok {
+				continue
+			}
+			value = fmt.Sprintf("%v", v)
+		}
+		if value == "" {
+			// Loki drops labels with empty values.
+			continue
+		}
+		stream[lb.name] = value
+		fmt.Fprintf(&key, "%s=%q,", lb.name, value)
+	}
+	if len(stream) == 0 {
+		stream["job"] = "logpipe"
+	}
+
+	if l.streams == nil {
+		l.streams = make(map[string]*lokiStream)
+	}
+	s, ok := l.streams[key.String()]
+	if !ok {
+		s = &lokiStream{Stream: stream}
+		l.streams[key.String()] = s
+		l.order = append(l.order, key.String())
+	}
+	s.Values = append(s.Values, [2]string{strconv.FormatInt(t.UnixNano(), 10), strings.TrimSuffix(line.String(), "\n")})
+	if l.held++; l.held >= l.batch {
+		return l.flush()
+	}
+	return nil
+}
+
+// flush pushes the held entries, if there are any, retrying as lokiRetries
+// describes. The entries are let go whether or not the push succeeds.
+func (l *lokiFormatter) flush() error {
+	if l.held == 0 {
+		return nil
+	}
+	req := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{Streams: make([]*lokiStream, len(l.order))}
+	for i, k := range l.order {
+		req.Streams[i] = l.streams[k]
+	}
+	body, err := json.Marshal(req)
+	held := l.held
+	l.streams, l.order, l.held = nil, nil, 0
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := l.push(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == len(l.retries) {
+			return fmt.Errorf("pushing %d entries to Loki: %w", held, err)
+		}
+		time.Sleep(l.retries[attempt])
+	}
+}
+
+// push makes one attempt at posting body to Loki and reports, when it
+// fails, whether it is worth trying again.
+func (l *lokiFormatter) push(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "logpipe/"+version)
+	if l.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", l.tenant)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s", resp.Status)
+	if s := strings.TrimSpace(string(msg)); s != "" {
+		err = fmt.Errorf("%s: %s", resp.Status, s)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Close pushes the last batch.
+func (l *lokiFormatter) Close() error {
+	return l.flush()
+}
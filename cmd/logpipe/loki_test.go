@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// -format loki
+// =============================================================================
+
+// lokiServer is a stand-in for Loki's push API that records each request
+// it accepts and answers the first len(fail) of them with those statuses.
+type lokiServer struct {
+	mu       sync.Mutex
+	fail     []int
+	requests []lokiRequest
+}
+
+type lokiRequest struct {
+	path, tenant string
+	streams      []lokiStream
+}
+
+func newLokiServer(t *testing.T, fail ...int) (*lokiServer, string) {
+	t.Helper()
+	ls := &lokiServer{fail: fail}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		if len(ls.fail) > 0 {
+			status := ls.fail[0]
+			ls.fail = ls.fail[1:]
+			http.Error(w, "try later", status)
+			return
+		}
+		var body struct {
+			Streams []lokiStream `json:"streams"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ls.requests = append(ls.requests, lokiRequest{r.URL.Path, r.Header.Get("X-Scope-OrgID"), body.Streams})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return ls, srv.URL
+}
+
+func TestRun_FormatLoki(t *testing.T) {
+	ls, url := newLokiServer(t)
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-format", "loki", "-loki-url", url, "-loki-labels", "level,job=backfill", "-loki-tenant", "team-a", "-loki-batch", "2", path)
+	if code != 0 || out != "" {
+		t.Fatalf("output (exit %d) = %q, want nothing on stdout", code, out)
+	}
+	if len(ls.requests) != 2 {
+		t.Fatalf("got %d push requests, want 2", len(ls.requests))
+	}
+	for _, r := range ls.requests {
+		if r.path != lokiPushPath || r.tenant != "team-a" {
+			t.Errorf("pushed to %s as %q, want %s as team-a", r.path, r.tenant, lokiPushPath)
+		}
+	}
+	want := []lokiStream{
+		{Stream: map[string]string{"level": "error", "job": "backfill"}, Values: [][2]string{{"1705312802000000000", `{"time":"2024-01-15T10:00:02Z","level":"error","msg":"b"}`}}},
+		{Stream: map[string]string{"level": "info", "job": "backfill"}, Values: [][2]string{{"1705312801000000000", `{"time":"2024-01-15T10:00:01Z","level":"info","msg":"a"}`}}},
+	}
+	if !reflect.DeepEqual(ls.requests[0].streams, want) {
+		t.Errorf("first push = %+v, want %+v", ls.requests[0].streams, want)
+	}
+	if got := ls.requests[1].streams; len(got) != 1 || got[0].Stream["level"] != "error" || len(got[0].Values) != 1 {
+		t.Errorf("second push = %+v, want the last error entry", got)
+	}
+}
+
+func TestLokiFormatter_Format_Retries(t *testing.T) {
+	ls, url := newLokiServer(t, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	lf, err := newLokiFormatter(url, "", "", 10, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.retries = []time.Duration{0, 0}
+	lf.now = func() time.Time { return time.Unix(5, 0) }
+	if err := lf.Format(nil, parser.NewEntry(map[string]any{"msg": "no time"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	want := []lokiStream{{Stream: map[string]string{"job": "logpipe"}, Values: [][2]string{{"5000000000", `{"msg":"no time"}`}}}}
+	if len(ls.requests) != 1 || !reflect.DeepEqual(ls.requests[0].streams, want) {
+		t.Errorf("pushes = %+v, want one of %+v", ls.requests, want)
+	}
+}
+
+func TestLokiFormatter_Format_GivesUp(t *testing.T) {
+	_, url := newLokiServer(t, http.StatusBadRequest)
+	lf, err := newLokiFormatter(url+"/custom/push", "", "", 1, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lf.Format(nil, parser.NewEntry(map[string]any{"msg": "x"}))
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request: try later") {
+		t.Errorf("Format error = %v, want the 400 response", err)
+	}
+	if err := lf.Close(); err != nil {
+		t.Errorf("Close after a failed push = %v, want nil", err)
+	}
+}
+
+func TestParseLokiLabels(t *testing.T) {
+	labels, err := parseLokiLabels("level, meta.host,2xx,env=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lokiLabel{{name: "level", field: "level"}, {name: "meta_host", field: "meta.host"}, {name: "_2xx", field: "2xx"}, {name: "env", value: "prod"}}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("got %+v, want %+v", labels, want)
+	}
+	for _, spec := range []string{"level,", "level,level", "bad-name=x", "=x"} {
+		if _, err := parseLokiLabels(spec); err == nil {
+			t.Errorf("parseLokiLabels(%q): expected error", spec)
+		}
+	}
+}
+
+func TestRun_FormatLoki_Errors(t *testing.T) {
+	path := writeLog(t, cliLog)
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-format", "loki", path}, 1},
+		{[]string{"view", "-format", "loki", "-loki-url", "localhost:3100", path}, 1},
+		{[]string{"view", "-format", "loki", "-loki-url", "http://localhost:3100", "-loki-batch", "0", path}, 1},
+		{[]string{"view", "-loki-url", "http://localhost:3100", path}, 1},
+		{[]string{"view", "-format", "loki", "-loki-url", "http://localhost:3100", "-follow", path}, 1},
+		{[]string{"follow", "-format", "loki", path}, 2},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
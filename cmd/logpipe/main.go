@@ -4,74 +4,98 @@
 // Usage:
 //
 //	logpipe [flags]
+//	logpipe [global flags] <command> [flags] [args]
 //
-// See the README or run with -help for a full flag reference.
+// The commands are view (the default), stats, patterns, sql, merge,
+// validate, report, follow, bench, index, profile and completion. See the
+// README or run with -help for a full flag reference.
 package main
 
 import (
 	"bufio"
-	"flag"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/tylermac92/logpipe/internal/filter"
-	"github.com/tylermac92/logpipe/internal/formatter"
-	"github.com/tylermac92/logpipe/internal/parser"
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/internal/stack"
+	"github.com/tylermac92/logpipe/parser"
 )
 
 // mergedEntry pairs a parsed log entry with its timestamp for sorting and the
 // source file name already embedded in the entry under the "_source" key.
 type mergedEntry struct {
-	entry parser.LogEntry
+	entry *parser.LogEntry
 	t     time.Time // zero when no recognisable timestamp field is present
 }
 
 // parseTimestampForSort extracts and parses a timestamp from entry for
 // comparison purposes. It checks the canonical timestamp field names in order
-// and tries a Unix-float and then RFC 3339 interpretation. Returns the zero
-// time when no usable timestamp is found.
-func parseTimestampForSort(entry parser.LogEntry) time.Time {
+// and tries a Unix-float and then an RFC 3339 interpretation, as
+// parser.ParseTime understands it, with timestamps that carry no UTC offset
+// taken to be in loc. Returns the zero time when no usable timestamp is
+// found.
+func parseTimestampForSort(entry *parser.LogEntry, loc *time.Location) time.Time {
+	_, t := timestampField(entry, loc)
+	return t
+}
+
+// timestampField is parseTimestampForSort that also returns the name of
+// the field the timestamp was found in.
+func timestampField(entry *parser.LogEntry, loc *time.Location) (string, time.Time) {
 	for _, key := range []string{"time", "ts", "timestamp"} {
-		val, ok := entry[key]
+		val, ok := entry.Fields[key]
 		if !ok {
 			continue
 		}
 		s := fmt.Sprintf("%v", val)
 		var f float64
 		if _, err := fmt.Sscanf(s, "%f", &f); err == nil && f > 1e9 {
-			return time.Unix(int64(f), 0).UTC()
+			return key, time.Unix(int64(f), 0).UTC()
 		}
-		if t, err := time.Parse(time.RFC3339, s); err == nil {
-			return t
+		if t, _, ok := parser.ParseTime(s, loc); ok {
+			return key, t
 		}
 	}
-	return time.Time{}
+	return "", time.Time{}
 }
 
 // loadEntries drains all log entries produced by p reading from r, tags each
 // entry with _source = source, and returns a slice of mergedEntry ready for
-// sorting. Parse errors are printed to stderr and skipped.
-func loadEntries(r io.Reader, p parser.Parser, source string) []mergedEntry {
+// sorting, with naive timestamps taken to be in loc. Raw entries for
+// unparsed lines take the timestamp of the entry before them so that they
+// sort next to it. Parse errors are printed to stderr and skipped; they are
+// also returned so the caller can account for them.
+func loadEntries(r io.Reader, p parser.Parser, source string, loc *time.Location) ([]mergedEntry, []error) {
 	entries, errs := p.Parse(r)
+	var parseErrs []error
+	errsDone := make(chan struct{})
 	go func() {
+		defer close(errsDone)
 		for err := range errs {
 			fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", source, err)
+			parseErrs = append(parseErrs, err)
 		}
 	}()
 	var result []mergedEntry
+	var last time.Time
 	for entry := range entries {
-		entry["_source"] = source
-		result = append(result, mergedEntry{
-			entry: entry,
-			t:     parseTimestampForSort(entry),
-		})
+		entry.Fields[parser.SourceField] = source
+		t := parseTimestampForSort(entry, loc)
+		if _, raw := entry.Fields[parser.RawField]; raw && t.IsZero() {
+			t = last
+		}
+		last = t
+		result = append(result, mergedEntry{entry: entry, t: t})
 	}
-	return result
+	<-errsDone
+	return result, parseErrs
 }
 
 // statEntry holds a single row in the --stats frequency table.
@@ -80,23 +104,71 @@ type statEntry struct {
 	Count int
 }
 
+// topFrameField is the field name that stands for the frame each entry's
+// stack trace was raised in, which stats -top-frame counts; see topFrame.
+const topFrameField = "(top frame)"
+
+// traceFields are the fields searched for a stack trace by topFrame, in
+// order.
+var traceFields = []string{"stack", "stacktrace", "error", "err", "message", "msg", "text"}
+
+// statValue returns the string representation of entry's value for field,
+// which may be a dotted path into nested objects, or "(none)" when entry
+// does not have the field. For topFrameField it is the frame entry's stack
+// trace was raised in.
+func statValue(entry *parser.LogEntry, field string) string {
+	if field == topFrameField {
+		if frame, ok := topFrame(entry); ok {
+			return frame
+		}
+		return "(none)"
+	}
+	if v, ok := entry.Lookup(field); ok {
+		return fmt.Sprintf("%v", v)
+	}
+	return "(none)"
+}
+
+// topFrame returns the frame that the first multi-line stack trace among
+// entry's traceFields was raised in.
+func topFrame(entry *parser.LogEntry) (string, bool) {
+	for _, k := range traceFields {
+		s, ok := entry.Fields[k].(string)
+		if !ok || !strings.Contains(s, "\n") {
+			continue
+		}
+		if frame, ok := stack.Top(strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")); ok {
+			return frame, true
+		}
+	}
+	return "", false
+}
+
 // collectStats drains the entries channel, applies match to each entry, and
-// tallies the string representation of the named field's value. Entries that
-// do not contain the field are counted under "(none)". The returned slice is
-// sorted by count descending; ties are broken alphabetically by value.
-func collectStats(entries <-chan parser.LogEntry, match func(parser.LogEntry) bool, field string) []statEntry {
-	counts := make(map[string]int)
+// tallies the string representation of the named field's value (see
+// statValue). Entries that do not contain the field are counted under
+// "(none)". The returned slice is sorted by count descending; ties are
+// broken alphabetically by value. Entries are released back to the parser
+// pool once counted.
+func collectStats(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, field string) []statEntry {
+	counts := make(statCounts)
 	for entry := range entries {
 		if match(entry) {
-			key := "(none)"
-			if v, ok := entry[field]; ok {
-				key = fmt.Sprintf("%v", v)
-			}
-			counts[key]++
+			counts[statValue(entry, field)]++
 		}
+		parser.Release(entry)
 	}
-	result := make([]statEntry, 0, len(counts))
-	for v, n := range counts {
+	return counts.sorted()
+}
+
+// statCounts tallies how often each value of a field occurs.
+type statCounts map[string]int
+
+// sorted returns the counts as the rows of a stats table, sorted by count
+// descending with ties broken alphabetically by value.
+func (c statCounts) sorted() []statEntry {
+	result := make([]statEntry, 0, len(c))
+	for v, n := range c {
 		result = append(result, statEntry{v, n})
 	}
 	sort.Slice(result, func(i, j int) bool {
@@ -108,22 +180,127 @@ func collectStats(entries <-chan parser.LogEntry, match func(parser.LogEntry) bo
 	return result
 }
 
+// emitEntries formats every entry from entries that satisfies match to w.
+// When limit is positive it stops after limit entries have been written and
+// returns without draining the rest of the channel, so the caller can
+// cancel the parser instead of waiting for it to read the remaining input.
+// Formatting errors are reported on stderr and do not stop output. It
+// returns whether the limit was reached and whether any entry failed to
+// format.
+//
+// Neither match nor f may retain an entry: each one is released back to the
+// parser pool as soon as it has been handled.
+func emitEntries(w io.Writer, entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, f formatter.Formatter, limit int) (limited, failed bool) {
+	n := 0
+	for entry := range entries {
+		if !match(entry) {
+			parser.Release(entry)
+			continue
+		}
+		err := f.Format(w, entry)
+		parser.Release(entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting log: %v\n", err)
+			failed = true
+			continue
+		}
+		n++
+		if limit > 0 && n >= limit {
+			return true, failed
+		}
+	}
+	return false, failed
+}
+
+// anyMatch reports whether any entry from entries satisfies match. It
+// returns at the first match without draining the rest of the channel,
+// releasing every entry it reads.
+func anyMatch(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool) bool {
+	for entry := range entries {
+		ok := match(entry)
+		parser.Release(entry)
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// window selects which matching entries are output: the first head of them
+// when head is positive, the last tail of them when tail is positive, or
+// all of them when both are zero. At most one of head and tail is set.
+type window struct {
+	head, tail int
+}
+
+// emitWindow formats the entries from entries that satisfy match and fall
+// within win to w. With a head window it behaves like emitEntries with
+// that limit. With a tail window it must read the whole channel first,
+// holding the last win.tail matching entries, so it never reports limited.
+func emitWindow(w io.Writer, entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, f formatter.Formatter, win window) (limited, failed bool) {
+	if win.tail <= 0 {
+		return emitEntries(w, entries, match, f, win.head)
+	}
+	for _, entry := range lastMatching(entries, match, win.tail) {
+		err := f.Format(w, entry)
+		parser.Release(entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting log: %v\n", err)
+			failed = true
+		}
+	}
+	return false, failed
+}
+
+// lastMatching drains entries and returns, oldest first, the last n of
+// them that satisfy match. It keeps them in a ring of n slots, releasing
+// every other entry as soon as it has been seen or overwritten.
+func lastMatching(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, n int) []*parser.LogEntry {
+	ring := make([]*parser.LogEntry, 0, n)
+	next := 0 // slot to overwrite once the ring is full
+	for entry := range entries {
+		if !match(entry) {
+			parser.Release(entry)
+			continue
+		}
+		if len(ring) < n {
+			ring = append(ring, entry)
+			continue
+		}
+		parser.Release(ring[next])
+		ring[next] = entry
+		next = (next + 1) % n
+	}
+	return append(ring[next:], ring[:next]...)
+}
+
 // sniffFormat reads the first non-empty line from r to decide whether the
-// input is newline-delimited JSON ("json") or logfmt ("logfmt"). It returns
-// the detected format name and a reconstructed io.Reader that still contains
-// the peeked line so the chosen parser receives the complete byte stream.
-// If the input is empty or only whitespace it defaults to "json".
+// input is newline-delimited JSON ("json"), Google Cloud Logging entries
+// ("gcp"), RFC 5424 syslog ("syslog"), RFC 3164 syslog ("syslog-bsd") or
+// logfmt ("logfmt"). It returns the detected format name and a
+// reconstructed io.Reader that still contains the peeked line so the chosen
+// parser receives the complete byte stream.
+// If the input is empty or only whitespace it defaults to "json". A UTF-8
+// byte order mark at the start of the input is ignored.
+//
+// When r exposes its content through a Bytes method (as memory-mapped files
+// do) the first line is inspected in place and r itself is returned, so the
+// parser can keep reading from the mapping without an intervening copy.
 func sniffFormat(r io.Reader) (string, io.Reader, error) {
+	if src, ok := r.(interface{ Bytes() []byte }); ok {
+		return sniffBytes(src.Bytes()), r, nil
+	}
+
 	br := bufio.NewReader(r)
 	for {
 		line, err := br.ReadString('\n')
-		trimmed := strings.TrimSpace(line)
+		trimmed := strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
 		if trimmed != "" {
 			reconstructed := io.MultiReader(strings.NewReader(line), br)
 			if strings.HasPrefix(trimmed, "{") {
-				return "json", reconstructed, nil
+				return jsonFormat([]byte(trimmed)), reconstructed, nil
 			}
-			return "logfmt", reconstructed, nil
+			return textFormat([]byte(trimmed)), reconstructed, nil
 		}
 		if err == io.EOF {
 			return "json", br, nil
@@ -134,210 +311,306 @@ func sniffFormat(r io.Reader) (string, io.Reader, error) {
 	}
 }
 
-// multiFlag is a custom flag.Value that accumulates repeated uses of the same
-// flag into a string slice. It is used so that -filter can be specified more
-// than once on the command line.
-type multiFlag []string
-
-// String implements flag.Value and returns a comma-joined representation of
-// all collected values.
-func (m *multiFlag) String() string {
-	return strings.Join(*m, ",")
-}
-
-// Set implements flag.Value and appends value to the slice.
-func (m *multiFlag) Set(value string) error {
-	*m = append(*m, value)
-	return nil
-}
-
-func main() {
-	var version = "dev"
-
-	// --- Flag definitions ---
-	var (
-		format      = flag.String("format", "text", "Output format: text or json")
-		inputFormat = flag.String("input", "auto", "Input format: json, logfmt, auto (default: auto)")
-		filePath    = flag.String("file", "", "Path to log file (default: stdin)")
-		color       = flag.Bool("color", false, "Enable color output (text format only)")
-		pretty      = flag.Bool("pretty", false, "Pretty-print JSON output (json format only)")
-		fields      = flag.String("fields", "", "Comma-separated list of fields to display (text format)")
-		filters     multiFlag
-		statsField  = flag.String("stats", "", "Print a frequency table of values for the named field instead of formatting entries")
-		versionFlag = flag.Bool("version", false, "Print version and exit")
-	)
-
-	var mergeFiles multiFlag
-	flag.Var(&filters, "filter", "Filter expression (e.g. level=error, time>=2024-01-01T00:00:00Z)")
-	flag.Var(&mergeFiles, "merge", "File to include in merged timestamp-sorted output (repeatable; use --merge once per file)")
-	flag.Parse()
-
-	if *versionFlag {
-		fmt.Printf("logpipe %s\n", version)
-		os.Exit(0)
-	}
-
-	if *filePath != "" && len(mergeFiles) > 0 {
-		fmt.Fprintf(os.Stderr, "--file and --merge are mutually exclusive\n")
-		os.Exit(1)
-	}
-
-	// --- Input source and parser (single-file / stdin mode only) ---
-	var r io.Reader
-	var p parser.Parser
-	if len(mergeFiles) == 0 {
-		// Open the specified file, or fall back to stdin.
-		if *filePath != "" {
-			f, err := os.Open(*filePath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
-				os.Exit(1)
-			}
-			defer f.Close()
-			r = f
+// sniffBytes applies the sniffFormat heuristic to an in-memory buffer.
+func sniffBytes(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
 		} else {
-			r = os.Stdin
+			data = nil
 		}
-
-		switch *inputFormat {
-		case "json":
-			p = parser.NewJSONParser()
-		case "logfmt":
-			p = parser.NewLogfmtParser()
-		case "auto":
-			detected, sniffed, err := sniffFormat(r)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error detecting input format: %v\n", err)
-				os.Exit(1)
-			}
-			r = sniffed
-			if detected == "json" {
-				p = parser.NewJSONParser()
-			} else {
-				p = parser.NewLogfmtParser()
-			}
-		default:
-			fmt.Fprintf(os.Stderr, "Unsupported input format: %s\n", *inputFormat)
-			os.Exit(1)
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			continue
+		}
+		if trimmed[0] == '{' {
+			return jsonFormat(trimmed)
 		}
+		return textFormat(trimmed)
 	}
+	return "json"
+}
 
-	// --- Filter construction ---
-	// Parse each -filter flag into a FieldFilter and combine them with AND
-	// semantics using a CompositeFilter.
-	var filterList []filter.Filter
-	for _, f := range filters {
-		filt, err := filter.NewFieldFilter(f)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid filter: %v\n", err)
-			os.Exit(1)
+// jsonFormat returns the format of a JSON input whose first entry is line:
+// "gcp" when it is a Google Cloud Logging entry, and "json" otherwise.
+func jsonFormat(line []byte) string {
+	var entry *parser.LogEntry
+	if json.Unmarshal(line, &entry) == nil && entry != nil && parser.IsGCPEntry(entry) {
+		return "gcp"
+	}
+	return "json"
+}
+
+// textFormat returns the format of an input whose first line, line, is not
+// JSON: "syslog" when it is an RFC 5424 syslog message, "syslog-bsd" when
+// it is an RFC 3164 one, and "logfmt" otherwise.
+func textFormat(line []byte) string {
+	if line[0] == '<' {
+		if entry, err := parser.ParseSyslog(string(line)); err == nil {
+			parser.Release(entry)
+			return "syslog"
 		}
-		filterList = append(filterList, filt)
 	}
-	composite := filter.NewCompositeFilter(filterList...)
+	if entry, err := parser.ParseBSDSyslog(string(line), time.Now()); err == nil {
+		parser.Release(entry)
+		return "syslog-bsd"
+	}
+	return "logfmt"
+}
 
-	// --- Formatter selection ---
-	var fieldsList []string
-	if *fields != "" {
-		fieldsList = strings.Split(*fields, ",")
+// newParser returns the parser for the named input format ("json", "gcp",
+// "syslog", "syslog-bsd", "logfmt", "csv" or "tsv") configured with opts.
+func newParser(name string, opts parser.ReadOptions) (parser.ContextParser, error) {
+	switch name {
+	case "json":
+		return &parser.JSONParser{ReadOptions: opts}, nil
+	case "gcp":
+		return &parser.GCPParser{ReadOptions: opts}, nil
+	case "syslog":
+		return &parser.SyslogParser{ReadOptions: opts}, nil
+	case "syslog-bsd":
+		return &parser.BSDSyslogParser{ReadOptions: opts}, nil
+	case "logfmt":
+		return &parser.LogfmtParser{ReadOptions: opts}, nil
+	case "csv":
+		return &parser.CSVParser{ReadOptions: opts, Comma: ','}, nil
+	case "tsv":
+		return &parser.CSVParser{ReadOptions: opts, Comma: '\t'}, nil
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s", name)
 	}
+}
 
-	var fmt_ formatter.Formatter
-	switch *format {
+// newFormatter returns the formatter for the named output format ("text",
+// "json", "logfmt" or "table"). pretty applies to json output; color,
+// sanitize and fields apply to text output, and to table output, where
+// color makes the header row bold and fields are the columns.
+func newFormatter(name string, pretty, color, sanitize bool, fields []string) (formatter.Formatter, error) {
+	switch name {
 	case "json":
-		fmt_ = &formatter.JSONFormatter{Pretty: *pretty}
+		return &formatter.JSONFormatter{Pretty: pretty}, nil
 	case "text":
-		fmt_ = &formatter.TextFormatter{Color: *color, Fields: fieldsList}
+		return &formatter.TextFormatter{Color: color, Sanitize: sanitize, Fields: fields}, nil
 	case "logfmt":
-		fmt_ = &formatter.LogfmtFormatter{}
+		return &formatter.LogfmtFormatter{}, nil
+	case "table":
+		return &formatter.TableFormatter{Color: color, Sanitize: sanitize, Fields: fields}, nil
 	default:
-		fmt.Fprintf(os.Stderr, "Unsupported output format: %s\n", *format)
-		os.Exit(1)
-	}
-
-	// --- Merge pipeline ---
-	// When --merge is used, load all files, sort by timestamp, then feed into
-	// the same stats / format machinery as the normal pipeline.
-	if len(mergeFiles) > 0 {
-		var all []mergedEntry
-		for _, path := range mergeFiles {
-			f, err := os.Open(path)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", path, err)
-				os.Exit(1)
-			}
-			defer f.Close()
-			detected, sniffed, err := sniffFormat(f)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error detecting format of %s: %v\n", path, err)
-				os.Exit(1)
-			}
-			var mp parser.Parser
-			if detected == "json" {
-				mp = parser.NewJSONParser()
-			} else {
-				mp = parser.NewLogfmtParser()
-			}
-			all = append(all, loadEntries(sniffed, mp, filepath.Base(path))...)
-		}
-		sort.SliceStable(all, func(i, j int) bool {
-			return all[i].t.Before(all[j].t)
-		})
+		return nil, fmt.Errorf("unsupported output format: %s", name)
+	}
+}
 
-		ch := make(chan parser.LogEntry, len(all))
-		for _, me := range all {
-			ch <- me.entry
-		}
-		close(ch)
+// byteSize is a flag.Value holding a size in bytes. It accepts a plain
+// integer or one with a K, M or G suffix (optionally followed by "B" or
+// "iB"), where the multipliers are powers of 1024.
+type byteSize int
 
-		if *statsField != "" {
-			for _, s := range collectStats(ch, composite.Match, *statsField) {
-				fmt.Fprintf(os.Stdout, "%s: %d\n", s.Value, s.Count)
-			}
-			os.Exit(0)
-		}
-		exitCode := 0
-		for entry := range ch {
-			if composite.Match(entry) {
-				if err := fmt_.Format(os.Stdout, entry); err != nil {
-					fmt.Fprintf(os.Stderr, "Error formatting log: %v\n", err)
-					exitCode = 1
-				}
+// String implements flag.Value.
+func (b *byteSize) String() string {
+	return strconv.Itoa(int(*b))
+}
+
+// Set implements flag.Value and parses value as described on byteSize.
+func (b *byteSize) Set(value string) error {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := 1
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*b = byteSize(n * mult)
+	return nil
+}
+
+// parseZone returns the time zone named by s: "UTC", "Local", a fixed
+// offset such as "+02:00" or "-0500", or a zone name from the IANA database
+// such as "Europe/Paris".
+func parseZone(s string) (*time.Location, error) {
+	switch s {
+	case "UTC", "Z":
+		return time.UTC, nil
+	case "Local":
+		return time.Local, nil
+	}
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(s, offset), nil
 			}
 		}
-		os.Exit(exitCode)
+		return nil, fmt.Errorf("invalid UTC offset %q (want a form such as +02:00)", s)
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", s)
 	}
+	return loc, nil
+}
 
-	// --- Normal pipeline ---
-	// Parse entries and errors from concurrent goroutines inside the parser.
-	entries, errs := p.Parse(r)
+// strictMode is a flag.Value for -strict. It is used like a boolean flag,
+// and also accepts the value "stop".
+type strictMode int
 
-	// Drain parse errors asynchronously so they don't block the entry channel.
-	go func() {
-		for err := range errs {
-			fmt.Fprintf(os.Stderr, "Error parsing log: %v\n", err)
-		}
-	}()
+const (
+	strictOff  strictMode = iota // parse errors are reported and skipped
+	strictOn                     // parse errors make the run fail
+	strictStop                   // as strictOn, and parsing ends at the first one
+)
 
-	if *statsField != "" {
-		// Stats mode: count value frequencies for the named field and print a
-		// frequency table sorted by count descending.
-		for _, s := range collectStats(entries, composite.Match, *statsField) {
-			fmt.Fprintf(os.Stdout, "%s: %d\n", s.Value, s.Count)
-		}
-		os.Exit(0)
+// String implements flag.Value.
+func (m *strictMode) String() string {
+	switch *m {
+	case strictOn:
+		return "true"
+	case strictStop:
+		return "stop"
+	default:
+		return "false"
 	}
+}
 
-	// Normal mode: iterate over parsed entries, apply filters, and format matching ones.
-	exitCode := 0
-	for entry := range entries {
-		if composite.Match(entry) {
-			if err := fmt_.Format(os.Stdout, entry); err != nil {
-				fmt.Fprintf(os.Stderr, "Error formatting log: %v\n", err)
-				exitCode = 1
-			}
-		}
+// Set implements flag.Value and accepts "stop" or a boolean.
+func (m *strictMode) Set(value string) error {
+	if value == "stop" {
+		*m = strictStop
+		return nil
+	}
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid strict mode %q (want true, false or stop)", value)
 	}
+	*m = strictOff
+	if on {
+		*m = strictOn
+	}
+	return nil
+}
 
-	os.Exit(exitCode)
+// IsBoolFlag lets -strict be given without a value.
+func (m *strictMode) IsBoolFlag() bool {
+	return true
+}
+
+// iconsMode is a flag.Value for -icons. It is used like a boolean flag,
+// and also accepts the value "only".
+type iconsMode formatter.LevelIcons
+
+// String implements flag.Value.
+func (m *iconsMode) String() string {
+	switch formatter.LevelIcons(*m) {
+	case formatter.IconsBeside:
+		return "true"
+	case formatter.IconsOnly:
+		return "only"
+	default:
+		return "false"
+	}
+}
+
+// Set implements flag.Value and accepts "only" or a boolean.
+func (m *iconsMode) Set(value string) error {
+	if value == "only" {
+		*m = iconsMode(formatter.IconsOnly)
+		return nil
+	}
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid icons mode %q (want true, false or only)", value)
+	}
+	*m = iconsMode(formatter.IconsOff)
+	if on {
+		*m = iconsMode(formatter.IconsBeside)
+	}
+	return nil
+}
+
+// IsBoolFlag lets -icons be given without a value.
+func (m *iconsMode) IsBoolFlag() bool {
+	return true
+}
+
+// autoBool is a flag.Value for a boolean flag whose default depends on the
+// environment. It is used like a boolean flag, also accepting "always" and
+// "never" for true and false, and "auto", its initial value, which leaves
+// the choice to resolve.
+type autoBool struct {
+	set bool // whether a value other than "auto" was given
+	on  bool
+}
+
+// String implements flag.Value.
+func (b *autoBool) String() string {
+	if !b.set {
+		return "auto"
+	}
+	return strconv.FormatBool(b.on)
+}
+
+// Set implements flag.Value and accepts "auto", "always", "never" or a
+// boolean.
+func (b *autoBool) Set(value string) error {
+	switch value {
+	case "auto":
+		*b = autoBool{}
+		return nil
+	case "always":
+		value = "true"
+	case "never":
+		value = "false"
+	}
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid value %q (want auto, always, never, true or false)", value)
+	}
+	*b = autoBool{set: true, on: on}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (b *autoBool) IsBoolFlag() bool {
+	return true
+}
+
+// resolve returns the flag's value, or auto if it was left at "auto".
+func (b *autoBool) resolve(auto bool) bool {
+	if !b.set {
+		return auto
+	}
+	return b.on
+}
+
+// multiFlag is a custom flag.Value that accumulates repeated uses of the same
+// flag into a string slice. It is used so that -filter can be specified more
+// than once on the command line.
+type multiFlag []string
+
+// String implements flag.Value and returns a comma-joined representation of
+// all collected values.
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+// Set implements flag.Value and appends value to the slice.
+func (m *multiFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
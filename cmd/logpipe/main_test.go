@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/tylermac92/logpipe/internal/parser"
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
 )
 
 // =============================================================================
@@ -106,6 +110,197 @@ func TestMultiFlag_ImplementsFlagValue(t *testing.T) {
 	_ = m.Set("x")
 }
 
+// =============================================================================
+// byteSize
+// =============================================================================
+
+func TestByteSize_Set(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"1024", 1024},
+		{"4K", 4 << 10},
+		{"4KB", 4 << 10},
+		{"8MiB", 8 << 20},
+		{"2m", 2 << 20},
+		{"1G", 1 << 30},
+	}
+	for _, tt := range tests {
+		var b byteSize
+		if err := b.Set(tt.input); err != nil {
+			t.Errorf("Set(%q) returned error: %v", tt.input, err)
+			continue
+		}
+		if int(b) != tt.want {
+			t.Errorf("Set(%q) = %d, want %d", tt.input, int(b), tt.want)
+		}
+	}
+}
+
+func TestByteSize_Set_Invalid(t *testing.T) {
+	for _, input := range []string{"", "abc", "-1", "0", "1T"} {
+		var b byteSize
+		if err := b.Set(input); err == nil {
+			t.Errorf("Set(%q) expected error, got %d", input, int(b))
+		}
+	}
+}
+
+func TestByteSize_String(t *testing.T) {
+	b := byteSize(2048)
+	if got := b.String(); got != "2048" {
+		t.Errorf("String() = %q, want %q", got, "2048")
+	}
+}
+
+// =============================================================================
+// strictMode
+// =============================================================================
+
+func TestStrictMode_Set(t *testing.T) {
+	tests := []struct {
+		input string
+		want  strictMode
+	}{
+		{"true", strictOn},
+		{"1", strictOn},
+		{"false", strictOff},
+		{"stop", strictStop},
+	}
+	for _, tt := range tests {
+		m := strictStop
+		if err := m.Set(tt.input); err != nil {
+			t.Errorf("Set(%q) error: %v", tt.input, err)
+			continue
+		}
+		if m != tt.want {
+			t.Errorf("Set(%q) = %v, want %v", tt.input, m.String(), tt.want.String())
+		}
+	}
+}
+
+func TestStrictMode_Set_Invalid(t *testing.T) {
+	var m strictMode
+	if err := m.Set("sometimes"); err == nil {
+		t.Error("Set(\"sometimes\") expected error")
+	}
+}
+
+func TestStrictMode_FlagWithoutValue(t *testing.T) {
+	var m strictMode
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&m, "strict", "")
+	if err := fs.Parse([]string{"-strict"}); err != nil {
+		t.Fatal(err)
+	}
+	if m != strictOn {
+		t.Errorf("mode = %v, want true", m.String())
+	}
+}
+
+// =============================================================================
+// autoBool
+// =============================================================================
+
+func TestAutoBool_Resolve(t *testing.T) {
+	tests := []struct {
+		args []string
+		auto bool
+		want bool
+	}{
+		{nil, true, true},
+		{nil, false, false},
+		{[]string{"-sanitize"}, false, true},
+		{[]string{"-sanitize=false"}, true, false},
+		{[]string{"-sanitize=true", "-sanitize=auto"}, true, true},
+		{[]string{"-sanitize=always"}, false, true},
+		{[]string{"-sanitize=never"}, true, false},
+	}
+	for _, tt := range tests {
+		var b autoBool
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Var(&b, "sanitize", "")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.resolve(tt.auto); got != tt.want {
+			t.Errorf("%v with auto %v: resolve = %v, want %v", tt.args, tt.auto, got, tt.want)
+		}
+	}
+}
+
+func TestAutoBool_String_RoundTrips(t *testing.T) {
+	for _, v := range []string{"auto", "true", "false"} {
+		var b autoBool
+		if err := b.Set(v); err != nil || b.String() != v {
+			t.Errorf("Set(%q): String() = %q, err = %v", v, b.String(), err)
+		}
+	}
+	var b autoBool
+	if err := b.Set("sometimes"); err == nil {
+		t.Error("Set(\"sometimes\") expected error")
+	}
+}
+
+// =============================================================================
+// newParser
+// =============================================================================
+
+func TestNewParser_AppliesReadOptions(t *testing.T) {
+	opts := parser.ReadOptions{MaxLineSize: 10, Oversize: parser.OversizeTruncate}
+	p, err := newParser("json", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jp, ok := p.(*parser.JSONParser)
+	if !ok {
+		t.Fatalf("newParser(json) returned %T", p)
+	}
+	if jp.ReadOptions != opts {
+		t.Errorf("ReadOptions = %+v, want %+v", jp.ReadOptions, opts)
+	}
+	if _, err := newParser("logfmt", opts); err != nil {
+		t.Errorf("newParser(logfmt): %v", err)
+	}
+}
+
+func TestNewParser_Unknown(t *testing.T) {
+	if _, err := newParser("xml", parser.ReadOptions{}); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
+
+// =============================================================================
+// newFormatter
+// =============================================================================
+
+func TestNewFormatter_KnownFormats(t *testing.T) {
+	for _, name := range []string{"text", "json", "logfmt"} {
+		f, err := newFormatter(name, false, false, false, nil)
+		if err != nil || f == nil {
+			t.Errorf("newFormatter(%q) = %v, %v", name, f, err)
+		}
+	}
+}
+
+func TestNewFormatter_AppliesOptions(t *testing.T) {
+	f, _ := newFormatter("json", true, false, false, nil)
+	if jf, ok := f.(*formatter.JSONFormatter); !ok || !jf.Pretty {
+		t.Errorf("json formatter = %#v, want Pretty", f)
+	}
+	f, _ = newFormatter("text", false, true, true, []string{"a"})
+	if tf, ok := f.(*formatter.TextFormatter); !ok || !tf.Color || !tf.Sanitize || len(tf.Fields) != 1 {
+		t.Errorf("text formatter = %#v, want Color, Sanitize and Fields", f)
+	}
+}
+
+func TestNewFormatter_Unknown(t *testing.T) {
+	if _, err := newFormatter("xml", false, false, false, nil); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
 // =============================================================================
 // sniffFormat
 // =============================================================================
@@ -132,6 +327,43 @@ func TestSniffFormat_Logfmt(t *testing.T) {
 	}
 }
 
+func TestSniffFormat_GCP(t *testing.T) {
+	line := `{"textPayload":"hello","severity":"INFO","logName":"projects/p/logs/app"}` + "\n"
+	got, _, err := sniffFormat(strings.NewReader(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "gcp" {
+		t.Errorf("got %q, want %q", got, "gcp")
+	}
+	if got := sniffBytes([]byte(line)); got != "gcp" {
+		t.Errorf("sniffBytes = %q, want %q", got, "gcp")
+	}
+}
+
+func TestSniffFormat_Syslog(t *testing.T) {
+	line := "<165>1 2024-01-15T10:00:00Z web1 checkout - - - payment failed\n"
+	got, _, err := sniffFormat(strings.NewReader(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "syslog" {
+		t.Errorf("got %q, want %q", got, "syslog")
+	}
+	if got := sniffBytes([]byte(line)); got != "syslog" {
+		t.Errorf("sniffBytes = %q, want %q", got, "syslog")
+	}
+	if got := sniffBytes([]byte("<34>Jan  2 15:04:05 web1 sshd[4123]: Accepted\n")); got != "syslog-bsd" {
+		t.Errorf("sniffBytes = %q, want %q", got, "syslog-bsd")
+	}
+	if got := sniffBytes([]byte("Jan  2 15:04:05 web1 kernel: eth0 up\n")); got != "syslog-bsd" {
+		t.Errorf("sniffBytes = %q, want %q", got, "syslog-bsd")
+	}
+	if got := sniffBytes([]byte("<html> key=value\n")); got != "logfmt" {
+		t.Errorf("sniffBytes = %q, want %q for a line that only starts like syslog", got, "logfmt")
+	}
+}
+
 func TestSniffFormat_LeadingBlankLines_JSON(t *testing.T) {
 	r := strings.NewReader("\n\n\n" + `{"level":"warn"}` + "\n")
 	got, _, err := sniffFormat(r)
@@ -208,16 +440,70 @@ func TestSniffFormat_ReconstructedReaderContainsAllLines(t *testing.T) {
 	}
 }
 
+// bytesReader stands in for a memory-mapped file: it exposes its content via
+// Bytes in addition to io.Reader.
+type bytesReader struct {
+	*strings.Reader
+	data []byte
+}
+
+func (b *bytesReader) Bytes() []byte { return b.data }
+
+func TestSniffFormat_BOMAndCRLF_JSON(t *testing.T) {
+	r := strings.NewReader("\ufeff" + `{"level":"info"}` + "\r\n")
+	got, _, err := sniffFormat(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "json" {
+		t.Errorf("got %q, want %q", got, "json")
+	}
+}
+
+func TestSniffFormat_ByteSource_ReturnsOriginalReader(t *testing.T) {
+	input := "\n" + `{"level":"info"}` + "\n"
+	src := &bytesReader{Reader: strings.NewReader(input), data: []byte(input)}
+	got, r, err := sniffFormat(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "json" {
+		t.Errorf("got %q, want %q", got, "json")
+	}
+	if r != io.Reader(src) {
+		t.Error("expected sniffFormat to return the byte source unchanged")
+	}
+}
+
+func TestSniffBytes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "json"},
+		{"  \n\n", "json"},
+		{`{"a":1}`, "json"},
+		{"\n  level=info\n", "logfmt"},
+		{"\ufeff{\"a\":1}\r\n", "json"},
+		{"\ufeff\r\n{\"a\":1}\r\n", "json"},
+	}
+	for _, tt := range tests {
+		if got := sniffBytes([]byte(tt.input)); got != tt.want {
+			t.Errorf("sniffBytes(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
 // =============================================================================
 // collectStats
 // =============================================================================
 
 // matchAll is a match function that accepts every entry.
-func matchAll(_ parser.LogEntry) bool { return true }
+func matchAll(_ *parser.LogEntry) bool { return true }
 
 // makeEntries returns a closed channel pre-loaded with the given entries.
-func makeEntries(entries ...parser.LogEntry) <-chan parser.LogEntry {
-	ch := make(chan parser.LogEntry, len(entries))
+func makeEntries(entries ...*parser.LogEntry) <-chan *parser.LogEntry {
+	ch := make(chan *parser.LogEntry, len(entries))
 	for _, e := range entries {
 		ch <- e
 	}
@@ -227,9 +513,9 @@ func makeEntries(entries ...parser.LogEntry) <-chan parser.LogEntry {
 
 func TestCollectStats_CountsByValue(t *testing.T) {
 	ch := makeEntries(
-		parser.LogEntry{"level": "info"},
-		parser.LogEntry{"level": "error"},
-		parser.LogEntry{"level": "info"},
+		parser.NewEntry(map[string]any{"level": "info"}),
+		parser.NewEntry(map[string]any{"level": "error"}),
+		parser.NewEntry(map[string]any{"level": "info"}),
 	)
 	got := collectStats(ch, matchAll, "level")
 	if len(got) != 2 {
@@ -245,12 +531,12 @@ func TestCollectStats_CountsByValue(t *testing.T) {
 
 func TestCollectStats_SortedByCountDescending(t *testing.T) {
 	ch := makeEntries(
-		parser.LogEntry{"level": "error"},
-		parser.LogEntry{"level": "info"},
-		parser.LogEntry{"level": "info"},
-		parser.LogEntry{"level": "info"},
-		parser.LogEntry{"level": "warn"},
-		parser.LogEntry{"level": "warn"},
+		parser.NewEntry(map[string]any{"level": "error"}),
+		parser.NewEntry(map[string]any{"level": "info"}),
+		parser.NewEntry(map[string]any{"level": "info"}),
+		parser.NewEntry(map[string]any{"level": "info"}),
+		parser.NewEntry(map[string]any{"level": "warn"}),
+		parser.NewEntry(map[string]any{"level": "warn"}),
 	)
 	got := collectStats(ch, matchAll, "level")
 	if len(got) != 3 {
@@ -269,9 +555,9 @@ func TestCollectStats_SortedByCountDescending(t *testing.T) {
 
 func TestCollectStats_TiesBrokenAlphabetically(t *testing.T) {
 	ch := makeEntries(
-		parser.LogEntry{"svc": "zebra"},
-		parser.LogEntry{"svc": "alpha"},
-		parser.LogEntry{"svc": "middle"},
+		parser.NewEntry(map[string]any{"svc": "zebra"}),
+		parser.NewEntry(map[string]any{"svc": "alpha"}),
+		parser.NewEntry(map[string]any{"svc": "middle"}),
 	)
 	got := collectStats(ch, matchAll, "svc")
 	if len(got) != 3 {
@@ -291,8 +577,8 @@ func TestCollectStats_TiesBrokenAlphabetically(t *testing.T) {
 
 func TestCollectStats_MissingFieldCountedAsNone(t *testing.T) {
 	ch := makeEntries(
-		parser.LogEntry{"level": "info"},
-		parser.LogEntry{"msg": "no level field"},
+		parser.NewEntry(map[string]any{"level": "info"}),
+		parser.NewEntry(map[string]any{"msg": "no level field"}),
 	)
 	got := collectStats(ch, matchAll, "level")
 	if len(got) != 2 {
@@ -311,12 +597,12 @@ func TestCollectStats_MissingFieldCountedAsNone(t *testing.T) {
 
 func TestCollectStats_FilterApplied(t *testing.T) {
 	ch := makeEntries(
-		parser.LogEntry{"level": "info", "svc": "api"},
-		parser.LogEntry{"level": "error", "svc": "db"},
-		parser.LogEntry{"level": "error", "svc": "api"},
+		parser.NewEntry(map[string]any{"level": "info", "svc": "api"}),
+		parser.NewEntry(map[string]any{"level": "error", "svc": "db"}),
+		parser.NewEntry(map[string]any{"level": "error", "svc": "api"}),
 	)
-	onlyErrors := func(e parser.LogEntry) bool {
-		return e["level"] == "error"
+	onlyErrors := func(e *parser.LogEntry) bool {
+		return e.Fields["level"] == "error"
 	}
 	got := collectStats(ch, onlyErrors, "svc")
 	if len(got) != 2 {
@@ -337,13 +623,195 @@ func TestCollectStats_EmptyInput(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// emitEntries
+// =============================================================================
+
+// failingFormatter returns an error for entries whose "fail" field is set and
+// writes the "msg" field of the others on its own line.
+type failingFormatter struct{}
+
+func (failingFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	if _, ok := entry.Fields["fail"]; ok {
+		return errors.New("cannot format")
+	}
+	_, err := fmt.Fprintf(w, "%v\n", entry.Fields["msg"])
+	return err
+}
+
+func TestEmitEntries_NoLimit_WritesAllMatches(t *testing.T) {
+	ch := makeEntries(
+		parser.NewEntry(map[string]any{"msg": "a", "level": "error"}),
+		parser.NewEntry(map[string]any{"msg": "b", "level": "info"}),
+		parser.NewEntry(map[string]any{"msg": "c", "level": "error"}),
+	)
+	isError := func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }
+	var out strings.Builder
+	limited, failed := emitEntries(&out, ch, isError, failingFormatter{}, 0)
+	if limited || failed {
+		t.Errorf("limited=%v failed=%v, want false false", limited, failed)
+	}
+	if got := out.String(); got != "a\nc\n" {
+		t.Errorf("output = %q, want %q", got, "a\nc\n")
+	}
+}
+
+func TestEmitEntries_Limit_StopsWithoutDraining(t *testing.T) {
+	ch := make(chan *parser.LogEntry, 4)
+	ch <- parser.NewEntry(map[string]any{"msg": "a"})
+	ch <- parser.NewEntry(map[string]any{"msg": "b"})
+	ch <- parser.NewEntry(map[string]any{"msg": "c"})
+	ch <- parser.NewEntry(map[string]any{"msg": "d"})
+	// The channel is left open: emitEntries must return once the limit is
+	// reached rather than waiting for more input.
+	var out strings.Builder
+	limited, _ := emitEntries(&out, ch, matchAll, failingFormatter{}, 2)
+	if !limited {
+		t.Error("limited = false, want true")
+	}
+	if got := out.String(); got != "a\nb\n" {
+		t.Errorf("output = %q, want %q", got, "a\nb\n")
+	}
+	if len(ch) != 2 {
+		t.Errorf("%d entries left unread, want 2", len(ch))
+	}
+}
+
+func TestEmitEntries_Limit_CountsOnlyMatches(t *testing.T) {
+	ch := makeEntries(
+		parser.NewEntry(map[string]any{"msg": "a", "level": "info"}),
+		parser.NewEntry(map[string]any{"msg": "b", "level": "error"}),
+		parser.NewEntry(map[string]any{"msg": "c", "level": "info"}),
+		parser.NewEntry(map[string]any{"msg": "d", "level": "error"}),
+	)
+	isError := func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }
+	var out strings.Builder
+	limited, _ := emitEntries(&out, ch, isError, failingFormatter{}, 2)
+	if !limited {
+		t.Error("limited = false, want true")
+	}
+	if got := out.String(); got != "b\nd\n" {
+		t.Errorf("output = %q, want %q", got, "b\nd\n")
+	}
+}
+
+func TestEmitEntries_LimitAboveMatches_NotLimited(t *testing.T) {
+	ch := makeEntries(parser.NewEntry(map[string]any{"msg": "a"}))
+	var out strings.Builder
+	if limited, _ := emitEntries(&out, ch, matchAll, failingFormatter{}, 5); limited {
+		t.Error("limited = true, want false")
+	}
+}
+
+func TestEmitEntries_FormatError_ReportedAndNotCounted(t *testing.T) {
+	ch := makeEntries(
+		parser.NewEntry(map[string]any{"msg": "a", "fail": true}),
+		parser.NewEntry(map[string]any{"msg": "b"}),
+	)
+	var out strings.Builder
+	limited, failed := emitEntries(&out, ch, matchAll, failingFormatter{}, 1)
+	if !failed {
+		t.Error("failed = false, want true")
+	}
+	if !limited {
+		t.Error("limited = false, want true")
+	}
+	if got := out.String(); got != "b\n" {
+		t.Errorf("output = %q, want %q", got, "b\n")
+	}
+}
+
+// =============================================================================
+// anyMatch
+// =============================================================================
+
+func TestAnyMatch_StopsAtFirstMatch(t *testing.T) {
+	ch := make(chan *parser.LogEntry, 3)
+	ch <- parser.NewEntry(map[string]any{"level": "info"})
+	ch <- parser.NewEntry(map[string]any{"level": "error"})
+	ch <- parser.NewEntry(map[string]any{"level": "error"})
+	isError := func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }
+	if !anyMatch(ch, isError) {
+		t.Fatal("anyMatch = false, want true")
+	}
+	if len(ch) != 1 {
+		t.Errorf("%d entries left unread, want 1", len(ch))
+	}
+}
+
+func TestAnyMatch_NoMatch(t *testing.T) {
+	ch := makeEntries(parser.NewEntry(map[string]any{"level": "info"}))
+	if anyMatch(ch, func(*parser.LogEntry) bool { return false }) {
+		t.Error("anyMatch = true, want false")
+	}
+}
+
+// =============================================================================
+// emitWindow
+// =============================================================================
+
+func TestEmitWindow_Tail_KeepsLastMatches(t *testing.T) {
+	ch := makeEntries(
+		parser.NewEntry(map[string]any{"msg": "a", "level": "error"}),
+		parser.NewEntry(map[string]any{"msg": "b", "level": "error"}),
+		parser.NewEntry(map[string]any{"msg": "c", "level": "info"}),
+		parser.NewEntry(map[string]any{"msg": "d", "level": "error"}),
+		parser.NewEntry(map[string]any{"msg": "e", "level": "error"}),
+		parser.NewEntry(map[string]any{"msg": "f", "level": "info"}),
+	)
+	isError := func(e *parser.LogEntry) bool { return e.Fields["level"] == "error" }
+	var out strings.Builder
+	limited, failed := emitWindow(&out, ch, isError, failingFormatter{}, window{tail: 3})
+	if limited || failed {
+		t.Errorf("limited=%v failed=%v, want false false", limited, failed)
+	}
+	if got := out.String(); got != "b\nd\ne\n" {
+		t.Errorf("output = %q, want %q", got, "b\nd\ne\n")
+	}
+}
+
+func TestEmitWindow_TailAboveMatches_WritesAll(t *testing.T) {
+	ch := makeEntries(parser.NewEntry(map[string]any{"msg": "a"}), parser.NewEntry(map[string]any{"msg": "b"}))
+	var out strings.Builder
+	emitWindow(&out, ch, matchAll, failingFormatter{}, window{tail: 5})
+	if got := out.String(); got != "a\nb\n" {
+		t.Errorf("output = %q, want %q", got, "a\nb\n")
+	}
+}
+
+func TestEmitWindow_Head_StopsWithoutDraining(t *testing.T) {
+	ch := make(chan *parser.LogEntry, 3)
+	ch <- parser.NewEntry(map[string]any{"msg": "a"})
+	ch <- parser.NewEntry(map[string]any{"msg": "b"})
+	ch <- parser.NewEntry(map[string]any{"msg": "c"})
+	var out strings.Builder
+	limited, _ := emitWindow(&out, ch, matchAll, failingFormatter{}, window{head: 1})
+	if !limited {
+		t.Error("limited = false, want true")
+	}
+	if got := out.String(); got != "a\n" {
+		t.Errorf("output = %q, want %q", got, "a\n")
+	}
+}
+
+func TestEmitWindow_Tail_FormatErrorReported(t *testing.T) {
+	ch := makeEntries(parser.NewEntry(map[string]any{"msg": "a"}), parser.NewEntry(map[string]any{"msg": "b", "fail": true}))
+	var out strings.Builder
+	if _, failed := emitWindow(&out, ch, matchAll, failingFormatter{}, window{tail: 2}); !failed {
+		t.Error("failed = false, want true")
+	}
+	if got := out.String(); got != "a\n" {
+		t.Errorf("output = %q, want %q", got, "a\n")
+	}
+}
+
 // =============================================================================
 // parseTimestampForSort
 // =============================================================================
 
 func TestParseTimestampForSort_RFC3339(t *testing.T) {
-	entry := parser.LogEntry{"time": "2024-01-15T12:34:56Z"}
-	got := parseTimestampForSort(entry)
+	entry := parser.NewEntry(map[string]any{"time": "2024-01-15T12:34:56Z"})
+	got := parseTimestampForSort(entry, nil)
 	want, _ := time.Parse(time.RFC3339, "2024-01-15T12:34:56Z")
 	if !got.Equal(want) {
 		t.Errorf("got %v, want %v", got, want)
@@ -351,8 +819,8 @@ func TestParseTimestampForSort_RFC3339(t *testing.T) {
 }
 
 func TestParseTimestampForSort_UnixEpoch(t *testing.T) {
-	entry := parser.LogEntry{"time": "1704067200"}
-	got := parseTimestampForSort(entry)
+	entry := parser.NewEntry(map[string]any{"time": "1704067200"})
+	got := parseTimestampForSort(entry, nil)
 	want := time.Unix(1704067200, 0).UTC()
 	if !got.Equal(want) {
 		t.Errorf("got %v, want %v", got, want)
@@ -360,55 +828,100 @@ func TestParseTimestampForSort_UnixEpoch(t *testing.T) {
 }
 
 func TestParseTimestampForSort_AlternativeKey_Ts(t *testing.T) {
-	entry := parser.LogEntry{"ts": "2024-06-01T00:00:00Z"}
-	got := parseTimestampForSort(entry)
+	entry := parser.NewEntry(map[string]any{"ts": "2024-06-01T00:00:00Z"})
+	got := parseTimestampForSort(entry, nil)
 	if got.IsZero() {
 		t.Error("expected non-zero time for ts key")
 	}
 }
 
 func TestParseTimestampForSort_AlternativeKey_Timestamp(t *testing.T) {
-	entry := parser.LogEntry{"timestamp": "2024-06-01T00:00:00Z"}
-	got := parseTimestampForSort(entry)
+	entry := parser.NewEntry(map[string]any{"timestamp": "2024-06-01T00:00:00Z"})
+	got := parseTimestampForSort(entry, nil)
 	if got.IsZero() {
 		t.Error("expected non-zero time for timestamp key")
 	}
 }
 
 func TestParseTimestampForSort_NoTimestampField_ReturnsZero(t *testing.T) {
-	entry := parser.LogEntry{"level": "info", "msg": "hello"}
-	got := parseTimestampForSort(entry)
+	entry := parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})
+	got := parseTimestampForSort(entry, nil)
 	if !got.IsZero() {
 		t.Errorf("expected zero time, got %v", got)
 	}
 }
 
 func TestParseTimestampForSort_UnparsableValue_ReturnsZero(t *testing.T) {
-	entry := parser.LogEntry{"time": "not-a-timestamp"}
-	got := parseTimestampForSort(entry)
+	entry := parser.NewEntry(map[string]any{"time": "not-a-timestamp"})
+	got := parseTimestampForSort(entry, nil)
 	if !got.IsZero() {
 		t.Errorf("expected zero time for unparseable value, got %v", got)
 	}
 }
 
+func TestParseTimestampForSort_OffsetAndNaive(t *testing.T) {
+	loc := time.FixedZone("", -5*60*60)
+	want := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	for _, s := range []string{"2024-01-15T12:00:00+02:00", "2024-01-15 05:00:00"} {
+		if got := parseTimestampForSort(parser.NewEntry(map[string]any{"time": s}), loc); !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+// =============================================================================
+// parseZone
+// =============================================================================
+
+func TestParseZone(t *testing.T) {
+	at := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		offset int
+	}{
+		{"UTC", 0},
+		{"+02:00", 2 * 60 * 60},
+		{"-0530", -(5*60 + 30) * 60},
+		{"+09", 9 * 60 * 60},
+	}
+	for _, tt := range tests {
+		loc, err := parseZone(tt.name)
+		if err != nil {
+			t.Errorf("parseZone(%q) error: %v", tt.name, err)
+			continue
+		}
+		if _, offset := at.In(loc).Zone(); offset != tt.offset {
+			t.Errorf("parseZone(%q) offset = %d, want %d", tt.name, offset, tt.offset)
+		}
+	}
+	if loc, err := parseZone("Local"); err != nil || loc != time.Local {
+		t.Errorf("parseZone(Local) = %v, %v", loc, err)
+	}
+	for _, name := range []string{"+2:00", "+25:00", "Mars/Olympus_Mons"} {
+		if _, err := parseZone(name); err == nil {
+			t.Errorf("parseZone(%q) expected an error", name)
+		}
+	}
+}
+
 // =============================================================================
 // loadEntries
 // =============================================================================
 
 func TestLoadEntries_TagsSource(t *testing.T) {
 	r := strings.NewReader(`{"level":"info"}` + "\n")
-	got := loadEntries(r, parser.NewJSONParser(), "myfile.log")
+	got, _ := loadEntries(r, parser.NewJSONParser(), "myfile.log", nil)
 	if len(got) != 1 {
 		t.Fatalf("expected 1 entry, got %d", len(got))
 	}
-	if got[0].entry["_source"] != "myfile.log" {
-		t.Errorf("_source = %q, want %q", got[0].entry["_source"], "myfile.log")
+	if got[0].entry.Fields["_source"] != "myfile.log" {
+		t.Errorf("_source = %q, want %q", got[0].entry.Fields["_source"], "myfile.log")
 	}
 }
 
 func TestLoadEntries_ParsesTimestamp(t *testing.T) {
 	r := strings.NewReader(`{"time":"2024-03-01T10:00:00Z","level":"info"}` + "\n")
-	got := loadEntries(r, parser.NewJSONParser(), "svc.log")
+	got, _ := loadEntries(r, parser.NewJSONParser(), "svc.log", nil)
 	if len(got) != 1 {
 		t.Fatalf("expected 1 entry, got %d", len(got))
 	}
@@ -420,15 +933,39 @@ func TestLoadEntries_ParsesTimestamp(t *testing.T) {
 
 func TestLoadEntries_MultipleEntries(t *testing.T) {
 	r := strings.NewReader(`{"level":"info"}` + "\n" + `{"level":"error"}` + "\n")
-	got := loadEntries(r, parser.NewJSONParser(), "app.log")
+	got, _ := loadEntries(r, parser.NewJSONParser(), "app.log", nil)
 	if len(got) != 2 {
 		t.Fatalf("expected 2 entries, got %d", len(got))
 	}
 }
 
+func TestLoadEntries_ReturnsParseErrors(t *testing.T) {
+	r := strings.NewReader(`{"level":"info"}` + "\nnot json\n")
+	got, errs := loadEntries(r, parser.NewJSONParser(), "app.log", nil)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected 1 parse error, got %v", errs)
+	}
+}
+
+func TestLoadEntries_RawEntryFollowsPrecedingTimestamp(t *testing.T) {
+	r := strings.NewReader(`{"time":"2024-03-01T10:00:00Z"}` + "\npanic: boom\n")
+	p := parser.NewJSONParser()
+	p.OnError = parser.ErrorRaw
+	got, _ := loadEntries(r, p, "app.log", nil)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+	if !got[1].t.Equal(got[0].t) {
+		t.Errorf("raw entry t = %v, want %v", got[1].t, got[0].t)
+	}
+}
+
 func TestLoadEntries_EmptyReader(t *testing.T) {
 	r := strings.NewReader("")
-	got := loadEntries(r, parser.NewJSONParser(), "empty.log")
+	got, _ := loadEntries(r, parser.NewJSONParser(), "empty.log", nil)
 	if len(got) != 0 {
 		t.Errorf("expected 0 entries, got %d", len(got))
 	}
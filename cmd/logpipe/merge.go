@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// runMerge implements "logpipe merge [flags] file...".
+func runMerge(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	g.register(fs)
+	g.registerSinks(fs)
+	var wf windowFlags
+	wf.register(fs)
+	var rf replayFlags
+	rf.register(fs)
+	groupBy := groupByFlag(fs)
+	var sf slowestFlags
+	sf.register(fs)
+	sourceBreaks := fs.Bool("source-breaks", false, "Write a separator line naming the file, such as \"―――― worker.log ――――\", whenever the source changes from one entry to the next (text format only)")
+	quiet := quietFlag(fs)
+	grepExitSet := grepExitFlag(fs)
+	explainSet := explainFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe merge [flags] file|dir...\n\nInterleaves the entries of several files in timestamp order, tagging each\nwith its source file in the _source field. A directory stands for all of\nits logs and their rotated generations, compressed or not.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	ge := newGrepExit(*grepExitSet && !*quiet)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *groupBy != "" {
+		if err := checkGroupBy(wf, *quiet, false, g.splitBy != ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+	}
+	if err := sf.check(wf, *quiet, *groupBy, "", false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := rf.check(wf, *quiet, *groupBy, sf.n > 0, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := checkMarkGaps(g.markGaps, *groupBy, sf.n > 0); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	paths, err := mergePaths(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	win, err := wf.window()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg.replay = newPacer(rf, cfg.location)
+	if *sourceBreaks {
+		if g.format != "text" || len(g.values) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --source-breaks requires text output\n")
+			return ge.status(1)
+		}
+		if g.splitBy != "" {
+			fmt.Fprintf(os.Stderr, "Error: --source-breaks cannot be combined with --split-by\n")
+			return ge.status(1)
+		}
+		if *groupBy != "" {
+			fmt.Fprintf(os.Stderr, "Error: --source-breaks cannot be combined with --group-by\n")
+			return ge.status(1)
+		}
+		if sf.n > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --source-breaks cannot be combined with --slowest\n")
+			return ge.status(1)
+		}
+		cfg.formatter = breakSources(cfg.formatter, g.useColor())
+	}
+	if *explainSet {
+		explain(os.Stdout, cfg, plan{inputFormat: g.input, paths: paths, merge: true, quiet: *quiet, groupBy: *groupBy, slowest: sf, win: win})
+		return 0
+	}
+	if *quiet {
+		return quietMergeMode(cfg, g.input, paths)
+	}
+	if err := cfg.openOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	ge.watch(cfg)
+	return ge.status(cfg.closeOutput(mergeMode(cfg, g.input, paths, "", *groupBy, sf, win)))
+}
+
+// mergePaths returns the files to merge for args, which name files, glob
+// patterns of files or directories whose rotated logs are all merged.
+func mergePaths(args []string) ([]string, error) {
+	args, err := expandGlobs(args)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+			// Missing files are reported when they are opened.
+			paths = append(paths, arg)
+			continue
+		}
+		files, err := rotatedFiles(arg)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, files...)
+	}
+	return paths, nil
+}
+
+// mergeMode loads every entry of paths, sorts them by timestamp and either
+// prints the frequency table of statsField, when it is set, formats the
+// matching entries grouped by their value of groupBy, or the s.n of them
+// with the largest values of s.by, when those are set, or formats the
+// matching entries within win to stdout. A file whose parsing
+// stopped early, or under --strict any parse error or entry failing
+// --validate, makes it fail once the output has been written.
+func mergeMode(cfg *pipelineConfig, inputFormat string, paths []string, statsField, groupBy string, s slowestFlags, win window) int {
+	all, parseErrs, err := loadMerged(cfg, inputFormat, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	ch := make(chan *parser.LogEntry, len(all))
+	for _, me := range all {
+		ch <- me.entry
+	}
+	close(ch)
+
+	exitCode := 0
+	switch {
+	case statsField != "":
+		if err := tabulate(cfg, ch, statsField)(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exitCode = 1
+		}
+	case groupBy != "":
+		groups := groupEntries(ch, cfg.process, groupBy, cfg.location)
+		if writeGroups(os.Stdout, groups, groupBy, cfg.formatter) {
+			exitCode = 1
+		}
+	case s.n > 0:
+		top, skipped := topEntries(ch, cfg.process, s.by, s.n)
+		if writeTop(cfg, top, skipped, s.by) {
+			exitCode = 1
+		}
+	default:
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		entries, match := cfg.replay.paced(ctx, ch, cfg.process)
+		entries, match = cfg.align.aligned(ctx, entries, match)
+		if _, failed := emitWindow(os.Stdout, entries, match, cfg.formatter, win); failed {
+			exitCode = 1
+		}
+	}
+	for _, err := range parseErrs {
+		if cfg.stopsRun(err) {
+			exitCode = 1
+		}
+	}
+	if cfg.strict {
+		skipped := 0
+		for _, err := range parseErrs {
+			if cfg.skipsLine(err) {
+				skipped++
+			}
+		}
+		reportSkipped(os.Stderr, skipped)
+		cfg.validator.reportInvalid(os.Stderr)
+		if len(parseErrs) > 0 || cfg.validator.failed() > 0 {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// quietMergeMode is the merge counterpart of quietMode: it returns 0 if
+// any entry of paths matches cfg's filters, 1 if none does and 2 if a file
+// cannot be read.
+func quietMergeMode(cfg *pipelineConfig, inputFormat string, paths []string) int {
+	all, _, err := loadMerged(cfg, inputFormat, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	matched := false
+	for _, me := range all {
+		if !matched && cfg.process(me.entry) {
+			matched = true
+		}
+		parser.Release(me.entry)
+	}
+	if matched {
+		return 0
+	}
+	return 1
+}
+
+// loadMerged reads every entry of paths, each parsed as inputFormat ("auto"
+// to detect it per file), and returns them sorted by timestamp. Entries
+// without a recognisable timestamp sort first; ties keep file order.
+// Files compressed with gzip, zstd or bzip2 are decompressed. The
+// parse errors reported for the files, which have already been printed, are
+// returned alongside. Timestamps are compared as instants, so files written
+// with different UTC offsets interleave correctly.
+func loadMerged(cfg *pipelineConfig, inputFormat string, paths []string) ([]mergedEntry, []error, error) {
+	var all []mergedEntry
+	var parseErrs []error
+	for _, path := range paths {
+		f, err := input.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening %s: %w", path, err)
+		}
+		// Rotated generations are often compressed.
+		if f, err = input.Decompress(f); err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		r, p, _, err := cfg.parserFor(f, inputFormat, cfg.readOptsFor(path))
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		entries, errs := loadEntries(r, p, filepath.Base(path), cfg.location)
+		all = append(all, entries...)
+		parseErrs = append(parseErrs, errs...)
+		f.Close()
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].t.Before(all[j].t)
+	})
+	return all, parseErrs, nil
+}
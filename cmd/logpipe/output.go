@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// outputFile implements -output for the formats written to stdout. While
+// it is open os.Stdout is the file, so that everything a command prints,
+// entries, tables and summaries alike, goes to it. The file is replaced,
+// or with -append added to. With -atomic the output is written to a
+// temporary file beside it instead, which replaces it only once the run
+// has succeeded, so that nothing reading the file ever sees it half
+// written and a failed run leaves it as it was.
+type outputFile struct {
+	path              string
+	appending, atomic bool
+
+	file   *os.File
+	stdout *os.File // os.Stdout before open
+}
+
+// open creates the file, or the temporary file, and points os.Stdout at it.
+func (o *outputFile) open() error {
+	var f *os.File
+	var err error
+	switch {
+	case o.appending:
+		f, err = os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	case o.atomic:
+		f, err = os.CreateTemp(filepath.Dir(o.path), "."+filepath.Base(o.path)+".*.tmp")
+	default:
+		f, err = os.Create(o.path)
+	}
+	if err != nil {
+		return err
+	}
+	o.file, o.stdout = f, os.Stdout
+	os.Stdout = f
+	return nil
+}
+
+// close restores os.Stdout and closes the file. With -atomic it renames
+// the temporary file over the output file when ok is set, and removes it
+// otherwise.
+func (o *outputFile) close(ok bool) error {
+	if o == nil || o.file == nil {
+		return nil
+	}
+	os.Stdout = o.stdout
+	f := o.file
+	o.file = nil
+	if !o.atomic {
+		return f.Close()
+	}
+	if !ok {
+		f.Close()
+		return os.Remove(f.Name())
+	}
+	err := o.commit(f)
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", o.path, err)
+	}
+	return nil
+}
+
+// commit gives the temporary file f the permissions of the file it
+// replaces, or 0644 for a new one, and renames it over the file once its
+// contents are on disk.
+func (o *outputFile) commit(f *os.File) error {
+	perm := os.FileMode(0o644)
+	if fi, err := os.Stat(o.path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	err := f.Chmod(perm)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), o.path)
+}
+
+// openOutput points os.Stdout at the -output file of a format written to
+// stdout, if there is one, until closeOutput.
+func (cfg *pipelineConfig) openOutput() error {
+	if cfg.file == nil {
+		return nil
+	}
+	return cfg.file.open()
+}
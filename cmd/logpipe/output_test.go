@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// -output
+// =============================================================================
+
+// readOutput returns the contents of the file at path, failing the test
+// if it cannot be read.
+func readOutput(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRun_Output(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out := filepath.Join(t.TempDir(), "errors.log")
+	if err := os.WriteFile(out, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, code := runCapture(t, "view", "-format", "logfmt", "-filter", "level=error", "-output", out, path)
+	if code != 0 || stdout != "" {
+		t.Fatalf("stdout (exit %d) = %q, want nothing", code, stdout)
+	}
+	want := "time=2024-01-15T10:00:02Z level=error msg=b\ntime=2024-01-15T10:00:03Z level=error msg=c\n"
+	if got := readOutput(t, out); got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+}
+
+func TestRun_Output_Append(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out := filepath.Join(t.TempDir(), "errors.log")
+	for range 2 {
+		if _, code := runCapture(t, "view", "-format", "logfmt", "-filter", "msg=a", "-output", out, "-append", path); code != 0 {
+			t.Fatalf("exit code = %d", code)
+		}
+	}
+	want := "time=2024-01-15T10:00:01Z level=info msg=a\ntime=2024-01-15T10:00:01Z level=info msg=a\n"
+	if got := readOutput(t, out); got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+}
+
+func TestRun_Output_Atomic(t *testing.T) {
+	path := writeLog(t, cliLog)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "stats.txt")
+	if err := os.WriteFile(out, []byte("old\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	// A run that fails leaves the file as it was.
+	if _, code := runCapture(t, "view", "-output", out, "-atomic", filepath.Join(dir, "missing.log")); code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	if got := readOutput(t, out); got != "old\n" {
+		t.Errorf("file after a failed run = %q, want it unchanged", got)
+	}
+
+	if _, code := runCapture(t, "-file", path, "-stats", "level", "-output", out, "-atomic"); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if got := readOutput(t, out); got != "error: 2\ninfo: 1\n" {
+		t.Errorf("file = %q", got)
+	}
+	if fi, err := os.Stat(out); err != nil || fi.Mode().Perm() != 0o640 {
+		t.Errorf("file mode = %v (%v), want the replaced file's 0640", fi.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the output", len(entries))
+	}
+}
+
+func TestRun_Output_Errors(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out := filepath.Join(t.TempDir(), "out.log")
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-append", path}, 1},
+		{[]string{"view", "-output", out, "-append", "-atomic", path}, 1},
+		{[]string{"view", "-format", "parquet", "-output", out, "-atomic", path}, 1},
+		{[]string{"view", "-format", "loki", "-loki-url", "http://localhost:3100", "-output", out, path}, 1},
+		{[]string{"view", "-output", out, "-atomic", "-follow", path}, 1},
+		{[]string{"follow", "-output", out, "-atomic", path}, 2},
+		{[]string{"bench", "-output", out, "-file", path}, 2},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+func TestExplainOutput(t *testing.T) {
+	tests := []struct {
+		o    *outputFile
+		want string
+	}{
+		{nil, "stdout"},
+		{&outputFile{path: "out.log"}, "out.log, replaced"},
+		{&outputFile{path: "out.log", appending: true}, "out.log, appended to"},
+		{&outputFile{path: "out.log", atomic: true}, "out.log, replaced by a temporary file written beside it once the run has succeeded"},
+	}
+	for _, tt := range tests {
+		if got := explainOutput(tt.o); got != tt.want {
+			t.Errorf("explainOutput(%+v) = %q, want %q", tt.o, got, tt.want)
+		}
+	}
+}
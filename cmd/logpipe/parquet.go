@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tylermac92/logpipe/internal/parquet"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// parquetFormatter implements -format parquet: it writes entries as rows
+// of a Parquet file at path rather than to the writer it is given. The
+// entries are held until Close, which infers a schema that covers every
+// one of them and writes the file.
+type parquetFormatter struct {
+	path string
+	held []map[string]any
+}
+
+// newParquetFormatter returns the formatter for -format parquet writing to
+// path.
+func newParquetFormatter(path string) (*parquetFormatter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("--format parquet requires --output, as Parquet is written to a file")
+	}
+	return &parquetFormatter{path: path}, nil
+}
+
+// Format holds a copy of entry until Close.
+func (p *parquetFormatter) Format(_ io.Writer, entry *parser.LogEntry) error {
+	// A copy, as the entry is released once formatted, without the
+	// entry's record of its key order.
+	rec := make(map[string]any, entry.Len())
+	for _, k := range entry.Keys() {
+		rec[k] = entry.Fields[k]
+	}
+	p.held = append(p.held, rec)
+	return nil
+}
+
+// Close infers the schema of the held entries and writes them to the file.
+func (p *parquetFormatter) Close() error {
+	if err := p.write(); err != nil {
+		return fmt.Errorf("writing %s: %w", p.path, err)
+	}
+	return nil
+}
+
+// write does the work of Close.
+func (p *parquetFormatter) write() error {
+	f, err := os.Create(p.path)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(f)
+	w, err := parquet.NewWriter(buf, parquet.Infer(p.held))
+	if err == nil {
+		for _, rec := range p.held {
+			if err = w.Append(rec); err != nil {
+				break
+			}
+		}
+	}
+	p.held = nil
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
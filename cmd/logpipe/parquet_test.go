@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// -format parquet
+// =============================================================================
+
+func TestRun_FormatParquet(t *testing.T) {
+	path := writeLog(t, cliLog)
+	outPath := filepath.Join(t.TempDir(), "out.parquet")
+	out, code := runCapture(t, "view", "-format", "parquet", "-output", outPath, "-filter", "level=error", path)
+	if code != 0 || out != "" {
+		t.Fatalf("output (exit %d) = %q, want nothing on stdout", code, out)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")):
+		t.Errorf("output is not a Parquet file: %q", data)
+	case !bytes.Contains(data, []byte("2024-01-15T10:00:03Z")):
+		t.Error("the last matching entry's timestamp is missing from the column statistics")
+	case bytes.Contains(data, []byte("10:00:01")):
+		t.Error("an entry the filter rejects was written")
+	}
+}
+
+func TestRun_FormatParquet_Errors(t *testing.T) {
+	path := writeLog(t, cliLog)
+	outPath := filepath.Join(t.TempDir(), "out.parquet")
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-format", "parquet", path}, 1},
+		{[]string{"view", "-format", "parquet", "-output", outPath, "-schema", "entry.avsc", path}, 1},
+		{[]string{"view", "-format", "parquet", "-output", outPath, "-listen", "grpc://127.0.0.1:0"}, 1},
+		{[]string{"view", "-format", "parquet", "-output", outPath, "-follow", path}, 1},
+		{[]string{"follow", "-format", "parquet", path}, 2},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+	if _, err := os.Stat(outPath); err == nil {
+		t.Error("a failed run created the output file")
+	}
+}
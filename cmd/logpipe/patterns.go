@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tylermac92/logpipe/internal/drain"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// messageFields are the fields patterns clusters by default, in order of
+// preference, matching those the text formatter shows as the message.
+var messageFields = []string{"message", "msg", "text"}
+
+// patternOptions are the settings of a patterns run.
+type patternOptions struct {
+	field      string  // field to cluster; empty means the message
+	top        int     // print only the most frequent templates; 0 means all
+	similarity float64 // drain.Miner.Similarity
+	depth      int     // drain.Miner.Depth
+}
+
+// defaultPatternOptions returns the options of a patterns run given no
+// flags.
+func defaultPatternOptions() patternOptions {
+	return patternOptions{similarity: drain.DefaultSimilarity, depth: drain.DefaultDepth}
+}
+
+// register defines the patterns flags other than -file on fs.
+func (o *patternOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.field, "field", "", "Field whose values are clustered (default: the message, from message, msg or text)")
+	fs.IntVar(&o.top, "top", 0, "Print only the N most frequent templates (0 means all)")
+	fs.Float64Var(&o.similarity, "similarity", drain.DefaultSimilarity, "Fraction of tokens a message must share with a template to join it, from 0 to 1")
+	fs.IntVar(&o.depth, "depth", drain.DefaultDepth, "Depth of the clustering tree; messages are routed apart by their first depth-3 tokens")
+}
+
+// check validates the options.
+func (o *patternOptions) check() error {
+	switch {
+	case o.top < 0:
+		return fmt.Errorf("--top must not be negative")
+	case o.similarity < 0 || o.similarity > 1:
+		return fmt.Errorf("--similarity must be between 0 and 1")
+	case o.depth < 3:
+		return fmt.Errorf("--depth must be at least 3")
+	}
+	return nil
+}
+
+// runPatterns implements "logpipe patterns [flags] [file]".
+func runPatterns(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("patterns", flag.ContinueOnError)
+	g.registerInput(fs)
+	g.registerFilter(fs)
+	g.registerProfile(fs)
+	filePath := fs.String("file", "", "Path to log file (default: stdin)")
+	noIndex := fs.Bool("no-index", false, "Ignore the sidecar index written by 'logpipe index' and read the whole file")
+	var opts patternOptions
+	opts.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe patterns [flags] [file]\n\nGroups the messages of the matching entries into templates, such as\n\"connection to <*> failed after <*>ms\", and prints how many messages each\ntemplate covers, most frequent first.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	path, err := fileArg(fs, *filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if err := opts.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return patternsMode(cfg, g.input, path, opts, !*noIndex)
+}
+
+// patternsMode prints the templates of the messages of the entries of path
+// (stdin when empty) that match cfg's filters.
+func patternsMode(cfg *pipelineConfig, inputFormat, path string, opts patternOptions, useIndex bool) int {
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	entries, errs := src.p.Parse(src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+	clusters := collectPatterns(entries, cfg.process, opts)
+	failed := wait()
+	src.close()
+	printPatterns(os.Stdout, clusters, opts.top)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// collectPatterns drains the entries channel and clusters the messages of
+// those that satisfy match, or the values of opts.field when it is set.
+// Entries without one are left out. It returns the clusters, most frequent
+// first, and releases the entries back to the parser pool.
+func collectPatterns(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, opts patternOptions) []*drain.Cluster {
+	m := drain.New()
+	m.Similarity, m.Depth = opts.similarity, opts.depth
+	fields := messageFields
+	if opts.field != "" {
+		fields = []string{opts.field}
+	}
+	for entry := range entries {
+		if match(entry) {
+			for _, f := range fields {
+				if v, ok := entry.Fields[f]; ok {
+					m.Add(fmt.Sprintf("%v", v))
+					break
+				}
+			}
+		}
+		parser.Release(entry)
+	}
+	return m.Clusters()
+}
+
+// printPatterns writes one "count  template" line per cluster to w, with
+// the counts right-aligned, stopping after top lines when top is positive.
+func printPatterns(w io.Writer, clusters []*drain.Cluster, top int) {
+	if top > 0 && len(clusters) > top {
+		clusters = clusters[:top]
+	}
+	width := 0
+	if len(clusters) > 0 {
+		width = len(fmt.Sprint(clusters[0].Count))
+	}
+	for _, c := range clusters {
+		fmt.Fprintf(w, "%*d  %s\n", width, c.Count, c)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/internal/plugin"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// pluginHooks holds the hooks provided by the -plugin modules.
+type pluginHooks struct {
+	all        []*plugin.Plugin // every loaded plugin, in flag order
+	parse      *plugin.Plugin   // the plugin that parses input, if any
+	transforms []*plugin.Plugin // plugins with a transform hook, in flag order
+	format     *plugin.Plugin   // the plugin that formats output, if any
+}
+
+// loadPlugins loads the plugin modules at paths and sorts out their hooks.
+// At most one plugin may parse and at most one may format.
+func loadPlugins(paths []string) (*pluginHooks, error) {
+	h := &pluginHooks{}
+	for _, path := range paths {
+		p, err := plugin.Load(context.Background(), path)
+		if err != nil {
+			return nil, err
+		}
+		h.all = append(h.all, p)
+		if p.HasParse() {
+			if h.parse != nil {
+				return nil, fmt.Errorf("plugins %s and %s both parse input; use only one", h.parse.Name(), p.Name())
+			}
+			h.parse = p
+		}
+		if p.HasTransform() {
+			h.transforms = append(h.transforms, p)
+		}
+		if p.HasFormat() {
+			if h.format != nil {
+				return nil, fmt.Errorf("plugins %s and %s both format output; use only one", h.format.Name(), p.Name())
+			}
+			h.format = p
+		}
+	}
+	return h, nil
+}
+
+// parser returns the plugin that parses input, or nil. h may be nil.
+func (h *pluginHooks) parser() *plugin.Plugin {
+	if h == nil {
+		return nil
+	}
+	return h.parse
+}
+
+// transformsEntries reports whether any plugin transforms entries. h may
+// be nil.
+func (h *pluginHooks) transformsEntries() bool {
+	return h != nil && len(h.transforms) > 0
+}
+
+// formatter returns the plugin formatter, or f when no plugin formats.
+func (h *pluginHooks) formatter(f formatter.Formatter) formatter.Formatter {
+	if h.format == nil {
+		return f
+	}
+	return &plugin.Formatter{Plugin: h.format}
+}
+
+// transform passes entry through the transform hooks in order, before it
+// is matched, and reports whether to keep it. An entry that a transform
+// drops is not kept, nor is one a transform fails on; the failure is
+// reported on stderr.
+func (h *pluginHooks) transform(entry *parser.LogEntry) bool {
+	for _, p := range h.transforms {
+		keep, err := p.Transform(entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error transforming log: %v\n", err)
+			return false
+		}
+		if !keep {
+			return false
+		}
+	}
+	return true
+}
+
+// parserFor returns the parser for r, together with the reader it should
+// consume and the name of its format: the plugin parser when a plugin
+// parses input, and otherwise the parser detectParser chooses for
+// inputFormat.
+func (cfg *pipelineConfig) parserFor(r io.Reader, inputFormat string, opts parser.ReadOptions) (io.Reader, parser.ContextParser, string, error) {
+	if p := cfg.plugins.parser(); p != nil {
+		return r, p.Parser(opts), "plugin " + p.Name(), nil
+	}
+	r, p, format, err := detectParser(r, inputFormat, opts)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return r, cfg.withColumns(p), format, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cacheDir holds the compilation cache of the test plugins for the run.
+// The cache directory is fixed by the first plugin loaded, so it must
+// outlive the test that loads it.
+var cacheDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	if cacheDir, err = os.MkdirTemp("", "logpipe-plugin"); err != nil {
+		panic(err)
+	}
+	// Keep compiled test modules out of the user's cache directory.
+	os.Setenv("XDG_CACHE_HOME", cacheDir)
+	code := m.Run()
+	os.RemoveAll(cacheDir)
+	os.Exit(code)
+}
+
+// buildTestPlugin builds the plugin in the plugin package's testdata
+// directory name, skipping the test when the Go toolchain cannot build it.
+func buildTestPlugin(t *testing.T, name string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building a WebAssembly plugin is slow")
+	}
+	path := filepath.Join(t.TempDir(), name+".wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", path, ".")
+	cmd.Dir = filepath.Join("..", "..", "internal", "plugin", "testdata", name)
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot build test plugin: %s", out)
+	}
+	return path
+}
+
+// =============================================================================
+// -plugin
+// =============================================================================
+
+func TestPlugin_ParseTransformFormat(t *testing.T) {
+	wasm := buildTestPlugin(t, "upper")
+	path := writeLog(t, "INFO hello\nbogus\nINFO drop\nWARN bye\n")
+
+	t.Run("view", func(t *testing.T) {
+		out, code := runCapture(t, "view", "-plugin", wasm, path)
+		if code != 0 {
+			t.Fatalf("exit code = %d", code)
+		}
+		if out != "[info] HELLO\n[warn] BYE\n" {
+			t.Errorf("output = %q", out)
+		}
+	})
+
+	t.Run("filter sees transformed entries", func(t *testing.T) {
+		out, _ := runCapture(t, "view", "-plugin", wasm, "-filter", "msg=BYE", path)
+		if out != "[warn] BYE\n" {
+			t.Errorf("output = %q", out)
+		}
+	})
+
+	t.Run("explain", func(t *testing.T) {
+		out, _ := runCapture(t, "view", "-explain", "-plugin", wasm, path)
+		for _, want := range []string{"Format:    plugin upper\n", "Transform: plugin upper\n", "Formatter: plugin upper\n"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("input conflict", func(t *testing.T) {
+		if _, code := runCapture(t, "view", "-input", "json", "-plugin", wasm, path); code == 0 {
+			t.Error("expected -input json with a parser plugin to fail")
+		}
+	})
+
+	t.Run("two parsers", func(t *testing.T) {
+		if _, code := runCapture(t, "view", "-plugin", wasm, "-plugin", wasm, path); code == 0 {
+			t.Error("expected two parser plugins to fail")
+		}
+	})
+}
+
+func TestPlugin_TransformSkipsIndex(t *testing.T) {
+	wasm := buildTestPlugin(t, "relevel")
+	// The index records the levels as written, all but one of them info,
+	// which the plugin turns into warn.
+	path := writeIndexedLog(t)
+	out, code := runCapture(t, "view", "-plugin", wasm, "-filter", "level=warn", "-format", "json", path)
+	if n := strings.Count(out, "\n"); code != 0 || n != 199 {
+		t.Errorf("printed %d entries (exit %d), want 199", n, code)
+	}
+	out, _ = runCapture(t, "view", "-explain", "-plugin", wasm, "-filter", "level=warn", path)
+	if !strings.Contains(out, "Index:     not used with a transform plugin\n") {
+		t.Errorf("explain output:\n%s", out)
+	}
+}
+
+func TestPlugin_MissingModule(t *testing.T) {
+	if _, code := runCapture(t, "view", "-plugin", filepath.Join(t.TempDir(), "none.wasm"), os.DevNull); code == 0 {
+		t.Error("expected a missing plugin to fail")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configEnv names the environment variable that overrides the location of
+// the configuration file.
+const configEnv = "LOGPIPE_CONFIG"
+
+// configFile is the layout of logpipe's JSON configuration file.
+type configFile struct {
+	// Profiles maps each profile name to the global flags it stands for,
+	// as command-line arguments.
+	Profiles map[string][]string `json:"profiles,omitempty"`
+}
+
+// configPath returns the location of the configuration file: $LOGPIPE_CONFIG
+// when set, and otherwise logpipe/config.json in the user's configuration
+// directory ($XDG_CONFIG_HOME or ~/.config on Linux).
+func configPath() (string, error) {
+	if path := os.Getenv(configEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logpipe", "config.json"), nil
+}
+
+// loadConfig reads the configuration file. A missing file yields an empty
+// configuration.
+func loadConfig() (*configFile, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &configFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c configFile
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// saveConfig writes c to the configuration file, creating its directory if
+// needed. The file is replaced atomically.
+func saveConfig(c *configFile) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// profileFlagSet returns a flag set defining the flags a profile may
+// contain, bound to g: every global flag except -profile itself.
+func profileFlagSet(g *globalFlags, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	g.registerInput(fs)
+	g.registerFilter(fs)
+	g.registerOutput(fs)
+	return fs
+}
+
+// profileValue is the flag.Value for -profile. Setting it applies the named
+// profile's flags to g at that point of the command line, so flags given
+// later override the profile's and repeatable flags such as -filter add to
+// them.
+type profileValue struct {
+	g    *globalFlags
+	name string
+}
+
+// String implements flag.Value.
+func (p *profileValue) String() string {
+	if p == nil {
+		return ""
+	}
+	return p.name
+}
+
+// Set implements flag.Value by applying the profile called name.
+func (p *profileValue) Set(name string) error {
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	args, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	if err := profileFlagSet(p.g, name).Parse(args); err != nil {
+		return fmt.Errorf("profile %q: %v", name, err)
+	}
+	p.name = name
+	return nil
+}
+
+// runProfile implements "logpipe profile list|save|delete".
+func runProfile(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: logpipe profile list
+       logpipe profile save name [global flags]
+       logpipe profile delete name
+
+Manages named bundles of global flags, stored in the configuration file
+(%s overrides its location). "logpipe -profile name ..." applies a
+profile's flags as if they had been typed in its place.
+
+For example:
+
+  logpipe profile save incident -filter level=error -fields time,msg,request_id -color
+  logpipe view -profile incident app.log
+`, configEnv)
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	switch sub, rest := fs.Arg(0), fs.Args()[1:]; sub {
+	case "list":
+		return profileList(rest)
+	case "save":
+		return profileSave(rest)
+	case "delete":
+		return profileDelete(rest)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown profile command %q (want list, save or delete)\n", sub)
+		return 2
+	}
+}
+
+// profileList prints each saved profile's name and flags.
+func profileList(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Usage: logpipe profile list\n")
+		return 2
+	}
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, name := range profileNames(c) {
+		fmt.Printf("%s\t%s\n", name, strings.Join(c.Profiles[name], " "))
+	}
+	return 0
+}
+
+// profileSave stores the global flags in args[1:] as the profile args[0],
+// replacing any profile of that name.
+func profileSave(args []string) int {
+	if len(args) == 0 || args[0] == "" || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "Usage: logpipe profile save name [global flags]\n")
+		return 2
+	}
+	name, flags := args[0], args[1:]
+
+	// Check that the flags parse and form a valid configuration before
+	// saving them.
+	check := newGlobalFlags()
+	fs := profileFlagSet(check, name)
+	if err := fs.Parse(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: a profile holds only flags, not %q\n", fs.Arg(0))
+		return 2
+	}
+	if _, err := check.config(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if c.Profiles == nil {
+		c.Profiles = make(map[string][]string)
+	}
+	c.Profiles[name] = append([]string{}, flags...)
+	if err := saveConfig(c); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: saving profile: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// profileDelete removes the profile args[0].
+func profileDelete(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: logpipe profile delete name\n")
+		return 2
+	}
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if _, ok := c.Profiles[args[0]]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown profile %q\n", args[0])
+		return 1
+	}
+	delete(c.Profiles, args[0])
+	if err := saveConfig(c); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: saving profiles: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// profileNames returns the names of c's profiles in sorted order.
+func profileNames(c *configFile) []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useConfig points the configuration file at a fresh temporary path and
+// returns it.
+func useConfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "logpipe", "config.json")
+	t.Setenv(configEnv, path)
+	return path
+}
+
+// saveProfile runs "logpipe profile save" with args and fails the test if
+// it does not succeed.
+func saveProfile(t *testing.T, args ...string) {
+	t.Helper()
+	if _, code := runCapture(t, append([]string{"profile", "save"}, args...)...); code != 0 {
+		t.Fatalf("profile save %v: exit code %d", args, code)
+	}
+}
+
+// =============================================================================
+// Configuration file
+// =============================================================================
+
+func TestLoadConfig_MissingFile_Empty(t *testing.T) {
+	useConfig(t)
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Profiles) != 0 {
+		t.Errorf("profiles = %v, want none", c.Profiles)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	path := useConfig(t)
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	os.WriteFile(path, []byte("{not json"), 0o644)
+	if _, err := loadConfig(); err == nil {
+		t.Error("expected error for malformed configuration file")
+	}
+}
+
+func TestSaveConfig_RoundTrip(t *testing.T) {
+	useConfig(t)
+	want := &configFile{Profiles: map[string][]string{"a": {"-color"}}}
+	if err := saveConfig(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestConfigPath_Default(t *testing.T) {
+	t.Setenv(configEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/xdg")
+	path, err := configPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join("/tmp/xdg", "logpipe", "config.json") {
+		t.Errorf("configPath = %q", path)
+	}
+}
+
+// =============================================================================
+// -profile
+// =============================================================================
+
+func TestProfile_AppliesFlags(t *testing.T) {
+	useConfig(t)
+	saveProfile(t, "errs", "-filter", "level=error", "-format", "logfmt")
+	path := writeLog(t, cliLog)
+
+	out, code := runCapture(t, "view", "-profile", "errs", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := "time=2024-01-15T10:00:02Z level=error msg=b\ntime=2024-01-15T10:00:03Z level=error msg=c\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestProfile_LaterFlagsOverrideAndFiltersAdd(t *testing.T) {
+	useConfig(t)
+	saveProfile(t, "errs", "-filter", "level=error", "-format", "json")
+	path := writeLog(t, cliLog)
+
+	out, _ := runCapture(t, "-profile", "errs", "view", "-format", "logfmt", "-filter", "msg=c", path)
+	if out != "time=2024-01-15T10:00:03Z level=error msg=c\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestProfile_FromEnvironment(t *testing.T) {
+	useConfig(t)
+	saveProfile(t, "errs", "-filter", "level=error")
+	t.Setenv("LOGPIPE_PROFILE", "errs")
+	path := writeLog(t, cliLog)
+
+	if _, code := runCapture(t, "view", "-q", "-filter", "level=info", path); code != 1 {
+		t.Errorf("exit code = %d, want 1 (profile filter combined with level=info)", code)
+	}
+}
+
+func TestProfile_Unknown(t *testing.T) {
+	useConfig(t)
+	if _, code := runCapture(t, "view", "-profile", "nope", os.DevNull); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+// =============================================================================
+// logpipe profile
+// =============================================================================
+
+func TestProfileSave_Invalid(t *testing.T) {
+	useConfig(t)
+	tests := [][]string{
+		{},
+		{"-filter", "level=error"},
+		{"bad", "-limit", "5"},
+		{"bad", "-filter", "nooperator"},
+		{"bad", "-filter", "level=error", "app.log"},
+	}
+	for _, args := range tests {
+		if _, code := runCapture(t, append([]string{"profile", "save"}, args...)...); code != 2 {
+			t.Errorf("profile save %v: exit code = %d, want 2", args, code)
+		}
+	}
+	if c, _ := loadConfig(); len(c.Profiles) != 0 {
+		t.Errorf("profiles = %v, want none saved", c.Profiles)
+	}
+}
+
+func TestProfileList(t *testing.T) {
+	useConfig(t)
+	saveProfile(t, "b", "-color")
+	saveProfile(t, "a", "-filter", "level=error", "-fields", "time,msg")
+
+	out, code := runCapture(t, "profile", "list")
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := "a\t-filter level=error -fields time,msg\nb\t-color\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestProfileSave_Replaces(t *testing.T) {
+	useConfig(t)
+	saveProfile(t, "a", "-color")
+	saveProfile(t, "a", "-pretty")
+	out, _ := runCapture(t, "profile", "list")
+	if out != "a\t-pretty\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestProfileDelete(t *testing.T) {
+	useConfig(t)
+	saveProfile(t, "a", "-color")
+	if _, code := runCapture(t, "profile", "delete", "a"); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if out, _ := runCapture(t, "profile", "list"); out != "" {
+		t.Errorf("list after delete = %q", out)
+	}
+	if _, code := runCapture(t, "profile", "delete", "a"); code != 1 {
+		t.Errorf("deleting a missing profile: exit code = %d, want 1", code)
+	}
+}
+
+func TestProfile_UnknownSubcommand(t *testing.T) {
+	if _, code := runCapture(t, "profile", "rename"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestComplete_ProfileNames(t *testing.T) {
+	useConfig(t)
+	saveProfile(t, "incident", "-color")
+	saveProfile(t, "audit", "-pretty")
+
+	if got := complete([]string{"view", "-profile", "inc"}); !reflect.DeepEqual(got, []string{"incident"}) {
+		t.Errorf("complete(-profile inc) = %v, want [incident]", got)
+	}
+	if got := complete([]string{"profile", "delete", ""}); strings.Join(got, ",") != "audit,incident" {
+		t.Errorf("complete(profile delete) = %v", got)
+	}
+	if got := complete([]string{"profile", "s"}); !reflect.DeepEqual(got, []string{"save"}) {
+		t.Errorf("complete(profile s) = %v, want [save]", got)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// progressInterval is how often the progress bar is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+// progressBarWidth is the number of cells in the bar itself.
+const progressBarWidth = 24
+
+// progressMeter draws a progress bar on a terminal for a parse of total
+// bytes, redrawing it from the parser's counters until it is stopped.
+// Diagnostics written through it clear the bar first so that they are not
+// garbled by it. stop may be called on a nil meter.
+type progressMeter struct {
+	w     io.Writer
+	total int64
+	prog  *parser.Progress
+	start time.Time
+
+	mu    sync.Mutex
+	drawn bool // a bar is on screen
+
+	done     chan struct{}
+	finished chan struct{}
+	stopOnce sync.Once
+}
+
+// startProgress starts drawing the progress of prog through total bytes
+// on w.
+func startProgress(w io.Writer, total int64, prog *parser.Progress) *progressMeter {
+	m := &progressMeter{
+		w:        w,
+		total:    total,
+		prog:     prog,
+		start:    time.Now(),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// run redraws the bar every progressInterval until stop is called.
+func (m *progressMeter) run() {
+	defer close(m.finished)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			line := renderProgress(m.prog.Bytes.Load(), m.total, m.prog.Lines.Load(), time.Since(m.start))
+			fmt.Fprintf(m.w, "\r%s\033[K", line)
+			m.drawn = true
+			m.mu.Unlock()
+		}
+	}
+}
+
+// clear erases the bar if it is on screen. m.mu must be held.
+func (m *progressMeter) clear() {
+	if m.drawn {
+		io.WriteString(m.w, "\r\033[K")
+		m.drawn = false
+	}
+}
+
+// Write clears the bar and writes p; the bar is redrawn on the next tick.
+func (m *progressMeter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clear()
+	return m.w.Write(p)
+}
+
+// stop stops redrawing and erases the bar. It may be called more than once.
+func (m *progressMeter) stop() {
+	if m == nil {
+		return
+	}
+	m.stopOnce.Do(func() {
+		close(m.done)
+		<-m.finished
+		m.mu.Lock()
+		m.clear()
+		m.mu.Unlock()
+	})
+}
+
+// renderProgress returns the progress line for done of total bytes and
+// lines lines scanned in elapsed time, for example:
+//
+//	[#########...............]  38.2%  1.2M lines  410.5k lines/s  ETA 0:14
+func renderProgress(done, total, lines int64, elapsed time.Duration) string {
+	frac := 0.0
+	if total > 0 {
+		frac = min(float64(done)/float64(total), 1)
+	}
+	filled := int(frac * progressBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+
+	secs := elapsed.Seconds()
+	rate, eta := 0.0, "--:--"
+	if secs > 0 && done > 0 {
+		rate = float64(lines) / secs
+		remaining := float64(total-done) / (float64(done) / secs)
+		eta = formatETA(time.Duration(max(remaining, 0) * float64(time.Second)))
+	}
+	return fmt.Sprintf("[%s] %5.1f%%  %s lines  %s lines/s  ETA %s", bar, frac*100, formatCount(float64(lines)), formatCount(rate), eta)
+}
+
+// formatCount abbreviates n with a k, M or G suffix.
+func formatCount(n float64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fG", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", n/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fk", n/1e3)
+	default:
+		return fmt.Sprintf("%.0f", n)
+	}
+}
+
+// formatETA formats d as m:ss, or h:mm:ss from an hour up.
+func formatETA(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// columnsEnv returns the width given by $COLUMNS when f is a terminal, or 0
+// when f is not or the variable is unset or invalid.
+func columnsEnv(f *os.File) int {
+	n, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || n <= 0 || !isTerminal(f) {
+		return 0
+	}
+	return n
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
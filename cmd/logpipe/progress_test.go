@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// renderProgress
+// =============================================================================
+
+func TestRenderProgress_Halfway(t *testing.T) {
+	got := renderProgress(500, 1000, 2500, 2*time.Second)
+	want := "[############............]  50.0%  2.5k lines  1.2k lines/s  ETA 0:02"
+	if got != want {
+		t.Errorf("renderProgress = %q, want %q", got, want)
+	}
+}
+
+func TestRenderProgress_NothingRead(t *testing.T) {
+	got := renderProgress(0, 1000, 0, 0)
+	if !strings.Contains(got, "  0.0%") || !strings.HasSuffix(got, "ETA --:--") {
+		t.Errorf("renderProgress = %q", got)
+	}
+}
+
+func TestRenderProgress_ClampsPastTotal(t *testing.T) {
+	got := renderProgress(1500, 1000, 10, time.Second)
+	if !strings.Contains(got, "100.0%") || !strings.HasSuffix(got, "ETA 0:00") {
+		t.Errorf("renderProgress = %q", got)
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	tests := map[float64]string{
+		0:       "0",
+		999:     "999",
+		1500:    "1.5k",
+		2.25e6:  "2.2M",
+		3e9:     "3.0G",
+		12345.6: "12.3k",
+	}
+	for n, want := range tests {
+		if got := formatCount(n); got != want {
+			t.Errorf("formatCount(%v) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                         "0:00",
+		75 * time.Second:          "1:15",
+		time.Hour + 2*time.Minute: "1:02:00",
+	}
+	for d, want := range tests {
+		if got := formatETA(d); got != want {
+			t.Errorf("formatETA(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+// =============================================================================
+// progressMeter
+// =============================================================================
+
+func TestProgressMeter_WriteClearsBar(t *testing.T) {
+	var buf bytes.Buffer
+	m := &progressMeter{w: &buf, drawn: true}
+	m.Write([]byte("Error parsing log: x\n"))
+	if buf.String() != "\r\033[KError parsing log: x\n" {
+		t.Errorf("output = %q", buf.String())
+	}
+	buf.Reset()
+	m.Write([]byte("y\n"))
+	if buf.String() != "y\n" {
+		t.Errorf("output with no bar drawn = %q", buf.String())
+	}
+}
+
+func TestProgressMeter_StopNilAndTwice(t *testing.T) {
+	var nilMeter *progressMeter
+	nilMeter.stop()
+
+	var buf bytes.Buffer
+	m := startProgress(&buf, 100, &parser.Progress{})
+	m.stop()
+	m.stop()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// rebasedFormatter implements -rebase-time: it rewrites each entry's
+// timestamp as its offset from the timestamp of the first entry it
+// formats, such as +1.532s, before handing the entry to f. Entries without
+// a timestamp are passed on unchanged.
+type rebasedFormatter struct {
+	f      formatter.Formatter
+	loc    *time.Location
+	origin time.Time // zero until an entry with a timestamp is formatted
+}
+
+// Format rewrites entry's timestamp and formats it with r.f.
+func (r *rebasedFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	if key, t := timestampField(entry, r.loc); !t.IsZero() {
+		if r.origin.IsZero() {
+			r.origin = t
+		}
+		entry.Fields[key] = formatOffset(t.Sub(r.origin))
+	}
+	return r.f.Format(w, entry)
+}
+
+// formatOffset formats d as signed seconds with millisecond precision:
+// +0.000s, +1.532s, -0.250s.
+func formatOffset(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	return fmt.Sprintf("%s%d.%03ds", sign, d/time.Second, d%time.Second/time.Millisecond)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// timeDisplay is the value of -time-display: how text output shows each
+// entry's timestamp.
+type timeDisplay string
+
+const (
+	timeAbsolute timeDisplay = "absolute" // the time of day, as always
+	timeRelative timeDisplay = "relative" // how long before now, such as 3m ago
+	timeElapsed  timeDisplay = "elapsed"  // the offset from the first entry, such as +00:02:15
+)
+
+// parseTimeDisplay validates the value of -time-display.
+func parseTimeDisplay(s string) (timeDisplay, error) {
+	switch d := timeDisplay(s); d {
+	case timeAbsolute, timeRelative, timeElapsed:
+		return d, nil
+	}
+	return "", fmt.Errorf("invalid --time-display %q (want absolute, relative or elapsed)", s)
+}
+
+// relativeFormatter implements -time-display relative and elapsed: it
+// rewrites each entry's timestamp as how long before now it was, or as its
+// offset from the timestamp of the first entry it formats, before handing
+// the entry to f. Entries without a timestamp are passed on unchanged.
+// Now is when the entry is formatted, so that a followed file shows the
+// age of each entry as it arrives.
+type relativeFormatter struct {
+	f       formatter.Formatter
+	display timeDisplay
+	loc     *time.Location
+	now     func() time.Time
+	origin  time.Time // zero until an entry with a timestamp is formatted
+}
+
+// Format rewrites entry's timestamp and formats it with r.f.
+func (r *relativeFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	key, t := timestampField(entry, r.loc)
+	if t.IsZero() {
+		return r.f.Format(w, entry)
+	}
+	if r.display == timeRelative {
+		entry.Fields[key] = formatAge(r.now().Sub(t))
+	} else {
+		if r.origin.IsZero() {
+			r.origin = t
+		}
+		entry.Fields[key] = formatClock(t.Sub(r.origin))
+	}
+	return r.f.Format(w, entry)
+}
+
+// formatAge formats the age d of an entry in its largest whole unit,
+// right-aligned to the width of the time of day it replaces: "  3m ago",
+// " 12s ago", "  2d ago", or "in 5s" for an entry from the future. Ages
+// under a second are "now".
+func formatAge(d time.Duration) string {
+	ahead := d < 0
+	if ahead {
+		d = -d
+	}
+	var age string
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%8s", "now")
+	case d < time.Minute:
+		age = fmt.Sprintf("%ds", d/time.Second)
+	case d < time.Hour:
+		age = fmt.Sprintf("%dm", d/time.Minute)
+	case d < 24*time.Hour:
+		age = fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		age = fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	if ahead {
+		return fmt.Sprintf("%8s", "in "+age)
+	}
+	return fmt.Sprintf("%8s", age+" ago")
+}
+
+// formatClock formats d as signed hours, minutes and whole seconds:
+// +00:00:00, +00:02:15, -01:30:00.
+func formatClock(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d", sign, d/time.Hour, d%time.Hour/time.Minute, d%time.Minute/time.Second)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// -time-display
+// =============================================================================
+
+func TestRun_TimeDisplay(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","msg":"a"}
+{"time":"2024-01-15T12:02:15Z","msg":"b"}
+{"msg":"c"}
+{"time":"2024-01-15T09:59:30Z","msg":"d"}
+`)
+	out, code := runCapture(t, "view", "-time-display", "elapsed", "-fields", "none", path)
+	want := "+00:00:00 [     ] a\n+02:02:15 [     ] b\n" + "                [     ] c\n" + "-00:00:30 [     ] d\n"
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-time-display", "ago", path}, 1},
+		{[]string{"view", "-time-display", "relative", "-format", "json", path}, 1},
+		{[]string{"view", "-time-display", "elapsed", "-rebase-time", path}, 1},
+		{[]string{"view", "-time-display", "absolute", "-format", "json", path}, 0},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+func TestRelativeFormatter_Format(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 5, 0, 0, time.UTC)
+	r := &relativeFormatter{f: &formatter.LogfmtFormatter{}, display: timeRelative, loc: time.UTC, now: func() time.Time { return now }}
+	var buf bytes.Buffer
+	for _, entry := range []*parser.LogEntry{
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:02:00Z", "msg": "a"}),
+		parser.NewEntry(map[string]any{"ts": "2024-01-15T10:04:59.5Z", "msg": "b"}),
+		parser.NewEntry(map[string]any{"msg": "c"}),
+	} {
+		if err := r.Format(&buf, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "msg=a time=\"  3m ago\"\nmsg=b ts=\"     now\"\nmsg=c\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "     now"},
+		{999 * time.Millisecond, "     now"},
+		{12 * time.Second, " 12s ago"},
+		{3*time.Minute + 59*time.Second, "  3m ago"},
+		{5 * time.Hour, "  5h ago"},
+		{50 * time.Hour, "  2d ago"},
+		{400 * 24 * time.Hour, "400d ago"},
+		{-5 * time.Second, "   in 5s"},
+	}
+	for _, tt := range tests {
+		if got := formatAge(tt.d); got != tt.want {
+			t.Errorf("formatAge(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestFormatClock(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "+00:00:00"},
+		{2*time.Minute + 15*time.Second + 900*time.Millisecond, "+00:02:15"},
+		{-90 * time.Minute, "-01:30:00"},
+		{100 * time.Hour, "+100:00:00"},
+	}
+	for _, tt := range tests {
+		if got := formatClock(tt.d); got != tt.want {
+			t.Errorf("formatClock(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
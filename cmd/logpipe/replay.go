@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// replayFlags holds the -replay and -speed flags, which write the matching
+// entries at the pace their timestamps were recorded at.
+type replayFlags struct {
+	on    bool
+	speed string
+}
+
+// register defines the flags on fs.
+func (r *replayFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&r.on, "replay", false, "Write the matching entries with delays matching the gaps between their timestamps, replaying the log at its recorded pace")
+	fs.StringVar(&r.speed, "speed", "1x", "Pace of --replay relative to the recorded one: 10x is ten times faster, 0.5x half as fast")
+}
+
+// check reports an error if the flags are invalid or combined with flags
+// they cannot honour: -tail, -quiet, -group-by and -slowest, which write
+// nothing until the input ends, or -listen, whose input is already live.
+func (r replayFlags) check(wf windowFlags, quiet bool, groupBy string, slowest, listen bool) error {
+	if _, err := parseSpeed(r.speed); err != nil {
+		return err
+	}
+	switch {
+	case !r.on && r.speed != "1x":
+		return fmt.Errorf("--speed requires --replay")
+	case !r.on:
+		return nil
+	case wf.tail > 0:
+		return fmt.Errorf("--replay cannot be combined with --tail")
+	case quiet:
+		return fmt.Errorf("--replay cannot be combined with --quiet")
+	case groupBy != "":
+		return fmt.Errorf("--replay cannot be combined with --group-by")
+	case slowest:
+		return fmt.Errorf("--replay cannot be combined with --slowest")
+	case listen:
+		return fmt.Errorf("--replay cannot be combined with --listen, whose input is already live")
+	}
+	return nil
+}
+
+// parseSpeed parses a -speed value: a positive factor, optionally followed
+// by x, as in 10x or 0.5.
+func parseSpeed(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || f <= 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid --speed %q (want a positive factor such as 10x or 0.5x)", s)
+	}
+	return f, nil
+}
+
+// pacer delays entries so that the time between writing them is the time
+// between their timestamps, divided by speed.
+type pacer struct {
+	speed float64
+	loc   *time.Location
+	now   func() time.Time
+	// wait waits for d to pass, reporting false if ctx is done first.
+	wait func(ctx context.Context, d time.Duration) bool
+}
+
+// newPacer returns a pacer for the flags r, or nil without -replay.
+// Timestamps without a UTC offset are taken to be in loc.
+func newPacer(r replayFlags, loc *time.Location) *pacer {
+	if !r.on {
+		return nil
+	}
+	speed, _ := parseSpeed(r.speed) // checked by replayFlags.check
+	return &pacer{speed: speed, loc: loc, now: time.Now, wait: sleepContext}
+}
+
+// paced returns the entries to format and the filter to apply to them:
+// entries and match, or with a pacer, the entries satisfying match sent at
+// the pace of their timestamps, which need no further filtering.
+//
+// The first entry with a timestamp is sent at once, and each later one
+// when as long has passed since then as its timestamp is after the first
+// one's, divided by the speed. An entry with a timestamp earlier than one
+// already sent, or without a timestamp, follows the entry before it
+// without a delay. The channel is closed once entries is; after ctx is
+// done nothing more is sent, and the rest of entries is drained and
+// released.
+func (p *pacer) paced(ctx context.Context, entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool) (<-chan *parser.LogEntry, func(*parser.LogEntry) bool) {
+	if p == nil {
+		return entries, match
+	}
+	out := make(chan *parser.LogEntry)
+	go func() {
+		defer close(out)
+		var first, latest, start time.Time
+		ok := true
+		for entry := range entries {
+			if !ok || !match(entry) {
+				parser.Release(entry)
+				continue
+			}
+			if t := parseTimestampForSort(entry, p.loc); t.IsZero() {
+				// Sent straight after the entry before it.
+			} else if first.IsZero() {
+				first, latest, start = t, t, p.now()
+			} else if t.After(latest) {
+				latest = t
+				due := start.Add(time.Duration(float64(latest.Sub(first)) / p.speed))
+				if d := due.Sub(p.now()); d > 0 && !p.wait(ctx, d) {
+					parser.Release(entry)
+					ok = false
+					continue
+				}
+			}
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				parser.Release(entry)
+				ok = false
+			}
+		}
+	}()
+	return out, func(*parser.LogEntry) bool { return true }
+}
+
+// sleepContext waits for d to pass, reporting false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// pacer
+// =============================================================================
+
+func TestPacer_WaitsForTimestampGaps(t *testing.T) {
+	clock := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	p := &pacer{speed: 2, loc: time.UTC,
+		now: func() time.Time { return clock },
+		wait: func(_ context.Context, d time.Duration) bool {
+			waits = append(waits, d)
+			clock = clock.Add(d)
+			return true
+		}}
+	in := make(chan *parser.LogEntry, 8)
+	for _, e := range []*parser.LogEntry{
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "msg": "a"}),
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:02Z", "msg": "b"}),
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:01Z", "msg": "c"}), // out of order: no delay
+		parser.NewEntry(map[string]any{"msg": "d"}),                                 // no timestamp: no delay
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:05Z", "msg": "e", "level": "debug"}),
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:05Z", "msg": "f"}),
+	} {
+		in <- e
+	}
+	close(in)
+	out, match := p.paced(context.Background(), in, func(e *parser.LogEntry) bool { return e.Fields["level"] != "debug" })
+	var got []string
+	for e := range out {
+		if match(e) {
+			got = append(got, e.Fields["msg"].(string))
+		}
+	}
+	if want := []string{"a", "b", "c", "d", "f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if want := []time.Duration{time.Second, 1500 * time.Millisecond}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	for s, want := range map[string]float64{"1x": 1, "10x": 10, "0.5x": 0.5, "3": 3} {
+		if got, err := parseSpeed(s); err != nil || got != want {
+			t.Errorf("parseSpeed(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"0x", "-2x", "fast", "x", "Infx"} {
+		if _, err := parseSpeed(s); err == nil {
+			t.Errorf("parseSpeed(%q) succeeded, want an error", s)
+		}
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/internal/drain"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// reportOptions are the settings of a report run.
+type reportOptions struct {
+	output  string // file to write; empty means stdout
+	title   string // heading of the report; empty means the input's name
+	by      string // field whose most frequent values are listed
+	top     int    // length of the top messages and top values lists
+	entries int    // most notable entries listed in the table
+}
+
+// register defines the report flags other than -file on fs.
+func (o *reportOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "output", "", "HTML file to write (default: stdout)")
+	fs.StringVar(&o.title, "title", "", "Heading of the report (default: the name of the input)")
+	fs.StringVar(&o.by, "by", "service", "Field whose most frequent values are listed, such as a service name")
+	fs.IntVar(&o.top, "top", 10, "Number of messages and values in each top list")
+	fs.IntVar(&o.entries, "max-entries", 1000, "Most warnings and errors listed in the table of notable entries")
+}
+
+// check validates the options.
+func (o *reportOptions) check() error {
+	switch {
+	case o.top <= 0:
+		return fmt.Errorf("--top must be positive")
+	case o.entries < 0:
+		return fmt.Errorf("--max-entries must not be negative")
+	case o.by == "":
+		return fmt.Errorf("--by must name a field")
+	}
+	return nil
+}
+
+// runReport implements "logpipe report [flags] [file]".
+func runReport(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	g.registerInput(fs)
+	g.registerFilter(fs)
+	g.registerProfile(fs)
+	filePath := fs.String("file", "", "Path to log file (default: stdin)")
+	noIndex := fs.Bool("no-index", false, "Ignore the sidecar index written by 'logpipe index' and read the whole file")
+	var opts reportOptions
+	opts.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe report [flags] [file]\n\nWrites a self-contained HTML report on the matching entries: a summary,\na chart of levels over time, the most frequent messages and values of\n-by, and a filterable table of the warnings and errors.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	path, err := fileArg(fs, *filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if err := opts.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return reportMode(cfg, g.input, path, opts, !*noIndex)
+}
+
+// reportMode writes the HTML report on the entries of path (stdin when
+// empty) that match cfg's filters to opts.output.
+func reportMode(cfg *pipelineConfig, inputFormat, path string, opts reportOptions, useIndex bool) int {
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	entries, errs := src.p.Parse(src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+	rep := collectReport(entries, cfg.process, opts, cfg.location)
+	failed := wait()
+	src.close()
+
+	rep.Title = opts.title
+	if rep.Title == "" {
+		rep.Title = "stdin"
+		if path != "" {
+			rep.Title = filepath.Base(path)
+		}
+	}
+	rep.Generated = time.Now()
+	if err := writeReport(opts.output, rep); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// writeReport renders rep to the file called name, or to stdout when name
+// is empty.
+func writeReport(name string, rep *report) error {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, rep); err != nil {
+		return fmt.Errorf("rendering report: %w", err)
+	}
+	if name == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+// reportLevels are the classes entries are counted in by level, in the
+// order they are shown.
+var reportLevels = []string{"error", "warn", "info", "debug", "other"}
+
+// levelClass returns the class of reportLevels that level belongs to.
+func levelClass(level string) string {
+	switch strings.ToLower(level) {
+	case "error", "err", "fatal", "crit", "critical", "alert", "emergency":
+		return "error"
+	case "warn", "warning":
+		return "warn"
+	case "info", "information":
+		return "info"
+	case "debug", "trace":
+		return "debug"
+	default:
+		return "other"
+	}
+}
+
+// levelIndex returns the position of class in reportLevels.
+func levelIndex(class string) int {
+	for i, l := range reportLevels {
+		if l == class {
+			return i
+		}
+	}
+	return len(reportLevels) - 1
+}
+
+// levelFields are the fields a report takes an entry's level from, in
+// order of preference, matching those the text formatter shows.
+var levelFields = []string{"level", "lvl", "severity"}
+
+// firstValue returns the value of the first of fields that entry has, or
+// "" when it has none.
+func firstValue(entry *parser.LogEntry, fields []string) string {
+	for _, f := range fields {
+		if v, ok := entry.Fields[f]; ok {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return ""
+}
+
+// report holds what an HTML report shows.
+type report struct {
+	Title     string
+	Generated time.Time
+	Total     int
+	First     time.Time // zero when no entry has a timestamp
+	Last      time.Time
+	Levels    []levelCount
+	Timeline  *timeline // nil when no entry has a timestamp
+	By        string
+	Values    []statEntry
+	Messages  []*drain.Cluster
+	Notable   []notableEntry
+	// Unlisted counts the notable entries left out of Notable by
+	// --max-entries.
+	Unlisted int
+}
+
+// levelCount is how many entries there are of one class of level.
+type levelCount struct {
+	Class string
+	Count int
+}
+
+// notableEntry is a row of the report's table of warnings and errors.
+type notableEntry struct {
+	Time    string
+	Class   string
+	Level   string
+	Value   string // of the --by field
+	Message string
+	Line    string // the whole entry as logfmt
+}
+
+// collectReport drains entries and gathers the report on those that
+// satisfy match. Timestamps without a UTC offset are taken to be in loc.
+func collectReport(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, opts reportOptions, loc *time.Location) *report {
+	rep := &report{By: opts.by}
+	levels := make([]int, len(reportLevels))
+	values := make(map[string]int)
+	perSecond := make(map[int64][]int)
+	miner := drain.New()
+	lf := &formatter.LogfmtFormatter{}
+	var line bytes.Buffer
+
+	for entry := range entries {
+		if !match(entry) {
+			parser.Release(entry)
+			continue
+		}
+		rep.Total++
+		level := firstValue(entry, levelFields)
+		class := levelClass(level)
+		levels[levelIndex(class)]++
+		if v, ok := entry.Fields[opts.by]; ok {
+			values[fmt.Sprintf("%v", v)]++
+		}
+		message := firstValue(entry, messageFields)
+		if message != "" {
+			miner.Add(message)
+		}
+
+		key, t := timestampField(entry, loc)
+		if !t.IsZero() {
+			if rep.First.IsZero() || t.Before(rep.First) {
+				rep.First = t
+			}
+			if t.After(rep.Last) {
+				rep.Last = t
+			}
+			counts := perSecond[t.Unix()]
+			if counts == nil {
+				counts = make([]int, len(reportLevels))
+				perSecond[t.Unix()] = counts
+			}
+			counts[levelIndex(class)]++
+		}
+
+		if class == "error" || class == "warn" {
+			if len(rep.Notable) < opts.entries {
+				line.Reset()
+				lf.Format(&line, entry)
+				n := notableEntry{Class: class, Level: level, Message: message, Line: strings.TrimSuffix(line.String(), "\n")}
+				if key != "" {
+					n.Time = fmt.Sprintf("%v", entry.Fields[key])
+				}
+				if v, ok := entry.Fields[opts.by]; ok {
+					n.Value = fmt.Sprintf("%v", v)
+				}
+				rep.Notable = append(rep.Notable, n)
+			} else {
+				rep.Unlisted++
+			}
+		}
+		parser.Release(entry)
+	}
+
+	for i, n := range levels {
+		rep.Levels = append(rep.Levels, levelCount{reportLevels[i], n})
+	}
+	for v, n := range values {
+		rep.Values = append(rep.Values, statEntry{v, n})
+	}
+	sort.Slice(rep.Values, func(i, j int) bool {
+		if rep.Values[i].Count != rep.Values[j].Count {
+			return rep.Values[i].Count > rep.Values[j].Count
+		}
+		return rep.Values[i].Value < rep.Values[j].Value
+	})
+	if len(rep.Values) > opts.top {
+		rep.Values = rep.Values[:opts.top]
+	}
+	rep.Messages = miner.Clusters()
+	if len(rep.Messages) > opts.top {
+		rep.Messages = rep.Messages[:opts.top]
+	}
+	if len(perSecond) > 0 {
+		rep.Timeline = newTimeline(perSecond, rep.First, rep.Last)
+	}
+	return rep
+}
+
+// Dimensions of the timeline chart, in SVG user units.
+const (
+	chartWidth   = 900
+	chartHeight  = 220
+	chartLeft    = 50 // room for the axis labels
+	chartBottom  = 20
+	maxChartBars = 60
+)
+
+// bucketWidths are the widths the timeline's buckets may have, the first
+// one that keeps the number of bars within maxChartBars being used.
+var bucketWidths = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// timeline is a stacked bar chart of the entries in each bucket of time,
+// by class of level, laid out for SVG.
+type timeline struct {
+	Width, Height int
+	Left, Bottom  int // the chart area's left and bottom edges
+	Bucket        time.Duration
+	Max           int // the count the top of the chart stands for
+	Bars          []timelineBar
+	Start, End    string // labels for the ends of the time axis
+}
+
+// timelineBar is one bucket of a timeline.
+type timelineBar struct {
+	X, Width int
+	Title    string // tooltip: the bucket's start and counts
+	Segments []timelineSegment
+}
+
+// timelineSegment is the part of a bar standing for one class of level.
+type timelineSegment struct {
+	Class     string
+	Y, Height int
+}
+
+// newTimeline buckets the counts of each second, keyed by Unix time, from
+// first to last into a timeline.
+func newTimeline(perSecond map[int64][]int, first, last time.Time) *timeline {
+	bucket := bucketWidths[len(bucketWidths)-1]
+	for _, w := range bucketWidths {
+		if last.Sub(first.Truncate(w))/w < maxChartBars {
+			bucket = w
+			break
+		}
+	}
+	for last.Sub(first.Truncate(bucket))/bucket >= maxChartBars {
+		bucket *= 2
+	}
+	start := first.Truncate(bucket)
+	n := int(last.Sub(start)/bucket) + 1
+	counts := make([][]int, n)
+	for i := range counts {
+		counts[i] = make([]int, len(reportLevels))
+	}
+	for sec, c := range perSecond {
+		i := int(time.Unix(sec, 0).Sub(start) / bucket)
+		for j, k := range c {
+			counts[i][j] += k
+		}
+	}
+
+	tl := &timeline{Width: chartWidth, Height: chartHeight, Left: chartLeft, Bottom: chartHeight - chartBottom, Bucket: bucket}
+	for _, c := range counts {
+		total := 0
+		for _, k := range c {
+			total += k
+		}
+		tl.Max = max(tl.Max, total)
+	}
+	area := tl.Bottom - 10
+	slot := (chartWidth - chartLeft) / n
+	for i, c := range counts {
+		bar := timelineBar{X: chartLeft + i*slot + 1, Width: max(slot-2, 1)}
+		y := tl.Bottom
+		var parts []string
+		for j, k := range c {
+			if k == 0 {
+				continue
+			}
+			h := max(k*area/tl.Max, 1)
+			y -= h
+			bar.Segments = append(bar.Segments, timelineSegment{Class: reportLevels[j], Y: y, Height: h})
+			parts = append(parts, fmt.Sprintf("%s %d", reportLevels[j], k))
+		}
+		bar.Title = start.Add(time.Duration(i) * bucket).UTC().Format(time.RFC3339)
+		if len(parts) > 0 {
+			bar.Title += ": " + strings.Join(parts, ", ")
+		}
+		tl.Bars = append(tl.Bars, bar)
+	}
+	tl.Start = start.UTC().Format(time.RFC3339)
+	tl.End = start.Add(time.Duration(n) * bucket).UTC().Format(time.RFC3339)
+	return tl
+}
+
+// reportTemplate renders a report as a single HTML page with no external
+// resources, so that it can be attached to a ticket or postmortem as is.
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"rfc3339": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}).Parse(reportHTML))
+
+const reportHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} – logpipe report</title>
+<style>
+body { font: 14px/1.4 system-ui, sans-serif; margin: 2em auto; max-width: 1100px; color: #222; padding: 0 1em; }
+h1 { margin-bottom: 0; }
+.meta { color: #666; margin-top: .2em; }
+.cards { display: flex; flex-wrap: wrap; gap: 1em; margin: 1.5em 0; }
+.card { border: 1px solid #ddd; border-radius: 6px; padding: .6em 1em; min-width: 7em; }
+.card b { display: block; font-size: 1.6em; }
+.columns { display: flex; flex-wrap: wrap; gap: 2em; }
+.columns section { flex: 1; min-width: 20em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .25em .5em; border-bottom: 1px solid #eee; vertical-align: top; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+code, .line { font-family: ui-monospace, monospace; font-size: 12px; }
+.line { color: #666; word-break: break-all; }
+.error { fill: #d62728; color: #d62728; }
+.warn { fill: #e6a700; color: #b38300; }
+.info { fill: #2ca02c; color: #2ca02c; }
+.debug { fill: #9e9e9e; color: #777; }
+.other { fill: #1f77b4; color: #1f77b4; }
+svg text { fill: #666; font-size: 11px; }
+.filters { margin: .5em 0; display: flex; gap: .5em; }
+.filters input { flex: 1; padding: .3em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated by logpipe at {{rfc3339 .Generated}}{{if not .First.IsZero}}, covering {{rfc3339 .First}} to {{rfc3339 .Last}}{{end}}</p>
+
+<div class="cards">
+<div class="card">entries<b>{{.Total}}</b></div>
+{{- range .Levels}}{{if .Count}}
+<div class="card {{.Class}}">{{.Class}}<b>{{.Count}}</b></div>
+{{- end}}{{end}}
+</div>
+
+{{with .Timeline}}
+<h2>Levels over time</h2>
+<svg viewBox="0 0 {{.Width}} {{.Height}}" width="100%" role="img" aria-label="entries per {{.Bucket}} by level">
+<line x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Width}}" y2="{{.Bottom}}" stroke="#ccc"/>
+<text x="{{.Left}}" y="10" text-anchor="end" dx="-4">{{.Max}}</text>
+<text x="{{.Left}}" y="{{.Bottom}}" text-anchor="end" dx="-4">0</text>
+{{- range .Bars}}
+<g><title>{{.Title}}</title>{{$x := .X}}{{$w := .Width}}{{range .Segments}}<rect class="{{.Class}}" x="{{$x}}" y="{{.Y}}" width="{{$w}}" height="{{.Height}}"/>{{end}}</g>
+{{- end}}
+<text x="{{.Left}}" y="{{.Height}}">{{.Start}}</text>
+<text x="{{.Width}}" y="{{.Height}}" text-anchor="end">{{.End}}</text>
+</svg>
+<p class="meta">Each bar is {{.Bucket}}.</p>
+{{end}}
+
+<div class="columns">
+<section>
+<h2>Top messages</h2>
+<table>
+<tr><th>count</th><th>template</th></tr>
+{{- range .Messages}}
+<tr><td class="n">{{.Count}}</td><td><code>{{.String}}</code></td></tr>
+{{- else}}
+<tr><td colspan="2">No messages.</td></tr>
+{{- end}}
+</table>
+</section>
+<section>
+<h2>Top {{.By}}</h2>
+<table>
+<tr><th>count</th><th>{{.By}}</th></tr>
+{{- range .Values}}
+<tr><td class="n">{{.Count}}</td><td>{{.Value}}</td></tr>
+{{- else}}
+<tr><td colspan="2">No entries have a {{.By}} field.</td></tr>
+{{- end}}
+</table>
+</section>
+</div>
+
+<h2>Warnings and errors</h2>
+{{- if .Notable}}
+<div class="filters">
+<input id="q" type="search" placeholder="Filter entries" oninput="filterRows()">
+<select id="level" onchange="filterRows()"><option value="">all levels</option><option value="error">errors</option><option value="warn">warnings</option></select>
+</div>
+<table id="notable">
+<tr><th>time</th><th>level</th><th>{{.By}}</th><th>message</th></tr>
+{{- range .Notable}}
+<tr data-class="{{.Class}}"><td>{{.Time}}</td><td class="{{.Class}}">{{.Level}}</td><td>{{.Value}}</td><td>{{.Message}}<div class="line">{{.Line}}</div></td></tr>
+{{- end}}
+</table>
+{{- if .Unlisted}}
+<p class="meta">{{.Unlisted}} more not listed; raise -max-entries to include them.</p>
+{{- end}}
+<script>
+function filterRows() {
+  var q = document.getElementById("q").value.toLowerCase();
+  var level = document.getElementById("level").value;
+  var rows = document.querySelectorAll("#notable tr[data-class]");
+  for (var i = 0; i < rows.length; i++) {
+    var r = rows[i];
+    var show = (!level || r.dataset.class === level) && r.textContent.toLowerCase().indexOf(q) >= 0;
+    r.style.display = show ? "" : "none";
+  }
+}
+</script>
+{{- else}}
+<p>No warnings or errors.</p>
+{{- end}}
+</body>
+</html>
+`
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// report
+// =============================================================================
+
+func TestNewTimeline_BucketWidth(t *testing.T) {
+	first := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		span time.Duration
+		want time.Duration
+	}{
+		{30 * time.Second, time.Second},
+		{5 * time.Minute, 10 * time.Second},
+		{2 * time.Hour, 5 * time.Minute},
+		{100 * 24 * time.Hour, 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		last := first.Add(tt.span)
+		perSecond := map[int64][]int{first.Unix(): {1, 0, 0, 0, 0}, last.Unix(): {0, 0, 2, 0, 0}}
+		tl := newTimeline(perSecond, first, last)
+		if tl.Bucket != tt.want {
+			t.Errorf("span %s: bucket = %s, want %s", tt.span, tl.Bucket, tt.want)
+		}
+		if len(tl.Bars) > maxChartBars {
+			t.Errorf("span %s: %d bars, want at most %d", tt.span, len(tl.Bars), maxChartBars)
+		}
+		if tl.Max != 2 {
+			t.Errorf("span %s: max = %d, want 2", tt.span, tl.Max)
+		}
+	}
+}
+
+func TestCollectReport_Sections(t *testing.T) {
+	at := func(s string) string { return "2024-01-15T10:" + s + "Z" }
+	ch := makeEntries(
+		parser.NewEntry(map[string]any{"time": at("00:00"), "level": "info", "service": "api", "msg": "user 1 logged in"}),
+		parser.NewEntry(map[string]any{"time": at("00:05"), "level": "INFO", "service": "api", "msg": "user 2 logged in"}),
+		parser.NewEntry(map[string]any{"time": at("00:07"), "level": "WARNING", "service": "web", "msg": "cache miss"}),
+		parser.NewEntry(map[string]any{"time": at("00:31"), "level": "crit", "service": "pay", "msg": "payment declined"}),
+		parser.NewEntry(map[string]any{"time": at("00:12"), "level": "trace", "service": "api", "msg": "user 3 logged in"}),
+		parser.NewEntry(map[string]any{"severity": "notice", "service": "pay", "msg": "user 4 logged in"}),
+		parser.NewEntry(map[string]any{"time": at("01:00"), "level": "debug", "service": "web", "msg": "dropped"}),
+		parser.NewEntry(map[string]any{"time": at("02:30"), "lvl": "err", "service": "web", "msg": "payment declined"}),
+	)
+	match := func(e *parser.LogEntry) bool { return e.Fields["msg"] != "dropped" }
+	rep := collectReport(ch, match, reportOptions{by: "service", top: 2, entries: 2}, time.UTC)
+
+	if rep.Total != 7 {
+		t.Errorf("total = %d, want 7", rep.Total)
+	}
+	wantLevels := []levelCount{{"error", 2}, {"warn", 1}, {"info", 2}, {"debug", 1}, {"other", 1}}
+	if !reflect.DeepEqual(rep.Levels, wantLevels) {
+		t.Errorf("levels = %v, want %v", rep.Levels, wantLevels)
+	}
+	// web and pay tie at 2 and are listed by value; -top 2 leaves out web.
+	wantValues := []statEntry{{"api", 3}, {"pay", 2}}
+	if !reflect.DeepEqual(rep.Values, wantValues) {
+		t.Errorf("values = %v, want %v", rep.Values, wantValues)
+	}
+	var messages []string
+	for _, c := range rep.Messages {
+		messages = append(messages, fmt.Sprintf("%d %s", c.Count, c))
+	}
+	if want := []string{"4 user <*> logged in", "2 payment declined"}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+	if got, want := rep.First.Format(time.RFC3339), at("00:00"); got != want {
+		t.Errorf("first = %s, want %s", got, want)
+	}
+	if got, want := rep.Last.Format(time.RFC3339), at("02:30"); got != want {
+		t.Errorf("last = %s, want %s", got, want)
+	}
+	wantNotable := []notableEntry{
+		{Time: at("00:07"), Class: "warn", Level: "WARNING", Value: "web", Message: "cache miss", Line: `level=WARNING msg="cache miss" service=web time=` + at("00:07")},
+		{Time: at("00:31"), Class: "error", Level: "crit", Value: "pay", Message: "payment declined", Line: `level=crit msg="payment declined" service=pay time=` + at("00:31")},
+	}
+	if !reflect.DeepEqual(rep.Notable, wantNotable) || rep.Unlisted != 1 {
+		t.Errorf("notable = %+v with %d unlisted, want %+v with 1", rep.Notable, rep.Unlisted, wantNotable)
+	}
+
+	// 150 seconds take 5-second buckets, each titled with its counts.
+	tl := rep.Timeline
+	if tl == nil {
+		t.Fatal("timeline = nil")
+	}
+	if tl.Bucket != 5*time.Second || len(tl.Bars) != 31 || tl.Max != 2 {
+		t.Fatalf("timeline has %d bars of %s up to %d, want 31 of 5s up to 2", len(tl.Bars), tl.Bucket, tl.Max)
+	}
+	for i, want := range map[int]string{
+		0:  at("00:00") + ": info 1",
+		1:  at("00:05") + ": warn 1, info 1",
+		2:  at("00:10") + ": debug 1",
+		3:  at("00:15"),
+		6:  at("00:30") + ": error 1",
+		30: at("02:30") + ": error 1",
+	} {
+		if got := tl.Bars[i].Title; got != want {
+			t.Errorf("bar %d title = %q, want %q", i, got, want)
+		}
+	}
+	// Each of the two entries in bar 1 takes half the chart's height.
+	wantSegments := []timelineSegment{{"warn", 105, 95}, {"info", 10, 95}}
+	if got := tl.Bars[1].Segments; !reflect.DeepEqual(got, wantSegments) {
+		t.Errorf("bar 1 segments = %v, want %v", got, wantSegments)
+	}
+}
+
+func TestRun_Report(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","level":"info","msg":"started","service":"api"}
+{"time":"2024-01-15T10:02:01Z","level":"warning","msg":"slow request 1500ms","service":"api"}
+{"time":"2024-01-15T10:05:01Z","level":"error","msg":"payment <b>declined</b>","service":"pay"}
+{"time":"2024-01-15T10:05:02Z","level":"error","msg":"payment <b>declined</b>","service":"pay"}
+`)
+	out := filepath.Join(t.TempDir(), "report.html")
+	if _, code := runCapture(t, "report", "-output", out, "-title", "Incident 42", "-max-entries", "2", path); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+	for _, want := range []string{
+		"<h1>Incident 42</h1>",
+		`<div class="card error">error<b>2</b></div>`,
+		`<tr><td class="n">2</td><td>pay</td></tr>`,
+		`<code>payment &lt;b&gt;declined&lt;/b&gt;</code>`,
+		`<rect class="warn"`,
+		"1 more not listed",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+	if strings.Contains(html, "<b>declined") {
+		t.Error("report contains an unescaped message")
+	}
+
+	stdout, code := runCapture(t, "report", "-filter", "level=debug", path)
+	if code != 0 || !strings.Contains(stdout, "No warnings or errors.") {
+		t.Errorf("report to stdout (exit %d) does not say there are no warnings", code)
+	}
+	if _, code := runCapture(t, "report", "-top", "0", path); code != 2 {
+		t.Errorf("-top 0: exit code = %d, want 2", code)
+	}
+}
+
+func TestRun_Report_EscapesLogContent(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T10:00:00Z","level":"error","<em>team</em>":"<script>alert(1)</script>","msg":"<img src=x onerror=alert(1)>","note":"\"quoted\" & 'single'"}
+`)
+	html, code := runCapture(t, "report", "-by", "<em>team</em>", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	for _, want := range []string{
+		// The -by field's name, in the headings of its list and the table.
+		`<h2>Top &lt;em&gt;team&lt;/em&gt;</h2>`,
+		`<th>&lt;em&gt;team&lt;/em&gt;</th>`,
+		// Its value, in the list and the table.
+		`<td>&lt;script&gt;alert(1)&lt;/script&gt;</td>`,
+		// The message, as a template and in the table.
+		`<code>&lt;img src=x onerror=alert(1)&gt;</code>`,
+		`<td>&lt;img src=x onerror=alert(1)&gt;<div class="line">`,
+		// Quotes and ampersands of other fields, in the entry's line.
+		`note=&#34;\&#34;quoted\&#34; &amp; &#39;single&#39;&#34;</div>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+	// The only script is the report's own filter.
+	if n := strings.Count(html, "<script"); n != 1 {
+		t.Errorf("report has %d script elements, want 1", n)
+	}
+	for _, raw := range []string{"<img", "<em>", `"quoted"`} {
+		if strings.Contains(html, raw) {
+			t.Errorf("report contains unescaped %q", raw)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rotation suffixes, after any ".gz": a generation number as logrotate
+// and most loggers add (app.log.1), or a date as with logrotate's dateext
+// (app.log-20240115, app.log.2024-01-15).
+var (
+	generationSuffix = regexp.MustCompile(`^(.+)\.(\d+)$`)
+	dateSuffix       = regexp.MustCompile(`^(.+)[.-](\d{8}|\d{4}-\d{2}-\d{2})$`)
+)
+
+// rotatedFile is a file of a directory given to -merge-dir, with where it
+// stands among the generations of its log.
+type rotatedFile struct {
+	path string
+	base string // the name of the log without its rotation suffix
+	// class and n order the generations of a log, oldest first: dated ones
+	// by date, then numbered ones from the highest number, then the live
+	// file.
+	class int // 0 dated, 1 numbered, 2 live
+	n     int // the date as YYYYMMDD, or the negated generation number
+}
+
+// parseRotated returns the rotatedFile for the file name in dir.
+func parseRotated(dir, name string) rotatedFile {
+	rf := rotatedFile{path: filepath.Join(dir, name), class: 2}
+	base := strings.TrimSuffix(name, ".gz")
+	rf.base = base
+	if m := dateSuffix.FindStringSubmatch(base); m != nil {
+		digits := strings.ReplaceAll(m[2], "-", "")
+		if _, err := time.Parse("20060102", digits); err == nil {
+			rf.base, rf.class = m[1], 0
+			rf.n, _ = strconv.Atoi(digits)
+			return rf
+		}
+	}
+	if m := generationSuffix.FindStringSubmatch(base); m != nil {
+		if n, err := strconv.Atoi(m[2]); err == nil {
+			rf.base, rf.class, rf.n = m[1], 1, -n
+		}
+	}
+	return rf
+}
+
+// rotatedFiles returns the log files of dir for -merge-dir: each log's
+// rotated generations, compressed or not, oldest first, followed by the
+// live file, with the logs in name order. Hidden files, subdirectories and
+// the sidecar indexes written by "logpipe index" are left out.
+func rotatedFiles(dir string) ([]string, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []rotatedFile
+	for _, de := range des {
+		name := de.Name()
+		if !de.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".lpidx") {
+			continue
+		}
+		files = append(files, parseRotated(dir, name))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s has no log files", dir)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		switch {
+		case a.base != b.base:
+			return a.base < b.base
+		case a.class != b.class:
+			return a.class < b.class
+		case a.n != b.n:
+			return a.n < b.n
+		}
+		// The same generation both compressed and not: take the names in order.
+		return a.path < b.path
+	})
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRotated writes each of files, by name, to a fresh temporary
+// directory, gzip-compressing those whose names end in .gz, and returns
+// the directory.
+func writeRotated(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		data := []byte(contents)
+		if strings.HasSuffix(name, ".gz") {
+			var b bytes.Buffer
+			zw := gzip.NewWriter(&b)
+			zw.Write(data)
+			zw.Close()
+			data = b.Bytes()
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// =============================================================================
+// rotatedFiles
+// =============================================================================
+
+func TestRotatedFiles_Order(t *testing.T) {
+	dir := writeRotated(t, map[string]string{
+		"app.log":             "",
+		"app.log.1":           "",
+		"app.log.2.gz":        "",
+		"app.log.10.gz":       "",
+		"app.log-20240114":    "",
+		"app.log-20240113.gz": "",
+		"db.log":              "",
+		"db.log.2024-01-14":   "",
+		".hidden":             "",
+		"app.log.lpidx":       "",
+	})
+	os.Mkdir(filepath.Join(dir, "old"), 0o755)
+	paths, err := rotatedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range paths {
+		paths[i] = filepath.Base(p)
+	}
+	want := "app.log-20240113.gz app.log-20240114 app.log.10.gz app.log.2.gz app.log.1 app.log db.log.2024-01-14 db.log"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("rotatedFiles() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRotatedFiles_Empty(t *testing.T) {
+	if _, err := rotatedFiles(t.TempDir()); err == nil {
+		t.Error("expected error for a directory without logs")
+	}
+	if _, err := rotatedFiles(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for a missing directory")
+	}
+}
+
+func TestParseRotated_NotADate(t *testing.T) {
+	// Eight digits that are not a date are a generation number.
+	rf := parseRotated("", "app.log.99999999")
+	if rf.base != "app.log" || rf.class != 1 {
+		t.Errorf("parseRotated = %+v, want a numbered generation of app.log", rf)
+	}
+}
+
+// =============================================================================
+// -merge-dir
+// =============================================================================
+
+func TestRun_MergeDir(t *testing.T) {
+	dir := writeRotated(t, map[string]string{
+		"app.log":      `{"time":"2024-01-15T10:00:05Z","msg":"live"}` + "\n",
+		"app.log.1":    `{"time":"2024-01-15T10:00:03Z","msg":"one"}` + "\n",
+		"app.log.2.gz": `{"time":"2024-01-15T10:00:01Z","msg":"two"}` + "\n",
+	})
+	want := "time=2024-01-15T10:00:01Z msg=two _source=app.log.2.gz\n" +
+		"time=2024-01-15T10:00:03Z msg=one _source=app.log.1\n" +
+		"time=2024-01-15T10:00:05Z msg=live _source=app.log\n"
+	for _, args := range [][]string{
+		{"-merge-dir", dir, "-format", "logfmt"},
+		{"merge", "-format", "logfmt", dir},
+	} {
+		out, code := runCapture(t, args...)
+		if code != 0 || out != want {
+			t.Errorf("%v: output (exit %d) =\n%s\nwant\n%s", args, code, out, want)
+		}
+	}
+	if _, code := runCapture(t, "merge", t.TempDir()); code != 1 {
+		t.Errorf("empty directory: exit code = %d, want 1", code)
+	}
+}
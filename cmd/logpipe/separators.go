@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// checkMarkGaps reports an error if -mark-gaps is combined with -group-by
+// or -slowest, which do not write entries in time order.
+func checkMarkGaps(markGaps time.Duration, groupBy string, slowest bool) error {
+	switch {
+	case markGaps <= 0:
+		return nil
+	case groupBy != "":
+		return fmt.Errorf("--mark-gaps cannot be combined with --group-by")
+	case slowest:
+		return fmt.Errorf("--mark-gaps cannot be combined with --slowest")
+	}
+	return nil
+}
+
+// gapFormatter implements -mark-gaps: before an entry whose timestamp is
+// more than min after that of the entry formatted before it, it writes a
+// separator line giving the length of the gap, such as
+// "―――― 42s gap ――――", dimmed when color is set. Entries without a
+// timestamp are passed on without affecting the gaps.
+type gapFormatter struct {
+	f     formatter.Formatter
+	min   time.Duration
+	loc   *time.Location
+	color bool
+	last  time.Time // zero until an entry with a timestamp is formatted
+}
+
+// Format writes a separator for the gap before entry, if there is one, and
+// formats entry with g.f.
+func (g *gapFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	if _, t := timestampField(entry, g.loc); !t.IsZero() {
+		if gap := t.Sub(g.last); !g.last.IsZero() && gap > g.min {
+			if _, err := io.WriteString(w, separator(formatGap(gap)+" gap", g.color)); err != nil {
+				return err
+			}
+		}
+		g.last = t
+	}
+	return g.f.Format(w, entry)
+}
+
+// formatGap formats d as a duration rounded to a precision that suits its
+// length: 1m32s, 4.5s, 750ms.
+func formatGap(d time.Duration) string {
+	switch {
+	case d >= 10*time.Second:
+		d = d.Round(time.Second)
+	case d >= time.Second:
+		d = d.Round(100 * time.Millisecond)
+	default:
+		d = d.Round(time.Millisecond)
+	}
+	return fmt.Sprint(d)
+}
+
+// sourceFormatter implements merge -source-breaks: before an entry whose
+// _source differs from that of the entry formatted before it, the first
+// entry included, it writes a separator line naming the source, such as
+// "―――― worker.log ――――", dimmed when color is set.
+type sourceFormatter struct {
+	f     formatter.Formatter
+	color bool
+	last  string // the _source of the last entry formatted
+}
+
+// Format writes a separator if entry's source is not the last one's, and
+// formats entry with s.f.
+func (s *sourceFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	source, _ := entry.Fields[parser.SourceField].(string)
+	if source != s.last && source != "" {
+		if _, err := io.WriteString(w, separator(source, s.color)); err != nil {
+			return err
+		}
+	}
+	s.last = source
+	return s.f.Format(w, entry)
+}
+
+// breakSources returns f with source separators written before its
+// entries. Inside -mark-gaps, a gap is marked before the source that ends
+// it.
+func breakSources(f formatter.Formatter, color bool) formatter.Formatter {
+	if g, ok := f.(*gapFormatter); ok {
+		g.f = &sourceFormatter{f: g.f, color: color}
+		return g
+	}
+	return &sourceFormatter{f: f, color: color}
+}
+
+// separator returns the separator line labelled label, dimmed when color
+// is set.
+func separator(label string, color bool) string {
+	line := "―――― " + label + " ――――"
+	if color {
+		line = "\033[2m" + line + "\033[0m"
+	}
+	return line + "\n"
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// gapFormatter
+// =============================================================================
+
+func TestGapFormatter_MarksLongGaps(t *testing.T) {
+	g := &gapFormatter{f: &formatter.LogfmtFormatter{}, min: 5 * time.Second, loc: time.UTC}
+	var buf bytes.Buffer
+	for _, e := range []*parser.LogEntry{
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "msg": "a"}),
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:05Z", "msg": "b"}),
+		parser.NewEntry(map[string]any{"msg": "c"}),
+		parser.NewEntry(map[string]any{"ts": "2024-01-15T10:00:47Z", "msg": "d"}),
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:40Z", "msg": "e"}),
+	} {
+		if err := g.Format(&buf, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "msg=a time=2024-01-15T10:00:00Z\n" +
+		"msg=b time=2024-01-15T10:00:05Z\n" +
+		"msg=c\n" +
+		"―――― 42s gap ――――\n" +
+		"msg=d ts=2024-01-15T10:00:47Z\n" +
+		"msg=e time=2024-01-15T10:00:40Z\n"
+	if buf.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestFormatGap(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{750*time.Millisecond + 400*time.Microsecond, "750ms"},
+		{4540 * time.Millisecond, "4.5s"},
+		{42*time.Second + 300*time.Millisecond, "42s"},
+		{92*time.Second + 400*time.Millisecond, "1m32s"},
+		{2 * time.Hour, "2h0m0s"},
+	}
+	for _, tt := range tests {
+		if got := formatGap(tt.d); got != tt.want {
+			t.Errorf("formatGap(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// =============================================================================
+// sourceFormatter
+// =============================================================================
+
+func TestSourceFormatter_BreaksOnChange(t *testing.T) {
+	f := breakSources(&formatter.LogfmtFormatter{}, false)
+	var buf bytes.Buffer
+	for _, e := range []*parser.LogEntry{
+		parser.NewEntry(map[string]any{"msg": "a1", "_source": "a.log"}),
+		parser.NewEntry(map[string]any{"msg": "a2", "_source": "a.log"}),
+		parser.NewEntry(map[string]any{"msg": "b1", "_source": "b.log"}),
+		parser.NewEntry(map[string]any{"msg": "none"}),
+		parser.NewEntry(map[string]any{"msg": "b2", "_source": "b.log"}),
+	} {
+		if err := f.Format(&buf, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "―――― a.log ――――\n_source=a.log msg=a1\n_source=a.log msg=a2\n" +
+		"―――― b.log ――――\n_source=b.log msg=b1\nmsg=none\n" +
+		"―――― b.log ――――\n_source=b.log msg=b2\n"
+	if buf.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestBreakSources_GapMarkedFirst(t *testing.T) {
+	f := breakSources(&gapFormatter{f: &formatter.LogfmtFormatter{}, min: time.Second, loc: time.UTC}, false)
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "_source": "a.log"}))
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:09Z", "_source": "b.log"}))
+	want := "―――― a.log ――――\n_source=a.log time=2024-01-15T10:00:00Z\n" +
+		"―――― 9s gap ――――\n―――― b.log ――――\n_source=b.log time=2024-01-15T10:00:09Z\n"
+	if buf.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// timeRange implements -since and -until: it matches the entries whose
+// timestamp, found as timestampField finds it, falls at or after since and
+// before until. A zero bound leaves that side open. Entries without a
+// timestamp never match.
+type timeRange struct {
+	since, until time.Time
+	loc          *time.Location // zone of timestamps without a UTC offset
+}
+
+// newTimeRange returns the time range between the -since and -until
+// values, each either a timestamp, as parser.ParseTime understands it, or
+// a duration before now, such as "15m", "2h" or "7d". It returns nil when
+// neither is given.
+func newTimeRange(since, until string, now time.Time, loc *time.Location) (*timeRange, error) {
+	if since == "" && until == "" {
+		return nil, nil
+	}
+	tr := &timeRange{loc: loc}
+	var err error
+	if since != "" {
+		if tr.since, err = parseTimeBound(since, now, loc); err != nil {
+			return nil, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if until != "" {
+		if tr.until, err = parseTimeBound(until, now, loc); err != nil {
+			return nil, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if since != "" && until != "" && !tr.since.Before(tr.until) {
+		return nil, fmt.Errorf("--since must be before --until")
+	}
+	return tr, nil
+}
+
+// parseTimeBound parses the value of -since or -until: a timestamp, taken
+// to be in loc when it has no UTC offset, or a duration before now.
+func parseTimeBound(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	if t, _, ok := parser.ParseTime(s, loc); ok {
+		return t, nil
+	}
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a timestamp nor a duration such as 15m, 2h or 7d", s)
+	}
+	return now.Add(-d), nil
+}
+
+// parseAge parses a non-negative duration as time.ParseDuration does, also
+// accepting a whole number of days, such as "7d".
+func parseAge(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, err
+		}
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
+
+// Match reports whether the timestamp of entry is within the range.
+func (tr *timeRange) Match(entry *parser.LogEntry) bool {
+	_, t := timestampField(entry, tr.loc)
+	if t.IsZero() {
+		return false
+	}
+	if !tr.since.IsZero() && t.Before(tr.since) {
+		return false
+	}
+	if !tr.until.IsZero() && !t.Before(tr.until) {
+		return false
+	}
+	return true
+}
+
+// String describes the range in the terms of filter expressions.
+func (tr *timeRange) String() string {
+	var parts []string
+	if !tr.since.IsZero() {
+		parts = append(parts, "timestamp>="+tr.since.UTC().Format(time.RFC3339Nano))
+	}
+	if !tr.until.IsZero() {
+		parts = append(parts, "timestamp<"+tr.until.UTC().Format(time.RFC3339Nano))
+	}
+	return strings.Join(parts, " AND ")
+}
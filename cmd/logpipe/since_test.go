@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+func TestNewTimeRange(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	tests := []struct {
+		since, until string
+		loc          *time.Location
+		wantSince    time.Time
+		wantUntil    time.Time
+		wantErr      string
+	}{
+		{since: "15m", loc: time.UTC, wantSince: now.Add(-15 * time.Minute)},
+		{since: "2h", until: "1h30m", loc: time.UTC, wantSince: now.Add(-2 * time.Hour), wantUntil: now.Add(-90 * time.Minute)},
+		{since: "7d", loc: time.UTC, wantSince: now.AddDate(0, 0, -7)},
+		{since: "2024-01-15T10:00:00Z", loc: time.UTC, wantSince: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)},
+		{until: "2024-01-15 10:00:00", loc: paris, wantUntil: time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{until: "2024-01-15", loc: time.UTC, wantUntil: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{since: "yesterday", loc: time.UTC, wantErr: "invalid --since"},
+		{until: "-15m", loc: time.UTC, wantErr: "invalid --until"},
+		{since: "1h", until: "2h", loc: time.UTC, wantErr: "--since must be before --until"},
+	}
+	for _, tt := range tests {
+		tr, err := newTimeRange(tt.since, tt.until, now, tt.loc)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newTimeRange(%q, %q) error = %v, want %q", tt.since, tt.until, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newTimeRange(%q, %q): %v", tt.since, tt.until, err)
+			continue
+		}
+		if !tr.since.Equal(tt.wantSince) || !tr.until.Equal(tt.wantUntil) {
+			t.Errorf("newTimeRange(%q, %q) = [%v, %v), want [%v, %v)", tt.since, tt.until, tr.since, tr.until, tt.wantSince, tt.wantUntil)
+		}
+	}
+	if tr, err := newTimeRange("", "", now, time.UTC); tr != nil || err != nil {
+		t.Errorf("newTimeRange without bounds = %v, %v; want nil", tr, err)
+	}
+}
+
+func TestTimeRange_Match(t *testing.T) {
+	tr := &timeRange{
+		since: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		until: time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+		loc:   time.UTC,
+	}
+	tests := []struct {
+		entry *parser.LogEntry
+		want  bool
+	}{
+		{parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z"}), true},
+		{parser.NewEntry(map[string]any{"ts": "2024-01-15T06:30:00-04:00"}), true},
+		{parser.NewEntry(map[string]any{"timestamp": "2024-01-15 10:59:59.999"}), true},
+		{parser.NewEntry(map[string]any{"time": "2024-01-15T11:00:00Z"}), false},
+		{parser.NewEntry(map[string]any{"time": "2024-01-15T09:59:59Z"}), false},
+		// Text comparison would put this after the start of the range.
+		{parser.NewEntry(map[string]any{"time": "2024-01-15T10:30:00+02:00"}), false},
+		{parser.NewEntry(map[string]any{"ts": 1705313400.5}), true},
+		{parser.NewEntry(map[string]any{"msg": "no timestamp"}), false},
+	}
+	for _, tt := range tests {
+		if got := tr.Match(tt.entry); got != tt.want {
+			t.Errorf("Match(%v) = %v, want %v", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestRun_SinceUntil(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-01-15T09:00:00Z","msg":"a"}
+{"time":"2024-01-15T10:00:00+01:00","msg":"b"}
+{"time":"2024-01-15T10:00:00Z","msg":"c"}
+{"msg":"d"}
+{"time":"2024-01-15T11:00:00Z","msg":"e"}
+`)
+	out, code := runCapture(t, "view", "-format", "logfmt", "-since", "2024-01-15T09:00:00Z", "-until", "2024-01-15T11:00:00Z", path)
+	if want := "time=2024-01-15T09:00:00Z msg=a\ntime=2024-01-15T10:00:00+01:00 msg=b\ntime=2024-01-15T10:00:00Z msg=c\n"; code != 0 || out != want {
+		t.Errorf("exit code %d, output %q, want %q", code, out, want)
+	}
+	// Everything in the log is long past.
+	if out, code := runCapture(t, "view", "-since", "1h", path); code != 0 || out != "" {
+		t.Errorf("-since 1h: exit code %d, output %q, want none", code, out)
+	}
+	if _, code := runCapture(t, "view", "-since", "soon", path); code != 1 {
+		t.Errorf("invalid -since: exit code %d, want 1", code)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// slowestFlags holds the -slowest and -by flags, which print the matching
+// entries with the largest values of a numeric field.
+type slowestFlags struct {
+	n  int
+	by string
+}
+
+// register defines the flags on fs.
+func (s *slowestFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&s.n, "slowest", 0, "Print only the N matching entries with the largest --by values, largest first, once the input has been read")
+	fs.StringVar(&s.by, "by", "", "Numeric or duration field ranked by --slowest, such as duration_ms")
+}
+
+// check reports an error if the flags are invalid or combined with flags
+// they cannot honour: -head and -tail, -quiet, -group-by, dedupe, the flag
+// turning on deduplication if any, or -listen, whose input never ends.
+func (s slowestFlags) check(wf windowFlags, quiet bool, groupBy, dedupe string, listen bool) error {
+	switch {
+	case s.n < 0:
+		return fmt.Errorf("--slowest must not be negative")
+	case s.n == 0 && s.by != "":
+		return fmt.Errorf("--by requires --slowest")
+	case s.n == 0:
+		return nil
+	case s.by == "":
+		return fmt.Errorf("--slowest requires --by to name the field to rank by")
+	case wf.head > 0 || wf.limit > 0 || wf.tail > 0:
+		return fmt.Errorf("--slowest cannot be combined with --head or --tail")
+	case quiet:
+		return fmt.Errorf("--slowest cannot be combined with --quiet")
+	case groupBy != "":
+		return fmt.Errorf("--slowest cannot be combined with --group-by")
+	case dedupe != "":
+		return fmt.Errorf("--slowest cannot be combined with %s", dedupe)
+	case listen:
+		return fmt.Errorf("--slowest cannot be combined with --listen, whose input never ends")
+	}
+	return nil
+}
+
+// rankedEntry is an entry with the value it is ranked by and its position
+// in the input, which breaks ties in favour of the earlier entry.
+type rankedEntry struct {
+	entry *parser.LogEntry
+	value float64
+	seq   int
+}
+
+// rankHeap is a min-heap of ranked entries: its root is the entry that
+// ranks lowest, the first to be displaced by a larger one.
+type rankHeap []rankedEntry
+
+func (h rankHeap) Len() int { return len(h) }
+func (h rankHeap) Less(i, j int) bool {
+	if h[i].value != h[j].value {
+		return h[i].value < h[j].value
+	}
+	return h[i].seq > h[j].seq
+}
+func (h rankHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *rankHeap) Push(x any)   { *h = append(*h, x.(rankedEntry)) }
+func (h *rankHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// topEntries drains entries and returns the n of those satisfying match
+// with the largest numeric values of field, largest first, with ties in
+// input order. It holds at most n entries at a time, releasing the rest.
+// Entries whose field is missing are left out, as are those whose field is
+// neither a number nor a duration; it also returns how many of the latter
+// there were.
+func topEntries(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, field string, n int) ([]*parser.LogEntry, int) {
+	h := make(rankHeap, 0, n)
+	seq, skipped := 0, 0
+	for entry := range entries {
+		if !match(entry) {
+			parser.Release(entry)
+			continue
+		}
+		// Read the field only once match has rewritten the entry.
+		v, ok := numericField(entry, field)
+		if !ok {
+			if entry.Fields[field] != nil {
+				skipped++
+			}
+			parser.Release(entry)
+			continue
+		}
+		seq++
+		r := rankedEntry{entry: entry, value: v, seq: seq}
+		switch {
+		case h.Len() < n:
+			heap.Push(&h, r)
+		case v > h[0].value:
+			parser.Release(h[0].entry)
+			h[0] = r
+			heap.Fix(&h, 0)
+		default:
+			parser.Release(entry)
+		}
+	}
+	sort.Slice(h, func(i, j int) bool { return h.Less(j, i) })
+	out := make([]*parser.LogEntry, len(h))
+	for i, r := range h {
+		out[i] = r.entry
+	}
+	return out, skipped
+}
+
+// numericField returns the value of entry's field as a number, if it is
+// one or is text spelling one. Text spelling a duration with a unit, such
+// as "1.2s" or "250ms", counts as its number of seconds, as it does for
+// filters, so that it ranks alongside numbers of seconds.
+func numericField(entry *parser.LogEntry, field string) (float64, bool) {
+	switch v := entry.Fields[field].(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		v = strings.TrimSpace(v)
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+		d, err := time.ParseDuration(v)
+		return d.Seconds(), err == nil
+	}
+	return 0, false
+}
+
+// slowestMode formats the s.n entries of path (stdin when empty) that
+// match cfg's filters and have the largest values of s.by to stdout.
+func slowestMode(cfg *pipelineConfig, inputFormat, path string, s slowestFlags, useIndex bool) int {
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	entries, errs := src.p.Parse(src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+	top, skipped := topEntries(entries, cfg.process, s.by, s.n)
+	failed := wait()
+	src.close()
+	if writeTop(cfg, top, skipped, s.by) {
+		failed = true
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// writeTop formats top, as returned by topEntries, to stdout and releases
+// its entries, after reporting the skipped entries whose field by was
+// neither a number nor a duration. It reports whether formatting failed.
+func writeTop(cfg *pipelineConfig, top []*parser.LogEntry, skipped int, by string) bool {
+	if skipped > 0 {
+		noun := "entries"
+		if skipped == 1 {
+			noun = "entry"
+		}
+		fmt.Fprintf(os.Stderr, "Skipped %d matching %s whose %s is neither a number nor a duration\n", skipped, noun, by)
+	}
+	failed := false
+	for _, entry := range top {
+		err := cfg.formatter.Format(os.Stdout, entry)
+		parser.Release(entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting log: %v\n", err)
+			failed = true
+		}
+	}
+	return failed
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// splitMissing names the file -split-by writes the entries without its
+// field to.
+const splitMissing = "_missing"
+
+// splitFormatter implements -split-by: it formats each entry with f to a
+// file of its own in dir, named after the entry's value of field, such as
+// out/checkout.log for service=checkout, rather than to the writer it is
+// given. Files are created as their first entries arrive, replacing those
+// already there unless appending is set, and written to as each entry is
+// formatted, so that a followed file is split as it grows.
+type splitFormatter struct {
+	f         formatter.Formatter
+	field     string
+	dir       string
+	appending bool
+
+	files map[string]*os.File
+}
+
+// newSplitFormatter returns the formatter for -split-by field, writing
+// the entries f formats to files in dir.
+func newSplitFormatter(f formatter.Formatter, field, dir string, appending bool) *splitFormatter {
+	return &splitFormatter{f: f, field: field, dir: dir, appending: appending, files: map[string]*os.File{}}
+}
+
+// Format formats entry to the file for its value of the field.
+func (s *splitFormatter) Format(_ io.Writer, entry *parser.LogEntry) error {
+	name := splitFileName(entry.Lookup(s.field))
+	w, ok := s.files[name]
+	if !ok {
+		var err error
+		if w, err = s.create(name); err != nil {
+			return err
+		}
+		s.files[name] = w
+	}
+	return s.f.Format(w, entry)
+}
+
+// create creates the file called name in the directory, and the directory
+// with it.
+func (s *splitFormatter) create(name string) (*os.File, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.dir, name)
+	if s.appending {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	}
+	return os.Create(path)
+}
+
+// Close closes the files.
+func (s *splitFormatter) Close() error {
+	var errs []error
+	for _, f := range s.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.files = map[string]*os.File{}
+	return errors.Join(errs...)
+}
+
+// splitFileName returns the name of the file for the value v of the
+// -split-by field, if the entry has one: the value with leading dots and
+// any character other than letters, digits, '.', '-' and '_' replaced by
+// underscores, so that it names a file in the directory and nowhere else,
+// and one that is not hidden, and .log appended.
+func splitFileName(v any, ok bool) string {
+	if !ok || v == nil {
+		return splitMissing + ".log"
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, fmt.Sprintf("%v", v))
+	rest := strings.TrimLeft(name, ".")
+	name = strings.Repeat("_", len(name)-len(rest)) + rest
+	if name == "" {
+		name = "_"
+	}
+	return name + ".log"
+}
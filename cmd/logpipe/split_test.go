@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// =============================================================================
+// -split-by
+// =============================================================================
+
+const splitLog = `{"service":"api","msg":"a"}
+{"service":"db","msg":"b"}
+{"msg":"c"}
+{"service":"api","msg":"d"}
+`
+
+func TestRun_SplitBy(t *testing.T) {
+	path := writeLog(t, splitLog)
+	dir := filepath.Join(t.TempDir(), "out")
+	out, code := runCapture(t, "view", "-split-by", "service", "-output-dir", dir, "-format", "logfmt", path)
+	if code != 0 || out != "" {
+		t.Fatalf("stdout (exit %d) = %q, want nothing", code, out)
+	}
+	want := map[string]string{
+		"api.log":      "service=api msg=a\nservice=api msg=d\n",
+		"db.log":       "service=db msg=b\n",
+		"_missing.log": "msg=c\n",
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != len(want) {
+		t.Errorf("wrote %d files, want %d", len(entries), len(want))
+	}
+	for name, content := range want {
+		if got := readOutput(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+
+	// -append adds to the files instead of replacing them.
+	if _, code := runCapture(t, "view", "-split-by", "service", "-output-dir", dir, "-format", "logfmt", "-filter", "service=db", "-append", path); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if got := readOutput(t, filepath.Join(dir, "db.log")); got != "service=db msg=b\nservice=db msg=b\n" {
+		t.Errorf("db.log after -append = %q", got)
+	}
+}
+
+func TestSplitFileName(t *testing.T) {
+	tests := []struct {
+		v    any
+		ok   bool
+		want string
+	}{
+		{"checkout", true, "checkout.log"},
+		{"web-1.eu_west", true, "web-1.eu_west.log"},
+		{"../etc/passwd", true, "___etc_passwd.log"},
+		{"a b/c", true, "a_b_c.log"},
+		{"", true, "_.log"},
+		{".hidden", true, "_hidden.log"},
+		{500, true, "500.log"},
+		{nil, true, "_missing.log"},
+		{nil, false, "_missing.log"},
+	}
+	for _, tt := range tests {
+		if got := splitFileName(tt.v, tt.ok); got != tt.want {
+			t.Errorf("splitFileName(%v, %v) = %q, want %q", tt.v, tt.ok, got, tt.want)
+		}
+	}
+}
+
+func TestRun_SplitBy_Errors(t *testing.T) {
+	path := writeLog(t, splitLog)
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-split-by", "service", path}, 1},
+		{[]string{"view", "-output-dir", dir, path}, 1},
+		{[]string{"view", "-split-by", "service", "-output-dir", dir, "-output", filepath.Join(dir, "all.log"), path}, 1},
+		{[]string{"view", "-split-by", "service", "-output-dir", dir, "-format", "table", path}, 1},
+		{[]string{"view", "-split-by", "service", "-output-dir", dir, "-mark-gaps", "5s", path}, 1},
+		{[]string{"view", "-split-by", "service", "-output-dir", dir, "-group-by", "msg", path}, 1},
+		{[]string{"merge", "-split-by", "service", "-output-dir", dir, "-source-breaks", path, path}, 1},
+		{[]string{"-file", path, "-split-by", "service", "-output-dir", dir, "-stats", "msg"}, 1},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		names := make([]string, len(entries))
+		for i, e := range entries {
+			names[i] = e.Name()
+		}
+		slices.Sort(names)
+		t.Errorf("failed runs wrote %v", names)
+	}
+}
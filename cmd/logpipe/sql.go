@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/internal/query"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// runSQL implements "logpipe sql [flags] query [file]".
+func runSQL(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("sql", flag.ContinueOnError)
+	g.registerInput(fs)
+	g.registerFilter(fs)
+	g.registerProfile(fs)
+	filePath := fs.String("file", "", "Path to log file (default: stdin)")
+	noIndex := fs.Bool("no-index", false, "Ignore the sidecar index written by 'logpipe index' and read the whole file")
+	output := fs.String("output", "table", "Result format: table, csv or json (one object per row)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: logpipe sql [flags] query [file]
+
+Runs a SQL query over the entries, which form the table logs, and prints
+the result. For example:
+
+  logpipe sql 'SELECT service, count(*) FROM logs WHERE level = "error"
+               GROUP BY service ORDER BY 2 DESC' app.log
+
+`)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	var path string
+	switch {
+	case fs.NArg() == 0:
+		fs.Usage()
+		return 2
+	case fs.NArg() > 2:
+		fmt.Fprintf(os.Stderr, "Error: expected a query and at most one file, got %d arguments\n", fs.NArg())
+		return 2
+	case fs.NArg() == 2 && *filePath != "":
+		fmt.Fprintf(os.Stderr, "Error: give the file either with -file or as an argument, not both\n")
+		return 2
+	case fs.NArg() == 2:
+		path = fs.Arg(1)
+	default:
+		path = *filePath
+	}
+	switch *output {
+	case "table", "csv", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --output %q (want table, csv or json)\n", *output)
+		return 2
+	}
+	q, err := query.Parse(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid query %v\n", err)
+		return 2
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return sqlMode(cfg, g.input, path, q, newSQLOutput(os.Stdout, *output, q), !*noIndex)
+}
+
+// sqlMode runs q over the entries of path (stdin when empty) that match
+// cfg's filters and writes the result to out. Once a query with LIMIT has
+// its rows, the parser is cancelled instead of reading the rest of the
+// input.
+func sqlMode(cfg *pipelineConfig, inputFormat, path string, q *query.Query, out *sqlOutput, useIndex bool) int {
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer src.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entries, errs := src.p.ParseContext(ctx, src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+	x := q.Executor(out.write)
+	var failed bool
+	if runQuery(entries, cfg.process, x) {
+		cancel()
+		failed = src.settle(wait)
+	} else {
+		failed = wait()
+	}
+	x.Close()
+	if err := out.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		failed = true
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// runQuery adds the entries from entries that satisfy match to x, releasing
+// them. It returns true, without draining the rest of the channel, once x
+// needs no more entries.
+func runQuery(entries <-chan *parser.LogEntry, match func(*parser.LogEntry) bool, x *query.Executor) (stopped bool) {
+	for entry := range entries {
+		more := !match(entry) || x.Add(entry)
+		parser.Release(entry)
+		if !more {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlOutput writes the rows of a query's result in one of the -output
+// formats. Table and CSV output start with a header naming the columns;
+// when the query selects *, the columns are only known once every row is,
+// so the rows are held until close.
+type sqlOutput struct {
+	w       io.Writer
+	format  string
+	columns []string // nil until known
+	// positional is set when each row's fields are the columns in order.
+	positional bool
+	held       []query.Row
+	table      *tabwriter.Writer
+	csv        *csv.Writer
+	err        error // the first write error
+}
+
+// newSQLOutput returns an output of q's result to w in format.
+func newSQLOutput(w io.Writer, format string, q *query.Query) *sqlOutput {
+	o := &sqlOutput{w: w, format: format}
+	switch format {
+	case "table":
+		o.table = newTable(w)
+	case "csv":
+		o.csv = csv.NewWriter(w)
+	}
+	if cols := q.Columns(); format != "json" && !slices.Contains(cols, "*") {
+		// Every row has exactly these columns, in order.
+		o.positional = true
+		o.writeHeader(cols)
+	}
+	return o
+}
+
+// write writes row, or holds it until the columns are known. It reports
+// false once writing has failed.
+func (o *sqlOutput) write(row query.Row) bool {
+	switch {
+	case o.err != nil:
+		return false
+	case o.format == "json":
+		entry := parser.NewOrderedEntry()
+		for _, f := range row {
+			entry.Set(f.Name, f.Value)
+		}
+		o.err = (&formatter.JSONFormatter{}).Format(o.w, entry)
+		parser.Release(entry)
+	case o.columns == nil:
+		o.held = append(o.held, row)
+	default:
+		o.writeRow(row)
+	}
+	return o.err == nil
+}
+
+// close writes the held rows and flushes the output, and returns the first
+// error writing it.
+func (o *sqlOutput) close() error {
+	if o.format != "json" && o.columns == nil {
+		// The columns of * are the fields of all the rows, in the order
+		// they first appear.
+		var cols []string
+		seen := make(map[string]bool)
+		for _, row := range o.held {
+			for _, f := range row {
+				if !seen[f.Name] {
+					seen[f.Name] = true
+					cols = append(cols, f.Name)
+				}
+			}
+		}
+		o.writeHeader(cols)
+		for _, row := range o.held {
+			o.writeRow(row)
+		}
+		o.held = nil
+	}
+	switch {
+	case o.table != nil:
+		if err := o.table.Flush(); o.err == nil {
+			o.err = err
+		}
+	case o.csv != nil:
+		o.csv.Flush()
+		if err := o.csv.Error(); o.err == nil {
+			o.err = err
+		}
+	}
+	return o.err
+}
+
+// writeHeader sets the columns and writes their names.
+func (o *sqlOutput) writeHeader(cols []string) {
+	o.columns = cols
+	o.writeCells(cols)
+}
+
+// writeRow writes the values of row in the order of the columns, leaving
+// a cell empty when row lacks its column.
+func (o *sqlOutput) writeRow(row query.Row) {
+	cells := make([]string, len(o.columns))
+	if o.positional {
+		for i, f := range row {
+			cells[i] = o.cell(f.Value)
+		}
+		o.writeCells(cells)
+		return
+	}
+	for _, f := range row {
+		for i, c := range o.columns {
+			if c == f.Name {
+				cells[i] = o.cell(f.Value)
+				break
+			}
+		}
+	}
+	o.writeCells(cells)
+}
+
+// cell returns v as the text of a cell. In a table NULL is spelled out and
+// text with control characters, which would break the layout, is quoted;
+// in CSV NULL is an empty cell.
+func (o *sqlOutput) cell(v any) string {
+	if o.csv != nil {
+		if v == nil {
+			return ""
+		}
+		return query.Text(v)
+	}
+	s := query.Text(v)
+	if strings.ContainsFunc(s, unicode.IsControl) {
+		s = strconv.Quote(s)
+	}
+	return s
+}
+
+// writeCells writes one line of cells.
+func (o *sqlOutput) writeCells(cells []string) {
+	if o.err != nil {
+		return
+	}
+	if o.csv != nil {
+		o.err = o.csv.Write(cells)
+		return
+	}
+	_, o.err = fmt.Fprintln(o.table, strings.Join(cells, "\t"))
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// syslogSchemes are the schemes a -syslog-addr URL may use, and the port
+// each uses when the URL names none.
+var syslogSchemes = map[string]string{"udp": "514", "tcp": "601", "tls": "6514"}
+
+// syslogFacilities names the syslog facilities, indexed by their numbers,
+// as the syslog parser names them.
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogSeverities gives the severity of the levels named as syslog names
+// them, including their usual abbreviations. Other levels are ranked as
+// levelRank ranks them.
+var syslogSeverities = map[string]int{
+	"emergency": 0, "emerg": 0, "panic": 0, "alert": 1, "critical": 2, "crit": 2,
+	"error": 3, "err": 3, "warning": 4, "warn": 4, "notice": 5, "info": 6,
+	"informational": 6, "debug": 7,
+}
+
+// syslogParts are the parts of a syslog message -syslog-fields can take
+// from other fields, and the fields each is taken from by default, the
+// first an entry has. The syslog parser gives parsed messages the first of
+// each.
+var syslogParts = map[string][]string{
+	"level":  {"level", "lvl", "severity"},
+	"msg":    {"msg", "message", "text"},
+	"host":   {"host", "hostname"},
+	"app":    {"app", "service"},
+	"procid": {"procid", "pid"},
+	"msgid":  {"msgid"},
+}
+
+// syslogFormatter implements -format syslog: it sends each entry as an RFC
+// 5424 message to a syslog collector rather than writing it to the writer
+// it is given. Over UDP each message is a datagram of its own; over TCP
+// and TLS messages are framed by octet counting, as RFC 6587 and RFC 5425
+// describe. The connection is made when the first entry is sent, and made
+// again once should a stream connection fail.
+//
+// The message's severity comes from the entry's level, its timestamp from
+// the entry's, or "-" without one, and its hostname, app-name, procid,
+// msgid and text from the fields syslogParts names, or the -syslog-fields
+// that replace them. An entry without a message is sent as its JSON. Other
+// fields are not sent.
+type syslogFormatter struct {
+	scheme, addr string
+	facility     int
+	fields       map[string][]string // the fields of each of syslogParts
+	host         string              // hostname of entries without one
+	loc          *time.Location
+	dial         func(network, addr string) (net.Conn, error)
+
+	conn net.Conn
+}
+
+// newSyslogFormatter returns the formatter for -format syslog sending to
+// the collector at the -syslog-addr rawAddr, with the -syslog-facility
+// facility and the -syslog-fields spec.
+func newSyslogFormatter(rawAddr, facility, spec string, loc *time.Location) (*syslogFormatter, error) {
+	if rawAddr == "" {
+		return nil, fmt.Errorf("--format syslog requires --syslog-addr")
+	}
+	scheme, addr, ok := strings.Cut(rawAddr, "://")
+	port, known := syslogSchemes[scheme]
+	if !ok || !known || addr == "" || strings.Contains(addr, "/") {
+		return nil, fmt.Errorf("invalid --syslog-addr %q (want udp://, tcp:// or tls:// and host[:port])", rawAddr)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), port)
+	}
+	fac := slices.Index(syslogFacilities, facility)
+	if fac < 0 {
+		return nil, fmt.Errorf("invalid --syslog-facility %q (want one of %s)", facility, strings.Join(syslogFacilities, ", "))
+	}
+	fields, err := parseSyslogFields(spec)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	sf := &syslogFormatter{scheme: scheme, addr: addr, facility: fac, fields: fields, host: host, loc: loc}
+	sf.dial = sf.connect
+	return sf, nil
+}
+
+// parseSyslogFields parses the -syslog-fields spec: comma-separated
+// part=field pairs, such as msg=message, each naming the field a part of
+// the message is taken from. The parts not named keep their usual fields.
+func parseSyslogFields(spec string) (map[string][]string, error) {
+	fields := make(map[string][]string, len(syslogParts))
+	for part, fs := range syslogParts {
+		fields[part] = fs
+	}
+	if spec == "" {
+		return fields, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		part, field, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if _, known := syslogParts[part]; !ok || !known || field == "" {
+			return nil, fmt.Errorf("invalid --syslog-fields %q (want part=field pairs, with parts level, msg, host, app, procid and msgid)", pair)
+		}
+		fields[part] = []string{field}
+	}
+	return fields, nil
+}
+
+// connect dials the collector.
+func (s *syslogFormatter) connect(network, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	if network == "tls" {
+		host, _, _ := net.SplitHostPort(addr)
+		return tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: host})
+	}
+	return d.Dial(network, addr)
+}
+
+// Format sends entry to the collector.
+func (s *syslogFormatter) Format(_ io.Writer, entry *parser.LogEntry) error {
+	msg := s.message(entry)
+	if s.scheme != "udp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			conn, err := s.dial(s.scheme, s.addr)
+			if err != nil {
+				return fmt.Errorf("connecting to syslog collector %s: %w", s.addr, err)
+			}
+			s.conn = conn
+		}
+		_, err := io.WriteString(s.conn, msg)
+		if err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+		if attempt == 1 || s.scheme == "udp" {
+			return fmt.Errorf("sending to syslog collector %s: %w", s.addr, err)
+		}
+	}
+}
+
+// Close closes the connection to the collector, if there is one.
+func (s *syslogFormatter) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// message returns entry as an RFC 5424 message, without framing.
+func (s *syslogFormatter) message(entry *parser.LogEntry) string {
+	level, _ := s.part(entry, "level")
+	ts := "-"
+	if _, t := timestampField(entry, s.loc); !t.IsZero() {
+		// RFC 5424 allows at most microseconds.
+		ts = t.Format("2006-01-02T15:04:05.999999Z07:00")
+	}
+	host, ok := s.part(entry, "host")
+	if !ok {
+		host = s.host
+	}
+	app, _ := s.part(entry, "app")
+	procid, _ := s.part(entry, "procid")
+	msgid, _ := s.part(entry, "msgid")
+	text, ok := s.part(entry, "msg")
+	if !ok {
+		b, _ := json.Marshal(entry)
+		text = string(b)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s -", s.facility*8+syslogSeverity(level), ts,
+		headerField(host, 255), headerField(app, 48), headerField(procid, 128), headerField(msgid, 32))
+	if text != "" {
+		b.WriteByte(' ')
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// part returns the value of the first of the fields of part that entry
+// has, and whether it has one.
+func (s *syslogFormatter) part(entry *parser.LogEntry, part string) (string, bool) {
+	for _, f := range s.fields[part] {
+		if v, ok := entry.Lookup(f); ok && v != nil {
+			return fmt.Sprintf("%v", v), true
+		}
+	}
+	return "", false
+}
+
+// syslogSeverity returns the severity of level: the syslog severity it
+// names, or the nearest to its levelRank, or info for a level neither
+// knows.
+func syslogSeverity(level string) int {
+	if sev, ok := syslogSeverities[strings.ToLower(strings.TrimSpace(level))]; ok {
+		return sev
+	}
+	rank, ok := levelRank(level)
+	if !ok {
+		return 6
+	}
+	// trace, debug, info, warn, error and fatal.
+	return []int{7, 7, 6, 4, 3, 2}[rank]
+}
+
+// headerField returns s as a field of a syslog header, which holds at most
+// limit printable ASCII characters other than the space: "-" when s is
+// empty, and otherwise s cut short with other characters replaced by
+// underscores.
+func headerField(s string, limit int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	if len(b) > limit {
+		b = b[:limit]
+	}
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// -format syslog
+// =============================================================================
+
+func TestRun_FormatSyslog(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		b, _ := io.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "view", "-format", "syslog", "-syslog-addr", "tcp://"+ln.Addr().String(), "-syslog-facility", "local0", "-filter", "level=error", path)
+	if code != 0 || out != "" {
+		t.Fatalf("output (exit %d) = %q, want nothing on stdout", code, out)
+	}
+	host, _ := os.Hostname()
+	first := "<131>1 2024-01-15T10:00:02Z " + host + " - - - - b"
+	second := "<131>1 2024-01-15T10:00:03Z " + host + " - - - - c"
+	want := strconv.Itoa(len(first)) + " " + first + strconv.Itoa(len(second)) + " " + second
+	select {
+	case got := <-received:
+		if got != want {
+			t.Errorf("received %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received")
+	}
+}
+
+func TestSyslogFormatter_Format_UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	sf, err := newSyslogFormatter("udp://"+pc.LocalAddr().String(), "daemon", "msg=text,app=service,procid=pid", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	entry := parser.NewEntry(map[string]any{"ts": "2024-01-15T10:00:01.123456789Z", "level": "WARN", "host": "web 1", "service": "api", "pid": 42, "text": "slow"})
+	if err := sf.Format(nil, entry); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<28>1 2024-01-15T10:00:01.123456Z web_1 api 42 - - slow"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("datagram = %q, want %q", got, want)
+	}
+}
+
+func TestSyslogFormatter_Format_Reconnects(t *testing.T) {
+	sf, err := newSyslogFormatter("tcp://collector", "user", "", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dials int
+	sf.dial = func(network, addr string) (net.Conn, error) {
+		dials++
+		if network != "tcp" || addr != "collector:601" {
+			t.Errorf("dialed %s %s, want tcp collector:601", network, addr)
+		}
+		client, server := net.Pipe()
+		if dials == 1 {
+			// The collector has gone away.
+			server.Close()
+			return client, nil
+		}
+		go io.Copy(io.Discard, server)
+		return client, nil
+	}
+	if err := sf.Format(nil, parser.NewEntry(map[string]any{"host": "h", "msg": "x"})); err != nil {
+		t.Fatal(err)
+	}
+	if dials != 2 {
+		t.Errorf("dialed %d times, want 2", dials)
+	}
+	sf.Close()
+
+	sf.dial = func(string, string) (net.Conn, error) { return nil, errors.New("connection refused") }
+	err = sf.Format(nil, parser.NewEntry(map[string]any{"msg": "x"}))
+	if err == nil || err.Error() != "connecting to syslog collector collector:601: connection refused" {
+		t.Errorf("Format error = %v", err)
+	}
+}
+
+func TestSyslogFormatter_Message(t *testing.T) {
+	sf, err := newSyslogFormatter("udp://collector", "user", "", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf.host = "here"
+	tests := []struct {
+		entry *parser.LogEntry
+		want  string
+	}{
+		{parser.NewEntry(map[string]any{"msg": "hi"}), "<14>1 - here - - - - hi"},
+		{parser.NewEntry(map[string]any{"level": "notice", "msg": ""}), "<13>1 - here - - - -"},
+		{parser.NewEntry(map[string]any{"level": "fatal", "code": 7}), `<10>1 - here - - - - {"code":7,"level":"fatal"}`},
+		{parser.NewEntry(map[string]any{"severity": "debug", "msgid": "ID47", "app": strings.Repeat("a", 60), "msg": "m"}), "<15>1 - here " + strings.Repeat("a", 48) + " - ID47 - m"},
+	}
+	for _, tt := range tests {
+		if got := sf.message(tt.entry); got != tt.want {
+			t.Errorf("message(%v) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	for level, want := range map[string]int{
+		"emerg": 0, "alert": 1, "CRIT": 2, "error": 3, "warning": 4, "notice": 5,
+		"info": 6, "debug": 7, "trace": 7, "fatal": 2, "50": 3, "": 6, "chatty": 6,
+	} {
+		if got := syslogSeverity(level); got != want {
+			t.Errorf("syslogSeverity(%q) = %d, want %d", level, got, want)
+		}
+	}
+}
+
+func TestRun_FormatSyslog_Errors(t *testing.T) {
+	path := writeLog(t, cliLog)
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"view", "-format", "syslog", path}, 1},
+		{[]string{"view", "-format", "syslog", "-syslog-addr", "localhost:514", path}, 1},
+		{[]string{"view", "-format", "syslog", "-syslog-addr", "udp://localhost", "-syslog-facility", "local9", path}, 1},
+		{[]string{"view", "-format", "syslog", "-syslog-addr", "udp://localhost", "-syslog-fields", "body=msg", path}, 1},
+		{[]string{"view", "-syslog-facility", "local0", path}, 1},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
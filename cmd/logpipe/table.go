@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/tylermac92/logpipe/formatter"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// newTable returns a writer that lines tab-separated cells up in columns
+// two spaces apart, as every table logpipe prints is laid out.
+func newTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
+
+// statsFormats are the presentations of a stats table -stats-format
+// selects between.
+var statsFormats = []string{"plain", "table", "json", "csv"}
+
+// statsBarWidth is the length of the bar of the most frequent value in a
+// -stats-format table.
+const statsBarWidth = 30
+
+// statsFormatFlag defines -stats-format on fs.
+func statsFormatFlag(fs *flag.FlagSet) *string {
+	return fs.String("stats-format", "plain", "How to print the stats table: plain (\"value: count\" lines), table (with percentages and bars), json (one object per row) or csv")
+}
+
+// checkStatsFormat reports an error unless format is one of statsFormats.
+func checkStatsFormat(format string) error {
+	if !slices.Contains(statsFormats, format) {
+		return fmt.Errorf("invalid --stats-format %q (want plain, table, json or csv)", format)
+	}
+	return nil
+}
+
+// statsTemplateFlag defines -stats-template on fs.
+func statsTemplateFlag(fs *flag.FlagSet) *string {
+	return fs.String("stats-template", "", "File holding a Go text/template that renders the stats table instead of --stats-format, given the field, the total and the rows with their counts and percentages")
+}
+
+// loadStatsTemplate parses the template in the file at path for
+// -stats-template, which replaces -stats-format, so format must be left at
+// plain. It returns nil when path is "".
+func loadStatsTemplate(path, format string) (*template.Template, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if format != "plain" {
+		return nil, fmt.Errorf("--stats-template cannot be combined with --stats-format")
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading stats template: %w", err)
+	}
+	t, err := template.New(path).Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("stats template: %w", err)
+	}
+	return t, nil
+}
+
+// statsTemplateData is what a -stats-template is executed with.
+type statsTemplateData struct {
+	Field string // the field counted
+	Total int    // the matching entries counted, without -compare
+	// Columns holds the -compare filter expressions and Totals the number
+	// of matching entries under each; both are empty without -compare.
+	Columns []string
+	Totals  []int
+	Rows    []statsTemplateRow // most frequent first
+}
+
+// statsTemplateRow is a row of statsTemplateData: a value of the field and
+// its count, or with -compare its counts under each column.
+type statsTemplateRow struct {
+	Value      string
+	Count      int
+	Percent    float64 // of Total, to one decimal place
+	Cumulative float64 // Percent summed down to this row
+	Counts     []int   // with -compare, by column
+}
+
+// executeStatsTemplate writes a frequency table to w rendered with t.
+func executeStatsTemplate(w io.Writer, t *template.Template, field string, stats []statEntry) error {
+	data := statsTemplateData{Field: field, Rows: make([]statsTemplateRow, len(stats))}
+	for _, s := range stats {
+		data.Total += s.Count
+	}
+	cumulative := 0
+	for i, s := range stats {
+		cumulative += s.Count
+		data.Rows[i] = statsTemplateRow{Value: s.Value, Count: s.Count, Percent: percent(s.Count, data.Total), Cumulative: percent(cumulative, data.Total)}
+	}
+	return t.Execute(w, data)
+}
+
+// executeComparedStatsTemplate writes a stats table with a column of
+// counts for each of cols to w rendered with t.
+func executeComparedStatsTemplate(w io.Writer, t *template.Template, field string, cols []compareColumn, rows []comparedStat) error {
+	data := statsTemplateData{Field: field, Totals: make([]int, len(cols)), Rows: make([]statsTemplateRow, len(rows))}
+	for _, c := range cols {
+		data.Columns = append(data.Columns, c.expr)
+	}
+	for i, row := range rows {
+		for j, n := range row.Counts {
+			data.Totals[j] += n
+		}
+		data.Rows[i] = statsTemplateRow{Value: row.Value, Counts: row.Counts}
+	}
+	return t.Execute(w, data)
+}
+
+// printStats writes a frequency table to w in format. Tables, JSON and CSV
+// give each value's count, its percentage of the matching entries and the
+// cumulative percentage down to it; tables add a bar scaled to the most
+// frequent value.
+func printStats(w io.Writer, format, field string, stats []statEntry) error {
+	if format == "plain" || format == "" {
+		for _, s := range stats {
+			if _, err := fmt.Fprintf(w, "%s: %d\n", s.Value, s.Count); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	total := 0
+	for _, s := range stats {
+		total += s.Count
+	}
+	columns := []string{field, "count", "percent", "cumulative"}
+	rows := make([][]any, len(stats))
+	cumulative := 0
+	for i, s := range stats {
+		cumulative += s.Count
+		rows[i] = []any{s.Value, s.Count, percent(s.Count, total), percent(cumulative, total)}
+	}
+	if format != "table" {
+		return writeRows(w, format, columns, rows)
+	}
+
+	tw := newTable(w)
+	// The bars have no heading, but line up after the cumulative column.
+	fmt.Fprintln(tw, strings.Join(columns, "\t")+"\t")
+	for i, row := range rows {
+		// Rows are ordered most frequent first.
+		bar := strings.Repeat("#", max(1, int(math.Round(float64(statsBarWidth*stats[i].Count)/float64(stats[0].Count)))))
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t%.1f%%\t%s\n", row[0], row[1], row[2], row[3], bar)
+	}
+	return tw.Flush()
+}
+
+// percent returns n as a percentage of total, to one decimal place.
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*1000/float64(total)) / 10
+}
+
+// printComparedStats writes a stats table with a column of counts for
+// each of cols to w in format, headed by the field's name and the columns'
+// filter expressions. Plain output is laid out as a table too.
+func printComparedStats(w io.Writer, format, field string, cols []compareColumn, rows []comparedStat) error {
+	columns := make([]string, 0, len(cols)+1)
+	columns = append(columns, field)
+	for _, c := range cols {
+		columns = append(columns, c.expr)
+	}
+	cells := make([][]any, len(rows))
+	for i, row := range rows {
+		cells[i] = append(make([]any, 0, len(cols)+1), row.Value)
+		for _, n := range row.Counts {
+			cells[i] = append(cells[i], n)
+		}
+	}
+	if format == "json" || format == "csv" {
+		return writeRows(w, format, columns, cells)
+	}
+	tw := newTable(w)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	text := make([]string, len(columns))
+	for _, row := range cells {
+		for i, v := range row {
+			text[i] = fmt.Sprint(v)
+		}
+		fmt.Fprintln(tw, strings.Join(text, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeRows writes rows, whose cells are named by columns, as JSON objects
+// one per line or as CSV with a header line.
+func writeRows(w io.Writer, format string, columns []string, rows [][]any) error {
+	if format == "json" {
+		f := &formatter.JSONFormatter{}
+		for _, row := range rows {
+			entry := parser.NewOrderedEntry()
+			for i, v := range row {
+				entry.Set(columns[i], v)
+			}
+			err := f.Format(w, entry)
+			parser.Release(entry)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, v := range row {
+			switch v := v.(type) {
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', 1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/tylermac92/logpipe/filter"
+)
+
+var levelStats = []statEntry{{"info", 6}, {"warn", 3}, {"error", 1}}
+
+// =============================================================================
+// printStats
+// =============================================================================
+
+func TestPrintStats_Formats(t *testing.T) {
+	tests := []struct {
+		format, want string
+	}{
+		{"plain", "info: 6\nwarn: 3\nerror: 1\n"},
+		{"table", "" +
+			"level  count  percent  cumulative  \n" +
+			"info   6      60.0%    60.0%       ##############################\n" +
+			"warn   3      30.0%    90.0%       ###############\n" +
+			"error  1      10.0%    100.0%      #####\n"},
+		{"json", "" +
+			`{"level":"info","count":6,"percent":60,"cumulative":60}` + "\n" +
+			`{"level":"warn","count":3,"percent":30,"cumulative":90}` + "\n" +
+			`{"level":"error","count":1,"percent":10,"cumulative":100}` + "\n"},
+		{"csv", "level,count,percent,cumulative\ninfo,6,60.0,60.0\nwarn,3,30.0,90.0\nerror,1,10.0,100.0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b strings.Builder
+			if err := printStats(&b, tt.format, "level", levelStats); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("printStats() =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintStats_TableBarsNeverEmpty(t *testing.T) {
+	var b strings.Builder
+	printStats(&b, "table", "level", []statEntry{{"info", 1000}, {"error", 1}})
+	if !strings.HasSuffix(b.String(), "0.1%     100.0%      #\n") {
+		t.Errorf("printStats() =\n%s\nwant a one-character bar for the rare value", b.String())
+	}
+}
+
+func TestPrintComparedStats_Formats(t *testing.T) {
+	api, _ := filter.NewFieldFilter("service=api")
+	worker, _ := filter.NewFieldFilter("service=worker")
+	cols := []compareColumn{{"service=api", api}, {"service=worker", worker}}
+	rows := []comparedStat{{Value: "error", Counts: []int{2, 1}}, {Value: "info", Counts: []int{1, 0}}}
+	tests := []struct {
+		format, want string
+	}{
+		{"table", "level  service=api  service=worker\nerror  2            1\ninfo   1            0\n"},
+		{"json", `{"level":"error","service=api":2,"service=worker":1}` + "\n" + `{"level":"info","service=api":1,"service=worker":0}` + "\n"},
+		{"csv", "level,service=api,service=worker\nerror,2,1\ninfo,1,0\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := printComparedStats(&b, tt.format, "level", cols, rows); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("printComparedStats(%s) =\n%s\nwant\n%s", tt.format, b.String(), tt.want)
+		}
+	}
+}
+
+func TestExecuteStatsTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`{{.Field}} of {{.Total}}:{{range .Rows}} {{.Value}}={{.Count}}/{{.Percent}}/{{.Cumulative}}{{end}}`))
+	var b strings.Builder
+	if err := executeStatsTemplate(&b, tmpl, "level", levelStats); err != nil {
+		t.Fatal(err)
+	}
+	if want := "level of 10: info=6/60/60 warn=3/30/90 error=1/10/100"; b.String() != want {
+		t.Errorf("executeStatsTemplate() = %q, want %q", b.String(), want)
+	}
+}
+
+func TestExecuteComparedStatsTemplate(t *testing.T) {
+	api, _ := filter.NewFieldFilter("service=api")
+	worker, _ := filter.NewFieldFilter("service=worker")
+	cols := []compareColumn{{"service=api", api}, {"service=worker", worker}}
+	rows := []comparedStat{{Value: "error", Counts: []int{2, 1}}, {Value: "info", Counts: []int{1, 0}}}
+	tmpl := template.Must(template.New("").Parse(`{{.Columns}} {{.Totals}}{{range .Rows}} {{.Value}}={{.Counts}}{{end}}`))
+	var b strings.Builder
+	if err := executeComparedStatsTemplate(&b, tmpl, "level", cols, rows); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[service=api service=worker] [3 1] error=[2 1] info=[1 0]"; b.String() != want {
+		t.Errorf("executeComparedStatsTemplate() = %q, want %q", b.String(), want)
+	}
+}
+
+// =============================================================================
+// -stats-format
+// =============================================================================
+
+func TestRun_StatsFormat(t *testing.T) {
+	path := writeLog(t, cliLog)
+	out, code := runCapture(t, "stats", "-field", "level", "-stats-format", "csv", path)
+	if want := "level,count,percent,cumulative\nerror,2,66.7,66.7\ninfo,1,33.3,100.0\n"; code != 0 || out != want {
+		t.Errorf("stats output (exit %d) =\n%s\nwant\n%s", code, out, want)
+	}
+	out, code = runCapture(t, "-stats", "level", "-stats-format", "table", "-file", path)
+	if !strings.HasPrefix(out, "level  count  percent  cumulative  \nerror  2      66.7%    66.7%       ####") || code != 0 {
+		t.Errorf("legacy output (exit %d) =\n%s", code, out)
+	}
+	for _, args := range [][]string{
+		{"stats", "-field", "level", "-stats-format", "yaml", path},
+		{"-stats-format", "table", "-file", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
+
+// =============================================================================
+// -stats-template
+// =============================================================================
+
+func TestRun_StatsTemplate(t *testing.T) {
+	path := writeLog(t, cliLog)
+	dir := t.TempDir()
+	tmplPath := filepath.Join(dir, "wiki.tmpl")
+	os.WriteFile(tmplPath, []byte("|| {{.Field}} || count ||\n{{range .Rows}}| {{.Value}} | {{.Count}} |\n{{end}}"), 0o644)
+	want := "|| level || count ||\n| error | 2 |\n| info | 1 |\n"
+	for _, args := range [][]string{
+		{"stats", "-field", "level", "-stats-template", tmplPath, path},
+		{"-stats", "level", "-stats-template", tmplPath, "-file", path},
+	} {
+		if out, code := runCapture(t, args...); code != 0 || out != want {
+			t.Errorf("%v: output (exit %d) =\n%s\nwant\n%s", args, code, out, want)
+		}
+	}
+
+	badPath := filepath.Join(dir, "bad.tmpl")
+	os.WriteFile(badPath, []byte("{{range .Rows}}"), 0o644)
+	failPath := filepath.Join(dir, "fail.tmpl")
+	os.WriteFile(failPath, []byte("{{.Missing}}"), 0o644)
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"stats", "-field", "level", "-stats-template", badPath, path}, 1},
+		{[]string{"stats", "-field", "level", "-stats-template", filepath.Join(dir, "missing"), path}, 1},
+		{[]string{"stats", "-field", "level", "-stats-template", tmplPath, "-stats-format", "csv", path}, 1},
+		{[]string{"-stats-template", tmplPath, "-file", path}, 1},
+		{[]string{"stats", "-field", "level", "-stats-template", failPath, path}, 1},
+	} {
+		if _, code := runCapture(t, tt.args...); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
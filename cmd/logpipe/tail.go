@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// readsBackward reports whether the last matching entries of a file can be
+// found by reading it backwards from its end: nothing cfg does to an entry
+// may depend on the entries before it, as -every, -dedupe and the
+// -multiline patterns do, and -strict needs every line read.
+func (cfg *pipelineConfig) readsBackward() bool {
+	return !cfg.strict && cfg.sampler == nil && cfg.dedupe == nil && !cfg.multiline()
+}
+
+// tailMode formats the last n entries of the file at path that match cfg's
+// filters, reading the file backwards from its end a block at a time until
+// n of them have been found, so that the start of a large file is never
+// parsed. ok is false, and nothing has been done, when path cannot be
+// read at any offset, as a named pipe or a compressed file cannot;
+// viewMode reads it forwards instead.
+func tailMode(cfg *pipelineConfig, inputFormat, path string, n int) (exitCode int, ok bool) {
+	f, err := input.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	var size int64
+	switch r := f.(type) {
+	case *input.MappedFile:
+		size = int64(len(r.Bytes()))
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		size = info.Size()
+	default:
+		return 0, false
+	}
+	ra := f.(io.ReaderAt)
+	head := make([]byte, 4)
+	if n, _ := ra.ReadAt(head, 0); input.Compression(head[:n]) != "" {
+		// A compressed file can only be read from its start.
+		return 0, false
+	}
+
+	opts := cfg.readOptsFor(path)
+	_, p, _, err := cfg.parserFor(io.NewSectionReader(ra, 0, size), inputFormat, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1, true
+	}
+
+	errs := make(chan error)
+	wait := drainErrors(cfg, errs, os.Stderr)
+	last := lastEntries(cfg, p, ra, size, n, errs)
+	close(errs)
+	failed := wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	all := func(*parser.LogEntry) bool { return true }
+	ch := make(chan *parser.LogEntry)
+	go func() {
+		defer close(ch)
+		for _, entry := range last {
+			ch <- entry
+		}
+	}()
+	entries, match := cfg.align.aligned(ctx, ch, all)
+	if _, formatFailed := emitEntries(os.Stdout, entries, match, cfg.formatter, 0); formatFailed || failed {
+		return 1, true
+	}
+	return 0, true
+}
+
+// lastEntries returns, oldest first, the last n entries of the size bytes
+// of r that satisfy cfg.process, parsing r with p one block at a time from
+// its end. The errors of the blocks parsed, with the line numbers in the
+// whole of r, are sent to errs, and parsing ends early at one that stops
+// the run.
+func lastEntries(cfg *pipelineConfig, p parser.ContextParser, r io.ReaderAt, size int64, n int, errs chan<- error) []*parser.LogEntry {
+	b := input.NewBackward(r, size, 0)
+	lines := &lineCounter{r: r, at: -1}
+	var blocks [][]*parser.LogEntry // the matching entries of each block, last block first
+	found := 0
+	for found < n {
+		block, off, err := b.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs <- fmt.Errorf("reading input: %w", err)
+			break
+		}
+		matched, stopped := parseBlock(cfg, p, block, off, lines, errs)
+		blocks = append(blocks, matched)
+		found += len(matched)
+		if stopped {
+			break
+		}
+	}
+
+	last := make([]*parser.LogEntry, 0, min(n, found))
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, entry := range blocks[i] {
+			if found > n {
+				parser.Release(entry)
+				found--
+				continue
+			}
+			last = append(last, entry)
+		}
+	}
+	return last
+}
+
+// parseBlock parses block, which starts at byte offset off of its input,
+// with p and returns the entries that satisfy cfg.process. Their positions
+// under -line-numbers, and the line numbers of the errors sent to errs,
+// are those in the whole input, as counted by lines. stopped reports an
+// error that stops the run.
+func parseBlock(cfg *pipelineConfig, p parser.ContextParser, block []byte, off int64, lines *lineCounter, errs chan<- error) (matched []*parser.LogEntry, stopped bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries, perrs := p.ParseContext(ctx, bytes.NewReader(block))
+	var blockErrs []error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range perrs {
+			blockErrs = append(blockErrs, err)
+		}
+	}()
+
+	first := 0 // the number of the block's first line, once needed
+	firstLine := func() int {
+		if first == 0 {
+			var err error
+			if first, err = lines.lineAt(off); err != nil {
+				first = -1
+			}
+		}
+		return first
+	}
+	for entry := range entries {
+		if !cfg.process(entry) {
+			parser.Release(entry)
+			continue
+		}
+		if cfg.readOpts.Positions {
+			if line, ok := entry.Fields[parser.LineField].(int); ok && firstLine() > 0 {
+				entry.Set(parser.LineField, line+first-1)
+			}
+			if offset, ok := entry.Fields[parser.OffsetField].(int); ok {
+				entry.Set(parser.OffsetField, offset+int(off))
+			}
+		}
+		matched = append(matched, entry)
+	}
+	<-done
+
+	for _, err := range blockErrs {
+		var lineErr *parser.LineError
+		if errors.As(err, &lineErr) && firstLine() > 0 {
+			lineErr.Line += first - 1
+		}
+		errs <- err
+		stopped = stopped || cfg.stopsRun(err)
+	}
+	return matched, stopped
+}
+
+// lineCounter numbers the lines of an input read backwards, counting the
+// newlines before the first line it is asked about and, from there, only
+// those between it and each line asked about after it.
+type lineCounter struct {
+	r    io.ReaderAt
+	at   int64 // the offset of the line numbered line, or -1 before any
+	line int
+}
+
+// lineAt returns the number of the line that starts at byte offset off,
+// which is no later than the offset of the previous call.
+func (c *lineCounter) lineAt(off int64) (int, error) {
+	if c.at < 0 {
+		n, err := countLines(c.r, 0, off)
+		if err != nil {
+			return 0, err
+		}
+		c.at, c.line = off, n+1
+		return c.line, nil
+	}
+	n, err := countLines(c.r, off, c.at)
+	if err != nil {
+		return 0, err
+	}
+	c.at, c.line = off, c.line-n
+	return c.line, nil
+}
+
+// countLines returns the number of newlines in the bytes of r from offset
+// from up to offset to.
+func countLines(r io.ReaderAt, from, to int64) (int, error) {
+	buf := make([]byte, min(to-from, input.DefaultBlockSize))
+	n := 0
+	for from < to {
+		chunk := buf[:min(to-from, int64(len(buf)))]
+		if _, err := r.ReadAt(chunk, from); err != nil && err != io.EOF {
+			return 0, err
+		}
+		n += bytes.Count(chunk, []byte{'\n'})
+		from += int64(len(chunk))
+	}
+	return n, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// bigLog returns n JSON lines, every seventh at level error, with a
+// malformed line after the line numbered bad when it is positive: enough
+// to span several blocks of a backward read.
+func bigLog(n, bad int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		level := "info"
+		if i%7 == 0 {
+			level = "error"
+		}
+		fmt.Fprintf(&b, `{"time":"2024-01-15T10:00:00Z","level":%q,"msg":"m%d"}`+"\n", level, i)
+		if i == bad {
+			b.WriteString("garbage {\n")
+		}
+	}
+	return b.String()
+}
+
+// lowestRead is an io.ReaderAt that records the lowest offset read.
+type lowestRead struct {
+	r      *bytes.Reader
+	lowest int64
+}
+
+func (l *lowestRead) ReadAt(p []byte, off int64) (int, error) {
+	l.lowest = min(l.lowest, off)
+	return l.r.ReadAt(p, off)
+}
+
+func TestLastEntries_ReadsOnlyTheEnd(t *testing.T) {
+	data := []byte(bigLog(30000, 0))
+	cfg, err := newGlobalFlags().config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &lowestRead{r: bytes.NewReader(data), lowest: int64(len(data))}
+	errs := make(chan error, 10)
+	last := lastEntries(cfg, &parser.JSONParser{}, r, int64(len(data)), 3, errs)
+	var msgs []string
+	for _, entry := range last {
+		msgs = append(msgs, entry.Fields["msg"].(string))
+	}
+	if got := strings.Join(msgs, ","); got != "m29998,m29999,m30000" {
+		t.Errorf("msgs = %s", got)
+	}
+	if r.lowest < int64(len(data))-2*input.DefaultBlockSize {
+		t.Errorf("read from offset %d of %d, want only the last block", r.lowest, len(data))
+	}
+	if len(errs) != 0 {
+		t.Errorf("unexpected error %v", <-errs)
+	}
+}
+
+func TestRun_Tail_Backward_MatchesForward(t *testing.T) {
+	path := writeLog(t, bigLog(30000, 29000))
+	// -every 1 keeps every entry but makes the file be read forwards.
+	for _, args := range [][]string{
+		{"-tail", "5", "-filter", "level=error"},
+		{"-tail", "4", "-line-numbers"},
+		{"-tail", "3000", "-line-numbers", "-on-error", "raw"},
+		{"-tail", "50000", "-filter", "msg=m3"},
+	} {
+		args = append([]string{"view", "-input", "json", "-format", "logfmt"}, args...)
+		back, backCode := runCapture(t, append(args, path)...)
+		fwd, fwdCode := runCapture(t, append(args, "-every", "1", path)...)
+		if back != fwd || backCode != fwdCode {
+			t.Errorf("%v: backwards (exit %d):\n%.300s\nforwards (exit %d):\n%.300s", args, backCode, back, fwdCode, fwd)
+		}
+		if back == "" {
+			t.Errorf("%v: no output", args)
+		}
+	}
+}
+
+func TestLineCounter(t *testing.T) {
+	data := "a\nb\nc\nd\ne\n"
+	c := &lineCounter{r: strings.NewReader(data), at: -1}
+	for _, tt := range []struct {
+		off  int64
+		want int
+	}{{6, 4}, {4, 3}, {0, 1}} {
+		if got, err := c.lineAt(tt.off); err != nil || got != tt.want {
+			t.Errorf("lineAt(%d) = %d, %v; want %d", tt.off, got, err, tt.want)
+		}
+	}
+	if n, err := countLines(strings.NewReader(data), 2, 8); n != 3 || err != nil {
+		t.Errorf("countLines(2, 8) = %d, %v; want 3", n, err)
+	}
+}
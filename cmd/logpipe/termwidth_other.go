@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// terminalWidth returns the number of columns of the terminal f is, or 0
+// when f is not a terminal or its size is unknown. The size cannot be
+// asked for on this platform, so only $COLUMNS is consulted.
+func terminalWidth(f *os.File) int {
+	return columnsEnv(f)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// strftimeLayouts maps the strftime directives -time-format accepts to the
+// Go layout elements they stand for.
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'j': "002",
+	'Z': "MST",
+	'z': "-0700",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'R': "15:04",
+	'D': "01/02/06",
+	'L': "000",
+	'f': "000000",
+	'%': "%",
+}
+
+// parseTimeFormat returns the Go layout for the value of -time-format,
+// which is either a Go layout, such as "2006-01-02 15:04:05", or, if it
+// holds a %, a strftime format, such as "%F %T". The fractions of a second
+// %L (milliseconds) and %f (microseconds) must follow a '.' or ',', as Go
+// layouts have them.
+func parseTimeFormat(s string) (string, error) {
+	layout := s
+	if strings.Contains(s, "%") {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] != '%' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i++; i == len(s) {
+				return "", fmt.Errorf("invalid --time-format %q: it ends with a lone %%", s)
+			}
+			elem, ok := strftimeLayouts[s[i]]
+			if !ok {
+				return "", fmt.Errorf("invalid --time-format %q: unsupported directive %%%c", s, s[i])
+			}
+			if (s[i] == 'L' || s[i] == 'f') && (i < 2 || (s[i-2] != '.' && s[i-2] != ',')) {
+				return "", fmt.Errorf("invalid --time-format %q: %%%c must follow '.' or ','", s, s[i])
+			}
+			b.WriteString(elem)
+		}
+		layout = b.String()
+	}
+	// A layout without a single element would write every timestamp the
+	// same.
+	if t := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC); t.Format(layout) == layout {
+		return "", fmt.Errorf("invalid --time-format %q (want a Go layout such as \"2006-01-02 15:04:05\", or strftime such as \"%%F %%T\")", s)
+	}
+	return layout, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+// =============================================================================
+// -time-format and -tz
+// =============================================================================
+
+func TestParseTimeFormat(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"2006-01-02 15:04:05", "2006-01-02 15:04:05", true},
+		{"%F %T", "2006-01-02 15:04:05", true},
+		{"%Y-%m-%dT%H:%M:%S.%L%z", "2006-01-02T15:04:05.000-0700", true},
+		{"%d %b %I:%M %p 100%%", "02 Jan 03:04 PM 100%", true},
+		{"%H:%M:%S,%f", "15:04:05,000000", true},
+		{"%L", "", false},
+		{"%Q", "", false},
+		{"%H%", "", false},
+		{"%%", "", false},
+		{"noon", "", false},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeFormat(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseTimeFormat(%q) = %q, %v, want %q (ok %v)", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRun_TimeFormat(t *testing.T) {
+	path := writeLog(t, `{"time":"2024-07-04T15:30:00.5Z","msg":"a"}
+{"time":"2024-01-15T15:30:00Z","msg":"b"}
+`)
+	out, code := runCapture(t, "view", "-time-format", "%F %T.%L %Z", "-tz", "America/Chicago", "-fields", "none", path)
+	want := "2024-07-04 10:30:00.500 CDT [     ] a\n2024-01-15 09:30:00.000 CST [     ] b\n"
+	if code != 0 || out != want {
+		t.Errorf("output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	// Timestamps without an offset are read in the -assume-tz zone.
+	path = writeLog(t, `{"time":"2024-01-15T09:30:00","msg":"a"}
+{"time":"2024-01-15 09:30:00.25","msg":"b"}
+`)
+	out, code = runCapture(t, "view", "-time-format", "%F %T.%L %Z", "-tz", "America/Chicago", "-assume-tz", "+01:00", "-fields", "none", path)
+	want = "2024-01-15 02:30:00.000 CST [     ] a\n2024-01-15 02:30:00.250 CST [     ] b\n"
+	if code != 0 || out != want {
+		t.Errorf("naive output (exit %d) = %q, want %q", code, out, want)
+	}
+
+	for _, args := range [][]string{
+		{"view", "-tz", "Nowhere/Town", path},
+		{"view", "-time-format", "%Q", path},
+		{"view", "-tz", "UTC", "-format", "logfmt", path},
+		{"view", "-time-format", "%T", "-time-display", "relative", path},
+	} {
+		if _, code := runCapture(t, args...); code != 1 {
+			t.Errorf("%v: exit code = %d, want 1", args, code)
+		}
+	}
+}
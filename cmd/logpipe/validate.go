@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/tylermac92/logpipe/internal/schema"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// invalidPolicy selects what -validate does with an entry that fails the
+// schema.
+type invalidPolicy int
+
+const (
+	invalidReport invalidPolicy = iota // report it and keep it
+	invalidDrop                        // report it and drop it
+	invalidOnly                        // report it and keep only such entries
+)
+
+// String returns the policy's name as accepted by parseInvalidPolicy.
+func (p invalidPolicy) String() string {
+	switch p {
+	case invalidDrop:
+		return "drop"
+	case invalidOnly:
+		return "only"
+	default:
+		return "report"
+	}
+}
+
+// parseInvalidPolicy returns the policy named s: "report", "drop" or
+// "only".
+func parseInvalidPolicy(s string) (invalidPolicy, error) {
+	switch s {
+	case "report":
+		return invalidReport, nil
+	case "drop":
+		return invalidDrop, nil
+	case "only":
+		return invalidOnly, nil
+	default:
+		return 0, fmt.Errorf("unknown policy %q (want report, drop or only)", s)
+	}
+}
+
+// validator checks entries against the -validate schema.
+type validator struct {
+	path   string
+	schema *schema.Schema
+	policy invalidPolicy
+	w      io.Writer // where violations are reported
+
+	checked atomic.Int64 // entries validated so far
+	invalid atomic.Int64 // entries that failed
+}
+
+// loadValidator compiles the JSON Schema in the file at path.
+func loadValidator(path string, policy invalidPolicy) (*validator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema: %w", err)
+	}
+	s, err := schema.Compile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &validator{path: path, schema: s, policy: policy, w: os.Stderr}, nil
+}
+
+// check validates entry, which has already matched, reporting each
+// violation on stderr along with the entry's position among those
+// validated. Whether an invalid entry is kept depends on the policy.
+func (v *validator) check(entry *parser.LogEntry) bool {
+	n := v.checked.Add(1)
+	violations := v.schema.Validate(entry)
+	if len(violations) == 0 {
+		return v.policy != invalidOnly
+	}
+	v.invalid.Add(1)
+	for _, viol := range violations {
+		fmt.Fprintf(v.w, "Invalid entry %d: %s\n", n, viol)
+	}
+	return v.policy != invalidDrop
+}
+
+// failed returns how many entries have failed validation. v may be nil.
+func (v *validator) failed() int64 {
+	if v == nil {
+		return 0
+	}
+	return v.invalid.Load()
+}
+
+// reportInvalid writes the --strict summary of how many entries failed
+// validation to w. It writes nothing when v is nil.
+func (v *validator) reportInvalid(w io.Writer) {
+	if v == nil {
+		return
+	}
+	if n := v.failed(); n == 1 {
+		fmt.Fprintf(w, "1 entry failed validation against %s\n", v.path)
+	} else {
+		fmt.Fprintf(w, "%d entries failed validation against %s\n", n, v.path)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// writeSchema writes src to schema.json in a fresh temporary directory and
+// returns its path.
+func writeSchema(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const levelSchema = `{"type":"object","required":["msg"],"properties":{"level":{"enum":["info","error"]}}}`
+
+// =============================================================================
+// validator
+// =============================================================================
+
+func TestParseInvalidPolicy(t *testing.T) {
+	for _, p := range []invalidPolicy{invalidReport, invalidDrop, invalidOnly} {
+		got, err := parseInvalidPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("parseInvalidPolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := parseInvalidPolicy("keep"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestValidator_Wrap(t *testing.T) {
+	valid := parser.NewEntry(map[string]any{"level": "info", "msg": "a"})
+	invalid := parser.NewEntry(map[string]any{"level": "debug"})
+	unmatched := parser.NewEntry(map[string]any{"level": "trace"})
+	notTrace := func(e *parser.LogEntry) bool { return e.Fields["level"] != "trace" }
+
+	tests := []struct {
+		policy      string
+		wantValid   bool
+		wantInvalid bool
+	}{
+		{"report", true, true},
+		{"drop", true, false},
+		{"only", false, true},
+	}
+	for _, tt := range tests {
+		policy, _ := parseInvalidPolicy(tt.policy)
+		v, err := loadValidator(writeSchema(t, levelSchema), policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stderr bytes.Buffer
+		v.w = &stderr
+		match := (&pipelineConfig{match: notTrace, accept: []stage{v.check}}).process
+		if got := match(valid); got != tt.wantValid {
+			t.Errorf("%s: valid entry matched = %v, want %v", tt.policy, got, tt.wantValid)
+		}
+		if got := match(invalid); got != tt.wantInvalid {
+			t.Errorf("%s: invalid entry matched = %v, want %v", tt.policy, got, tt.wantInvalid)
+		}
+		if match(unmatched) {
+			t.Errorf("%s: entry rejected by the filter matched", tt.policy)
+		}
+		want := "Invalid entry 2: /msg: required property is missing\nInvalid entry 2: /level: value \"debug\" is not one of \"info\", \"error\"\n"
+		if stderr.String() != want {
+			t.Errorf("%s: reported %q, want %q", tt.policy, stderr.String(), want)
+		}
+		if v.failed() != 1 {
+			t.Errorf("%s: failed() = %d, want 1", tt.policy, v.failed())
+		}
+	}
+}
+
+func TestValidator_NilIsANoOp(t *testing.T) {
+	var v *validator
+	if v.failed() != 0 {
+		t.Error("nil validator reported failures")
+	}
+	v.reportInvalid(os.Stderr) // must not panic
+}
+
+func TestLoadValidator_Errors(t *testing.T) {
+	if _, err := loadValidator(filepath.Join(t.TempDir(), "missing.json"), invalidReport); err == nil {
+		t.Error("expected error for a missing schema file")
+	}
+	path := writeSchema(t, `{"type":"text"}`)
+	_, err := loadValidator(path, invalidReport)
+	if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), `unknown type "text"`) {
+		t.Errorf("error = %v, want one naming the file and the problem", err)
+	}
+}
+
+// =============================================================================
+// -validate
+// =============================================================================
+
+func TestRun_Validate(t *testing.T) {
+	schemaPath := writeSchema(t, levelSchema)
+	path := writeLog(t, `{"level":"info","msg":"a"}`+"\n"+`{"level":"debug"}`+"\n"+`{"level":"error","msg":"c"}`+"\n")
+	tests := []struct {
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{[]string{"view", "-validate", schemaPath}, 0, "level=info msg=a\nlevel=debug\nlevel=error msg=c\n"},
+		{[]string{"view", "-validate", schemaPath, "-on-invalid", "drop"}, 0, "level=info msg=a\nlevel=error msg=c\n"},
+		{[]string{"view", "-validate", schemaPath, "-on-invalid", "only"}, 0, "level=debug\n"},
+		{[]string{"view", "-validate", schemaPath, "-strict"}, 1, "level=info msg=a\nlevel=debug\nlevel=error msg=c\n"},
+		{[]string{"view", "-validate", schemaPath, "-strict", "-filter", "level!=debug"}, 0, "level=info msg=a\nlevel=error msg=c\n"},
+		{[]string{"merge", "-validate", schemaPath, "-strict", path}, 1, "level=info msg=a _source=app.log\nlevel=debug _source=app.log\nlevel=error msg=c _source=app.log\n"},
+		{[]string{"view", "-validate", schemaPath, "-on-invalid", "keep"}, 1, ""},
+	}
+	for _, tt := range tests {
+		args := append([]string{tt.args[0], "-format", "logfmt"}, tt.args[1:]...)
+		if tt.args[0] == "view" {
+			args = append(args, path)
+		}
+		out, code := runCapture(t, args...)
+		if code != tt.wantCode {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, code, tt.wantCode)
+		}
+		if out != tt.wantOut {
+			t.Errorf("%v: output = %q, want %q", tt.args, out, tt.wantOut)
+		}
+	}
+}
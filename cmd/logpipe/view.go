@@ -0,0 +1,608 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tylermac92/logpipe/internal/forward"
+	"github.com/tylermac92/logpipe/internal/gelf"
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/internal/logstream"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// runView implements "logpipe view [flags] [file]".
+func runView(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("view", flag.ContinueOnError)
+	g.register(fs)
+	g.registerSinks(fs)
+	filePath := fs.String("file", "", "Path to log file (default: stdin)")
+	noIndex := fs.Bool("no-index", false, "Ignore the sidecar index written by 'logpipe index' and read the whole file")
+	groupBy := groupByFlag(fs)
+	var dd dedupeFlags
+	dd.register(fs)
+	var sf slowestFlags
+	sf.register(fs)
+	var rf replayFlags
+	rf.register(fs)
+	follow := followFlag(fs)
+	listen := fs.String("listen", "", "Receive entries over the network instead of reading a file: forward://host:port (Fluentd forward protocol), grpc://host:port (logpipe.v1.LogStream/Push), or gelf+udp://host:port or gelf+tcp://host:port (Graylog GELF)")
+	var wf windowFlags
+	wf.register(fs)
+	quiet := quietFlag(fs)
+	grepExitSet := grepExitFlag(fs)
+	explainSet := explainFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe view [flags] [file]\n\nFilters and formats the entries of a file, or of stdin when no file is given.\nWith -listen it formats the events Fluentd or Fluent Bit, gRPC clients or\nGELF senders send it instead.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	ge := newGrepExit(*grepExitSet && !*quiet)
+	path, err := fileArg(fs, *filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	var ln listenURL
+	if *listen != "" {
+		switch {
+		case path != "":
+			err = fmt.Errorf("give either a file or --listen, not both")
+		case wf.tail > 0:
+			err = fmt.Errorf("--tail cannot be used with --listen, whose input never ends")
+		case *quiet:
+			err = fmt.Errorf("--quiet cannot be used with --listen")
+		default:
+			ln, err = parseListen(*listen)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+	}
+	if *follow {
+		if err := checkFollow(path, wf, *quiet, *groupBy, sf.n > 0, ln.addr != "", g); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+	}
+	if *groupBy != "" {
+		if err := checkGroupBy(wf, *quiet, ln.addr != "", g.splitBy != ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ge.status(1)
+		}
+	}
+	if err := dd.check(*quiet, *groupBy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := sf.check(wf, *quiet, *groupBy, dd.flag(), ln.addr != ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := rf.check(wf, *quiet, *groupBy, sf.n > 0, ln.addr != ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if err := checkMarkGaps(g.markGaps, *groupBy, sf.n > 0); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	win, err := wf.window()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg.dedupe = newDeduper(dd, cfg.location)
+	cfg.replay = newPacer(rf, cfg.location)
+	if *explainSet {
+		explain(os.Stdout, cfg, plan{inputFormat: g.input, paths: pathList(path), listen: ln, useIndex: !*noIndex, quiet: *quiet, groupBy: *groupBy, slowest: sf, follow: *follow, win: win})
+		return 0
+	}
+	if ln.addr != "" {
+		switch {
+		case g.format == "avro" || g.format == "parquet" || g.format == "loki":
+			fmt.Fprintf(os.Stderr, "Error: --format %s cannot be combined with --listen, which runs until interrupted\n", g.format)
+			return ge.status(1)
+		case g.atomic:
+			fmt.Fprintf(os.Stderr, "Error: --atomic cannot be combined with --listen, which runs until interrupted\n")
+			return ge.status(1)
+		}
+	}
+	if *quiet {
+		return quietMode(cfg, g.input, path, !*noIndex)
+	}
+	if err := cfg.openOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	ge.watch(cfg)
+	if *follow {
+		return ge.status(cfg.closeOutput(followViewMode(cfg, g.input, path, win)))
+	}
+	if ln.addr != "" {
+		return ge.status(cfg.closeOutput(listenMode(cfg, ln, win)))
+	}
+	if *groupBy != "" {
+		return ge.status(cfg.closeOutput(groupMode(cfg, g.input, path, *groupBy, !*noIndex)))
+	}
+	if sf.n > 0 {
+		return ge.status(cfg.closeOutput(slowestMode(cfg, g.input, path, sf, !*noIndex)))
+	}
+	return ge.status(cfg.closeOutput(viewMode(cfg, g.input, path, win, !*noIndex)))
+}
+
+// runStats implements "logpipe stats -field name [flags] [file...]". With
+// more than one file the counts cover all of them.
+func runStats(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	g.registerInput(fs)
+	g.registerFilter(fs)
+	g.registerProfile(fs)
+	field := fs.String("field", "", "Field whose values are counted (required unless -top-frame is given)")
+	topFrame := fs.Bool("top-frame", false, "Count the frames that the stack traces in the stack, error and message fields were raised in, instead of a field's values")
+	var compare multiFlag
+	compareFlag(fs, &compare)
+	statsFormat := statsFormatFlag(fs)
+	statsTemplate := statsTemplateFlag(fs)
+	filePath := fs.String("file", "", "Path to log file (default: stdin)")
+	noIndex := fs.Bool("no-index", false, "Ignore the sidecar index written by 'logpipe index' and read the whole file")
+	grepExitSet := grepExitFlag(fs)
+	explainSet := explainFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe stats -field name|-top-frame [flags] [file...]\n\nPrints how often each value of a field occurs among the matching entries,\nmost frequent first. With -top-frame, it counts the frames their stack\ntraces were raised in instead.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	ge := newGrepExit(*grepExitSet)
+	switch {
+	case *topFrame && *field != "":
+		fmt.Fprintf(os.Stderr, "Error: give either -field or -top-frame, not both\n")
+		return ge.status(1)
+	case *topFrame:
+		*field = topFrameField
+	case *field == "":
+		fs.Usage()
+		return 2
+	}
+	if err := checkStatsFormat(*statsFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if cfg.compare, err = parseCompare(compare, cfg.location); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	cfg.statsFormat = *statsFormat
+	if cfg.statsTemplate, err = loadStatsTemplate(*statsTemplate, *statsFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	ge.watch(cfg)
+	if fs.NArg() > 1 {
+		if *filePath != "" {
+			fmt.Fprintf(os.Stderr, "Error: give the files either with -file or as arguments, not both\n")
+			return ge.status(1)
+		}
+		if *explainSet {
+			explain(os.Stdout, cfg, plan{inputFormat: g.input, paths: fs.Args(), merge: true, statsField: *field})
+			return 0
+		}
+		return ge.status(mergeMode(cfg, g.input, fs.Args(), *field, "", slowestFlags{}, window{}))
+	}
+	path, err := fileArg(fs, *filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ge.status(1)
+	}
+	if *explainSet {
+		explain(os.Stdout, cfg, plan{inputFormat: g.input, paths: pathList(path), useIndex: !*noIndex, statsField: *field})
+		return 0
+	}
+	return ge.status(statsMode(cfg, g.input, path, *field, !*noIndex))
+}
+
+// source is an input opened by openInput, ready to be parsed.
+type source struct {
+	r        io.Reader
+	p        parser.ContextParser
+	closeFn  func() error
+	progress *progressMeter // nil when no progress bar is shown
+	// stdin is set when r is standard input, whose reads may block for as
+	// long as the writer keeps the pipe open.
+	stdin bool
+	// follow is set when r is a followed file, whose reads wait for more
+	// data until it is closed.
+	follow bool
+}
+
+// stderr returns where diagnostics about the parse should be written: the
+// progress bar, when there is one, so that it is cleared first.
+func (s *source) stderr() io.Writer {
+	if s.progress != nil {
+		return s.progress
+	}
+	return os.Stderr
+}
+
+// settle waits, with the drainErrors function wait, for a cancelled parse of
+// s to stop and returns wait's result. On stdin the parser may be blocked
+// in a read that cancellation cannot interrupt, so it is abandoned for the
+// process exit to clean up instead; a followed file is closed, which ends
+// the read it waits in.
+func (s *source) settle(wait func() bool) bool {
+	switch {
+	case s.stdin:
+		return false
+	case s.follow:
+		s.closeFn()
+	}
+	return wait()
+}
+
+// close removes the progress bar and releases the file.
+func (s *source) close() error {
+	s.progress.stop()
+	return s.closeFn()
+}
+
+// openInput opens the file at path, or stdin when path is empty, and
+// returns it together with the parser for inputFormat ("auto" to detect
+// it). Input compressed with gzip, zstd or bzip2 is decompressed as it is
+// read. Regular files are memory-mapped when possible, and when useIndex is
+// set a fresh sidecar index restricts reading to the blocks that can match
+// cfg's filters. When showProgress is set, the whole file is to be read and
+// stderr is a terminal, a progress bar is drawn there until the source is
+// closed.
+func openInput(cfg *pipelineConfig, inputFormat, path string, useIndex, showProgress bool) (*source, error) {
+	src := &source{stdin: true}
+	var f io.ReadCloser = io.NopCloser(os.Stdin)
+	if path != "" {
+		var err error
+		if f, err = input.Open(path); err != nil {
+			return nil, fmt.Errorf("opening file: %w", err)
+		}
+		src.stdin = false
+	}
+	dr, err := input.Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	src.r, src.closeFn = dr, dr.Close
+	compressed := input.IsCompressed(dr)
+
+	if path != "" && useIndex && !compressed && cfg.plugins.parser() == nil && !cfg.readOpts.Positions && cfg.levels == nil && !cfg.plugins.transformsEntries() && !cfg.multiline() && !cfg.readsHeader(inputFormat) && !cfg.strict {
+		// A fresh sidecar index lets us read only the blocks that can
+		// contain a match. Skipping blocks would lose count of the lines,
+		// the index records fields as written, not as -level-map or a
+		// transform plugin rewrites them, its blocks may split the entries
+		// of -multiline-start, the block with a CSV header may be skipped,
+		// and -strict must see the malformed lines of every block.
+		if ir, indexed, ok := indexedReader(path, f, cfg.filters); ok {
+			src.r = ir
+			showProgress = false
+			if inputFormat == "auto" {
+				inputFormat = indexed
+			}
+		}
+	}
+
+	opts := cfg.readOptsFor(path)
+	var total int64
+	if showProgress && path != "" && !compressed && isTerminal(os.Stderr) {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			opts.Progress = &parser.Progress{}
+			total = info.Size()
+		}
+	}
+	r, p, _, err := cfg.parserFor(src.r, inputFormat, opts)
+	if err != nil {
+		src.closeFn()
+		return nil, err
+	}
+	src.r, src.p = r, p
+	if opts.Progress != nil {
+		src.progress = startProgress(os.Stderr, total, opts.Progress)
+		if cfg.validator != nil {
+			// Keep violations from being drawn over by the bar.
+			cfg.validator.w = src.progress
+		}
+	}
+	return src, nil
+}
+
+// detectParser returns the parser for inputFormat, sniffing the format from
+// r when it is "auto", together with the reader the parser should consume
+// and the name of the format chosen.
+func detectParser(r io.Reader, inputFormat string, opts parser.ReadOptions) (io.Reader, parser.ContextParser, string, error) {
+	if inputFormat == "auto" {
+		detected, sniffed, err := sniffFormat(r)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("detecting input format: %w", err)
+		}
+		r, inputFormat = sniffed, detected
+	}
+	p, err := newParser(inputFormat, opts)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return r, p, inputFormat, nil
+}
+
+// drainErrors prints the parse errors from errs as they arrive so
+// they never block the entry channel. The returned wait function blocks
+// until errs is closed and reports whether the errors make the run fail:
+// parsing was stopped early (see pipelineConfig.stopsRun), or any error was
+// reported under --strict, as is any entry failing --validate. Under
+// --strict it also prints how many lines were skipped and how many entries
+// failed validation. Errors are written to w.
+func drainErrors(cfg *pipelineConfig, errs <-chan error, w io.Writer) (wait func() bool) {
+	var stoppedEarly bool
+	var reported, skipped int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errs {
+			fmt.Fprintf(w, "Error parsing log: %v\n", err)
+			if cfg.stopsRun(err) {
+				stoppedEarly = true
+			}
+			reported++
+			if cfg.skipsLine(err) {
+				skipped++
+			}
+		}
+	}()
+	return func() bool {
+		<-done
+		if !cfg.strict {
+			return stoppedEarly
+		}
+		reportSkipped(w, skipped)
+		cfg.validator.reportInvalid(w)
+		return stoppedEarly || reported > 0 || cfg.validator.failed() > 0
+	}
+}
+
+// reportSkipped writes the --strict summary of how many input lines were
+// skipped because of parse errors to w.
+func reportSkipped(w io.Writer, n int) {
+	if n == 1 {
+		fmt.Fprintf(w, "1 line skipped due to parse errors\n")
+	} else {
+		fmt.Fprintf(w, "%d lines skipped due to parse errors\n", n)
+	}
+}
+
+// viewMode formats the entries of path (stdin when empty) that match cfg's
+// filters and fall within win to stdout. A tail window of a file is read
+// backwards from its end when cfg allows.
+func viewMode(cfg *pipelineConfig, inputFormat, path string, win window, useIndex bool) int {
+	if win.tail > 0 && path != "" && cfg.readsBackward() && !cfg.readsHeader(inputFormat) {
+		if exitCode, ok := tailMode(cfg, inputFormat, path, win.tail); ok {
+			return exitCode
+		}
+	}
+	// Entries written to the terminal would be interleaved with the bar,
+	// so progress is shown only while stdout is redirected.
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress && !isTerminal(os.Stdout))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	exitCode := formatStream(cfg, src, win)
+	src.close()
+	return exitCode
+}
+
+// listenURL is a parsed -listen URL: the protocol to receive entries
+// with, "forward", "grpc", "gelf+udp" or "gelf+tcp", and the address to
+// listen on.
+type listenURL struct {
+	scheme, addr string
+}
+
+// listenSchemes are the schemes a -listen URL may use.
+var listenSchemes = []string{"forward", "grpc", "gelf+udp", "gelf+tcp"}
+
+// parseListen parses the -listen URL s, which must use one of the
+// listenSchemes. The port may be left out to use the protocol's usual one.
+func parseListen(s string) (listenURL, error) {
+	scheme, addr, ok := strings.Cut(s, "://")
+	if !ok || !slices.Contains(listenSchemes, scheme) || addr == "" || strings.Contains(addr, "/") {
+		return listenURL{}, fmt.Errorf("invalid --listen %q (want forward://, grpc://, gelf+udp:// or gelf+tcp:// and host:port)", s)
+	}
+	return listenURL{scheme, addr}, nil
+}
+
+// receiver is a server that entries are received from with -listen.
+type receiver interface {
+	Addr() net.Addr
+	Receive(ctx context.Context) (<-chan *parser.LogEntry, <-chan error)
+}
+
+// listenMode formats the matching events received on u until it is
+// interrupted or, with a head window, the window is full.
+func listenMode(cfg *pipelineConfig, u listenURL, win window) int {
+	var (
+		srv   receiver
+		err   error
+		proto string
+	)
+	switch u.scheme {
+	case "grpc":
+		srv, err = logstream.Listen(u.addr)
+		proto = "gRPC"
+	case "gelf+udp":
+		srv, err = gelf.Listen("udp", u.addr)
+		proto = "GELF over UDP"
+	case "gelf+tcp":
+		srv, err = gelf.Listen("tcp", u.addr)
+		proto = "GELF over TCP"
+	default:
+		srv, err = forward.Listen(u.addr)
+		proto = "the forward protocol"
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Listening for %s on %s\n", proto, srv.Addr())
+	return receiveStream(cfg, srv, win)
+}
+
+// receiveStream formats the matching events srv receives within win to
+// stdout, and returns the exit code. Problems with a connection are
+// reported on stderr and only make the run fail under --strict.
+func receiveStream(cfg *pipelineConfig, srv receiver, win window) (exitCode int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries, errs := srv.Receive(ctx)
+	wait := drainErrors(cfg, errs, os.Stderr)
+
+	entries, match := cfg.deduped(ctx, entries)
+	entries, match = cfg.align.aligned(ctx, entries, match)
+	limited, failed := emitWindow(os.Stdout, entries, match, cfg.formatter, win)
+	if failed {
+		exitCode = 1
+	}
+	if limited {
+		cancel()
+		// Drain what the connections were sending so they can close.
+		for entry := range entries {
+			parser.Release(entry)
+		}
+	}
+	if wait() {
+		exitCode = 1
+	}
+	return exitCode
+}
+
+// quietMode reports whether any entry of path (stdin when empty) matches
+// cfg's filters, in the manner of grep -q: it prints no entries and returns
+// 0 as soon as one matches, 1 when none do, and 2 when the input cannot be
+// opened. Parse errors are still reported on stderr.
+func quietMode(cfg *pipelineConfig, inputFormat, path string, useIndex bool) int {
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer src.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entries, errs := src.p.ParseContext(ctx, src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+	if anyMatch(entries, cfg.process) {
+		// Stop the parser rather than read the rest of the input.
+		cancel()
+		src.settle(wait)
+		return 0
+	}
+	wait()
+	return 1
+}
+
+// formatStream parses src and formats the matching entries within win to
+// stdout, and returns the exit code. Once a head window is full the parser
+// is cancelled instead of reading the rest of the input.
+func formatStream(cfg *pipelineConfig, src *source, win window) (exitCode int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries, errs := src.p.ParseContext(ctx, src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+
+	entries, match := cfg.deduped(ctx, cfg.alerts.watch(ctx, entries))
+	entries, match = cfg.replay.paced(ctx, entries, match)
+	entries, match = cfg.align.aligned(ctx, entries, match)
+	limited, failed := emitWindow(os.Stdout, entries, match, cfg.formatter, win)
+	if failed {
+		exitCode = 1
+	}
+	if limited {
+		cancel()
+		if src.settle(wait) {
+			exitCode = 1
+		}
+	} else if wait() {
+		exitCode = 1
+	}
+	return exitCode
+}
+
+// statsMode prints the frequency table of field's values among the entries
+// of path (stdin when empty) that match cfg's filters.
+func statsMode(cfg *pipelineConfig, inputFormat, path, field string, useIndex bool) int {
+	src, err := openInput(cfg, inputFormat, path, useIndex, cfg.progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	entries, errs := src.p.Parse(src.r)
+	wait := drainErrors(cfg, errs, src.stderr())
+	writeTable := tabulate(cfg, entries, field)
+	failed := wait()
+	src.close()
+	if err := writeTable(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		failed = true
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// tabulate drains entries and counts the values of field among those that
+// satisfy cfg.process, in a column for each -compare filter when there are
+// any. It returns the function that writes the table to stdout in
+// cfg.statsFormat, or rendered with cfg.statsTemplate when there is one.
+func tabulate(cfg *pipelineConfig, entries <-chan *parser.LogEntry, field string) (write func() error) {
+	if len(cfg.compare) > 0 {
+		rows := collectComparedStats(entries, cfg.process, field, cfg.compare)
+		return func() error { return cfg.writeComparedStats(os.Stdout, field, rows) }
+	}
+	stats := collectStats(entries, cfg.process, field)
+	return func() error { return cfg.writeStats(os.Stdout, field, stats) }
+}
+
+// writeStats writes the stats table of field's values to w in
+// cfg.statsFormat, or rendered with cfg.statsTemplate when there is one.
+func (cfg *pipelineConfig) writeStats(w io.Writer, field string, stats []statEntry) error {
+	if cfg.statsTemplate != nil {
+		return executeStatsTemplate(w, cfg.statsTemplate, field, stats)
+	}
+	return printStats(w, cfg.statsFormat, field, stats)
+}
+
+// writeComparedStats is writeStats for a table with cfg.compare columns.
+func (cfg *pipelineConfig) writeComparedStats(w io.Writer, field string, rows []comparedStat) error {
+	if cfg.statsTemplate != nil {
+		return executeComparedStatsTemplate(w, cfg.statsTemplate, field, cfg.compare, rows)
+	}
+	return printComparedStats(w, cfg.statsFormat, field, cfg.compare, rows)
+}
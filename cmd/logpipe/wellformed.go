@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/tylermac92/logpipe/internal/input"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// runValidate implements "logpipe validate [flags] [file]": it parses the
+// whole input, reports how well-formed it is, and fails when too many of
+// its lines are malformed.
+func runValidate(g *globalFlags, args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	g.registerInput(fs)
+	g.registerProfile(fs)
+	filePath := fs.String("file", "", "Path to log file (default: stdin)")
+	examples := fs.Int("examples", 3, "Number of example lines shown for each type of error")
+	maxRate := fs.Float64("max-error-rate", 0, "Largest percentage of malformed lines that still passes, such as 0.5")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logpipe validate [flags] [file]\n\nParses every line of a file, or of stdin when no file is given, and\nprints how many are well-formed and what is wrong with the rest. It exits\n1 when the percentage of malformed lines is above -max-error-rate.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return 2
+	}
+	path, err := fileArg(fs, *filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	switch {
+	case *examples < 0:
+		err = fmt.Errorf("--examples must not be negative")
+	case *maxRate < 0 || *maxRate > 100 || math.IsNaN(*maxRate):
+		err = fmt.Errorf("--max-error-rate must be a percentage from 0 to 100")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	cfg, err := g.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return validateMode(cfg, g.input, path, *examples, *maxRate)
+}
+
+// validateMode parses path (stdin when empty) and writes a report of its
+// malformed lines to stdout. It returns 1 when more than maxRate percent
+// of the lines are malformed, and 2 when the input cannot be read.
+func validateMode(cfg *pipelineConfig, inputFormat, path string, examples int, maxRate float64) int {
+	var f io.ReadCloser = io.NopCloser(os.Stdin)
+	name := "stdin"
+	if path != "" {
+		var err error
+		if f, err = input.Open(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: opening file: %v\n", err)
+			return 2
+		}
+		name = path
+	}
+	dr, err := input.Decompress(f)
+	if err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "Error: reading %s: %v\n", name, err)
+		return 2
+	}
+	defer dr.Close()
+
+	// Every malformed line is reported rather than kept, truncated or
+	// taken leniently, and repeated keys count against the line.
+	opts := cfg.readOpts
+	opts.OnError = parser.ErrorSkip
+	opts.Oversize = parser.OversizeSkip
+	opts.KeepRaw = false
+	opts.StrictLogfmt = true
+	opts.ReportDuplicates = true
+	r, p, format, err := cfg.parserFor(dr, inputFormat, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	rep := newValidateReport(examples)
+	entries, errs := p.Parse(r)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errs {
+			rep.addError(err)
+		}
+	}()
+	for entry := range entries {
+		rep.entries++
+		parser.Release(entry)
+	}
+	<-done
+
+	rep.write(os.Stdout, name, format)
+	if rep.readErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", rep.readErr)
+		return 2
+	}
+	if rep.rate() > maxRate {
+		fmt.Fprintf(os.Stderr, "%.2f%% of lines are malformed, above the limit of %g%%\n", rep.rate(), maxRate)
+		return 1
+	}
+	return 0
+}
+
+// errorClass is one type of malformed line in a validate report.
+type errorClass struct {
+	name     string
+	count    int
+	examples []string
+}
+
+// validateReport tallies the well-formed entries and the malformed lines
+// of one input, keeping the first few examples of each type of error.
+type validateReport struct {
+	entries    int // entries parsed, including those with repeated keys
+	duplicates int // lines that parsed but repeat a key
+	malformed  int // lines that could not be parsed
+	classes    map[string]*errorClass
+	examples   int
+	readErr    error // a failure reading the input, which ends the report early
+}
+
+// newValidateReport returns an empty report that keeps examples examples
+// of each type of error.
+func newValidateReport(examples int) *validateReport {
+	return &validateReport{classes: make(map[string]*errorClass), examples: examples}
+}
+
+// addError records err, an error from the parser.
+func (rep *validateReport) addError(err error) {
+	var lineErr *parser.LineError
+	if !errors.As(err, &lineErr) {
+		rep.readErr = err
+		return
+	}
+	name := classifyLineError(lineErr)
+	if name == "duplicate key" {
+		rep.duplicates++
+	} else {
+		rep.malformed++
+	}
+	c := rep.classes[name]
+	if c == nil {
+		c = &errorClass{name: name}
+		rep.classes[name] = c
+	}
+	c.count++
+	if len(c.examples) < rep.examples {
+		c.examples = append(c.examples, err.Error())
+	}
+}
+
+// classifyLineError names the type of problem err reports.
+func classifyLineError(err *parser.LineError) string {
+	var syntaxErr *parser.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, parser.ErrLineTooLong):
+		return "line too long"
+	case errors.Is(err, parser.ErrDuplicateKey):
+		return "duplicate key"
+	case errors.As(err, &syntaxErr):
+		return "invalid logfmt"
+	case errors.As(err, &typeErr):
+		return "not a JSON object"
+	default:
+		return "invalid JSON"
+	}
+}
+
+// lines returns the number of non-blank lines read.
+func (rep *validateReport) lines() int {
+	return rep.entries + rep.malformed
+}
+
+// invalid returns the number of lines with any problem.
+func (rep *validateReport) invalid() int {
+	return rep.malformed + rep.duplicates
+}
+
+// rate returns the percentage of lines with a problem.
+func (rep *validateReport) rate() float64 {
+	if rep.lines() == 0 {
+		return 0
+	}
+	return 100 * float64(rep.invalid()) / float64(rep.lines())
+}
+
+// write writes the report on the input called name, parsed as format, to
+// w: the totals, then each type of error, most frequent first, with its
+// examples.
+func (rep *validateReport) write(w io.Writer, name, format string) {
+	fmt.Fprintf(w, "%s (%s): %d lines, %d valid entries, %d invalid (%.2f%%)\n",
+		name, format, rep.lines(), rep.lines()-rep.invalid(), rep.invalid(), rep.rate())
+	classes := make([]*errorClass, 0, len(rep.classes))
+	for _, c := range rep.classes {
+		classes = append(classes, c)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].count != classes[j].count {
+			return classes[i].count > classes[j].count
+		}
+		return classes[i].name < classes[j].name
+	})
+	for _, c := range classes {
+		fmt.Fprintf(w, "\n%s: %d\n", c.name, c.count)
+		for _, ex := range c.examples {
+			fmt.Fprintf(w, "  %s\n", ex)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// Package filter provides log entry filtering based on field values.
+// Filters are composed from simple field expressions, which can be negated
+// and combined into AND and OR filters.
+package filter
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// Filter is the interface implemented by all log entry filters.
+// Match returns true when the given entry satisfies the filter condition.
+type Filter interface {
+	Match(entry *parser.LogEntry) bool
+}
+
+// FieldFilter matches log entries by comparing a named field against a
+// constant value using a specific operator.
+type FieldFilter struct {
+	re         *regexp.Regexp // Compiled regex, populated only for the ~ operator.
+	lower      string         // Value in lower case, for the *= operator.
+	network    netip.Prefix   // Value as a network, set when cidr.
+	cidr       bool           // Whether the comparison is of an IP address with a network.
+	at         time.Time      // Value as a timestamp, set when timed.
+	dur        time.Duration  // Value as a duration, set when durational.
+	durational bool           // Whether the comparison is between durations.
+	timed      bool           // Whether the comparison is between timestamps.
+	loc        *time.Location // Zone of timestamps without a UTC offset.
+	Field      string         // Name of the log field to inspect.
+	Operator   string         // Comparison operator (=, !=, >, <, >=, <=, ~, *=), or ? or ! for presence.
+	Value      string         // The value to compare against.
+}
+
+// NewFieldFilter parses a filter expression of the form "field<op>value" and
+// returns a FieldFilter. Supported operators, in precedence order:
+//
+//	!=   not equal
+//	*=   contains, ignoring case
+//	~    regex match
+//	>=   greater-than-or-equal (lexicographic)
+//	<=   less-than-or-equal (lexicographic)
+//	=    equal
+//	>    greater-than (lexicographic)
+//	<    less-than (lexicographic)
+//
+// An expression may also test whether a field is present at all: "field?"
+// matches the entries that have the field, whatever its value, and "!field"
+// those that do not.
+//
+// When the value of a >, <, >= or <= comparison is a timestamp, as
+// parser.ParseTime understands it, the comparison is instead between
+// instants, so that timestamps with different UTC offsets are ordered
+// correctly; entries whose field is not a timestamp then never match.
+// Timestamps without an offset are taken to be in UTC.
+//
+// Likewise, when the value of a >, <, >= or <= comparison is a duration
+// with a unit, as time.ParseDuration understands it, such as "250ms" or
+// "1m30s", the comparison is between durations: the field may hold a
+// duration with a unit or a number of seconds, so that "latency>250ms"
+// matches both "1.2s" and 0.3. Entries whose field is neither then never
+// match.
+//
+// When the value of an = or != comparison is "cidr:" followed by a network
+// in CIDR notation, as in "client_ip=cidr:10.0.0.0/8", the field is instead
+// taken as an IP address, optionally with a port, and the filter matches
+// the entries whose address is inside the network, or outside it for !=;
+// entries whose field is not an IP address then never match.
+//
+// Returns an error if the expression contains no recognised operator, if
+// the ~ operator is paired with an invalid regular expression, or if a
+// "cidr:" value is not a valid network.
+func NewFieldFilter(expression string) (*FieldFilter, error) {
+	return NewFieldFilterIn(expression, time.UTC)
+}
+
+// NewFieldFilterIn is like NewFieldFilter but takes timestamps without a
+// UTC offset, in the expression and in log entries, to be in loc.
+func NewFieldFilterIn(expression string, loc *time.Location) (*FieldFilter, error) {
+	// Operators are checked in this order so that multi-character operators
+	// (e.g. "!=", ">=") are matched before their single-character prefixes.
+	operators := []string{"!=", "*=", "~", ">=", "<=", "=", ">", "<"}
+
+	// "field?" and "!field" name a field and nothing more.
+	if field, ok := strings.CutSuffix(expression, "?"); ok && field != "" && !strings.ContainsAny(field, "!=~<>") {
+		return newFieldFilter(field, "?", "", loc)
+	}
+	if field, ok := strings.CutPrefix(expression, "!"); ok && field != "" && !strings.ContainsAny(field, "!=~<>") {
+		return newFieldFilter(field, "!", "", loc)
+	}
+
+	for _, op := range operators {
+		idx := strings.Index(expression, op)
+		if idx == -1 {
+			continue
+		}
+		return newFieldFilter(expression[:idx], op, expression[idx+len(op):], loc)
+	}
+
+	return nil, fmt.Errorf("invalid filter expression: %s", expression)
+}
+
+// newFieldFilter returns the FieldFilter comparing field with value by op,
+// one of the operators of NewFieldFilter, or testing that field is present
+// when op is "?" and absent when op is "!".
+func newFieldFilter(field, op, value string, loc *time.Location) (*FieldFilter, error) {
+	f := &FieldFilter{
+		loc:      loc,
+		Field:    field,
+		Operator: op,
+		Value:    value,
+	}
+	switch op {
+	case ">", "<", ">=", "<=":
+		f.at, _, f.timed = parser.ParseTime(value, loc)
+		if !f.timed && strings.ContainsFunc(value, unicode.IsLetter) {
+			d, err := time.ParseDuration(value)
+			f.dur, f.durational = d, err == nil
+		}
+	}
+
+	if op == "*=" {
+		f.lower = strings.ToLower(value)
+	}
+
+	if cidr, ok := strings.CutPrefix(value, "cidr:"); ok && (op == "=" || op == "!=") {
+		network, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network in filter: %w", err)
+		}
+		f.network, f.cidr = network.Masked(), true
+	}
+
+	if op == "~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in filter: %w", err)
+		}
+		f.re = re
+	}
+
+	return f, nil
+}
+
+// Match returns true when the entry's field satisfies the filter condition.
+// The field value is converted to a string via fmt.Sprintf before comparison,
+// so numeric and boolean field values are supported. Entries that do not
+// contain the target field match only the "!field" form. A dotted field
+// name reaches into nested objects and arrays, as parser.LogEntry.Lookup
+// describes.
+func (f *FieldFilter) Match(entry *parser.LogEntry) bool {
+	value, exists := entry.Lookup(f.Field)
+	switch f.Operator {
+	case "?":
+		return exists
+	case "!":
+		return !exists
+	}
+	if !exists {
+		return false
+	}
+	if f.timed {
+		return f.matchTime(fmt.Sprintf("%v", value))
+	}
+	if f.durational {
+		return f.matchDuration(fmt.Sprintf("%v", value))
+	}
+	if f.cidr {
+		return f.matchNetwork(fmt.Sprintf("%v", value))
+	}
+
+	switch f.Operator {
+	case "=":
+		return fmt.Sprintf("%v", value) == f.Value
+	case "!=":
+		return fmt.Sprintf("%v", value) != f.Value
+	case ">":
+		return fmt.Sprintf("%v", value) > f.Value
+	case "<":
+		return fmt.Sprintf("%v", value) < f.Value
+	case ">=":
+		return fmt.Sprintf("%v", value) >= f.Value
+	case "<=":
+		return fmt.Sprintf("%v", value) <= f.Value
+	case "~":
+		return f.re.MatchString(fmt.Sprintf("%v", value))
+	case "*=":
+		return strings.Contains(strings.ToLower(fmt.Sprintf("%v", value)), f.lower)
+	default:
+		return false
+	}
+}
+
+// matchTime compares the timestamp s with the filter's.
+func (f *FieldFilter) matchTime(s string) bool {
+	t, _, ok := parser.ParseTime(s, f.loc)
+	if !ok {
+		return false
+	}
+	switch f.Operator {
+	case ">":
+		return t.After(f.at)
+	case "<":
+		return t.Before(f.at)
+	case ">=":
+		return !t.Before(f.at)
+	case "<=":
+		return !t.After(f.at)
+	default:
+		return false
+	}
+}
+
+// matchDuration compares the duration s, with a unit or a number of
+// seconds, with the filter's.
+func (f *FieldFilter) matchDuration(s string) bool {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(secs) || math.Abs(secs) > math.MaxInt64/float64(time.Second) {
+			return false
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	switch f.Operator {
+	case ">":
+		return d > f.dur
+	case "<":
+		return d < f.dur
+	case ">=":
+		return d >= f.dur
+	case "<=":
+		return d <= f.dur
+	default:
+		return false
+	}
+}
+
+// matchNetwork reports whether the IP address s, which may carry a port,
+// is inside the filter's network, or outside it for !=.
+func (f *FieldFilter) matchNetwork(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		ap, err := netip.ParseAddrPort(s)
+		if err != nil {
+			return false
+		}
+		addr = ap.Addr()
+	}
+	return f.network.Contains(addr.Unmap()) == (f.Operator == "=")
+}
+
+// Network returns the network the filter's value denotes and true when the
+// filter matches IP addresses against a network, as described on
+// NewFieldFilter.
+func (f *FieldFilter) Network() (netip.Prefix, bool) {
+	return f.network, f.cidr
+}
+
+// Duration returns the duration the filter's value denotes and true when
+// the filter compares durations, as described on NewFieldFilter.
+func (f *FieldFilter) Duration() (time.Duration, bool) {
+	return f.dur, f.durational
+}
+
+// Time returns the instant the filter's value denotes and true when the
+// filter compares timestamps, as described on NewFieldFilter.
+func (f *FieldFilter) Time() (time.Time, bool) {
+	return f.at, f.timed
+}
+
+// String returns the filter as an expression of the form accepted by
+// NewFieldFilter.
+func (f *FieldFilter) String() string {
+	switch f.Operator {
+	case "?":
+		return f.Field + "?"
+	case "!":
+		return "!" + f.Field
+	}
+	return f.Field + f.Operator + f.Value
+}
+
+// CompositeFilter combines multiple filters with logical AND semantics:
+// an entry must satisfy every child filter to be considered a match.
+type CompositeFilter struct {
+	filters []Filter
+}
+
+// NewCompositeFilter returns a CompositeFilter that requires all provided
+// filters to match. Passing zero filters creates a filter that matches
+// every entry.
+func NewCompositeFilter(filters ...Filter) *CompositeFilter {
+	return &CompositeFilter{filters: filters}
+}
+
+// Filters returns the child filters.
+func (cf *CompositeFilter) Filters() []Filter {
+	return cf.filters
+}
+
+// String returns the child filters joined with " AND ", or "*" when there
+// are none and every entry matches. OrFilter children are parenthesized,
+// and children that do not implement fmt.Stringer are shown by type.
+func (cf *CompositeFilter) String() string {
+	if len(cf.filters) == 0 {
+		return "*"
+	}
+	parts := make([]string, len(cf.filters))
+	for i, f := range cf.filters {
+		_, or := f.(*OrFilter)
+		parts[i] = operand(f, or)
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// operand returns f as a String operand of AND, OR or NOT, in parentheses
+// when parens is set.
+func operand(f Filter, parens bool) string {
+	s, ok := f.(fmt.Stringer)
+	switch {
+	case !ok:
+		return fmt.Sprintf("%T", f)
+	case parens:
+		return "(" + s.String() + ")"
+	}
+	return s.String()
+}
+
+// Match returns true only if every child filter matches the entry.
+// An empty CompositeFilter always returns true.
+func (cf *CompositeFilter) Match(entry *parser.LogEntry) bool {
+	for _, filter := range cf.filters {
+		if !filter.Match(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// OrFilter combines multiple filters with logical OR semantics: an entry
+// must satisfy at least one child filter to be considered a match.
+type OrFilter struct {
+	filters []Filter
+}
+
+// NewOrFilter returns an OrFilter that requires any of the provided filters
+// to match. Passing zero filters creates a filter that matches no entry.
+func NewOrFilter(filters ...Filter) *OrFilter {
+	return &OrFilter{filters: filters}
+}
+
+// Filters returns the child filters.
+func (of *OrFilter) Filters() []Filter {
+	return of.filters
+}
+
+// String returns the child filters joined with " OR ". Children that do
+// not implement fmt.Stringer are shown by type.
+func (of *OrFilter) String() string {
+	parts := make([]string, len(of.filters))
+	for i, f := range of.filters {
+		parts[i] = operand(f, false)
+	}
+	return strings.Join(parts, " OR ")
+}
+
+// Match returns true if any child filter matches the entry. An empty
+// OrFilter always returns false.
+func (of *OrFilter) Match(entry *parser.LogEntry) bool {
+	for _, filter := range of.filters {
+		if filter.Match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotFilter negates another filter: an entry matches when it does not
+// satisfy the wrapped filter. Unlike a != comparison, it therefore matches
+// entries that lack the wrapped filter's field.
+type NotFilter struct {
+	filter Filter
+}
+
+// NewNotFilter returns a NotFilter matching the entries f does not.
+func NewNotFilter(f Filter) *NotFilter {
+	return &NotFilter{filter: f}
+}
+
+// Filter returns the negated filter.
+func (nf *NotFilter) Filter() Filter {
+	return nf.filter
+}
+
+// String returns the negated filter prefixed with "NOT ", in parentheses
+// when it combines others.
+func (nf *NotFilter) String() string {
+	switch nf.filter.(type) {
+	case *OrFilter, *CompositeFilter:
+		return "NOT " + operand(nf.filter, true)
+	}
+	return "NOT " + operand(nf.filter, false)
+}
+
+// Match returns true when the negated filter does not match the entry.
+func (nf *NotFilter) Match(entry *parser.LogEntry) bool {
+	return !nf.filter.Match(entry)
+}
@@ -0,0 +1,796 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// NewFieldFilter — expression parsing
+// =============================================================================
+
+func TestNewFieldFilter_Equal(t *testing.T) {
+	f, err := NewFieldFilter("level=error")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Field != "level" {
+		t.Errorf("field: got %q, want %q", f.Field, "level")
+	}
+	if f.Operator != "=" {
+		t.Errorf("operator: got %q, want %q", f.Operator, "=")
+	}
+	if f.Value != "error" {
+		t.Errorf("value: got %q, want %q", f.Value, "error")
+	}
+}
+
+func TestNewFieldFilter_NotEqual(t *testing.T) {
+	f, err := NewFieldFilter("level!=info")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != "!=" {
+		t.Errorf("operator: got %q, want %q", f.Operator, "!=")
+	}
+	if f.Field != "level" {
+		t.Errorf("field: got %q, want %q", f.Field, "level")
+	}
+	if f.Value != "info" {
+		t.Errorf("value: got %q, want %q", f.Value, "info")
+	}
+}
+
+func TestNewFieldFilter_GreaterThanOrEqual(t *testing.T) {
+	f, err := NewFieldFilter("count>=10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != ">=" {
+		t.Errorf("operator: got %q, want %q", f.Operator, ">=")
+	}
+	if f.Field != "count" {
+		t.Errorf("field: got %q, want %q", f.Field, "count")
+	}
+	if f.Value != "10" {
+		t.Errorf("value: got %q, want %q", f.Value, "10")
+	}
+}
+
+func TestNewFieldFilter_LessThanOrEqual(t *testing.T) {
+	f, err := NewFieldFilter("count<=5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != "<=" {
+		t.Errorf("operator: got %q, want %q", f.Operator, "<=")
+	}
+}
+
+func TestNewFieldFilter_GreaterThan(t *testing.T) {
+	f, err := NewFieldFilter("count>5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != ">" {
+		t.Errorf("operator: got %q, want %q", f.Operator, ">")
+	}
+}
+
+func TestNewFieldFilter_LessThan(t *testing.T) {
+	f, err := NewFieldFilter("count<5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != "<" {
+		t.Errorf("operator: got %q, want %q", f.Operator, "<")
+	}
+}
+
+func TestNewFieldFilter_Regex(t *testing.T) {
+	f, err := NewFieldFilter("msg~error.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != "~" {
+		t.Errorf("operator: got %q, want %q", f.Operator, "~")
+	}
+	if f.re == nil {
+		t.Error("expected compiled regex, got nil")
+	}
+}
+
+func TestNewFieldFilter_Regex_FieldAndValueParsed(t *testing.T) {
+	f, err := NewFieldFilter("msg~^fatal:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Field != "msg" {
+		t.Errorf("field: got %q, want %q", f.Field, "msg")
+	}
+	if f.Value != "^fatal:" {
+		t.Errorf("value: got %q, want %q", f.Value, "^fatal:")
+	}
+}
+
+// The operator scan order is: "!=", "~", ">=", "<=", "=", ">", "<".
+// NotEqual must be tried before Equal so "level!=error" is parsed correctly.
+func TestNewFieldFilter_NotEqualTakesPriorityOverEqual(t *testing.T) {
+	f, err := NewFieldFilter("level!=error")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != "!=" {
+		t.Errorf("operator: got %q, want %q — NotEqual must take priority over Equal", f.Operator, "!=")
+	}
+	if f.Field != "level" {
+		t.Errorf("field: got %q, want %q", f.Field, "level")
+	}
+	if f.Value != "error" {
+		t.Errorf("value: got %q, want %q", f.Value, "error")
+	}
+}
+
+// ">=" must be tried before ">" so "count>=10" is not misread as field="count>", value="10".
+func TestNewFieldFilter_GreaterThanOrEqualTakesPriorityOverGreaterThan(t *testing.T) {
+	f, err := NewFieldFilter("count>=10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Operator != ">=" {
+		t.Errorf("operator: got %q, want %q — >= must take priority over >", f.Operator, ">=")
+	}
+}
+
+func TestNewFieldFilter_InvalidExpression_NoOperator(t *testing.T) {
+	_, err := NewFieldFilter("noop")
+	if err == nil {
+		t.Error("expected error for expression with no recognised operator")
+	}
+}
+
+func TestNewFieldFilter_InvalidExpression_Empty(t *testing.T) {
+	_, err := NewFieldFilter("")
+	if err == nil {
+		t.Error("expected error for empty expression")
+	}
+}
+
+func TestNewFieldFilter_InvalidRegex(t *testing.T) {
+	_, err := NewFieldFilter("msg~[invalid")
+	if err == nil {
+		t.Error("expected error for invalid regex pattern")
+	}
+}
+
+func TestNewFieldFilter_ValueWithSpecialChars(t *testing.T) {
+	// Field filter value can contain anything after the operator.
+	f, err := NewFieldFilter("time>=2024-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Field != "time" {
+		t.Errorf("field: got %q, want %q", f.Field, "time")
+	}
+	if f.Value != "2024-01-01T00:00:00Z" {
+		t.Errorf("value: got %q, want %q", f.Value, "2024-01-01T00:00:00Z")
+	}
+}
+
+// =============================================================================
+// FieldFilter.Match
+// =============================================================================
+
+func TestFieldFilter_Match_Equal_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level=error")
+	entry := parser.NewEntry(map[string]any{"level": "error"})
+	if !f.Match(entry) {
+		t.Error("expected Match=true")
+	}
+}
+
+func TestFieldFilter_Match_Equal_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level=error")
+	entry := parser.NewEntry(map[string]any{"level": "info"})
+	if f.Match(entry) {
+		t.Error("expected Match=false")
+	}
+}
+
+func TestFieldFilter_Match_Equal_MissingField(t *testing.T) {
+	f, _ := NewFieldFilter("level=error")
+	entry := parser.NewEntry(map[string]any{"msg": "something"})
+	if f.Match(entry) {
+		t.Error("expected Match=false for missing field")
+	}
+}
+
+func TestFieldFilter_Match_Equal_EmptyEntry(t *testing.T) {
+	f, _ := NewFieldFilter("level=error")
+	if f.Match(parser.NewEntry(nil)) {
+		t.Error("expected Match=false for empty entry")
+	}
+}
+
+func TestFieldFilter_Match_NotEqual_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level!=info")
+	entry := parser.NewEntry(map[string]any{"level": "error"})
+	if !f.Match(entry) {
+		t.Error("expected Match=true")
+	}
+}
+
+func TestFieldFilter_Match_NotEqual_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level!=info")
+	entry := parser.NewEntry(map[string]any{"level": "info"})
+	if f.Match(entry) {
+		t.Error("expected Match=false")
+	}
+}
+
+func TestFieldFilter_Match_NotEqual_MissingField(t *testing.T) {
+	f, _ := NewFieldFilter("level!=info")
+	// Field does not exist — Match returns false regardless of operator.
+	entry := parser.NewEntry(map[string]any{"msg": "hello"})
+	if f.Match(entry) {
+		t.Error("expected Match=false for missing field")
+	}
+}
+
+func TestFieldFilter_Match_GreaterThan_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level>b")
+	if !f.Match(parser.NewEntry(map[string]any{"level": "c"})) {
+		t.Error("expected Match=true")
+	}
+}
+
+func TestFieldFilter_Match_GreaterThan_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level>c")
+	if f.Match(parser.NewEntry(map[string]any{"level": "a"})) {
+		t.Error("expected Match=false")
+	}
+}
+
+func TestFieldFilter_Match_GreaterThan_EqualValue_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level>a")
+	if f.Match(parser.NewEntry(map[string]any{"level": "a"})) {
+		t.Error("expected Match=false when values are equal")
+	}
+}
+
+func TestFieldFilter_Match_LessThan_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level<c")
+	if !f.Match(parser.NewEntry(map[string]any{"level": "a"})) {
+		t.Error("expected Match=true")
+	}
+}
+
+func TestFieldFilter_Match_LessThan_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level<a")
+	if f.Match(parser.NewEntry(map[string]any{"level": "c"})) {
+		t.Error("expected Match=false")
+	}
+}
+
+func TestFieldFilter_Match_LessThan_EqualValue_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level<a")
+	if f.Match(parser.NewEntry(map[string]any{"level": "a"})) {
+		t.Error("expected Match=false when values are equal")
+	}
+}
+
+func TestFieldFilter_Match_GreaterThanOrEqual_Equal_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level>=b")
+	if !f.Match(parser.NewEntry(map[string]any{"level": "b"})) {
+		t.Error("expected Match=true for equal value")
+	}
+}
+
+func TestFieldFilter_Match_GreaterThanOrEqual_Greater_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level>=b")
+	if !f.Match(parser.NewEntry(map[string]any{"level": "c"})) {
+		t.Error("expected Match=true for greater value")
+	}
+}
+
+func TestFieldFilter_Match_GreaterThanOrEqual_Less_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level>=c")
+	if f.Match(parser.NewEntry(map[string]any{"level": "a"})) {
+		t.Error("expected Match=false for lesser value")
+	}
+}
+
+func TestFieldFilter_Match_LessThanOrEqual_Equal_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level<=b")
+	if !f.Match(parser.NewEntry(map[string]any{"level": "b"})) {
+		t.Error("expected Match=true for equal value")
+	}
+}
+
+func TestFieldFilter_Match_LessThanOrEqual_Less_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level<=b")
+	if !f.Match(parser.NewEntry(map[string]any{"level": "a"})) {
+		t.Error("expected Match=true for lesser value")
+	}
+}
+
+func TestFieldFilter_Match_LessThanOrEqual_Greater_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level<=a")
+	if f.Match(parser.NewEntry(map[string]any{"level": "c"})) {
+		t.Error("expected Match=false for greater value")
+	}
+}
+
+func TestFieldFilter_Match_Regex_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("msg~^err.*")
+	if !f.Match(parser.NewEntry(map[string]any{"msg": "error: connection refused"})) {
+		t.Error("expected Match=true for matching regex")
+	}
+}
+
+func TestFieldFilter_Match_Regex_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("msg~^err.*")
+	if f.Match(parser.NewEntry(map[string]any{"msg": "info: all systems go"})) {
+		t.Error("expected Match=false for non-matching regex")
+	}
+}
+
+func TestFieldFilter_Match_Regex_CaseSensitive(t *testing.T) {
+	f, _ := NewFieldFilter("msg~^ERROR")
+	if f.Match(parser.NewEntry(map[string]any{"msg": "error: lowercase"})) {
+		t.Error("expected Match=false: regex is case-sensitive by default")
+	}
+}
+
+func TestFieldFilter_Match_Regex_Partial(t *testing.T) {
+	f, _ := NewFieldFilter("msg~timeout")
+	if !f.Match(parser.NewEntry(map[string]any{"msg": "connection timeout exceeded"})) {
+		t.Error("expected Match=true for partial regex match")
+	}
+}
+
+// The Match function calls fmt.Sprintf("%v", value) for comparison.
+// JSON numbers arrive as float64, so float64(42) formats as "42".
+func TestFieldFilter_Match_NumericField_StringComparison(t *testing.T) {
+	f, _ := NewFieldFilter("count=42")
+	if !f.Match(parser.NewEntry(map[string]any{"count": float64(42)})) {
+		t.Error("expected Match=true: float64(42) → \"42\"")
+	}
+}
+
+func TestFieldFilter_Match_BooleanField_StringComparison(t *testing.T) {
+	f, _ := NewFieldFilter("ok=true")
+	if !f.Match(parser.NewEntry(map[string]any{"ok": true})) {
+		t.Error("expected Match=true: true → \"true\"")
+	}
+}
+
+func TestFieldFilter_Match_NilField_StringComparison(t *testing.T) {
+	f, _ := NewFieldFilter("key=<nil>")
+	if !f.Match(parser.NewEntry(map[string]any{"key": nil})) {
+		t.Error("expected Match=true: nil → \"<nil>\"")
+	}
+}
+
+// Ordering comparisons against a timestamp compare instants, whatever the
+// offsets of the two sides.
+
+func TestFieldFilter_Match_Timestamps_ComparedAsInstants(t *testing.T) {
+	f, _ := NewFieldFilter("time>=2024-01-15T10:00:00Z")
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"2024-01-15T11:30:00+02:00", false}, // 09:30 UTC, though it sorts after as text
+		{"2024-01-15T06:00:00-04:00", true},  // 10:00 UTC, though it sorts before as text
+		{"2024-01-15 10:00:00.5", true},
+		{"not a time", false},
+	}
+	for _, tt := range tests {
+		if got := f.Match(parser.NewEntry(map[string]any{"time": tt.value})); got != tt.want {
+			t.Errorf("Match(time=%s) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFieldFilter_Match_Timestamps_NaiveInLocation(t *testing.T) {
+	loc := time.FixedZone("", -5*60*60)
+	f, _ := NewFieldFilterIn("time<2024-01-15 10:00:00", loc)
+	if !f.Match(parser.NewEntry(map[string]any{"time": "2024-01-15T14:59:59Z"})) {
+		t.Error("expected 14:59:59 UTC to be before 10:00 at UTC-5")
+	}
+	if f.Match(parser.NewEntry(map[string]any{"time": "2024-01-15 10:00:00"})) {
+		t.Error("expected equal naive timestamps not to match <")
+	}
+}
+
+func TestFieldFilter_Time(t *testing.T) {
+	f, _ := NewFieldFilter("time>2024-01-15T12:00:00+02:00")
+	if at, ok := f.Time(); !ok || !at.Equal(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Time() = %v, %v", at, ok)
+	}
+	for _, expr := range []string{"status>=500", "time=2024-01-15T10:00:00Z"} {
+		f, _ := NewFieldFilter(expr)
+		if _, ok := f.Time(); ok {
+			t.Errorf("%s: Time() ok, want a text comparison", expr)
+		}
+	}
+}
+
+func TestFieldFilter_Match_ContainsIgnoringCase(t *testing.T) {
+	f, err := NewFieldFilter("msg*=TimeOut")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Field != "msg" || f.Operator != "*=" || f.Value != "TimeOut" {
+		t.Errorf("got field %q, operator %q, value %q", f.Field, f.Operator, f.Value)
+	}
+	for _, v := range []string{"upstream timeout", "TIMEOUT after 30s", "timeout"} {
+		if !f.Match(parser.NewEntry(map[string]any{"msg": v})) {
+			t.Errorf("expected Match=true for %q", v)
+		}
+	}
+	if f.Match(parser.NewEntry(map[string]any{"msg": "time out"})) {
+		t.Error("expected Match=false")
+	}
+	if f.Match(parser.NewEntry(map[string]any{"error": "timeout"})) {
+		t.Error("expected Match=false for missing field")
+	}
+}
+
+func TestFieldFilter_Match_NestedField(t *testing.T) {
+	f, _ := NewFieldFilter("meta.host=srv1")
+	if !f.Match(parser.NewEntry(map[string]any{"meta": map[string]any{"host": "srv1"}})) {
+		t.Error("expected Match=true for nested field")
+	}
+	if f.Match(parser.NewEntry(map[string]any{"meta": map[string]any{"host": "srv2"}})) {
+		t.Error("expected Match=false")
+	}
+	if f.Match(parser.NewEntry(map[string]any{"meta": "srv1"})) {
+		t.Error("expected Match=false when the parent is not an object")
+	}
+	absent, _ := NewFieldFilter("!meta.host")
+	if !absent.Match(parser.NewEntry(map[string]any{"meta": map[string]any{}})) {
+		t.Error("expected !meta.host to match an entry without it")
+	}
+}
+
+func TestFieldFilter_Match_Durations(t *testing.T) {
+	f, err := NewFieldFilter("latency>250ms")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d, ok := f.Duration(); !ok || d != 250*time.Millisecond {
+		t.Errorf("Duration() = %v, %v, want 250ms, true", d, ok)
+	}
+	tests := []struct {
+		latency any
+		want    bool
+	}{
+		{"1.2s", true},
+		{"251ms", true},
+		{"250ms", false},
+		{"90ms", false},
+		{0.3, true},
+		{json.Number("0.25"), false},
+		{"2", true},
+		{"slow", false},
+		{"1e300", false},
+	}
+	for _, tt := range tests {
+		if got := f.Match(parser.NewEntry(map[string]any{"latency": tt.latency})); got != tt.want {
+			t.Errorf("latency %v: Match = %v, want %v", tt.latency, got, tt.want)
+		}
+	}
+	if f.Match(parser.NewEntry(nil)) {
+		t.Error("expected Match=false for missing field")
+	}
+}
+
+func TestFieldFilter_Match_DurationsNeedAUnit(t *testing.T) {
+	// Plain numbers keep comparing as text.
+	f, _ := NewFieldFilter("count>0")
+	if _, ok := f.Duration(); ok {
+		t.Error("expected count>0 not to compare durations")
+	}
+	le, _ := NewFieldFilter("wait<=1m30s")
+	if !le.Match(parser.NewEntry(map[string]any{"wait": "90s"})) || le.Match(parser.NewEntry(map[string]any{"wait": "1m31s"})) {
+		t.Error("expected wait<=1m30s to compare durations")
+	}
+}
+
+func TestFieldFilter_Match_Network(t *testing.T) {
+	in, err := NewFieldFilter("client_ip=cidr:10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := NewFieldFilter("client_ip!=cidr:10.1.2.3/8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if network, ok := out.Network(); !ok || network.String() != "10.0.0.0/8" {
+		t.Errorf("Network() = %v, %v, want 10.0.0.0/8, true", network, ok)
+	}
+	tests := []struct {
+		ip      any
+		in, out bool
+	}{
+		{"10.1.2.3", true, false},
+		{"10.255.0.1:8080", true, false},
+		{"::ffff:10.0.0.1", true, false},
+		{"192.168.1.1", false, true},
+		{"[2001:db8::1]:443", false, true},
+		{"not an ip", false, false},
+		{42, false, false},
+	}
+	for _, tt := range tests {
+		entry := parser.NewEntry(map[string]any{"client_ip": tt.ip})
+		if got := in.Match(entry); got != tt.in {
+			t.Errorf("%v: = match %v, want %v", tt.ip, got, tt.in)
+		}
+		if got := out.Match(entry); got != tt.out {
+			t.Errorf("%v: != match %v, want %v", tt.ip, got, tt.out)
+		}
+	}
+	if in.Match(parser.NewEntry(nil)) || out.Match(parser.NewEntry(nil)) {
+		t.Error("expected Match=false for missing field")
+	}
+}
+
+func TestNewFieldFilter_InvalidNetwork(t *testing.T) {
+	if _, err := NewFieldFilter("client_ip=cidr:10.0.0.0/33"); err == nil {
+		t.Error("expected error for invalid network")
+	}
+	// Only = and != take a network; elsewhere cidr: is part of the value.
+	f, err := NewFieldFilter("note~cidr:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := f.Network(); ok {
+		t.Error("expected no network for ~")
+	}
+}
+
+func TestFieldFilter_Match_Present(t *testing.T) {
+	f, err := NewFieldFilter("trace_id?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Field != "trace_id" || f.Operator != "?" {
+		t.Errorf("got field %q, operator %q", f.Field, f.Operator)
+	}
+	if !f.Match(parser.NewEntry(map[string]any{"trace_id": "abc"})) || !f.Match(parser.NewEntry(map[string]any{"trace_id": nil})) {
+		t.Error("expected Match=true when the field is present, whatever its value")
+	}
+	if f.Match(parser.NewEntry(map[string]any{"msg": "hello"})) {
+		t.Error("expected Match=false for missing field")
+	}
+}
+
+func TestFieldFilter_Match_Absent(t *testing.T) {
+	f, err := NewFieldFilter("!trace_id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Field != "trace_id" || f.Operator != "!" {
+		t.Errorf("got field %q, operator %q", f.Field, f.Operator)
+	}
+	if !f.Match(parser.NewEntry(map[string]any{"msg": "hello"})) || !f.Match(parser.NewEntry(nil)) {
+		t.Error("expected Match=true for missing field")
+	}
+	if f.Match(parser.NewEntry(map[string]any{"trace_id": ""})) {
+		t.Error("expected Match=false when the field is present")
+	}
+}
+
+func TestNewFieldFilter_PresenceNotMistakenForComparison(t *testing.T) {
+	// A "?" or "!" alongside an operator belongs to the comparison.
+	for expr, op := range map[string]string{"msg~colou?r?": "~", "level!=info": "!=", "!x=1": "=", "q=?": "="} {
+		f, err := NewFieldFilter(expr)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", expr, err)
+		}
+		if f.Operator != op {
+			t.Errorf("%q: operator %q, want %q", expr, f.Operator, op)
+		}
+	}
+	for _, expr := range []string{"?", "!"} {
+		if _, err := NewFieldFilter(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+// =============================================================================
+// CompositeFilter
+// =============================================================================
+
+func TestCompositeFilter_NoFilters_MatchesAnyEntry(t *testing.T) {
+	cf := NewCompositeFilter()
+	entry := parser.NewEntry(map[string]any{"level": "info", "msg": "anything"})
+	if !cf.Match(entry) {
+		t.Error("expected empty CompositeFilter to match any entry")
+	}
+}
+
+func TestCompositeFilter_NoFilters_MatchesEmptyEntry(t *testing.T) {
+	cf := NewCompositeFilter()
+	if !cf.Match(parser.NewEntry(nil)) {
+		t.Error("expected empty CompositeFilter to match empty entry")
+	}
+}
+
+func TestCompositeFilter_SingleFilter_Hit(t *testing.T) {
+	f, _ := NewFieldFilter("level=info")
+	cf := NewCompositeFilter(f)
+	if !cf.Match(parser.NewEntry(map[string]any{"level": "info"})) {
+		t.Error("expected Match=true")
+	}
+}
+
+func TestCompositeFilter_SingleFilter_Miss(t *testing.T) {
+	f, _ := NewFieldFilter("level=info")
+	cf := NewCompositeFilter(f)
+	if cf.Match(parser.NewEntry(map[string]any{"level": "error"})) {
+		t.Error("expected Match=false")
+	}
+}
+
+func TestCompositeFilter_TwoFilters_BothMatch(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("service=api")
+	cf := NewCompositeFilter(f1, f2)
+	entry := parser.NewEntry(map[string]any{"level": "error", "service": "api"})
+	if !cf.Match(entry) {
+		t.Error("expected Match=true when all filters match")
+	}
+}
+
+func TestCompositeFilter_TwoFilters_FirstMisses(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("service=api")
+	cf := NewCompositeFilter(f1, f2)
+	entry := parser.NewEntry(map[string]any{"level": "info", "service": "api"})
+	if cf.Match(entry) {
+		t.Error("expected Match=false (first filter misses)")
+	}
+}
+
+func TestCompositeFilter_TwoFilters_SecondMisses(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("service=api")
+	cf := NewCompositeFilter(f1, f2)
+	entry := parser.NewEntry(map[string]any{"level": "error", "service": "web"})
+	if cf.Match(entry) {
+		t.Error("expected Match=false (second filter misses)")
+	}
+}
+
+func TestCompositeFilter_TwoFilters_NoneMatch(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("service=api")
+	cf := NewCompositeFilter(f1, f2)
+	entry := parser.NewEntry(map[string]any{"level": "info", "service": "web"})
+	if cf.Match(entry) {
+		t.Error("expected Match=false (no filters match)")
+	}
+}
+
+func TestCompositeFilter_ThreeFilters_AllMatch(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("service=api")
+	f3, _ := NewFieldFilter("region=us-east")
+	cf := NewCompositeFilter(f1, f2, f3)
+	entry := parser.NewEntry(map[string]any{"level": "error", "service": "api", "region": "us-east"})
+	if !cf.Match(entry) {
+		t.Error("expected Match=true when all three filters match")
+	}
+}
+
+func TestCompositeFilter_ThreeFilters_MiddleMisses(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("service=api")
+	f3, _ := NewFieldFilter("region=us-east")
+	cf := NewCompositeFilter(f1, f2, f3)
+	entry := parser.NewEntry(map[string]any{"level": "error", "service": "web", "region": "us-east"})
+	if cf.Match(entry) {
+		t.Error("expected Match=false (middle filter misses)")
+	}
+}
+
+// A CompositeFilter with a regex filter and an equality filter ANDs both conditions.
+func TestCompositeFilter_MixedOperators(t *testing.T) {
+	fEq, _ := NewFieldFilter("level=error")
+	fRe, _ := NewFieldFilter("msg~timeout")
+	cf := NewCompositeFilter(fEq, fRe)
+
+	// Both conditions satisfied.
+	if !cf.Match(parser.NewEntry(map[string]any{"level": "error", "msg": "db timeout"})) {
+		t.Error("expected Match=true when both conditions hold")
+	}
+	// Regex not satisfied.
+	if cf.Match(parser.NewEntry(map[string]any{"level": "error", "msg": "normal error"})) {
+		t.Error("expected Match=false when regex does not match")
+	}
+}
+
+// =============================================================================
+// String
+// =============================================================================
+
+func TestFieldFilter_String_RoundTrips(t *testing.T) {
+	for _, expr := range []string{"level=error", "status>=500", "msg~^time(out)?$", "env!=prod", "msg*=timeout", "ip=cidr:10.0.0.0/8", "trace_id?", "!trace_id"} {
+		f, err := NewFieldFilter(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.String() != expr {
+			t.Errorf("String() = %q, want %q", f.String(), expr)
+		}
+	}
+}
+
+func TestCompositeFilter_String(t *testing.T) {
+	if got := NewCompositeFilter().String(); got != "*" {
+		t.Errorf("empty String() = %q, want %q", got, "*")
+	}
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("msg~timeout")
+	if got := NewCompositeFilter(f1, f2).String(); got != "level=error AND msg~timeout" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+// =============================================================================
+// OrFilter and NotFilter
+// =============================================================================
+
+func TestOrFilter_Match(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("level=warn")
+	of := NewOrFilter(f1, f2)
+	for _, tt := range []struct {
+		entry *parser.LogEntry
+		want  bool
+	}{
+		{parser.NewEntry(map[string]any{"level": "error"}), true},
+		{parser.NewEntry(map[string]any{"level": "warn"}), true},
+		{parser.NewEntry(map[string]any{"level": "info"}), false},
+		{parser.NewEntry(nil), false},
+	} {
+		if got := of.Match(tt.entry); got != tt.want {
+			t.Errorf("Match(%v) = %v, want %v", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestOrFilter_NoFilters_MatchesNothing(t *testing.T) {
+	if NewOrFilter().Match(parser.NewEntry(map[string]any{"level": "error"})) {
+		t.Error("expected an empty OrFilter to match nothing")
+	}
+}
+
+func TestNotFilter_Match_MissingField(t *testing.T) {
+	f, _ := NewFieldFilter("service=api")
+	nf := NewNotFilter(f)
+	if nf.Match(parser.NewEntry(map[string]any{"service": "api"})) {
+		t.Error("expected Match=false for the negated value")
+	}
+	if !nf.Match(parser.NewEntry(map[string]any{"service": "web"})) {
+		t.Error("expected Match=true for another value")
+	}
+	if !nf.Match(parser.NewEntry(map[string]any{"level": "info"})) {
+		t.Error("expected Match=true for an entry without the field")
+	}
+}
+
+func TestOrFilter_String(t *testing.T) {
+	f1, _ := NewFieldFilter("level=error")
+	f2, _ := NewFieldFilter("msg~timeout")
+	if got := NewOrFilter(f1, NewNotFilter(f2)).String(); got != "level=error OR NOT msg~timeout" {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -0,0 +1,241 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseQuery parses a query: field expressions of the form accepted by
+// NewFieldFilter, combined with "and", "or" and "not" and grouped with
+// parentheses, into a tree of CompositeFilter, OrFilter and NotFilter:
+//
+//	(level=error or level=warn) and service!=cron
+//	not (path~^/health or path=/metrics)
+//
+// The keywords may be written in any case. "not" binds tightest and "or"
+// loosest, so "a and b or c" is "(a and b) or c". A value ends at the first
+// space or unbalanced closing parenthesis, so "msg~(timeout|refused)" needs
+// no quotes; a value containing spaces is written in single or double
+// quotes, inside which a backslash escapes the quote or itself. "field?"
+// and "!field" test whether an entry has a field at all. Timestamps
+// without a UTC offset are taken to be in UTC.
+func ParseQuery(query string) (Filter, error) {
+	return ParseQueryIn(query, time.UTC)
+}
+
+// ParseQueryIn is like ParseQuery but takes timestamps without a UTC
+// offset, in the query and in log entries, to be in loc.
+func ParseQueryIn(query string, loc *time.Location) (Filter, error) {
+	p := &queryParser{src: query, loc: loc}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	if p.pos < len(p.src) {
+		return nil, p.fail("unexpected %q", p.src[p.pos:])
+	}
+	return f, nil
+}
+
+// queryParser parses a query by recursive descent, from left to right.
+type queryParser struct {
+	src string
+	pos int
+	loc *time.Location
+}
+
+// fail returns an error at the current position.
+func (p *queryParser) fail(format string, args ...any) error {
+	return fmt.Errorf("at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// space skips the white space at the current position.
+func (p *queryParser) space() {
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+// keyword skips the keyword kw, in any case, and reports whether it was
+// there. A keyword is followed by white space, a parenthesis or the end of
+// the query, so that a field named "order" is not taken for "or".
+func (p *queryParser) keyword(kw string) bool {
+	p.space()
+	end := p.pos + len(kw)
+	if end > len(p.src) || !strings.EqualFold(p.src[p.pos:end], kw) {
+		return false
+	}
+	if end < len(p.src) {
+		r, _ := utf8.DecodeRuneInString(p.src[end:])
+		if !unicode.IsSpace(r) && r != '(' && r != ')' {
+			return false
+		}
+	}
+	p.pos = end
+	return true
+}
+
+// or parses alternatives separated by "or".
+func (p *queryParser) or() (Filter, error) {
+	f, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	filters := []Filter{f}
+	for p.keyword("or") {
+		if f, err = p.and(); err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return NewOrFilter(filters...), nil
+}
+
+// and parses operands separated by "and".
+func (p *queryParser) and() (Filter, error) {
+	f, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	filters := []Filter{f}
+	for p.keyword("and") {
+		if f, err = p.unary(); err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return NewCompositeFilter(filters...), nil
+}
+
+// unary parses a negation, a parenthesized query or a field expression.
+func (p *queryParser) unary() (Filter, error) {
+	if p.keyword("not") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return NewNotFilter(f), nil
+	}
+	p.space()
+	if p.pos < len(p.src) && p.src[p.pos] == '(' {
+		p.pos++
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.space()
+		if p.pos >= len(p.src) || p.src[p.pos] != ')' {
+			return nil, p.fail("expected ')'")
+		}
+		p.pos++
+		return f, nil
+	}
+	return p.comparison()
+}
+
+// queryOperators are the operators of a field expression, those of two
+// characters first.
+var queryOperators = []string{"!=", ">=", "<=", "*=", "=", ">", "<", "~"}
+
+// comparison parses a field expression: a field name, an operator and a
+// value, or a field name followed by "?" or preceded by "!".
+func (p *queryParser) comparison() (Filter, error) {
+	absent := strings.HasPrefix(p.src[p.pos:], "!") && !strings.HasPrefix(p.src[p.pos:], "!=")
+	if absent {
+		p.pos++
+	}
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if unicode.IsSpace(r) || strings.ContainsRune("()!=~<>?'\"", r) || strings.HasPrefix(p.src[p.pos:], "*=") {
+			break
+		}
+		p.pos += size
+	}
+	field := p.src[start:p.pos]
+	if field == "" {
+		if p.pos >= len(p.src) {
+			return nil, p.fail("expected a field expression")
+		}
+		return nil, p.fail("expected a field name")
+	}
+	if absent {
+		return newFieldFilter(field, "!", "", p.loc)
+	}
+	if strings.HasPrefix(p.src[p.pos:], "?") {
+		p.pos++
+		return newFieldFilter(field, "?", "", p.loc)
+	}
+	op := ""
+	for _, o := range queryOperators {
+		if strings.HasPrefix(p.src[p.pos:], o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.fail("expected an operator after %q", field)
+	}
+	p.pos += len(op)
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return newFieldFilter(field, op, value, p.loc)
+}
+
+// value parses the value of a field expression, quoted or bare.
+func (p *queryParser) value() (string, error) {
+	if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+		quote := p.src[p.pos]
+		start := p.pos
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			switch {
+			case c == quote:
+				p.pos++
+				return b.String(), nil
+			case c == '\\' && p.pos+1 < len(p.src) && (p.src[p.pos+1] == quote || p.src[p.pos+1] == '\\'):
+				b.WriteByte(p.src[p.pos+1])
+				p.pos += 2
+			default:
+				b.WriteByte(c)
+				p.pos++
+			}
+		}
+		p.pos = start
+		return "", p.fail("unterminated quoted value")
+	}
+
+	start, depth := p.pos, 0
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if unicode.IsSpace(r) || r == ')' && depth == 0 {
+			break
+		}
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		p.pos += size
+	}
+	return p.src[start:p.pos], nil
+}
@@ -0,0 +1,142 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// ParseQuery
+// =============================================================================
+
+func TestParseQuery_Match(t *testing.T) {
+	tests := []struct {
+		query   string
+		match   []*parser.LogEntry
+		noMatch []*parser.LogEntry
+	}{
+		{
+			query:   "(level=error or level=warn) and service!=cron",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"level": "error", "service": "api"}), parser.NewEntry(map[string]any{"level": "warn", "service": "web"})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"level": "error", "service": "cron"}), parser.NewEntry(map[string]any{"level": "info", "service": "api"}), parser.NewEntry(map[string]any{"level": "warn"})},
+		},
+		{
+			// and binds tighter than or.
+			query:   "level=error and service=api or level=fatal",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"level": "error", "service": "api"}), parser.NewEntry(map[string]any{"level": "fatal"})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"level": "error", "service": "web"})},
+		},
+		{
+			query:   "NOT (path~^/health OR path=/metrics)",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"path": "/api"}), parser.NewEntry(nil)},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"path": "/healthz"}), parser.NewEntry(map[string]any{"path": "/metrics"})},
+		},
+		{
+			query:   "trace_id? and !user or (level=error and !trace_id)",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"trace_id": "t1"}), parser.NewEntry(map[string]any{"level": "error"})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"trace_id": "t1", "user": "u"}), parser.NewEntry(map[string]any{"level": "error", "trace_id": "t1", "user": "u"}), parser.NewEntry(map[string]any{"level": "info"})},
+		},
+		{
+			query:   "msg*=timeout or msg*='connection refused'",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"msg": "Upstream TIMEOUT"}), parser.NewEntry(map[string]any{"msg": "dial: Connection Refused"})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"msg": "ok"}), parser.NewEntry(map[string]any{"error": "timeout"})},
+		},
+		{
+			query:   "not not level=error",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"level": "error"})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"level": "info"})},
+		},
+		{
+			// A regular expression keeps its balanced parentheses.
+			query:   "(msg~(timeout|refused))",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"msg": "connection refused"})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"msg": "ok"})},
+		},
+		{
+			query:   `msg="disk full" or msg='it\'s \\ here'`,
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"msg": "disk full"}), parser.NewEntry(map[string]any{"msg": `it's \ here`})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"msg": "disk"})},
+		},
+		{
+			query:   "time>=2024-01-15T10:00:00Z",
+			match:   []*parser.LogEntry{parser.NewEntry(map[string]any{"time": "2024-01-15T07:00:00-04:00"})},
+			noMatch: []*parser.LogEntry{parser.NewEntry(map[string]any{"time": "2024-01-15T09:59:59Z"})},
+		},
+	}
+	for _, tt := range tests {
+		f, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+		}
+		for _, e := range tt.match {
+			if !f.Match(e) {
+				t.Errorf("%q: expected a match for %v", tt.query, e)
+			}
+		}
+		for _, e := range tt.noMatch {
+			if f.Match(e) {
+				t.Errorf("%q: expected no match for %v", tt.query, e)
+			}
+		}
+	}
+}
+
+func TestParseQuery_String(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"level=error", "level=error"},
+		{"(level=error or level=warn) and service!=cron", "(level=error OR level=warn) AND service!=cron"},
+		{"a=1 and b=2 or c=3", "a=1 AND b=2 OR c=3"},
+		{"not (a=1 or b=2)", "NOT (a=1 OR b=2)"},
+		// Words that start with a keyword are field names.
+		{"order=1 and notes=x", "order=1 AND notes=x"},
+		{"msg='a b'", "msg=a b"},
+		{"!trace_id or (user? and not user=root)", "!trace_id OR user? AND NOT user=root"},
+	}
+	for _, tt := range tests {
+		f, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+		}
+		if got := f.(interface{ String() string }).String(); got != tt.want {
+			t.Errorf("ParseQuery(%q).String() = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery_SingleExpression_IsFieldFilter(t *testing.T) {
+	f, err := ParseQuery("  level=error  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff, ok := f.(*FieldFilter); !ok || ff.Value != "error" {
+		t.Errorf("ParseQuery returned %#v, want a *FieldFilter for level=error", f)
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "position 1: expected a field expression"},
+		{"(level=error", "position 13: expected ')'"},
+		{"level=error)", `position 12: unexpected ")"`},
+		{"level", `position 6: expected an operator after "level"`},
+		{"level=error and", "position 16: expected a field expression"},
+		{"=error", "position 1: expected a field name"},
+		{"level=error and !", "position 18: expected a field expression"},
+		{`msg="open`, "position 5: unterminated quoted value"},
+		{"msg~(", "invalid regex in filter"},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseQuery(%q) error = %v, want %q", tt.query, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,1045 @@
+// Package formatter provides output formatters that write log entries to an
+// io.Writer in a human- or machine-readable form.
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tylermac92/logpipe/internal/stack"
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// Formatter is the interface implemented by all output formatters.
+// Format writes a single log entry to w and returns any write error. The
+// formatters in this package render the entry into a pooled scratch buffer
+// and hand it to w in a single Write call; they keep no reference to the
+// entry afterwards, so the caller may pass it to parser.Release once Format
+// returns.
+type Formatter interface {
+	Format(w io.Writer, entry *parser.LogEntry) error
+}
+
+// maxPooledBuffer bounds the scratch buffers kept for reuse so that one
+// unusually large entry does not pin its buffer for the rest of the run.
+const maxPooledBuffer = 64 << 10
+
+var bufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty scratch buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool. buf must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufPool.Put(buf)
+}
+
+// writeValue appends the text form of v, as valueString returns it, to buf.
+func writeValue(buf *bytes.Buffer, v any) {
+	buf.WriteString(valueString(v))
+}
+
+// valueString returns the text form of a field value: a string as it is,
+// a nested object or array as compact JSON, and anything else in its %v
+// form.
+func valueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]any, []any, *parser.LogEntry:
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err == nil {
+			return strings.TrimSuffix(b.String(), "\n")
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// JSONFormatter writes each log entry as a JSON object followed by a newline.
+// Object members keep the order the fields appeared in the input, unless
+// KeyOrder is set.
+type JSONFormatter struct {
+	// Pretty enables indented JSON output when true.
+	Pretty bool
+	// KeyOrder, when not nil, orders the members of each object instead:
+	// the fields it names first, in its order, and the rest alphabetically,
+	// so that entries whose fields arrived in different orders are written
+	// alike. An empty KeyOrder sorts every member.
+	KeyOrder []string
+}
+
+// CanonicalKeys is the KeyOrder that puts an entry's timestamp, level and
+// message first, under any of the names TextFormatter recognises.
+var CanonicalKeys = []string{"time", "ts", "timestamp", "level", "lvl", "severity", "message", "msg", "text"}
+
+// Format marshals the entry to JSON and writes it to w. When Pretty is true
+// the output is indented with two spaces; otherwise it is compact.
+func (f *JSONFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	enc := json.NewEncoder(buf)
+	if f.Pretty {
+		enc.SetIndent("", "  ")
+	}
+	var v any = entry
+	if f.KeyOrder != nil {
+		v = sortedEntry{entry, f.sortedKeys(entry)}
+	}
+	// Encode terminates the object with a newline.
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// sortedKeys returns the keys of entry in KeyOrder.
+func (f *JSONFormatter) sortedKeys(entry *parser.LogEntry) []string {
+	keys := entry.Keys()
+	rank := func(k string) int {
+		if i := slices.Index(f.KeyOrder, k); i >= 0 {
+			return i
+		}
+		return len(f.KeyOrder)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+// sortedEntry marshals entry as a JSON object with its members in the
+// order of keys.
+type sortedEntry struct {
+	entry *parser.LogEntry
+	keys  []string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o sortedEntry) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(o.entry.Fields[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ANSI escape codes used by TextFormatter for terminal coloring.
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorGray   = "\033[90m"
+	colorBold   = "\033[1m"
+	colorDim    = "\033[2m"
+)
+
+// TextFormatter writes each log entry as a human-readable line of text in
+// the format:
+//
+//	<timestamp> [LEVEL] <message> key=value ...
+//
+// Well-known field names (time/ts/timestamp, level/lvl/severity,
+// message/msg/text) are pulled out and rendered in fixed positions; all
+// remaining fields are appended as key=value pairs sorted alphabetically,
+// with nested objects and arrays shown as compact JSON. Multi-line error
+// and stack trace fields (see blockFields) follow on lines of their own.
+// Entries that stand for an unparsed input line (see rawLine) are written
+// as that line. Entries numbered by their parser (see
+// parser.ReadOptions.Positions) start with their line number and a colon,
+// as grep -n prints them.
+type TextFormatter struct {
+	// Fields restricts the extra key=value pairs to the named fields,
+	// which may be dotted paths into nested objects, such as "meta.host".
+	// When empty, all non-canonical fields are printed.
+	Fields []string
+	// Color enables ANSI terminal colours when true.
+	Color bool
+	// ColorLines colours the whole of an entry's output by its level: dim
+	// for debug and trace, yellow for warnings and red for errors. Other
+	// entries are left uncoloured, or coloured as usual when Color is set.
+	ColorLines bool
+	// Sanitize escapes control characters in the entry's contents, so
+	// that escape sequences and other terminal controls embedded in a log
+	// are shown instead of acted on.
+	Sanitize bool
+	// Width, when positive, is the number of columns output lines are
+	// fitted to, such as a terminal's width. Longer lines are cut short
+	// with an ellipsis, or with Wrap set, wrapped at spaces onto lines
+	// indented to where the message starts.
+	Width int
+	Wrap  bool
+	// Align pads the timestamp, level, _source and Fields of each line
+	// into columns as wide as the widest seen so far, so that lines line
+	// up with one another. Columns only ever widen; Measure lets a caller
+	// widen them for entries it has yet to format.
+	Align bool
+	// Icons shows a symbol for each entry's level, such as ✖ for errors,
+	// beside or instead of the bracketed level.
+	Icons LevelIcons
+	// FoldStacks, when positive, cuts each run of stack frames in
+	// multi-line messages and blockFields down to the FoldStacks frames
+	// nearest where the trace was raised, followed by a count of the
+	// frames left out.
+	FoldStacks int
+	// MaxValue, when positive, is the most characters the message and the
+	// value of each extra field are written with; longer ones are cut
+	// short, the last character written being an ellipsis. Limits
+	// overrides it for the fields it names, a limit of 0 leaving the field
+	// uncut, with the message's limit named by any of msg, message and
+	// text. Multi-line fields written below the entry are never cut.
+	MaxValue int
+	Limits   map[string]int
+	// TimeLayout is the Go time layout timestamps are written with, and
+	// Location the zone they are written in, "15:04:05" and UTC when not
+	// set. Timestamps are read as parser.ParseTime reads them, those
+	// without a UTC offset taken to be in AssumeLocation, or UTC when it
+	// is nil. Timestamps that cannot be parsed are written as they are.
+	TimeLayout     string
+	Location       *time.Location
+	AssumeLocation *time.Location
+
+	columns columns // widths of the columns when Align is set
+}
+
+// LevelIcons selects whether a TextFormatter marks levels with icons.
+type LevelIcons int
+
+const (
+	IconsOff    LevelIcons = iota // the bracketed level only
+	IconsBeside                   // an icon followed by the bracketed level
+	IconsOnly                     // an icon in place of the bracketed level
+)
+
+// columns holds the widths, in terminal columns, that an aligned
+// TextFormatter pads each part of a line to. A width of 0 means the part
+// has not been seen.
+type columns struct {
+	line, time, level, source, message int
+	fields                             map[string]int
+}
+
+// maxAlignedMessage caps the width messages are padded to when aligning,
+// so that one long message does not push every field off the screen.
+const maxAlignedMessage = 60
+
+// Format writes a formatted text representation of entry to w.
+func (f *TextFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	if raw, ok := rawLine(entry); ok {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if lineNum := f.lineNumber(entry, f.Color); lineNum != "" {
+			buf.WriteString(lineNum)
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.clean(raw))
+		buf.WriteByte('\n')
+		return f.write(w, buf, -1)
+	}
+
+	timestamp := f.clean(extractString(entry, "time", "ts", "timestamp"))
+	level := f.clean(extractString(entry, "level", "lvl", "severity"))
+	message := f.clean(cutValue(f.fold(extractString(entry, "message", "msg", "text")), f.messageLimit()))
+
+	lineColor := f.lineColor(level)
+	color := f.Color && lineColor == ""
+	levelStr := f.levelCell(level, color)
+	lineNum := f.lineNumber(entry, color)
+	// Without color, including a line colored by its level, whose color
+	// the placeholder's own would end, the placeholder is plain padding.
+	timeStr := f.formatTime(timestamp, color)
+	if f.Align && timestamp == "" {
+		// The time column is padded instead.
+		timeStr = ""
+	}
+
+	var extras []string
+	if len(f.Fields) > 0 {
+		// User requested specific fields — render only those.
+		for _, field := range f.Fields {
+			if _, exists := entry.Lookup(field); exists {
+				extras = append(extras, field)
+			}
+		}
+	} else {
+		// Render all non-canonical fields in sorted order for stable output.
+		for _, k := range entry.Keys() {
+			if !canonical[k] && k != parser.LineField && !(f.Align && k == parser.SourceField) {
+				extras = append(extras, k)
+			}
+		}
+		sort.Strings(extras)
+	}
+
+	var blocks []string
+	inline := extras[:0]
+	for _, k := range extras {
+		if _, ok := blockLines(entry, k); ok {
+			blocks = append(blocks, k)
+		} else {
+			inline = append(inline, k)
+		}
+	}
+	extras = inline
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	buf.WriteString(lineColor)
+	indent := visibleWidth(timeStr) + 1 + visibleWidth(levelStr) + 1
+	if f.Align {
+		f.Measure(entry)
+		indent = f.writeAligned(buf, entry, lineNum, timeStr, levelStr, message, extras, color)
+	} else {
+		if lineNum != "" {
+			buf.WriteString(lineNum)
+			buf.WriteByte(' ')
+			indent += visibleWidth(lineNum) + 1
+		}
+		buf.WriteString(timeStr)
+		buf.WriteByte(' ')
+		buf.WriteString(levelStr)
+		buf.WriteByte(' ')
+		buf.WriteString(message)
+	}
+	if len(extras) > 0 && !f.Align {
+		buf.WriteByte(' ')
+		if color {
+			buf.WriteString(colorGray)
+		}
+		for i, k := range extras {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			v, _ := entry.Lookup(k)
+			buf.WriteString(f.clean(k))
+			buf.WriteByte('=')
+			switch n := f.limit(k); {
+			case n > 0:
+				buf.WriteString(f.clean(cutValue(valueString(v), n)))
+			case f.Sanitize:
+				buf.WriteString(escapeControl(valueString(v)))
+			default:
+				writeValue(buf, v)
+			}
+		}
+		if color {
+			buf.WriteString(colorReset)
+		}
+	}
+	if lineColor != "" {
+		buf.WriteString(colorReset)
+	}
+	buf.WriteByte('\n')
+	blockColor := lineColor
+	if color {
+		blockColor = colorRed
+	}
+	for _, k := range blocks {
+		f.writeBlock(buf, k, entry, blockColor)
+	}
+
+	return f.write(w, buf, indent)
+}
+
+// Measure widens the columns of an aligned formatter to fit entry, so that
+// it lines up with the entries formatted after it. Format measures every
+// entry it writes; Measure lets a caller look ahead at entries before
+// formatting them, so that the first lines line up with later ones too. It
+// must not be called concurrently with Format.
+func (f *TextFormatter) Measure(entry *parser.LogEntry) {
+	if _, ok := rawLine(entry); ok {
+		return
+	}
+	c := &f.columns
+	c.line = max(c.line, visibleWidth(f.lineNumber(entry, false)))
+	if timestamp := extractString(entry, "time", "ts", "timestamp"); timestamp != "" {
+		c.time = max(c.time, visibleWidth(f.formatTime(f.clean(timestamp), false)))
+	}
+	c.level = max(c.level, visibleWidth(f.levelCell(f.clean(extractString(entry, "level", "lvl", "severity")), false)))
+	if v, ok := entry.Fields[parser.SourceField]; ok {
+		c.source = max(c.source, visibleWidth(f.clean(valueString(v))))
+	}
+	message := f.clean(cutValue(f.fold(extractString(entry, "message", "msg", "text")), f.messageLimit()))
+	c.message = max(c.message, min(visibleWidth(message), maxAlignedMessage))
+	for _, k := range f.Fields {
+		if _, ok := entry.Lookup(k); !ok {
+			continue
+		}
+		if _, ok := blockLines(entry, k); ok {
+			continue
+		}
+		if c.fields == nil {
+			c.fields = make(map[string]int)
+		}
+		c.fields[k] = max(c.fields[k], visibleWidth(f.pair(entry, k)))
+	}
+}
+
+// writeAligned writes the first line of entry's output, but for its
+// colour and line break, to buf with each part padded to the width of its
+// column, and returns the column the message starts at. Parts missing from
+// the entry are left blank, and nothing is padded after the last part.
+func (f *TextFormatter) writeAligned(buf *bytes.Buffer, entry *parser.LogEntry, lineNum, timeStr, levelStr, message string, extras []string, color bool) int {
+	c := &f.columns
+	start := buf.Len()
+	pending := 0 // spaces owed before the next part written
+	cell := func(s string, width int) {
+		if s == "" && width == 0 {
+			return
+		}
+		if s != "" {
+			buf.WriteString(strings.Repeat(" ", pending))
+			buf.WriteString(s)
+			pending = 0
+		}
+		pending += max(width-visibleWidth(s), 0) + 1
+	}
+
+	cell(lineNum, c.line)
+	cell(timeStr, c.time)
+	cell(levelStr, c.level)
+	if v, ok := entry.Fields[parser.SourceField]; ok {
+		cell(f.clean(valueString(v)), c.source)
+	} else {
+		cell("", c.source)
+	}
+	indent := visibleWidth(buf.String()[start:]) + pending
+	cell(message, c.message)
+
+	gray := func(s string) string {
+		if color {
+			return colorGray + s + colorReset
+		}
+		return s
+	}
+	if len(f.Fields) == 0 {
+		pairs := make([]string, len(extras))
+		for i, k := range extras {
+			pairs[i] = f.pair(entry, k)
+		}
+		if len(pairs) > 0 {
+			cell(gray(strings.Join(pairs, " ")), 0)
+		}
+		return indent
+	}
+	for _, k := range f.Fields {
+		if slices.Contains(extras, k) {
+			cell(gray(f.pair(entry, k)), c.fields[k])
+		} else {
+			cell("", c.fields[k])
+		}
+	}
+	return indent
+}
+
+// lineNumber returns the "N:" that an entry numbered by its parser starts
+// with, in gray when color is set, or "" for any other entry.
+func (f *TextFormatter) lineNumber(entry *parser.LogEntry, color bool) string {
+	v, ok := entry.Fields[parser.LineField]
+	if !ok {
+		return ""
+	}
+	n := f.clean(valueString(v)) + ":"
+	if color {
+		return colorGray + n + colorReset
+	}
+	return n
+}
+
+// pair returns entry's field k as it is written among a line's extra
+// fields: key=value.
+func (f *TextFormatter) pair(entry *parser.LogEntry, k string) string {
+	v, _ := entry.Lookup(k)
+	s := cutValue(valueString(v), f.limit(k))
+	if f.Sanitize {
+		s = escapeControl(s)
+	}
+	return f.clean(k) + "=" + s
+}
+
+// write writes the lines in buf to w, fitted to f.Width when it is set.
+// Wrapped parts of the first line are indented by indent columns, and
+// those of every other line, or of the first when indent is negative, two
+// columns deeper than the line itself.
+func (f *TextFormatter) write(w io.Writer, buf *bytes.Buffer, indent int) error {
+	if f.Width <= 0 {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	out := getBuffer()
+	defer putBuffer(out)
+	text := buf.String()
+	for i := 0; len(text) > 0; i++ {
+		line, rest, _ := strings.Cut(text, "\n")
+		text = rest
+		hang := indent
+		if i > 0 || hang < 0 {
+			hang = len(line) - len(strings.TrimLeft(line, " ")) + 2
+		}
+		if hang > f.Width/2 {
+			hang = 0
+		}
+		if f.Wrap {
+			wrapLine(out, line, f.Width, hang)
+		} else {
+			truncateLine(out, line, f.Width)
+		}
+		out.WriteByte('\n')
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// ellipsis marks where truncateLine cut a line short, and where cutValue
+// cut a value short.
+const ellipsis = "…"
+
+// limit returns the most characters the value of field k is written
+// with, or 0 for no limit.
+func (f *TextFormatter) limit(k string) int {
+	if n, ok := f.Limits[k]; ok {
+		return n
+	}
+	return f.MaxValue
+}
+
+// messageLimit returns the most characters the message is written with,
+// or 0 for no limit.
+func (f *TextFormatter) messageLimit() int {
+	for _, k := range []string{"msg", "message", "text"} {
+		if n, ok := f.Limits[k]; ok {
+			return n
+		}
+	}
+	return f.MaxValue
+}
+
+// cutValue returns s cut short to n characters, the last an ellipsis,
+// when it is longer than that and n is positive, and s otherwise.
+func cutValue(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + ellipsis
+}
+
+// nextColumn returns the column after r when it starts at col: tabs move
+// to the next multiple of eight and other characters take one column.
+func nextColumn(col int, r rune) int {
+	if r == '\t' {
+		return col + 8 - col%8
+	}
+	return col + 1
+}
+
+// escapeLen returns the length of the ANSI escape sequence at the start of
+// s, or 0 when s does not start with one.
+func escapeLen(s string) int {
+	if len(s) < 2 || s[0] != '\033' || s[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// visibleWidth returns the number of columns s takes on a terminal, not
+// counting ANSI escape sequences.
+func visibleWidth(s string) int {
+	col := 0
+	for i := 0; i < len(s); {
+		if n := escapeLen(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		col = nextColumn(col, r)
+		i += size
+	}
+	return col
+}
+
+// truncateLine writes line to out, cut short with an ellipsis if it is
+// wider than width columns. Escape sequences are kept, and a cut line that
+// had any ends with a reset so that its color does not run on.
+func truncateLine(out *bytes.Buffer, line string, width int) {
+	if visibleWidth(line) <= width {
+		out.WriteString(line)
+		return
+	}
+	col := 0
+	colored := false
+	for i := 0; i < len(line); {
+		if n := escapeLen(line[i:]); n > 0 {
+			out.WriteString(line[i : i+n])
+			colored = true
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		next := nextColumn(col, r)
+		if next > width-1 {
+			break
+		}
+		out.WriteString(line[i : i+size])
+		col = next
+		i += size
+	}
+	out.WriteString(ellipsis)
+	if colored {
+		out.WriteString(colorReset)
+	}
+}
+
+// wrapLine writes line to out, broken into lines of at most width columns
+// where it is wider. Breaks fall at spaces past the indent where possible,
+// and the lines after the first are indented by indent columns.
+func wrapLine(out *bytes.Buffer, line string, width, indent int) {
+	if visibleWidth(line) <= width {
+		out.WriteString(line)
+		return
+	}
+	pad := strings.Repeat(" ", indent)
+	var cur strings.Builder
+	col := 0
+	lastSpace := -1 // position in cur of the last space to break at
+	for i := 0; i < len(line); {
+		if n := escapeLen(line[i:]); n > 0 {
+			cur.WriteString(line[i : i+n])
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		if next := nextColumn(col, r); next > width {
+			text := cur.String()
+			cur.Reset()
+			switch {
+			case r == ' ':
+				out.WriteString(text)
+				r = 0
+			case lastSpace >= 0:
+				out.WriteString(text[:lastSpace])
+				cur.WriteString(text[lastSpace+1:])
+			default:
+				out.WriteString(text)
+			}
+			out.WriteByte('\n')
+			rest := cur.String()
+			cur.Reset()
+			cur.WriteString(pad)
+			cur.WriteString(rest)
+			col, lastSpace = visibleWidth(cur.String()), -1
+			if r == 0 {
+				continue
+			}
+		}
+		if r == ' ' && col > 0 && col >= indent {
+			lastSpace = cur.Len()
+		}
+		cur.WriteRune(r)
+		col = nextColumn(col, r)
+	}
+	out.WriteString(cur.String())
+}
+
+// blockFields are the fields whose multi-line string values, such as errors
+// with their causes and stack traces, TextFormatter writes indented on lines
+// of their own below the entry rather than inline.
+var blockFields = map[string]bool{"error": true, "err": true, "stack": true, "stacktrace": true}
+
+// blockLines returns the lines of entry's value for key when key is one of
+// blockFields and its value is a string of more than one line. Trailing
+// line breaks are dropped, as are carriage returns ending a line.
+func blockLines(entry *parser.LogEntry, key string) ([]string, bool) {
+	if !blockFields[key] {
+		return nil, false
+	}
+	s, ok := entry.Fields[key].(string)
+	if !ok {
+		return nil, false
+	}
+	s = strings.TrimRight(s, "\r\n")
+	if !strings.Contains(s, "\n") {
+		return nil, false
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, true
+}
+
+// writeBlock writes the multi-line value of entry's field key to buf as a
+// "key:" line followed by the value's lines, indented, in the ANSI colour
+// color when it is not empty.
+func (f *TextFormatter) writeBlock(buf *bytes.Buffer, key string, entry *parser.LogEntry, color string) {
+	lines, _ := blockLines(entry, key)
+	lines = stack.Fold(lines, f.FoldStacks)
+	buf.WriteString(color)
+	buf.WriteString("  ")
+	buf.WriteString(f.clean(key))
+	buf.WriteString(":\n")
+	for i, line := range lines {
+		buf.WriteString("    ")
+		buf.WriteString(f.clean(line))
+		if color != "" && i == len(lines)-1 {
+			buf.WriteString(colorReset)
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+// fold returns the multi-line string s with its stack frames folded for
+// FoldStacks, and any other s unchanged.
+func (f *TextFormatter) fold(s string) string {
+	if f.FoldStacks <= 0 || !strings.Contains(s, "\n") {
+		return s
+	}
+	return strings.Join(stack.Fold(strings.Split(s, "\n"), f.FoldStacks), "\n")
+}
+
+// clean returns s with its control characters escaped if f.Sanitize is
+// set, and s unchanged otherwise.
+func (f *TextFormatter) clean(s string) string {
+	if !f.Sanitize {
+		return s
+	}
+	return escapeControl(s)
+}
+
+// escapeControl returns s with its control characters other than tab, and
+// any bytes that are not valid UTF-8, replaced by Go-style escapes such as
+// \n, \x1b and \u009b. Terminals then show them as text instead of acting
+// on them, which defuses ANSI escape sequences.
+func escapeControl(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= ' ' && s[i] < utf8.RuneSelf && s[i] != 0x7f {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteByte('\t')
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r >= 0x80 && r < 0xa0:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// canonical holds the well-known field names that TextFormatter renders in
+// fixed positions so they are not duplicated in the trailing key=value pairs.
+var canonical = map[string]bool{"time": true, "ts": true, "timestamp": true, "level": true, "lvl": true, "severity": true, "message": true, "msg": true, "text": true}
+
+// colorizeLevel returns the level string wrapped in ANSI colour codes when
+// Color is enabled, or as a plain bracketed uppercase token otherwise.
+func (f *TextFormatter) colorizeLevel(level string) string {
+	return levelToken(level, f.Color)
+}
+
+// levelToken returns the bracketed level token, coloured when color is set.
+func levelToken(level string, color bool) string {
+	if !color {
+		return fmt.Sprintf("[%-5s]", strings.ToUpper(level))
+	}
+	switch strings.ToLower(level) {
+	case "error", "err", "fatal", "crit", "critical", "alert", "emergency":
+		return colorRed + colorBold + "[ERROR]" + colorReset
+	case "warn", "warning":
+		return colorYellow + colorBold + "[WARN ]" + colorReset
+	case "info", "information":
+		return colorGreen + colorBold + "[INFO ]" + colorReset
+	default:
+		return colorGray + "[" + strings.ToUpper(level) + "]" + colorReset
+	}
+}
+
+// levelCell returns how level is shown at the start of a line: its
+// bracketed token, its icon, or both, as f.Icons says, coloured when color
+// is set.
+func (f *TextFormatter) levelCell(level string, color bool) string {
+	if f.Icons == IconsOff {
+		return levelToken(level, color)
+	}
+	icon, iconColor := levelIcon(level)
+	if color {
+		icon = iconColor + icon + colorReset
+	}
+	if f.Icons == IconsOnly {
+		return icon
+	}
+	return icon + " " + levelToken(level, color)
+}
+
+// levelIcon returns the symbol for level and its colour: ✖ for errors, ⚠
+// for warnings, ℹ for information, · for debug and trace, and a blank for
+// other levels so that lines stay the same width.
+func levelIcon(level string) (icon, color string) {
+	switch strings.ToLower(level) {
+	case "error", "err", "fatal", "crit", "critical", "alert", "emergency":
+		return "✖", colorRed + colorBold
+	case "warn", "warning":
+		return "⚠", colorYellow + colorBold
+	case "info", "information":
+		return "ℹ", colorGreen + colorBold
+	case "debug", "trace":
+		return "·", colorGray
+	default:
+		return " ", ""
+	}
+}
+
+// lineColor returns the ANSI colour of a whole line at level when
+// ColorLines is set, or "" for a line left to the usual colouring.
+func (f *TextFormatter) lineColor(level string) string {
+	if !f.ColorLines {
+		return ""
+	}
+	switch strings.ToLower(level) {
+	case "error", "err", "fatal", "crit", "critical", "alert", "emergency":
+		return colorRed
+	case "warn", "warning":
+		return colorYellow
+	case "debug", "trace":
+		return colorDim
+	default:
+		return ""
+	}
+}
+
+// extractString tries each key in order and returns the string representation
+// of the first one found in entry. Returns an empty string if none exist.
+func extractString(entry *parser.LogEntry, keys ...string) string {
+	for _, key := range keys {
+		if val, exists := entry.Fields[key]; exists {
+			return valueString(val)
+		}
+	}
+	return ""
+}
+
+// rawLine returns the input line held by an entry that a parser emitted
+// for a line it could not parse: one with a string parser.RawField and no
+// other fields apart from metadata such as _source, whose names begin with
+// an underscore.
+func rawLine(entry *parser.LogEntry) (string, bool) {
+	raw, ok := entry.Fields[parser.RawField].(string)
+	if !ok {
+		return "", false
+	}
+	for _, k := range entry.Keys() {
+		if k != parser.RawField && !strings.HasPrefix(k, "_") {
+			return "", false
+		}
+	}
+	return raw, true
+}
+
+// timePlaceholder stands in for the timestamp of an entry without one.
+const timePlaceholder = "               "
+
+// defaultTimeLayout is the layout timestamps are written with unless
+// TimeLayout says otherwise.
+const defaultTimeLayout = "15:04:05"
+
+// formatTime writes a raw timestamp string for display with f's
+// TimeLayout in its Location, reading a timestamp without a UTC offset in
+// its AssumeLocation, and graying the placeholder for a missing one when
+// color is set.
+func (f *TextFormatter) formatTime(value string, color bool) string {
+	layout, loc := f.TimeLayout, f.Location
+	if layout == "" {
+		layout = defaultTimeLayout
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return formatTimestampIn(value, layout, loc, f.AssumeLocation, color)
+}
+
+// formatTimestamp normalises a raw timestamp string for display as the
+// time of day in UTC.
+func formatTimestamp(value string, color bool) string {
+	return formatTimestampIn(value, defaultTimeLayout, time.UTC, nil, color)
+}
+
+// formatTimestampIn normalises a raw timestamp string for display with
+// layout in loc. It accepts:
+//   - A Unix epoch (seconds, possibly fractional) greater than 1e9
+//   - A timestamp parser.ParseTime understands, taken to be in naive
+//     (UTC when nil) when it carries no UTC offset
+//   - Any other string, truncated to 15 characters
+//
+// Returns a fixed-width blank placeholder when value is empty, grayed when
+// color is set.
+func formatTimestampIn(value, layout string, loc, naive *time.Location, color bool) string {
+	if value == "" {
+		if color {
+			return colorGray + timePlaceholder + colorReset
+		}
+		return timePlaceholder
+	}
+
+	// Try to parse as a Unix timestamp (float).
+	var f float64
+	if _, err := fmt.Sscanf(value, "%f", &f); err == nil && f > 1e9 {
+		t := time.Unix(int64(f), 0).In(loc)
+		return t.Format(layout)
+	}
+
+	// Try RFC 3339 and its variants (e.g. "2024-01-15T12:34:56Z" or
+	// "2024-01-15 12:34:56.789").
+	if t, _, ok := parser.ParseTime(value, naive); ok {
+		return t.In(loc).Format(layout)
+	}
+
+	// Fall back to a prefix of the raw value.
+	if len(value) > 15 {
+		return value[:15]
+	}
+	return value
+}
+
+// LogfmtFormatter writes each log entry as a logfmt line: a sequence of
+// space-separated key=value pairs in the order the fields appeared in the
+// input, or alphabetically by key when that order is unknown. Nested
+// objects and arrays are written as compact JSON. Values that contain
+// spaces, tabs, line breaks or double-quotes are double-quoted, with quotes,
+// backslashes and control characters escaped as the logfmt parser expects,
+// so that the output parses back to the same entry.
+type LogfmtFormatter struct{}
+
+// logfmtEscaper escapes a value written between double quotes.
+var logfmtEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// Format writes a logfmt representation of entry to w.
+func (f *LogfmtFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	for i, k := range entry.Keys() {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		v := valueString(entry.Fields[k])
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		if strings.ContainsAny(v, " \t\"\n\r") {
+			buf.WriteByte('"')
+			logfmtEscaper.WriteString(buf, v)
+			buf.WriteByte('"')
+		} else {
+			buf.WriteString(v)
+		}
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ValueFormatter writes only the values of the named fields, with no keys
+// or decoration, one entry per line and the values separated by tabs:
+// the structured counterpart of awk '{print $3}' for feeding sort, uniq or
+// xargs. Strings are written as they are, apart from tabs and line breaks,
+// which are written as \t, \n and \r so that each entry stays on one line
+// and in its columns; nested objects and arrays are written as compact
+// JSON. A missing field leaves its column empty, and an entry with none of
+// the fields is skipped.
+type ValueFormatter struct {
+	// Fields lists the fields whose values are written, in order. A
+	// dotted path, such as "meta.host", reaches into nested objects.
+	Fields []string
+}
+
+// valueEscaper escapes the characters that would split a value across
+// lines or columns.
+var valueEscaper = strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// Format writes the values of f.Fields in entry to w.
+func (f *ValueFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	found := false
+	for i, k := range f.Fields {
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+		if v, ok := entry.Lookup(k); ok {
+			found = true
+			valueEscaper.WriteString(buf, valueString(v))
+		}
+	}
+	if !found {
+		return nil
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
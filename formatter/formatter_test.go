@@ -0,0 +1,1575 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// JSONFormatter
+// =============================================================================
+
+func TestJSONFormatter_NonPretty_ValidJSON(t *testing.T) {
+	f := &JSONFormatter{Pretty: false}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	line := strings.TrimSpace(buf.String())
+	var result map[string]any
+	if err := json.Unmarshal([]byte(line), &result); err != nil {
+		t.Fatalf("output is not valid JSON: %v\noutput: %s", err, line)
+	}
+}
+
+func TestJSONFormatter_NonPretty_SingleLine(t *testing.T) {
+	f := &JSONFormatter{Pretty: false}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Trailing newline is appended, but the JSON itself must be on one line.
+	trimmed := strings.TrimRight(buf.String(), "\n")
+	if strings.ContainsRune(trimmed, '\n') {
+		t.Errorf("non-pretty JSON must be a single line, got: %s", buf.String())
+	}
+}
+
+func TestJSONFormatter_Pretty_ValidJSON(t *testing.T) {
+	f := &JSONFormatter{Pretty: true}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &result); err != nil {
+		t.Fatalf("pretty output is not valid JSON: %v\noutput: %s", err, buf.String())
+	}
+}
+
+func TestJSONFormatter_Pretty_ContainsNewlines(t *testing.T) {
+	f := &JSONFormatter{Pretty: true}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"a": "1", "b": "2"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\n") {
+		t.Error("pretty JSON should contain newlines")
+	}
+}
+
+func TestJSONFormatter_Pretty_ContainsIndentation(t *testing.T) {
+	f := &JSONFormatter{Pretty: true}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"key": "val"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "  ") {
+		t.Error("pretty JSON should contain indentation (two spaces)")
+	}
+}
+
+func TestJSONFormatter_TrailingNewline(t *testing.T) {
+	for _, pretty := range []bool{false, true} {
+		f := &JSONFormatter{Pretty: pretty}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, parser.NewEntry(map[string]any{"k": "v"})); err != nil {
+			t.Fatalf("Pretty=%v: unexpected error: %v", pretty, err)
+		}
+		if !strings.HasSuffix(buf.String(), "\n") {
+			t.Errorf("Pretty=%v: output should end with newline, got: %q", pretty, buf.String())
+		}
+	}
+}
+
+func TestJSONFormatter_EmptyEntry(t *testing.T) {
+	f := &JSONFormatter{Pretty: false}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != "{}" {
+		t.Errorf("expected {}, got: %s", strings.TrimSpace(buf.String()))
+	}
+}
+
+func TestJSONFormatter_AllFieldsPreserved(t *testing.T) {
+	f := &JSONFormatter{Pretty: false}
+	entry := parser.NewEntry(map[string]any{"a": "1", "b": float64(2), "c": true})
+	var buf bytes.Buffer
+	if err := f.Format(&buf, entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &result); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(result) != 3 {
+		t.Errorf("expected 3 fields, got %d: %v", len(result), result)
+	}
+	if result["a"] != "1" {
+		t.Errorf("a: got %v, want 1", result["a"])
+	}
+	if result["b"] != float64(2) {
+		t.Errorf("b: got %v, want 2", result["b"])
+	}
+	if result["c"] != true {
+		t.Errorf("c: got %v, want true", result["c"])
+	}
+}
+
+// orderedEntry parses a JSON object with the real parser so that the entry
+// carries its input key order.
+func orderedEntry(t *testing.T, line string) *parser.LogEntry {
+	t.Helper()
+	var e *parser.LogEntry
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		t.Fatalf("parsing %s: %v", line, err)
+	}
+	return e
+}
+
+func TestJSONFormatter_PreservesInputKeyOrder(t *testing.T) {
+	f := &JSONFormatter{}
+	var buf bytes.Buffer
+	line := `{"time":"2024-01-15T00:00:00Z","msg":"hello","level":"info","zeta":1,"alpha":2}`
+	if err := f.Format(&buf, orderedEntry(t, line)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != line {
+		t.Errorf("got %s, want %s", got, line)
+	}
+}
+
+func TestJSONFormatter_Pretty_PreservesInputKeyOrder(t *testing.T) {
+	f := &JSONFormatter{Pretty: true}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, orderedEntry(t, `{"b":1,"a":2}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "{\n  \"b\": 1,\n  \"a\": 2\n}\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestJSONFormatter_KeyOrder(t *testing.T) {
+	line := `{"service":"api","msg":"hello","meta":{"z":1,"a":2},"level":"info","time":"2024-01-15T00:00:00Z"}`
+	tests := []struct {
+		order []string
+		want  string
+	}{
+		{CanonicalKeys, `{"time":"2024-01-15T00:00:00Z","level":"info","msg":"hello","meta":{"a":2,"z":1},"service":"api"}`},
+		{[]string{}, `{"level":"info","meta":{"a":2,"z":1},"msg":"hello","service":"api","time":"2024-01-15T00:00:00Z"}`},
+		{[]string{"service", "missing", "level"}, `{"service":"api","level":"info","meta":{"a":2,"z":1},"msg":"hello","time":"2024-01-15T00:00:00Z"}`},
+	}
+	for _, tt := range tests {
+		f := &JSONFormatter{KeyOrder: tt.order}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, orderedEntry(t, line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := strings.TrimSpace(buf.String()); got != tt.want {
+			t.Errorf("KeyOrder %q: got %s, want %s", tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestJSONFormatter_Pretty_KeyOrder(t *testing.T) {
+	f := &JSONFormatter{Pretty: true, KeyOrder: CanonicalKeys}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, orderedEntry(t, `{"b":"<x>","msg":"m"}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "{\n  \"msg\": \"m\",\n  \"b\": \"\\u003cx\\u003e\"\n}\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// =============================================================================
+// TextFormatter
+// =============================================================================
+
+func TestTextFormatter_BasicOutput_ContainsMessage(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "test message", "time": "2024-01-01T12:00:00Z"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "test message") {
+		t.Errorf("output should contain message, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_BasicOutput_ContainsLevel(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "hello"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "INFO") {
+		t.Errorf("output should contain level, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_TrailingNewline(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "test"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(buf.String(), "\n") {
+		t.Errorf("output should end with newline, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorDisabled_LevelFormat_Info(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[INFO ]") {
+		t.Errorf("expected [INFO ] in output, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorDisabled_LevelFormat_Error(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "error", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[ERROR]") {
+		t.Errorf("expected [ERROR] in output, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorDisabled_LevelFormat_Warn(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "warn", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[WARN ]") {
+		t.Errorf("expected [WARN ] in output, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorDisabled_LevelFormat_Debug(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "debug", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[DEBUG]") {
+		t.Errorf("expected [DEBUG] in output, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorDisabled_LevelFormat_UpperCase(t *testing.T) {
+	// Level is uppercased regardless of input case.
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "INFO", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[INFO ]") {
+		t.Errorf("expected [INFO ] for uppercase input, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorEnabled_ContainsANSICodes(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "error", "msg": "test"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\033[") {
+		t.Error("expected ANSI escape codes in color output")
+	}
+}
+
+func TestTextFormatter_ColorEnabled_ErrorLevel_UsesRed(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "error", "msg": "x"}))
+	if !strings.Contains(buf.String(), colorRed) {
+		t.Errorf("expected red color code for error level, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorEnabled_WarnLevel_UsesYellow(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "warn", "msg": "x"}))
+	if !strings.Contains(buf.String(), colorYellow) {
+		t.Errorf("expected yellow color code for warn level, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorEnabled_InfoLevel_UsesGreen(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x"}))
+	if !strings.Contains(buf.String(), colorGreen) {
+		t.Errorf("expected green color code for info level, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorEnabled_UnknownLevel_UsesGray(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "trace", "msg": "x"}))
+	if !strings.Contains(buf.String(), colorGray) {
+		t.Errorf("expected gray color code for unknown level, got: %q", buf.String())
+	}
+}
+
+// colorizeLevel aliases for error: "err", "fatal", "crit"
+func TestTextFormatter_ColorEnabled_ErrAlias(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "err", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[ERROR]") {
+		t.Errorf("expected [ERROR] for level=err, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorEnabled_FatalAlias(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "fatal", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[ERROR]") {
+		t.Errorf("expected [ERROR] for level=fatal, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorEnabled_WarningAlias(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "warning", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[WARN ]") {
+		t.Errorf("expected [WARN ] for level=warning, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_ColorEnabled_InformationAlias(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "information", "msg": "x"}))
+	if !strings.Contains(buf.String(), "[INFO ]") {
+		t.Errorf("expected [INFO ] for level=information, got: %q", buf.String())
+	}
+}
+
+func TestTextFormatter_MissingLevel_NoError(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"msg": "no level here"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "no level here") {
+		t.Errorf("output should contain message, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_MissingMessage_NoError(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTextFormatter_MissingTimestamp_NoError(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Alternative keys for level: "lvl", "severity"
+func TestTextFormatter_AlternativeLevelKey_Lvl(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"lvl": "warn", "msg": "x"}))
+	if !strings.Contains(buf.String(), "WARN") {
+		t.Errorf("expected WARN from lvl key, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_AlternativeLevelKey_Severity(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"severity": "error", "msg": "x"}))
+	if !strings.Contains(buf.String(), "ERROR") {
+		t.Errorf("expected ERROR from severity key, got: %s", buf.String())
+	}
+}
+
+// Alternative keys for message: "message", "text"
+func TestTextFormatter_AlternativeMessageKey_Message(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "message": "msg via message key"}))
+	if !strings.Contains(buf.String(), "msg via message key") {
+		t.Errorf("expected message content, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_AlternativeMessageKey_Text(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "text": "msg via text key"}))
+	if !strings.Contains(buf.String(), "msg via text key") {
+		t.Errorf("expected message content, got: %s", buf.String())
+	}
+}
+
+// Alternative keys for timestamp: "ts", "timestamp"
+func TestTextFormatter_AlternativeTimeKey_Ts(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x", "ts": "2024-06-15T09:30:00Z"}))
+	if !strings.Contains(buf.String(), "09:30:00") {
+		t.Errorf("expected formatted time from ts key, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_AlternativeTimeKey_Timestamp(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x", "timestamp": "2024-06-15T14:45:00Z"}))
+	if !strings.Contains(buf.String(), "14:45:00") {
+		t.Errorf("expected formatted time from timestamp key, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_RFC3339Timestamp_FormattedAsTime(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x", "time": "2024-01-01T12:34:56Z"}))
+	if !strings.Contains(buf.String(), "12:34:56") {
+		t.Errorf("expected 12:34:56 in output, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_OffsetTimestamp_ShownInUTC(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x", "time": "2024-01-01T14:34:56+02:00"}))
+	if !strings.Contains(buf.String(), "12:34:56") {
+		t.Errorf("expected 12:34:56 in output, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_UnixTimestamp_FormattedAsTime(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	// 1704067200 = 2024-01-01T00:00:00Z
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x", "time": "1704067200"}))
+	out := buf.String()
+	// Should contain a HH:MM:SS formatted time.
+	if !strings.Contains(out, ":") {
+		t.Errorf("expected HH:MM:SS formatted time, got: %s", out)
+	}
+}
+
+// Non-canonical extra fields are appended after message.
+func TestTextFormatter_ExtrasAppended_NoFields(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"level":   "info",
+		"msg":     "hello",
+		"service": "api",
+		"host":    "srv1",
+	}))
+	out := buf.String()
+	if !strings.Contains(out, "service=api") {
+		t.Errorf("expected service=api in extras, got: %s", out)
+	}
+	if !strings.Contains(out, "host=srv1") {
+		t.Errorf("expected host=srv1 in extras, got: %s", out)
+	}
+}
+
+func TestTextFormatter_ExtrasSortedAlphabetically(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"level":   "info",
+		"msg":     "hello",
+		"z_field": "last",
+		"a_field": "first",
+		"m_field": "middle",
+	}))
+	out := buf.String()
+	aIdx := strings.Index(out, "a_field")
+	mIdx := strings.Index(out, "m_field")
+	zIdx := strings.Index(out, "z_field")
+	if aIdx == -1 || mIdx == -1 || zIdx == -1 {
+		t.Fatalf("expected all fields in output, got: %s", out)
+	}
+	if aIdx >= mIdx || mIdx >= zIdx {
+		t.Errorf("fields should be sorted alphabetically (a < m < z), got: %s", out)
+	}
+}
+
+func TestTextFormatter_CanonicalFieldsNotInExtras(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"time":  "2024-01-01T00:00:00Z",
+		"level": "info",
+		"msg":   "hello",
+	}))
+	out := buf.String()
+	// Canonical fields must not appear as "key=value" extras.
+	for _, bad := range []string{"time=", "level=", "msg="} {
+		if strings.Contains(out, bad) {
+			t.Errorf("canonical field %q must not appear in extras, got: %s", bad, out)
+		}
+	}
+}
+
+// When Fields is specified, only those fields appear as extras (in order).
+func TestTextFormatter_FieldsFilter_OnlyIncludesSpecified(t *testing.T) {
+	f := &TextFormatter{Color: false, Fields: []string{"service"}}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"level":   "info",
+		"msg":     "hello",
+		"service": "api",
+		"host":    "srv1",
+	}))
+	out := buf.String()
+	if !strings.Contains(out, "service=api") {
+		t.Errorf("expected service=api in output, got: %s", out)
+	}
+	if strings.Contains(out, "host=") {
+		t.Errorf("host should not appear when not in Fields, got: %s", out)
+	}
+}
+
+func TestTextFormatter_FieldsFilter_AbsentFieldsSkipped(t *testing.T) {
+	// Requesting a field that doesn't exist in the entry should not error.
+	f := &TextFormatter{Color: false, Fields: []string{"nonexistent"}}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// "nonexistent" is absent, so no extras appear.
+	if strings.Contains(buf.String(), "nonexistent") {
+		t.Errorf("absent field should not appear in output, got: %s", buf.String())
+	}
+}
+
+func TestTextFormatter_FieldsFilter_MultipleFields(t *testing.T) {
+	f := &TextFormatter{Color: false, Fields: []string{"service", "region"}}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"level":   "info",
+		"msg":     "hello",
+		"service": "api",
+		"region":  "us-east",
+		"host":    "srv1",
+	}))
+	out := buf.String()
+	if !strings.Contains(out, "service=api") {
+		t.Errorf("expected service=api, got: %s", out)
+	}
+	if !strings.Contains(out, "region=us-east") {
+		t.Errorf("expected region=us-east, got: %s", out)
+	}
+	if strings.Contains(out, "host=") {
+		t.Errorf("host should be excluded, got: %s", out)
+	}
+}
+
+func TestTextFormatter_ColorEnabled_ExtrasInGray(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x", "svc": "api"}))
+	out := buf.String()
+	// The extras section is wrapped in gray.
+	if !strings.Contains(out, colorGray) {
+		t.Errorf("expected gray ANSI code for extras in color mode, got: %q", out)
+	}
+}
+
+// Entries emitted for unparsed lines are written as the original line.
+
+func TestTextFormatter_RawEntry_WrittenVerbatim(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	var buf bytes.Buffer
+	entry := parser.NewEntry(nil)
+	entry.Set(parser.RawField, "\tgoroutine 1 [running]:")
+	entry.Set("_source", "app.log")
+	f.Format(&buf, entry)
+	if got := buf.String(); got != "\tgoroutine 1 [running]:\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTextFormatter_RawFieldAmongOthers_FormattedNormally(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"_raw": "original", "msg": "parsed"}))
+	out := buf.String()
+	if !strings.Contains(out, "parsed") || !strings.Contains(out, "_raw=original") {
+		t.Errorf("expected a normal text line, got: %q", out)
+	}
+}
+
+// With Sanitize set, control characters in the entry are escaped so that a
+// log line cannot drive the terminal.
+
+func TestTextFormatter_Sanitize_EscapesControlCharacters(t *testing.T) {
+	f := &TextFormatter{Sanitize: true}
+	var buf bytes.Buffer
+	entry := parser.NewEntry(map[string]any{"level": "info", "msg": "\x1b[2Jcleared\r\nforged line", "user\x07": "a\tb\x00"})
+	if err := f.Format(&buf, entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ` [INFO ] \x1b[2Jcleared\r\nforged line user\x07=a` + "\t" + `b\x00` + "\n"
+	if got := buf.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want suffix %q", got, want)
+	}
+}
+
+func TestTextFormatter_Sanitize_RawEntry(t *testing.T) {
+	f := &TextFormatter{Sanitize: true}
+	var buf bytes.Buffer
+	entry := parser.NewEntry(nil)
+	entry.Set(parser.RawField, "binary \xff\xfe\x1b]0;title\x07")
+	f.Format(&buf, entry)
+	if got, want := buf.String(), `binary \xff\xfe\x1b]0;title\x07`+"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTextFormatter_NoSanitize_WritesControlCharacters(t *testing.T) {
+	f := &TextFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "\x1b[31mred"}))
+	if !strings.Contains(buf.String(), "\x1b[31mred") {
+		t.Errorf("got %q, want the escape sequence unchanged", buf.String())
+	}
+}
+
+func TestEscapeControl(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{"héllo 世界", "héllo 世界"},
+		{"tab\tkept", "tab\tkept"},
+		{"del\x7f", `del\x7f`},
+		{"csi\u009b31m", `csi\u009b31m`},
+		{"bad\xc3", `bad\xc3`},
+		{"\ufffd stays", "\ufffd stays"},
+	}
+	for _, tt := range tests {
+		if got := escapeControl(tt.in); got != tt.want {
+			t.Errorf("escapeControl(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Multi-line error and stack trace fields are written below the entry.
+func TestTextFormatter_MultilineError_WrittenAsBlock(t *testing.T) {
+	f := &TextFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"time":  "2024-01-15T10:00:00Z",
+		"level": "error",
+		"msg":   "request failed",
+		"stack": "goroutine 1 [running]:\r\nmain.main()\r\n\t/app/main.go:12 +0x1d\n",
+		"error": "dial tcp: refused\ncaused by: timeout",
+		"user":  "u1",
+	}))
+	want := "10:00:00 [ERROR] request failed user=u1\n" +
+		"  error:\n    dial tcp: refused\n    caused by: timeout\n" +
+		"  stack:\n    goroutine 1 [running]:\n    main.main()\n    \t/app/main.go:12 +0x1d\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_SingleLineError_Inline(t *testing.T) {
+	f := &TextFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "x", "err": "refused\n", "trace": "a\nb"}))
+	if want := " [     ] x err=refused\n trace=a\nb\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("got %q, want it to end with %q", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_MultilineError_ColorAndSanitize(t *testing.T) {
+	f := &TextFormatter{Color: true, Sanitize: true, Fields: []string{"stacktrace"}}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "x", "stacktrace": "a\x1b[2J\nb", "other": "y"}))
+	out := buf.String()
+	want := colorRed + "  stacktrace:\n    a\\x1b[2J\n    b" + colorReset + "\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("got %q, want it to end with %q", out, want)
+	}
+	if strings.Contains(out, "other") {
+		t.Errorf("got %q, want only the requested fields", out)
+	}
+}
+
+func TestTextFormatter_FoldStacks_Block(t *testing.T) {
+	f := &TextFormatter{FoldStacks: 1}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"msg":   "request failed",
+		"stack": "java.io.IOException: closed\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n\tat a.B.e(B.java:3)",
+	}))
+	want := "  stack:\n    java.io.IOException: closed\n    \tat a.B.c(B.java:1)\n    \t... 2 more frames\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("got %q, want it to end with %q", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_FoldStacks_Message(t *testing.T) {
+	f := &TextFormatter{FoldStacks: 1}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{
+		"msg": "boom\n    at render (/app/view.js:14:9)\n    at main (/app/index.js:3:1)\n    at run (/app/index.js:9:1)",
+	}))
+	want := "[     ] boom\n    at render (/app/view.js:14:9)\n    ... 2 more frames\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("got %q, want it to end with %q", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_LineNumbers(t *testing.T) {
+	f := &TextFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "started", "_line": 42, "_offset": 3120}))
+	f.Format(&buf, parser.NewEntry(map[string]any{"_raw": "not json", "_line": 43, "_offset": 3170}))
+	want := "42: 10:00:00 [INFO ] started _offset=3120\n43: not json\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_LineNumbers_Align(t *testing.T) {
+	f := &TextFormatter{Align: true, Fields: []string{"user"}}
+	f.Measure(parser.NewEntry(map[string]any{"msg": "a", "_line": 1000}))
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "b", "user": "bob", "_line": 7}))
+	if want := "7:    [     ] b user=bob\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_ColorLines_WholeLineByLevel(t *testing.T) {
+	f := &TextFormatter{ColorLines: true}
+	tests := []struct {
+		level, color string
+	}{
+		{"error", colorRed},
+		{"FATAL", colorRed},
+		{"warn", colorYellow},
+		{"debug", colorDim},
+		{"trace", colorDim},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		f.Format(&buf, parser.NewEntry(map[string]any{"level": tt.level, "msg": "x", "svc": "api"}))
+		want := tt.color + fmt.Sprintf("                [%-5s] x svc=api", strings.ToUpper(tt.level)) + colorReset + "\n"
+		if got := buf.String(); got != want {
+			t.Errorf("%s: got %q, want %q", tt.level, got, want)
+		}
+	}
+}
+
+func TestTextFormatter_ColorLines_InfoKeepsUsualColor(t *testing.T) {
+	var buf bytes.Buffer
+	(&TextFormatter{ColorLines: true}).Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x"}))
+	if got := buf.String(); strings.Contains(got, "\033[") {
+		t.Errorf("info line without Color got %q, want no colour", got)
+	}
+	buf.Reset()
+	(&TextFormatter{Color: true, ColorLines: true}).Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x"}))
+	if got := buf.String(); !strings.Contains(got, colorGreen+colorBold+"[INFO ]"+colorReset) {
+		t.Errorf("info line with Color got %q, want a green level", got)
+	}
+}
+
+func TestTextFormatter_ColorLines_ErrorBlockInLineColor(t *testing.T) {
+	f := &TextFormatter{Color: true, ColorLines: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "warn", "msg": "x", "error": "a\nb"}))
+	want := colorYellow + "                [WARN ] x" + colorReset + "\n" + colorYellow + "  error:\n    a\n    b" + colorReset + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTextFormatter_Width_TruncatesWithEllipsis(t *testing.T) {
+	f := &TextFormatter{Width: 30}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "connection pool exhausted after retries"}))
+	want := "10:00:00 [INFO ] connection p…\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTextFormatter_Width_ShortLinesUnchanged(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "ok"})
+	var plain, fitted bytes.Buffer
+	(&TextFormatter{}).Format(&plain, entry)
+	(&TextFormatter{Width: 80, Wrap: true}).Format(&fitted, entry)
+	if plain.String() != fitted.String() {
+		t.Errorf("got %q, want %q", fitted.String(), plain.String())
+	}
+}
+
+func TestTextFormatter_Width_TruncateResetsColor(t *testing.T) {
+	f := &TextFormatter{Width: 20, ColorLines: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "error", "msg": "disk full"}))
+	want := colorRed + "10:00:00 [ERROR] di…" + colorReset + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTextFormatter_Wrap_HangingIndent(t *testing.T) {
+	f := &TextFormatter{Width: 40, Wrap: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "the connection pool was exhausted after three retries"}))
+	want := "10:00:00 [INFO ] the connection pool was\n" +
+		"                 exhausted after three\n" +
+		"                 retries\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTextFormatter_Wrap_LongWordIsSplit(t *testing.T) {
+	f := &TextFormatter{Width: 34, Wrap: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "abcdefghijklmnopqrstuvwxyz"}))
+	want := "10:00:00 [INFO ] abcdefghijklmnopq\n                 rstuvwxyz\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTextFormatter_Wrap_BlockLinesIndentUnderThemselves(t *testing.T) {
+	f := &TextFormatter{Width: 20, Wrap: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "error", "msg": "x", "error": "one two three four five\nsix"}))
+	want := "10:00:00 [ERROR] x\n  error:\n    one two three\n      four five\n    six\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTextFormatter_TimeLayout(t *testing.T) {
+	chicago := time.FixedZone("CST", -6*3600)
+	tests := []struct {
+		layout string
+		loc    *time.Location
+		time   any
+		want   string
+	}{
+		{"", nil, "2024-01-15T10:00:00+02:00", "08:00:00 [INFO ] hi\n"},
+		{"2006-01-02 15:04:05.000", nil, "2024-01-15T10:00:00.25Z", "2024-01-15 10:00:00.250 [INFO ] hi\n"},
+		{"", chicago, "2024-01-15T10:00:00Z", "04:00:00 [INFO ] hi\n"},
+		{"Jan _2 15:04 MST", chicago, "1705312800", "Jan 15 04:00 CST [INFO ] hi\n"},
+		{"2006-01-02", chicago, "yesterday", "yesterday [INFO ] hi\n"},
+	}
+	for _, tt := range tests {
+		f := &TextFormatter{TimeLayout: tt.layout, Location: tt.loc}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, parser.NewEntry(map[string]any{"time": tt.time, "level": "info", "msg": "hi"})); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("layout %q in %v: got %q, want %q", tt.layout, tt.loc, got, tt.want)
+		}
+	}
+}
+
+func TestTextFormatter_TimeLayout_Naive(t *testing.T) {
+	chicago := time.FixedZone("CST", -6*3600)
+	berlin := time.FixedZone("CET", 3600)
+	tests := []struct {
+		assume *time.Location
+		time   string
+		want   string
+	}{
+		{nil, "2024-01-01T09:30:00", "2024-01-01 03:30:00.000 CST"},
+		{nil, "2024-01-01 09:30:00.125", "2024-01-01 03:30:00.125 CST"},
+		{berlin, "2024-01-01T09:30:00", "2024-01-01 02:30:00.000 CST"},
+		{berlin, "2024-01-01T09:30:00.5+00:00", "2024-01-01 03:30:00.500 CST"},
+	}
+	for _, tt := range tests {
+		f := &TextFormatter{TimeLayout: "2006-01-02 15:04:05.000 MST", Location: chicago, AssumeLocation: tt.assume}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, parser.NewEntry(map[string]any{"time": tt.time, "level": "info", "msg": "hi"})); err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want + " [INFO ] hi\n"; buf.String() != want {
+			t.Errorf("%q assumed in %v: got %q, want %q", tt.time, tt.assume, buf.String(), want)
+		}
+	}
+}
+
+func TestTextFormatter_MaxValue(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "a very long message", "user": "alice", "body": "héllo wörld"})
+	tests := []struct {
+		f    *TextFormatter
+		want string
+	}{
+		{&TextFormatter{MaxValue: 8}, "10:00:00 [INFO ] a very … body=héllo w… user=alice\n"},
+		{&TextFormatter{MaxValue: 8, Limits: map[string]int{"message": 0, "body": 3}}, "10:00:00 [INFO ] a very long message body=hé… user=alice\n"},
+		{&TextFormatter{Limits: map[string]int{"msg": 6}}, "10:00:00 [INFO ] a ver… body=héllo wörld user=alice\n"},
+		{&TextFormatter{MaxValue: 4, Fields: []string{"user"}, Align: true}, "10:00:00 [INFO ] a v… user=ali…\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := tt.f.Format(&buf, entry); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("MaxValue %d, Limits %v: got %q, want %q", tt.f.MaxValue, tt.f.Limits, got, tt.want)
+		}
+	}
+}
+
+func TestTextFormatter_MaxValue_Sanitize(t *testing.T) {
+	f := &TextFormatter{MaxValue: 5, Sanitize: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "ab\x1bcdef"}))
+	// Cut before escaping, so that no escape is cut in two.
+	if want := "10:00:00 [INFO ] ab\\x1bc…\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_Align_PadsColumns(t *testing.T) {
+	f := &TextFormatter{Align: true, Fields: []string{"user", "dur"}}
+	entries := []*parser.LogEntry{
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "warning", "msg": "slow request", "user": "alice", "dur": 1500}),
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:01Z", "level": "info", "msg": "ok", "dur": 5}),
+	}
+	for _, e := range entries {
+		f.Measure(e)
+	}
+	var buf bytes.Buffer
+	for _, e := range entries {
+		f.Format(&buf, e)
+	}
+	want := "10:00:00 [WARNING] slow request user=alice dur=1500\n" +
+		"10:00:01 [INFO ]   ok                      dur=5\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTextFormatter_Align_ColumnsOnlyWiden(t *testing.T) {
+	f := &TextFormatter{Align: true}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "a much longer message", "k": "v"}))
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "short", "k": "v"}))
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "short"}))
+	want := "[INFO ] a much longer message k=v\n" +
+		"[INFO ] short                 k=v\n" +
+		"[INFO ] short\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTextFormatter_Align_SourceColumn(t *testing.T) {
+	f := &TextFormatter{Align: true}
+	f.Measure(parser.NewEntry(map[string]any{"level": "info", "msg": "x", parser.SourceField: "api.log"}))
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "x", parser.SourceField: "db.log", "k": "v"}))
+	if want := "[INFO ] db.log  x k=v\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTextFormatter_Icons(t *testing.T) {
+	tests := []struct {
+		icons LevelIcons
+		level string
+		want  string
+	}{
+		{IconsBeside, "error", "10:00:00 ✖ [ERROR] x\n"},
+		{IconsBeside, "warn", "10:00:00 ⚠ [WARN ] x\n"},
+		{IconsBeside, "info", "10:00:00 ℹ [INFO ] x\n"},
+		{IconsBeside, "debug", "10:00:00 · [DEBUG] x\n"},
+		{IconsBeside, "notice", "10:00:00   [NOTICE] x\n"},
+		{IconsOnly, "error", "10:00:00 ✖ x\n"},
+		{IconsOnly, "", "10:00:00   x\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		(&TextFormatter{Icons: tt.icons}).Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": tt.level, "msg": "x"}))
+		if got := buf.String(); got != tt.want {
+			t.Errorf("Icons %d, level %q: got %q, want %q", tt.icons, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestTextFormatter_Icons_Color(t *testing.T) {
+	var buf bytes.Buffer
+	(&TextFormatter{Icons: IconsOnly, Color: true}).Format(&buf, parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "warn", "msg": "x"}))
+	if want := "10:00:00 " + colorYellow + colorBold + "⚠" + colorReset + " x\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// =============================================================================
+// LogfmtFormatter
+// =============================================================================
+
+func TestLogfmtFormatter_BasicOutput_ContainsKeyValues(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := strings.TrimSpace(buf.String())
+	if !strings.Contains(out, "level=info") {
+		t.Errorf("expected level=info, got: %s", out)
+	}
+	if !strings.Contains(out, "msg=hello") {
+		t.Errorf("expected msg=hello, got: %s", out)
+	}
+}
+
+func TestLogfmtFormatter_TrailingNewline(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"k": "v"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(buf.String(), "\n") {
+		t.Errorf("output should end with newline, got: %q", buf.String())
+	}
+}
+
+func TestLogfmtFormatter_PreservesInputKeyOrder(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, orderedEntry(t, `{"time":"t","msg":"m","level":"l","b":1}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "time=t msg=m level=l b=1" {
+		t.Errorf("got %q, want input order", got)
+	}
+}
+
+func TestTextFormatter_ExtrasSortedWhateverTheInputOrder(t *testing.T) {
+	f := &TextFormatter{}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, orderedEntry(t, `{"msg":"m","b":1,"a":2}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := buf.String(); !strings.HasSuffix(got, " m a=2 b=1\n") {
+		t.Errorf("got %q, want the extra fields sorted", got)
+	}
+}
+
+func TestLogfmtFormatter_KeysSortedAlphabetically(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"z_key": "last", "a_key": "first", "m_key": "middle"}))
+	out := buf.String()
+	aIdx := strings.Index(out, "a_key")
+	mIdx := strings.Index(out, "m_key")
+	zIdx := strings.Index(out, "z_key")
+	if aIdx == -1 || mIdx == -1 || zIdx == -1 {
+		t.Fatalf("expected all keys in output, got: %s", out)
+	}
+	if aIdx >= mIdx || mIdx >= zIdx {
+		t.Errorf("keys should be sorted alphabetically, got: %s", out)
+	}
+}
+
+func TestLogfmtFormatter_PlainValue_NotQuoted(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "error"}))
+	out := strings.TrimSpace(buf.String())
+	if out != "level=error" {
+		t.Errorf("expected level=error, got: %s", out)
+	}
+}
+
+func TestLogfmtFormatter_ValueWithSpace_IsQuoted(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "hello world"}))
+	out := buf.String()
+	if !strings.Contains(out, `msg="hello world"`) {
+		t.Errorf("expected quoted value for space, got: %s", out)
+	}
+}
+
+func TestLogfmtFormatter_ValueWithTab_IsQuoted(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "hello\tworld"}))
+	out := buf.String()
+	if !strings.Contains(out, `"`) {
+		t.Errorf("expected quoted value for tab, got: %s", out)
+	}
+}
+
+func TestLogfmtFormatter_ValueWithDoubleQuote_IsQuotedAndEscaped(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": `say "hello"`}))
+	out := buf.String()
+	// The value contains quotes, so the whole value is wrapped in quotes
+	// and inner quotes are backslash-escaped.
+	if !strings.Contains(out, `msg="say \"hello\""`) {
+		t.Errorf("expected escaped quotes, got: %s", out)
+	}
+}
+
+func TestLogfmtFormatter_EscapesBackslashesAndLineBreaks(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "a \\ b\nc", "path": `C:\dir`}))
+	want := `msg="a \\ b\nc" path=C:\dir` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLogfmtFormatter_RoundTrip(t *testing.T) {
+	values := []string{`say "hello"`, `back\slash and space`, "two\nlines\r", "tab\there", `\"`, `C:\plain`, ""}
+	for _, v := range values {
+		var buf bytes.Buffer
+		if err := (&LogfmtFormatter{}).Format(&buf, parser.NewEntry(map[string]any{"msg": v})); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := parser.ParseLogfmt(strings.TrimSuffix(buf.String(), "\n"))
+		if err != nil {
+			t.Errorf("%q: parsing %q: %v", v, buf.String(), err)
+			continue
+		}
+		if entry.Fields["msg"] != v {
+			t.Errorf("%q: round trip gave %q (via %q)", v, entry.Fields["msg"], buf.String())
+		}
+	}
+}
+
+func TestLogfmtFormatter_EmptyEntry_OutputsBlankLine(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Empty entry → empty parts → Fprintln writes just a newline.
+	if buf.String() != "\n" {
+		t.Errorf("expected single newline for empty entry, got: %q", buf.String())
+	}
+}
+
+func TestLogfmtFormatter_MultipleEntries_EachOnOwnLine(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "info", "msg": "first"}))
+	f.Format(&buf, parser.NewEntry(map[string]any{"level": "error", "msg": "second"}))
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Errorf("expected 2 lines, got %d: %v", len(lines), lines)
+	}
+}
+
+// =============================================================================
+// ValueFormatter
+// =============================================================================
+
+func TestValueFormatter_SingleField_WritesRawValue(t *testing.T) {
+	f := &ValueFormatter{Fields: []string{"user"}}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"user": "alice", "msg": "login"}))
+	f.Format(&buf, parser.NewEntry(map[string]any{"user": "bob smith", "msg": "login"}))
+	if want := "alice\nbob smith\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestValueFormatter_MultipleFields_TabSeparated(t *testing.T) {
+	f := &ValueFormatter{Fields: []string{"status", "path", "user"}}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"status": json.Number("404"), "path": "/x", "user": map[string]any{"id": json.Number("7")}}))
+	f.Format(&buf, parser.NewEntry(map[string]any{"path": "/y"}))
+	if want := "404\t/x\t{\"id\":7}\n\t/y\t\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestValueFormatter_MissingFields_SkipsEntry(t *testing.T) {
+	f := &ValueFormatter{Fields: []string{"user"}}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, parser.NewEntry(map[string]any{"msg": "startup"})); err != nil || buf.Len() != 0 {
+		t.Errorf("Format = %v, output %q; want nothing written", err, buf.String())
+	}
+}
+
+func TestValueFormatter_EscapesTabsAndLineBreaks(t *testing.T) {
+	f := &ValueFormatter{Fields: []string{"msg"}}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "a\tb\r\nc \\d"}))
+	if want := `a\tb\r\nc \d` + "\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+// =============================================================================
+// formatTimestamp (white-box tests: package formatter)
+// =============================================================================
+
+func TestFormatTimestamp_EmptyString_ReturnsPlaceholder(t *testing.T) {
+	out := formatTimestamp("", true)
+	// Returns colorGray + 15 spaces + colorReset with color.
+	if out != colorGray+"               "+colorReset {
+		t.Errorf("expected a gray placeholder with color, got: %q", out)
+	}
+	// And plain padding without, so that no escape codes reach a pipe.
+	if out := formatTimestamp("", false); out != "               " {
+		t.Errorf("expected 15 spaces without color, got: %q", out)
+	}
+}
+
+func TestFormatTimestamp_RFC3339_FormattedAsHHMMSS(t *testing.T) {
+	out := formatTimestamp("2024-01-15T09:30:00Z", false)
+	if out != "09:30:00" {
+		t.Errorf("got %q, want %q", out, "09:30:00")
+	}
+}
+
+func TestFormatTimestamp_RFC3339_WithOffset(t *testing.T) {
+	// time.Parse(time.RFC3339, ...) normalizes to the parsed zone; Format("15:04:05")
+	// outputs in that zone. UTC offset "+00:00" should give same as "Z".
+	out := formatTimestamp("2024-06-01T18:00:00+00:00", false)
+	if out != "18:00:00" {
+		t.Errorf("got %q, want %q", out, "18:00:00")
+	}
+}
+
+func TestFormatTimestamp_UnixSeconds_FormattedAsHHMMSS(t *testing.T) {
+	// 1704067200 = 2024-01-01T00:00:00Z
+	out := formatTimestamp("1704067200", false)
+	if out != "00:00:00" {
+		t.Errorf("got %q, want %q", out, "00:00:00")
+	}
+}
+
+func TestFormatTimestamp_UnixFloat_FormattedAsHHMMSS(t *testing.T) {
+	// Float unix timestamp; fractional seconds are truncated.
+	out := formatTimestamp("1704067200.5", false)
+	if out != "00:00:00" {
+		t.Errorf("got %q, want %q", out, "00:00:00")
+	}
+}
+
+func TestFormatTimestamp_SmallNumber_NotTreatedAsUnix(t *testing.T) {
+	// Numbers <= 1e9 are not treated as unix timestamps.
+	// "123" is a short string (len <= 15) and cannot be parsed as RFC3339,
+	// and 123.0 <= 1e9, so it falls through to the string truncation path.
+	out := formatTimestamp("123", false)
+	if out != "123" {
+		t.Errorf("got %q, want %q", out, "123")
+	}
+}
+
+func TestFormatTimestamp_ShortNonParseable_ReturnedAsIs(t *testing.T) {
+	out := formatTimestamp("short", false)
+	if out != "short" {
+		t.Errorf("got %q, want %q", out, "short")
+	}
+}
+
+func TestFormatTimestamp_ExactlyFifteenChars_ReturnedAsIs(t *testing.T) {
+	// Use a non-numeric string that can't be parsed as a float or RFC3339,
+	// so it reaches the len-check branch. Exactly 15 chars → returned as-is.
+	val := "abcdefghijklmno" // exactly 15 chars, not a number, not RFC3339
+	out := formatTimestamp(val, false)
+	if out != val {
+		t.Errorf("got %q, want %q", out, val)
+	}
+}
+
+func TestFormatTimestamp_MoreThanFifteenChars_Truncated(t *testing.T) {
+	val := "this-is-a-very-long-non-parseable-timestamp"
+	out := formatTimestamp(val, false)
+	if len(out) > 15 {
+		t.Errorf("expected truncation to 15 chars, got %d: %q", len(out), out)
+	}
+	if out != val[:15] {
+		t.Errorf("got %q, want %q", out, val[:15])
+	}
+}
+
+// =============================================================================
+// extractString (white-box tests: package formatter)
+// =============================================================================
+
+func TestExtractString_FirstKeyPresent(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"time": "2024", "ts": "old"})
+	out := extractString(entry, "time", "ts")
+	if out != "2024" {
+		t.Errorf("got %q, want %q", out, "2024")
+	}
+}
+
+func TestExtractString_FallsBackToSecondKey(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"ts": "fallback"})
+	out := extractString(entry, "time", "ts")
+	if out != "fallback" {
+		t.Errorf("got %q, want %q", out, "fallback")
+	}
+}
+
+func TestExtractString_NoKeyPresent_ReturnsEmpty(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"other": "value"})
+	out := extractString(entry, "time", "ts", "timestamp")
+	if out != "" {
+		t.Errorf("got %q, want empty string", out)
+	}
+}
+
+func TestExtractString_EmptyEntry_ReturnsEmpty(t *testing.T) {
+	out := extractString(parser.NewEntry(nil), "level", "lvl")
+	if out != "" {
+		t.Errorf("got %q, want empty string", out)
+	}
+}
+
+func TestExtractString_NumericValue_ReturnedAsString(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"count": float64(42)})
+	out := extractString(entry, "count")
+	if out != "42" {
+		t.Errorf("got %q, want %q", out, "42")
+	}
+}
+
+func TestExtractString_BooleanValue_ReturnedAsString(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"ok": true})
+	out := extractString(entry, "ok")
+	if out != "true" {
+		t.Errorf("got %q, want %q", out, "true")
+	}
+}
+
+// =============================================================================
+// colorizeLevel (white-box tests: unexported method on TextFormatter)
+// =============================================================================
+
+func TestColorizeLevel_NoColor_PadsToFiveChars(t *testing.T) {
+	f := &TextFormatter{Color: false}
+	tests := []struct {
+		level    string
+		expected string
+	}{
+		{"info", "[INFO ]"},
+		{"error", "[ERROR]"},
+		{"warn", "[WARN ]"},
+		{"debug", "[DEBUG]"},
+		{"", "[     ]"},
+		{"x", "[X    ]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			got := f.colorizeLevel(tt.level)
+			if got != tt.expected {
+				t.Errorf("colorizeLevel(%q) = %q, want %q", tt.level, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestColorizeLevel_Color_ErrorGroup(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	for _, level := range []string{"error", "err", "fatal", "crit", "critical", "alert", "emergency"} {
+		got := f.colorizeLevel(level)
+		if !strings.Contains(got, "[ERROR]") {
+			t.Errorf("colorizeLevel(%q) should produce [ERROR], got: %q", level, got)
+		}
+		if !strings.Contains(got, colorRed) {
+			t.Errorf("colorizeLevel(%q) should use red, got: %q", level, got)
+		}
+	}
+}
+
+func TestColorizeLevel_Color_WarnGroup(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	for _, level := range []string{"warn", "warning"} {
+		got := f.colorizeLevel(level)
+		if !strings.Contains(got, "[WARN ]") {
+			t.Errorf("colorizeLevel(%q) should produce [WARN ], got: %q", level, got)
+		}
+		if !strings.Contains(got, colorYellow) {
+			t.Errorf("colorizeLevel(%q) should use yellow, got: %q", level, got)
+		}
+	}
+}
+
+func TestColorizeLevel_Color_InfoGroup(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	for _, level := range []string{"info", "information"} {
+		got := f.colorizeLevel(level)
+		if !strings.Contains(got, "[INFO ]") {
+			t.Errorf("colorizeLevel(%q) should produce [INFO ], got: %q", level, got)
+		}
+		if !strings.Contains(got, colorGreen) {
+			t.Errorf("colorizeLevel(%q) should use green, got: %q", level, got)
+		}
+	}
+}
+
+func TestColorizeLevel_Color_UnknownLevel_UsesGrayAndUpperCase(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	got := f.colorizeLevel("trace")
+	if !strings.Contains(got, "[TRACE]") {
+		t.Errorf("expected [TRACE] for unknown level, got: %q", got)
+	}
+	if !strings.Contains(got, colorGray) {
+		t.Errorf("expected gray for unknown level, got: %q", got)
+	}
+}
+
+func TestColorizeLevel_Color_CaseInsensitive(t *testing.T) {
+	f := &TextFormatter{Color: true}
+	lower := f.colorizeLevel("error")
+	upper := f.colorizeLevel("ERROR")
+	if lower != upper {
+		t.Errorf("colorizeLevel should be case-insensitive: %q != %q", lower, upper)
+	}
+}
+
+// =============================================================================
+// Scratch buffers
+// =============================================================================
+
+// countingWriter records how many Write calls it receives.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestFormatters_SingleWritePerEntry(t *testing.T) {
+	entry := parser.NewEntry(map[string]any{"time": "2024-01-15T10:30:00Z", "level": "info", "msg": "hi", "user": "bob", "n": 3})
+	formatters := map[string]Formatter{
+		"json":   &JSONFormatter{},
+		"pretty": &JSONFormatter{Pretty: true},
+		"text":   &TextFormatter{Color: true},
+		"logfmt": &LogfmtFormatter{},
+	}
+	for name, f := range formatters {
+		var w countingWriter
+		if err := f.Format(&w, entry); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if w.writes != 1 {
+			t.Errorf("%s: %d writes, want 1", name, w.writes)
+		}
+		if !strings.HasSuffix(w.String(), "\n") {
+			t.Errorf("%s: output %q does not end in a newline", name, w.String())
+		}
+	}
+}
+
+func TestFormatters_BufferReuseDoesNotLeak(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var first, second bytes.Buffer
+	if err := f.Format(&first, parser.NewEntry(map[string]any{"a": "a long value that fills the buffer"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Format(&second, parser.NewEntry(map[string]any{"b": "2"})); err != nil {
+		t.Fatal(err)
+	}
+	if got := second.String(); got != "b=2\n" {
+		t.Errorf("second output = %q, want %q", got, "b=2\n")
+	}
+}
+
+func TestPutBuffer_DropsOversizedBuffers(t *testing.T) {
+	buf := getBuffer()
+	buf.Grow(maxPooledBuffer + 1)
+	putBuffer(buf) // must not be pooled, and must not panic
+	if got := getBuffer(); got.Len() != 0 {
+		t.Errorf("getBuffer returned a non-empty buffer (%d bytes)", got.Len())
+	}
+}
+
+func TestWriteValue(t *testing.T) {
+	var buf bytes.Buffer
+	writeValue(&buf, "s")
+	buf.WriteByte(' ')
+	writeValue(&buf, 1.5)
+	buf.WriteByte(' ')
+	writeValue(&buf, true)
+	buf.WriteByte(' ')
+	writeValue(&buf, nil)
+	if got, want := buf.String(), "s 1.5 true <nil>"; got != want {
+		t.Errorf("writeValue output = %q, want %q", got, want)
+	}
+}
+
+func TestValueString_NestedValuesAsCompactJSON(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{map[string]any{"b": 1.0, "a": "x y"}, `{"a":"x y","b":1}`},
+		{[]any{"a", 2.0, nil}, `["a",2,null]`},
+		{map[string]any{"url": "/q?a=1&b=<2>"}, `{"url":"/q?a=1&b=<2>"}`},
+		{parser.NewEntry(map[string]any{"k": "v"}), `{"k":"v"}`},
+		{json.Number("12345678901234567890"), "12345678901234567890"},
+	}
+	for _, tt := range tests {
+		if got := valueString(tt.v); got != tt.want {
+			t.Errorf("valueString(%v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestTextFormatter_NestedValue_RendersAsJSON(t *testing.T) {
+	f := &TextFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"msg": "m", "req": map[string]any{"id": 7.0}, "tags": []any{"a", "b"}}))
+	if out := buf.String(); !strings.Contains(out, `req={"id":7} tags=["a","b"]`) {
+		t.Errorf("expected nested values as JSON, got: %s", out)
+	}
+}
+
+func TestLogfmtFormatter_NestedValue_RoundTrips(t *testing.T) {
+	f := &LogfmtFormatter{}
+	var buf bytes.Buffer
+	f.Format(&buf, parser.NewEntry(map[string]any{"req": map[string]any{"path": "/a b"}, "ids": []any{1.0, 2.0}}))
+	want := `ids=[1,2] req="{\"path\":\"/a b\"}"` + "\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+	entry, err := parser.ParseLogfmt(strings.TrimSuffix(buf.String(), "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Fields["req"] != `{"path":"/a b"}` || entry.Fields["ids"] != "[1,2]" {
+		t.Errorf("parsed back as %v", entry)
+	}
+}
@@ -0,0 +1,151 @@
+package formatter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// tableDefaultColumns are the columns of a TableFormatter without Fields.
+// Each also finds its field under the other well-known names, so that the
+// time column shows a ts or timestamp field.
+var tableDefaultColumns = []string{"time", "level", "message"}
+
+// tableAliases lists the other names of the default columns' fields.
+var tableAliases = map[string][]string{
+	"time":    {"time", "ts", "timestamp"},
+	"level":   {"level", "lvl", "severity"},
+	"message": {"message", "msg", "text"},
+}
+
+// TableFormatter writes log entries as the rows of a table, one column per
+// field, beneath a header row of the field names. Each cell is padded to
+// the width of the widest value seen so far in its column, capped so that
+// one long value does not push every column after it off the screen; as
+// with an aligned TextFormatter, columns only ever widen, and Measure lets
+// a caller widen them for entries it has yet to format. The header is
+// written before the first row, padded to the widths measured by then.
+//
+// Values are written as the text format writes them, with line breaks and
+// tabs escaped so that each entry stays on its row. A field an entry lacks
+// leaves its cell blank. Entries that stand for an unparsed input line are
+// written as that line.
+type TableFormatter struct {
+	// Fields are the table's columns, which may be dotted paths into
+	// nested objects, such as "meta.host". When empty, the columns are the
+	// entry's time, level and message.
+	Fields []string
+	// Color writes the header row in bold when true.
+	Color bool
+	// Sanitize escapes control characters in the entry's contents.
+	Sanitize bool
+
+	widths map[string]int // widths of the columns measured so far
+	header bool           // whether the header row has been written
+}
+
+// columns returns the names of the table's columns.
+func (f *TableFormatter) columns() []string {
+	if len(f.Fields) > 0 {
+		return f.Fields
+	}
+	return tableDefaultColumns
+}
+
+// cell returns the text of entry's value in column k, or "" when entry
+// has no such field.
+func (f *TableFormatter) cell(entry *parser.LogEntry, k string) string {
+	var s string
+	if len(f.Fields) == 0 {
+		s = extractString(entry, tableAliases[k]...)
+	} else if v, ok := entry.Lookup(k); ok {
+		s = valueString(v)
+	}
+	return rowBreaks.Replace(f.clean(s))
+}
+
+// rowBreaks escapes the characters that would break a table row.
+var rowBreaks = strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// Measure widens the columns to fit entry, so that it lines up with the
+// entries formatted after it. Format measures every entry it writes; it
+// must not be called concurrently with Measure.
+func (f *TableFormatter) Measure(entry *parser.LogEntry) {
+	if _, ok := rawLine(entry); ok {
+		return
+	}
+	if f.widths == nil {
+		f.widths = make(map[string]int)
+		for _, k := range f.columns() {
+			f.widths[k] = visibleWidth(k)
+		}
+	}
+	for _, k := range f.columns() {
+		f.widths[k] = max(f.widths[k], min(visibleWidth(f.cell(entry, k)), maxAlignedMessage))
+	}
+}
+
+// Format writes entry to w as a row of the table, preceded by the header
+// row when it is the first.
+func (f *TableFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if raw, ok := rawLine(entry); ok {
+		buf.WriteString(f.clean(raw))
+		buf.WriteByte('\n')
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+
+	f.Measure(entry)
+	columns := f.columns()
+	if !f.header {
+		f.header = true
+		if f.Color {
+			buf.WriteString(colorBold)
+		}
+		f.writeRow(buf, columns)
+		if f.Color {
+			// Ahead of the line break writeRow ended the row with.
+			buf.Truncate(buf.Len() - 1)
+			buf.WriteString(colorReset + "\n")
+		}
+	}
+	cells := make([]string, len(columns))
+	for i, k := range columns {
+		cells[i] = f.cell(entry, k)
+	}
+	f.writeRow(buf, cells)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeRow writes cells to buf as a row, each but the last padded to the
+// width of its column and two spaces apart, followed by a line break.
+// Blank cells at the end of the row are left out.
+func (f *TableFormatter) writeRow(buf *bytes.Buffer, cells []string) {
+	columns := f.columns()
+	last := len(cells) - 1
+	for last >= 0 && cells[last] == "" {
+		last--
+	}
+	for i, s := range cells[:last+1] {
+		buf.WriteString(s)
+		if i < last {
+			buf.WriteString(strings.Repeat(" ", max(f.widths[columns[i]]-visibleWidth(s), 0)+2))
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+// clean escapes control characters in s when Sanitize is set.
+func (f *TableFormatter) clean(s string) string {
+	if f.Sanitize {
+		return escapeControl(s)
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+package formatter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+func TestTableFormatter_Format(t *testing.T) {
+	entries := []*parser.LogEntry{
+		parser.NewEntry(map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "started", "user": "alice", "meta": map[string]any{"host": "srv1"}}),
+		parser.NewEntry(map[string]any{"ts": "2024-01-15T10:00:01Z", "severity": "error", "message": "disk\nfull", "user": "bob"}),
+	}
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{"default columns", nil, "" +
+			"time                  level  message\n" +
+			"2024-01-15T10:00:00Z  info   started\n" +
+			"2024-01-15T10:00:01Z  error  disk\\nfull\n"},
+		{"fields", []string{"user", "meta.host", "level"}, "" +
+			"user   meta.host  level\n" +
+			"alice  srv1       info\n" +
+			"bob\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &TableFormatter{Fields: tt.fields}
+			for _, e := range entries {
+				f.Measure(e)
+			}
+			var buf bytes.Buffer
+			for _, e := range entries {
+				if err := f.Format(&buf, e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTableFormatter_Format_ColumnsWiden(t *testing.T) {
+	f := &TableFormatter{Fields: []string{"a", "b"}}
+	var buf bytes.Buffer
+	for _, e := range []*parser.LogEntry{parser.NewEntry(map[string]any{"a": "x", "b": "1"}), parser.NewEntry(map[string]any{"a": "longer", "b": "2"})} {
+		if err := f.Format(&buf, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "a  b\nx  1\nlonger  2\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,73 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// TemplateFormatter writes each log entry by executing a text/template
+// with the entry as its data, so that {{.level}} is the entry's level
+// field and {{.meta.host}} reaches into a nested object. A line break
+// follows each entry unless the template's output already ends with one.
+//
+// As with any map, a field the entry lacks, or a member of a nested object
+// it lacks, prints as "<no value>"; the template's own functions give
+// alternatives, such as {{or .user "-"}}.
+// Beyond the built-in functions, json writes a value as compact JSON and
+// value as the other formatters write it: nested objects and arrays as
+// compact JSON and anything else as its text.
+type TemplateFormatter struct {
+	text string
+	tmpl *template.Template
+}
+
+// templateFuncs are the functions available to a TemplateFormatter's
+// template beyond the built-in ones.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(b.String(), "\n"), nil
+	},
+	"value": valueString,
+}
+
+// NewTemplateFormatter returns a TemplateFormatter for the template text,
+// or an error if it does not parse.
+func NewTemplateFormatter(text string) (*TemplateFormatter, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateFormatter{text: text, tmpl: tmpl}, nil
+}
+
+// Text returns the text of the template.
+func (f *TemplateFormatter) Text() string {
+	return f.text
+}
+
+// Format writes entry to w as the template renders it.
+func (f *TemplateFormatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := f.tmpl.Execute(buf, entry.Fields); err != nil {
+		return fmt.Errorf("executing template: %w", err)
+	}
+	if b := buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
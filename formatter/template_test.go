@@ -0,0 +1,92 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+func TestTemplateFormatter_Format(t *testing.T) {
+	var entry *parser.LogEntry
+	if err := json.Unmarshal([]byte(`{"time":"2024-01-15T10:00:00Z","level":"error","msg":"disk <full>","meta":{"host":"srv1"},"n":3}`), &entry); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{.time}} {{.level}} {{.msg}}", "2024-01-15T10:00:00Z error disk <full>\n"},
+		{"{{.meta.host}} n={{.n}}\n", "srv1 n=3\n"},
+		{`{{or .user "-"}} {{.user}}`, "- <no value>\n"},
+		{"{{json .meta}} {{value .meta}} {{json .msg}}", `{"host":"srv1"} {"host":"srv1"} "disk <full>"` + "\n"},
+		{"{{range $k, $v := .}}{{$k}} {{end}}", "level meta msg n time \n"},
+		{"", "\n"},
+	}
+	for _, tt := range tests {
+		f, err := NewTemplateFormatter(tt.text)
+		if err != nil {
+			t.Fatalf("NewTemplateFormatter(%q): %v", tt.text, err)
+		}
+		if f.Text() != tt.text {
+			t.Errorf("Text() = %q, want %q", f.Text(), tt.text)
+		}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, entry); err != nil {
+			t.Fatalf("%q: Format: %v", tt.text, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.text, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestTemplateFormatter_MissingField(t *testing.T) {
+	// A field the entry lacks, or a member of one, prints as "<no value>";
+	// missingkey=zero would not help, as the zero of an any prints the same.
+	entry := parser.NewEntry(map[string]any{"level": "info", "meta": map[string]any{"host": "srv1"}})
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{.level}} user={{.user}}", "info user=<no value>\n"},
+		{"{{.meta.zone}} {{.http.status}}", "<no value> <no value>\n"},
+		{`{{or .user "-"}}{{with .user}} user={{.}}{{end}}`, "-\n"},
+	}
+	for _, tt := range tests {
+		f, err := NewTemplateFormatter(tt.text)
+		if err != nil {
+			t.Fatalf("NewTemplateFormatter(%q): %v", tt.text, err)
+		}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, entry); err != nil {
+			t.Fatalf("%q: Format: %v", tt.text, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.text, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestNewTemplateFormatter_Invalid(t *testing.T) {
+	if _, err := NewTemplateFormatter("{{.msg"); err == nil {
+		t.Error("expected error for unclosed action")
+	}
+}
+
+func TestTemplateFormatter_ExecutionError(t *testing.T) {
+	f, err := NewTemplateFormatter("{{.msg.text}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = f.Format(&buf, parser.NewEntry(map[string]any{"msg": "hi"}))
+	if err == nil || !strings.Contains(err.Error(), "executing template") {
+		t.Errorf("Format error = %v, want an execution error", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q despite the error", buf.String())
+	}
+}
@@ -1,3 +1,12 @@
 module github.com/tylermac92/logpipe
 
 go 1.25.0
+
+require (
+	github.com/itchyny/gojq v0.12.19
+	github.com/klauspost/compress v1.18.0
+	github.com/tetratelabs/wazero v1.12.0
+	golang.org/x/sys v0.44.0
+)
+
+require github.com/itchyny/timefmt-go v0.1.8 // indirect
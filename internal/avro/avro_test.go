@@ -0,0 +1,359 @@
+package avro
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustParse parses src or fails the test.
+func mustParse(t *testing.T, src string) *Schema {
+	t.Helper()
+	s, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return s
+}
+
+// readFile decodes the object container file data, returning the schema
+// in its header and its records.
+func readFile(t *testing.T, data []byte) (string, []any) {
+	t.Helper()
+	r := bufio.NewReader(bytes.NewReader(data))
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil || !bytes.Equal(head, magic) {
+		t.Fatalf("magic = %q, %v", head, err)
+	}
+	meta := map[string]string{}
+	for {
+		n := readLong(t, r)
+		if n == 0 {
+			break
+		}
+		for ; n > 0; n-- {
+			k := readString(t, r)
+			meta[k] = readString(t, r)
+		}
+	}
+	if meta["avro.codec"] != "null" {
+		t.Fatalf("codec = %q", meta["avro.codec"])
+	}
+	var sync [16]byte
+	io.ReadFull(r, sync[:])
+	s := mustParse(t, meta["avro.schema"])
+
+	var records []any
+	for {
+		count, err := binary.ReadVarint(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		readLong(t, r) // block size
+		for ; count > 0; count-- {
+			records = append(records, decode(t, s.root, r))
+		}
+		var got [16]byte
+		io.ReadFull(r, got[:])
+		if got != sync {
+			t.Fatalf("sync marker = %x, want %x", got, sync)
+		}
+	}
+	return meta["avro.schema"], records
+}
+
+func readLong(t *testing.T, r *bufio.Reader) int64 {
+	t.Helper()
+	n, err := binary.ReadVarint(r)
+	if err != nil {
+		t.Fatalf("reading long: %v", err)
+	}
+	return n
+}
+
+func readString(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	b := make([]byte, readLong(t, r))
+	if _, err := io.ReadFull(r, b); err != nil {
+		t.Fatalf("reading string: %v", err)
+	}
+	return string(b)
+}
+
+// decode reads a value of type n from r.
+func decode(t *testing.T, n *node, r *bufio.Reader) any {
+	t.Helper()
+	switch n.kind {
+	case kindNull:
+		return nil
+	case kindBoolean:
+		b, _ := r.ReadByte()
+		return b == 1
+	case kindInt, kindLong:
+		return readLong(t, r)
+	case kindFloat:
+		var b [4]byte
+		io.ReadFull(r, b[:])
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b[:])))
+	case kindDouble:
+		var b [8]byte
+		io.ReadFull(r, b[:])
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+	case kindBytes, kindString:
+		return readString(t, r)
+	case kindEnum:
+		return n.symbols[readLong(t, r)]
+	case kindRecord:
+		rec := map[string]any{}
+		for _, f := range n.fields {
+			rec[f.name] = decode(t, f.typ, r)
+		}
+		return rec
+	case kindArray:
+		items := []any{}
+		for count := readLong(t, r); count != 0; count = readLong(t, r) {
+			for ; count > 0; count-- {
+				items = append(items, decode(t, n.items, r))
+			}
+		}
+		return items
+	case kindMap:
+		m := map[string]any{}
+		for count := readLong(t, r); count != 0; count = readLong(t, r) {
+			for ; count > 0; count-- {
+				k := readString(t, r)
+				m[k] = decode(t, n.items, r)
+			}
+		}
+		return m
+	case kindUnion:
+		return decode(t, n.branches[readLong(t, r)], r)
+	}
+	t.Fatalf("unexpected kind %d", n.kind)
+	return nil
+}
+
+// write writes records to a file with schema s and decodes it.
+func write(t *testing.T, s *Schema, records ...map[string]any) []any {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, s)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, rec := range records {
+		if err := w.Append(rec); err != nil {
+			t.Fatalf("Append(%v): %v", rec, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	_, got := readFile(t, buf.Bytes())
+	return got
+}
+
+const entrySchema = `{
+	"type": "record",
+	"name": "Entry",
+	"namespace": "com.example",
+	"fields": [
+		{"name": "time", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["debug", "info", "warn", "error"]}},
+		{"name": "msg", "type": "string"},
+		{"name": "status", "type": ["null", "int"], "default": null},
+		{"name": "latency", "type": "double", "default": 0},
+		{"name": "ok", "type": "boolean", "default": true},
+		{"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+		{"name": "labels", "type": {"type": "map", "values": "string"}, "default": {}},
+		{"name": "request", "type": ["null", {"type": "record", "name": "Request", "fields": [
+			{"name": "path", "type": "string"},
+			{"name": "bytes", "type": "long"}
+		]}], "default": null}
+	]
+}`
+
+// =============================================================================
+// Parse
+// =============================================================================
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"not a record", `"string"`, "schema must be a record"},
+		{"unknown type", `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "text"}]}`, `unknown type "text"`},
+		{"fixed", `{"type": "record", "name": "R", "fields": [{"name": "a", "type": {"type": "fixed", "name": "F", "size": 4}}]}`, "fixed types are not supported"},
+		{"bad field name", `{"type": "record", "name": "R", "fields": [{"name": "http.status", "type": "int"}]}`, `invalid field name "http.status"`},
+		{"nested union", `{"type": "record", "name": "R", "fields": [{"name": "a", "type": ["null", ["int"]]}]}`, "unions may not contain unions"},
+		{"not JSON", `{"type": `, "parsing schema"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_NamedTypeReference(t *testing.T) {
+	s := mustParse(t, `{"type": "record", "name": "R", "namespace": "ns", "fields": [
+		{"name": "a", "type": {"type": "enum", "name": "Level", "symbols": ["info", "error"]}},
+		{"name": "b", "type": ["null", "Level"]},
+		{"name": "c", "type": "ns.Level"}
+	]}`)
+	got := write(t, s, map[string]any{"a": "info", "b": "error", "c": "error"})
+	want := []any{map[string]any{"a": "info", "b": "error", "c": "error"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+// =============================================================================
+// Writer
+// =============================================================================
+
+func TestWriter_RoundTrip(t *testing.T) {
+	s := mustParse(t, entrySchema)
+	got := write(t, s,
+		map[string]any{
+			"time": "2024-01-15T10:00:00.250Z", "level": "error", "msg": "upstream failed",
+			"status": json.Number("502"), "latency": json.Number("1.5"), "ok": false,
+			"tags":    []any{"edge", "retry"},
+			"labels":  map[string]any{"region": "eu", "zone": "b"},
+			"request": map[string]any{"path": "/api", "bytes": json.Number("512")},
+			"extra":   "dropped",
+		},
+		// logfmt values are strings, and missing fields take defaults.
+		map[string]any{"time": "2024-01-15T10:00:01Z", "level": "info", "msg": "ok", "status": "200"},
+	)
+	want := []any{
+		map[string]any{
+			"time": int64(1705312800250), "level": "error", "msg": "upstream failed",
+			"status": int64(502), "latency": 1.5, "ok": false,
+			"tags":    []any{"edge", "retry"},
+			"labels":  map[string]any{"region": "eu", "zone": "b"},
+			"request": map[string]any{"path": "/api", "bytes": int64(512)},
+		},
+		map[string]any{
+			"time": int64(1705312801000), "level": "info", "msg": "ok",
+			"status": int64(200), "latency": 0.0, "ok": true,
+			"tags": []any{}, "labels": map[string]any{}, "request": nil,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestWriter_AppendErrors(t *testing.T) {
+	s := mustParse(t, entrySchema)
+	base := func() map[string]any {
+		return map[string]any{"time": "2024-01-15T10:00:00Z", "level": "info", "msg": "m"}
+	}
+	tests := []struct {
+		name string
+		edit func(map[string]any)
+		want string
+	}{
+		{"missing", func(m map[string]any) { delete(m, "msg") }, "field msg: missing"},
+		{"not a symbol", func(m map[string]any) { m["level"] = "fatal" }, `field level: "fatal" is not a symbol of enum com.example.Level`},
+		{"out of range", func(m map[string]any) { m["status"] = json.Number("3000000000") }, "field status: cannot write 3000000000 as int"},
+		{"nested", func(m map[string]any) { m["request"] = map[string]any{"path": "/", "bytes": "many"} }, `field request.bytes: cannot write "many" as long`},
+		{"timestamp", func(m map[string]any) { m["time"] = "yesterday" }, `field time: cannot write "yesterday" as long`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, _ := NewWriter(&buf, s)
+			rec := base()
+			tt.edit(rec)
+			if err := w.Append(rec); err == nil || err.Error() != tt.want {
+				t.Errorf("Append() error = %v, want %q", err, tt.want)
+			}
+			// The failed record leaves nothing behind.
+			if err := w.Append(base()); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			w.Flush()
+			if _, got := readFile(t, buf.Bytes()); len(got) != 1 {
+				t.Errorf("got %d records, want 1", len(got))
+			}
+		})
+	}
+}
+
+func TestWriter_SplitsBlocks(t *testing.T) {
+	s := mustParse(t, `{"type": "record", "name": "R", "fields": [{"name": "msg", "type": "string"}]}`)
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, s)
+	msg := strings.Repeat("x", 1000)
+	for range 200 {
+		if err := w.Append(map[string]any{"msg": msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	_, got := readFile(t, buf.Bytes())
+	if len(got) != 200 {
+		t.Errorf("got %d records, want 200", len(got))
+	}
+	if n := bytes.Count(buf.Bytes(), w.sync[:]); n < 4 {
+		t.Errorf("sync marker appears %d times, want a block per 64 KiB", n)
+	}
+}
+
+// =============================================================================
+// Infer
+// =============================================================================
+
+func TestInfer(t *testing.T) {
+	records := []map[string]any{
+		{"time": "2024-01-15T10:00:00Z", "status": json.Number("200"), "latency": json.Number("12"), "ok": true, "http.method": "GET", "_line": 1},
+		{"time": "2024-01-15T10:00:01Z", "status": json.Number("500"), "latency": 3.5, "ok": "yes", "user": map[string]any{"id": 7}, "_line": 2},
+	}
+	s := Infer(records)
+	want := `{"type":"record","name":"LogEntry","namespace":"logpipe","fields":[` +
+		`{"name":"_line","type":["null","long"],"default":null},` +
+		`{"name":"http_method","type":["null","string"],"default":null},` +
+		`{"name":"latency","type":["null","double"],"default":null},` +
+		`{"name":"ok","type":["null","string"],"default":null},` +
+		`{"name":"status","type":["null","long"],"default":null},` +
+		`{"name":"time","type":["null","string"],"default":null},` +
+		`{"name":"user","type":["null","string"],"default":null}]}`
+	if s.String() != want {
+		t.Errorf("Infer() =\n%s\nwant\n%s", s, want)
+	}
+	if _, err := Parse([]byte(s.String())); err != nil {
+		t.Errorf("inferred schema does not parse: %v", err)
+	}
+
+	got := write(t, s, records...)
+	if rec := got[0].(map[string]any); rec["http_method"] != "GET" || rec["user"] != nil || rec["ok"] != "true" || rec["latency"] != 12.0 {
+		t.Errorf("first record = %v", rec)
+	}
+	if rec := got[1].(map[string]any); rec["user"] != `{"id":7}` || rec["status"] != int64(500) || rec["latency"] != 3.5 {
+		t.Errorf("second record = %v", rec)
+	}
+}
+
+func TestInfer_CollidingNames(t *testing.T) {
+	s := Infer([]map[string]any{{"a.b": "1", "a_b": "2", "a-b": "3"}})
+	if got := strings.Join(s.Fields(), ","); got != "a_b,a_b_2,a_b_3" {
+		t.Errorf("fields = %s", got)
+	}
+	got := write(t, s, map[string]any{"a.b": "1", "a_b": "2", "a-b": "3"})
+	want := []any{map[string]any{"a_b": "3", "a_b_2": "1", "a_b_3": "2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
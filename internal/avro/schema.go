@@ -0,0 +1,409 @@
+// Package avro writes log entries as Avro object container files, the
+// self-describing binary format that Hadoop, Spark and most data lake
+// ingestion pipelines read. It implements the parts of the specification a
+// log record needs:
+//
+//   - the primitive types, records, enums, arrays, maps and unions
+//   - field defaults
+//   - the timestamp-millis and timestamp-micros logical types on long,
+//     which accept RFC 3339 timestamps
+//   - the null codec, so blocks are written uncompressed
+//
+// Fixed types, and schemas that are not a record, are rejected. Values are
+// converted to the type the schema asks for where that is lossless, so a
+// logfmt value of "200" may be written as a long; a value that cannot be
+// converted is an error for that entry.
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// kind is an Avro type.
+type kind int
+
+const (
+	kindNull kind = iota
+	kindBoolean
+	kindInt
+	kindLong
+	kindFloat
+	kindDouble
+	kindBytes
+	kindString
+	kindRecord
+	kindEnum
+	kindArray
+	kindMap
+	kindUnion
+)
+
+// primitives maps the names of the primitive types to their kinds.
+var primitives = map[string]kind{
+	"null":    kindNull,
+	"boolean": kindBoolean,
+	"int":     kindInt,
+	"long":    kindLong,
+	"float":   kindFloat,
+	"double":  kindDouble,
+	"bytes":   kindBytes,
+	"string":  kindString,
+}
+
+// node is a parsed schema.
+type node struct {
+	kind     kind
+	logical  string   // logical type of a long, such as "timestamp-millis"
+	name     string   // full name of a record or enum
+	fields   []field  // of a record
+	symbols  []string // of an enum
+	items    *node    // element type of an array, value type of a map
+	branches []*node  // of a union
+}
+
+// field is a field of a record.
+type field struct {
+	name   string
+	key    string // entry key the value is read from
+	typ    *node
+	def    any // default, when hasDef is set
+	hasDef bool
+}
+
+// Schema is a record schema that entries are written with.
+type Schema struct {
+	root *node
+	text string // the schema as JSON, for the file header
+}
+
+// String returns the schema as compact JSON.
+func (s *Schema) String() string {
+	return s.text
+}
+
+// Fields returns the names of the schema's fields, in order.
+func (s *Schema) Fields() []string {
+	names := make([]string, len(s.root.fields))
+	for i, f := range s.root.fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Parse parses the JSON schema src, which must describe a record.
+func Parse(src []byte) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+	p := &schemaParser{names: map[string]*node{}}
+	root, err := p.parse(v, "")
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != kindRecord {
+		return nil, fmt.Errorf("schema must be a record")
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, src); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+	return &Schema{root: root, text: buf.String()}, nil
+}
+
+// schemaParser holds the named types defined so far, which later parts of
+// a schema may refer to by name.
+type schemaParser struct {
+	names map[string]*node
+}
+
+// parse parses the schema v within namespace.
+func (p *schemaParser) parse(v any, namespace string) (*node, error) {
+	switch v := v.(type) {
+	case string:
+		if k, ok := primitives[v]; ok {
+			return &node{kind: k}, nil
+		}
+		if n, ok := p.names[fullName(v, namespace)]; ok {
+			return n, nil
+		}
+		if n, ok := p.names[v]; ok {
+			return n, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+	case []any:
+		n := &node{kind: kindUnion}
+		for _, b := range v {
+			branch, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if branch.kind == kindUnion {
+				return nil, fmt.Errorf("unions may not contain unions")
+			}
+			n.branches = append(n.branches, branch)
+		}
+		if len(n.branches) == 0 {
+			return nil, fmt.Errorf("union has no types")
+		}
+		return n, nil
+	case map[string]any:
+		return p.parseObject(v, namespace)
+	}
+	return nil, fmt.Errorf("invalid schema %v", v)
+}
+
+// parseObject parses a schema given as a JSON object.
+func (p *schemaParser) parseObject(v map[string]any, namespace string) (*node, error) {
+	typ, ok := v["type"].(string)
+	if !ok {
+		if t, present := v["type"]; present {
+			return p.parse(t, namespace)
+		}
+		return nil, fmt.Errorf("schema object has no type")
+	}
+	switch typ {
+	case "record", "error":
+		return p.parseRecord(v, namespace)
+	case "enum":
+		n, err := p.define(v, namespace, kindEnum)
+		if err != nil {
+			return nil, err
+		}
+		symbols, _ := v["symbols"].([]any)
+		for _, s := range symbols {
+			sym, ok := s.(string)
+			if !ok {
+				return nil, fmt.Errorf("enum %s: symbols must be strings", n.name)
+			}
+			n.symbols = append(n.symbols, sym)
+		}
+		if len(n.symbols) == 0 {
+			return nil, fmt.Errorf("enum %s has no symbols", n.name)
+		}
+		return n, nil
+	case "array", "map":
+		key := "items"
+		n := &node{kind: kindArray}
+		if typ == "map" {
+			key, n.kind = "values", kindMap
+		}
+		items, ok := v[key]
+		if !ok {
+			return nil, fmt.Errorf("%s has no %s", typ, key)
+		}
+		var err error
+		if n.items, err = p.parse(items, namespace); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case "fixed":
+		return nil, fmt.Errorf("fixed types are not supported")
+	}
+	n, err := p.parse(typ, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if logical, _ := v["logicalType"].(string); n.kind == kindLong && (logical == "timestamp-millis" || logical == "timestamp-micros") {
+		// Other logical types are written as their underlying type, as
+		// the specification allows.
+		n = &node{kind: kindLong, logical: logical}
+	}
+	return n, nil
+}
+
+// parseRecord parses a record schema.
+func (p *schemaParser) parseRecord(v map[string]any, namespace string) (*node, error) {
+	n, err := p.define(v, namespace, kindRecord)
+	if err != nil {
+		return nil, err
+	}
+	namespace = n.name[:max(strings.LastIndex(n.name, "."), 0)]
+	fields, ok := v["fields"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("record %s has no fields", n.name)
+	}
+	seen := map[string]bool{}
+	for _, fv := range fields {
+		fo, ok := fv.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("record %s: fields must be objects", n.name)
+		}
+		name, _ := fo["name"].(string)
+		if !validName(name) {
+			return nil, fmt.Errorf("record %s: invalid field name %q", n.name, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("record %s: field %q defined twice", n.name, name)
+		}
+		seen[name] = true
+		typ, err := p.parse(fo["type"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("record %s: field %s: %w", n.name, name, err)
+		}
+		def, hasDef := fo["default"]
+		n.fields = append(n.fields, field{name: name, key: name, typ: typ, def: def, hasDef: hasDef})
+	}
+	return n, nil
+}
+
+// define creates the named type described by v and records it so that
+// later parts of the schema can refer to it.
+func (p *schemaParser) define(v map[string]any, namespace string, k kind) (*node, error) {
+	name, _ := v["name"].(string)
+	if ns, ok := v["namespace"].(string); ok {
+		namespace = ns
+	}
+	full := fullName(name, namespace)
+	for _, part := range strings.Split(full, ".") {
+		if !validName(part) {
+			return nil, fmt.Errorf("invalid name %q", full)
+		}
+	}
+	if _, ok := p.names[full]; ok {
+		return nil, fmt.Errorf("type %s defined twice", full)
+	}
+	n := &node{kind: k, name: full}
+	p.names[full] = n
+	return n, nil
+}
+
+// fullName returns name qualified by namespace, unless it already is.
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// nameRE matches the names Avro allows for types and fields.
+var nameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validName reports whether name is a valid Avro name.
+func validName(name string) bool {
+	return nameRE.MatchString(name)
+}
+
+// Infer returns a schema for records: a record named logpipe.LogEntry with
+// a field for every key any of them has, in alphabetical order. Each field
+// is a union of null, for records without the key, and the narrowest type
+// that holds every value of it: boolean, long, double or string. Keys that
+// hold values of different types, or objects and arrays, become strings.
+// Keys that are not valid Avro names, such as "http.status", are written
+// as fields with the other characters replaced by underscores.
+func Infer(records []map[string]any) *Schema {
+	kinds := map[string]kind{}
+	for _, rec := range records {
+		for k, v := range rec {
+			got, ok := valueKind(v)
+			if !ok {
+				continue
+			}
+			prev, seen := kinds[k]
+			switch {
+			case !seen || prev == got:
+				kinds[k] = got
+			case (prev == kindLong && got == kindDouble) || (prev == kindDouble && got == kindLong):
+				kinds[k] = kindDouble
+			default:
+				kinds[k] = kindString
+			}
+		}
+	}
+	keys := make([]string, 0, len(kinds))
+	for k := range kinds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	type jsonField struct {
+		Name    string   `json:"name"`
+		Type    []string `json:"type"`
+		Default any      `json:"default"`
+	}
+	root := &node{kind: kindRecord, name: "logpipe.LogEntry"}
+	var jf []jsonField
+	used := map[string]bool{}
+	for _, k := range keys {
+		name := fieldName(k)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s_%d", fieldName(k), i)
+		}
+		used[name] = true
+		typ := &node{kind: kindUnion, branches: []*node{{kind: kindNull}, {kind: kinds[k]}}}
+		root.fields = append(root.fields, field{name: name, key: k, typ: typ, hasDef: true})
+		jf = append(jf, jsonField{Name: name, Type: []string{"null", kindName(kinds[k])}})
+	}
+	text, _ := json.Marshal(struct {
+		Type      string      `json:"type"`
+		Name      string      `json:"name"`
+		Namespace string      `json:"namespace"`
+		Fields    []jsonField `json:"fields"`
+	}{"record", "LogEntry", "logpipe", jf})
+	return &Schema{root: root, text: string(text)}
+}
+
+// valueKind returns the type Infer gives v, or false for nil.
+func valueKind(v any) (kind, bool) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false
+	case bool:
+		return kindBoolean, true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return kindLong, true
+	case float32:
+		return floatKind(float64(v)), true
+	case float64:
+		return floatKind(v), true
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return kindLong, true
+		}
+		return kindDouble, true
+	}
+	return kindString, true
+}
+
+// floatKind returns long for floats that hold an integer, as every JSON
+// number does when decoded with -numbers float, and double otherwise.
+func floatKind(f float64) kind {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return kindLong
+	}
+	return kindDouble
+}
+
+// kindName returns the name of the primitive type k.
+func kindName(k kind) string {
+	for name, pk := range primitives {
+		if pk == k {
+			return name
+		}
+	}
+	return ""
+}
+
+// fieldName turns the entry key k into a valid Avro name, replacing the
+// characters a name may not have, such as dots and a leading digit, with
+// underscores.
+func fieldName(k string) string {
+	b := []byte(k)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
@@ -0,0 +1,445 @@
+package avro
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// magic starts every object container file.
+var magic = []byte("Obj\x01")
+
+// blockSize is the size at which a Writer writes out the block of records
+// it is building.
+const blockSize = 64 << 10
+
+// Writer writes records to an object container file.
+type Writer struct {
+	w      io.Writer
+	schema *Schema
+	sync   [16]byte
+	block  []byte // encoded records not yet written
+	count  int    // number of records in block
+}
+
+// NewWriter writes the header of a file of records with schema s to w and
+// returns a Writer for the records. Flush must be called once the last has
+// been appended.
+func NewWriter(w io.Writer, s *Schema) (*Writer, error) {
+	aw := &Writer{w: w, schema: s}
+	if _, err := rand.Read(aw.sync[:]); err != nil {
+		return nil, err
+	}
+	header := append([]byte{}, magic...)
+	header = binary.AppendVarint(header, 2)
+	header = appendString(header, "avro.schema")
+	header = appendString(header, s.text)
+	header = appendString(header, "avro.codec")
+	header = appendString(header, "null")
+	header = binary.AppendVarint(header, 0)
+	header = append(header, aw.sync[:]...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// Append encodes rec, reading each field of the schema from the key of
+// the same name, and adds it to the file. Keys the schema has no field for
+// are left out. When rec cannot be encoded nothing is added and the error
+// names the field at fault.
+func (w *Writer) Append(rec map[string]any) error {
+	n := len(w.block)
+	b, err := w.schema.root.encode(w.block, rec)
+	if err != nil {
+		w.block = w.block[:n]
+		return err
+	}
+	w.block = b
+	w.count++
+	if len(w.block) >= blockSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush writes the records appended since the last Flush as a block.
+func (w *Writer) Flush() error {
+	if w.count == 0 {
+		return nil
+	}
+	head := binary.AppendVarint(nil, int64(w.count))
+	head = binary.AppendVarint(head, int64(len(w.block)))
+	for _, b := range [][]byte{head, w.block, w.sync[:]} {
+		if _, err := w.w.Write(b); err != nil {
+			return err
+		}
+	}
+	w.block, w.count = w.block[:0], 0
+	return nil
+}
+
+// appendString appends s in Avro's encoding of strings and bytes: its
+// length followed by its bytes.
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendVarint(b, int64(len(s)))
+	return append(b, s...)
+}
+
+// fieldError is an error encoding the value of a field, which may be
+// nested in other records.
+type fieldError struct {
+	path string // such as "request.status"
+	err  error
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf("field %s: %v", e.path, e.err)
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// encode appends v encoded as n to b.
+func (n *node) encode(b []byte, v any) ([]byte, error) {
+	switch n.kind {
+	case kindNull:
+		if v != nil {
+			return b, cannot(v, "null")
+		}
+		return b, nil
+	case kindBoolean:
+		t, ok := toBool(v)
+		if !ok {
+			return b, cannot(v, "boolean")
+		}
+		if t {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case kindInt:
+		i, ok := toInt(v)
+		if !ok || i != int64(int32(i)) {
+			return b, cannot(v, "int")
+		}
+		return binary.AppendVarint(b, i), nil
+	case kindLong:
+		i, ok := n.toLong(v)
+		if !ok {
+			return b, cannot(v, "long")
+		}
+		return binary.AppendVarint(b, i), nil
+	case kindFloat:
+		f, ok := toFloat(v)
+		if !ok {
+			return b, cannot(v, "float")
+		}
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(f))), nil
+	case kindDouble:
+		f, ok := toFloat(v)
+		if !ok {
+			return b, cannot(v, "double")
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(f)), nil
+	case kindBytes, kindString:
+		s, ok := toString(v)
+		if !ok {
+			return b, cannot(v, "string")
+		}
+		return appendString(b, s), nil
+	case kindEnum:
+		s, _ := v.(string)
+		for i, sym := range n.symbols {
+			if s == sym {
+				return binary.AppendVarint(b, int64(i)), nil
+			}
+		}
+		return b, fmt.Errorf("%s is not a symbol of enum %s", describe(v), n.name)
+	case kindRecord:
+		return n.encodeRecord(b, v)
+	case kindArray:
+		items, ok := v.([]any)
+		if !ok {
+			return b, cannot(v, "array")
+		}
+		if len(items) > 0 {
+			b = binary.AppendVarint(b, int64(len(items)))
+			for _, item := range items {
+				var err error
+				if b, err = n.items.encode(b, item); err != nil {
+					return b, err
+				}
+			}
+		}
+		return binary.AppendVarint(b, 0), nil
+	case kindMap:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return b, cannot(v, "map")
+		}
+		if len(m) > 0 {
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			b = binary.AppendVarint(b, int64(len(keys)))
+			for _, k := range keys {
+				b = appendString(b, k)
+				var err error
+				if b, err = n.items.encode(b, m[k]); err != nil {
+					return b, err
+				}
+			}
+		}
+		return binary.AppendVarint(b, 0), nil
+	case kindUnion:
+		return n.encodeUnion(b, v)
+	}
+	return b, fmt.Errorf("unsupported type")
+}
+
+// encodeRecord appends the record v to b. Fields missing from v take their
+// defaults, or are null.
+func (n *node) encodeRecord(b []byte, v any) ([]byte, error) {
+	rec, ok := v.(map[string]any)
+	if !ok {
+		return b, cannot(v, "record "+n.name)
+	}
+	for _, f := range n.fields {
+		fv, present := rec[f.key]
+		if !present && f.hasDef {
+			fv = f.def
+		}
+		var err error
+		if b, err = f.typ.encode(b, fv); err != nil {
+			if fe, ok := err.(*fieldError); ok {
+				return b, &fieldError{path: f.name + "." + fe.path, err: fe.err}
+			}
+			if !present && fv == nil {
+				err = errors.New("missing")
+			}
+			return b, &fieldError{path: f.name, err: err}
+		}
+	}
+	return b, nil
+}
+
+// encodeUnion appends v to b as the first branch of the union n whose type
+// v has, or failing that, the first that v can be converted to. When v has
+// the type of a branch but cannot be encoded as any, the error is the one
+// from that branch.
+func (n *node) encodeUnion(b []byte, v any) ([]byte, error) {
+	order := make([]int, 0, len(n.branches))
+	for i, branch := range n.branches {
+		if branch.holds(v) {
+			order = append(order, i)
+		}
+	}
+	held := len(order)
+	for i, branch := range n.branches {
+		if !branch.holds(v) {
+			order = append(order, i)
+		}
+	}
+	start := len(b)
+	var firstErr error
+	for j, i := range order {
+		out, err := n.branches[i].encode(binary.AppendVarint(b, int64(i)), v)
+		if err == nil {
+			return out, nil
+		}
+		if j == 0 && held > 0 {
+			firstErr = err
+		}
+		b = out[:start]
+	}
+	if firstErr != nil {
+		return b, firstErr
+	}
+	return b, fmt.Errorf("%s matches no type of the union", describe(v))
+}
+
+// holds reports whether v is already a value of type n, needing no
+// conversion.
+func (n *node) holds(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return n.kind == kindNull
+	case bool:
+		return n.kind == kindBoolean
+	case string:
+		return n.kind == kindString || n.kind == kindEnum && indexOf(n.symbols, v) >= 0
+	case map[string]any:
+		return n.kind == kindRecord || n.kind == kindMap
+	case []any:
+		return n.kind == kindArray
+	}
+	switch k, _ := valueKind(v); k {
+	case kindLong:
+		return n.kind == kindLong || n.kind == kindInt
+	case kindDouble:
+		return n.kind == kindDouble || n.kind == kindFloat
+	}
+	return false
+}
+
+// indexOf returns the index of s in list, or -1.
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// cannot returns the error for a value v that cannot be written as typ.
+func cannot(v any, typ string) error {
+	if v == nil {
+		return fmt.Errorf("cannot write null as %s", typ)
+	}
+	return fmt.Errorf("cannot write %s as %s", describe(v), typ)
+}
+
+// describe returns v as it would appear in JSON, for error messages.
+func describe(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// toBool converts v to a boolean.
+func toBool(v any) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case string:
+		t, err := strconv.ParseBool(v)
+		return t, err == nil
+	}
+	return false, false
+}
+
+// toInt converts v to an integer, if it holds one exactly.
+func toInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), v <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case float32:
+		return floatInt(float64(v))
+	case float64:
+		return floatInt(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return floatInt(f)
+		}
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// floatInt returns f as an integer, if it is one.
+func floatInt(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// toLong converts v to a long, parsing RFC 3339 timestamps when n has a
+// timestamp logical type.
+func (n *node) toLong(v any) (int64, bool) {
+	if n.logical != "" {
+		t, ok := v.(time.Time)
+		if s, isString := v.(string); isString {
+			var err error
+			t, err = time.Parse(time.RFC3339Nano, s)
+			ok = err == nil
+		}
+		if ok {
+			if n.logical == "timestamp-millis" {
+				return t.UnixMilli(), true
+			}
+			return t.UnixMicro(), true
+		}
+	}
+	return toInt(v)
+}
+
+// toFloat converts v to a floating-point number.
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	if i, ok := toInt(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// toString converts v to a string. Objects and arrays are written as JSON.
+func toString(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	if i, ok := toInt(v); ok {
+		return strconv.FormatInt(i, 10), true
+	}
+	return describe(v), true
+}
@@ -0,0 +1,210 @@
+// Package drain clusters log messages into templates with the Drain
+// algorithm (He et al., "Drain: An Online Log Parsing Approach with Fixed
+// Depth Tree", ICWS 2017). Messages are split into whitespace-separated
+// tokens and routed through a tree keyed first by their token count and
+// then by their leading tokens; at the leaf each is compared with the
+// templates already there and joins the most similar one, whose differing
+// tokens become the wildcard "<*>", or starts a template of its own.
+package drain
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Wildcard stands in a template for the tokens that vary between the
+// messages of a cluster.
+const Wildcard = "<*>"
+
+// Defaults for a Miner's parameters, those of the Drain paper and its
+// reference implementation.
+const (
+	DefaultDepth       = 4
+	DefaultSimilarity  = 0.4
+	DefaultMaxChildren = 100
+)
+
+// Cluster is a group of messages sharing a template.
+type Cluster struct {
+	// Template holds the tokens common to the cluster's messages, with
+	// Wildcard in the positions where they differ.
+	Template []string
+	// Count is the number of messages in the cluster.
+	Count int
+}
+
+// String returns the template as text, its tokens joined by spaces.
+func (c *Cluster) String() string {
+	return strings.Join(c.Template, " ")
+}
+
+// node is an internal node of the parse tree. Nodes at the last level hold
+// clusters instead of children.
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+// Miner clusters messages added to it. The zero value is not usable; call
+// New.
+type Miner struct {
+	// Depth is the depth of the parse tree's leaves, counting its root and
+	// the token-count level, so that Depth-3 leading tokens route a
+	// message. It must be at least 3.
+	Depth int
+	// Similarity is the fraction of a message's tokens that must equal
+	// those of a template, position by position, for the message to join
+	// its cluster. Wildcards in the template do not count as equal.
+	Similarity float64
+	// MaxChildren bounds the children of a tree node; tokens beyond it are
+	// routed to a wildcard child.
+	MaxChildren int
+
+	byLength map[int]*node
+	clusters []*Cluster
+}
+
+// New returns a Miner with the default parameters.
+func New() *Miner {
+	return &Miner{
+		Depth:       DefaultDepth,
+		Similarity:  DefaultSimilarity,
+		MaxChildren: DefaultMaxChildren,
+		byLength:    make(map[int]*node),
+	}
+}
+
+// Add assigns message to a cluster, creating one if no template is similar
+// enough, and returns the cluster.
+func (m *Miner) Add(message string) *Cluster {
+	tokens := Tokenize(message)
+	leaf := m.route(tokens)
+	if c := m.best(leaf.clusters, tokens); c != nil {
+		for i, t := range tokens {
+			if c.Template[i] != t {
+				c.Template[i] = Wildcard
+			}
+		}
+		c.Count++
+		return c
+	}
+	c := &Cluster{Template: tokens, Count: 1}
+	leaf.clusters = append(leaf.clusters, c)
+	m.clusters = append(m.clusters, c)
+	return c
+}
+
+// Clusters returns the clusters found so far, the largest first; clusters
+// of the same size are in the order they were created.
+func (m *Miner) Clusters() []*Cluster {
+	out := append([]*Cluster(nil), m.clusters...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
+
+// route returns the leaf for tokens, creating the nodes on its path.
+func (m *Miner) route(tokens []string) *node {
+	n := m.byLength[len(tokens)]
+	if n == nil {
+		n = &node{children: make(map[string]*node)}
+		m.byLength[len(tokens)] = n
+	}
+	for i := 0; i < m.Depth-3 && i < len(tokens); i++ {
+		key := tokens[i]
+		if hasDigit(key) {
+			key = Wildcard
+		}
+		child := n.children[key]
+		if child == nil {
+			if key != Wildcard && len(n.children) >= m.MaxChildren-1 {
+				// Keep the last slot for the wildcard child.
+				key = Wildcard
+				child = n.children[key]
+			}
+			if child == nil {
+				child = &node{children: make(map[string]*node)}
+				n.children[key] = child
+			}
+		}
+		n = child
+	}
+	return n
+}
+
+// best returns the cluster among clusters most similar to tokens, or nil
+// if none reaches m.Similarity. Ties go to the template with the most
+// wildcards, the most general.
+func (m *Miner) best(clusters []*Cluster, tokens []string) *Cluster {
+	var best *Cluster
+	bestSim, bestParams := -1.0, -1
+	for _, c := range clusters {
+		same, params := 0, 0
+		for i, t := range c.Template {
+			switch {
+			case t == Wildcard:
+				params++
+			case t == tokens[i]:
+				same++
+			}
+		}
+		sim := 1.0
+		if len(tokens) > 0 {
+			sim = float64(same) / float64(len(tokens))
+		}
+		if sim > bestSim || sim == bestSim && params > bestParams {
+			best, bestSim, bestParams = c, sim, params
+		}
+	}
+	if best == nil || bestSim < m.Similarity {
+		return nil
+	}
+	return best
+}
+
+var (
+	// numberRe matches a token that is a number, optionally followed by a
+	// unit made of letters or %, such as 350ms or 12.5%; the unit is kept.
+	numberRe = regexp.MustCompile(`^[-+]?(?:0[xX][0-9a-fA-F]+|[0-9]+(?:\.[0-9]+)?)([a-zA-Zµ%]*)$`)
+	// hexRe matches hexadecimal identifiers such as hashes and UUIDs.
+	hexRe = regexp.MustCompile(`^[0-9a-fA-F]{8,}$|^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// Tokenize splits message into whitespace-separated tokens, replacing the
+// ones that are obviously variable — numbers, IP addresses with or without
+// a port, and long hexadecimal identifiers — with Wildcard up front, so
+// that they neither route messages apart nor count against similarity. A
+// number's unit is kept, turning 350ms into <*>ms.
+func Tokenize(message string) []string {
+	tokens := strings.Fields(message)
+	for i, t := range tokens {
+		tokens[i] = mask(t)
+	}
+	return tokens
+}
+
+// mask returns token, or its masked form if it is variable.
+func mask(token string) string {
+	if sub := numberRe.FindStringSubmatch(token); sub != nil {
+		return Wildcard + sub[1]
+	}
+	if hexRe.MatchString(token) && hasDigit(token) {
+		return Wildcard
+	}
+	host := token
+	if h, _, err := net.SplitHostPort(token); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return Wildcard
+	}
+	return token
+}
+
+// hasDigit reports whether s contains an ASCII digit.
+func hasDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789")
+}
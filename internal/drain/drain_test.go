@@ -0,0 +1,114 @@
+package drain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// templates returns the miner's clusters as "count template" strings.
+func templates(m *Miner) []string {
+	var out []string
+	for _, c := range m.Clusters() {
+		out = append(out, fmt.Sprintf("%d %s", c.Count, c))
+	}
+	return out
+}
+
+// =============================================================================
+// Miner
+// =============================================================================
+
+func TestMiner_ClustersSimilarMessages(t *testing.T) {
+	m := New()
+	for _, msg := range []string{
+		"connection to 10.0.0.5:5432 failed after 350ms",
+		"user alice logged in",
+		"connection to db-primary failed after 12ms",
+		"connection to 10.0.0.7 failed after 1200ms",
+		"user bob logged in",
+		"cache warmed",
+	} {
+		m.Add(msg)
+	}
+	want := []string{
+		"3 connection to <*> failed after <*>ms",
+		"2 user <*> logged in",
+		"1 cache warmed",
+	}
+	if got := templates(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("templates = %q, want %q", got, want)
+	}
+}
+
+func TestMiner_DifferentLengthsNeverMerge(t *testing.T) {
+	m := New()
+	m.Add("job started")
+	m.Add("job started again")
+	if got := len(m.Clusters()); got != 2 {
+		t.Errorf("got %d clusters, want 2", got)
+	}
+}
+
+func TestMiner_DissimilarMessagesStaySeparate(t *testing.T) {
+	m := New()
+	m.Add("disk full on volume data")
+	m.Add("disk quota reset for tenant acme")
+	m.Add("request served in 12ms to client")
+	m.Add("request rejected: bad token from client")
+	if got := len(m.Clusters()); got != 4 {
+		t.Errorf("got %d clusters, want 4: %q", got, templates(m))
+	}
+}
+
+func TestMiner_Add_ReturnsCluster(t *testing.T) {
+	m := New()
+	a := m.Add("retrying in 5s")
+	b := m.Add("retrying in 10s")
+	if a != b || b.Count != 2 || b.String() != "retrying in <*>s" {
+		t.Errorf("Add returned %v (count %d) and %v", a, a.Count, b)
+	}
+}
+
+func TestMiner_MaxChildren_RoutesToWildcard(t *testing.T) {
+	m := New()
+	m.MaxChildren = 3
+	for _, w := range []string{"alpha", "beta", "gamma", "delta"} {
+		m.Add(w + " stage done")
+	}
+	// alpha and beta get their own children; gamma and delta share the
+	// wildcard child and so can merge.
+	want := []string{"2 <*> stage done", "1 alpha stage done", "1 beta stage done"}
+	if got := templates(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("templates = %q, want %q", got, want)
+	}
+}
+
+func TestMiner_EmptyMessage(t *testing.T) {
+	m := New()
+	m.Add("")
+	m.Add("   ")
+	if got := templates(m); !reflect.DeepEqual(got, []string{"2 "}) {
+		t.Errorf("templates = %q", got)
+	}
+}
+
+// =============================================================================
+// Tokenize
+// =============================================================================
+
+func TestTokenize_MasksVariableTokens(t *testing.T) {
+	got := Tokenize("GET /api took 35ms from 192.168.1.4:8080 id=7 trace 9f86d081884c7d65 req 123e4567-e89b-12d3-a456-426614174000 used 99.5% 0x1f -3 ::1")
+	want := []string{"GET", "/api", "took", "<*>ms", "from", "<*>", "id=7", "trace", "<*>", "req", "<*>", "used", "<*>%", "<*>", "<*>", "<*>"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestTokenize_KeepsWords(t *testing.T) {
+	got := Tokenize("deadbeef facade v2")
+	want := []string{"deadbeef", "facade", "v2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,371 @@
+// Package forward receives log events sent with the forward protocol used
+// by Fluentd and Fluent Bit, so that their agents can ship logs straight to
+// logpipe. It implements the Message, Forward, PackedForward and
+// CompressedPackedForward modes over TCP, and acknowledges each message
+// that asks for it with a chunk option. Authentication handshakes and the
+// UDP heartbeat are not supported.
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// DefaultPort is the port Fluentd and Fluent Bit forward to by default.
+const DefaultPort = "24224"
+
+// DefaultMaxMessageSize is the largest message a Server accepts when
+// MaxMessageSize is zero, counting packed events after decompression.
+const DefaultMaxMessageSize = 64 << 20
+
+// TagField is the entry field that holds the tag an event was sent with.
+const TagField = "_tag"
+
+// timeFields are the fields that already give an event's time; an event
+// whose record has none of them gets a time field from its event time.
+var timeFields = []string{"time", "ts", "timestamp"}
+
+// Server receives events on a TCP listener.
+type Server struct {
+	ln net.Listener
+	// MaxMessageSize bounds the size of a single message; a connection
+	// that sends a larger one is closed. Zero means DefaultMaxMessageSize.
+	MaxMessageSize int
+}
+
+// Listen returns a Server listening on the TCP address addr. A missing
+// port means DefaultPort.
+func Listen(addr string) (*Server, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{ln: ln}, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Receive accepts connections until ctx is done and sends each event they
+// carry on the entries channel, as an entry holding the event's record, its
+// tag under TagField and, when the record has no time field of its own, its
+// event time as an RFC 3339 time field. Problems with a connection, which
+// is then closed, are sent on the error channel. When ctx is done the
+// listener and every connection are closed, and both channels are closed
+// once the connections have been served. The entries are owned by the
+// receiver, as a parser's are.
+func (s *Server) Receive(ctx context.Context) (<-chan *parser.LogEntry, <-chan error) {
+	entries := make(chan *parser.LogEntry, 64)
+	errs := make(chan error, 16)
+
+	var mu sync.Mutex
+	conns := make(map[net.Conn]bool)
+	stop := context.AfterFunc(ctx, func() {
+		s.ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for c := range conns {
+			c.Close()
+		}
+	})
+
+	send := func(e *parser.LogEntry) bool {
+		select {
+		case entries <- e:
+			return true
+		case <-ctx.Done():
+			parser.Release(e)
+			return false
+		}
+	}
+	report := func(err error) {
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case errs <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			stop()
+			wg.Wait()
+			close(entries)
+			close(errs)
+		}()
+		for {
+			c, err := s.ln.Accept()
+			if err != nil {
+				report(fmt.Errorf("accepting forward connections: %w", err))
+				return
+			}
+			mu.Lock()
+			conns[c] = true
+			mu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.serve(c, send); err != nil {
+					report(fmt.Errorf("forward connection from %s: %w", c.RemoteAddr(), err))
+				}
+				mu.Lock()
+				delete(conns, c)
+				mu.Unlock()
+				c.Close()
+			}()
+		}
+	}()
+	return entries, errs
+}
+
+// maxMessageSize returns the effective message size limit.
+func (s *Server) maxMessageSize() int {
+	if s.MaxMessageSize > 0 {
+		return s.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
+}
+
+// serve reads messages from c until it is closed, passing each event to
+// send and acknowledging the messages that ask for it. It stops without an
+// error when send returns false or c is closed between messages.
+func (s *Server) serve(c net.Conn, send func(*parser.LogEntry) bool) error {
+	br := bufio.NewReader(c)
+	for {
+		if _, err := br.Peek(1); err != nil {
+			return nil
+		}
+		d := &decoder{r: br, budget: s.maxMessageSize()}
+		chunk, ok, err := s.message(d, send)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if chunk != "" {
+			if _, err := c.Write(appendAck(nil, chunk)); err != nil {
+				return fmt.Errorf("sending ack: %w", err)
+			}
+		}
+	}
+}
+
+// options are the settings a client may attach to a message.
+type options struct {
+	chunk      string // the message is to be acknowledged with this id
+	compressed string // packed events are compressed: "gzip" or ""
+}
+
+// message reads one message from d and passes its events to send. It
+// returns the chunk id to acknowledge, if any, and ok=false when send asked
+// to stop.
+func (s *Server) message(d *decoder, send func(*parser.LogEntry) bool) (chunk string, ok bool, err error) {
+	n, err := d.arrayLen()
+	if err != nil {
+		return "", false, err
+	}
+	if n < 2 || n > 4 {
+		return "", false, fmt.Errorf("message has %d elements, want 2 to 4", n)
+	}
+	v, err := d.value()
+	if err != nil {
+		return "", false, unexpectedEOF(err)
+	}
+	tag, isString := v.(string)
+	if !isString {
+		return "", false, fmt.Errorf("message tag is %T, not a string", v)
+	}
+
+	head, err := d.r.Peek(1)
+	if err != nil {
+		return "", false, unexpectedEOF(err)
+	}
+	var packed []byte
+	rest := n - 2
+	ok = true
+	switch b := head[0]; {
+	case b&0xf0 == 0x90 || b == 0xdc || b == 0xdd: // Forward: an array of events
+		count, err := d.arrayLen()
+		if err != nil {
+			return "", false, unexpectedEOF(err)
+		}
+		for i := 0; i < count && ok; i++ {
+			if ok, err = event(d, tag, send); err != nil {
+				return "", false, unexpectedEOF(err)
+			}
+		}
+	case b&0xe0 == 0xa0 || b >= 0xc4 && b <= 0xc6 || b >= 0xd9 && b <= 0xdb: // PackedForward
+		v, err := d.value()
+		if err != nil {
+			return "", false, unexpectedEOF(err)
+		}
+		packed = []byte(v.(string))
+	default: // Message: a single event
+		if rest == 0 {
+			return "", false, fmt.Errorf("message has no record")
+		}
+		rest--
+		t, err := d.value()
+		if err != nil {
+			return "", false, unexpectedEOF(err)
+		}
+		if ok, err = record(d, tag, t, send); err != nil {
+			return "", false, unexpectedEOF(err)
+		}
+	}
+
+	var opts options
+	if rest > 0 {
+		if opts, err = readOptions(d); err != nil {
+			return "", false, unexpectedEOF(err)
+		}
+	}
+	if packed != nil && ok {
+		if ok, err = s.unpack(packed, opts.compressed, tag, send); err != nil {
+			return "", false, err
+		}
+	}
+	return opts.chunk, ok, nil
+}
+
+// unpack passes the events of a PackedForward message to send.
+func (s *Server) unpack(packed []byte, compressed, tag string, send func(*parser.LogEntry) bool) (bool, error) {
+	var r io.Reader = bytes.NewReader(packed)
+	budget := len(packed)
+	switch compressed {
+	case "":
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return false, fmt.Errorf("decompressing events: %w", err)
+		}
+		r, budget = zr, s.maxMessageSize()
+	default:
+		return false, fmt.Errorf("unsupported compression %q", compressed)
+	}
+	d := &decoder{r: bufio.NewReader(r), budget: budget}
+	for {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			return true, nil
+		} else if err != nil {
+			return false, fmt.Errorf("decompressing events: %w", err)
+		}
+		ok, err := event(d, tag, send)
+		if err != nil || !ok {
+			return ok, unexpectedEOF(err)
+		}
+	}
+}
+
+// event reads one [time, record] event and passes it to send.
+func event(d *decoder, tag string, send func(*parser.LogEntry) bool) (bool, error) {
+	n, err := d.arrayLen()
+	if err != nil {
+		return false, err
+	}
+	if n != 2 {
+		return false, fmt.Errorf("event has %d elements, want 2", n)
+	}
+	t, err := d.value()
+	if err != nil {
+		return false, err
+	}
+	return record(d, tag, t, send)
+}
+
+// record reads the record of an event with the given tag and time, and
+// passes it to send as an entry.
+func record(d *decoder, tag string, t any, send func(*parser.LogEntry) bool) (bool, error) {
+	at, err := eventTime(t)
+	if err != nil {
+		return false, err
+	}
+	n, err := d.mapLen()
+	if err != nil {
+		return false, err
+	}
+	type field struct {
+		key   string
+		value any
+	}
+	fields := make([]field, 0, n)
+	hasTime := false
+	err = d.pairs(n, func(k string, v any) {
+		fields = append(fields, field{k, plain(v)})
+		for _, f := range timeFields {
+			hasTime = hasTime || k == f
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	entry := parser.NewOrderedEntry()
+	if !hasTime {
+		entry.Set("time", at.Format(time.RFC3339Nano))
+	}
+	for _, f := range fields {
+		entry.Set(f.key, f.value)
+	}
+	entry.Set(TagField, tag)
+	return send(entry), nil
+}
+
+// eventTime interprets the time of an event: an EventTime, or a number of
+// seconds since the Unix epoch.
+func eventTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case json.Number:
+		sec, err := v.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("event time %s is out of range", v)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("event time is %T, not a time", v)
+	}
+}
+
+// readOptions reads the option map that may end a message.
+func readOptions(d *decoder) (options, error) {
+	v, err := d.value()
+	if err != nil {
+		return options{}, err
+	}
+	m, isMap := v.(map[string]any)
+	if !isMap && v != nil {
+		return options{}, fmt.Errorf("message option is %T, not a map", v)
+	}
+	var opts options
+	opts.chunk, _ = m["chunk"].(string)
+	opts.compressed, _ = m["compressed"].(string)
+	if opts.compressed == "text" {
+		opts.compressed = ""
+	}
+	return opts, nil
+}
@@ -0,0 +1,327 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// obj is an ordered map for pack, bin a byte string and evTime an
+// EventTime extension.
+type (
+	kv     struct{ k, v any }
+	obj    []kv
+	bin    []byte
+	evTime time.Time
+)
+
+// pack returns the MessagePack encoding of v.
+func pack(v any) []byte {
+	return appendValue(nil, v)
+}
+
+func appendValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		if v >= -32 && v < 128 {
+			return append(b, byte(int8(v)))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+	case string:
+		return appendString(b, v)
+	case bin:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(len(v)))
+		return append(b, v...)
+	case []any:
+		b = binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(len(v)))
+		for _, e := range v {
+			b = appendValue(b, e)
+		}
+		return b
+	case obj:
+		b = binary.BigEndian.AppendUint16(append(b, 0xde), uint16(len(v)))
+		for _, p := range v {
+			b = appendValue(appendValue(b, p.k), p.v)
+		}
+		return b
+	case evTime:
+		t := time.Time(v)
+		b = binary.BigEndian.AppendUint32(append(b, 0xd7, 0x00), uint32(t.Unix()))
+		return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	default:
+		panic("pack: unsupported type")
+	}
+}
+
+// decode decodes data as a single value.
+func decode(data []byte) (any, error) {
+	d := &decoder{r: bufio.NewReader(bytes.NewReader(data)), budget: 1 << 20}
+	return d.value()
+}
+
+// =============================================================================
+// decoder
+// =============================================================================
+
+func TestDecoder_Values(t *testing.T) {
+	at := time.Date(2024, 1, 15, 10, 0, 0, 500, time.UTC)
+	tests := []struct {
+		data []byte
+		want any
+	}{
+		{pack(nil), nil},
+		{pack(true), true},
+		{pack(7), json.Number("7")},
+		{pack(-3), json.Number("-3")},
+		{pack(-1 << 40), json.Number("-1099511627776")},
+		{[]byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, json.Number("18446744073709551615")},
+		{[]byte{0xd0, 0x80}, json.Number("-128")},
+		{pack(1.5), 1.5},
+		{[]byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, 1.5},
+		{pack(strings.Repeat("x", 40)), strings.Repeat("x", 40)},
+		{pack(bin("raw")), "raw"},
+		{pack(evTime(at)), at},
+	}
+	for _, tt := range tests {
+		got, err := decode(tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("decode(% x) = %#v, %v; want %#v", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecoder_Containers(t *testing.T) {
+	got, err := decode(pack(obj{{"a", []any{1, "b", nil}}, {2, obj{{"t", evTime(time.Unix(0, 0))}}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(got)
+	if want := `{"2":{"t":"1970-01-01T00:00:00Z"},"a":[1,"b",null]}`; string(data) != want {
+		t.Errorf("decoded %s, want %s", data, want)
+	}
+}
+
+func TestDecoder_LengthsBoundedByBudget(t *testing.T) {
+	for _, data := range [][]byte{
+		{0xdb, 0xff, 0xff, 0xff, 0xff},
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0xdf, 0x7f, 0xff, 0xff, 0xff},
+	} {
+		if _, err := decode(data); !errors.Is(err, errTooLarge) {
+			t.Errorf("decode(% x) error = %v, want %v", data, err, errTooLarge)
+		}
+	}
+}
+
+func TestDecoder_Truncated(t *testing.T) {
+	data := pack([]any{"tag", 1})
+	if _, err := decode(data[:len(data)-1]); err != io.ErrUnexpectedEOF {
+		t.Errorf("error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// =============================================================================
+// Server
+// =============================================================================
+
+// serve starts a server on a loopback port and returns a connection to it
+// along with the server's channels.
+func serve(t *testing.T) (net.Conn, <-chan *parser.LogEntry, <-chan error) {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errs := s.Receive(ctx)
+	c, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		cancel()
+		for range entries {
+		}
+	})
+	return c, entries, errs
+}
+
+// receive returns the next n entries as JSON.
+func receive(t *testing.T, entries <-chan *parser.LogEntry, n int) []string {
+	t.Helper()
+	var out []string
+	for range n {
+		select {
+		case e := <-entries:
+			data, _ := json.Marshal(e)
+			out = append(out, string(data))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d of %d entries", len(out), n)
+		}
+	}
+	return out
+}
+
+var at = time.Date(2024, 1, 15, 10, 0, 0, 250000000, time.UTC)
+
+func TestServer_MessageMode_Acknowledged(t *testing.T) {
+	c, entries, _ := serve(t)
+	c.Write(pack([]any{"app.web", evTime(at), obj{{"level", "info"}, {"msg", "hi"}}, obj{{"chunk", "c1"}}}))
+
+	got := receive(t, entries, 1)
+	if want := `{"time":"2024-01-15T10:00:00.25Z","level":"info","msg":"hi","_tag":"app.web"}`; got[0] != want {
+		t.Errorf("entry = %s, want %s", got[0], want)
+	}
+	ack := make([]byte, 64)
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := c.Read(ack)
+	if err != nil || !bytes.Equal(ack[:n], appendAck(nil, "c1")) {
+		t.Errorf("ack = % x, %v", ack[:n], err)
+	}
+	if v, _ := decode(ack[:n]); v.(map[string]any)["ack"] != "c1" {
+		t.Errorf("ack decodes to %v", v)
+	}
+}
+
+func TestServer_ForwardMode_KeepsRecordTime(t *testing.T) {
+	c, entries, _ := serve(t)
+	c.Write(pack([]any{"app", []any{
+		[]any{1705312800, obj{{"msg", "a"}, {"time", "2024-01-15T10:00:00+01:00"}}},
+		[]any{1705312801.5, obj{{"msg", "b"}, {"n", 3}}},
+	}}))
+	got := receive(t, entries, 2)
+	want := []string{
+		`{"msg":"a","time":"2024-01-15T10:00:00+01:00","_tag":"app"}`,
+		`{"time":"2024-01-15T10:00:01.5Z","msg":"b","n":3,"_tag":"app"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("entries =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestServer_PackedForwardMode(t *testing.T) {
+	events := append(pack([]any{evTime(at), obj{{"msg", "a"}}}), pack([]any{evTime(at), obj{{"msg", "b"}}})...)
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(events)
+	zw.Close()
+
+	c, entries, _ := serve(t)
+	c.Write(pack([]any{"plain", bin(events)}))
+	c.Write(pack([]any{"zipped", bin(zipped.Bytes()), obj{{"compressed", "gzip"}, {"size", 2}}}))
+	got := receive(t, entries, 4)
+	for i, want := range []string{`"msg":"a","_tag":"plain"`, `"msg":"b","_tag":"plain"`, `"msg":"a","_tag":"zipped"`, `"msg":"b","_tag":"zipped"`} {
+		if !strings.Contains(got[i], want) {
+			t.Errorf("entry %d = %s, want it to contain %s", i, got[i], want)
+		}
+	}
+}
+
+func TestServer_MalformedMessage_ReportedAndClosed(t *testing.T) {
+	c, _, errs := serve(t)
+	c.Write(pack([]any{"app", true, obj{}}))
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "forward connection from") || !strings.Contains(err.Error(), "event time is bool") {
+			t.Errorf("error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error reported")
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after a malformed message = %v, want the connection closed", err)
+	}
+}
+
+func TestServer_MaxMessageSize(t *testing.T) {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxMessageSize = 32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, errs := s.Receive(ctx)
+	c, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write(pack([]any{"app", 1, obj{{"msg", strings.Repeat("x", 64)}}}))
+	select {
+	case err := <-errs:
+		if !errors.Is(err, errTooLarge) {
+			t.Errorf("error = %v, want %v", err, errTooLarge)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error reported")
+	}
+}
+
+func TestServer_Cancel_ClosesChannels(t *testing.T) {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errs := s.Receive(ctx)
+	c, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write(pack([]any{"app", 1, obj{{"msg", "a"}}}))
+	receive(t, entries, 1)
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		for range entries {
+		}
+		for range errs {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("channels not closed after cancel")
+	}
+	if _, err := net.Dial("tcp", s.Addr().String()); err == nil {
+		t.Error("listener still accepting after cancel")
+	}
+}
+
+func TestListen_DefaultPort(t *testing.T) {
+	s, err := Listen("127.0.0.1")
+	if err != nil {
+		t.Skipf("port %s unavailable: %v", DefaultPort, err)
+	}
+	defer s.ln.Close()
+	if _, port, _ := net.SplitHostPort(s.Addr().String()); port != DefaultPort {
+		t.Errorf("port = %s, want %s", port, DefaultPort)
+	}
+}
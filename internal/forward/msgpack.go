@@ -0,0 +1,322 @@
+package forward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// errTooLarge is returned by a decoder whose message exceeds its budget.
+var errTooLarge = errors.New("message too large")
+
+// ext is a MessagePack extension value other than an EventTime.
+type ext struct {
+	typ  int8
+	data []byte
+}
+
+// eventTimeExt is the extension type of the forward protocol's EventTime:
+// seconds and nanoseconds since the Unix epoch as two big-endian uint32s.
+const eventTimeExt = 0
+
+// decoder reads MessagePack values from r. Each value is charged against
+// budget, the number of bytes the current message may still use, so that a
+// corrupt or hostile length cannot make it allocate without bound.
+type decoder struct {
+	r      *bufio.Reader
+	budget int
+}
+
+// byte reads one byte.
+func (d *decoder) byte() (byte, error) {
+	if d.budget < 1 {
+		return 0, errTooLarge
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.budget--
+	return b, nil
+}
+
+// bytes reads n bytes into a new slice.
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if n < 0 || n > d.budget {
+		return nil, errTooLarge
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	d.budget -= n
+	return buf, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *decoder) uint(size int) (uint64, error) {
+	buf, err := d.bytes(size)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range buf {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// length reads a container or string length of size bytes and checks it
+// against the budget: every element or byte takes at least one byte.
+func (d *decoder) length(size int) (int, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(d.budget) {
+		return 0, errTooLarge
+	}
+	return int(n), nil
+}
+
+// value reads the next value. Maps become map[string]any, with other key
+// types formatted as strings; arrays become []any; integers become
+// json.Number, as the JSON parser's exact numbers are; str and bin both
+// become strings; and EventTime extensions become time.Time.
+func (d *decoder) value() (any, error) {
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return json.Number(strconv.Itoa(int(b))), nil
+	case b >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(b)))), nil
+	case b&0xf0 == 0x80:
+		return d.mapValue(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.array(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.str(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := d.length(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := d.length(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xc7, 0xc8, 0xc9: // ext 8/16/32
+		n, err := d.length(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		v, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(v))), nil
+	case 0xcb:
+		v, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(v), nil
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		v, err := d.uint(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(v, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8/16/32/64
+		size := 1 << (b - 0xd0)
+		v, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*size
+		return json.Number(strconv.FormatInt(int64(v<<shift)>>shift, 10)), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1/2/4/8/16
+		return d.ext(1 << (b - 0xd4))
+	case 0xdc, 0xdd: // array 16/32
+		n, err := d.length(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n)
+	case 0xde, 0xdf: // map 16/32
+		n, err := d.length(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n)
+	default:
+		return nil, fmt.Errorf("invalid MessagePack type byte 0x%02x", b)
+	}
+}
+
+// str reads a string of n bytes.
+func (d *decoder) str(n int) (string, error) {
+	buf, err := d.bytes(n)
+	return string(buf), err
+}
+
+// ext reads the type and n data bytes of an extension value.
+func (d *decoder) ext(n int) (any, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	data, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) == eventTimeExt && n == 8 {
+		sec := binary.BigEndian.Uint32(data[:4])
+		nsec := binary.BigEndian.Uint32(data[4:])
+		return time.Unix(int64(sec), int64(nsec)).UTC(), nil
+	}
+	return ext{typ: int8(typ), data: data}, nil
+}
+
+// array reads the n elements of an array.
+func (d *decoder) array(n int) ([]any, error) {
+	out := make([]any, n)
+	for i := range out {
+		v, err := d.value()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		out[i] = plain(v)
+	}
+	return out, nil
+}
+
+// mapValue reads the n pairs of a map.
+func (d *decoder) mapValue(n int) (map[string]any, error) {
+	out := make(map[string]any, n)
+	err := d.pairs(n, func(k string, v any) {
+		out[k] = plain(v)
+	})
+	return out, err
+}
+
+// mapLen reads the header of a map and returns its number of pairs.
+func (d *decoder) mapLen() (int, error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f), nil
+	case b == 0xde, b == 0xdf:
+		return d.length(2 << (b - 0xde))
+	default:
+		return 0, fmt.Errorf("expected a map, got type byte 0x%02x", b)
+	}
+}
+
+// arrayLen reads the header of an array and returns its number of
+// elements.
+func (d *decoder) arrayLen() (int, error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b&0xf0 == 0x90:
+		return int(b & 0x0f), nil
+	case b == 0xdc, b == 0xdd:
+		return d.length(2 << (b - 0xdc))
+	default:
+		return 0, fmt.Errorf("expected an array, got type byte 0x%02x", b)
+	}
+}
+
+// pairs reads n key-value pairs, calling fn with each in order.
+func (d *decoder) pairs(n int, fn func(k string, v any)) error {
+	for range n {
+		k, err := d.value()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		v, err := d.value()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(plain(k))
+		}
+		fn(key, v)
+	}
+	return nil
+}
+
+// plain converts the values that only occur inside a decoder to ones the
+// rest of logpipe handles: times as RFC 3339 strings and other extensions
+// as their hex-encoded data.
+func plain(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case ext:
+		return hex.EncodeToString(v.data)
+	default:
+		return v
+	}
+}
+
+// unexpectedEOF turns io.EOF, met inside a value, into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// appendAck appends the MessagePack encoding of the acknowledgement
+// {"ack": chunk} to buf.
+func appendAck(buf []byte, chunk string) []byte {
+	buf = append(buf, 0x81, 0xa3, 'a', 'c', 'k')
+	return appendString(buf, chunk)
+}
+
+// appendString appends the MessagePack encoding of s to buf.
+func appendString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, s...)
+}
@@ -0,0 +1,439 @@
+// Package gelf receives log messages in the Graylog Extended Log Format,
+// so that applications and agents configured for Graylog can send their
+// logs to logpipe instead. Messages are accepted as UDP datagrams, which
+// may be gzip- or zlib-compressed and split into chunks, or over TCP,
+// where each uncompressed message ends with a null byte.
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// DefaultPort is the port Graylog's GELF inputs listen on by default.
+const DefaultPort = "12201"
+
+// DefaultMaxMessageSize is the largest message a Server accepts when
+// MaxMessageSize is zero, after reassembly and decompression.
+const DefaultMaxMessageSize = 8 << 20
+
+// Chunking limits from the GELF specification: a message is split into at
+// most maxChunks chunks, and one whose chunks have not all arrived within
+// chunkTimeout is dropped.
+const (
+	maxChunks    = 128
+	chunkTimeout = 5 * time.Second
+)
+
+// chunkMagic starts every chunk of a chunked message.
+var chunkMagic = []byte{0x1e, 0x0f}
+
+// levels names the syslog severities GELF levels are given as.
+var levels = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// errTooLarge is reported for a message larger than the size limit.
+var errTooLarge = errors.New("message too large")
+
+// Server receives GELF messages on a UDP socket or a TCP listener.
+type Server struct {
+	pc net.PacketConn // for UDP
+	ln net.Listener   // for TCP
+	// MaxMessageSize bounds the size of a single message; larger ones are
+	// dropped, and a TCP connection that sends one is closed. Zero means
+	// DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	now func() time.Time // the time, replaced in tests
+}
+
+// Listen returns a Server receiving on addr over network, "udp" or "tcp".
+// A missing port means DefaultPort.
+func Listen(network, addr string) (*Server, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	s := &Server{now: time.Now}
+	var err error
+	switch network {
+	case "udp":
+		s.pc, err = net.ListenPacket("udp", addr)
+	case "tcp":
+		s.ln, err = net.Listen("tcp", addr)
+	default:
+		return nil, fmt.Errorf("gelf: unsupported network %q", network)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Addr returns the address the server is receiving on.
+func (s *Server) Addr() net.Addr {
+	if s.pc != nil {
+		return s.pc.LocalAddr()
+	}
+	return s.ln.Addr()
+}
+
+// maxMessageSize returns the effective message size limit.
+func (s *Server) maxMessageSize() int {
+	if s.MaxMessageSize > 0 {
+		return s.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
+}
+
+// Receive receives messages until ctx is done and sends each on the
+// entries channel as an entry: its timestamp as an RFC 3339 time field,
+// falling back to when it was received; its level as the syslog
+// severity's name; its short_message as msg; and then its other fields in
+// the order they were sent, additional fields without their leading
+// underscore. Malformed messages are dropped, and they and problems with
+// a connection, which is then closed, are sent on the error channel. When
+// ctx is done the socket or listener and every connection are closed, and
+// both channels are closed once everything received has been sent. The
+// entries are owned by the receiver, as a parser's are.
+func (s *Server) Receive(ctx context.Context) (<-chan *parser.LogEntry, <-chan error) {
+	entries := make(chan *parser.LogEntry, 64)
+	errs := make(chan error, 16)
+
+	send := func(e *parser.LogEntry) bool {
+		select {
+		case entries <- e:
+			return true
+		case <-ctx.Done():
+			parser.Release(e)
+			return false
+		}
+	}
+	report := func(err error) {
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case errs <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer func() {
+			close(entries)
+			close(errs)
+		}()
+		if s.pc != nil {
+			s.receivePackets(ctx, send, report)
+		} else {
+			s.acceptConns(ctx, send, report)
+		}
+	}()
+	return entries, errs
+}
+
+// partial is a chunked message whose chunks have not all arrived.
+type partial struct {
+	chunks [][]byte
+	n      int // chunks received
+	size   int // bytes received
+	first  time.Time
+}
+
+// receivePackets reads datagrams until ctx is done, reassembling chunked
+// messages, and passes each message to send.
+func (s *Server) receivePackets(ctx context.Context, send func(*parser.LogEntry) bool, report func(error)) {
+	stop := context.AfterFunc(ctx, func() { s.pc.Close() })
+	defer stop()
+	partials := make(map[string]*partial)
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			report(fmt.Errorf("receiving GELF datagrams: %w", err))
+			return
+		}
+		now := s.now()
+		for id, p := range partials {
+			if now.Sub(p.first) > chunkTimeout {
+				delete(partials, id)
+				report(fmt.Errorf("GELF message %s: dropped with %d of %d chunks after %s", id, p.n, len(p.chunks), chunkTimeout))
+			}
+		}
+		data := buf[:n]
+		if bytes.HasPrefix(data, chunkMagic) {
+			var err error
+			if data, err = s.reassemble(partials, data, now); err != nil {
+				report(fmt.Errorf("GELF chunk from %s: %w", from, err))
+				continue
+			}
+			if data == nil {
+				continue
+			}
+		}
+		entry, err := s.decode(data, now)
+		if err != nil {
+			report(fmt.Errorf("GELF message from %s: %w", from, err))
+			continue
+		}
+		if !send(entry) {
+			return
+		}
+	}
+}
+
+// reassemble adds the chunk data to the message it belongs to in partials,
+// and returns the whole message once every chunk of it has arrived, or nil
+// until then.
+func (s *Server) reassemble(partials map[string]*partial, data []byte, now time.Time) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("chunk of %d bytes is shorter than its header", len(data))
+	}
+	id, seq, count := hex.EncodeToString(data[2:10]), int(data[10]), int(data[11])
+	if count == 0 || count > maxChunks || seq >= count {
+		return nil, fmt.Errorf("chunk %d of %d is out of range (at most %d chunks)", seq, count, maxChunks)
+	}
+	p := partials[id]
+	if p == nil {
+		p = &partial{chunks: make([][]byte, count), first: now}
+		partials[id] = p
+	}
+	if len(p.chunks) != count {
+		delete(partials, id)
+		return nil, fmt.Errorf("message %s: chunk counts %d and %d differ", id, len(p.chunks), count)
+	}
+	if p.chunks[seq] != nil {
+		// A duplicate, as UDP may deliver.
+		return nil, nil
+	}
+	p.chunks[seq] = bytes.Clone(data[12:])
+	p.n++
+	p.size += len(data) - 12
+	if p.size > s.maxMessageSize() {
+		delete(partials, id)
+		return nil, fmt.Errorf("message %s: %w", id, errTooLarge)
+	}
+	if p.n < count {
+		return nil, nil
+	}
+	delete(partials, id)
+	return bytes.Join(p.chunks, nil), nil
+}
+
+// acceptConns accepts TCP connections until ctx is done and passes each
+// message they send to send.
+func (s *Server) acceptConns(ctx context.Context, send func(*parser.LogEntry) bool, report func(error)) {
+	var mu sync.Mutex
+	conns := make(map[net.Conn]bool)
+	stop := context.AfterFunc(ctx, func() {
+		s.ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for c := range conns {
+			c.Close()
+		}
+	})
+	var wg sync.WaitGroup
+	defer func() {
+		stop()
+		wg.Wait()
+	}()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			report(fmt.Errorf("accepting GELF connections: %w", err))
+			return
+		}
+		mu.Lock()
+		conns[c] = true
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.serve(c, send, report); err != nil {
+				report(fmt.Errorf("GELF connection from %s: %w", c.RemoteAddr(), err))
+			}
+			mu.Lock()
+			delete(conns, c)
+			mu.Unlock()
+			c.Close()
+		}()
+	}
+}
+
+// serve reads null-terminated messages from c until it is closed, passing
+// each to send. A malformed message is reported and the connection
+// carries on; it stops without an error when send returns false or c is
+// closed between messages.
+func (s *Server) serve(c net.Conn, send func(*parser.LogEntry) bool, report func(error)) error {
+	br := bufio.NewReader(c)
+	limit := s.maxMessageSize()
+	var msg []byte
+	for {
+		chunk, err := br.ReadSlice(0)
+		msg = append(msg, chunk...)
+		if len(msg) > limit+1 {
+			return errTooLarge
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			if len(bytes.TrimSpace(msg)) > 0 && err == io.EOF {
+				return fmt.Errorf("message not ended with a null byte: %w", io.ErrUnexpectedEOF)
+			}
+			return nil
+		}
+		data := bytes.TrimSpace(msg[:len(msg)-1])
+		msg = msg[:0]
+		if len(data) == 0 {
+			continue
+		}
+		entry, err := s.decode(data, s.now())
+		if err != nil {
+			report(fmt.Errorf("GELF message from %s: %w", c.RemoteAddr(), err))
+			continue
+		}
+		if !send(entry) {
+			return nil
+		}
+	}
+}
+
+// decode decompresses data if need be and returns the message it holds as
+// an entry, received at now.
+func (s *Server) decode(data []byte, now time.Time) (*parser.LogEntry, error) {
+	var zr io.ReadCloser
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		zr, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		zr, err = zlib.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decompressing: %w", err)
+	}
+	if zr != nil {
+		limit := s.maxMessageSize()
+		data, err = io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+		zr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decompressing: %w", err)
+		}
+		if len(data) > limit {
+			return nil, errTooLarge
+		}
+	}
+	return message(data, now)
+}
+
+// field is a field of a message, in the order it was sent.
+type field struct {
+	key   string
+	value any
+}
+
+// message returns the entry for the JSON message data, received at now.
+func message(data []byte, now time.Time) (*parser.LogEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	var (
+		fields []field
+		at     = now
+		level  any
+		msg    string
+		hasMsg bool
+	)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		key := tok.(string)
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		switch key {
+		case "version":
+		case "short_message":
+			msg, hasMsg = v.(string)
+		case "timestamp":
+			if at, err = timestamp(v); err != nil {
+				return nil, err
+			}
+		case "level":
+			level = severity(v)
+		default:
+			if name, ok := strings.CutPrefix(key, "_"); ok && name != "" {
+				key = name
+			}
+			fields = append(fields, field{key, v})
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("data after the JSON object")
+	}
+	if !hasMsg {
+		return nil, fmt.Errorf("no short_message")
+	}
+
+	entry := parser.NewOrderedEntry()
+	entry.Set("time", at.UTC().Format(time.RFC3339Nano))
+	if level != nil {
+		entry.Set("level", level)
+	}
+	entry.Set("msg", msg)
+	for _, f := range fields {
+		entry.Set(f.key, f.value)
+	}
+	return entry, nil
+}
+
+// timestamp interprets a message's timestamp: seconds since the Unix epoch
+// with an optional fraction.
+func timestamp(v any) (time.Time, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, fmt.Errorf("timestamp is not a number")
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp %s is out of range", n)
+	}
+	sec, frac := math.Modf(f)
+	// Timestamps carry at most microseconds; rounding hides float error.
+	return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3), nil
+}
+
+// severity returns the name of the syslog severity v gives as a number,
+// or v itself when it is not one.
+func severity(v any) any {
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil && i >= 0 && i < int64(len(levels)) {
+			return levels[i]
+		}
+	}
+	return v
+}
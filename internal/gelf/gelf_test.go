@@ -0,0 +1,328 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// message
+// =============================================================================
+
+func TestMessage_Fields(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		data, want string
+	}{
+		{
+			`{"version":"1.1","host":"web-1","short_message":"disk full","timestamp":1705312801.25,"level":3,"_user_id":42,"_path":"/var"}`,
+			`{"time":"2024-01-15T10:00:01.25Z","level":"error","msg":"disk full","host":"web-1","user_id":42,"path":"/var"}`,
+		},
+		{
+			// No timestamp: the time it was received.
+			`{"short_message":"hi","full_message":"hi\nthere","level":"WARN"}`,
+			`{"time":"2024-01-15T10:00:00Z","level":"WARN","msg":"hi","full_message":"hi\nthere"}`,
+		},
+		{
+			`{"short_message":"x","level":9,"_":1}`,
+			`{"time":"2024-01-15T10:00:00Z","level":9,"msg":"x","_":1}`,
+		},
+	}
+	for _, tt := range tests {
+		entry, err := message([]byte(tt.data), now)
+		if err != nil {
+			t.Errorf("message(%s): %v", tt.data, err)
+			continue
+		}
+		if got := encode(t, entry); got != tt.want {
+			t.Errorf("message(%s) =\n%s\nwant\n%s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestMessage_Malformed(t *testing.T) {
+	for _, data := range []string{
+		`[1]`,
+		`{"short_message":"x"`,
+		`{"short_message":"x"} {}`,
+		`{"host":"web-1"}`,
+		`{"short_message":3}`,
+		`{"short_message":"x","timestamp":"yesterday"}`,
+	} {
+		if _, err := message([]byte(data), time.Now()); err == nil {
+			t.Errorf("message(%s): expected error", data)
+		}
+	}
+}
+
+// encode returns entry as JSON, with its fields in order.
+func encode(t *testing.T, entry *parser.LogEntry) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range entry.Keys() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		value, err := json.Marshal(entry.Fields[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// =============================================================================
+// UDP
+// =============================================================================
+
+const sample = `{"version":"1.1","host":"web-1","short_message":"hello","timestamp":1705312800,"level":6}`
+
+// listen starts a server on a loopback port, after passing it to setup
+// when that is not nil, and returns a client socket connected to it along
+// with the server's channels.
+func listen(t *testing.T, network string, setup func(*Server)) (net.Conn, <-chan *parser.LogEntry, <-chan error) {
+	t.Helper()
+	s, err := Listen(network, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(s)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errs := s.Receive(ctx)
+	c, err := net.Dial(network, s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		cancel()
+		for range entries {
+		}
+	})
+	return c, entries, errs
+}
+
+// next returns the msg of the next entry received, failing the test if
+// none arrives in time.
+func next(t *testing.T, entries <-chan *parser.LogEntry) string {
+	t.Helper()
+	select {
+	case e := <-entries:
+		return e.Fields["msg"].(string)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an entry")
+		return ""
+	}
+}
+
+// nextErr returns the next error reported, failing the test if none
+// arrives in time.
+func nextErr(t *testing.T, errs <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an error")
+		return nil
+	}
+}
+
+// chunks splits data into GELF chunks of at most size bytes of payload
+// under the message id.
+func chunks(id byte, data []byte, size int) [][]byte {
+	var out [][]byte
+	count := (len(data) + size - 1) / size
+	for i := 0; i < count; i++ {
+		end := min(len(data), (i+1)*size)
+		header := []byte{0x1e, 0x0f, id, 0, 0, 0, 0, 0, 0, 0, byte(i), byte(count)}
+		out = append(out, append(header, data[i*size:end]...))
+	}
+	return out
+}
+
+func TestServer_UDP_Plain(t *testing.T) {
+	c, entries, _ := listen(t, "udp", nil)
+	c.Write([]byte(sample))
+	if got := next(t, entries); got != "hello" {
+		t.Errorf("msg = %q", got)
+	}
+}
+
+func TestServer_UDP_Compressed(t *testing.T) {
+	c, entries, _ := listen(t, "udp", nil)
+	var gz, zl bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(sample))
+	zw.Close()
+	lw := zlib.NewWriter(&zl)
+	lw.Write([]byte(strings.Replace(sample, "hello", "zlib", 1)))
+	lw.Close()
+	c.Write(gz.Bytes())
+	if got := next(t, entries); got != "hello" {
+		t.Errorf("gzip msg = %q", got)
+	}
+	c.Write(zl.Bytes())
+	if got := next(t, entries); got != "zlib" {
+		t.Errorf("zlib msg = %q", got)
+	}
+}
+
+func TestServer_UDP_Chunked(t *testing.T) {
+	c, entries, _ := listen(t, "udp", nil)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(sample))
+	zw.Close()
+	parts := chunks(1, gz.Bytes(), 20)
+	if len(parts) < 3 {
+		t.Fatalf("only %d chunks", len(parts))
+	}
+	// Out of order, with a duplicate, as UDP may deliver them.
+	c.Write(parts[len(parts)-1])
+	c.Write(parts[0])
+	c.Write(parts[0])
+	for _, p := range parts[1 : len(parts)-1] {
+		c.Write(p)
+	}
+	c.Write([]byte(strings.Replace(sample, "hello", "after", 1)))
+	if got := next(t, entries); got != "hello" {
+		t.Errorf("msg = %q, want the reassembled message", got)
+	}
+	if got := next(t, entries); got != "after" {
+		t.Errorf("msg = %q, want the next message", got)
+	}
+}
+
+func TestServer_UDP_ChunkTimeout(t *testing.T) {
+	clock := make(chan time.Time, 2)
+	base := time.Now()
+	clock <- base
+	clock <- base.Add(chunkTimeout + time.Second)
+	c, entries, errs := listen(t, "udp", func(s *Server) {
+		s.now = func() time.Time { return <-clock }
+	})
+
+	parts := chunks(2, []byte(sample), 30)
+	c.Write(parts[0])
+	c.Write([]byte(sample))
+	if err := nextErr(t, errs); !strings.Contains(err.Error(), "dropped with 1 of") {
+		t.Errorf("error = %v", err)
+	}
+	if got := next(t, entries); got != "hello" {
+		t.Errorf("msg = %q", got)
+	}
+}
+
+func TestServer_UDP_Malformed_Reported(t *testing.T) {
+	c, entries, errs := listen(t, "udp", nil)
+	c.Write([]byte("not gelf"))
+	c.Write([]byte{0x1e, 0x0f, 1, 2})
+	c.Write([]byte{0x1e, 0x0f, 1, 0, 0, 0, 0, 0, 0, 0, 5, 3})
+	c.Write([]byte(sample))
+	for _, want := range []string{"not a JSON object", "shorter than its header", "out of range"} {
+		if err := nextErr(t, errs); !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want %q", err, want)
+		}
+	}
+	if got := next(t, entries); got != "hello" {
+		t.Errorf("msg = %q", got)
+	}
+}
+
+func TestServer_MaxMessageSize(t *testing.T) {
+	c, entries, errs := listen(t, "udp", func(s *Server) { s.MaxMessageSize = 40 })
+	for _, p := range chunks(3, []byte(sample), 30) {
+		c.Write(p)
+	}
+	if err := nextErr(t, errs); !strings.Contains(err.Error(), errTooLarge.Error()) {
+		t.Errorf("error = %v, want %v", err, errTooLarge)
+	}
+	c.Write([]byte(`{"short_message":"ok"}`))
+	if got := next(t, entries); got != "ok" {
+		t.Errorf("msg = %q", got)
+	}
+}
+
+// =============================================================================
+// TCP
+// =============================================================================
+
+func TestServer_TCP(t *testing.T) {
+	c, entries, errs := listen(t, "tcp", nil)
+	c.Write([]byte(sample + "\x00{oops}\x00" + strings.Replace(sample, "hello", "second", 1) + "\n\x00"))
+	if got := next(t, entries); got != "hello" {
+		t.Errorf("msg = %q", got)
+	}
+	if err := nextErr(t, errs); !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("error = %v", err)
+	}
+	if got := next(t, entries); got != "second" {
+		t.Errorf("msg = %q", got)
+	}
+}
+
+func TestServer_TCP_Unterminated(t *testing.T) {
+	c, _, errs := listen(t, "tcp", nil)
+	c.Write([]byte(sample))
+	c.(*net.TCPConn).CloseWrite()
+	if err := nextErr(t, errs); !strings.Contains(err.Error(), "null byte") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestServer_Cancel_ClosesChannels(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		s, err := Listen(network, "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		entries, errs := s.Receive(ctx)
+		cancel()
+		done := make(chan struct{})
+		go func() {
+			for range entries {
+			}
+			for range errs {
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: channels not closed after cancel", network)
+		}
+	}
+}
+
+func TestListen_DefaultPort(t *testing.T) {
+	s, err := Listen("udp", "127.0.0.1")
+	if err != nil {
+		t.Skipf("port %s unavailable: %v", DefaultPort, err)
+	}
+	defer s.pc.Close()
+	if _, port, _ := net.SplitHostPort(s.Addr().String()); port != DefaultPort {
+		t.Errorf("port = %s, want %s", port, DefaultPort)
+	}
+	if _, err := Listen("sctp", "127.0.0.1:0"); err == nil {
+		t.Error("expected error for an unsupported network")
+	}
+}
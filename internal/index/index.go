@@ -0,0 +1,352 @@
+// Package index builds and reads sidecar indexes for large log files. An
+// index divides a file into blocks of whole lines and records, for each
+// block, its byte range, the range of timestamp values it contains and which
+// level values occur in it. Filtered runs consult the index to read only the
+// blocks that could contain a matching entry.
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// Version is the on-disk format version written by Build. Load rejects
+// indexes with a different version.
+const Version = 2
+
+// DefaultBlockSize is the target size of an index block in bytes.
+const DefaultBlockSize = 4 << 20
+
+// Suffix is appended to a log file's path to form its sidecar index path.
+const Suffix = ".lpidx"
+
+// overflowBit is set in Block.Levels when a block contains a level value
+// that did not fit in the 63-entry level dictionary.
+const overflowBit = 63
+
+// timeFields and levelFields are the canonical field names the index
+// summarises, matching those the text formatter recognises.
+var (
+	timeFields  = []string{"time", "ts", "timestamp"}
+	levelFields = []string{"level", "lvl", "severity"}
+)
+
+// Index is the sidecar index for one log file.
+type Index struct {
+	Version int       `json:"version"`
+	Size    int64     `json:"size"`     // Size of the source file when indexed.
+	ModTime time.Time `json:"mod_time"` // Modification time of the source file when indexed.
+	Format  string    `json:"format"`   // Input format used to parse the file.
+	Entries int       `json:"entries"`  // Total number of parsed entries.
+	// Levels is the dictionary of level values seen; bit i of Block.Levels
+	// refers to Levels[i].
+	Levels []string `json:"levels"`
+	Blocks []Block  `json:"blocks"`
+}
+
+// Block summarises a contiguous run of whole lines.
+type Block struct {
+	Offset  int64 `json:"offset"`  // Byte offset of the first line.
+	Length  int64 `json:"length"`  // Length in bytes, including line terminators.
+	Lines   int   `json:"lines"`   // Number of lines in the block.
+	Entries int   `json:"entries"` // Number of lines that parsed as entries.
+	// MinTime and MaxTime bound the string values of every time, ts and
+	// timestamp field in the block, compared lexicographically as filters do.
+	MinTime string `json:"min_time,omitempty"`
+	MaxTime string `json:"max_time,omitempty"`
+	// Start and End bound the instants of those values that are timestamps
+	// with a UTC offset, for filters that compare timestamps. Naive is set
+	// when some are timestamps without an offset, whose instant depends on
+	// the zone a run assumes for them.
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+	Naive bool       `json:"naive,omitempty"`
+	// Levels is a bitmap over Index.Levels of the values of every level,
+	// lvl and severity field in the block.
+	Levels uint64 `json:"levels"`
+}
+
+// Predicate is a single field comparison an index can use to rule blocks
+// out. Op uses the filter package's operator spellings.
+type Predicate struct {
+	Field string
+	Op    string
+	Value string
+	// Time is the instant Value denotes when the filter compares
+	// timestamps rather than text, and the zero time otherwise.
+	Time time.Time
+}
+
+// Path returns the sidecar index path for the log file at logPath.
+func Path(logPath string) string {
+	return logPath + Suffix
+}
+
+// Build reads r to the end, parsing each block of roughly blockSize bytes
+// with p, and returns the resulting index. format names the input format
+// for later runs; info describes the file being indexed and is used for
+// staleness checks.
+func Build(r io.Reader, p parser.Parser, format string, info os.FileInfo, blockSize int) (*Index, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	ix := &Index{
+		Version: Version,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Format:  format,
+	}
+	levelBits := make(map[string]int)
+
+	br := bufio.NewReader(r)
+	var buf bytes.Buffer
+	var offset int64
+	lines := 0
+	inLine := false
+	flush := func() {
+		if buf.Len() == 0 {
+			return
+		}
+		b := Block{Offset: offset, Length: int64(buf.Len()), Lines: lines}
+		ix.summarise(&b, p, buf.Bytes(), levelBits)
+		ix.Blocks = append(ix.Blocks, b)
+		ix.Entries += b.Entries
+		offset += b.Length
+		buf.Reset()
+		lines = 0
+	}
+
+	for {
+		chunk, err := br.ReadSlice('\n')
+		buf.Write(chunk)
+		inLine = inLine || len(chunk) > 0
+		if err == bufio.ErrBufferFull {
+			// Keep reading the rest of an unusually long line.
+			continue
+		}
+		if inLine {
+			lines++
+			inLine = false
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() >= blockSize {
+			flush()
+		}
+	}
+	flush()
+	return ix, nil
+}
+
+// summarise parses data with p and fills in b's entry count, time range and
+// level bitmap.
+func (ix *Index) summarise(b *Block, p parser.Parser, data []byte, levelBits map[string]int) {
+	entries, errs := p.Parse(bytes.NewReader(data))
+	go func() {
+		for range errs {
+			// Malformed lines are not indexed; they can never match a filter.
+		}
+	}()
+	for entry := range entries {
+		b.Entries++
+		for _, f := range timeFields {
+			v, ok := entry.Fields[f]
+			if !ok {
+				continue
+			}
+			s := fmt.Sprintf("%v", v)
+			if b.MinTime == "" || s < b.MinTime {
+				b.MinTime = s
+			}
+			if s > b.MaxTime {
+				b.MaxTime = s
+			}
+			if t, zoned, ok := parser.ParseTime(s, nil); ok && !zoned {
+				b.Naive = true
+			} else if ok {
+				t = t.UTC()
+				if b.Start == nil || t.Before(*b.Start) {
+					b.Start = &t
+				}
+				if b.End == nil || t.After(*b.End) {
+					b.End = &t
+				}
+			}
+		}
+		for _, f := range levelFields {
+			v, ok := entry.Fields[f]
+			if !ok {
+				continue
+			}
+			s := fmt.Sprintf("%v", v)
+			bit, ok := levelBits[s]
+			if !ok {
+				bit = overflowBit
+				if len(ix.Levels) < overflowBit {
+					bit = len(ix.Levels)
+					ix.Levels = append(ix.Levels, s)
+					levelBits[s] = bit
+				}
+			}
+			b.Levels |= 1 << bit
+		}
+		parser.Release(entry)
+	}
+}
+
+// Write stores ix as JSON at path.
+func (ix *Index) Write(path string) error {
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return fmt.Errorf("encoding index: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Load reads the index stored at path.
+func Load(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ix Index
+	if err := json.Unmarshal(data, &ix); err != nil {
+		return nil, fmt.Errorf("decoding index %s: %w", path, err)
+	}
+	if ix.Version != Version {
+		return nil, fmt.Errorf("index %s has version %d, want %d", path, ix.Version, Version)
+	}
+	return &ix, nil
+}
+
+// Fresh reports whether ix still describes the file with the given info,
+// judged by its size and modification time.
+func (ix *Index) Fresh(info os.FileInfo) bool {
+	return ix.Size == info.Size() && ix.ModTime.Equal(info.ModTime())
+}
+
+// Candidates returns the blocks that may contain an entry satisfying every
+// predicate. Predicates the index cannot evaluate never exclude a block.
+func (ix *Index) Candidates(preds []Predicate) []Block {
+	var out []Block
+	for _, b := range ix.Blocks {
+		if ix.mayMatch(b, preds) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// mayMatch reports whether b could hold an entry satisfying all of preds.
+func (ix *Index) mayMatch(b Block, preds []Predicate) bool {
+	if b.Entries == 0 {
+		return false
+	}
+	for _, pr := range preds {
+		switch {
+		case contains(levelFields, pr.Field):
+			if pr.Op == "=" && !ix.hasLevel(b, pr.Value) {
+				return false
+			}
+		case contains(timeFields, pr.Field) && !pr.Time.IsZero():
+			if !instantMayMatch(b, pr.Op, pr.Time) {
+				return false
+			}
+		case contains(timeFields, pr.Field):
+			if !timeMayMatch(b, pr.Op, pr.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasLevel reports whether b may contain the level value v.
+func (ix *Index) hasLevel(b Block, v string) bool {
+	if b.Levels&(1<<overflowBit) != 0 {
+		return true
+	}
+	for i, l := range ix.Levels {
+		if l == v {
+			return b.Levels&(1<<i) != 0
+		}
+	}
+	return false
+}
+
+// timeMayMatch reports whether some value in [b.MinTime, b.MaxTime] could
+// satisfy "value op v".
+func timeMayMatch(b Block, op, v string) bool {
+	if b.MinTime == "" && b.MaxTime == "" {
+		// No timestamps in the block: nothing can match a time filter.
+		return false
+	}
+	switch op {
+	case "=":
+		return v >= b.MinTime && v <= b.MaxTime
+	case ">":
+		return b.MaxTime > v
+	case ">=":
+		return b.MaxTime >= v
+	case "<":
+		return b.MinTime < v
+	case "<=":
+		return b.MinTime <= v
+	default:
+		return true
+	}
+}
+
+// instantMayMatch reports whether some timestamp in b could satisfy
+// "timestamp op t". Blocks with naive timestamps are always kept.
+func instantMayMatch(b Block, op string, t time.Time) bool {
+	if b.Naive {
+		return true
+	}
+	if b.Start == nil {
+		// No timestamps in the block: nothing can match a time filter.
+		return false
+	}
+	switch op {
+	case ">":
+		return b.End.After(t)
+	case ">=":
+		return !b.End.Before(t)
+	case "<":
+		return b.Start.Before(t)
+	case "<=":
+		return !b.Start.After(t)
+	default:
+		return true
+	}
+}
+
+// Reader returns a reader over just the given blocks of the indexed file.
+func Reader(ra io.ReaderAt, blocks []Block) io.Reader {
+	readers := make([]io.Reader, len(blocks))
+	for i, b := range blocks {
+		readers[i] = io.NewSectionReader(ra, b.Offset, b.Length)
+	}
+	return io.MultiReader(readers...)
+}
+
+// contains reports whether s is one of list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
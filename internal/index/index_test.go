@@ -0,0 +1,246 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// fakeInfo is a minimal os.FileInfo for Build.
+type fakeInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+func (f fakeInfo) Name() string       { return "test.log" }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) Mode() os.FileMode  { return 0o644 }
+func (f fakeInfo) ModTime() time.Time { return f.modTime }
+func (f fakeInfo) IsDir() bool        { return false }
+func (f fakeInfo) Sys() any           { return nil }
+
+// sampleLog returns n JSON lines with increasing timestamps; every tenth
+// entry is a warning and entry 25 is the only error.
+func sampleLog(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		level := "info"
+		switch {
+		case i == 25:
+			level = "error"
+		case i%10 == 0:
+			level = "warn"
+		}
+		fmt.Fprintf(&b, `{"time":"2024-01-15T00:00:%02dZ","level":"%s","msg":"m%d"}`+"\n", i, level, i)
+	}
+	return b.String()
+}
+
+// buildSample indexes data with a block size small enough to produce
+// several blocks.
+func buildSample(t *testing.T, data string, blockSize int) *Index {
+	t.Helper()
+	info := fakeInfo{size: int64(len(data)), modTime: time.Unix(1700000000, 0)}
+	ix, err := Build(strings.NewReader(data), parser.NewJSONParser(), "json", info, blockSize)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return ix
+}
+
+func TestBuild_BlocksCoverWholeFile(t *testing.T) {
+	data := sampleLog(50)
+	ix := buildSample(t, data, 512)
+	if len(ix.Blocks) < 2 {
+		t.Fatalf("expected several blocks, got %d", len(ix.Blocks))
+	}
+	var offset int64
+	lines := 0
+	for i, b := range ix.Blocks {
+		if b.Offset != offset {
+			t.Errorf("block %d offset = %d, want %d", i, b.Offset, offset)
+		}
+		offset += b.Length
+		lines += b.Lines
+	}
+	if offset != int64(len(data)) {
+		t.Errorf("blocks cover %d bytes, want %d", offset, len(data))
+	}
+	if lines != 50 || ix.Entries != 50 {
+		t.Errorf("lines = %d, entries = %d, want 50 each", lines, ix.Entries)
+	}
+}
+
+func TestBuild_BlocksEndOnLineBoundaries(t *testing.T) {
+	data := sampleLog(30)
+	ix := buildSample(t, data, 100)
+	for i, b := range ix.Blocks {
+		end := b.Offset + b.Length
+		if data[end-1] != '\n' {
+			t.Errorf("block %d does not end on a newline", i)
+		}
+	}
+}
+
+func TestBuild_RecordsTimeRangeAndLevels(t *testing.T) {
+	ix := buildSample(t, sampleLog(5), DefaultBlockSize)
+	if len(ix.Blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(ix.Blocks))
+	}
+	b := ix.Blocks[0]
+	if b.MinTime != "2024-01-15T00:00:00Z" || b.MaxTime != "2024-01-15T00:00:04Z" {
+		t.Errorf("time range = [%s, %s]", b.MinTime, b.MaxTime)
+	}
+	if !ix.hasLevel(b, "warn") || !ix.hasLevel(b, "info") || ix.hasLevel(b, "error") {
+		t.Errorf("unexpected level set %v / %b", ix.Levels, b.Levels)
+	}
+}
+
+func TestCandidates_LevelFilterSkipsBlocks(t *testing.T) {
+	data := sampleLog(50)
+	ix := buildSample(t, data, 512)
+	blocks := ix.Candidates([]Predicate{{Field: "level", Op: "=", Value: "error"}})
+	if len(blocks) != 1 {
+		t.Fatalf("expected exactly one candidate block, got %d", len(blocks))
+	}
+	got, err := io.ReadAll(Reader(strings.NewReader(data), blocks))
+	if err != nil {
+		t.Fatalf("reading candidates: %v", err)
+	}
+	if !bytes.Contains(got, []byte(`"level":"error"`)) {
+		t.Errorf("candidate block does not contain the error entry: %s", got)
+	}
+}
+
+func TestCandidates_TimeFilters(t *testing.T) {
+	ix := buildSample(t, sampleLog(50), 512)
+	all := len(ix.Blocks)
+	tests := []struct {
+		pred Predicate
+		want func(n int) bool
+	}{
+		{Predicate{Field: "time", Op: ">=", Value: "2024-01-15T00:00:49Z"}, func(n int) bool { return n == 1 }},
+		{Predicate{Field: "time", Op: "<", Value: "2024-01-15T00:00:01Z"}, func(n int) bool { return n == 1 }},
+		{Predicate{Field: "time", Op: ">", Value: "2024-01-15T00:01:00Z"}, func(n int) bool { return n == 0 }},
+		{Predicate{Field: "ts", Op: "=", Value: "2024-01-15T00:00:10Z"}, func(n int) bool { return n == 1 }},
+		{Predicate{Field: "time", Op: "~", Value: "anything"}, func(n int) bool { return n == all }},
+	}
+	for _, tt := range tests {
+		if n := len(ix.Candidates([]Predicate{tt.pred})); !tt.want(n) {
+			t.Errorf("%+v: %d candidate blocks", tt.pred, n)
+		}
+	}
+}
+
+func TestCandidates_InstantFilters(t *testing.T) {
+	// Two blocks whose timestamps sort the other way round as text.
+	data := `{"time":"2024-01-15T11:00:00+02:00"}` + "\n" + `{"time":"2024-01-15T09:30:00+02:00"}` + "\n" +
+		`{"time":"2024-01-15T05:00:00-04:00"}` + "\n" + `{"time":"2024-01-15T06:00:00-04:00"}` + "\n"
+	ix := buildSample(t, data, 80)
+	if len(ix.Blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(ix.Blocks))
+	}
+	at := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	tests := []struct {
+		pred Predicate
+		want int64 // offset of the only candidate block
+	}{
+		{Predicate{Field: "time", Op: ">=", Value: "2024-01-15T09:30:00Z", Time: at("2024-01-15T09:30:00Z")}, ix.Blocks[1].Offset},
+		{Predicate{Field: "time", Op: "<", Value: "2024-01-15T09:30:00Z", Time: at("2024-01-15T09:30:00Z")}, ix.Blocks[0].Offset},
+	}
+	for _, tt := range tests {
+		got := ix.Candidates([]Predicate{tt.pred})
+		if len(got) != 1 || got[0].Offset != tt.want {
+			t.Errorf("%s%s: candidates %+v, want the block at %d", tt.pred.Op, tt.pred.Value, got, tt.want)
+		}
+	}
+}
+
+func TestCandidates_NaiveTimestampsKeepBlock(t *testing.T) {
+	ix := buildSample(t, `{"time":"2024-01-15 10:00:00"}`+"\n", DefaultBlockSize)
+	if !ix.Blocks[0].Naive {
+		t.Fatal("expected the block to be marked naive")
+	}
+	pred := Predicate{Field: "time", Op: ">", Value: "2024-01-16T00:00:00Z", Time: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)}
+	if len(ix.Candidates([]Predicate{pred})) != 1 {
+		t.Error("a block with naive timestamps must not be skipped")
+	}
+}
+
+func TestCandidates_UnknownFieldKeepsAllBlocks(t *testing.T) {
+	ix := buildSample(t, sampleLog(50), 512)
+	blocks := ix.Candidates([]Predicate{{Field: "msg", Op: "=", Value: "m3"}})
+	if len(blocks) != len(ix.Blocks) {
+		t.Errorf("got %d blocks, want all %d", len(blocks), len(ix.Blocks))
+	}
+}
+
+func TestCandidates_LevelOverflowNeverSkipped(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 70; i++ {
+		fmt.Fprintf(&b, `{"level":"l%d"}`+"\n", i)
+	}
+	ix := buildSample(t, b.String(), DefaultBlockSize)
+	if len(ix.Levels) != overflowBit {
+		t.Fatalf("dictionary size = %d, want %d", len(ix.Levels), overflowBit)
+	}
+	if len(ix.Candidates([]Predicate{{Field: "level", Op: "=", Value: "l69"}})) != 1 {
+		t.Error("a block with overflowed levels must not be skipped")
+	}
+}
+
+func TestWriteLoad_RoundTrip(t *testing.T) {
+	ix := buildSample(t, sampleLog(20), 256)
+	path := filepath.Join(t.TempDir(), "app.log"+Suffix)
+	if err := ix.Write(path); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got.Blocks) != len(ix.Blocks) || got.Entries != ix.Entries || got.Format != "json" {
+		t.Errorf("round trip mismatch: %+v", got)
+	}
+	if !got.ModTime.Equal(ix.ModTime) {
+		t.Errorf("ModTime = %v, want %v", got.ModTime, ix.ModTime)
+	}
+}
+
+func TestLoad_WrongVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x"+Suffix)
+	os.WriteFile(path, []byte(`{"version":999}`), 0o644)
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for unknown version")
+	}
+}
+
+func TestFresh(t *testing.T) {
+	mod := time.Unix(1700000000, 0)
+	ix := &Index{Size: 10, ModTime: mod}
+	if !ix.Fresh(fakeInfo{size: 10, modTime: mod}) {
+		t.Error("expected index to be fresh")
+	}
+	if ix.Fresh(fakeInfo{size: 11, modTime: mod}) {
+		t.Error("size change must make the index stale")
+	}
+	if ix.Fresh(fakeInfo{size: 10, modTime: mod.Add(time.Second)}) {
+		t.Error("modification must make the index stale")
+	}
+}
+
+func TestPath(t *testing.T) {
+	if got := Path("/var/log/app.log"); got != "/var/log/app.log.lpidx" {
+		t.Errorf("Path = %q", got)
+	}
+}
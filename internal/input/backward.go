@@ -0,0 +1,58 @@
+package input
+
+import (
+	"bytes"
+	"io"
+)
+
+// DefaultBlockSize is the size of the blocks a Backward reader reads when
+// it is given no other.
+const DefaultBlockSize = 256 * 1024
+
+// Backward reads a file from its end towards its start, in blocks of
+// whole lines, so that the last entries of a large file can be found
+// without parsing everything before them.
+type Backward struct {
+	r         io.ReaderAt
+	pos       int64 // the start of the block last returned
+	blockSize int
+}
+
+// NewBackward returns a Backward reader of the size bytes of r, reading
+// blocks of about blockSize bytes, or DefaultBlockSize when it is not
+// positive.
+func NewBackward(r io.ReaderAt, size int64, blockSize int) *Backward {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	return &Backward{r: r, pos: size, blockSize: blockSize}
+}
+
+// Next returns the block of whole lines that ends where the previously
+// returned block starts, together with the offset it starts at. Blocks
+// start at the beginning of a line; where no line starts within the block
+// size, a larger block is read instead. Once the start of the file has
+// been returned, Next returns io.EOF.
+func (b *Backward) Next() ([]byte, int64, error) {
+	if b.pos <= 0 {
+		return nil, 0, io.EOF
+	}
+	for size := int64(b.blockSize); ; size *= 2 {
+		start := max(0, b.pos-size)
+		block := make([]byte, b.pos-start)
+		if _, err := b.r.ReadAt(block, start); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		if start == 0 {
+			b.pos = 0
+			return block, 0, nil
+		}
+		// The bytes up to the first newline belong to a line that starts
+		// in the block before; the block ends with a newline or at the end
+		// of the file, so a newline in its last byte does not count.
+		if i := bytes.IndexByte(block[:len(block)-1], '\n'); i >= 0 {
+			b.pos = start + int64(i) + 1
+			return block[i+1:], b.pos, nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package input
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// backwardBlocks returns the blocks a Backward reader of s returns, last
+// first, checking that each starts at the offset reported and at the
+// start of a line, and that together they make up s.
+func backwardBlocks(t *testing.T, s string, blockSize int) []string {
+	t.Helper()
+	b := NewBackward(strings.NewReader(s), int64(len(s)), blockSize)
+	var blocks []string
+	for {
+		block, off, err := b.Next()
+		if err == io.EOF {
+			if joined := strings.Join(reversed(blocks), ""); joined != s {
+				t.Fatalf("blocks %q do not make up %q", blocks, s)
+			}
+			return blocks
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if s[off:off+int64(len(block))] != string(block) {
+			t.Fatalf("block %q does not start at offset %d", block, off)
+		}
+		if off > 0 && s[off-1] != '\n' {
+			t.Fatalf("block %q at offset %d does not start a line", block, off)
+		}
+		blocks = append(blocks, string(block))
+	}
+}
+
+func TestBackward_WholeLines(t *testing.T) {
+	for _, s := range []string{
+		"one\ntwo\nthree\nfour\nfive\n",
+		"one\ntwo\nthree\nfour\nfive",
+		"\n\nshort\n\n",
+	} {
+		if blocks := backwardBlocks(t, s, 8); len(blocks) < 2 {
+			t.Errorf("%q: read in %d block(s), want several", s, len(blocks))
+		}
+	}
+}
+
+func TestBackward_LineLongerThanBlock(t *testing.T) {
+	long := strings.Repeat("x", 50)
+	s := strings.Repeat("short\n", 20) + long + "\nlast\n"
+	blocks := backwardBlocks(t, s, 8)
+	if len(blocks) < 3 || blocks[0] != "last\n" || !strings.HasSuffix(blocks[1], "\n"+long+"\n") {
+		t.Errorf("blocks = %q, want the long line whole in the second", blocks)
+	}
+}
+
+func TestBackward_Empty(t *testing.T) {
+	if blocks := backwardBlocks(t, "", 8); len(blocks) != 0 {
+		t.Errorf("blocks = %q, want none", blocks)
+	}
+}
+
+// reversed returns a reversed copy of s.
+func reversed(s []string) []string {
+	r := make([]string, len(s))
+	for i, v := range s {
+		r[len(s)-1-i] = v
+	}
+	return r
+}
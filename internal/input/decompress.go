@@ -0,0 +1,128 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// magicLen is the length of the longest magic number Compression
+// recognizes.
+const magicLen = 4
+
+// Compression returns the name of the compression whose magic number
+// starts head, "gzip", "zstd" or "bzip2", or "" when head starts with none
+// of them.
+func Compression(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	case len(head) >= 4 && bytes.HasPrefix(head, []byte("BZh")) && head[3] >= '1' && head[3] <= '9':
+		return "bzip2"
+	}
+	return ""
+}
+
+// Decompress returns r itself, or when its contents are compressed with
+// gzip, zstd or bzip2, as rotated and archived logs often are, a reader of
+// the decompressed contents. The compression is recognized by the contents
+// rather than the file name. Closing the result closes r.
+func Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	var src io.Reader = r
+	var method string
+	if m, ok := r.(*MappedFile); ok {
+		if method = Compression(m.Bytes()); method == "" {
+			return r, nil
+		}
+	} else {
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(magicLen)
+		if method = Compression(head); method == "" {
+			return readCloser{br, r}, nil
+		}
+		src = br
+	}
+
+	switch method {
+	case "gzip":
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return decompressor{zr, closers{zr, r}}, nil
+	case "zstd":
+		zr, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return decompressor{zstdErrors{zr}, closers{zstdCloser{zr}, r}}, nil
+	default:
+		// The bzip2 package names itself in its errors.
+		return decompressor{bzip2.NewReader(src), r}, nil
+	}
+}
+
+// IsCompressed reports whether rc, a result of Decompress, is decompressing
+// its source rather than reading it as it is.
+func IsCompressed(rc io.ReadCloser) bool {
+	_, ok := rc.(decompressor)
+	return ok
+}
+
+// decompressor is the readCloser Decompress returns for compressed
+// contents.
+type decompressor readCloser
+
+// zstdErrors prefixes the errors of a zstd decoder, other than io.EOF,
+// with "zstd: ", as the gzip package does its own.
+type zstdErrors struct {
+	zr *zstd.Decoder
+}
+
+// Read implements io.Reader.
+func (z zstdErrors) Read(p []byte) (int, error) {
+	n, err := z.zr.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("zstd: %w", err)
+	}
+	return n, err
+}
+
+// zstdCloser releases the goroutines of a zstd decoder, whose Close
+// returns nothing.
+type zstdCloser struct {
+	zr *zstd.Decoder
+}
+
+// Close implements io.Closer.
+func (z zstdCloser) Close() error {
+	z.zr.Close()
+	return nil
+}
+
+// readCloser reads from one reader and closes another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closers closes each of its elements in turn, returning the first error.
+type closers []io.Closer
+
+// Close implements io.Closer.
+func (cs closers) Close() error {
+	var first error
+	for _, c := range cs {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,156 @@
+package input
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// gzipped returns s compressed with gzip.
+func gzipped(t *testing.T, s string) string {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// zstded returns s compressed with zstd.
+func zstded(t *testing.T, s string) string {
+	t.Helper()
+	var b bytes.Buffer
+	zw, err := zstd.NewWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// bzipped is `{"level":"info"}` and a newline compressed with bzip2, which
+// the standard library cannot write.
+var bzipped = string([]byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x37, 0xc4,
+	0x2b, 0xaa, 0x00, 0x00, 0x07, 0xd9, 0x80, 0x00, 0x10, 0x10, 0x00, 0x00,
+	0x10, 0x03, 0x25, 0x81, 0x0a, 0x20, 0x00, 0x22, 0x98, 0x01, 0xea, 0x10,
+	0x34, 0x0d, 0x02, 0x9c, 0xd9, 0x20, 0x6c, 0x40, 0x61, 0xf8, 0x5d, 0xc9,
+	0x14, 0xe1, 0x42, 0x40, 0xdf, 0x10, 0xae, 0xa8,
+})
+
+// readDecompressed opens path, decompresses it and returns its contents.
+func readDecompressed(t *testing.T, path string) string {
+	t.Helper()
+	rc, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	rc, err = Decompress(rc)
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return string(got)
+}
+
+func TestDecompress_Gzip(t *testing.T) {
+	const contents = `{"level":"info"}` + "\n"
+	path := writeTemp(t, "app.log.2.gz", gzipped(t, contents))
+	if got := readDecompressed(t, path); got != contents {
+		t.Errorf("contents = %q, want %q", got, contents)
+	}
+}
+
+func TestDecompress_Zstd(t *testing.T) {
+	const contents = `{"level":"info"}` + "\n"
+	path := writeTemp(t, "app.log.zst", zstded(t, contents))
+	if got := readDecompressed(t, path); got != contents {
+		t.Errorf("contents = %q, want %q", got, contents)
+	}
+}
+
+func TestDecompress_Bzip2(t *testing.T) {
+	const contents = `{"level":"info"}` + "\n"
+	path := writeTemp(t, "app.log.bz2", bzipped)
+	if got := readDecompressed(t, path); got != contents {
+		t.Errorf("contents = %q, want %q", got, contents)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		head string
+		want string
+	}{
+		{"\x1f\x8b\x08", "gzip"},
+		{"\x28\xb5\x2f\xfd", "zstd"},
+		{"BZh9", "bzip2"},
+		{"BZh0", ""},
+		{"BZh", ""},
+		{`{"level":"info"}`, ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Compression([]byte(tt.head)); got != tt.want {
+			t.Errorf("Compression(%q) = %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestDecompress_Plain_IsUnchanged(t *testing.T) {
+	const contents = `{"level":"info"}` + "\n"
+	path := writeTemp(t, "app.log.1", contents)
+	rc, _ := Open(path)
+	got, err := Decompress(rc)
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	defer got.Close()
+	if _, ok := rc.(*MappedFile); ok && got != rc {
+		t.Errorf("Decompress returned %T, want the mapped file itself", got)
+	}
+	if got := readDecompressed(t, path); got != contents {
+		t.Errorf("contents = %q, want %q", got, contents)
+	}
+}
+
+func TestDecompress_UnmappedFile(t *testing.T) {
+	const contents = `{"level":"info"}` + "\n"
+	for name, data := range map[string]string{
+		"app.log.gz":  gzipped(t, contents),
+		"app.log.zst": zstded(t, contents),
+		"app.log.bz2": bzipped,
+	} {
+		f, err := os.Open(writeTemp(t, name, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := Decompress(f)
+		if err != nil {
+			t.Fatalf("%s: Decompress: %v", name, err)
+		}
+		if got, _ := io.ReadAll(rc); string(got) != contents {
+			t.Errorf("%s: contents = %q, want %q", name, got, contents)
+		}
+		rc.Close()
+	}
+}
+
+func TestDecompress_Truncated_ReturnsError(t *testing.T) {
+	if _, err := Decompress(&MappedFile{data: []byte{0x1f, 0x8b, 8}}); err == nil {
+		t.Error("expected error for a truncated gzip header")
+	}
+}
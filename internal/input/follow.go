@@ -0,0 +1,100 @@
+package input
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is how often a Follower checks for appended data
+// once it has caught up with the end of the file.
+const DefaultPollInterval = 250 * time.Millisecond
+
+// Follower reads a file the way tail -f does: at end of file it waits for
+// more data to be appended instead of returning io.EOF. If the file shrinks
+// below the current read position, as it does when a log is truncated in
+// place by copytruncate-style rotation, reading restarts from the beginning.
+//
+// Read only returns io.EOF after Close has been called, so a parser reading
+// from a Follower runs until the Follower is closed.
+type Follower struct {
+	f        *os.File
+	off      int64
+	interval time.Duration
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Follow opens the named file for following. When fromStart is false,
+// reading begins at the current end of the file so that only entries
+// written from now on are seen. interval is the polling period; zero means
+// DefaultPollInterval.
+func Follow(name string, fromStart bool, interval time.Duration) (*Follower, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	var off int64
+	if !fromStart {
+		off, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &Follower{f: f, off: off, interval: interval, done: make(chan struct{})}, nil
+}
+
+// Read implements io.Reader. It blocks until data is available or the
+// Follower is closed.
+func (fl *Follower) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-fl.done:
+			return 0, io.EOF
+		default:
+		}
+
+		n, err := fl.f.Read(p)
+		fl.off += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			if errors.Is(err, os.ErrClosed) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+
+		// Caught up: restart after a truncation, otherwise wait for more.
+		if info, err := fl.f.Stat(); err == nil && info.Size() < fl.off {
+			if _, err := fl.f.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			fl.off = 0
+			continue
+		}
+		select {
+		case <-fl.done:
+			return 0, io.EOF
+		case <-time.After(fl.interval):
+		}
+	}
+}
+
+// Close stops following and closes the file. A Read blocked waiting for
+// data returns io.EOF.
+func (fl *Follower) Close() error {
+	var err error
+	fl.once.Do(func() {
+		close(fl.done)
+		err = fl.f.Close()
+	})
+	return err
+}
@@ -0,0 +1,119 @@
+package input
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// appendTo appends s to the file at path.
+func appendTo(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLine reads one line from br, failing the test if none arrives soon.
+func readLine(t *testing.T, br *bufio.Reader) string {
+	t.Helper()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := br.ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a line")
+		return ""
+	}
+}
+
+func TestFollow_FromStart_ReadsExistingThenAppended(t *testing.T) {
+	path := writeTemp(t, "app.log", "one\n")
+	fl, err := Follow(path, true, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	defer fl.Close()
+	br := bufio.NewReader(fl)
+
+	if got := readLine(t, br); got != "one\n" {
+		t.Errorf("first line = %q, want %q", got, "one\n")
+	}
+	appendTo(t, path, "two\n")
+	if got := readLine(t, br); got != "two\n" {
+		t.Errorf("second line = %q, want %q", got, "two\n")
+	}
+}
+
+func TestFollow_FromEnd_SkipsExisting(t *testing.T) {
+	path := writeTemp(t, "app.log", "old\n")
+	fl, err := Follow(path, false, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	defer fl.Close()
+	br := bufio.NewReader(fl)
+
+	appendTo(t, path, "new\n")
+	if got := readLine(t, br); got != "new\n" {
+		t.Errorf("line = %q, want %q", got, "new\n")
+	}
+}
+
+func TestFollow_Truncation_RestartsFromBeginning(t *testing.T) {
+	path := writeTemp(t, "app.log", "a long first line\n")
+	fl, err := Follow(path, true, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	defer fl.Close()
+	br := bufio.NewReader(fl)
+	readLine(t, br)
+
+	if err := os.WriteFile(path, []byte("short\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLine(t, br); got != "short\n" {
+		t.Errorf("line after truncation = %q, want %q", got, "short\n")
+	}
+}
+
+func TestFollow_Close_UnblocksRead(t *testing.T) {
+	path := writeTemp(t, "app.log", "")
+	fl, err := Follow(path, true, time.Hour)
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := fl.Read(make([]byte, 16))
+		errs <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	fl.Close()
+	select {
+	case err := <-errs:
+		if err != io.EOF {
+			t.Errorf("Read after Close = %v, want io.EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read did not return after Close")
+	}
+}
+
+func TestFollow_MissingFile(t *testing.T) {
+	if _, err := Follow("/nonexistent/app.log", true, 0); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,95 @@
+// Package input opens log sources for reading. Regular files are
+// memory-mapped where the platform supports it so that parsers can split
+// lines directly out of the mapping instead of copying them through a
+// buffered scanner; pipes, devices, empty files and anything else that
+// cannot be mapped fall back to ordinary reads.
+package input
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// MappedFile is a read-only view of a memory-mapped regular file. It
+// implements io.Reader so it can be passed anywhere a plain file can, and
+// exposes the mapping itself through Bytes for consumers that can work on
+// the whole buffer at once.
+type MappedFile struct {
+	data []byte
+	off  int
+}
+
+// Bytes returns the unread portion of the mapping. The slice aliases the
+// mapped memory and must not be modified or retained after Close.
+func (m *MappedFile) Bytes() []byte {
+	return m.data[m.off:]
+}
+
+// Read implements io.Reader by copying from the mapping.
+func (m *MappedFile) Read(p []byte) (int, error) {
+	if m.off >= len(m.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[m.off:])
+	m.off += n
+	return n, nil
+}
+
+// ReadAt implements io.ReaderAt by copying from the mapping at off.
+func (m *MappedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("input: negative offset %d", off)
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close unmaps the file. Any slice previously returned by Bytes becomes
+// invalid.
+func (m *MappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := munmap(m.data)
+	m.data = nil
+	m.off = 0
+	return err
+}
+
+// Open opens the named file for reading. When name refers to a non-empty
+// regular file and mapping succeeds, the result is a *MappedFile; otherwise
+// it is the *os.File itself. Callers must Close the result when done.
+//
+// A mapped file must not be truncated while it is being read: on most
+// platforms touching a page beyond the new end of file raises SIGBUS.
+func Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat %s: %w", name, err)
+	}
+	if !info.Mode().IsRegular() || info.Size() == 0 || info.Size() > math.MaxInt {
+		return f, nil
+	}
+
+	data, err := mmap(f, int(info.Size()))
+	if err != nil {
+		// Mapping is an optimisation only; read the file normally instead.
+		return f, nil
+	}
+	// The mapping stays valid after the descriptor is closed.
+	f.Close()
+	return &MappedFile{data: data}, nil
+}
@@ -0,0 +1,122 @@
+package input
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// writeTemp creates a file named name in a fresh temporary directory with
+// the given contents and returns its path.
+func writeTemp(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+	return path
+}
+
+func TestOpen_RegularFile_IsMapped(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("memory mapping not supported on " + runtime.GOOS)
+	}
+	path := writeTemp(t, "app.log", "line one\nline two\n")
+	rc, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+
+	m, ok := rc.(*MappedFile)
+	if !ok {
+		t.Fatalf("Open returned %T, want *MappedFile", rc)
+	}
+	if got := string(m.Bytes()); got != "line one\nline two\n" {
+		t.Errorf("Bytes() = %q", got)
+	}
+}
+
+func TestOpen_EmptyFile_FallsBackToOSFile(t *testing.T) {
+	path := writeTemp(t, "empty.log", "")
+	rc, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	if _, ok := rc.(*os.File); !ok {
+		t.Errorf("Open returned %T, want *os.File", rc)
+	}
+}
+
+func TestOpen_Pipe_FallsBackToOSFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes not available")
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+
+	path := "/dev/fd/" + strconv.Itoa(int(pr.Fd()))
+	if _, err := os.Stat(path); err != nil {
+		t.Skip("/dev/fd not available")
+	}
+	rc, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	if _, ok := rc.(*MappedFile); ok {
+		t.Error("a pipe must not be memory-mapped")
+	}
+}
+
+func TestOpen_MissingFile_ReturnsError(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "nope.log")); err == nil {
+		t.Error("expected error for missing file, got nil")
+	}
+}
+
+func TestOpen_ReadReturnsFullContents(t *testing.T) {
+	const contents = `{"level":"info"}` + "\n" + `{"level":"error"}` + "\n"
+	path := writeTemp(t, "app.log", contents)
+	rc, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != contents {
+		t.Errorf("ReadAll = %q, want %q", got, contents)
+	}
+}
+
+func TestMappedFile_ReadAdvancesBytes(t *testing.T) {
+	m := &MappedFile{data: []byte("abcdef")}
+	buf := make([]byte, 2)
+	if _, err := m.Read(buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if got := string(m.Bytes()); got != "cdef" {
+		t.Errorf("Bytes() after reading 2 bytes = %q, want %q", got, "cdef")
+	}
+}
+
+func TestMappedFile_ReadAtEnd_ReturnsEOF(t *testing.T) {
+	m := &MappedFile{data: []byte("x")}
+	buf := make([]byte, 4)
+	m.Read(buf)
+	if _, err := m.Read(buf); err != io.EOF {
+		t.Errorf("Read at end: err = %v, want io.EOF", err)
+	}
+}
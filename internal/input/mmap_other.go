@@ -0,0 +1,18 @@
+//go:build !unix
+
+package input
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is not implemented on this platform; Open falls back to plain reads.
+func mmap(_ *os.File, _ int) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// munmap is never reached because mmap always fails.
+func munmap(_ []byte) error {
+	return nil
+}
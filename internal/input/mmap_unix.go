@@ -0,0 +1,18 @@
+//go:build unix
+
+package input
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of f read-only into memory.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap releases a mapping created by mmap.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
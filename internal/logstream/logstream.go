@@ -0,0 +1,250 @@
+// Package logstream receives log records that applications and sidecars
+// push to logpipe over gRPC, with the client-streaming Push method of the
+// logpipe.v1.LogStream service described in logstream.proto. It serves
+// gRPC over HTTP/2 without TLS, and does not support compressed messages.
+package logstream
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// DefaultPort is the port a Server listens on when none is given, the one
+// gRPC examples conventionally use.
+const DefaultPort = "50051"
+
+// PushPath is the HTTP/2 path of the Push method.
+const PushPath = "/logpipe.v1.LogStream/Push"
+
+// DefaultMaxMessageSize is the largest record a Server accepts when
+// MaxMessageSize is zero.
+const DefaultMaxMessageSize = 4 << 20
+
+// gRPC status codes used in responses.
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeUnavailable       = 14
+)
+
+// Server receives records on a TCP listener.
+type Server struct {
+	ln net.Listener
+	// MaxMessageSize bounds the size of a single record; a stream that
+	// sends a larger one is ended with an error. Zero means
+	// DefaultMaxMessageSize.
+	MaxMessageSize int
+}
+
+// Listen returns a Server listening on the TCP address addr. A missing
+// port means DefaultPort.
+func Listen(addr string) (*Server, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{ln: ln}, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Receive serves Push streams until ctx is done and sends each record they
+// carry on the entries channel, as an entry with the record's fields.
+// Problems with a stream, which is then ended with an error status, are
+// sent on the error channel. When ctx is done the listener and every
+// connection are closed, and both channels are closed once the streams
+// have been served. The entries are owned by the receiver, as a parser's
+// are.
+func (s *Server) Receive(ctx context.Context) (<-chan *parser.LogEntry, <-chan error) {
+	entries := make(chan *parser.LogEntry, 64)
+	errs := make(chan error, 16)
+
+	send := func(e *parser.LogEntry) bool {
+		select {
+		case entries <- e:
+			return true
+		case <-ctx.Done():
+			parser.Release(e)
+			return false
+		}
+	}
+	report := func(err error) {
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case errs <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	var streams sync.WaitGroup
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Protocols: protocols,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			streams.Add(1)
+			defer streams.Done()
+			if err := s.push(w, r, send); err != nil {
+				report(fmt.Errorf("gRPC stream from %s: %w", r.RemoteAddr, err))
+			}
+		}),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	stop := context.AfterFunc(ctx, func() { srv.Close() })
+
+	go func() {
+		defer func() {
+			stop()
+			srv.Close()
+			streams.Wait()
+			close(entries)
+			close(errs)
+		}()
+		if err := srv.Serve(s.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			report(fmt.Errorf("serving gRPC: %w", err))
+		}
+	}()
+	return entries, errs
+}
+
+// maxMessageSize returns the effective message size limit.
+func (s *Server) maxMessageSize() int {
+	if s.MaxMessageSize > 0 {
+		return s.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
+}
+
+// statusError is a failed stream's gRPC status.
+type statusError struct {
+	code int
+	msg  string
+}
+
+// Error returns the status message.
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// push serves one request: a Push stream, whose records it passes to send,
+// or anything else, which it answers with an error status. It returns the
+// error the stream ended with, if the client is to blame.
+func (s *Server) push(w http.ResponseWriter, r *http.Request, send func(*parser.LogEntry) bool) error {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if r.ProtoMajor != 2 || r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "logpipe serves gRPC over HTTP/2", http.StatusUnsupportedMediaType)
+		return nil
+	}
+	if r.URL.Path != PushPath {
+		finish(w, &statusError{codeUnimplemented, "unknown method " + r.URL.Path})
+		return nil
+	}
+	if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+		finish(w, &statusError{codeUnimplemented, "compression is not supported"})
+		return nil
+	}
+
+	accepted, err := s.records(r.Body, send)
+	if err != nil {
+		finish(w, err)
+		if err.code == codeUnavailable {
+			return nil
+		}
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(frame(encodeResponse(accepted)))
+	finish(w, nil)
+	return nil
+}
+
+// records reads length-prefixed records from body until it ends, passing
+// each to send, and returns how many there were.
+func (s *Server) records(body io.Reader, send func(*parser.LogEntry) bool) (uint64, *statusError) {
+	var accepted uint64
+	var head [5]byte
+	for {
+		if _, err := io.ReadFull(body, head[:]); err != nil {
+			if err == io.EOF {
+				return accepted, nil
+			}
+			return accepted, &statusError{codeInvalidArgument, "reading record: " + err.Error()}
+		}
+		if head[0] != 0 {
+			return accepted, &statusError{codeUnimplemented, "compression is not supported"}
+		}
+		n := binary.BigEndian.Uint32(head[1:])
+		if int64(n) > int64(s.maxMessageSize()) {
+			return accepted, &statusError{codeResourceExhausted, fmt.Sprintf("record %d is %d bytes, over the limit of %d", accepted+1, n, s.maxMessageSize())}
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(body, data); err != nil {
+			return accepted, &statusError{codeInvalidArgument, "reading record: " + err.Error()}
+		}
+		entry, err := decodeRecord(data)
+		if err != nil {
+			return accepted, &statusError{codeInvalidArgument, fmt.Sprintf("record %d: %v", accepted+1, err)}
+		}
+		if !send(entry) {
+			return accepted, &statusError{codeUnavailable, "logpipe is shutting down"}
+		}
+		accepted++
+	}
+}
+
+// frame returns msg with the gRPC length prefix of an uncompressed
+// message.
+func frame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// finish sets the trailers that end a stream with err's status, or OK when
+// err is nil.
+func finish(w http.ResponseWriter, err *statusError) {
+	code, msg := codeOK, ""
+	if err != nil {
+		code, msg = err.code, err.msg
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", percentEncode(msg))
+	}
+}
+
+// percentEncode encodes msg for the Grpc-Message trailer, which allows
+// printable ASCII other than '%' as it is.
+func percentEncode(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
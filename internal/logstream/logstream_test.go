@@ -0,0 +1,227 @@
+package logstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+// field appends a protocol buffer field with the given number and value: a
+// varint for an int64, and length-delimited bytes for a string or []byte.
+func field(b []byte, n int, v any) []byte {
+	switch v := v.(type) {
+	case int64:
+		b = binary.AppendUvarint(b, uint64(n<<3|wireVarint))
+		return binary.AppendUvarint(b, uint64(v))
+	case string:
+		return field(b, n, []byte(v))
+	case []byte:
+		b = binary.AppendUvarint(b, uint64(n<<3|wireBytes))
+		b = binary.AppendUvarint(b, uint64(len(v)))
+		return append(b, v...)
+	}
+	panic("unsupported field value")
+}
+
+// attribute returns an encoded attributes map entry.
+func attribute(k, v string) []byte {
+	return field(field(nil, 1, k), 2, v)
+}
+
+// serve starts a server and returns its address and what it receives.
+func serve(t *testing.T) (*Server, <-chan *parser.LogEntry, <-chan error) {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errs := s.Receive(ctx)
+	t.Cleanup(func() {
+		cancel()
+		for range entries {
+		}
+	})
+	return s, entries, errs
+}
+
+// push sends records to s's Push method and returns the response.
+func push(t *testing.T, s *Server, path string, records ...[]byte) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	for _, r := range records {
+		body.Write(frame(r))
+	}
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}, Timeout: 5 * time.Second}
+	req, err := http.NewRequest(http.MethodPost, "http://"+s.Addr().String()+path, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// status reads the rest of resp and returns its body and grpc-status,
+// which may come in the headers or the trailers.
+func status(t *testing.T, resp *http.Response) ([]byte, string) {
+	t.Helper()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := resp.Header.Get("Grpc-Status"); s != "" {
+		return data, s
+	}
+	return data, resp.Trailer.Get("Grpc-Status")
+}
+
+// =============================================================================
+// decodeRecord
+// =============================================================================
+
+func TestDecodeRecord(t *testing.T) {
+	at := time.Date(2024, 1, 15, 10, 0, 0, 250000000, time.UTC)
+	var rec []byte
+	rec = field(rec, 1, at.UnixNano())
+	rec = field(rec, 2, "error")
+	rec = field(rec, 3, "payment declined")
+	rec = field(rec, 4, attribute("service", "pay"))
+	rec = field(rec, 5, `{"amount":12.5,"user":{"id":7}}`)
+	rec = field(rec, 9, "an unknown field, skipped")
+	entry, err := decodeRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(entry)
+	want := `{"time":"2024-01-15T10:00:00.25Z","level":"error","msg":"payment declined","amount":12.5,"user":{"id":7},"service":"pay"}`
+	if string(data) != want {
+		t.Errorf("entry = %s, want %s", data, want)
+	}
+}
+
+func TestDecodeRecord_Errors(t *testing.T) {
+	for name, rec := range map[string][]byte{
+		"truncated":  field(nil, 3, "message")[:4],
+		"wrong type": field(nil, 2, int64(3)),
+		"bad json":   field(nil, 5, "{"),
+	} {
+		if _, err := decodeRecord(rec); err == nil {
+			t.Errorf("%s: decodeRecord succeeded, want an error", name)
+		}
+	}
+}
+
+// =============================================================================
+// Server
+// =============================================================================
+
+func TestServer_Push(t *testing.T) {
+	s, entries, _ := serve(t)
+	resp := push(t, s, PushPath,
+		field(field(nil, 2, "info"), 3, "one"),
+		field(nil, 3, "two"),
+	)
+	body, code := status(t, resp)
+	if code != "0" {
+		t.Fatalf("grpc-status = %q, want 0", code)
+	}
+	if want := frame(encodeResponse(2)); !bytes.Equal(body, want) {
+		t.Errorf("response = %x, want %x", body, want)
+	}
+	for _, want := range []string{"one", "two"} {
+		select {
+		case e := <-entries:
+			if e.Fields["msg"] != want {
+				t.Errorf("entry = %v, want msg %q", e, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an entry")
+		}
+	}
+}
+
+func TestServer_MalformedRecord_Reported(t *testing.T) {
+	s, _, errs := serve(t)
+	resp := push(t, s, PushPath, field(nil, 5, "not json"))
+	if _, code := status(t, resp); code != "3" {
+		t.Errorf("grpc-status = %q, want 3 (invalid argument)", code)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("got a nil error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the error")
+	}
+}
+
+func TestServer_UnknownMethod(t *testing.T) {
+	s, _, _ := serve(t)
+	resp := push(t, s, "/logpipe.v1.LogStream/Pull")
+	if _, code := status(t, resp); code != "12" {
+		t.Errorf("grpc-status = %q, want 12 (unimplemented)", code)
+	}
+}
+
+func TestServer_MaxMessageSize(t *testing.T) {
+	s, _, _ := serve(t)
+	s.MaxMessageSize = 8
+	resp := push(t, s, PushPath, field(nil, 3, "a message over eight bytes"))
+	if _, code := status(t, resp); code != "8" {
+		t.Errorf("grpc-status = %q, want 8 (resource exhausted)", code)
+	}
+}
+
+func TestServer_Cancel_ClosesChannels(t *testing.T) {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errs := s.Receive(ctx)
+	cancel()
+	select {
+	case _, ok := <-entries:
+		if ok {
+			t.Error("received an entry after cancelling")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("entries not closed after cancelling")
+	}
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("errors not closed after cancelling")
+	}
+}
+
+func TestListen_DefaultPort(t *testing.T) {
+	s, err := Listen("127.0.0.1")
+	if err != nil {
+		t.Skipf("port %s unavailable: %v", DefaultPort, err)
+	}
+	defer s.ln.Close()
+	if got := s.Addr().String(); got != "127.0.0.1:"+DefaultPort {
+		t.Errorf("Addr = %s, want port %s", got, DefaultPort)
+	}
+}
@@ -0,0 +1,231 @@
+package logstream
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// Protocol buffer wire types, from the encoding's specification.
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+// errTruncated reports a message that ends inside a field.
+var errTruncated = errors.New("truncated message")
+
+// protoReader reads the fields of an encoded protocol buffer message.
+type protoReader struct {
+	data []byte
+}
+
+// next returns the number and wire type of the next field, and reports
+// false at the end of the message.
+func (r *protoReader) next() (field int, wire int, ok bool, err error) {
+	if len(r.data) == 0 {
+		return 0, 0, false, nil
+	}
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if key>>3 == 0 {
+		return 0, 0, false, fmt.Errorf("invalid field number 0")
+	}
+	return int(key >> 3), int(key & 7), true, nil
+}
+
+// varint reads a base-128 varint.
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+// bytes reads a length-delimited field's contents.
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)) {
+		return nil, errTruncated
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+// skip skips a field of the wire type wire, so that fields added to the
+// message later are ignored.
+func (r *protoReader) skip(wire int) error {
+	var n int
+	switch wire {
+	case wireVarint:
+		_, err := r.varint()
+		return err
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case wire64:
+		n = 8
+	case wire32:
+		n = 4
+	default:
+		return fmt.Errorf("unsupported wire type %d", wire)
+	}
+	if len(r.data) < n {
+		return errTruncated
+	}
+	r.data = r.data[n:]
+	return nil
+}
+
+// expect reports an error unless a field has the wire type want.
+func expect(field, wire, want int) error {
+	if wire != want {
+		return fmt.Errorf("field %d has wire type %d, want %d", field, wire, want)
+	}
+	return nil
+}
+
+// decodeRecord decodes an encoded LogRecord into an entry with the fields
+// time (RFC 3339), level and msg first, then those of the JSON object, then
+// the attributes. A field that appears twice keeps its last value.
+func decodeRecord(data []byte) (*parser.LogEntry, error) {
+	var (
+		nanos          int64
+		level, message string
+		attrs          [][2]string
+		obj            []byte
+	)
+	r := &protoReader{data: data}
+	for {
+		field, wire, ok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			if err := expect(field, wire, wireVarint); err != nil {
+				return nil, err
+			}
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			nanos = int64(v)
+		case 2, 3, 5:
+			if err := expect(field, wire, wireBytes); err != nil {
+				return nil, err
+			}
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			switch field {
+			case 2:
+				level = string(b)
+			case 3:
+				message = string(b)
+			default:
+				obj = b
+			}
+		case 4:
+			if err := expect(field, wire, wireBytes); err != nil {
+				return nil, err
+			}
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			kv, err := decodeMapEntry(b)
+			if err != nil {
+				return nil, fmt.Errorf("attributes: %w", err)
+			}
+			attrs = append(attrs, kv)
+		default:
+			if err := r.skip(wire); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	entry := parser.NewOrderedEntry()
+	if nanos != 0 {
+		entry.Set("time", time.Unix(0, nanos).UTC().Format(time.RFC3339Nano))
+	}
+	if level != "" {
+		entry.Set("level", level)
+	}
+	if message != "" {
+		entry.Set("msg", message)
+	}
+	if len(obj) > 0 {
+		var fields *parser.LogEntry
+		if err := json.Unmarshal(obj, &fields); err != nil {
+			parser.Release(entry)
+			return nil, fmt.Errorf("json: %w", err)
+		}
+		for _, k := range fields.Keys() {
+			entry.Set(k, fields.Fields[k])
+		}
+		parser.Release(fields)
+	}
+	for _, kv := range attrs {
+		entry.Set(kv[0], kv[1])
+	}
+	return entry, nil
+}
+
+// decodeMapEntry decodes an entry of a map<string, string> field: its key
+// in field 1 and its value in field 2.
+func decodeMapEntry(data []byte) ([2]string, error) {
+	var kv [2]string
+	r := &protoReader{data: data}
+	for {
+		field, wire, ok, err := r.next()
+		if err != nil {
+			return kv, err
+		}
+		if !ok {
+			return kv, nil
+		}
+		if field != 1 && field != 2 {
+			if err := r.skip(wire); err != nil {
+				return kv, err
+			}
+			continue
+		}
+		if err := expect(field, wire, wireBytes); err != nil {
+			return kv, err
+		}
+		b, err := r.bytes()
+		if err != nil {
+			return kv, err
+		}
+		kv[field-1] = string(b)
+	}
+}
+
+// encodeResponse encodes a PushResponse with the given count.
+func encodeResponse(accepted uint64) []byte {
+	if accepted == 0 {
+		return nil
+	}
+	b := []byte{1<<3 | wireVarint}
+	return binary.AppendUvarint(b, accepted)
+}
@@ -0,0 +1,193 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// =============================================================================
+// Infer
+// =============================================================================
+
+func TestInfer(t *testing.T) {
+	s := Infer([]map[string]any{
+		{"level": "info", "status": json.Number("200"), "ok": true, "latency": 1.5, "meta": map[string]any{"host": "a"}},
+		{"level": "error", "status": float64(500), "latency": json.Number("2"), "mixed": "x", "none": nil},
+		{"mixed": json.Number("1")},
+	})
+	want := []column{
+		{"latency", kindDouble},
+		{"level", kindString},
+		{"meta", kindString},
+		{"mixed", kindString},
+		{"ok", kindBoolean},
+		{"status", kindLong},
+	}
+	if !reflect.DeepEqual(s.columns, want) {
+		t.Errorf("columns = %+v, want %+v", s.columns, want)
+	}
+	if got := strings.Join(s.Fields(), ","); got != "latency,level,meta,mixed,ok,status" {
+		t.Errorf("Fields() = %s", got)
+	}
+}
+
+// =============================================================================
+// Writer
+// =============================================================================
+
+// thriftReader decodes the compact protocol just far enough to read the
+// integer fields of a struct, skipping everything else.
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	n, size := binary.Uvarint(r.b[r.pos:])
+	r.pos += size
+	return n
+}
+
+func (r *thriftReader) varint() int64 {
+	n := r.uvarint()
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+// skip skips a value of type typ.
+func (r *thriftReader) skip(typ byte) {
+	switch typ {
+	case tBoolTrue, tBoolFalse:
+	case 3:
+		r.pos++
+	case 4, tI32, tI64:
+		r.varint()
+	case 7:
+		r.pos += 8
+	case tBinary:
+		n := r.uvarint()
+		r.pos += int(n)
+	case tList, 10:
+		h := r.b[r.pos]
+		r.pos++
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		for range n {
+			r.skip(h & 0x0f)
+		}
+	case tStruct:
+		r.object()
+	}
+}
+
+// object reads a struct, returning its integer fields by id.
+func (r *thriftReader) object() map[int16]int64 {
+	ints := map[int16]int64{}
+	var id int16
+	for {
+		h := r.b[r.pos]
+		r.pos++
+		if h == 0 {
+			return ints
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		switch typ := h & 0x0f; typ {
+		case tI32, tI64:
+			ints[id] = r.varint()
+		default:
+			r.skip(typ)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	recs := []map[string]any{
+		{"level": "info", "n": json.Number("3"), "ok": true},
+		{"level": "error", "ok": false},
+		{"n": float64(-4), "ok": true, "extra": "not in the schema"},
+	}
+	s := &Schema{columns: []column{{"level", kindString}, {"n", kindLong}, {"ok", kindBoolean}}}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range recs {
+		if err := w.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, []byte(magic)) || !bytes.HasSuffix(file, []byte(magic)) {
+		t.Fatalf("file does not start and end with %s", magic)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := &thriftReader{b: file[len(file)-8-footerLen : len(file)-8]}
+	if meta := footer.object(); meta[1] != 1 || meta[3] != 3 {
+		t.Errorf("footer version %d, rows %d, want 1 and 3", meta[1], meta[3])
+	}
+
+	// Each column is a page header followed by its compressed levels and
+	// values.
+	want := [][]byte{
+		append([]byte{4, 0, 0, 0, 4, 1, 2, 0}, "\x04\x00\x00\x00info\x05\x00\x00\x00error"...),
+		append([]byte{6, 0, 0, 0, 2, 1, 2, 0, 2, 1}, "\x03\x00\x00\x00\x00\x00\x00\x00\xfc\xff\xff\xff\xff\xff\xff\xff"...),
+		{2, 0, 0, 0, 6, 1, 0b101},
+	}
+	r := &thriftReader{b: file, pos: len(magic)}
+	for i, page := range want {
+		h := r.object()
+		if h[1] != pageData || h[2] != int64(len(page)) {
+			t.Fatalf("column %d: page type %d of %d bytes, want a data page of %d", i, h[1], h[2], len(page))
+		}
+		got, err := snappy.Decode(nil, file[r.pos:r.pos+int(h[3])])
+		if err != nil {
+			t.Fatalf("column %d: %v", i, err)
+		}
+		if !bytes.Equal(got, page) {
+			t.Errorf("column %d: page = %q, want %q", i, got, page)
+		}
+		r.pos += int(h[3])
+	}
+}
+
+func TestWriter_Append_Mismatch(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, &Schema{columns: []column{{"n", kindLong}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Append(map[string]any{"n": "many"})
+	if err == nil || err.Error() != `field n: cannot write "many" as int64` {
+		t.Errorf("Append error = %v", err)
+	}
+	if w.rows != 0 {
+		t.Error("a row that failed was added")
+	}
+}
+
+func TestWidenStatistics(t *testing.T) {
+	long := func(n int64) []byte { return binary.LittleEndian.AppendUint64(nil, uint64(n)) }
+	var lo, hi []byte
+	for _, n := range []int64{3, -5, 10, 0} {
+		lo, hi = widen(lo, hi, long(n), kindLong)
+	}
+	if !bytes.Equal(lo, long(-5)) || !bytes.Equal(hi, long(10)) {
+		t.Errorf("min %v, max %v, want -5 and 10", lo, hi)
+	}
+}
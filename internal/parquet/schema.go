@@ -0,0 +1,154 @@
+// Package parquet writes log entries as Parquet files, the columnar format
+// that DuckDB, Spark, pandas and most query engines read directly. It
+// implements the parts of the specification a flat log record needs:
+//
+//   - optional columns of the boolean, int64, double and UTF-8 string
+//     types, with each column's type inferred from the entries
+//   - the PLAIN encoding, with definition levels for missing values
+//   - the SNAPPY codec, and row groups of up to RowGroupSize rows
+//   - min, max and null count statistics for each column chunk, so that
+//     readers can skip row groups a query rules out
+//
+// Nested types and repeated columns are not supported: objects and arrays
+// are written as JSON strings.
+package parquet
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// kind is the type of a column.
+type kind int
+
+const (
+	kindBoolean kind = iota
+	kindLong
+	kindDouble
+	kindString
+)
+
+// Parquet's physical types, as they are numbered in the footer.
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+)
+
+// physical returns the physical type that columns of kind k are stored as.
+func (k kind) physical() int32 {
+	switch k {
+	case kindBoolean:
+		return typeBoolean
+	case kindLong:
+		return typeInt64
+	case kindDouble:
+		return typeDouble
+	}
+	return typeByteArray
+}
+
+// String returns the name of k as Parquet's logical types have it.
+func (k kind) String() string {
+	switch k {
+	case kindBoolean:
+		return "boolean"
+	case kindLong:
+		return "int64"
+	case kindDouble:
+		return "double"
+	}
+	return "string"
+}
+
+// column is a column of a schema, holding the values of an entry key.
+type column struct {
+	name string
+	kind kind
+}
+
+// Schema is the flat list of optional columns entries are written with.
+type Schema struct {
+	columns []column
+}
+
+// Fields returns the names of the schema's columns, in order.
+func (s *Schema) Fields() []string {
+	names := make([]string, len(s.columns))
+	for i, c := range s.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// Infer returns a schema for records with a column for every key any of
+// them has, in alphabetical order and named after the key. Each column is
+// optional, for records without the key, and of the narrowest type that
+// holds every value of it: boolean, int64, double or string. Keys that
+// hold values of different types, or objects and arrays, become strings.
+func Infer(records []map[string]any) *Schema {
+	kinds := map[string]kind{}
+	for _, rec := range records {
+		for k, v := range rec {
+			got, ok := valueKind(v)
+			if !ok {
+				continue
+			}
+			prev, seen := kinds[k]
+			switch {
+			case !seen || prev == got:
+				kinds[k] = got
+			case (prev == kindLong && got == kindDouble) || (prev == kindDouble && got == kindLong):
+				kinds[k] = kindDouble
+			default:
+				kinds[k] = kindString
+			}
+		}
+	}
+	s := &Schema{columns: make([]column, 0, len(kinds))}
+	for k, kd := range kinds {
+		s.columns = append(s.columns, column{name: k, kind: kd})
+	}
+	sort.Slice(s.columns, func(i, j int) bool { return s.columns[i].name < s.columns[j].name })
+	return s
+}
+
+// valueKind returns the type Infer gives v, or false for nil.
+func valueKind(v any) (kind, bool) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false
+	case bool:
+		return kindBoolean, true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		return kindLong, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return kindDouble, true
+		}
+		return kindLong, true
+	case float32:
+		return floatKind(float64(v)), true
+	case float64:
+		return floatKind(v), true
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return kindLong, true
+		}
+		if _, err := v.Float64(); err == nil {
+			return kindDouble, true
+		}
+	}
+	return kindString, true
+}
+
+// floatKind returns int64 for floats that hold an integer, as every JSON
+// number does when decoded with -numbers float, and double otherwise.
+func floatKind(f float64) kind {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return kindLong
+	}
+	return kindDouble
+}
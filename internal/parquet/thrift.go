@@ -0,0 +1,102 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol type codes, as they appear in field and list
+// headers.
+const (
+	tBoolTrue  = 1
+	tBoolFalse = 2
+	tI32       = 5
+	tI64       = 6
+	tBinary    = 8
+	tList      = 9
+	tStruct    = 12
+)
+
+// compact encodes Thrift structs with the compact protocol, in which
+// Parquet's page headers and footer are written. Fields must be written in
+// increasing order of their ids within each struct.
+type compact struct {
+	b    []byte
+	last []int16 // id of the last field written in each open struct
+}
+
+// begin opens a struct, after its field header or as a list element.
+func (c *compact) begin() {
+	c.last = append(c.last, 0)
+}
+
+// end closes the innermost struct with a stop field.
+func (c *compact) end() {
+	c.b = append(c.b, 0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+// field writes the header of field id, of type typ, of the open struct.
+func (c *compact) field(id int16, typ byte) {
+	last := &c.last[len(c.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.b = append(c.b, byte(delta)<<4|typ)
+	} else {
+		c.b = append(c.b, typ)
+		c.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes n zigzag-encoded, as integers of every size are.
+func (c *compact) varint(n int64) {
+	c.b = binary.AppendUvarint(c.b, uint64(n<<1^n>>63))
+}
+
+// i32 writes field id as a 32-bit integer, which enums are too.
+func (c *compact) i32(id int16, n int32) {
+	c.field(id, tI32)
+	c.varint(int64(n))
+}
+
+// i64 writes field id as a 64-bit integer.
+func (c *compact) i64(id int16, n int64) {
+	c.field(id, tI64)
+	c.varint(n)
+}
+
+// bool writes field id as a boolean, which the field header holds.
+func (c *compact) bool(id int16, v bool) {
+	if v {
+		c.field(id, tBoolTrue)
+	} else {
+		c.field(id, tBoolFalse)
+	}
+}
+
+// binary writes field id as a string or binary value.
+func (c *compact) binary(id int16, s []byte) {
+	c.field(id, tBinary)
+	c.bytes(s)
+}
+
+// bytes writes s as a list element or the value of a binary field.
+func (c *compact) bytes(s []byte) {
+	c.b = binary.AppendUvarint(c.b, uint64(len(s)))
+	c.b = append(c.b, s...)
+}
+
+// list writes the header of field id as a list of n elements of type typ,
+// which the caller writes next.
+func (c *compact) list(id int16, typ byte, n int) {
+	c.field(id, tList)
+	if n < 15 {
+		c.b = append(c.b, byte(n)<<4|typ)
+		return
+	}
+	c.b = append(c.b, 0xf0|typ)
+	c.b = binary.AppendUvarint(c.b, uint64(n))
+}
+
+// object writes the header of field id as a struct and opens it.
+func (c *compact) object(id int16) {
+	c.field(id, tStruct)
+	c.begin()
+}
@@ -0,0 +1,450 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// RowGroupSize is the most rows a Writer puts in one row group. Each
+// column of a row group is written as a single page.
+const RowGroupSize = 128 * 1024
+
+// magic starts and ends every Parquet file.
+const magic = "PAR1"
+
+// maxStatLen is the longest min or max value a column chunk's statistics
+// hold; the statistics of strings longer than that, such as messages,
+// leave both out rather than bloat the footer.
+const maxStatLen = 256
+
+// Values of the enums in page headers and column metadata.
+const (
+	pageData          = 0 // PageType DATA_PAGE
+	encodingPlain     = 0 // Encoding PLAIN
+	encodingRLE       = 3 // Encoding RLE
+	codecSnappy       = 1 // CompressionCodec SNAPPY
+	repetitionOpt     = 1 // FieldRepetitionType OPTIONAL
+	convertedUTF8     = 0 // ConvertedType UTF8
+	logicalTypeString = 1 // LogicalType STRING
+)
+
+// Writer writes records to a Parquet file.
+type Writer struct {
+	w      io.Writer
+	offset int64 // bytes written to w
+	schema *Schema
+	values [][]any // of each column, for the rows of the row group to come
+	rows   int     // in values
+	groups []rowGroup
+}
+
+// rowGroup describes a row group written, for the footer.
+type rowGroup struct {
+	rows   int
+	size   int64 // uncompressed size of its column chunks
+	chunks []chunk
+}
+
+// chunk describes a column chunk written, for the footer.
+type chunk struct {
+	offset                   int64 // of its page header
+	uncompressed, compressed int64 // sizes, the page header included
+	nulls                    int
+	min, max                 []byte // nil when the column has no values
+}
+
+// NewWriter writes the start of a file of records with schema s to w and
+// returns a Writer for them. Close writes the rest.
+func NewWriter(w io.Writer, s *Schema) (*Writer, error) {
+	pw := &Writer{w: w, schema: s, values: make([][]any, len(s.columns))}
+	if err := pw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// write writes b to the file.
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return err
+}
+
+// Append adds rec as a row, reading each column from the key of the same
+// name; keys without a column are left out. It writes a row group once
+// there are RowGroupSize rows. A value that does not fit its column's type
+// is an error, and the row is not added.
+func (w *Writer) Append(rec map[string]any) error {
+	row := make([]any, len(w.schema.columns))
+	for i, c := range w.schema.columns {
+		v, ok := rec[c.name]
+		if !ok || v == nil {
+			continue
+		}
+		if row[i], ok = convert(v, c.kind); !ok {
+			return fmt.Errorf("field %s: cannot write %s as %s", c.name, describe(v), c.kind)
+		}
+	}
+	for i, v := range row {
+		w.values[i] = append(w.values[i], v)
+	}
+	if w.rows++; w.rows == RowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes the rows appended since the last row group and the file's
+// footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.rows > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	footer := w.footer()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	return w.write(append(footer, magic...))
+}
+
+// flush writes the appended rows as a row group.
+func (w *Writer) flush() error {
+	g := rowGroup{rows: w.rows, chunks: make([]chunk, len(w.schema.columns))}
+	for i, c := range w.schema.columns {
+		ch, err := w.writeChunk(c.kind, w.values[i])
+		if err != nil {
+			return err
+		}
+		g.chunks[i] = ch
+		g.size += ch.uncompressed
+		w.values[i] = w.values[i][:0]
+	}
+	w.groups = append(w.groups, g)
+	w.rows = 0
+	return nil
+}
+
+// writeChunk writes values, each nil or of the Go type convert gives kind
+// k, as a column chunk of a single data page.
+func (w *Writer) writeChunk(k kind, values []any) (chunk, error) {
+	ch := chunk{offset: w.offset}
+	var levels, data bytes.Buffer
+	writeLevels(&levels, values)
+	var bits []bool
+	for _, v := range values {
+		if v == nil {
+			ch.nulls++
+			continue
+		}
+		var b []byte
+		switch v := v.(type) {
+		case bool:
+			bits = append(bits, v)
+			b = []byte{0}
+			if v {
+				b[0] = 1
+			}
+		case int64:
+			b = binary.LittleEndian.AppendUint64(nil, uint64(v))
+			data.Write(b)
+		case float64:
+			b = binary.LittleEndian.AppendUint64(nil, math.Float64bits(v))
+			data.Write(b)
+			if math.IsNaN(v) {
+				// NaN has no place in the order; leave it out of the
+				// statistics.
+				b = nil
+			}
+		case string:
+			data.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+			data.WriteString(v)
+			b = []byte(v)
+		}
+		ch.min, ch.max = widen(ch.min, ch.max, b, k)
+	}
+	if k == kindBoolean {
+		data.Write(packBits(bits))
+	}
+	if len(ch.min) > maxStatLen || len(ch.max) > maxStatLen {
+		ch.min, ch.max = nil, nil
+	}
+
+	page := binary.LittleEndian.AppendUint32(nil, uint32(levels.Len()))
+	page = append(page, levels.Bytes()...)
+	page = append(page, data.Bytes()...)
+	compressed := snappy.Encode(nil, page)
+
+	var c compact
+	c.begin()
+	c.i32(1, pageData)
+	c.i32(2, int32(len(page)))
+	c.i32(3, int32(len(compressed)))
+	c.object(5)
+	c.i32(1, int32(len(values)))
+	c.i32(2, encodingPlain)
+	c.i32(3, encodingRLE)
+	c.i32(4, encodingRLE)
+	c.end()
+	c.end()
+
+	ch.uncompressed = int64(len(c.b) + len(page))
+	ch.compressed = int64(len(c.b) + len(compressed))
+	if err := w.write(c.b); err != nil {
+		return chunk{}, err
+	}
+	return ch, w.write(compressed)
+}
+
+// widen returns the least and greatest of lo, hi and v, each the plain
+// encoding of a value of kind k, as a column's statistics order them. A
+// nil v leaves lo and hi as they are; otherwise nil lo and hi take v's
+// value.
+func widen(lo, hi, v []byte, k kind) ([]byte, []byte) {
+	if v == nil {
+		return lo, hi
+	}
+	if lo == nil {
+		return v, v
+	}
+	less := func(a, b []byte) bool {
+		switch k {
+		case kindLong:
+			return int64(binary.LittleEndian.Uint64(a)) < int64(binary.LittleEndian.Uint64(b))
+		case kindDouble:
+			return math.Float64frombits(binary.LittleEndian.Uint64(a)) < math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		// Booleans, false before true, and strings by their bytes.
+		return bytes.Compare(a, b) < 0
+	}
+	if less(v, lo) {
+		lo = v
+	}
+	if less(hi, v) {
+		hi = v
+	}
+	return lo, hi
+}
+
+// writeLevels writes the definition levels of values, 0 for nil and 1 for
+// the rest, to buf in the RLE hybrid encoding, as runs of equal levels.
+func writeLevels(buf *bytes.Buffer, values []any) {
+	for i := 0; i < len(values); {
+		j := i + 1
+		for j < len(values) && (values[j] == nil) == (values[i] == nil) {
+			j++
+		}
+		buf.Write(binary.AppendUvarint(nil, uint64(j-i)<<1))
+		if values[i] == nil {
+			buf.WriteByte(0)
+		} else {
+			buf.WriteByte(1)
+		}
+		i = j
+	}
+}
+
+// packBits packs booleans eight to a byte, the first in the lowest bit.
+func packBits(bits []bool) []byte {
+	b := make([]byte, (len(bits)+7)/8)
+	for i, v := range bits {
+		if v {
+			b[i/8] |= 1 << (i % 8)
+		}
+	}
+	return b
+}
+
+// footer returns the file's metadata.
+func (w *Writer) footer() []byte {
+	var c compact
+	c.begin()
+	c.i32(1, 1) // version
+	c.list(2, tStruct, len(w.schema.columns)+1)
+	c.begin()
+	c.binary(4, []byte("schema"))
+	c.i32(5, int32(len(w.schema.columns)))
+	c.end()
+	for _, col := range w.schema.columns {
+		c.begin()
+		c.i32(1, col.kind.physical())
+		c.i32(3, repetitionOpt)
+		c.binary(4, []byte(col.name))
+		if col.kind == kindString {
+			c.i32(6, convertedUTF8)
+			c.object(10)
+			c.object(logicalTypeString)
+			c.end()
+			c.end()
+		}
+		c.end()
+	}
+	rows := 0
+	for _, g := range w.groups {
+		rows += g.rows
+	}
+	c.i64(3, int64(rows))
+	c.list(4, tStruct, len(w.groups))
+	for _, g := range w.groups {
+		c.begin()
+		c.list(1, tStruct, len(g.chunks))
+		for i, ch := range g.chunks {
+			col := w.schema.columns[i]
+			c.begin()
+			c.i64(2, ch.offset)
+			c.object(3)
+			c.i32(1, col.kind.physical())
+			c.list(2, tI32, 2)
+			c.varint(encodingPlain)
+			c.varint(encodingRLE)
+			c.list(3, tBinary, 1)
+			c.bytes([]byte(col.name))
+			c.i32(4, codecSnappy)
+			c.i64(5, int64(g.rows))
+			c.i64(6, ch.uncompressed)
+			c.i64(7, ch.compressed)
+			c.i64(9, ch.offset)
+			c.object(12)
+			c.i64(3, int64(ch.nulls))
+			if ch.min != nil {
+				c.binary(5, ch.max)
+				c.binary(6, ch.min)
+			}
+			c.end()
+			c.end()
+			c.end()
+		}
+		c.i64(2, g.size)
+		c.i64(3, int64(g.rows))
+		c.end()
+	}
+	c.binary(6, []byte("logpipe"))
+	// Each column orders its statistics by its type, so that readers
+	// trust the min and max values.
+	c.list(7, tStruct, len(w.schema.columns))
+	for range w.schema.columns {
+		c.begin()
+		c.object(1)
+		c.end()
+		c.end()
+	}
+	c.end()
+	return c.b
+}
+
+// convert converts v to the Go type columns of kind k hold: bool, int64,
+// float64 or string. Objects and arrays are written as JSON strings.
+func convert(v any, k kind) (any, bool) {
+	switch k {
+	case kindBoolean:
+		b, ok := v.(bool)
+		return b, ok
+	case kindLong:
+		return toInt(v)
+	case kindDouble:
+		return toFloat(v)
+	}
+	return toString(v), true
+}
+
+// toInt converts v to an integer, if it holds one exactly.
+func toInt(v any) (any, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), v <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case float32:
+		return floatInt(float64(v))
+	case float64:
+		return floatInt(v)
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	}
+	return nil, false
+}
+
+// floatInt returns f as an integer, if it is one.
+func floatInt(f float64) (any, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return nil, false
+	}
+	return int64(f), true
+}
+
+// toFloat converts v to a floating-point number.
+func toFloat(v any) (any, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	if i, ok := toInt(v); ok {
+		return float64(i.(int64)), true
+	}
+	return nil, false
+}
+
+// toString converts v to a string: objects and arrays as JSON, and other
+// values as their text.
+func toString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// describe returns v as it appears in an error message.
+func describe(v any) string {
+	s := toString(v)
+	if len(s) > 40 {
+		s = s[:40] + "..."
+	}
+	if _, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return s
+}
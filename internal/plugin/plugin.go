@@ -0,0 +1,253 @@
+// Package plugin runs WebAssembly modules that extend logpipe with their own
+// parser, transform and formatter hooks. Modules run in a wazero sandbox:
+// they get WASI with no filesystem, environment or arguments, only stderr
+// for diagnostics, and a bounded amount of memory.
+//
+// # ABI
+//
+// A plugin module exports its linear memory as "memory" and a function
+//
+//	alloc(size i32) i32
+//
+// returning the address of a buffer of at least size bytes, into which the
+// host copies the input of the next hook call. The buffer may be reused from
+// call to call. It also exports one or more hooks, each taking the address
+// and length of its input and returning the location of its result packed
+// as (address << 32 | length):
+//
+//	parse(ptr, len i32) i64      input: one line of the log, without its
+//	                             terminator; result: the entry as a JSON
+//	                             object, or length 0 if the line is malformed
+//	transform(ptr, len i32) i64  input: an entry as a JSON object; result: the
+//	                             JSON object that replaces it, or length 0 to
+//	                             drop it
+//	format(ptr, len i32) i64     input: an entry as a JSON object; result: the
+//	                             bytes to write for it, verbatim
+//
+// Results are copied out before the next call into the module, so a module
+// may keep a single output buffer. Modules built as WASI reactors, such as
+// Go programs built with -buildmode=c-shared, have their _initialize
+// function run when they are loaded.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// memoryLimitPages caps a plugin's linear memory at 256 MiB (64 KiB pages).
+const memoryLimitPages = 4096
+
+// compilationCache holds compiled modules for reuse by later Loads: on disk
+// under the user's cache directory when there is one, so that a plugin is
+// only compiled once, and in memory otherwise.
+var compilationCache = sync.OnceValue(func() wazero.CompilationCache {
+	if dir, err := os.UserCacheDir(); err == nil {
+		if c, err := wazero.NewCompilationCacheWithDir(filepath.Join(dir, "logpipe", "wasm")); err == nil {
+			return c
+		}
+	}
+	return wazero.NewCompilationCache()
+})
+
+// ErrMalformed is wrapped by the error returned for a line that a plugin's
+// parse hook rejects.
+var ErrMalformed = errors.New("rejected by plugin")
+
+// Plugin is a loaded plugin module. Its hooks may be called from several
+// goroutines; calls into the module are serialised.
+type Plugin struct {
+	name    string
+	runtime wazero.Runtime
+	mod     api.Module
+
+	alloc, parse, transform, format api.Function
+
+	mu sync.Mutex // serialises calls into mod
+}
+
+// Load compiles and instantiates the plugin module at path.
+func Load(ctx context.Context, path string) (*Plugin, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	cfg := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(memoryLimitPages).
+		WithCompilationCache(compilationCache())
+	rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+	p, err := instantiate(ctx, rt, name, code)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("loading plugin %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// instantiate instantiates code in rt and looks up its exports.
+func instantiate(ctx context.Context, rt wazero.Runtime, name string, code []byte) (*Plugin, error) {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		return nil, err
+	}
+	compiled, err := rt.CompileModule(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	cfg := wazero.NewModuleConfig().
+		WithName(name).
+		WithStderr(os.Stderr).
+		WithStartFunctions("_initialize")
+	mod, err := rt.InstantiateModule(ctx, compiled, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plugin{
+		name:      name,
+		runtime:   rt,
+		mod:       mod,
+		alloc:     mod.ExportedFunction("alloc"),
+		parse:     mod.ExportedFunction("parse"),
+		transform: mod.ExportedFunction("transform"),
+		format:    mod.ExportedFunction("format"),
+	}
+	switch {
+	case mod.Memory() == nil:
+		return nil, errors.New("module does not export its memory")
+	case p.alloc == nil:
+		return nil, errors.New("module does not export alloc")
+	case p.parse == nil && p.transform == nil && p.format == nil:
+		return nil, errors.New("module exports none of parse, transform and format")
+	}
+	return p, nil
+}
+
+// Name returns the plugin's name: its file name without the extension.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Close releases the module and its runtime.
+func (p *Plugin) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
+
+// HasParse reports whether the plugin exports a parse hook.
+func (p *Plugin) HasParse() bool { return p.parse != nil }
+
+// HasTransform reports whether the plugin exports a transform hook.
+func (p *Plugin) HasTransform() bool { return p.transform != nil }
+
+// HasFormat reports whether the plugin exports a format hook.
+func (p *Plugin) HasFormat() bool { return p.format != nil }
+
+// call copies in into the module, calls fn on it and returns a copy of its
+// result.
+func (p *Plugin) call(fn api.Function, in []byte) ([]byte, error) {
+	ctx := context.Background()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res, err := p.alloc.Call(ctx, uint64(len(in)))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: alloc: %w", p.name, err)
+	}
+	ptr := uint32(res[0])
+	mem := p.mod.Memory()
+	if !mem.Write(ptr, in) {
+		return nil, fmt.Errorf("plugin %s: alloc returned %d, outside its memory", p.name, ptr)
+	}
+	res, err = fn.Call(ctx, uint64(ptr), uint64(len(in)))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	if outLen == 0 {
+		return nil, nil
+	}
+	out, ok := mem.Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: result at %d+%d is outside its memory", p.name, outPtr, outLen)
+	}
+	return bytes.Clone(out), nil
+}
+
+// ParseLine parses line with the plugin's parse hook. It suits
+// parser.FuncParser.ParseLine.
+func (p *Plugin) ParseLine(line []byte) (*parser.LogEntry, error) {
+	out, err := p.call(p.parse, line)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return nil, fmt.Errorf("%w %s", ErrMalformed, p.name)
+	}
+	var entry *parser.LogEntry
+	if err := json.Unmarshal(out, &entry); err != nil || entry == nil {
+		return nil, fmt.Errorf("plugin %s: parse result is not a JSON object", p.name)
+	}
+	return entry, nil
+}
+
+// Parser returns a parser that parses each line with the plugin's parse
+// hook, applying opts.
+func (p *Plugin) Parser(opts parser.ReadOptions) *parser.FuncParser {
+	return &parser.FuncParser{ReadOptions: opts, ParseLine: p.ParseLine}
+}
+
+// Transform replaces entry's fields with those of the plugin's transform
+// hook's result. It reports false if the hook drops the entry, which is
+// then left unchanged.
+func (p *Plugin) Transform(entry *parser.LogEntry) (keep bool, err error) {
+	in, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+	out, err := p.call(p.transform, in)
+	if err != nil || out == nil {
+		return false, err
+	}
+	var replaced *parser.LogEntry
+	if err := json.Unmarshal(out, &replaced); err != nil || replaced == nil {
+		return false, fmt.Errorf("plugin %s: transform result is not a JSON object", p.name)
+	}
+	// Taking the result as a whole carries over its field order too.
+	*entry = *replaced
+	return true, nil
+}
+
+// Formatter is a formatter.Formatter that writes what a plugin's format
+// hook returns for each entry.
+type Formatter struct {
+	Plugin *Plugin
+}
+
+// Format implements formatter.Formatter.
+func (f *Formatter) Format(w io.Writer, entry *parser.LogEntry) error {
+	in, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	out, err := f.Plugin.call(f.Plugin.format, in)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// tempDir holds the test plugin and the compilation cache for the run.
+var tempDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	if tempDir, err = os.MkdirTemp("", "logpipe-plugin"); err != nil {
+		panic(err)
+	}
+	// Keep compiled test modules out of the user's cache directory.
+	os.Setenv("XDG_CACHE_HOME", tempDir)
+	code := m.Run()
+	os.RemoveAll(tempDir)
+	os.Exit(code)
+}
+
+var (
+	buildOnce sync.Once
+	builtPath string
+	buildErr  error
+)
+
+// testPlugin builds testdata/upper as a WASI reactor once per test run and
+// loads it, skipping the test when the Go toolchain cannot build it.
+func testPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building a WebAssembly plugin is slow")
+	}
+	buildOnce.Do(func() {
+		builtPath = filepath.Join(tempDir, "upper.wasm")
+		cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", builtPath, ".")
+		cmd.Dir = filepath.Join("testdata", "upper")
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			buildErr = errors.New(string(out))
+		}
+	})
+	if buildErr != nil {
+		t.Skipf("cannot build test plugin: %v", buildErr)
+	}
+	p, err := Load(context.Background(), builtPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close(context.Background()) })
+	return p
+}
+
+// =============================================================================
+// Load
+// =============================================================================
+
+func TestLoad_Hooks(t *testing.T) {
+	p := testPlugin(t)
+	if p.Name() != "upper" {
+		t.Errorf("Name() = %q, want upper", p.Name())
+	}
+	if !p.HasParse() || !p.HasTransform() || !p.HasFormat() {
+		t.Errorf("hooks: parse=%v transform=%v format=%v, want all", p.HasParse(), p.HasTransform(), p.HasFormat())
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	if _, err := Load(context.Background(), filepath.Join(t.TempDir(), "none.wasm")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestLoad_NotWasm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.wasm")
+	os.WriteFile(path, []byte("not wasm"), 0o644)
+	if _, err := Load(context.Background(), path); err == nil {
+		t.Error("expected error for a file that is not a module")
+	}
+}
+
+func TestLoad_NoHooks(t *testing.T) {
+	// The smallest valid module: magic number and version, no exports.
+	path := filepath.Join(t.TempDir(), "empty.wasm")
+	os.WriteFile(path, []byte("\x00asm\x01\x00\x00\x00"), 0o644)
+	_, err := Load(context.Background(), path)
+	if err == nil || !strings.Contains(err.Error(), "does not export") {
+		t.Errorf("err = %v, want a missing export error", err)
+	}
+}
+
+// =============================================================================
+// Hooks
+// =============================================================================
+
+func TestPlugin_ParseLine(t *testing.T) {
+	p := testPlugin(t)
+	entry, err := p.ParseLine([]byte("ERROR disk full"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Fields["level"] != "error" || entry.Fields["msg"] != "disk full" {
+		t.Errorf("entry = %v", entry)
+	}
+	if _, err := p.ParseLine([]byte("nospace")); !errors.Is(err, ErrMalformed) {
+		t.Errorf("err = %v, want ErrMalformed", err)
+	}
+}
+
+func TestPlugin_Parser(t *testing.T) {
+	p := testPlugin(t)
+	var msgs []string
+	var errs int
+	for entry, err := range p.Parser(parser.ReadOptions{}).ParseSeq(strings.NewReader("INFO a\nbad\nWARN b\n")) {
+		if err != nil {
+			errs++
+			continue
+		}
+		msgs = append(msgs, entry.Fields["msg"].(string))
+	}
+	if strings.Join(msgs, ",") != "a,b" || errs != 1 {
+		t.Errorf("msgs = %v, errors = %d", msgs, errs)
+	}
+}
+
+func TestPlugin_Transform(t *testing.T) {
+	p := testPlugin(t)
+	entry := parser.NewEntry(map[string]any{"level": "info", "msg": "hello"})
+	keep, err := p.Transform(entry)
+	if err != nil || !keep {
+		t.Fatalf("Transform = %v, %v", keep, err)
+	}
+	if entry.Fields["msg"] != "HELLO" || entry.Fields["level"] != "info" {
+		t.Errorf("entry = %v", entry)
+	}
+
+	keep, err = p.Transform(parser.NewEntry(map[string]any{"msg": "drop"}))
+	if err != nil || keep {
+		t.Errorf("Transform(drop) = %v, %v, want false, nil", keep, err)
+	}
+}
+
+func TestFormatter_Format(t *testing.T) {
+	p := testPlugin(t)
+	var buf bytes.Buffer
+	if err := (&Formatter{Plugin: p}).Format(&buf, parser.NewEntry(map[string]any{"level": "warn", "msg": "slow"})); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[warn] slow\n" {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestPlugin_ConcurrentCalls(t *testing.T) {
+	p := testPlugin(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				entry := parser.NewEntry(map[string]any{"msg": "x"})
+				if keep, err := p.Transform(entry); err != nil || !keep || entry.Fields["msg"] != "X" {
+					t.Errorf("Transform = %v, %v, %v", keep, err, entry)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,44 @@
+// Command relevel is a logpipe plugin used by the -plugin tests. Build it
+// with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o relevel.wasm .
+//
+// It only transforms: it raises the level of every info entry to warn.
+package main
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+// in holds the input of the current call; out holds its result until the
+// next call.
+var in, out []byte
+
+func main() {}
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	if cap(in) < int(size) || size == 0 {
+		in = make([]byte, max(size, 1))
+	}
+	in = in[:size]
+	return ptr(in[:cap(in)])
+}
+
+//go:wasmexport transform
+func transform(p, n uint32) uint64 {
+	var entry map[string]any
+	if json.Unmarshal(in[:n], &entry) != nil {
+		return 0
+	}
+	if entry["level"] == "info" {
+		entry["level"] = "warn"
+	}
+	out, _ = json.Marshal(entry)
+	return uint64(ptr(out))<<32 | uint64(len(out))
+}
+
+func ptr(b []byte) uint32 {
+	return uint32(uintptr(unsafe.Pointer(unsafe.SliceData(b))))
+}
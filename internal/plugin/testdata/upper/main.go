@@ -0,0 +1,80 @@
+// Command upper is a logpipe plugin used by the plugin tests. Build it with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o upper.wasm .
+//
+// It parses lines of the form "LEVEL message", upper-cases the msg field of
+// every entry (dropping entries whose msg is "drop"), and formats entries as
+// "[level] msg".
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"unsafe"
+)
+
+// in holds the input of the current call; out holds its result until the
+// next call.
+var in, out []byte
+
+func main() {}
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	if cap(in) < int(size) || size == 0 {
+		in = make([]byte, max(size, 1))
+	}
+	in = in[:size]
+	return ptr(in[:cap(in)])
+}
+
+//go:wasmexport parse
+func parse(p, n uint32) uint64 {
+	level, msg, ok := strings.Cut(string(in[:n]), " ")
+	if !ok {
+		return 0
+	}
+	return result(map[string]string{"level": strings.ToLower(level), "msg": msg})
+}
+
+//go:wasmexport transform
+func transform(p, n uint32) uint64 {
+	var entry map[string]any
+	if json.Unmarshal(in[:n], &entry) != nil {
+		return 0
+	}
+	msg, _ := entry["msg"].(string)
+	if msg == "drop" {
+		return 0
+	}
+	entry["msg"] = strings.ToUpper(msg)
+	return result(entry)
+}
+
+//go:wasmexport format
+func format(p, n uint32) uint64 {
+	var entry map[string]any
+	json.Unmarshal(in[:n], &entry)
+	out = []byte("[" + str(entry["level"]) + "] " + str(entry["msg"]) + "\n")
+	return pack(out)
+}
+
+// result marshals v into out and returns its packed location.
+func result(v any) uint64 {
+	out, _ = json.Marshal(v)
+	return pack(out)
+}
+
+// pack returns the ABI's (pointer << 32 | length) for b.
+func pack(b []byte) uint64 {
+	return uint64(ptr(b))<<32 | uint64(len(b))
+}
+
+func ptr(b []byte) uint32 {
+	return uint32(uintptr(unsafe.Pointer(unsafe.SliceData(b))))
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
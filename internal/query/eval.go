@@ -0,0 +1,382 @@
+package query
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// scope supplies the values of the expressions that are not computed from
+// their parts: fields, for an entry, or grouped expressions and
+// aggregates, for a group.
+type scope interface {
+	value(e expr) (any, bool)
+}
+
+// eval returns the value of e in s: a string, float64, bool, nil for NULL,
+// or a value taken from an entry as it is.
+func eval(e expr, s scope) any {
+	if v, ok := s.value(e); ok {
+		return v
+	}
+	switch e := e.(type) {
+	case *literal:
+		return e.v
+	case *unary:
+		x := eval(e.x, s)
+		if e.op == "NOT" {
+			if b, ok := truth(x); ok {
+				return !b
+			}
+			return nil
+		}
+		if f, ok := number(x); ok {
+			return -f
+		}
+		return nil
+	case *binary:
+		return evalBinary(e, s)
+	case *like:
+		x, pattern := eval(e.x, s), eval(e.pattern, s)
+		if x == nil || pattern == nil {
+			return nil
+		}
+		return likeMatch(Text(x), Text(pattern)) != e.not
+	case *inList:
+		x := eval(e.x, s)
+		if x == nil {
+			return nil
+		}
+		var result any = false
+		for _, item := range e.list {
+			v := eval(item, s)
+			if v == nil {
+				result = nil
+				continue
+			}
+			if compare(x, v) == 0 {
+				return !e.not
+			}
+		}
+		if result == nil {
+			return nil
+		}
+		return e.not
+	case *isNull:
+		return (eval(e.x, s) == nil) != e.not
+	case *call:
+		args := make([]any, len(e.args))
+		for i, a := range e.args {
+			args[i] = eval(a, s)
+		}
+		return callScalar(e.name, args)
+	}
+	return nil
+}
+
+// evalBinary returns the value of e in s. AND and OR follow SQL's three
+// valued logic, in which NULL stands for unknown.
+func evalBinary(e *binary, s scope) any {
+	switch e.op {
+	case "AND", "OR":
+		l, lok := truth(eval(e.l, s))
+		if lok && l == (e.op == "OR") {
+			return l
+		}
+		r, rok := truth(eval(e.r, s))
+		if rok && r == (e.op == "OR") {
+			return r
+		}
+		if !lok || !rok {
+			return nil
+		}
+		return l
+	}
+	l, r := eval(e.l, s), eval(e.r, s)
+	if l == nil || r == nil {
+		return nil
+	}
+	switch e.op {
+	case "=":
+		return compare(l, r) == 0
+	case "!=":
+		return compare(l, r) != 0
+	case "<":
+		return compare(l, r) < 0
+	case "<=":
+		return compare(l, r) <= 0
+	case ">":
+		return compare(l, r) > 0
+	case ">=":
+		return compare(l, r) >= 0
+	}
+	a, aok := number(l)
+	b, bok := number(r)
+	if !aok || !bok {
+		return nil
+	}
+	switch e.op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		if b == 0 {
+			return nil
+		}
+		return a / b
+	}
+	return nil
+}
+
+// truth returns the truth value of v, and false if it is unknown: v is
+// NULL or neither a boolean nor a number.
+func truth(v any) (bool, bool) {
+	if b, ok := v.(bool); ok {
+		return b, true
+	}
+	if f, ok := number(v); ok {
+		return f != 0, true
+	}
+	return false, false
+}
+
+// number returns v as a number if it is one or is text spelling one.
+func number(v any) (float64, bool) {
+	var f float64
+	var err error
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err = v.Float64()
+	case string:
+		f, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, false
+	}
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// Text returns v as text: strings as they are, numbers in their shortest
+// decimal form, and objects and arrays as compact JSON.
+func Text(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// compare orders two values that are not NULL: numerically when both are
+// numbers or spell them, false before true when both are booleans, and as
+// text otherwise. It returns -1, 0 or +1.
+func compare(a, b any) int {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case y:
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(Text(a), Text(b))
+}
+
+// likeMatch reports whether s matches the LIKE pattern, in which % stands
+// for any run of characters and _ for any single character.
+func likeMatch(s, pattern string) bool {
+	// Match greedily, backtracking to the last % on a mismatch.
+	si, pi := 0, 0
+	star, mark := -1, 0
+	for si < len(s) {
+		if pi < len(pattern) {
+			switch pattern[pi] {
+			case '%':
+				star, mark = pi, si
+				pi++
+				continue
+			case '_':
+				_, size := utf8.DecodeRuneInString(s[si:])
+				si += size
+				pi++
+				continue
+			default:
+				if s[si] == pattern[pi] {
+					si++
+					pi++
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(s[mark:])
+		mark += size
+		si, pi = mark, star+1
+	}
+	for pi < len(pattern) && pattern[pi] == '%' {
+		pi++
+	}
+	return pi == len(pattern)
+}
+
+// scalars maps each scalar function to its number of arguments, or -1 if
+// it takes any number.
+var scalars = map[string]int{
+	"lower":    1,
+	"upper":    1,
+	"length":   1,
+	"coalesce": -1,
+}
+
+// callScalar returns the result of the scalar function name given args.
+func callScalar(name string, args []any) any {
+	if name == "coalesce" {
+		for _, a := range args {
+			if a != nil {
+				return a
+			}
+		}
+		return nil
+	}
+	if args[0] == nil {
+		return nil
+	}
+	s := Text(args[0])
+	switch name {
+	case "lower":
+		return strings.ToLower(s)
+	case "upper":
+		return strings.ToUpper(s)
+	case "length":
+		return float64(utf8.RuneCountInString(s))
+	}
+	return nil
+}
+
+// accumulator computes an aggregate over the values added to it.
+type accumulator interface {
+	add(v any)
+	result() any
+}
+
+// aggregates maps each aggregate function to a constructor of its
+// accumulator for a call.
+var aggregates = map[string]func(c *call) accumulator{
+	"count": func(c *call) accumulator {
+		if c.distinct {
+			return &countDistinct{seen: make(map[string]struct{})}
+		}
+		return new(count)
+	},
+	"sum": func(*call) accumulator { return &sum{} },
+	"avg": func(*call) accumulator { return &sum{avg: true} },
+	"min": func(*call) accumulator { return &extreme{sign: -1} },
+	"max": func(*call) accumulator { return &extreme{sign: 1} },
+}
+
+// count counts the values that are not NULL. count(*) is given true for
+// every entry.
+type count float64
+
+func (c *count) add(v any) {
+	if v != nil {
+		*c++
+	}
+}
+
+func (c *count) result() any { return float64(*c) }
+
+// countDistinct counts the distinct values that are not NULL, compared as
+// text.
+type countDistinct struct {
+	seen map[string]struct{}
+}
+
+func (c *countDistinct) add(v any) {
+	if v != nil {
+		c.seen[Text(v)] = struct{}{}
+	}
+}
+
+func (c *countDistinct) result() any { return float64(len(c.seen)) }
+
+// sum adds up the values that are numbers or text spelling one, so that
+// "7" counts as 7, ignoring the rest; with avg set it returns their mean
+// instead, over only the values it added. Without any such values the
+// result is NULL.
+type sum struct {
+	total float64
+	n     int
+	avg   bool
+}
+
+func (s *sum) add(v any) {
+	if f, ok := number(v); ok {
+		s.total += f
+		s.n++
+	}
+}
+
+func (s *sum) result() any {
+	switch {
+	case s.n == 0:
+		return nil
+	case s.avg:
+		return s.total / float64(s.n)
+	}
+	return s.total
+}
+
+// extreme keeps the least (sign -1) or greatest (sign 1) value that is not
+// NULL, as ordered by compare.
+type extreme struct {
+	v    any
+	sign int
+}
+
+func (e *extreme) add(v any) {
+	if v != nil && (e.v == nil || compare(v, e.v)*e.sign > 0) {
+		e.v = v
+	}
+}
+
+func (e *extreme) result() any { return e.v }
@@ -0,0 +1,176 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind classifies a token.
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            // a bare word: a field name or a keyword
+	tokQuoted           // a field name in backquotes
+	tokString           // a string literal in single or double quotes
+	tokNumber
+	tokOp // punctuation and operators
+)
+
+// token is a lexical token of a query. pos is the byte offset of its start.
+type token struct {
+	kind tokenKind
+	text string // the identifier, operator or number, or a string's value
+	pos  int
+}
+
+// keywords are the words that cannot be used as bare field names.
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true,
+	"HAVING": true, "ORDER": true, "ASC": true, "DESC": true, "LIMIT": true,
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "IN": true, "IS": true,
+	"NULL": true, "TRUE": true, "FALSE": true, "AS": true, "DISTINCT": true,
+}
+
+// is reports whether t is the keyword kw, in any case.
+func (t token) is(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+// keyword reports whether t is a reserved word.
+func (t token) keyword() bool {
+	return t.kind == tokIdent && keywords[strings.ToUpper(t.text)]
+}
+
+// String describes t for error messages.
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	case tokQuoted:
+		return "`" + t.text + "`"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// twoCharOps are the operators spelled with two characters.
+var twoCharOps = []string{"<=", ">=", "<>", "!=", "=="}
+
+// lex splits src into tokens, ending with a tokEOF token.
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case isIdentStart(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if !isIdentStart(r) && !unicode.IsDigit(r) && r != '.' {
+					break
+				}
+				i += size
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case r >= '0' && r <= '9' || r == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			i = scanNumber(src, i)
+			toks = append(toks, token{tokNumber, src[start:i], start})
+		case r == '\'' || r == '"' || r == '`':
+			s, end, ok := scanQuoted(src, i)
+			if !ok {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated " + quoteName(r)}
+			}
+			kind := tokString
+			if r == '`' {
+				kind = tokQuoted
+			}
+			toks = append(toks, token{kind, s, i})
+			i = end
+		default:
+			op := ""
+			for _, two := range twoCharOps {
+				if strings.HasPrefix(src[i:], two) {
+					op = two
+					break
+				}
+			}
+			if op == "" && strings.ContainsRune("(),*+-/=<>;", r) {
+				op = string(r)
+			}
+			if op == "" {
+				return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+// isIdentStart reports whether r may begin a bare identifier.
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '@'
+}
+
+// scanNumber returns the end of the number starting at src[i]: digits with
+// an optional fraction and exponent.
+func scanNumber(src string, i int) int {
+	digits := func() {
+		for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+			i++
+		}
+	}
+	digits()
+	if i < len(src) && src[i] == '.' {
+		i++
+		digits()
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && src[j] >= '0' && src[j] <= '9' {
+			i = j
+			digits()
+		}
+	}
+	return i
+}
+
+// scanQuoted returns the value of the quoted text starting at src[i] and
+// the offset after its closing quote. A doubled quote character stands for
+// itself.
+func scanQuoted(src string, i int) (string, int, bool) {
+	q := src[i]
+	var b strings.Builder
+	for j := i + 1; j < len(src); j++ {
+		if src[j] != q {
+			b.WriteByte(src[j])
+			continue
+		}
+		if j+1 < len(src) && src[j+1] == q {
+			b.WriteByte(q)
+			j++
+			continue
+		}
+		return b.String(), j + 1, true
+	}
+	return "", 0, false
+}
+
+// quoteName names the kind of quoted text q begins.
+func quoteName(q rune) string {
+	if q == '`' {
+		return "quoted field name"
+	}
+	return "string"
+}
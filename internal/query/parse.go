@@ -0,0 +1,544 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError reports a query that cannot be parsed or makes no sense.
+type SyntaxError struct {
+	Pos int // byte offset in the query
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// expr is a node of an expression. Its String form is canonical, so two
+// expressions written alike have the same String.
+type expr interface {
+	String() string
+}
+
+// field refers to the value of an entry's field.
+type field struct {
+	name string
+}
+
+// literal is a constant: a string, float64, bool or nil for NULL. text is
+// its canonical spelling.
+type literal struct {
+	v    any
+	text string
+}
+
+// unary is NOT x or -x.
+type unary struct {
+	op string
+	x  expr
+}
+
+// binary is a comparison, a logical or an arithmetic operation.
+type binary struct {
+	op   string // AND, OR, =, !=, <, <=, >, >=, +, -, * or /
+	l, r expr
+}
+
+// like is x [NOT] LIKE pattern.
+type like struct {
+	x, pattern expr
+	not        bool
+}
+
+// inList is x [NOT] IN (list).
+type inList struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+// isNull is x IS [NOT] NULL.
+type isNull struct {
+	x   expr
+	not bool
+}
+
+// call is a function call. agg is the index of an aggregate call's
+// accumulator in the query, or -1 for a scalar function.
+type call struct {
+	name     string // lower case
+	args     []expr
+	star     bool // count(*)
+	distinct bool // count(DISTINCT x)
+	agg      int
+	pos      int // of the function name
+}
+
+func (e *field) String() string {
+	if isBareName(e.name) {
+		return e.name
+	}
+	return "`" + strings.ReplaceAll(e.name, "`", "``") + "`"
+}
+
+func (e *literal) String() string { return e.text }
+
+func (e *unary) String() string {
+	if e.op == "NOT" {
+		return "NOT " + operand(e.x)
+	}
+	return e.op + operand(e.x)
+}
+
+func (e *binary) String() string {
+	return operand(e.l) + " " + e.op + " " + operand(e.r)
+}
+
+func (e *like) String() string {
+	op := " LIKE "
+	if e.not {
+		op = " NOT LIKE "
+	}
+	return operand(e.x) + op + operand(e.pattern)
+}
+
+func (e *inList) String() string {
+	items := make([]string, len(e.list))
+	for i, x := range e.list {
+		items[i] = x.String()
+	}
+	op := " IN ("
+	if e.not {
+		op = " NOT IN ("
+	}
+	return operand(e.x) + op + strings.Join(items, ", ") + ")"
+}
+
+func (e *isNull) String() string {
+	if e.not {
+		return operand(e.x) + " IS NOT NULL"
+	}
+	return operand(e.x) + " IS NULL"
+}
+
+func (e *call) String() string {
+	if e.star {
+		return e.name + "(*)"
+	}
+	args := make([]string, len(e.args))
+	for i, x := range e.args {
+		args[i] = x.String()
+	}
+	prefix := ""
+	if e.distinct {
+		prefix = "DISTINCT "
+	}
+	return e.name + "(" + prefix + strings.Join(args, ", ") + ")"
+}
+
+// operand returns the String of e, in parentheses when it is an operation
+// itself.
+func operand(e expr) string {
+	switch e.(type) {
+	case *field, *literal, *call:
+		return e.String()
+	}
+	return "(" + e.String() + ")"
+}
+
+// isBareName reports whether name can be written without backquotes.
+func isBareName(name string) bool {
+	toks, err := lex(name)
+	return err == nil && len(toks) == 2 && toks[0].kind == tokIdent && toks[0].text == name && !toks[0].keyword()
+}
+
+// item is an entry of the select list: an expression, or * for all of an
+// entry's fields.
+type item struct {
+	e    expr // nil for *
+	name string
+	pos  int
+}
+
+// orderItem is an entry of the ORDER BY list.
+type orderItem struct {
+	e    expr
+	desc bool
+}
+
+// statement is a parsed SELECT statement, before its expressions are
+// resolved.
+type statement struct {
+	items   []item
+	where   expr
+	groupBy []expr
+	having  expr
+	orderBy []orderItem
+	limit   int // -1 without LIMIT
+	// positions of the clauses, for error messages
+	groupPos  []int
+	havingPos int
+	orderPos  []int
+}
+
+// queryParser is a recursive descent parser over the tokens of a query.
+type queryParser struct {
+	toks []token
+	i    int
+}
+
+func (p *queryParser) peek() token { return p.toks[p.i] }
+
+func (p *queryParser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the keyword or operator s.
+func (p *queryParser) accept(s string) bool {
+	t := p.peek()
+	if t.is(s) || t.kind == tokOp && t.text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// expect consumes the keyword or operator s, or fails.
+func (p *queryParser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected %s, found %s", s, p.peek())
+	}
+	return nil
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return &SyntaxError{Pos: p.peek().pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseStatement parses a whole SELECT statement.
+func (p *queryParser) parseStatement() (*statement, error) {
+	st := &statement{limit: -1}
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	for {
+		pos := p.peek().pos
+		if p.accept("*") {
+			st.items = append(st.items, item{name: "*", pos: pos})
+		} else {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			it := item{e: e, name: e.String(), pos: pos}
+			if p.accept("AS") || p.peek().kind == tokIdent && !p.peek().keyword() || p.peek().kind == tokQuoted {
+				t := p.next()
+				if t.kind != tokIdent && t.kind != tokQuoted || t.keyword() {
+					return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected a column name after AS, found %s", t)}
+				}
+				it.name = t.text
+			}
+			st.items = append(st.items, it)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("FROM") {
+		t := p.next()
+		if t.kind != tokIdent || !strings.EqualFold(t.text, "logs") {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unknown table %s: the entries are the table logs", t)}
+		}
+	}
+	var err error
+	if p.accept("WHERE") {
+		if st.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			st.groupPos = append(st.groupPos, p.peek().pos)
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			st.groupBy = append(st.groupBy, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.peek().is("HAVING") {
+		st.havingPos = p.next().pos
+		if st.having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			st.orderPos = append(st.orderPos, p.peek().pos)
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			o := orderItem{e: e}
+			if p.accept("DESC") {
+				o.desc = true
+			} else {
+				p.accept("ASC")
+			}
+			st.orderBy = append(st.orderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokNumber || err != nil || n < 0 {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected a row count after LIMIT, found %s", t)}
+		}
+		st.limit = n
+	}
+	p.accept(";")
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", t)
+	}
+	return st, nil
+}
+
+// parseExpr parses an expression; the operators bind, loosest first: OR,
+// AND, NOT, comparisons, + and -, * and /, unary minus.
+func (p *queryParser) parseExpr() (expr, error) {
+	return p.parseBinary(0)
+}
+
+// levels lists the binary operators by precedence, loosest first; NOT and
+// the comparisons sit between AND and +.
+var levels = [][]string{{"OR"}, {"AND"}, nil, nil, {"+", "-"}, {"*", "/"}}
+
+func (p *queryParser) parseBinary(level int) (expr, error) {
+	switch level {
+	case 2:
+		if p.accept("NOT") {
+			x, err := p.parseBinary(2)
+			if err != nil {
+				return nil, err
+			}
+			return &unary{op: "NOT", x: x}, nil
+		}
+		return p.parseBinary(3)
+	case 3:
+		return p.parseComparison()
+	case len(levels):
+		return p.parseUnary()
+	}
+	l, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range levels[level] {
+			if p.accept(o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return l, nil
+		}
+		r, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{op: op, l: l, r: r}
+	}
+}
+
+// comparisons maps each comparison operator to its canonical spelling.
+var comparisons = map[string]string{"=": "=", "==": "=", "!=": "!=", "<>": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+func (p *queryParser) parseComparison() (expr, error) {
+	x, err := p.parseBinary(4)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if op, ok := comparisons[t.text]; ok && t.kind == tokOp {
+		p.next()
+		r, err := p.parseBinary(4)
+		if err != nil {
+			return nil, err
+		}
+		return &binary{op: op, l: x, r: r}, nil
+	}
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNull{x: x, not: not}, nil
+	}
+	not := p.accept("NOT")
+	switch {
+	case p.accept("LIKE"):
+		pattern, err := p.parseBinary(4)
+		if err != nil {
+			return nil, err
+		}
+		return &like{x: x, pattern: pattern, not: not}, nil
+	case p.accept("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		in := &inList{x: x, not: not}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	case not:
+		return nil, p.errorf("expected LIKE or IN after NOT, found %s", p.peek())
+	}
+	return x, nil
+}
+
+func (p *queryParser) parseUnary() (expr, error) {
+	if p.accept("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if l, ok := x.(*literal); ok {
+			if f, ok := l.v.(float64); ok {
+				return &literal{v: -f, text: "-" + l.text}, nil
+			}
+		}
+		return &unary{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("invalid number %s", t)}
+		}
+		return &literal{v: f, text: t.text}, nil
+	case tokString:
+		return &literal{v: t.text, text: "'" + strings.ReplaceAll(t.text, "'", "''") + "'"}, nil
+	case tokQuoted:
+		return &field{name: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	case tokIdent:
+		switch {
+		case t.is("NULL"):
+			return &literal{v: nil, text: "NULL"}, nil
+		case t.is("TRUE"):
+			return &literal{v: true, text: "TRUE"}, nil
+		case t.is("FALSE"):
+			return &literal{v: false, text: "FALSE"}, nil
+		case t.keyword():
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s (quote a field with this name in backquotes)", strings.ToUpper(t.text))}
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		return &field{name: t.text}, nil
+	}
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected an expression, found %s", t)}
+}
+
+// parseCall parses the arguments of a call to the function named by t,
+// whose opening parenthesis has been read.
+func (p *queryParser) parseCall(t token) (expr, error) {
+	c := &call{name: strings.ToLower(t.text), agg: -1, pos: t.pos}
+	if p.accept("*") {
+		c.star = true
+	} else if !p.accept(")") {
+		c.distinct = p.accept("DISTINCT")
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	} else {
+		return c, checkCall(c, t.pos)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return c, checkCall(c, t.pos)
+}
+
+// checkCall reports an error if c calls an unknown function or passes it
+// the wrong arguments.
+func checkCall(c *call, pos int) error {
+	fail := func(format string, args ...any) error {
+		return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	}
+	_, isAgg := aggregates[c.name]
+	if _, ok := scalars[c.name]; !ok && !isAgg {
+		return fail("unknown function %s", c.name)
+	}
+	switch {
+	case c.star && c.name != "count":
+		return fail("only count accepts *")
+	case c.distinct && c.name != "count":
+		return fail("only count accepts DISTINCT")
+	case c.distinct && len(c.args) != 1:
+		return fail("count(DISTINCT ...) takes one argument")
+	}
+	if isAgg {
+		if !c.star && len(c.args) != 1 {
+			return fail("%s takes one argument", c.name)
+		}
+		return nil
+	}
+	if n := scalars[c.name]; n >= 0 && len(c.args) != n || n < 0 && len(c.args) == 0 {
+		return fail("wrong number of arguments to %s", c.name)
+	}
+	return nil
+}
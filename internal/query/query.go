@@ -0,0 +1,579 @@
+// Package query runs a small dialect of SQL over log entries, which form
+// the table logs:
+//
+//	SELECT service, count(*) FROM logs WHERE level = "error"
+//	GROUP BY service ORDER BY 2 DESC LIMIT 10
+//
+// A query has a select list of expressions, each optionally named with AS,
+// or * for all of an entry's fields, and optional FROM logs, WHERE, GROUP
+// BY, HAVING, ORDER BY and LIMIT clauses; GROUP BY, HAVING and ORDER BY
+// may name a column of the select list. Expressions combine fields,
+// string literals in single or double quotes, numbers, NULL, TRUE and
+// FALSE with the operators =, != (or <>), <, <=, >, >=, LIKE, IN, IS NULL,
+// AND, OR, NOT, +, -, * and /, the scalar functions lower, upper, length
+// and coalesce, and the aggregates count, sum, avg, min and max. A field
+// whose name is a keyword or holds other characters is written in
+// backquotes, and a.b also reaches member b of an object field a.
+//
+// Values are compared as numbers when both are numbers or text spelling
+// one, and as text otherwise. A missing field is NULL, and comparisons with
+// NULL are neither true nor false. Aggregates other than count(*) skip
+// NULL, and sum and avg also skip values that are neither numbers nor text
+// spelling one; over nothing but skipped values, all but count are NULL.
+//
+// Queries without aggregates, GROUP BY or ORDER BY stream: each matching
+// entry produces its row as it is added. Aggregate queries keep one set of
+// running totals per group rather than the entries themselves.
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// Field is a named value of a result row.
+type Field struct {
+	Name  string
+	Value any
+}
+
+// Row is a row of a query's result. Its fields are those of the select
+// list, with * standing for all of an entry's fields in their order.
+type Row []Field
+
+// Query is a parsed query, ready to be run with Executor.
+type Query struct {
+	items   []item
+	where   expr
+	groupBy []expr
+	having  expr
+	orderBy []orderItem
+	limit   int     // -1 without LIMIT
+	aggs    []*call // the aggregate calls, indexed by their agg field
+	grouped bool    // rows are groups rather than entries
+
+	groupKeys []string // the String forms of groupBy
+}
+
+// Parse parses a query. A *SyntaxError reports where it went wrong.
+func Parse(src string) (*Query, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+	st, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{items: st.items, where: st.where, having: st.having, limit: st.limit}
+
+	for i, e := range st.groupBy {
+		r, err := q.resolve(e, st.groupPos[i], "GROUP BY")
+		if err != nil {
+			return nil, err
+		}
+		if firstAggregate(r) != nil {
+			return nil, &SyntaxError{Pos: st.groupPos[i], Msg: "GROUP BY cannot use an aggregate"}
+		}
+		q.groupBy = append(q.groupBy, r)
+		q.groupKeys = append(q.groupKeys, r.String())
+	}
+	for i, o := range st.orderBy {
+		r, err := q.resolve(o.e, st.orderPos[i], "ORDER BY")
+		if err != nil {
+			return nil, err
+		}
+		q.orderBy = append(q.orderBy, orderItem{e: r, desc: o.desc})
+	}
+	if q.having != nil {
+		q.having = q.substitute(q.having)
+	}
+	if q.where != nil {
+		if c := firstAggregate(q.where); c != nil {
+			return nil, &SyntaxError{Pos: c.pos, Msg: "WHERE cannot use an aggregate; use HAVING"}
+		}
+	}
+
+	// Number the aggregate calls, each of which gets its own accumulator.
+	var nested *call // the first aggregate found inside another
+	number := func(e expr) {
+		walk(e, func(e expr) {
+			// A call reached through an alias or position is already numbered.
+			if c, ok := e.(*call); ok && isAggregate(c) && c.agg < 0 {
+				for _, a := range c.args {
+					if inner := firstAggregate(a); inner != nil && nested == nil {
+						nested = inner
+					}
+				}
+				c.agg = len(q.aggs)
+				q.aggs = append(q.aggs, c)
+			}
+		})
+	}
+	for _, it := range q.items {
+		if it.e != nil {
+			number(it.e)
+		}
+	}
+	if q.having != nil {
+		number(q.having)
+	}
+	for _, o := range q.orderBy {
+		number(o.e)
+	}
+	if nested != nil {
+		return nil, &SyntaxError{Pos: nested.pos, Msg: "aggregates cannot be nested"}
+	}
+
+	q.grouped = len(q.groupBy) > 0 || len(q.aggs) > 0
+	if q.having != nil && !q.grouped {
+		return nil, &SyntaxError{Pos: st.havingPos, Msg: "HAVING needs GROUP BY or an aggregate"}
+	}
+	if q.grouped {
+		for _, it := range q.items {
+			if it.e == nil {
+				return nil, &SyntaxError{Pos: it.pos, Msg: "* cannot be used with GROUP BY or aggregates"}
+			}
+			if err := q.checkGrouped(it.e, it.pos); err != nil {
+				return nil, err
+			}
+		}
+		if q.having != nil {
+			if err := q.checkGrouped(q.having, st.havingPos); err != nil {
+				return nil, err
+			}
+		}
+		for i, o := range q.orderBy {
+			if err := q.checkGrouped(o.e, st.orderPos[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return q, nil
+}
+
+// resolve returns the expression a GROUP BY or ORDER BY item e stands for:
+// the select list's expression for a position such as 2 or the name of
+// one of its columns, or else e itself.
+func (q *Query) resolve(e expr, pos int, clause string) (expr, error) {
+	switch e := e.(type) {
+	case *literal:
+		f, ok := e.v.(float64)
+		if !ok || strings.ContainsAny(e.text, ".eE-") {
+			break
+		}
+		n := int(f)
+		if n < 1 || n > len(q.items) {
+			return nil, &SyntaxError{Pos: pos, Msg: clause + " position " + e.text + " is not in the select list"}
+		}
+		if q.items[n-1].e == nil {
+			return nil, &SyntaxError{Pos: pos, Msg: clause + " position " + e.text + " is *"}
+		}
+		return q.items[n-1].e, nil
+	case *field:
+		for _, it := range q.items {
+			if it.e != nil && it.name == e.name {
+				return it.e, nil
+			}
+		}
+	}
+	return e, nil
+}
+
+// substitute returns e with the fields in it that name a column of the
+// select list, as HAVING n > 1 names count(*) AS n, replaced by the
+// column's expression.
+func (q *Query) substitute(e expr) expr {
+	switch e := e.(type) {
+	case *field:
+		r, _ := q.resolve(e, 0, "")
+		return r
+	case *unary:
+		e.x = q.substitute(e.x)
+	case *binary:
+		e.l, e.r = q.substitute(e.l), q.substitute(e.r)
+	case *like:
+		e.x, e.pattern = q.substitute(e.x), q.substitute(e.pattern)
+	case *inList:
+		e.x = q.substitute(e.x)
+		for i, x := range e.list {
+			e.list[i] = q.substitute(x)
+		}
+	case *isNull:
+		e.x = q.substitute(e.x)
+	case *call:
+		for i, x := range e.args {
+			e.args[i] = q.substitute(x)
+		}
+	}
+	return e
+}
+
+// checkGrouped reports an error if e uses a field other than in an
+// aggregate or a GROUP BY expression, which has no single value in a
+// group.
+func (q *Query) checkGrouped(e expr, pos int) error {
+	var bad expr
+	var check func(e expr)
+	check = func(e expr) {
+		if bad != nil || q.groupIndex(e) >= 0 {
+			return
+		}
+		switch e := e.(type) {
+		case *call:
+			if e.agg >= 0 {
+				return
+			}
+		case *field:
+			bad = e
+			return
+		}
+		for _, c := range children(e) {
+			check(c)
+		}
+	}
+	check(e)
+	if bad != nil {
+		return &SyntaxError{Pos: pos, Msg: bad.String() + " must appear in GROUP BY or be used in an aggregate"}
+	}
+	return nil
+}
+
+// groupIndex returns the position of e in the GROUP BY list, or -1.
+func (q *Query) groupIndex(e expr) int {
+	if len(q.groupKeys) == 0 {
+		return -1
+	}
+	s := e.String()
+	for i, k := range q.groupKeys {
+		if k == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Columns returns the names of the select list's columns; * stands for all
+// of an entry's fields.
+func (q *Query) Columns() []string {
+	names := make([]string, len(q.items))
+	for i, it := range q.items {
+		names[i] = it.name
+	}
+	return names
+}
+
+// Streaming reports whether the query produces each row as soon as its
+// entry is added, rather than when the executor is closed.
+func (q *Query) Streaming() bool {
+	return !q.grouped && len(q.orderBy) == 0
+}
+
+// isAggregate reports whether c calls an aggregate function.
+func isAggregate(c *call) bool {
+	_, ok := aggregates[c.name]
+	return ok
+}
+
+// firstAggregate returns the first aggregate call in e, or nil if there
+// is none.
+func firstAggregate(e expr) *call {
+	var found *call
+	walk(e, func(e expr) {
+		if c, ok := e.(*call); ok && isAggregate(c) && found == nil {
+			found = c
+		}
+	})
+	return found
+}
+
+// children returns the operands of e.
+func children(e expr) []expr {
+	switch e := e.(type) {
+	case *unary:
+		return []expr{e.x}
+	case *binary:
+		return []expr{e.l, e.r}
+	case *like:
+		return []expr{e.x, e.pattern}
+	case *inList:
+		return append([]expr{e.x}, e.list...)
+	case *isNull:
+		return []expr{e.x}
+	case *call:
+		return e.args
+	}
+	return nil
+}
+
+// walk calls fn for e and every expression within it.
+func walk(e expr, fn func(expr)) {
+	fn(e)
+	for _, c := range children(e) {
+		walk(c, fn)
+	}
+}
+
+// entryScope evaluates expressions over an entry.
+type entryScope map[string]any
+
+func (s entryScope) value(e expr) (any, bool) {
+	if f, ok := e.(*field); ok {
+		return lookup(s, f.name), true
+	}
+	return nil, false
+}
+
+// lookup returns the value of the field name of m, or nil if there is
+// none. A name with dots that is not itself a field reaches into objects:
+// a.b is member b of the object in field a.
+func lookup(m map[string]any, name string) any {
+	if v, ok := m[name]; ok {
+		return v
+	}
+	for i := strings.IndexByte(name, '.'); i >= 0; {
+		if obj, ok := m[name[:i]].(map[string]any); ok {
+			if v := lookup(obj, name[i+1:]); v != nil {
+				return v
+			}
+		}
+		j := strings.IndexByte(name[i+1:], '.')
+		if j < 0 {
+			break
+		}
+		i += j + 1
+	}
+	return nil
+}
+
+// group is the running state of one group of an aggregate query.
+type group struct {
+	keys []any // values of the GROUP BY expressions
+	accs []accumulator
+}
+
+// groupScope evaluates expressions over a group.
+type groupScope struct {
+	q *Query
+	g *group
+}
+
+func (s groupScope) value(e expr) (any, bool) {
+	if c, ok := e.(*call); ok && c.agg >= 0 {
+		return s.g.accs[c.agg].result(), true
+	}
+	if i := s.q.groupIndex(e); i >= 0 {
+		return s.g.keys[i], true
+	}
+	return nil, false
+}
+
+// sortedRow is a row with the values of the ORDER BY expressions.
+type sortedRow struct {
+	row  Row
+	keys []any
+}
+
+// Executor runs a query over the entries added to it.
+type Executor struct {
+	q       *Query
+	emit    func(Row) bool
+	sent    int
+	stopped bool
+
+	groups map[string]*group
+	order  []*group // groups in the order they were created
+
+	rows []sortedRow // rows awaiting ORDER BY
+}
+
+// Executor returns an executor of q that passes each result row to emit,
+// which returns false to stop the query.
+func (q *Query) Executor(emit func(Row) bool) *Executor {
+	return &Executor{q: q, emit: emit, groups: make(map[string]*group)}
+}
+
+// Add runs the query over entry, which is not retained, although values
+// taken from it may be. It reports false once no more entries are needed:
+// LIMIT rows have been produced by a streaming query, or emit returned
+// false.
+func (x *Executor) Add(entry *parser.LogEntry) bool {
+	if x.stopped || x.q.limit == 0 {
+		return false
+	}
+	q, s := x.q, entryScope(entry.Fields)
+	if q.where != nil {
+		if ok, known := truth(eval(q.where, s)); !ok || !known {
+			return true
+		}
+	}
+	if q.grouped {
+		x.accumulate(s)
+		return true
+	}
+	row := x.row(entry, s)
+	if len(q.orderBy) == 0 {
+		return x.send(row)
+	}
+	x.rows = append(x.rows, sortedRow{row: row, keys: q.orderKeys(s)})
+	if q.limit > 0 && len(x.rows) >= 2*q.limit+64 {
+		// Only the first LIMIT rows can be output; drop the rest.
+		x.sortRows(x.rows)
+		clear(x.rows[q.limit:])
+		x.rows = x.rows[:q.limit]
+	}
+	return true
+}
+
+// Close produces the rows that were waiting for the end of the input: the
+// groups of an aggregate query, or the rows of one with ORDER BY.
+func (x *Executor) Close() {
+	q := x.q
+	if !q.grouped {
+		x.flush(x.rows)
+		x.rows = nil
+		return
+	}
+	if len(x.order) == 0 && len(q.groupBy) == 0 {
+		// Aggregates over no entries still make one row.
+		x.order = append(x.order, x.newGroup(nil))
+	}
+	var rows []sortedRow
+	for _, g := range x.order {
+		s := groupScope{q, g}
+		if q.having != nil {
+			if ok, known := truth(eval(q.having, s)); !ok || !known {
+				continue
+			}
+		}
+		rows = append(rows, sortedRow{row: x.row(nil, s), keys: q.orderKeys(s)})
+	}
+	x.flush(rows)
+}
+
+// accumulate adds the entry of s to its group's aggregates.
+func (x *Executor) accumulate(s entryScope) {
+	keys := make([]any, len(x.q.groupBy))
+	var id strings.Builder
+	for i, e := range x.q.groupBy {
+		keys[i] = eval(e, s)
+		if keys[i] == nil {
+			id.WriteString("\x00n")
+		} else {
+			id.WriteString("\x00v")
+			id.WriteString(Text(keys[i]))
+		}
+	}
+	g := x.groups[id.String()]
+	if g == nil {
+		g = x.newGroup(keys)
+		x.groups[id.String()] = g
+		x.order = append(x.order, g)
+	}
+	for i, c := range x.q.aggs {
+		var v any = true
+		if !c.star {
+			v = eval(c.args[0], s)
+		}
+		g.accs[i].add(v)
+	}
+}
+
+// newGroup returns a group with the given keys and fresh accumulators.
+func (x *Executor) newGroup(keys []any) *group {
+	g := &group{keys: keys, accs: make([]accumulator, len(x.q.aggs))}
+	for i, c := range x.q.aggs {
+		g.accs[i] = aggregates[c.name](c)
+	}
+	return g
+}
+
+// row returns the select list's values in s; entry supplies the fields of
+// *.
+func (x *Executor) row(entry *parser.LogEntry, s scope) Row {
+	row := make(Row, 0, len(x.q.items))
+	for _, it := range x.q.items {
+		if it.e != nil {
+			row = append(row, Field{it.name, eval(it.e, s)})
+			continue
+		}
+		for _, k := range entry.Keys() {
+			row = append(row, Field{k, entry.Fields[k]})
+		}
+	}
+	return row
+}
+
+// orderKeys returns the values of the ORDER BY expressions in s.
+func (q *Query) orderKeys(s scope) []any {
+	if len(q.orderBy) == 0 {
+		return nil
+	}
+	keys := make([]any, len(q.orderBy))
+	for i, o := range q.orderBy {
+		keys[i] = eval(o.e, s)
+	}
+	return keys
+}
+
+// sortRows sorts rows by their ORDER BY values. NULL sorts before every
+// other value, and rows that compare equal keep their order.
+func (x *Executor) sortRows(rows []sortedRow) {
+	if len(x.q.orderBy) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, o := range x.q.orderBy {
+			a, b := rows[i].keys[k], rows[j].keys[k]
+			var c int
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				c = -1
+			case b == nil:
+				c = 1
+			default:
+				c = compare(a, b)
+			}
+			if o.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// flush sorts rows and sends them, up to the limit.
+func (x *Executor) flush(rows []sortedRow) {
+	x.sortRows(rows)
+	for _, r := range rows {
+		if !x.send(r.row) {
+			return
+		}
+	}
+}
+
+// send passes row to emit unless the query has stopped, and reports
+// whether more rows are wanted.
+func (x *Executor) send(row Row) bool {
+	if x.stopped {
+		return false
+	}
+	if !x.emit(row) {
+		x.stopped = true
+		return false
+	}
+	x.sent++
+	if x.q.limit >= 0 && x.sent >= x.q.limit {
+		x.stopped = true
+		return false
+	}
+	return true
+}
@@ -0,0 +1,316 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// sample is a small log used by the tests.
+var sample = []*parser.LogEntry{
+	parser.NewEntry(map[string]any{"level": "error", "service": "api", "latency": json.Number("120"), "msg": "timeout calling db"}),
+	parser.NewEntry(map[string]any{"level": "info", "service": "api", "latency": json.Number("12"), "msg": "request served"}),
+	parser.NewEntry(map[string]any{"level": "error", "service": "worker", "latency": json.Number("300"), "msg": "job failed"}),
+	parser.NewEntry(map[string]any{"level": "error", "service": "api", "latency": json.Number("80"), "msg": "timeout calling cache"}),
+	parser.NewEntry(map[string]any{"level": "warn", "service": "worker", "msg": "retrying", "http": map[string]any{"status": json.Number("503")}}),
+}
+
+// run runs src over entries and returns its rows as "name=value" lists.
+func run(t *testing.T, src string, entries []*parser.LogEntry) []string {
+	t.Helper()
+	q, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", src, err)
+	}
+	var rows []string
+	x := q.Executor(func(r Row) bool {
+		parts := make([]string, len(r))
+		for i, f := range r {
+			parts[i] = f.Name + "=" + Text(f.Value)
+		}
+		rows = append(rows, strings.Join(parts, " "))
+		return true
+	})
+	for _, e := range entries {
+		if !x.Add(e) {
+			break
+		}
+	}
+	x.Close()
+	return rows
+}
+
+// =============================================================================
+// Executor
+// =============================================================================
+
+func TestExecutor_GroupByOrderByPosition(t *testing.T) {
+	got := run(t, `SELECT service, count(*) FROM logs WHERE level="error" GROUP BY service ORDER BY 2 DESC`, sample)
+	want := []string{"service=api count(*)=2", "service=worker count(*)=1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestExecutor_Aggregates(t *testing.T) {
+	got := run(t, `select service, sum(latency) total, avg(latency) as mean, min(msg), max(latency), count(latency), count(distinct level)
+		from logs group by service having count(*) > 1 order by total`, sample)
+	want := []string{
+		"service=api total=212 mean=70.66666666666667 min(msg)=request served max(latency)=120 count(latency)=3 count(DISTINCT level)=2",
+		"service=worker total=300 mean=300 min(msg)=job failed max(latency)=300 count(latency)=1 count(DISTINCT level)=2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestExecutor_AggregateOverNoEntries(t *testing.T) {
+	got := run(t, "SELECT count(*), sum(latency) FROM logs", nil)
+	if want := []string{"count(*)=0 sum(latency)=NULL"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestExecutor_AggregatesSkipNull(t *testing.T) {
+	// Two entries lack latency and one has it null; the group b has no
+	// latency at all.
+	entries := []*parser.LogEntry{
+		parser.NewEntry(map[string]any{"g": "a", "latency": json.Number("10")}),
+		parser.NewEntry(map[string]any{"g": "a", "latency": nil}),
+		parser.NewEntry(map[string]any{"g": "a"}),
+		parser.NewEntry(map[string]any{"g": "a", "latency": json.Number("30")}),
+		parser.NewEntry(map[string]any{"g": "b"}),
+		parser.NewEntry(map[string]any{"latency": json.Number("5")}),
+	}
+	tests := []struct {
+		agg  string
+		want []string // one value per group: a, b, then the one without g
+	}{
+		{"count(*)", []string{"4", "1", "1"}},
+		{"count(latency)", []string{"2", "0", "1"}},
+		{"count(DISTINCT latency)", []string{"2", "0", "1"}},
+		{"sum(latency)", []string{"40", "NULL", "5"}},
+		{"avg(latency)", []string{"20", "NULL", "5"}},
+		{"min(latency)", []string{"10", "NULL", "5"}},
+		{"max(latency)", []string{"30", "NULL", "5"}},
+		{"sum(coalesce(latency, 0))", []string{"40", "0", "5"}},
+		{"avg(coalesce(latency, 0))", []string{"10", "0", "5"}},
+	}
+	for _, tt := range tests {
+		got := run(t, "SELECT g, "+tt.agg+" AS v GROUP BY g ORDER BY g", entries)
+		// ORDER BY puts NULL first.
+		want := []string{"g=NULL v=" + tt.want[2], "g=a v=" + tt.want[0], "g=b v=" + tt.want[1]}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: rows = %q, want %q", tt.agg, got, want)
+		}
+	}
+}
+
+func TestExecutor_AggregatesOverMixedValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []any
+		want   string
+	}{
+		{"numbers", []any{json.Number("4"), float64(2)}, "s=6 a=3 lo=2 hi=4 n=2"},
+		{"text spelling a number", []any{"7", json.Number("3")}, "s=10 a=5 lo=3 hi=7 n=2"},
+		{"padded text", []any{" 7 ", json.Number("3")}, "s=10 a=5 lo=3 hi= 7  n=2"},
+		{"text compared as numbers", []any{"10", "9"}, "s=19 a=9.5 lo=9 hi=10 n=2"},
+		{"text not a number", []any{"n/a", json.Number("4"), json.Number("2")}, "s=6 a=3 lo=2 hi=n/a n=3"},
+		{"only text", []any{"n/a", "timeout"}, "s=NULL a=NULL lo=n/a hi=timeout n=2"},
+		{"booleans", []any{true, json.Number("2")}, "s=2 a=2 lo=2 hi=true n=2"},
+		{"objects", []any{map[string]any{"ms": json.Number("1")}, json.Number("2")}, `s=2 a=2 lo=2 hi={"ms":1} n=2`},
+	}
+	for _, tt := range tests {
+		var entries []*parser.LogEntry
+		for _, v := range tt.values {
+			entries = append(entries, parser.NewEntry(map[string]any{"v": v}))
+		}
+		got := run(t, "SELECT sum(v) s, avg(v) a, min(v) lo, max(v) hi, count(v) n", entries)
+		if want := []string{tt.want}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: rows = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestExecutor_StreamsWithLimit(t *testing.T) {
+	q, err := Parse("SELECT msg, latency * 2 AS doubled WHERE latency >= 80 LIMIT 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Streaming() {
+		t.Error("Streaming() = false, want true")
+	}
+	var rows []string
+	x := q.Executor(func(r Row) bool {
+		rows = append(rows, Text(r[0].Value)+" "+Text(r[1].Value))
+		return true
+	})
+	added := 0
+	for _, e := range sample {
+		added++
+		if !x.Add(e) {
+			break
+		}
+	}
+	x.Close()
+	want := []string{"timeout calling db 240", "job failed 600"}
+	if !reflect.DeepEqual(rows, want) || added != 3 {
+		t.Errorf("rows = %q after %d entries, want %q after 3", rows, added, want)
+	}
+}
+
+func TestExecutor_OrderByWithLimit(t *testing.T) {
+	var entries []*parser.LogEntry
+	for i := range 500 {
+		entries = append(entries, parser.NewEntry(map[string]any{"n": float64(i % 250)}))
+	}
+	got := run(t, "SELECT n FROM logs ORDER BY n DESC LIMIT 3", entries)
+	if want := []string{"n=249", "n=249", "n=248"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestExecutor_Star(t *testing.T) {
+	got := run(t, "SELECT *, upper(level) AS lvl FROM logs WHERE msg LIKE 'job%'", sample)
+	if want := []string{"latency=300 level=error msg=job failed service=worker lvl=ERROR"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestExecutor_Predicates(t *testing.T) {
+	tests := []struct {
+		where string
+		want  int
+	}{
+		{`level = 'error' AND NOT service = 'worker'`, 2},
+		{`level IN ('warn', 'info')`, 2},
+		{`level NOT IN ('warn', 'info')`, 3},
+		{`latency IS NULL`, 1},
+		{`latency IS NOT NULL AND latency < 100`, 2},
+		{`latency > 100 OR level = 'warn'`, 3},
+		{`latency != 12`, 3}, // NULL latency is neither equal nor unequal
+		{`msg LIKE '%calling%'`, 2},
+		{`msg NOT LIKE 'timeout _alling %'`, 3},
+		{"`http.status` = 503", 1},
+		{`http.status >= 500`, 1},
+		{`length(msg) = 8`, 1},
+		{`coalesce(latency, 0) = 0`, 1},
+		{`latency = '120'`, 1},
+		{`(latency + 10) / 2 = 65`, 1},
+	}
+	for _, tt := range tests {
+		got := run(t, "SELECT count(*) FROM logs WHERE "+tt.where, sample)
+		if want := []string{"count(*)=" + Text(float64(tt.want))}; !reflect.DeepEqual(got, want) {
+			t.Errorf("WHERE %s: rows = %q, want %q", tt.where, got, want)
+		}
+	}
+}
+
+func TestExecutor_GroupByAlias(t *testing.T) {
+	got := run(t, "SELECT lower(level) AS lvl, count(*) AS n GROUP BY lvl ORDER BY n DESC, lvl", sample)
+	want := []string{"lvl=error n=3", "lvl=info n=1", "lvl=warn n=1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestExecutor_EmitStops(t *testing.T) {
+	q, err := Parse("SELECT msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	x := q.Executor(func(Row) bool { n++; return false })
+	if x.Add(sample[0]) || x.Add(sample[1]) || n != 1 {
+		t.Errorf("Add kept going after emit returned false (%d rows)", n)
+	}
+}
+
+// =============================================================================
+// Parse
+// =============================================================================
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"", "at position 1: expected SELECT, found end of query"},
+		{"SELECT msg FROM events", "at position 17: unknown table \"events\": the entries are the table logs"},
+		{"SELECT msg, count(*) FROM logs", "at position 8: msg must appear in GROUP BY or be used in an aggregate"},
+		{"SELECT * GROUP BY level", "at position 8: * cannot be used with GROUP BY or aggregates"},
+		{"SELECT msg WHERE count(*) > 1", "at position 18: WHERE cannot use an aggregate; use HAVING"},
+		{"SELECT msg WHERE level = 'x' AND max(latency) > 1", "at position 34: WHERE cannot use an aggregate; use HAVING"},
+		{"SELECT count(*) GROUP BY count(*)", "at position 26: GROUP BY cannot use an aggregate"},
+		{"SELECT msg HAVING msg = 'x'", "at position 12: HAVING needs GROUP BY or an aggregate"},
+		{"SELECT sum(count(*))", "at position 12: aggregates cannot be nested"},
+		{"SELECT level GROUP BY level HAVING count(*) > 1 AND avg(1 + max(latency)) > 1", "at position 61: aggregates cannot be nested"},
+		{"SELECT msg ORDER BY 3", "at position 21: ORDER BY position 3 is not in the select list"},
+		{"SELECT median(latency)", "at position 8: unknown function median"},
+		{"SELECT sum(*)", "at position 8: only count accepts *"},
+		{"SELECT msg WHERE level = 'error", "at position 26: unterminated string"},
+		{"SELECT msg WHERE order = 1", "at position 18: unexpected ORDER (quote a field with this name in backquotes)"},
+		{"SELECT msg LIMIT x", "at position 18: expected a row count after LIMIT, found \"x\""},
+		{"SELECT msg WHERE level NOT 'x'", "at position 28: expected LIKE or IN after NOT, found string \"x\""},
+		{"SELECT msg extra junk", "at position 18: unexpected \"junk\""},
+		{"SELECT msg # comment", "at position 12: unexpected character '#'"},
+		{"SELECT (msg", "at position 12: expected ), found end of query"},
+		{"SELECT count(", "at position 14: expected an expression, found end of query"},
+		{"SELECT msg WHERE", "at position 17: expected an expression, found end of query"},
+		{"SELECT msg WHERE level IN 'x'", "at position 27: expected (, found string \"x\""},
+		{"SELECT msg AS", "at position 14: expected a column name after AS, found end of query"},
+		{"SELECT msg, FROM logs", "at position 13: unexpected FROM (quote a field with this name in backquotes)"},
+		{"SELECT msg WHERE `level = 1", "at position 18: unterminated quoted field name"},
+		{"SELECT lower(msg, level)", "at position 8: wrong number of arguments to lower"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var se *SyntaxError
+		if !errors.As(err, &se) || err.Error() != tt.want {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestParse_Columns(t *testing.T) {
+	q, err := Parse("SELECT `user-id`, Lower(msg), level AS lvl, -latency, *, a.b FROM LOGS;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"`user-id`", "lower(msg)", "lvl", "-latency", "*", "a.b"}
+	if got := q.Columns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Columns() = %q, want %q", got, want)
+	}
+}
+
+// =============================================================================
+// likeMatch
+// =============================================================================
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"timeout", "timeout", true},
+		{"timeout", "time%", true},
+		{"timeout", "%out", true},
+		{"timeout", "%me%u%", true},
+		{"timeout", "t_meout", true},
+		{"timeout", "t_out", false},
+		{"héllo", "h_llo", true},
+		{"", "%", true},
+		{"", "_", false},
+		{"aaa", "%a%a%a%a", false},
+		{"Timeout", "timeout", false},
+	}
+	for _, tt := range tests {
+		if got := likeMatch(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("likeMatch(%q, %q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,645 @@
+// Package schema checks log entries against a JSON Schema. It implements
+// the validation keywords that describe the shape of a log entry:
+//
+//   - type, enum and const
+//   - properties, required, additionalProperties, minProperties and
+//     maxProperties
+//   - items, minItems and maxItems
+//   - minLength, maxLength and pattern
+//   - minimum, maximum, exclusiveMinimum, exclusiveMaximum and multipleOf
+//   - allOf, anyOf, oneOf and not
+//   - $ref to a location in the same document, such as "#/$defs/level"
+//
+// Boolean schemas are accepted wherever a schema is. Other keywords,
+// including format, are annotations as far as this package is concerned
+// and are ignored, as are the "$schema" and "$id" declarations.
+//
+// Numbers are compared exactly, whether they are held as json.Number or as
+// a Go numeric type, so an integer beyond 2^53 is still an integer. Values
+// parsed from logfmt are strings, apart from bare keys, which are true.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	// allow, when non-nil, makes this a boolean schema that accepts
+	// everything (true) or nothing (false).
+	allow *bool
+
+	types    []string
+	enum     []any
+	constant any
+	hasConst bool
+
+	properties    map[string]*Schema
+	required      []string
+	additional    *Schema
+	minProperties int
+	maxProperties int
+
+	items    *Schema
+	minItems int
+	maxItems int
+
+	minLength int
+	maxLength int
+	pattern   *regexp.Regexp
+
+	minimum, maximum                   *big.Rat
+	exclusiveMinimum, exclusiveMaximum *big.Rat
+	multipleOf                         *big.Rat
+
+	allOf, anyOf, oneOf []*Schema
+	not                 *Schema
+	ref                 *Schema
+}
+
+// Violation describes one way in which a value fails a schema.
+type Violation struct {
+	// Path is the JSON Pointer of the offending value within the value
+	// validated, such as "/user/id"; "" is the value itself.
+	Path    string
+	Message string
+}
+
+// String returns the violation as "path: message", with "/" standing for
+// the value itself.
+func (v Violation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + v.Message
+}
+
+// Compile parses a JSON Schema document.
+func Compile(data []byte) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+	c := &compiler{root: doc, refs: make(map[string]*Schema)}
+	s, err := c.compile(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compiler compiles the schemas of one document.
+type compiler struct {
+	root any
+	refs map[string]*Schema // compiled $ref targets, by JSON Pointer
+}
+
+// compile compiles the schema node found at ptr in the document.
+func (c *compiler) compile(node any, ptr string) (*Schema, error) {
+	s := &Schema{minProperties: -1, maxProperties: -1, minItems: -1, maxItems: -1, minLength: -1, maxLength: -1}
+	if b, ok := node.(bool); ok {
+		s.allow = &b
+		return s, nil
+	}
+	obj, ok := node.(map[string]any)
+	if !ok {
+		return nil, schemaError(ptr, "a schema must be an object or a boolean")
+	}
+
+	var err error
+	if t, ok := obj["type"]; ok {
+		if s.types, err = typeNames(t); err != nil {
+			return nil, schemaError(ptr+"/type", err.Error())
+		}
+	}
+	if e, ok := obj["enum"]; ok {
+		if s.enum, ok = e.([]any); !ok {
+			return nil, schemaError(ptr+"/enum", "must be an array")
+		}
+	}
+	s.constant, s.hasConst = obj["const"]
+
+	if p, ok := obj["properties"]; ok {
+		props, ok := p.(map[string]any)
+		if !ok {
+			return nil, schemaError(ptr+"/properties", "must be an object")
+		}
+		s.properties = make(map[string]*Schema, len(props))
+		for name, sub := range props {
+			if s.properties[name], err = c.compile(sub, ptr+"/properties/"+escapePointer(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if r, ok := obj["required"]; ok {
+		names, ok := r.([]any)
+		if !ok {
+			return nil, schemaError(ptr+"/required", "must be an array of strings")
+		}
+		for _, n := range names {
+			name, ok := n.(string)
+			if !ok {
+				return nil, schemaError(ptr+"/required", "must be an array of strings")
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	if s.additional, err = c.subschema(obj, "additionalProperties", ptr); err != nil {
+		return nil, err
+	}
+	if s.items, err = c.subschema(obj, "items", ptr); err != nil {
+		return nil, err
+	}
+	if s.not, err = c.subschema(obj, "not", ptr); err != nil {
+		return nil, err
+	}
+	for _, kw := range []struct {
+		name string
+		dst  *[]*Schema
+	}{{"allOf", &s.allOf}, {"anyOf", &s.anyOf}, {"oneOf", &s.oneOf}} {
+		if *kw.dst, err = c.subschemas(obj, kw.name, ptr); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, kw := range []struct {
+		name string
+		dst  *int
+	}{
+		{"minProperties", &s.minProperties}, {"maxProperties", &s.maxProperties},
+		{"minItems", &s.minItems}, {"maxItems", &s.maxItems},
+		{"minLength", &s.minLength}, {"maxLength", &s.maxLength},
+	} {
+		if *kw.dst, err = count(obj, kw.name, ptr); err != nil {
+			return nil, err
+		}
+	}
+	for _, kw := range []struct {
+		name string
+		dst  **big.Rat
+	}{
+		{"minimum", &s.minimum}, {"maximum", &s.maximum},
+		{"exclusiveMinimum", &s.exclusiveMinimum}, {"exclusiveMaximum", &s.exclusiveMaximum},
+		{"multipleOf", &s.multipleOf},
+	} {
+		v, ok := obj[kw.name]
+		if !ok {
+			continue
+		}
+		if *kw.dst, ok = toRat(v); !ok {
+			return nil, schemaError(ptr+"/"+kw.name, "must be a number")
+		}
+	}
+	if s.multipleOf != nil && s.multipleOf.Sign() <= 0 {
+		return nil, schemaError(ptr+"/multipleOf", "must be greater than 0")
+	}
+
+	if p, ok := obj["pattern"]; ok {
+		expr, ok := p.(string)
+		if !ok {
+			return nil, schemaError(ptr+"/pattern", "must be a string")
+		}
+		if s.pattern, err = regexp.Compile(expr); err != nil {
+			return nil, schemaError(ptr+"/pattern", err.Error())
+		}
+	}
+
+	if r, ok := obj["$ref"]; ok {
+		ref, ok := r.(string)
+		if !ok {
+			return nil, schemaError(ptr+"/$ref", "must be a string")
+		}
+		if s.ref, err = c.resolve(ref); err != nil {
+			return nil, schemaError(ptr+"/$ref", err.Error())
+		}
+	}
+	return s, nil
+}
+
+// subschema compiles the schema held by keyword name of obj, if any.
+func (c *compiler) subschema(obj map[string]any, name, ptr string) (*Schema, error) {
+	node, ok := obj[name]
+	if !ok {
+		return nil, nil
+	}
+	return c.compile(node, ptr+"/"+name)
+}
+
+// subschemas compiles the array of schemas held by keyword name of obj.
+func (c *compiler) subschemas(obj map[string]any, name, ptr string) ([]*Schema, error) {
+	node, ok := obj[name]
+	if !ok {
+		return nil, nil
+	}
+	nodes, ok := node.([]any)
+	if !ok || len(nodes) == 0 {
+		return nil, schemaError(ptr+"/"+name, "must be a non-empty array of schemas")
+	}
+	out := make([]*Schema, len(nodes))
+	for i, n := range nodes {
+		var err error
+		if out[i], err = c.compile(n, ptr+"/"+name+"/"+strconv.Itoa(i)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// resolve returns the compiled schema that ref, a URI fragment holding a
+// JSON Pointer into the document, refers to.
+func (c *compiler) resolve(ref string) (*Schema, error) {
+	frag, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("unsupported reference %q: only references within the schema, starting with #, are supported", ref)
+	}
+	ptr, err := url.PathUnescape(frag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference %q", ref)
+	}
+	if s, ok := c.refs[ptr]; ok {
+		return s, nil
+	}
+	node := c.root
+	if ptr != "" {
+		if !strings.HasPrefix(ptr, "/") {
+			return nil, fmt.Errorf("unsupported reference %q: anchors are not supported", ref)
+		}
+		for _, tok := range strings.Split(ptr[1:], "/") {
+			tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+			switch n := node.(type) {
+			case map[string]any:
+				node, ok = n[tok]
+			case []any:
+				i, err := strconv.Atoi(tok)
+				ok = err == nil && i >= 0 && i < len(n)
+				if ok {
+					node = n[i]
+				}
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, fmt.Errorf("reference %q does not resolve", ref)
+			}
+		}
+	}
+	// Register the target before compiling it so that recursive references
+	// find it.
+	s := &Schema{}
+	c.refs[ptr] = s
+	compiled, err := c.compile(node, ptr)
+	if err != nil {
+		return nil, err
+	}
+	*s = *compiled
+	return s, nil
+}
+
+// typeNames returns the type names held by a type keyword.
+func typeNames(v any) ([]string, error) {
+	var names []string
+	switch t := v.(type) {
+	case string:
+		names = []string{t}
+	case []any:
+		for _, n := range t {
+			name, ok := n.(string)
+			if !ok {
+				return nil, errors.New("must be a string or an array of strings")
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, errors.New("must be a string or an array of strings")
+	}
+	for _, n := range names {
+		switch n {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("unknown type %q", n)
+		}
+	}
+	return names, nil
+}
+
+// count returns the non-negative integer held by keyword name of obj, or
+// -1 if it is absent.
+func count(obj map[string]any, name, ptr string) (int, error) {
+	v, ok := obj[name]
+	if !ok {
+		return -1, nil
+	}
+	r, ok := toRat(v)
+	if !ok || !r.IsInt() || r.Sign() < 0 || !r.Num().IsInt64() {
+		return 0, schemaError(ptr+"/"+name, "must be a non-negative integer")
+	}
+	return int(r.Num().Int64()), nil
+}
+
+// schemaError returns the error for a problem with the schema at ptr.
+func schemaError(ptr, msg string) error {
+	if ptr == "" {
+		ptr = "/"
+	}
+	return fmt.Errorf("invalid schema at %s: %s", ptr, msg)
+}
+
+// Validate checks v, typically a *parser.LogEntry, against s and returns
+// every violation found, or nil if v conforms.
+func (s *Schema) Validate(v any) []Violation {
+	var out []Violation
+	s.validate(v, "", &out)
+	return out
+}
+
+// valid reports whether v conforms to s.
+func (s *Schema) valid(v any) bool {
+	var out []Violation
+	s.validate(v, "", &out)
+	return len(out) == 0
+}
+
+// validate appends the violations of s by v, found at path, to out.
+func (s *Schema) validate(v any, path string, out *[]Violation) {
+	add := func(format string, args ...any) {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.allow != nil {
+		if !*s.allow {
+			add("no value is allowed here")
+		}
+		return
+	}
+	if s.ref != nil {
+		s.ref.validate(v, path, out)
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return hasType(v, t) }) {
+		add("expected %s, got %s", strings.Join(s.types, " or "), typeOf(v))
+		// The remaining keywords would only repeat the mismatch.
+		return
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return equal(v, e) }) {
+		choices := make([]string, len(s.enum))
+		for i, e := range s.enum {
+			choices[i] = display(e)
+		}
+		add("value %s is not one of %s", display(v), strings.Join(choices, ", "))
+	}
+	if s.hasConst && !equal(v, s.constant) {
+		add("value %s is not %s", display(v), display(s.constant))
+	}
+
+	switch v := v.(type) {
+	case string:
+		s.validateString(v, add)
+	case []any:
+		s.validateArray(v, path, out, add)
+	default:
+		if keys, get, ok := objectOf(v); ok {
+			s.validateObject(keys, get, path, out, add)
+		} else if r, ok := toRat(v); ok {
+			s.validateNumber(r, add)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, out)
+	}
+	if s.anyOf != nil && !slices.ContainsFunc(s.anyOf, func(sub *Schema) bool { return sub.valid(v) }) {
+		add("value matches none of the anyOf schemas")
+	}
+	if s.oneOf != nil {
+		n := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(v) {
+				n++
+			}
+		}
+		if n != 1 {
+			add("value matches %d of the oneOf schemas, want exactly 1", n)
+		}
+	}
+	if s.not != nil && s.not.valid(v) {
+		add("value matches the schema it must not match")
+	}
+}
+
+// validateString checks the string keywords of s against v.
+func (s *Schema) validateString(v string, add func(string, ...any)) {
+	n := utf8.RuneCountInString(v)
+	if s.minLength >= 0 && n < s.minLength {
+		add("string is %d characters long, shorter than the minimum %d", n, s.minLength)
+	}
+	if s.maxLength >= 0 && n > s.maxLength {
+		add("string is %d characters long, longer than the maximum %d", n, s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(v) {
+		add("string %s does not match pattern %s", display(v), display(s.pattern.String()))
+	}
+}
+
+// validateArray checks the array keywords of s against v, found at path.
+func (s *Schema) validateArray(v []any, path string, out *[]Violation, add func(string, ...any)) {
+	if s.minItems >= 0 && len(v) < s.minItems {
+		add("array has %d items, fewer than the minimum %d", len(v), s.minItems)
+	}
+	if s.maxItems >= 0 && len(v) > s.maxItems {
+		add("array has %d items, more than the maximum %d", len(v), s.maxItems)
+	}
+	if s.items != nil {
+		for i, item := range v {
+			s.items.validate(item, path+"/"+strconv.Itoa(i), out)
+		}
+	}
+}
+
+// validateObject checks the object keywords of s against the object with
+// the given keys, found at path.
+func (s *Schema) validateObject(keys []string, get func(string) (any, bool), path string, out *[]Violation, add func(string, ...any)) {
+	if s.minProperties >= 0 && len(keys) < s.minProperties {
+		add("object has %d properties, fewer than the minimum %d", len(keys), s.minProperties)
+	}
+	if s.maxProperties >= 0 && len(keys) > s.maxProperties {
+		add("object has %d properties, more than the maximum %d", len(keys), s.maxProperties)
+	}
+	for _, name := range s.required {
+		if _, ok := get(name); !ok {
+			*out = append(*out, Violation{Path: path + "/" + escapePointer(name), Message: "required property is missing"})
+		}
+	}
+	for _, k := range keys {
+		val, _ := get(k)
+		sub, declared := s.properties[k]
+		if !declared {
+			sub = s.additional
+		}
+		if sub != nil {
+			sub.validate(val, path+"/"+escapePointer(k), out)
+		}
+	}
+}
+
+// validateNumber checks the numeric keywords of s against v.
+func (s *Schema) validateNumber(v *big.Rat, add func(string, ...any)) {
+	if s.minimum != nil && v.Cmp(s.minimum) < 0 {
+		add("value %s is less than the minimum %s", ratString(v), ratString(s.minimum))
+	}
+	if s.maximum != nil && v.Cmp(s.maximum) > 0 {
+		add("value %s is greater than the maximum %s", ratString(v), ratString(s.maximum))
+	}
+	if s.exclusiveMinimum != nil && v.Cmp(s.exclusiveMinimum) <= 0 {
+		add("value %s is not greater than %s", ratString(v), ratString(s.exclusiveMinimum))
+	}
+	if s.exclusiveMaximum != nil && v.Cmp(s.exclusiveMaximum) >= 0 {
+		add("value %s is not less than %s", ratString(v), ratString(s.exclusiveMaximum))
+	}
+	if s.multipleOf != nil && !new(big.Rat).Quo(v, s.multipleOf).IsInt() {
+		add("value %s is not a multiple of %s", ratString(v), ratString(s.multipleOf))
+	}
+}
+
+// objectOf returns the keys of v, in order, and a lookup function for its
+// members, if v is an object. The keys of a *parser.LogEntry come in input
+// order, and those of a map in sorted order.
+func objectOf(v any) (keys []string, get func(string) (any, bool), ok bool) {
+	switch m := v.(type) {
+	case *parser.LogEntry:
+		return m.Keys(), func(k string) (any, bool) { val, ok := m.Fields[k]; return val, ok }, true
+	case map[string]any:
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys, func(k string) (any, bool) { val, ok := m[k]; return val, ok }, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// toRat returns the exact value of v if it is a number.
+func toRat(v any) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(n.String())
+	case float64:
+		r := new(big.Rat)
+		if r.SetFloat64(n) == nil {
+			return nil, false
+		}
+		return r, true
+	case float32:
+		return toRat(float64(n))
+	case int:
+		return new(big.Rat).SetInt64(int64(n)), true
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	default:
+		return nil, false
+	}
+}
+
+// typeOf returns the JSON Schema type of v, using "integer" for numbers
+// without a fractional part.
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	if _, _, ok := objectOf(v); ok {
+		return "object"
+	}
+	if r, ok := toRat(v); ok {
+		if r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// hasType reports whether v is of the JSON Schema type t.
+func hasType(v any, t string) bool {
+	got := typeOf(v)
+	return got == t || t == "number" && got == "integer"
+}
+
+// equal reports whether a and b are the same JSON value. Numbers are equal
+// if their values are, however they are written.
+func equal(a, b any) bool {
+	if ra, ok := toRat(a); ok {
+		rb, ok := toRat(b)
+		return ok && ra.Cmp(rb) == 0
+	}
+	if sa, ok := a.([]any); ok {
+		sb, ok := b.([]any)
+		return ok && slices.EqualFunc(sa, sb, equal)
+	}
+	if ka, geta, ok := objectOf(a); ok {
+		kb, getb, ok := objectOf(b)
+		if !ok || len(ka) != len(kb) {
+			return false
+		}
+		for _, k := range ka {
+			va, _ := geta(k)
+			vb, ok := getb(k)
+			if !ok || !equal(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+	switch a.(type) {
+	case nil, bool, string:
+		return a == b
+	}
+	return false
+}
+
+// display returns v as compact JSON for use in a message.
+func display(v any) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// ratString formats r as a decimal number.
+func ratString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	f, _ := r.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// escapePointer escapes name for use as a JSON Pointer reference token.
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
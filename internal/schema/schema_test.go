@@ -0,0 +1,219 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tylermac92/logpipe/parser"
+)
+
+// mustCompile compiles src or fails the test.
+func mustCompile(t *testing.T, src string) *Schema {
+	t.Helper()
+	s, err := Compile([]byte(src))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return s
+}
+
+// violations returns the violations of v as "path: message" strings.
+func violations(s *Schema, v any) []string {
+	var out []string
+	for _, viol := range s.Validate(v) {
+		out = append(out, viol.String())
+	}
+	return out
+}
+
+// entry parses a JSON object as the JSON parser does.
+func entry(t *testing.T, src string) *parser.LogEntry {
+	t.Helper()
+	var e *parser.LogEntry
+	if err := json.Unmarshal([]byte(src), &e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+const contract = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["time", "level", "msg"],
+	"properties": {
+		"time": {"type": "string", "pattern": "^\\d{4}-\\d{2}-\\d{2}T"},
+		"level": {"$ref": "#/$defs/level"},
+		"msg": {"type": "string", "minLength": 1},
+		"status": {"type": "integer", "minimum": 100, "exclusiveMaximum": 600},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+	},
+	"additionalProperties": {"type": ["string", "number", "boolean"]},
+	"$defs": {
+		"level": {"enum": ["debug", "info", "warn", "error"]}
+	}
+}`
+
+// =============================================================================
+// Validate
+// =============================================================================
+
+func TestValidate_ConformingEntry(t *testing.T) {
+	s := mustCompile(t, contract)
+	e := entry(t, `{"time":"2024-01-15T10:00:00Z","level":"info","msg":"ok","status":200,"tags":["a"],"user":"u1"}`)
+	if got := violations(s, e); got != nil {
+		t.Errorf("violations = %q, want none", got)
+	}
+}
+
+func TestValidate_ReportsEachViolationWithPath(t *testing.T) {
+	s := mustCompile(t, contract)
+	e := entry(t, `{"time":"yesterday","level":"verbose","status":600,"tags":["a",2,"c"],"extra":{"k":1}}`)
+	want := []string{
+		"/msg: required property is missing",
+		`/time: string "yesterday" does not match pattern "^\\d{4}-\\d{2}-\\d{2}T"`,
+		`/level: value "verbose" is not one of "debug", "info", "warn", "error"`,
+		"/status: value 600 is not less than 600",
+		"/tags: array has 3 items, more than the maximum 2",
+		"/tags/1: expected string, got integer",
+		"/extra: expected string or number or boolean, got object",
+	}
+	got := violations(s, e)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidate_Types(t *testing.T) {
+	tests := []struct {
+		typ  string
+		v    any
+		want bool
+	}{
+		{"integer", json.Number("1704067200123456789"), true},
+		{"integer", json.Number("1.0"), true},
+		{"integer", json.Number("1.5"), false},
+		{"integer", 3.0, true},
+		{"number", json.Number("1.5"), true},
+		{"number", "1.5", false},
+		{"string", "x", true},
+		{"boolean", true, true},
+		{"null", nil, true},
+		{"array", []any{}, true},
+		{"object", map[string]any{}, true},
+		{"object", parser.NewEntry(nil), true},
+	}
+	for _, tt := range tests {
+		s := mustCompile(t, `{"type":"`+tt.typ+`"}`)
+		if got := len(s.Validate(tt.v)) == 0; got != tt.want {
+			t.Errorf("%s against %#v: valid = %v, want %v", tt.typ, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_NumbersComparedExactly(t *testing.T) {
+	s := mustCompile(t, `{"maximum": 9007199254740993}`)
+	if got := violations(s, json.Number("9007199254740994")); len(got) != 1 {
+		t.Errorf("violations = %q, want one", got)
+	}
+	if got := violations(s, json.Number("9007199254740993")); got != nil {
+		t.Errorf("violations = %q, want none", got)
+	}
+	if got := violations(mustCompile(t, `{"multipleOf": 0.1}`), json.Number("0.3")); got != nil {
+		t.Errorf("0.3 multipleOf 0.1: violations = %q, want none", got)
+	}
+}
+
+func TestValidate_EnumAndConst_CompareNumbersByValue(t *testing.T) {
+	s := mustCompile(t, `{"properties":{"v":{"const":1}},"additionalProperties":{"enum":[[1,"a"],{"k":2}]}}`)
+	ok := entry(t, `{"v":1.0,"a":[1.0,"a"],"b":{"k":2e0}}`)
+	if got := violations(s, ok); got != nil {
+		t.Errorf("violations = %q, want none", got)
+	}
+	bad := entry(t, `{"v":2,"a":[1,"b"]}`)
+	want := []string{"/v: value 2 is not 1", `/a: value [1,"b"] is not one of [1,"a"], {"k":2}`}
+	if got := violations(s, bad); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations = %q, want %q", got, want)
+	}
+}
+
+func TestValidate_Combinators(t *testing.T) {
+	s := mustCompile(t, `{"anyOf":[{"type":"string"},{"type":"integer"}],"oneOf":[{"minimum":0},{"maximum":10}],"not":{"const":"x"}}`)
+	tests := []struct {
+		v    any
+		want []string
+	}{
+		{json.Number("20"), nil},
+		{json.Number("5"), []string{"/: value matches 2 of the oneOf schemas, want exactly 1"}},
+		// Numeric keywords do not apply to other types, so both oneOf
+		// schemas match anything that is not a number.
+		{true, []string{"/: value matches none of the anyOf schemas", "/: value matches 2 of the oneOf schemas, want exactly 1"}},
+		{"x", []string{"/: value matches 2 of the oneOf schemas, want exactly 1", "/: value matches the schema it must not match"}},
+	}
+	for _, tt := range tests {
+		if got := violations(s, tt.v); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%v: violations = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_BooleanSchemas(t *testing.T) {
+	s := mustCompile(t, `{"properties":{"a":true},"additionalProperties":false}`)
+	got := violations(s, parser.NewEntry(map[string]any{"a": 1.0, "b/c": "x"}))
+	if strings.Join(got, "|") != "/b~1c: no value is allowed here" {
+		t.Errorf("violations = %q", got)
+	}
+}
+
+func TestValidate_RecursiveRef(t *testing.T) {
+	s := mustCompile(t, `{"$defs":{"node":{"type":"object","properties":{"child":{"$ref":"#/$defs/node"}},"required":["id"]}},"$ref":"#/$defs/node"}`)
+	got := violations(s, map[string]any{"id": 1.0, "child": map[string]any{"child": map[string]any{}}})
+	want := []string{"/child/id: required property is missing", "/child/child/id: required property is missing"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations = %q, want %q", got, want)
+	}
+}
+
+func TestValidate_StringLengthCountsCharacters(t *testing.T) {
+	s := mustCompile(t, `{"maxLength": 2}`)
+	if got := violations(s, "éé"); got != nil {
+		t.Errorf("violations = %q, want none", got)
+	}
+	if got := violations(s, "abc"); len(got) != 1 {
+		t.Errorf("violations = %q, want one", got)
+	}
+}
+
+// =============================================================================
+// Compile
+// =============================================================================
+
+func TestCompile_InvalidSchemas(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`[]`, "invalid schema at /: a schema must be an object or a boolean"},
+		{`{"type":"text"}`, `invalid schema at /type: unknown type "text"`},
+		{`{"properties":{"a":{"pattern":"("}}}`, "invalid schema at /properties/a/pattern: "},
+		{`{"minLength":-1}`, "invalid schema at /minLength: must be a non-negative integer"},
+		{`{"multipleOf":0}`, "invalid schema at /multipleOf: must be greater than 0"},
+		{`{"anyOf":[]}`, "invalid schema at /anyOf: must be a non-empty array of schemas"},
+		{`{"$ref":"#/$defs/missing"}`, `invalid schema at /$ref: reference "#/$defs/missing" does not resolve`},
+		{`{"$ref":"other.json"}`, "invalid schema at /$ref: unsupported reference"},
+		{`{"type":`, "parsing schema: "},
+	}
+	for _, tt := range tests {
+		_, err := Compile([]byte(tt.src))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Compile(%s) error = %v, want prefix %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestCompile_IgnoresUnknownKeywords(t *testing.T) {
+	s := mustCompile(t, `{"$id":"https://example.com/log","title":"log","format":"date-time","x-owner":"team"}`)
+	if got := violations(s, "not a date"); got != nil {
+		t.Errorf("violations = %q, want none", got)
+	}
+}
@@ -0,0 +1,175 @@
+// Package stack recognizes the frames of stack traces as Java and other
+// JVM languages, JavaScript, Python and Go print them, so that long traces
+// can be folded down to the frames nearest where they were raised and
+// grouped by the frame they were raised in. Lines that are not frames, such
+// as exception messages, "Caused by:" lines and goroutine headers, are left
+// as they are.
+package stack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// frame is a stack frame that spans lines[start:end] of a trace.
+type frame struct {
+	start, end int
+	name       string // the function and location, such as "main.run (/app/main.go:42)"
+	python     bool   // whether the trace lists its innermost frame last
+}
+
+// frames returns the frames found among lines, in order.
+func frames(lines []string) []frame {
+	var out []frame
+	for i := 0; i < len(lines); {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(trimmed, "at "):
+			// Java: "\tat com.example.Foo.bar(Foo.java:42)"
+			// JavaScript: "    at handler (/app/server.js:10:5)"
+			out = append(out, frame{start: i, end: i + 1, name: strings.TrimSpace(trimmed[3:])})
+			i++
+		case strings.HasPrefix(trimmed, `File "`):
+			// Python: `  File "app.py", line 10, in handler` followed by
+			// the line of code, indented further.
+			end := i + 1
+			for end < len(lines) && indentation(lines[end]) > indentation(lines[i]) &&
+				!strings.HasPrefix(strings.TrimSpace(lines[end]), `File "`) {
+				end++
+			}
+			out = append(out, frame{start: i, end: end, name: pythonName(trimmed), python: true})
+			i = end
+		case trimmed != "" && i+1 < len(lines) && goLocation(lines[i+1]):
+			// Go: "main.handler(0xc000012345)" followed by
+			// "\t/app/main.go:42 +0x1d".
+			out = append(out, frame{start: i, end: i + 2, name: goName(trimmed, lines[i+1])})
+			i += 2
+		default:
+			i++
+		}
+	}
+	return out
+}
+
+// indentation returns the number of spaces and tabs line starts with.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// pythonName returns the function and location of a Python frame line,
+// such as "handler (app.py:10)", or the line itself when it is not in the
+// usual form.
+func pythonName(line string) string {
+	rest := strings.TrimPrefix(line, `File "`)
+	file, rest, ok := strings.Cut(rest, `"`)
+	if !ok {
+		return line
+	}
+	rest, fn, _ := strings.Cut(rest, ", in ")
+	lineNo := strings.TrimPrefix(rest, ", line ")
+	if _, err := strconv.Atoi(lineNo); err != nil || fn == "" {
+		return line
+	}
+	return fmt.Sprintf("%s (%s:%s)", fn, file, lineNo)
+}
+
+// goLocation reports whether line is the location line of a Go frame: a
+// tab, a .go file and its line number, and perhaps a program counter
+// offset.
+func goLocation(line string) bool {
+	if !strings.HasPrefix(line, "\t") {
+		return false
+	}
+	loc, _, _ := strings.Cut(strings.TrimSpace(line), " +0x")
+	file, n, ok := strings.Cut(loc, ".go:")
+	if !ok || file == "" {
+		return false
+	}
+	_, err := strconv.Atoi(n)
+	return err == nil
+}
+
+// goName returns the function and location of a Go frame, such as
+// "main.handler (/app/main.go:42)", without the function's arguments and
+// the program counter offset.
+func goName(fn, loc string) string {
+	if strings.HasSuffix(fn, ")") {
+		if i := strings.LastIndex(fn, "("); i > 0 {
+			fn = fn[:i]
+		}
+	}
+	loc, _, _ = strings.Cut(strings.TrimSpace(loc), " +0x")
+	return fmt.Sprintf("%s (%s)", fn, loc)
+}
+
+// runs splits frames into runs of frames that follow one another with no
+// other lines in between.
+func runs(fs []frame) [][]frame {
+	var out [][]frame
+	for i, f := range fs {
+		if i > 0 && fs[i-1].end == f.start && fs[i-1].python == f.python {
+			out[len(out)-1] = append(out[len(out)-1], f)
+		} else {
+			out = append(out, []frame{f})
+		}
+	}
+	return out
+}
+
+// Fold returns lines with each run of more than n stack frames cut down to
+// the n frames nearest where the trace was raised: the first n for most
+// languages, and the last n for Python, which prints its innermost frame
+// last. The frames left out are replaced by a line such as "... 12 more
+// frames", indented like them. When n is not positive, or nothing is
+// folded, lines is returned as it is.
+func Fold(lines []string, n int) []string {
+	if n <= 0 {
+		return lines
+	}
+	var out []string
+	next := 0 // first line of lines not yet copied to out
+	for _, run := range runs(frames(lines)) {
+		if len(run) <= n {
+			continue
+		}
+		dropped := run[n:]
+		if run[0].python {
+			dropped = run[:len(run)-n]
+		}
+		first, last := dropped[0], dropped[len(dropped)-1]
+		noun := "frames"
+		if len(dropped) == 1 {
+			noun = "frame"
+		}
+		line := lines[first.start]
+		out = append(out, lines[next:first.start]...)
+		out = append(out, fmt.Sprintf("%s... %d more %s", line[:indentation(line)], len(dropped), noun))
+		next = last.end
+	}
+	if out == nil {
+		return lines
+	}
+	return append(out, lines[next:]...)
+}
+
+// Top returns the frame of the trace in lines that it was raised in, as
+// its function and location, such as "com.example.Foo.bar(Foo.java:42)" or
+// "handler (app.py:10)". That is the first frame, skipping Go's panic and
+// runtime frames, or for Python the last. It returns false when lines hold
+// no frames.
+func Top(lines []string) (string, bool) {
+	fs := frames(lines)
+	if len(fs) == 0 {
+		return "", false
+	}
+	if fs[0].python {
+		return fs[len(fs)-1].name, true
+	}
+	for _, f := range fs {
+		if !strings.HasPrefix(f.name, "panic ") && !strings.HasPrefix(f.name, "runtime.") {
+			return f.name, true
+		}
+	}
+	return fs[0].name, true
+}
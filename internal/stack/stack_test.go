@@ -0,0 +1,138 @@
+package stack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const javaTrace = `java.lang.IllegalStateException: pool exhausted
+	at com.example.db.Pool.acquire(Pool.java:88)
+	at com.example.db.Client.query(Client.java:41)
+	at com.example.api.Handler.get(Handler.java:17)
+	at com.example.api.Router.dispatch(Router.java:102)
+Caused by: java.net.SocketTimeoutException: connect timed out
+	at java.net.Socket.connect(Socket.java:601)
+	at com.example.db.Pool.open(Pool.java:120)
+	... 4 more`
+
+const pythonTrace = `Traceback (most recent call last):
+  File "app.py", line 30, in <module>
+    main()
+  File "app.py", line 25, in main
+    handle(request)
+  File "handlers.py", line 12, in handle
+    user = users[request.user_id]
+KeyError: 42`
+
+const goTrace = `panic: runtime error: invalid memory address or nil pointer dereference
+
+goroutine 1 [running]:
+panic({0x4a1b20, 0x5c8f40})
+	/usr/local/go/src/runtime/panic.go:785 +0x132
+main.(*Server).handle(0x0, {0x4d2e9a, 0x5})
+	/app/server.go:42 +0x1d
+main.main()
+	/app/main.go:10 +0x25`
+
+func lines(s string) []string {
+	return strings.Split(s, "\n")
+}
+
+// =============================================================================
+// Fold
+// =============================================================================
+
+func TestFold_Java(t *testing.T) {
+	got := Fold(lines(javaTrace), 2)
+	want := []string{
+		"java.lang.IllegalStateException: pool exhausted",
+		"\tat com.example.db.Pool.acquire(Pool.java:88)",
+		"\tat com.example.db.Client.query(Client.java:41)",
+		"\t... 2 more frames",
+		"Caused by: java.net.SocketTimeoutException: connect timed out",
+		"\tat java.net.Socket.connect(Socket.java:601)",
+		"\tat com.example.db.Pool.open(Pool.java:120)",
+		"\t... 4 more",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fold() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFold_PythonKeepsInnermostFrames(t *testing.T) {
+	got := Fold(lines(pythonTrace), 1)
+	want := []string{
+		"Traceback (most recent call last):",
+		"  ... 2 more frames",
+		`  File "handlers.py", line 12, in handle`,
+		"    user = users[request.user_id]",
+		"KeyError: 42",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fold() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFold_Go(t *testing.T) {
+	got := Fold(lines(goTrace), 2)
+	want := lines(`panic: runtime error: invalid memory address or nil pointer dereference
+
+goroutine 1 [running]:
+panic({0x4a1b20, 0x5c8f40})
+	/usr/local/go/src/runtime/panic.go:785 +0x132
+main.(*Server).handle(0x0, {0x4d2e9a, 0x5})
+	/app/server.go:42 +0x1d
+... 1 more frame`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fold() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFold_ShortTraceUnchanged(t *testing.T) {
+	in := lines(javaTrace)
+	if got := Fold(in, 4); !reflect.DeepEqual(got, in) {
+		t.Errorf("Fold() = %q, want the lines unchanged", got)
+	}
+	if got := Fold(in, 0); !reflect.DeepEqual(got, in) {
+		t.Errorf("Fold(0) = %q, want the lines unchanged", got)
+	}
+}
+
+func TestFold_NoFrames(t *testing.T) {
+	in := []string{"failed to connect:", "  dial tcp 10.0.0.5:5432: connection refused"}
+	if got := Fold(in, 1); !reflect.DeepEqual(got, in) {
+		t.Errorf("Fold() = %q, want the lines unchanged", got)
+	}
+}
+
+// =============================================================================
+// Top
+// =============================================================================
+
+func TestTop(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace string
+		want  string
+	}{
+		{"java", javaTrace, "com.example.db.Pool.acquire(Pool.java:88)"},
+		{"javascript", "TypeError: x is undefined\n    at render (/app/view.js:14:9)\n    at main (/app/index.js:3:1)", "render (/app/view.js:14:9)"},
+		{"python", pythonTrace, "handle (handlers.py:12)"},
+		{"go skips panic", goTrace, "main.(*Server).handle (/app/server.go:42)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Top(lines(tt.trace))
+			if !ok || got != tt.want {
+				t.Errorf("Top() = %q, %v, want %q, true", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestTop_NoFrames(t *testing.T) {
+	if got, ok := Top([]string{"something failed", "and then something else did"}); ok {
+		t.Errorf("Top() = %q, true, want false", got)
+	}
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"time"
+)
+
+// BSDSyslogParser parses syslog messages in the older BSD format of
+// RFC 3164, one per line, as traditional syslog daemons write them to
+// /var/log:
+//
+//	<34>Jan  2 15:04:05 web1 sshd[4123]: Accepted publickey for deploy
+//
+// The priority is often left out of files, and without it so are the level
+// and facility. Each message becomes an entry with these fields, in this
+// order:
+//
+//   - time, the timestamp in RFC 3339 form without a UTC offset, as in
+//     "2024-01-02T15:04:05", since the format gives neither a year nor a
+//     time zone;
+//   - level and facility, decoded from the priority as SyslogParser
+//     decodes them;
+//   - host;
+//   - app and pid, from a tag such as "sshd[4123]:" before the message;
+//   - msg, the rest of the line.
+//
+// A timestamp is given the year of Now, or the year before when it would
+// otherwise fall more than a month after Now, as it does for the entries
+// of December read in January. Lines without a timestamp and a host are
+// malformed, and are reported as a *SyntaxError giving the column of the
+// problem.
+type BSDSyslogParser struct {
+	ReadOptions
+	// Now returns the time that decides the year of each timestamp. Nil
+	// means time.Now.
+	Now func() time.Time
+}
+
+// NewBSDSyslogParser returns a new BSDSyslogParser.
+func NewBSDSyslogParser() *BSDSyslogParser {
+	return &BSDSyslogParser{}
+}
+
+// Parse reads BSD syslog messages from r, one per line, emitting each as a
+// LogEntry. Lines that fail to parse are handled according to the OnError
+// policy, and lines longer than MaxLineSize according to the Oversize
+// policy.
+func (p *BSDSyslogParser) Parse(r io.Reader) (<-chan *LogEntry, <-chan error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse, stopping early when ctx is done.
+func (p *BSDSyslogParser) ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error) {
+	out := newOutput(ctx)
+	go func() {
+		defer out.close()
+		p.scan(r, out)
+	}()
+	return out.entries, out.errors
+}
+
+// ParseSeq is the iterator form of Parse; see JSONParser.ParseSeq.
+func (p *BSDSyslogParser) ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error] {
+	return func(yield func(*LogEntry, error) bool) {
+		p.scan(r, &seqOutput{yield: yield})
+	}
+}
+
+// scan parses r, handing the results to out.
+func (p *BSDSyslogParser) scan(r io.Reader, out sink) {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	err := scanLines(r, p.ReadOptions, func(lineNum int, offset int64, raw []byte) error {
+		if out.cancelled() {
+			return errStop
+		}
+		first, rest := cutRecord(raw)
+		line := strings.TrimRight(string(first), "\r")
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+
+		entry, err := ParseBSDSyslog(line, now())
+		if err != nil {
+			return p.malformed(lineNum, offset, raw, err, out)
+		}
+		if len(rest) > 0 {
+			appendLines(entry, bytes.TrimRight(rest, "\r\n"))
+		}
+		p.position(entry, lineNum, offset)
+
+		return out.emit(entry)
+	}, out.report)
+	if err != nil {
+		out.report(fmt.Errorf("reading input: %w", err))
+	}
+}
+
+// ParseBSDSyslog parses a single RFC 3164 syslog message into a LogEntry
+// with the fields described for BSDSyslogParser, taking the year of its
+// timestamp from now. It is what BSDSyslogParser applies to each line of
+// its input. An error is a *SyntaxError.
+func ParseBSDSyslog(line string, now time.Time) (*LogEntry, error) {
+	s := &syslogScanner{line: line}
+	entry := NewOrderedEntry()
+	pri := -1
+	if strings.HasPrefix(line, "<") {
+		var err error
+		if pri, err = s.priority(); err != nil {
+			Release(entry)
+			return nil, err
+		}
+	}
+
+	ts, err := s.bsdTimestamp(now)
+	if err != nil {
+		Release(entry)
+		return nil, err
+	}
+	entry.Set("time", ts.Format("2006-01-02T15:04:05"))
+	if pri >= 0 {
+		setPriority(entry, pri)
+	}
+
+	host, msg, _ := strings.Cut(s.line[s.pos:], " ")
+	if host == "" {
+		Release(entry)
+		return nil, s.fail("missing host")
+	}
+	entry.Set("host", host)
+
+	if app, pid, rest, ok := cutTag(msg); ok {
+		entry.Set("app", app)
+		if pid != "" {
+			entry.Set("pid", pid)
+		}
+		msg = rest
+	}
+	if msg != "" {
+		entry.Set("msg", msg)
+	}
+	return entry, nil
+}
+
+// bsdTimestamp reads a timestamp such as "Jan  2 15:04:05", with the day
+// padded by a space or not, and the space after it, and returns it in the
+// year that puts it at most a month after now.
+func (s *syslogScanner) bsdTimestamp(now time.Time) (time.Time, error) {
+	start := s.pos
+	month, err := s.token("timestamp")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if s.pos < len(s.line) && s.line[s.pos] == ' ' {
+		s.pos++ // the padding of a one-digit day
+	}
+	day, err := s.token("timestamp")
+	if err != nil {
+		return time.Time{}, err
+	}
+	clock, err := s.token("host")
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse("Jan 2 15:04:05", month+" "+day+" "+clock)
+	if err != nil {
+		text := strings.TrimSpace(s.line[start:s.pos])
+		s.pos = start
+		return time.Time{}, s.fail("invalid timestamp %q", text)
+	}
+	year := now.Year()
+	if time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).After(now.AddDate(0, 1, 0)) {
+		year--
+	}
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), nil
+}
+
+// cutTag splits the tag off the start of msg: a name of letters, digits
+// and the characters "-_./", optionally followed by a process ID in
+// brackets, then a colon. ok is false when msg has no tag.
+func cutTag(msg string) (app, pid, rest string, ok bool) {
+	end := strings.IndexByte(msg, ':')
+	if end <= 0 {
+		return "", "", "", false
+	}
+	tag := msg[:end]
+	if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+		tag, pid = tag[:open], tag[open+1:len(tag)-1]
+		if pid == "" || strings.Trim(pid, "0123456789") != "" {
+			return "", "", "", false
+		}
+	}
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./", c)) {
+			return "", "", "", false
+		}
+	}
+	return tag, pid, strings.TrimPrefix(msg[end+1:], " "), true
+}
@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bsdNow is the time BSD syslog tests read their messages at.
+var bsdNow = time.Date(2024, time.January, 15, 12, 0, 0, 0, time.UTC)
+
+// bsdSyslogJSON parses line with ParseBSDSyslog at bsdNow and returns the
+// entry as JSON.
+func bsdSyslogJSON(t *testing.T, line string) string {
+	t.Helper()
+	entry, err := ParseBSDSyslog(line, bsdNow)
+	if err != nil {
+		t.Fatalf("ParseBSDSyslog(%q): %v", line, err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseBSDSyslog_Priority(t *testing.T) {
+	got := bsdSyslogJSON(t, "<34>Jan  2 15:04:05 web1 sshd[4123]: Accepted publickey for deploy")
+	want := `{"time":"2024-01-02T15:04:05","level":"critical","facility":"auth","host":"web1","app":"sshd","pid":"4123","msg":"Accepted publickey for deploy"}`
+	if got != want {
+		t.Errorf("entry =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseBSDSyslog_NoPriority(t *testing.T) {
+	got := bsdSyslogJSON(t, "Jan 2 15:04:05 host app[77]: message")
+	if want := `{"time":"2024-01-02T15:04:05","host":"host","app":"app","pid":"77","msg":"message"}`; got != want {
+		t.Errorf("entry = %s, want %s", got, want)
+	}
+}
+
+func TestParseBSDSyslog_Tags(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"Jan 15 10:00:00 h kernel: eth0 up", `"app":"kernel","msg":"eth0 up"}`},
+		{"Jan 15 10:00:00 h no tag here", `"host":"h","msg":"no tag here"}`},
+		{"Jan 15 10:00:00 h error: a: b", `"app":"error","msg":"a: b"}`},
+		{"Jan 15 10:00:00 h x[abc]: y", `"host":"h","msg":"x[abc]: y"}`},
+		{"Jan 15 10:00:00 h", `"host":"h"}`},
+	}
+	for _, tt := range tests {
+		if got := bsdSyslogJSON(t, tt.line); !strings.HasSuffix(got, tt.want) {
+			t.Errorf("%q: entry = %s, want it to end %s", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseBSDSyslog_Year(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"Feb 14 10:00:00 h m", "2024-02-14T10:00:00"},
+		{"Dec 31 23:59:59 h m", "2023-12-31T23:59:59"},
+	}
+	for _, tt := range tests {
+		entry, err := ParseBSDSyslog(tt.line, bsdNow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Fields["time"] != tt.want {
+			t.Errorf("%q: time = %v, want %s", tt.line, entry.Fields["time"], tt.want)
+		}
+	}
+}
+
+func TestParseBSDSyslog_Malformed(t *testing.T) {
+	tests := []struct {
+		line   string
+		column int
+	}{
+		{"<300>Jan 2 15:04:05 h m", 2},
+		{"Foo 2 15:04:05 h m", 1},
+		{"<13>Jan 2 25:04:05 h m", 5},
+		{"Jan 2 15:04:05", 15},
+		{"Jan 2 15:04:05  m", 16},
+		{"level=info msg=hi", 18},
+	}
+	for _, tt := range tests {
+		_, err := ParseBSDSyslog(tt.line, bsdNow)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseBSDSyslog(%q) error = %v, want a *SyntaxError", tt.line, err)
+			continue
+		}
+		if syntaxErr.Column != tt.column {
+			t.Errorf("ParseBSDSyslog(%q) error = %v, want column %d", tt.line, err, tt.column)
+		}
+	}
+}
+
+func TestBSDSyslogParser_Parse(t *testing.T) {
+	p := &BSDSyslogParser{Now: func() time.Time { return bsdNow }}
+	entries, errs := p.Parse(r("Jan 15 10:00:00 h a: one\nbad\nJan 15 10:00:01 h a: two\n"))
+	got, parseErrs := collectEntries(t, entries, errs)
+	if len(got) != 2 || got[0].Fields["msg"] != "one" || got[1].Fields["time"] != "2024-01-15T10:00:01" {
+		t.Errorf("entries = %v", got)
+	}
+	if len(parseErrs) != 1 || !strings.Contains(parseErrs[0].Error(), "line 2") {
+		t.Errorf("errors = %v, want one for line 2", parseErrs)
+	}
+}
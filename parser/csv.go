@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+)
+
+// CSVParser parses comma- or tab-separated values, one row per line, as
+// audit logs and spreadsheets export them. Each row becomes an entry with
+// a field for each non-empty cell, named after its column and holding the
+// cell's text, in column order. The columns are named by Columns or, when
+// that is empty, by the first non-blank row of the input, the header,
+// which is not itself an entry; a header cell that is empty names
+// its column "colN", N counting from 1.
+//
+// Cells may be quoted as RFC 4180 describes, with "" standing for a quote
+// inside a quoted cell, but a quoted cell cannot span lines. A row with
+// more cells than there are columns, or with a stray quote, is malformed,
+// and is reported as a *SyntaxError giving the column of the problem; a row
+// with fewer cells leaves the fields of the missing ones out.
+type CSVParser struct {
+	ReadOptions
+	// Comma separates the cells of a row. Zero means ','.
+	Comma rune
+	// Columns names the fields of the cells of each row, in column order,
+	// for input without a header row.
+	Columns []string
+}
+
+// NewCSVParser returns a new CSVParser for comma-separated values.
+func NewCSVParser() *CSVParser {
+	return &CSVParser{Comma: ','}
+}
+
+// NewTSVParser returns a new CSVParser for tab-separated values.
+func NewTSVParser() *CSVParser {
+	return &CSVParser{Comma: '\t'}
+}
+
+// Parse reads rows from r, emitting each as a LogEntry. Rows that fail to
+// parse are handled according to the OnError policy, and lines longer than
+// MaxLineSize according to the Oversize policy.
+func (p *CSVParser) Parse(r io.Reader) (<-chan *LogEntry, <-chan error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse, stopping early when ctx is done.
+func (p *CSVParser) ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error) {
+	out := newOutput(ctx)
+	go func() {
+		defer out.close()
+		p.scan(r, out)
+	}()
+	return out.entries, out.errors
+}
+
+// ParseSeq is the iterator form of Parse; see JSONParser.ParseSeq.
+func (p *CSVParser) ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error] {
+	return func(yield func(*LogEntry, error) bool) {
+		p.scan(r, &seqOutput{yield: yield})
+	}
+}
+
+// scan parses r, handing the results to out.
+func (p *CSVParser) scan(r io.Reader, out sink) {
+	comma := p.Comma
+	if comma == 0 {
+		comma = ','
+	}
+	columns := p.Columns
+	err := scanLines(r, p.ReadOptions, func(lineNum int, offset int64, raw []byte) error {
+		if out.cancelled() {
+			return errStop
+		}
+		first, rest := cutRecord(raw)
+		line := strings.TrimRight(string(first), "\r")
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+
+		cells, rr, err := parseCSVRow(line, comma)
+		if err != nil {
+			return p.malformed(lineNum, offset, raw, err, out)
+		}
+		if len(columns) == 0 {
+			columns = make([]string, len(cells))
+			for i, name := range cells {
+				if name == "" {
+					name = fmt.Sprintf("col%d", i+1)
+				}
+				columns[i] = name
+			}
+			return nil
+		}
+		if len(cells) > len(columns) {
+			_, col := rr.FieldPos(len(columns))
+			err := &SyntaxError{Column: col, Msg: fmt.Sprintf("row has %d cells, but there are %d columns", len(cells), len(columns))}
+			return p.malformed(lineNum, offset, raw, err, out)
+		}
+
+		entry := NewOrderedEntry()
+		for i, cell := range cells {
+			if cell != "" {
+				entry.Set(columns[i], cell)
+			}
+		}
+		if len(rest) > 0 {
+			appendLines(entry, bytes.TrimRight(rest, "\r\n"))
+		}
+		p.position(entry, lineNum, offset)
+
+		return out.emit(entry)
+	}, out.report)
+	if err != nil {
+		out.report(fmt.Errorf("reading input: %w", err))
+	}
+}
+
+// parseCSVRow splits line into its cells, separated by comma, and returns
+// them with the reader that read them, for the positions of the cells. An
+// error is a *SyntaxError.
+func parseCSVRow(line string, comma rune) ([]string, *csv.Reader, error) {
+	rr := csv.NewReader(strings.NewReader(line))
+	rr.Comma = comma
+	rr.FieldsPerRecord = -1
+	cells, err := rr.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, nil, &SyntaxError{Column: parseErr.Column, Msg: parseErr.Err.Error()}
+		}
+		return nil, nil, &SyntaxError{Column: 1, Msg: err.Error()}
+	}
+	return cells, rr, nil
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// csvJSON parses input with p and returns each entry as JSON, together
+// with the errors reported.
+func csvJSON(t *testing.T, p *CSVParser, input string) ([]string, []error) {
+	t.Helper()
+	entries, errs := p.Parse(r(input))
+	got, parseErrs := collectEntries(t, entries, errs)
+	var out []string
+	for _, e := range got {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(data))
+	}
+	return out, parseErrs
+}
+
+func TestCSVParser_Header(t *testing.T) {
+	input := "time,level,user,msg\n" +
+		`2024-01-15T10:00:00Z,info,alice,"signed in, via SSO"` + "\r\n" +
+		"\n" +
+		`2024-01-15T10:00:01Z,error,,"said ""no"""` + "\n"
+	got, errs := csvJSON(t, NewCSVParser(), input)
+	want := []string{
+		`{"time":"2024-01-15T10:00:00Z","level":"info","user":"alice","msg":"signed in, via SSO"}`,
+		`{"time":"2024-01-15T10:00:01Z","level":"error","msg":"said \"no\""}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") || len(errs) > 0 {
+		t.Errorf("entries =\n%s\nerrors %v; want\n%s", strings.Join(got, "\n"), errs, strings.Join(want, "\n"))
+	}
+}
+
+func TestCSVParser_Columns(t *testing.T) {
+	p := NewTSVParser()
+	p.Columns = []string{"time", "level", "msg"}
+	p.Positions = true
+	got, errs := csvJSON(t, p, "2024-01-15T10:00:00Z\twarn\tdisk low\n2024-01-15T10:00:01Z\tinfo\n")
+	want := []string{
+		`{"time":"2024-01-15T10:00:00Z","level":"warn","msg":"disk low","_line":1,"_offset":0}`,
+		`{"time":"2024-01-15T10:00:01Z","level":"info","_line":2,"_offset":35}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") || len(errs) > 0 {
+		t.Errorf("entries =\n%s\nerrors %v; want\n%s", strings.Join(got, "\n"), errs, strings.Join(want, "\n"))
+	}
+}
+
+func TestCSVParser_EmptyHeaderCell(t *testing.T) {
+	got, _ := csvJSON(t, NewCSVParser(), "a,,c\n1,2,3\n")
+	if want := `{"a":"1","col2":"2","c":"3"}`; len(got) != 1 || got[0] != want {
+		t.Errorf("entries = %v, want %s", got, want)
+	}
+}
+
+func TestCSVParser_Malformed(t *testing.T) {
+	got, errs := csvJSON(t, NewCSVParser(), "a,b\n1,2,3\n\"open,4\n5,6\n")
+	if len(got) != 1 || got[0] != `{"a":"5","b":"6"}` {
+		t.Errorf("entries = %v, want only the last row", got)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want 2", errs)
+	}
+	var syntaxErr *SyntaxError
+	if !errors.As(errs[0], &syntaxErr) || syntaxErr.Column != 5 || !strings.Contains(errs[0].Error(), "line 2") {
+		t.Errorf("first error = %v, want a *SyntaxError at line 2, column 5", errs[0])
+	}
+	if !errors.As(errs[1], &syntaxErr) || !strings.Contains(errs[1].Error(), "line 3") {
+		t.Errorf("second error = %v, want a *SyntaxError at line 3", errs[1])
+	}
+}
+
+func TestCSVParser_ParseSeq(t *testing.T) {
+	var got []string
+	for e, err := range NewCSVParser().ParseSeq(r("msg\na\n")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.Fields["msg"].(string))
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Errorf("messages = %v, want [a]", got)
+	}
+}
@@ -0,0 +1,314 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NewEntry returns an entry holding fields, which it takes over. The entry
+// has no recorded field order, so Keys lists its fields alphabetically. A
+// nil fields gives an empty entry.
+func NewEntry(fields map[string]any) *LogEntry {
+	if fields == nil {
+		fields = make(map[string]any)
+	}
+	return &LogEntry{Fields: fields}
+}
+
+// Keys returns the entry's field names. Fields whose input position is known
+// come first, in that order; any others (for example fields added after
+// parsing, or every field of an entry built with NewEntry) follow in
+// alphabetical order. A nil entry has no fields.
+func (e *LogEntry) Keys() []string {
+	if e == nil {
+		return nil
+	}
+	n := len(e.Fields)
+	keys := make([]string, 0, n)
+	for _, k := range e.keys {
+		if _, ok := e.Fields[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == n {
+		return keys
+	}
+
+	known := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		known[k] = true
+	}
+	start := len(keys)
+	for k := range e.Fields {
+		if !known[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys[start:])
+	return keys
+}
+
+// Len returns the number of fields in the entry. A nil entry has none.
+func (e *LogEntry) Len() int {
+	if e == nil {
+		return 0
+	}
+	return len(e.Fields)
+}
+
+// Set assigns value to key. A key that is new to an ordered entry is
+// recorded after the existing ones, so it keeps its insertion position in
+// Keys instead of being sorted with other unordered fields.
+func (e *LogEntry) Set(key string, value any) {
+	if _, exists := e.Fields[key]; !exists && e.keys != nil {
+		e.keys = append(e.keys, key)
+	}
+	e.Fields[key] = value
+}
+
+// Lookup returns the value of the field named by path and whether the
+// entry has it. A path is first taken as a field name; failing that, a path
+// with dots, such as "meta.host" or "items.0.id", is resolved through
+// nested objects by member name and through arrays by index. A field whose
+// own name contains dots, as the structured data fields of SyslogParser
+// do, thus takes precedence over the same path through nested objects.
+func (e *LogEntry) Lookup(path string) (any, bool) {
+	if v, ok := e.Fields[path]; ok {
+		return v, true
+	}
+	first, rest, ok := strings.Cut(path, ".")
+	if !ok {
+		return nil, false
+	}
+	node, ok := e.Fields[first]
+	if !ok {
+		return nil, false
+	}
+	for _, key := range strings.Split(rest, ".") {
+		switch n := node.(type) {
+		case map[string]any:
+			if node, ok = n[key]; !ok {
+				return nil, false
+			}
+		case *LogEntry:
+			if node, ok = n.Fields[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(n) || key[0] == '+' {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// Flatten replaces each field holding a nested object with a field for
+// each of its members, named by its dotted path, such as meta.host for the
+// host member of meta, in the object's place, so that flat formats and
+// column lists reach them by name. Members that are objects themselves are
+// flattened in turn, in alphabetical order unless their order is known;
+// arrays, and objects without members, are kept as they are. A dotted name
+// that is already a field of the entry keeps that field's value.
+func (e *LogEntry) Flatten() {
+	keys := e.Keys()
+	if !slices.ContainsFunc(keys, func(k string) bool { return nestedObject(e.Fields[k]) != nil }) {
+		return
+	}
+	flat := make([]string, 0, len(keys))
+	for _, k := range keys {
+		obj := nestedObject(e.Fields[k])
+		if obj == nil {
+			flat = append(flat, k)
+			continue
+		}
+		delete(e.Fields, k)
+		flat = e.flatten(flat, k, obj)
+	}
+	e.setKeys(flat)
+}
+
+// flatten adds the members of obj to the entry under prefix, appending
+// their names to keys, and returns keys.
+func (e *LogEntry) flatten(keys []string, prefix string, obj *LogEntry) []string {
+	for _, k := range obj.Keys() {
+		name := prefix + "." + k
+		if sub := nestedObject(obj.Fields[k]); sub != nil {
+			keys = e.flatten(keys, name, sub)
+			continue
+		}
+		if _, exists := e.Fields[name]; exists {
+			continue
+		}
+		e.Fields[name] = obj.Fields[k]
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// nestedObject returns v as an entry if it is an object with members, and
+// nil otherwise.
+func nestedObject(v any) *LogEntry {
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) > 0 {
+			return NewEntry(v)
+		}
+	case *LogEntry:
+		if v.Len() > 0 {
+			return v
+		}
+	}
+	return nil
+}
+
+// NewOrderedEntry returns an empty entry that records the order in which
+// fields are first Set, as the entries of the parsers in this package do.
+// It may reuse an entry given to Release.
+func NewOrderedEntry() *LogEntry {
+	e := newEntry()
+	e.keys = make([]string, 0, 8)
+	return e
+}
+
+// setKeys records keys, which must be distinct, as the entry's field order.
+func (e *LogEntry) setKeys(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	e.keys = keys
+}
+
+// MarshalJSON encodes the entry as a JSON object whose members appear in
+// the order given by Keys.
+func (e *LogEntry) MarshalJSON() ([]byte, error) {
+	if e == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range e.Keys() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(e.Fields[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object into the entry and records the order
+// of its top-level members. When the entry is already non-nil its map is
+// reused, as encoding/json does for plain maps; fields it already held are
+// kept unless the object overwrites them. Numbers are decoded as
+// json.Number, as under NumberExact.
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	return e.decode(data, NumberExact)
+}
+
+// decode is UnmarshalJSON with numbers decoded as the mode selects.
+func (e *LogEntry) decode(data []byte, numbers NumberMode) error {
+	m := e.Fields
+	if err := unmarshal(data, &m, numbers); err != nil {
+		return err
+	}
+	e.Fields, e.keys = m, nil
+	if m != nil {
+		e.setKeys(objectKeys(data))
+	}
+	return nil
+}
+
+// unmarshal is json.Unmarshal, decoding numbers into v as the mode selects.
+func unmarshal(data []byte, v any, numbers NumberMode) error {
+	if numbers == NumberFloat {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// Reject anything after the value, as json.Unmarshal does.
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+// objectKeys returns the distinct member names of the top-level JSON object
+// in data, in the order they appear. data must already be known to hold a
+// valid JSON object.
+func objectKeys(data []byte) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case '"':
+			end := i + 1
+			escaped := false
+			for ; end < len(data) && data[end] != '"'; end++ {
+				if data[end] == '\\' {
+					escaped = true
+					end++
+				}
+			}
+			if depth == 1 && end < len(data) && followedByColon(data[end+1:]) {
+				key := string(data[i+1 : end])
+				if escaped {
+					// Let encoding/json resolve escape sequences in the name.
+					if err := json.Unmarshal(data[i:end+1], &key); err != nil {
+						key = string(data[i+1 : end])
+					}
+				}
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			i = end
+		}
+	}
+	return keys
+}
+
+// followedByColon reports whether the first non-whitespace byte of data is a
+// colon, i.e. whether the string just before it was an object member name.
+func followedByColon(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case ':':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
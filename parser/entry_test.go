@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogEntry_Keys_UnorderedEntrySorted(t *testing.T) {
+	e := NewEntry(map[string]any{"msg": "hi", "level": "info", "a": 1})
+	if got := strings.Join(e.Keys(), ","); got != "a,level,msg" {
+		t.Errorf("Keys() = %s, want a,level,msg", got)
+	}
+}
+
+func TestLogEntry_Keys_InputOrder(t *testing.T) {
+	var e *LogEntry
+	if err := json.Unmarshal([]byte(`{"time":"t","msg":"m","level":"l","b":1,"a":2}`), &e); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got := strings.Join(e.Keys(), ","); got != "time,msg,level,b,a" {
+		t.Errorf("Keys() = %s, want input order", got)
+	}
+}
+
+func TestLogEntry_Keys_AddedFieldsAfterOrderedOnes(t *testing.T) {
+	e, _ := ParseLogfmt("z=1 y=2")
+	e.Fields["b"] = "x"
+	e.Fields["a"] = "x"
+	if got := strings.Join(e.Keys(), ","); got != "z,y,a,b" {
+		t.Errorf("Keys() = %s, want z,y,a,b", got)
+	}
+}
+
+func TestLogEntry_Keys_DeletedFieldOmitted(t *testing.T) {
+	e, _ := ParseLogfmt("z=1 y=2 x=3")
+	delete(e.Fields, "y")
+	if got := strings.Join(e.Keys(), ","); got != "z,x" {
+		t.Errorf("Keys() = %s, want z,x", got)
+	}
+}
+
+func TestLogEntry_Set_AppendsToOrder(t *testing.T) {
+	e, _ := ParseLogfmt("z=1 y=2")
+	e.Set("b", "x")
+	e.Set("a", "x")
+	e.Set("z", "changed")
+	if got := strings.Join(e.Keys(), ","); got != "z,y,b,a" {
+		t.Errorf("Keys() = %s, want z,y,b,a", got)
+	}
+	if e.Fields["z"] != "changed" {
+		t.Errorf("z = %v, want changed", e.Fields["z"])
+	}
+}
+
+func TestLogEntry_Lookup(t *testing.T) {
+	var e *LogEntry
+	if err := json.Unmarshal([]byte(`{"meta":{"host":"srv1","tags":["a","b"],"req":{"id":7}},"items":[{"id":"x"}],"a.b":"flat","a":{"b":"nested"}}`), &e); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"meta.host", "srv1", true},
+		{"meta.req.id", "7", true},
+		{"meta.tags.1", "b", true},
+		{"items.0.id", "x", true},
+		{"a.b", "flat", true}, // a field named with dots wins
+		{"meta.missing", "", false},
+		{"meta.tags.2", "", false},
+		{"meta.tags.-1", "", false},
+		{"meta.host.x", "", false},
+		{"missing.x", "", false},
+		{"meta", "map[host:srv1 req:map[id:7] tags:[a b]]", true},
+	}
+	for _, tt := range tests {
+		v, ok := e.Lookup(tt.path)
+		if ok != tt.ok {
+			t.Errorf("Lookup(%q) ok = %v, want %v", tt.path, ok, tt.ok)
+			continue
+		}
+		if ok {
+			if got := fmt.Sprint(v); got != tt.want {
+				t.Errorf("Lookup(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLogEntry_Flatten(t *testing.T) {
+	var e *LogEntry
+	line := `{"time":"t","meta":{"host":"srv1","env":{"region":"eu","zone":"b"},"tags":["x"],"none":{}},"meta.host":"top","msg":"hi"}`
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		t.Fatal(err)
+	}
+	e.Flatten()
+	want := `{"time":"t","meta.env.region":"eu","meta.env.zone":"b","meta.none":{},"meta.tags":["x"],"meta.host":"top","msg":"hi"}`
+	if got, _ := json.Marshal(e); string(got) != want {
+		t.Errorf("flattened = %s, want %s", got, want)
+	}
+	if v, ok := e.Lookup("meta.env.zone"); !ok || v != "b" {
+		t.Errorf("Lookup(meta.env.zone) = %v, %v", v, ok)
+	}
+
+	flat := NewEntry(map[string]any{"a": 1, "b": []any{map[string]any{"c": 2}}})
+	flat.Flatten()
+	if got := strings.Join(flat.Keys(), ","); got != "a,b" {
+		t.Errorf("Keys() of an entry without objects = %s, want a,b", got)
+	}
+}
+
+func TestLogEntry_OrderKeptOutsideFields(t *testing.T) {
+	e, _ := ParseLogfmt("b=2 a=1")
+	if e.Len() != 2 || len(e.Fields) != 2 {
+		t.Errorf("Len() = %d, len(Fields) = %d, want 2", e.Len(), len(e.Fields))
+	}
+	if want := map[string]any{"a": "1", "b": "2"}; !reflect.DeepEqual(e.Fields, want) {
+		t.Errorf("Fields = %v, want %v", e.Fields, want)
+	}
+	if got := strings.Join(e.Keys(), ","); got != "b,a" {
+		t.Errorf("Keys() = %s, want b,a", got)
+	}
+	if NewEntry(map[string]any{"a": 1}).Len() != 1 {
+		t.Error("Len() of an unordered entry should equal len(Fields)")
+	}
+}
+
+func TestLogEntry_MarshalJSON_PreservesOrder(t *testing.T) {
+	var e *LogEntry
+	input := `{"time":"t","msg":"m","level":"l","nested":{"b":1,"a":2}}`
+	if err := json.Unmarshal([]byte(input), &e); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	got, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// Nested objects are plain maps and keep encoding/json's sorted order.
+	want := `{"time":"t","msg":"m","level":"l","nested":{"a":2,"b":1}}`
+	if string(got) != want {
+		t.Errorf("Marshal = %s, want %s", got, want)
+	}
+}
+
+func TestLogEntry_MarshalJSON_Nil(t *testing.T) {
+	var e *LogEntry
+	got, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(got) != "null" {
+		t.Errorf("Marshal(nil) = %s, want null", got)
+	}
+}
+
+func TestLogEntry_MarshalJSON_Indent(t *testing.T) {
+	e, _ := ParseLogfmt("b=1 a=2")
+	got, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		t.Fatalf("MarshalIndent: %v", err)
+	}
+	want := "{\n  \"b\": \"1\",\n  \"a\": \"2\"\n}"
+	if string(got) != want {
+		t.Errorf("MarshalIndent = %q, want %q", got, want)
+	}
+}
+
+func TestLogEntry_UnmarshalJSON_NotAnObject(t *testing.T) {
+	var e *LogEntry
+	if err := json.Unmarshal([]byte(`[1,2]`), &e); err == nil {
+		t.Error("expected error for a JSON array")
+	}
+}
+
+func TestLogEntry_UnmarshalJSON_NumbersKeepPrecision(t *testing.T) {
+	var e *LogEntry
+	if err := json.Unmarshal([]byte(`{"ns":1704067200123456789}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"ns":1704067200123456789}` {
+		t.Errorf("round trip = %s", out)
+	}
+}
+
+func TestObjectKeys(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{}`, ""},
+		{`{"a":1}`, "a"},
+		{`{ "b" : "x:y" , "a" : [ "c", {"d":1} ] }`, "b,a"},
+		{`{"s":"quote \" and \\ backslash","k":{"inner":"v"},"z":null}`, "s,k,z"},
+		{`{"escAped":1,"t\"q":2}`, `escAped,t"q`},
+		{`{"dup":1,"x":2,"dup":3}`, "dup,x"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(objectKeys([]byte(tt.input)), ","); got != tt.want {
+			t.Errorf("objectKeys(%s) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseLogfmt_RecordsKeyOrder(t *testing.T) {
+	e, err := ParseLogfmt("time=t msg=m level=l flag")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(e.Keys(), ","); got != "time,msg,level,flag" {
+		t.Errorf("Keys() = %s, want input order", got)
+	}
+}
+
+func TestLogEntry_UnmarshalJSON_ReusesMapAndResetsOrder(t *testing.T) {
+	e := NewEntry(nil)
+	if err := json.Unmarshal([]byte(`{"b":1,"a":2}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	m := e
+	clear(e.Fields)
+	if err := json.Unmarshal([]byte(`{"z":1,"y":2}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(e.Keys(), ","); got != "z,y" {
+		t.Errorf("Keys() = %s, want z,y", got)
+	}
+	m.Fields["x"] = true
+	if _, ok := e.Fields["x"]; !ok {
+		t.Error("UnmarshalJSON allocated a new map instead of reusing the entry")
+	}
+}
+
+func TestNewOrderedEntry_RecordsSetOrder(t *testing.T) {
+	e := NewOrderedEntry()
+	e.Set("time", "t")
+	e.Set("b", 1)
+	e.Set("a", 2)
+	e.Set("b", 3)
+	if got := strings.Join(e.Keys(), ","); got != "time,b,a" || e.Len() != 3 {
+		t.Errorf("Keys() = %s, Len() = %d, want time,b,a and 3", got, e.Len())
+	}
+}
@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"context"
+	"io"
+	"iter"
+	"strings"
+)
+
+// GCPParser parses newline-delimited JSON exported from Google Cloud
+// Logging, as log sinks write it, and normalizes each Cloud Logging entry
+// into the canonical fields the formatters and filters recognise:
+//
+//   - timestamp becomes time;
+//   - severity becomes a lower-case level, left out for DEFAULT;
+//   - textPayload becomes message;
+//   - the members of jsonPayload become top-level fields;
+//   - the members of labels and httpRequest become top-level fields named
+//     with a "labels." or "httpRequest." prefix.
+//
+// These come first, in that order, followed by the entry's other fields,
+// such as logName and resource, unchanged. A jsonPayload member whose name
+// is already taken keeps a "jsonPayload." prefix. Lines that are not Cloud
+// Logging entries are emitted as JSONParser would emit them.
+type GCPParser struct {
+	ReadOptions
+}
+
+// NewGCPParser returns a new GCPParser.
+func NewGCPParser() *GCPParser {
+	return &GCPParser{}
+}
+
+// Parse reads Cloud Logging entries from r, one JSON object per line, and
+// emits each as a normalized LogEntry. Lines that fail to parse are handled
+// according to the OnError policy, and lines longer than MaxLineSize
+// according to the Oversize policy.
+func (p *GCPParser) Parse(r io.Reader) (<-chan *LogEntry, <-chan error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse, stopping early when ctx is done.
+func (p *GCPParser) ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error) {
+	out := newOutput(ctx)
+	go func() {
+		defer out.close()
+		p.scan(r, out)
+	}()
+	return out.entries, out.errors
+}
+
+// ParseSeq is the iterator form of Parse; see JSONParser.ParseSeq.
+func (p *GCPParser) ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error] {
+	return func(yield func(*LogEntry, error) bool) {
+		p.scan(r, &seqOutput{yield: yield})
+	}
+}
+
+// scan parses r, handing the results to out.
+func (p *GCPParser) scan(r io.Reader, out sink) {
+	scanJSON(r, p.ReadOptions, out, normalizeGCP)
+}
+
+// gcpMarkers are fields of which a Cloud Logging entry has at least one.
+var gcpMarkers = []string{"logName", "jsonPayload", "textPayload", "protoPayload"}
+
+// IsGCPEntry reports whether e looks like a Google Cloud Logging entry: an
+// object with a logName or a jsonPayload, textPayload or protoPayload.
+func IsGCPEntry(e *LogEntry) bool {
+	for _, k := range gcpMarkers {
+		if _, ok := e.Fields[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// gcpPrefixed are the object fields of a Cloud Logging entry whose members
+// are lifted to the top level under a prefix of the field's name.
+var gcpPrefixed = []string{"labels", "httpRequest"}
+
+// normalizeGCP returns the normalized form of the Cloud Logging entry e,
+// decoded from line, releasing e. Other entries are returned unchanged.
+func normalizeGCP(e *LogEntry, line []byte) *LogEntry {
+	if !IsGCPEntry(e) {
+		return e
+	}
+	var members map[string][]string
+	for _, k := range []string{"jsonPayload", "labels", "httpRequest"} {
+		if _, ok := e.Fields[k].(map[string]any); ok {
+			// Nested objects decode to plain maps; recover their order.
+			members = gcpMembers(line)
+			break
+		}
+	}
+	out := NewOrderedEntry()
+	used := make(map[string]bool)
+	if ts, ok := e.Fields["timestamp"]; ok {
+		out.Set("time", ts)
+		used["timestamp"] = true
+	}
+	if sev, ok := e.Fields["severity"].(string); ok {
+		if !strings.EqualFold(sev, "DEFAULT") {
+			out.Set("level", strings.ToLower(sev))
+		}
+		used["severity"] = true
+	}
+	if text, ok := e.Fields["textPayload"]; ok {
+		out.Set("message", text)
+		used["textPayload"] = true
+	}
+
+	if payload, ok := e.Fields["jsonPayload"].(map[string]any); ok {
+		used["jsonPayload"] = true
+		for _, k := range orderedKeys(payload, members["jsonPayload"]) {
+			key := k
+			_, taken := out.Fields[k]
+			if _, top := e.Fields[k]; taken || top && !used[k] {
+				key = "jsonPayload." + k
+			}
+			out.Set(key, payload[k])
+		}
+	}
+	for _, field := range gcpPrefixed {
+		obj, ok := e.Fields[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		used[field] = true
+		for _, k := range orderedKeys(obj, members[field]) {
+			out.Set(field+"."+k, obj[k])
+		}
+	}
+
+	for _, k := range e.Keys() {
+		if !used[k] {
+			if _, taken := out.Fields[k]; !taken {
+				out.Set(k, e.Fields[k])
+			}
+		}
+	}
+	Release(e)
+	return out
+}
+
+// gcpMembers returns, for the jsonPayload, labels and httpRequest objects
+// of the entry in line, their member names in input order. Objects missing
+// from line have no entry.
+func gcpMembers(line []byte) map[string][]string {
+	var raw struct {
+		JSONPayload rawObject `json:"jsonPayload"`
+		Labels      rawObject `json:"labels"`
+		HTTPRequest rawObject `json:"httpRequest"`
+	}
+	if err := unmarshal(line, &raw, NumberFloat); err != nil {
+		return nil
+	}
+	return map[string][]string{
+		"jsonPayload": raw.JSONPayload,
+		"labels":      raw.Labels,
+		"httpRequest": raw.HTTPRequest,
+	}
+}
+
+// rawObject decodes a JSON object into the names of its members, in order.
+// Any other value decodes to nil.
+type rawObject []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (o *rawObject) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		*o = objectKeys(data)
+	}
+	return nil
+}
+
+// orderedKeys returns the keys of m in the given order when it lists them
+// all, and sorted otherwise.
+func orderedKeys(m map[string]any, order []string) []string {
+	if len(order) == len(m) {
+		return order
+	}
+	return NewEntry(m).Keys()
+}
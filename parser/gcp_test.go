@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// gcpJSON parses input with a GCPParser and returns each entry as JSON.
+func gcpJSON(t *testing.T, p *GCPParser, input string) []string {
+	t.Helper()
+	entries, errs := p.Parse(r(input))
+	got, parseErrs := collectEntries(t, entries, errs)
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected errors: %v", parseErrs)
+	}
+	var out []string
+	for _, e := range got {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(data))
+	}
+	return out
+}
+
+func TestGCPParser_JSONPayload_Flattened(t *testing.T) {
+	line := `{"insertId":"abc","jsonPayload":{"message":"charge failed","user":"u1","amount":12.5},` +
+		`"httpRequest":{"requestMethod":"POST","status":502},"resource":{"type":"k8s_container"},` +
+		`"timestamp":"2024-01-15T10:00:00.123Z","severity":"ERROR","labels":{"env":"prod","app":"billing"},` +
+		`"logName":"projects/p/logs/stdout"}` + "\n"
+	got := gcpJSON(t, NewGCPParser(), line)
+	want := `{"time":"2024-01-15T10:00:00.123Z","level":"error","message":"charge failed","user":"u1","amount":12.5,` +
+		`"labels.env":"prod","labels.app":"billing","httpRequest.requestMethod":"POST","httpRequest.status":502,` +
+		`"insertId":"abc","resource":{"type":"k8s_container"},"logName":"projects/p/logs/stdout"}`
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("entry =\n%v\nwant\n%s", got, want)
+	}
+}
+
+func TestGCPParser_TextPayload(t *testing.T) {
+	got := gcpJSON(t, NewGCPParser(), `{"textPayload":"started","severity":"INFO","timestamp":"2024-01-15T10:00:00Z"}`+"\n")
+	if want := `{"time":"2024-01-15T10:00:00Z","level":"info","message":"started"}`; len(got) != 1 || got[0] != want {
+		t.Errorf("entry = %v, want %s", got, want)
+	}
+}
+
+func TestGCPParser_DefaultSeverity_NoLevel(t *testing.T) {
+	got := gcpJSON(t, NewGCPParser(), `{"textPayload":"x","severity":"DEFAULT"}`+"\n")
+	if want := `{"message":"x"}`; len(got) != 1 || got[0] != want {
+		t.Errorf("entry = %v, want %s", got, want)
+	}
+}
+
+func TestGCPParser_PayloadNameClash_Prefixed(t *testing.T) {
+	got := gcpJSON(t, NewGCPParser(), `{"jsonPayload":{"time":"local","logName":"mine","n":1},"timestamp":"2024-01-15T10:00:00Z","logName":"projects/p/logs/app"}`+"\n")
+	want := `{"time":"2024-01-15T10:00:00Z","jsonPayload.time":"local","jsonPayload.logName":"mine","n":1,"logName":"projects/p/logs/app"}`
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("entry =\n%v\nwant\n%s", got, want)
+	}
+}
+
+func TestGCPParser_OtherLines_Unchanged(t *testing.T) {
+	got := gcpJSON(t, NewGCPParser(), `{"severity":"ERROR","msg":"plain"}`+"\n")
+	if want := `{"severity":"ERROR","msg":"plain"}`; len(got) != 1 || got[0] != want {
+		t.Errorf("entry = %v, want %s", got, want)
+	}
+}
+
+func TestGCPParser_MalformedLine_Reported(t *testing.T) {
+	entries, errs := NewGCPParser().Parse(r("{bad\n" + `{"textPayload":"ok"}` + "\n"))
+	got, parseErrs := collectEntries(t, entries, errs)
+	if len(got) != 1 || len(parseErrs) != 1 || !strings.Contains(parseErrs[0].Error(), "line 1") {
+		t.Errorf("got %d entries and errors %v, want 1 entry and a line 1 error", len(got), parseErrs)
+	}
+}
+
+func TestGCPParser_ParseSeq(t *testing.T) {
+	var got []string
+	for e, err := range NewGCPParser().ParseSeq(r(`{"textPayload":"a"}` + "\n")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.Fields["message"].(string))
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Errorf("messages = %v, want [a]", got)
+	}
+}
+
+func TestIsGCPEntry(t *testing.T) {
+	tests := []struct {
+		e    *LogEntry
+		want bool
+	}{
+		{NewEntry(map[string]any{"logName": "projects/p/logs/a"}), true},
+		{NewEntry(map[string]any{"protoPayload": map[string]any{}}), true},
+		{NewEntry(map[string]any{"severity": "INFO", "message": "x"}), false},
+	}
+	for _, tt := range tests {
+		if got := IsGCPEntry(tt.e); got != tt.want {
+			t.Errorf("IsGCPEntry(%v) = %v, want %v", tt.e, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,687 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync/atomic"
+)
+
+// DefaultMaxLineSize is the line length limit used when
+// ReadOptions.MaxLineSize is zero.
+const DefaultMaxLineSize = 1024 * 1024
+
+// ErrLineTooLong is wrapped by the LineError reported for a line that
+// exceeds the parser's maximum line size.
+var ErrLineTooLong = errors.New("line too long")
+
+// LineError describes a problem with a single input line. It is the error
+// type sent on a parser's error channel for malformed and oversized lines.
+type LineError struct {
+	Line int   // 1-based line number within the input.
+	Err  error // The underlying problem.
+}
+
+// Error implements the error interface as "line N: <cause>".
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error so callers can use errors.Is and
+// errors.As on it.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// OversizePolicy selects what a parser does with a line longer than its
+// maximum line size.
+type OversizePolicy int
+
+const (
+	// OversizeSkip reports the line as an error and continues with the next.
+	OversizeSkip OversizePolicy = iota
+	// OversizeTruncate reports the line and parses its first MaxLineSize bytes.
+	OversizeTruncate
+	// OversizeError reports the line and stops parsing.
+	OversizeError
+)
+
+// String returns the policy's name as accepted by ParseOversizePolicy.
+func (p OversizePolicy) String() string {
+	switch p {
+	case OversizeSkip:
+		return "skip"
+	case OversizeTruncate:
+		return "truncate"
+	case OversizeError:
+		return "error"
+	default:
+		return fmt.Sprintf("OversizePolicy(%d)", int(p))
+	}
+}
+
+// ParseOversizePolicy returns the policy named s: "skip", "truncate" or
+// "error".
+func ParseOversizePolicy(s string) (OversizePolicy, error) {
+	switch s {
+	case "skip":
+		return OversizeSkip, nil
+	case "truncate":
+		return OversizeTruncate, nil
+	case "error":
+		return OversizeError, nil
+	default:
+		return 0, fmt.Errorf("unknown oversize-line policy %q (want skip, truncate or error)", s)
+	}
+}
+
+// RawField is the field that holds the text of an input line which could
+// not be parsed, in the entries emitted for such lines under ErrorRaw or
+// KeepRaw.
+const RawField = "_raw"
+
+// SourceField is the field that names the input an entry came from. Raw
+// entries carry it when ReadOptions.Source is set.
+const SourceField = "_source"
+
+// LineField and OffsetField are the fields that hold the number of the
+// input line an entry was parsed from, counting from 1, and the byte offset
+// the line starts at, when ReadOptions.Positions is set.
+const (
+	LineField   = "_line"
+	OffsetField = "_offset"
+)
+
+// ErrorPolicy selects what a parser does with a line it cannot parse.
+type ErrorPolicy int
+
+const (
+	// ErrorSkip reports the line as an error and continues with the next.
+	ErrorSkip ErrorPolicy = iota
+	// ErrorRaw emits the line, without reporting it, as a raw entry: one
+	// holding the line in RawField, so that it keeps its place in the
+	// output.
+	ErrorRaw
+	// ErrorFail reports the line and stops parsing.
+	ErrorFail
+)
+
+// String returns the policy's name as accepted by ParseErrorPolicy.
+func (p ErrorPolicy) String() string {
+	switch p {
+	case ErrorSkip:
+		return "skip"
+	case ErrorRaw:
+		return "raw"
+	case ErrorFail:
+		return "fail"
+	default:
+		return fmt.Sprintf("ErrorPolicy(%d)", int(p))
+	}
+}
+
+// ParseErrorPolicy returns the policy named s: "skip", "raw" or "fail".
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch s {
+	case "skip":
+		return ErrorSkip, nil
+	case "raw":
+		return ErrorRaw, nil
+	case "fail":
+		return ErrorFail, nil
+	default:
+		return 0, fmt.Errorf("unknown malformed-line policy %q (want skip, raw or fail)", s)
+	}
+}
+
+// ErrDuplicateKey is wrapped by the LineError reported, under
+// ReadOptions.ReportDuplicates, for a line that repeats a key.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// DuplicatePolicy selects which value a key repeated within one logfmt line
+// takes.
+type DuplicatePolicy int
+
+const (
+	// DuplicateLast keeps the last value given for the key.
+	DuplicateLast DuplicatePolicy = iota
+	// DuplicateFirst keeps the first value given for the key.
+	DuplicateFirst
+	// DuplicateCollect keeps every value, in order, in a []any.
+	DuplicateCollect
+)
+
+// String returns the policy's name as accepted by ParseDuplicatePolicy.
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateLast:
+		return "last"
+	case DuplicateFirst:
+		return "first"
+	case DuplicateCollect:
+		return "collect"
+	default:
+		return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+	}
+}
+
+// ParseDuplicatePolicy returns the policy named s: "first", "last" or
+// "collect".
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch s {
+	case "first":
+		return DuplicateFirst, nil
+	case "last":
+		return DuplicateLast, nil
+	case "collect":
+		return DuplicateCollect, nil
+	default:
+		return 0, fmt.Errorf("unknown duplicate-key policy %q (want first, last or collect)", s)
+	}
+}
+
+// NumberMode selects the Go type that JSON numbers are decoded into.
+type NumberMode int
+
+const (
+	// NumberExact decodes numbers as json.Number, which keeps their text as
+	// it was written, so 64-bit IDs and nanosecond timestamps are not
+	// rounded. json.Number's Int64 and Float64 methods convert it.
+	NumberExact NumberMode = iota
+	// NumberFloat decodes numbers as float64, as encoding/json does by
+	// default. Integers beyond 2^53 lose precision.
+	NumberFloat
+)
+
+// String returns the mode's name as accepted by ParseNumberMode.
+func (m NumberMode) String() string {
+	switch m {
+	case NumberExact:
+		return "exact"
+	case NumberFloat:
+		return "float"
+	default:
+		return fmt.Sprintf("NumberMode(%d)", int(m))
+	}
+}
+
+// ParseNumberMode returns the mode named s: "exact" or "float".
+func ParseNumberMode(s string) (NumberMode, error) {
+	switch s {
+	case "exact":
+		return NumberExact, nil
+	case "float":
+		return NumberFloat, nil
+	default:
+		return 0, fmt.Errorf("unknown number mode %q (want exact or float)", s)
+	}
+}
+
+// ReadOptions controls how a parser splits its input into lines and what it
+// does with lines it cannot use. The zero value accepts lines up to
+// DefaultMaxLineSize, skips longer ones and skips malformed ones, and keeps
+// JSON numbers exact.
+type ReadOptions struct {
+	// MaxLineSize is the longest line, in bytes and excluding the line
+	// terminator, that is parsed in full. Zero means DefaultMaxLineSize.
+	MaxLineSize int
+	// Oversize selects what happens to lines longer than MaxLineSize.
+	Oversize OversizePolicy
+	// OnError selects what happens to lines that cannot be parsed.
+	OnError ErrorPolicy
+	// KeepRaw emits every line that cannot be parsed as a raw entry, as
+	// ErrorRaw does, while still applying OnError's reporting and stopping.
+	KeepRaw bool
+	// Source, when set, is recorded in the SourceField of raw entries.
+	Source string
+	// Duplicates selects the value of a key repeated within a logfmt line.
+	Duplicates DuplicatePolicy
+	// ReportDuplicates reports each logfmt line that repeats a key, as a
+	// *LineError wrapping ErrDuplicateKey. The line's entry is still
+	// emitted.
+	ReportDuplicates bool
+	// Numbers selects the type of the numbers in JSON entries.
+	Numbers NumberMode
+	// StrictLogfmt treats logfmt lines that are not well formed, such as
+	// those with bare keys or stray quotes, as malformed, reporting a
+	// *SyntaxError with the column of the problem. By default the parser
+	// makes what it can of them.
+	StrictLogfmt bool
+	// Positions records in each entry, raw entries included, the number
+	// of the line it was parsed from in LineField and the line's byte
+	// offset in OffsetField, both as ints. A byte order mark counts
+	// towards the offsets.
+	Positions bool
+	// MultilineStart and MultilineCont, when either is set, group lines
+	// into records, joined by newlines, before any other option applies.
+	// A line matching MultilineStart always starts a record. With
+	// MultilineCont set, a line matching it continues the record before it
+	// and any other line stands alone; without it, every line not matching
+	// MultilineStart continues the record before it. A record's line
+	// number and offset are those of its first line, and MaxLineSize
+	// limits the record as a whole.
+	//
+	// The JSON parsers parse a record as one, as pretty-printed JSON needs.
+	// The other built-in parsers parse its first line and append the lines
+	// after it to the entry's message, as a stack trace continues the line
+	// that logged it, and so do the JSON parsers for a record that is not
+	// JSON as a whole. FuncParser is given the whole record.
+	MultilineStart *regexp.Regexp
+	MultilineCont  *regexp.Regexp
+	// Progress, when non-nil, is advanced as lines are scanned.
+	Progress *Progress
+}
+
+// Progress counts how much of its input a parser has scanned. Its counters
+// may be read while the parser is running.
+type Progress struct {
+	Bytes atomic.Int64 // input bytes scanned, including line terminators
+	Lines atomic.Int64 // lines scanned
+}
+
+// advance records a scanned line of n bytes, including its terminator.
+func (p *Progress) advance(n int) {
+	if p != nil {
+		p.Bytes.Add(int64(n))
+		p.Lines.Add(1)
+	}
+}
+
+// sink receives what a parser produces from its input.
+type sink interface {
+	// emit hands over entry, returning errStop if the parse should end.
+	emit(entry *LogEntry) error
+	// report hands over a parse or read error.
+	report(err error)
+	// cancelled reports whether the parse should end. It does not block.
+	cancelled() bool
+}
+
+// output is the sink of ParseContext: the channels a parser's goroutine
+// sends on, and the context that cancels it.
+type output struct {
+	entries chan *LogEntry
+	errors  chan error
+	done    <-chan struct{}
+}
+
+// newOutput returns the channels for a parse cancelled by ctx.
+func newOutput(ctx context.Context) *output {
+	return &output{
+		entries: make(chan *LogEntry),
+		errors:  make(chan error, 1),
+		done:    ctx.Done(),
+	}
+}
+
+// emit sends entry, or releases it and returns errStop if the parse is
+// cancelled first.
+func (o *output) emit(entry *LogEntry) error {
+	select {
+	case o.entries <- entry:
+		return nil
+	case <-o.done:
+		Release(entry)
+		return errStop
+	}
+}
+
+// report sends err unless the parse is cancelled first.
+func (o *output) report(err error) {
+	select {
+	case o.errors <- err:
+	case <-o.done:
+	}
+}
+
+// cancelled reports whether the parse has been cancelled.
+func (o *output) cancelled() bool {
+	select {
+	case <-o.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes both channels once the parse is over.
+func (o *output) close() {
+	close(o.entries)
+	close(o.errors)
+}
+
+// seqOutput is the sink of ParseSeq, which hands each result straight to
+// the consumer's loop body.
+type seqOutput struct {
+	yield   func(*LogEntry, error) bool
+	stopped bool // the loop body returned false
+}
+
+// emit yields entry, returning errStop once the loop has ended.
+func (o *seqOutput) emit(entry *LogEntry) error {
+	if o.stopped || !o.yield(entry, nil) {
+		o.stopped = true
+		return errStop
+	}
+	return nil
+}
+
+// report yields err unless the loop has ended.
+func (o *seqOutput) report(err error) {
+	if !o.stopped && !o.yield(nil, err) {
+		o.stopped = true
+	}
+}
+
+// cancelled reports whether the loop has ended.
+func (o *seqOutput) cancelled() bool {
+	return o.stopped
+}
+
+// cutRecord splits a record of lines grouped by the multiline options into
+// its first line and the lines after it, joined by newlines. rest is empty
+// for a record of one line.
+func cutRecord(raw []byte) (first, rest []byte) {
+	first, rest, _ = bytes.Cut(raw, []byte{'\n'})
+	return first, rest
+}
+
+// appendLines appends rest, the lines that continue the line entry was
+// parsed from, to the entry's message on a new line: to its message, msg
+// or text field, the first that is a string, or else to a new msg field.
+func appendLines(entry *LogEntry, rest []byte) {
+	for _, k := range []string{"message", "msg", "text"} {
+		if msg, ok := entry.Fields[k].(string); ok {
+			entry.Set(k, msg+"\n"+string(rest))
+			return
+		}
+	}
+	entry.Set("msg", string(rest))
+}
+
+// position records line lineNum, starting at byte offset, in entry when
+// o.Positions is set.
+func (o ReadOptions) position(entry *LogEntry, lineNum int, offset int64) {
+	if o.Positions {
+		entry.Set(LineField, lineNum)
+		entry.Set(OffsetField, int(offset))
+	}
+}
+
+// malformed applies the malformed-line policy to line lineNum, which
+// starts at byte offset and whose text raw failed to parse with err. Raw
+// entries are emitted to out. It returns errStop when the scan should end.
+func (o ReadOptions) malformed(lineNum int, offset int64, raw []byte, err error, out sink) error {
+	if o.KeepRaw || o.OnError == ErrorRaw {
+		entry := newEntry()
+		entry.Set(RawField, string(raw))
+		if o.Source != "" {
+			entry.Set(SourceField, o.Source)
+		}
+		o.position(entry, lineNum, offset)
+		if out.emit(entry) == errStop {
+			return errStop
+		}
+	}
+	switch o.OnError {
+	case ErrorRaw:
+		return nil
+	case ErrorFail:
+		out.report(&LineError{Line: lineNum, Err: fmt.Errorf("%w; stopping", err)})
+		return errStop
+	default:
+		out.report(&LineError{Line: lineNum, Err: err})
+		return nil
+	}
+}
+
+// maxLineSize returns the effective line length limit.
+func (o ReadOptions) maxLineSize() int {
+	if o.MaxLineSize > 0 {
+		return o.MaxLineSize
+	}
+	return DefaultMaxLineSize
+}
+
+// byteSource is implemented by readers that can expose their remaining
+// content as a single in-memory slice, such as memory-mapped files. Parsers
+// split lines directly out of that slice instead of copying them through a
+// buffered reader.
+type byteSource interface {
+	Bytes() []byte
+}
+
+// utf8BOM is the byte order mark some Windows tools write at the start of
+// UTF-8 text. It is not part of the first line.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// errStop is returned by lineSplitter.oversize, and by a scanLines
+// callback, to end the scan.
+var errStop = errors.New("stop")
+
+// lineSplitter applies ReadOptions to the raw lines of an input.
+type lineSplitter struct {
+	opts   ReadOptions
+	fn     func(lineNum int, offset int64, line []byte) error
+	report func(error)
+	group  *lineGroup // nil unless grouping lines into records
+}
+
+// lineGroup is the record a lineSplitter is gathering under the
+// ReadOptions multiline patterns.
+type lineGroup struct {
+	buf     []byte // the record's first bytes, at most the line size limit
+	size    int    // the record's full size, newlines between lines included
+	lineNum int    // the record's first line
+	offset  int64
+	open    bool // buf holds a record not yet handed on
+}
+
+// line hands on line lineNum, starting at byte offset, which is size bytes
+// long without its terminator and whose first bytes (all of them unless it
+// is longer than the limit) are in head: to fn when lines are not grouped,
+// or to the record being gathered. It returns errStop when the scan should
+// end.
+func (s *lineSplitter) line(lineNum int, offset int64, head []byte, size int) error {
+	g := s.group
+	if g == nil {
+		return s.emit(lineNum, offset, head, size)
+	}
+	head = head[:min(size, len(head))]
+	if !g.open || !s.continues(head) {
+		if s.flush() == errStop {
+			return errStop
+		}
+		g.buf, g.size, g.lineNum, g.offset, g.open = g.buf[:0], 0, lineNum, offset, true
+	} else {
+		g.buf = append(g.buf, '\n')
+		g.size++
+	}
+	// Keep no more of the record than the limit, as for a single line.
+	if room := s.opts.maxLineSize() - len(g.buf); room > 0 {
+		g.buf = append(g.buf, head[:min(len(head), room)]...)
+	}
+	g.size += size
+	return nil
+}
+
+// continues reports whether line continues the record before it.
+func (s *lineSplitter) continues(line []byte) bool {
+	if start := s.opts.MultilineStart; start != nil && start.Match(line) {
+		return false
+	}
+	if cont := s.opts.MultilineCont; cont != nil {
+		return cont.Match(line)
+	}
+	return true
+}
+
+// flush hands on the record being gathered, if any. It returns errStop
+// when the scan should end.
+func (s *lineSplitter) flush() error {
+	g := s.group
+	if g == nil || !g.open {
+		return nil
+	}
+	g.open = false
+	return s.emit(g.lineNum, g.offset, g.buf, g.size)
+}
+
+// emit passes a line or record of size bytes, whose first bytes are in
+// head, to fn, or applies the oversize policy to it when it is longer than
+// the limit. It returns errStop when the scan should end.
+func (s *lineSplitter) emit(lineNum int, offset int64, head []byte, size int) error {
+	if size > s.opts.maxLineSize() {
+		return s.oversize(lineNum, offset, head, size)
+	}
+	return s.fn(lineNum, offset, head[:size])
+}
+
+// oversize applies the oversize policy to a line of size bytes whose first
+// bytes (at most the maximum line size) are given in head. It returns
+// errStop when the scan should end.
+func (s *lineSplitter) oversize(lineNum int, offset int64, head []byte, size int) error {
+	limit := s.opts.maxLineSize()
+	cause := fmt.Errorf("%w (%d bytes, limit %d)", ErrLineTooLong, size, limit)
+	switch s.opts.Oversize {
+	case OversizeTruncate:
+		s.report(&LineError{Line: lineNum, Err: fmt.Errorf("%w; truncated", cause)})
+		return s.fn(lineNum, offset, head[:limit])
+	case OversizeError:
+		s.report(&LineError{Line: lineNum, Err: fmt.Errorf("%w; stopping", cause)})
+		return errStop
+	default:
+		s.report(&LineError{Line: lineNum, Err: fmt.Errorf("%w; skipped", cause)})
+		return nil
+	}
+}
+
+// scanLines calls fn for every line in r, numbering lines from 1 and
+// giving the byte offset each starts at. The line passed to fn has its
+// trailing newline (and carriage return) removed, and is only valid for the
+// duration of the call. A UTF-8 byte order mark at the start of r is
+// skipped. fn returns errStop to end the scan. Lines longer than the
+// configured maximum are handled according to opts.Oversize, with a
+// *LineError passed to report. When r implements byteSource the lines are
+// sliced out of its buffer without copying. With the multiline patterns of
+// opts set, fn is called for each record of grouped lines instead. The
+// returned error is a read error from r, if any.
+func scanLines(r io.Reader, opts ReadOptions, fn func(lineNum int, offset int64, line []byte) error, report func(error)) error {
+	s := &lineSplitter{opts: opts, fn: fn, report: report}
+	if opts.MultilineStart != nil || opts.MultilineCont != nil {
+		s.group = &lineGroup{}
+	}
+	if src, ok := r.(byteSource); ok {
+		s.scanBytes(src.Bytes())
+		return nil
+	}
+	return s.scanReader(r)
+}
+
+// scanBytes is the zero-copy counterpart of scanReader.
+func (s *lineSplitter) scanBytes(data []byte) {
+	var offset int64
+	if bytes.HasPrefix(data, utf8BOM) {
+		data = data[len(utf8BOM):]
+		offset = int64(len(utf8BOM))
+		s.opts.Progress.advance(len(utf8BOM))
+	}
+	lineNum := 0
+	for len(data) > 0 {
+		lineNum++
+		start := offset
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+			offset += int64(i + 1)
+			s.opts.Progress.advance(i + 1)
+		} else {
+			line, data = data, nil
+			offset += int64(len(line))
+			s.opts.Progress.advance(len(line))
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		if s.line(lineNum, start, line, len(line)) == errStop {
+			return
+		}
+	}
+	s.flush()
+}
+
+// scanReader reads lines from r through a bufio.Reader, buffering at most
+// the maximum line size per line; the remainder of an oversized line is
+// counted and discarded.
+func (s *lineSplitter) scanReader(r io.Reader) error {
+	limit := s.opts.maxLineSize()
+	br := bufio.NewReader(r)
+	var offset int64
+	if head, _ := br.Peek(len(utf8BOM)); bytes.Equal(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		offset = int64(len(utf8BOM))
+		s.opts.Progress.advance(len(utf8BOM))
+	}
+	var buf []byte
+	lineNum := 0
+	for {
+		// size counts the line's bytes including its terminator; last and
+		// prev track the final two bytes read so that a "\r\n" split across
+		// chunks is still recognised.
+		buf = buf[:0]
+		size := 0
+		var prev, last byte
+		var err error
+		for {
+			var chunk []byte
+			chunk, err = br.ReadSlice('\n')
+			if len(chunk) > 0 {
+				prev, last = last, chunk[len(chunk)-1]
+				if len(chunk) > 1 {
+					prev = chunk[len(chunk)-2]
+				}
+			}
+			size += len(chunk)
+			if room := limit + 2 - len(buf); room > 0 {
+				// Keep up to limit bytes of content plus a possible "\r\n".
+				buf = append(buf, chunk[:min(len(chunk), room)]...)
+			}
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if size == 0 && err != nil {
+			s.flush()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		lineNum++
+		start := offset
+		offset += int64(size)
+		s.opts.Progress.advance(size)
+		if last == '\n' {
+			size--
+			if prev == '\r' {
+				size--
+			}
+		} else if last == '\r' {
+			size--
+		}
+		if s.line(lineNum, start, buf, size) == errStop {
+			return nil
+		}
+
+		if err != nil {
+			s.flush()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
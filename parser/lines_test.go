@@ -0,0 +1,461 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// mappedReader mimics a memory-mapped input: it exposes its content via
+// Bytes but panics if the parser falls back to reading through it.
+type mappedReader struct {
+	data []byte
+}
+
+func (m *mappedReader) Bytes() []byte { return m.data }
+
+func (m *mappedReader) Read(_ []byte) (int, error) {
+	panic("Read must not be called on a byteSource")
+}
+
+// collectLines runs scanLines over r with default options and returns the
+// lines it produced along with their line numbers.
+func collectLines(t *testing.T, r io.Reader) ([]string, []int) {
+	t.Helper()
+	lines, nums, errs := scanWith(t, r, ReadOptions{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected reported errors: %v", errs)
+	}
+	return lines, nums
+}
+
+// scanWith runs scanLines over r with opts and returns the lines, their
+// numbers, and every error passed to the report callback.
+func scanWith(t *testing.T, r io.Reader, opts ReadOptions) ([]string, []int, []error) {
+	t.Helper()
+	var lines []string
+	var nums []int
+	var errs []error
+	err := scanLines(r, opts, func(lineNum int, _ int64, line []byte) error {
+		lines = append(lines, string(line))
+		nums = append(nums, lineNum)
+		return nil
+	}, func(err error) {
+		errs = append(errs, err)
+	})
+	if err != nil {
+		t.Fatalf("scanLines: %v", err)
+	}
+	return lines, nums, errs
+}
+
+// oversizeInputs returns the same input as a plain reader and as a
+// byteSource so that both scanning paths can be exercised.
+func oversizeInputs(input string) map[string]io.Reader {
+	return map[string]io.Reader{
+		"reader":     strings.NewReader(input),
+		"byteSource": &mappedReader{data: []byte(input)},
+	}
+}
+
+func TestScanLines_Reader(t *testing.T) {
+	lines, nums := collectLines(t, strings.NewReader("a\nb\n\nc"))
+	if strings.Join(lines, "|") != "a|b||c" {
+		t.Errorf("lines = %q", lines)
+	}
+	if nums[3] != 4 {
+		t.Errorf("last line number = %d, want 4", nums[3])
+	}
+}
+
+func TestScanLines_ByteSource_MatchesReader(t *testing.T) {
+	input := "first\r\nsecond\n\nthird"
+	fromReader, _ := collectLines(t, strings.NewReader(input))
+	fromBytes, _ := collectLines(t, &mappedReader{data: []byte(input)})
+	if strings.Join(fromReader, "|") != strings.Join(fromBytes, "|") {
+		t.Errorf("byteSource lines %q differ from reader lines %q", fromBytes, fromReader)
+	}
+}
+
+func TestScanLines_ByteSource_TrailingNewline(t *testing.T) {
+	lines, _ := collectLines(t, &mappedReader{data: []byte("a\nb\n")})
+	if len(lines) != 2 {
+		t.Errorf("expected 2 lines, got %d: %q", len(lines), lines)
+	}
+}
+
+func TestScanLines_ByteSource_Empty(t *testing.T) {
+	lines, _ := collectLines(t, &mappedReader{})
+	if len(lines) != 0 {
+		t.Errorf("expected no lines, got %q", lines)
+	}
+}
+
+func TestScanLines_LeadingBOM_Skipped(t *testing.T) {
+	input := "\ufeffa\r\n\ufeffb\r\n"
+	for name, r := range oversizeInputs(input) {
+		prog := &Progress{}
+		lines, _, _ := scanWith(t, r, ReadOptions{Progress: prog})
+		// Only a mark at the very start of the input is dropped.
+		if strings.Join(lines, "|") != "a|\ufeffb" {
+			t.Errorf("%s: lines = %q", name, lines)
+		}
+		if got := prog.Bytes.Load(); got != int64(len(input)) {
+			t.Errorf("%s: Bytes = %d, want %d", name, got, len(input))
+		}
+	}
+}
+
+func TestScanLines_DefaultLimitIsOneMiB(t *testing.T) {
+	long := strings.Repeat("x", DefaultMaxLineSize+1)
+	lines, _, errs := scanWith(t, strings.NewReader("ok\n"+long+"\nafter\n"), ReadOptions{})
+	if strings.Join(lines, "|") != "ok|after" {
+		t.Errorf("lines = %q, want the oversized line skipped", lines)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected 1 reported error, got %v", errs)
+	}
+}
+
+func TestScanLines_ExactlyAtLimit_Accepted(t *testing.T) {
+	for name, r := range oversizeInputs("12345\r\n") {
+		lines, _, errs := scanWith(t, r, ReadOptions{MaxLineSize: 5})
+		if len(errs) != 0 || len(lines) != 1 || lines[0] != "12345" {
+			t.Errorf("%s: lines = %q, errs = %v", name, lines, errs)
+		}
+	}
+}
+
+func TestScanLines_Oversize_Skip(t *testing.T) {
+	for name, r := range oversizeInputs("short\nthis line is too long\nnext\n") {
+		lines, _, errs := scanWith(t, r, ReadOptions{MaxLineSize: 8, Oversize: OversizeSkip})
+		if strings.Join(lines, "|") != "short|next" {
+			t.Errorf("%s: lines = %q", name, lines)
+		}
+		if len(errs) != 1 {
+			t.Fatalf("%s: expected 1 error, got %v", name, errs)
+		}
+		var le *LineError
+		if !errors.As(errs[0], &le) || le.Line != 2 {
+			t.Errorf("%s: expected LineError for line 2, got %v", name, errs[0])
+		}
+		if !errors.Is(errs[0], ErrLineTooLong) {
+			t.Errorf("%s: expected error to wrap ErrLineTooLong, got %v", name, errs[0])
+		}
+		if !strings.Contains(errs[0].Error(), "21 bytes") || !strings.Contains(errs[0].Error(), "skipped") {
+			t.Errorf("%s: diagnostic lacks size or action: %v", name, errs[0])
+		}
+	}
+}
+
+func TestScanLines_Oversize_Truncate(t *testing.T) {
+	for name, r := range oversizeInputs("this line is too long\nnext\n") {
+		lines, nums, errs := scanWith(t, r, ReadOptions{MaxLineSize: 9, Oversize: OversizeTruncate})
+		if strings.Join(lines, "|") != "this line|next" {
+			t.Errorf("%s: lines = %q", name, lines)
+		}
+		if nums[1] != 2 {
+			t.Errorf("%s: line after truncated line numbered %d, want 2", name, nums[1])
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "truncated") {
+			t.Errorf("%s: expected one truncation diagnostic, got %v", name, errs)
+		}
+	}
+}
+
+func TestScanLines_Oversize_Error_StopsScanning(t *testing.T) {
+	for name, r := range oversizeInputs("ok\nthis line is too long\nnever\n") {
+		lines, _, errs := scanWith(t, r, ReadOptions{MaxLineSize: 8, Oversize: OversizeError})
+		if strings.Join(lines, "|") != "ok" {
+			t.Errorf("%s: lines = %q, want scanning to stop at line 2", name, lines)
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 2") {
+			t.Errorf("%s: expected one error for line 2, got %v", name, errs)
+		}
+	}
+}
+
+func TestScanLines_Reader_LineLongerThanBuffer(t *testing.T) {
+	// Lines longer than bufio's internal buffer are assembled from several
+	// chunks; make sure they come through intact when within the limit.
+	long := strings.Repeat("ab", 10000)
+	lines, _, errs := scanWith(t, strings.NewReader(long+"\r\nx"), ReadOptions{MaxLineSize: 20000})
+	if len(errs) != 0 || len(lines) != 2 || lines[0] != long || lines[1] != "x" {
+		t.Errorf("unexpected result: %d lines, errs %v", len(lines), errs)
+	}
+}
+
+func TestParseOversizePolicy(t *testing.T) {
+	for _, p := range []OversizePolicy{OversizeSkip, OversizeTruncate, OversizeError} {
+		got, err := ParseOversizePolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseOversizePolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := ParseOversizePolicy("drop"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestScanLines_Progress_CountsEveryByte(t *testing.T) {
+	input := "a\r\nbb\n\n" + strings.Repeat("x", 40) + "\nlast"
+	for name, in := range oversizeInputs(input) {
+		prog := &Progress{}
+		scanWith(t, in, ReadOptions{MaxLineSize: 16, Progress: prog})
+		if got := prog.Bytes.Load(); got != int64(len(input)) {
+			t.Errorf("%s: Bytes = %d, want %d", name, got, len(input))
+		}
+		if got := prog.Lines.Load(); got != 5 {
+			t.Errorf("%s: Lines = %d, want 5", name, got)
+		}
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	for _, p := range []ErrorPolicy{ErrorSkip, ErrorRaw, ErrorFail} {
+		got, err := ParseErrorPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseErrorPolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := ParseErrorPolicy("ignore"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestLineError_Format(t *testing.T) {
+	err := &LineError{Line: 7, Err: errors.New("boom")}
+	if err.Error() != "line 7: boom" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestJSONParser_OversizeLine_ReportedWithLineNumber(t *testing.T) {
+	p := NewJSONParser()
+	p.MaxLineSize = 32
+	input := `{"level":"info"}` + "\n" + `{"msg":"` + strings.Repeat("x", 64) + `"}` + "\n" + `{"level":"error"}`
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+	if len(gotErrs) != 1 || !strings.Contains(gotErrs[0].Error(), "line 2") {
+		t.Errorf("expected one error for line 2, got %v", gotErrs)
+	}
+}
+
+func TestLogfmtParser_LongLine_NoLongerSilentlyStops(t *testing.T) {
+	// The logfmt parser used to stop without error on lines over 64 KiB.
+	long := "msg=" + strings.Repeat("x", 100*1024)
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r(long + "\nlevel=info\n"))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 2 {
+		t.Errorf("expected 2 entries, got %d", len(got))
+	}
+}
+
+func TestJSONParser_ByteSource(t *testing.T) {
+	p := NewJSONParser()
+	src := &mappedReader{data: []byte("{\"level\":\"info\"}\nbad\n{\"level\":\"error\"}\n")}
+	entries, errs := p.Parse(src)
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+	if len(gotErrs) != 1 || !strings.Contains(gotErrs[0].Error(), "line 2") {
+		t.Errorf("expected one error on line 2, got %v", gotErrs)
+	}
+}
+
+func TestLogfmtParser_ByteSource(t *testing.T) {
+	p := NewLogfmtParser()
+	src := &mappedReader{data: []byte("level=info msg=a\nlevel=warn msg=b\n")}
+	entries, errs := p.Parse(src)
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 2 || got[1].Fields["level"] != "warn" {
+		t.Errorf("unexpected entries: %v", got)
+	}
+}
+
+func TestJSONParser_WindowsFile(t *testing.T) {
+	for name, src := range oversizeInputs("\ufeff{\"level\":\"info\"}\r\n{\"level\":\"warn\"}\r\n") {
+		entries, errs := NewJSONParser().Parse(src)
+		got, gotErrs := collectEntries(t, entries, errs)
+		if len(gotErrs) != 0 || len(got) != 2 || got[0].Fields["level"] != "info" {
+			t.Errorf("%s: entries = %v, errors = %v", name, got, gotErrs)
+		}
+	}
+}
+
+func TestLogfmtParser_WindowsFile(t *testing.T) {
+	for name, src := range oversizeInputs("\ufefflevel=info msg=\"a b\"\r\nlevel=warn\r\n") {
+		entries, errs := NewLogfmtParser().Parse(src)
+		got, gotErrs := collectEntries(t, entries, errs)
+		if len(gotErrs) != 0 || len(got) != 2 || got[0].Fields["level"] != "info" || got[0].Fields["msg"] != "a b" {
+			t.Errorf("%s: entries = %v, errors = %v", name, got, gotErrs)
+		}
+	}
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	for _, p := range []DuplicatePolicy{DuplicateLast, DuplicateFirst, DuplicateCollect} {
+		got, err := ParseDuplicatePolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseDuplicatePolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := ParseDuplicatePolicy("merge"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestParseNumberMode(t *testing.T) {
+	for _, m := range []NumberMode{NumberExact, NumberFloat} {
+		got, err := ParseNumberMode(m.String())
+		if err != nil || got != m {
+			t.Errorf("ParseNumberMode(%q) = %v, %v", m.String(), got, err)
+		}
+	}
+	if _, err := ParseNumberMode("int"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestScanLines_Multiline_Start(t *testing.T) {
+	input := "preamble\n2024-01-15 first\n  at a\n  at b\n2024-01-15 second\n\n2024-01-15 third"
+	opts := ReadOptions{MultilineStart: regexp.MustCompile(`^\d{4}-`)}
+	for name, r := range oversizeInputs(input) {
+		lines, nums, errs := scanWith(t, r, opts)
+		want := []string{"preamble", "2024-01-15 first\n  at a\n  at b", "2024-01-15 second\n", "2024-01-15 third"}
+		if strings.Join(lines, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: lines = %q, want %q", name, lines, want)
+		}
+		if len(nums) != 4 || nums[1] != 2 || nums[2] != 5 || nums[3] != 7 {
+			t.Errorf("%s: line numbers = %v, want those of each record's first line", name, nums)
+		}
+		if len(errs) != 0 {
+			t.Errorf("%s: unexpected errors %v", name, errs)
+		}
+	}
+}
+
+func TestScanLines_Multiline_Cont(t *testing.T) {
+	input := "a\n  b\n  c\nd\ne\n  f\n"
+	for name, r := range oversizeInputs(input) {
+		lines, _, _ := scanWith(t, r, ReadOptions{MultilineCont: regexp.MustCompile(`^\s`)})
+		if got := strings.Join(lines, "|"); got != "a\n  b\n  c|d|e\n  f" {
+			t.Errorf("%s: lines = %q", name, lines)
+		}
+	}
+}
+
+func TestScanLines_Multiline_StartAndCont(t *testing.T) {
+	// A line matching neither pattern ends the record and stands alone.
+	input := "BEGIN 1\n  x\nstray\n  y\nBEGIN 2\n  z\n"
+	opts := ReadOptions{
+		MultilineStart: regexp.MustCompile(`^BEGIN`),
+		MultilineCont:  regexp.MustCompile(`^\s`),
+	}
+	for name, r := range oversizeInputs(input) {
+		lines, _, _ := scanWith(t, r, opts)
+		if got := strings.Join(lines, "|"); got != "BEGIN 1\n  x|stray\n  y|BEGIN 2\n  z" {
+			t.Errorf("%s: lines = %q", name, lines)
+		}
+	}
+}
+
+func TestScanLines_Multiline_OversizeRecord(t *testing.T) {
+	input := "A short\n one\nA long\n continued\n past the limit\nA last\n"
+	opts := ReadOptions{MultilineStart: regexp.MustCompile(`^A`), MaxLineSize: 16, Oversize: OversizeTruncate}
+	for name, r := range oversizeInputs(input) {
+		lines, nums, errs := scanWith(t, r, opts)
+		if got := strings.Join(lines, "|"); got != "A short\n one|A long\n continue|A last" {
+			t.Errorf("%s: lines = %q", name, lines)
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 3") || !strings.Contains(errs[0].Error(), "33 bytes") {
+			t.Errorf("%s: expected one truncation of the record at line 3, got %v", name, errs)
+		}
+		if len(nums) != 3 || nums[2] != 6 {
+			t.Errorf("%s: line numbers = %v", name, nums)
+		}
+	}
+}
+
+func TestJSONParser_Multiline_PrettyPrinted(t *testing.T) {
+	input := "{\n  \"level\": \"info\",\n  \"msg\": \"one\"\n}\n{\n  \"msg\": \"two\"\n}\n"
+	p := &JSONParser{ReadOptions: ReadOptions{MultilineStart: regexp.MustCompile(`^\{`), Positions: true}}
+	var msgs []string
+	var lines []int
+	for entry, err := range p.ParseSeq(strings.NewReader(input)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		msgs = append(msgs, entry.Fields["msg"].(string))
+		lines = append(lines, entry.Fields[LineField].(int))
+	}
+	if strings.Join(msgs, ",") != "one,two" || len(lines) != 2 || lines[1] != 5 {
+		t.Errorf("msgs = %v, lines = %v", msgs, lines)
+	}
+}
+
+func TestJSONParser_Multiline_StackTrace(t *testing.T) {
+	input := `{"level":"error","msg":"boom"}` + "\n" +
+		"java.lang.IllegalStateException: boom\n\tat com.example.A.run(A.java:12)\n" +
+		`{"level":"info","message":"ok"}` + "\n" +
+		`{"level":"warn"}` + "\n  extra\n" +
+		"{broken\n  more\n"
+	p := &JSONParser{ReadOptions: ReadOptions{MultilineCont: regexp.MustCompile(`^(\s|java\.)`)}}
+	entries, errs := p.Parse(strings.NewReader(input))
+	got, parseErrs := collectEntries(t, entries, errs)
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3: %v", len(got), got)
+	}
+	if want := "boom\njava.lang.IllegalStateException: boom\n\tat com.example.A.run(A.java:12)"; got[0].Fields["msg"] != want {
+		t.Errorf("msg = %q, want %q", got[0].Fields["msg"], want)
+	}
+	if got[1].Fields["message"] != "ok" {
+		t.Errorf("message = %q, want the single line's", got[1].Fields["message"])
+	}
+	if got[2].Fields["msg"] != "  extra" {
+		t.Errorf("msg = %q, want the continuation in a new msg field", got[2].Fields["msg"])
+	}
+	if len(parseErrs) != 1 || !strings.Contains(parseErrs[0].Error(), "line 7") {
+		t.Errorf("errors = %v, want one for the record at line 7", parseErrs)
+	}
+}
+
+func TestLogfmtParser_Multiline_StackTrace(t *testing.T) {
+	input := "level=error msg=\"failed\" user=u1\nTraceback (most recent call last):\n  File \"app.py\", line 3\nlevel=info msg=ok\n"
+	p := &LogfmtParser{ReadOptions: ReadOptions{MultilineStart: regexp.MustCompile(`^level=`)}}
+	entries, errs := p.Parse(strings.NewReader(input))
+	got, parseErrs := collectEntries(t, entries, errs)
+	if len(got) != 2 || len(parseErrs) != 0 {
+		t.Fatalf("got %v and errors %v, want 2 entries", got, parseErrs)
+	}
+	if want := "failed\nTraceback (most recent call last):\n  File \"app.py\", line 3"; got[0].Fields["msg"] != want || got[0].Fields["user"] != "u1" {
+		t.Errorf("entry = %v, want msg %q", got[0], want)
+	}
+}
+
+func TestSyslogParser_Multiline_StackTrace(t *testing.T) {
+	input := "<11>1 - h app - - - failed\n\tat a\n<14>1 - h app - - - ok\n"
+	p := &SyslogParser{ReadOptions: ReadOptions{MultilineCont: regexp.MustCompile(`^\s`)}}
+	entries, errs := p.Parse(strings.NewReader(input))
+	got, _ := collectEntries(t, entries, errs)
+	if len(got) != 2 || got[0].Fields["msg"] != "failed\n\tat a" || got[1].Fields["msg"] != "ok" {
+		t.Errorf("entries = %v", got)
+	}
+}
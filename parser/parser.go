@@ -0,0 +1,531 @@
+// Package parser provides log entry parsers for different log formats.
+// Parsers read from an io.Reader and emit log entries over a channel,
+// reporting parse errors on a separate error channel.
+//
+// A typical consumer ranges over the entries while draining the errors:
+//
+//	entries, errs := parser.NewLogfmtParser().Parse(r)
+//	go func() {
+//		for err := range errs {
+//			log.Print(err)
+//		}
+//	}()
+//	for entry := range entries {
+//		// use entry, then optionally parser.Release(entry)
+//	}
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LogEntry represents a single structured log record: its fields, by name,
+// and the order in which they appeared in the input, when that is known.
+// Entries are passed around by pointer. Read and write fields through
+// Fields; iterate with Keys to honour the input order.
+type LogEntry struct {
+	// Fields maps field names to values. Ranging over it visits the
+	// fields in no particular order.
+	Fields map[string]any
+
+	// keys records the order of the fields of an ordered entry, as Set
+	// and the parsers add them, and is nil for an unordered one. It may
+	// name fields that have since been deleted from Fields.
+	keys []string
+}
+
+// Parser is the interface implemented by all log format parsers.
+// Parse reads from r and returns two channels: one for successfully parsed
+// log entries and one for errors encountered during parsing. Both channels
+// are closed when r is exhausted. Each entry received from the channel
+// belongs to the receiver, which may return it with Release once done.
+type Parser interface {
+	Parse(r io.Reader) (<-chan *LogEntry, <-chan error)
+}
+
+// ContextParser is implemented by parsers that can be cancelled. ParseContext
+// behaves like Parse until ctx is done; then the parser stops before the
+// next line of r, releases any entry it was about to send, and closes both
+// channels, so a consumer may stop receiving at any point and cancel ctx
+// without leaking the parser's goroutine. A Read already blocked in r is not
+// interrupted. Parse is ParseContext with context.Background().
+type ContextParser interface {
+	Parser
+	ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error)
+}
+
+// SeqParser is implemented by parsers that can also be consumed as an
+// iterator, which needs no goroutine or channels and cannot be left blocked:
+//
+//	for entry, err := range p.ParseSeq(r) {
+//		if err != nil {
+//			log.Print(err)
+//			continue
+//		}
+//		// use entry
+//	}
+type SeqParser interface {
+	Parser
+	ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error]
+}
+
+// JSONParser parses newline-delimited JSON log entries.
+type JSONParser struct {
+	ReadOptions
+}
+
+// NewJSONParser returns a new JSONParser.
+func NewJSONParser() *JSONParser {
+	return &JSONParser{}
+}
+
+// Parse reads newline-delimited JSON from r, emitting each successfully
+// unmarshalled object as a LogEntry. Lines that fail to parse are handled
+// according to the OnError policy, and lines longer than MaxLineSize
+// according to the Oversize policy.
+func (p *JSONParser) Parse(r io.Reader) (<-chan *LogEntry, <-chan error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse, stopping early when ctx is done.
+func (p *JSONParser) ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error) {
+	out := newOutput(ctx)
+	go func() {
+		defer out.close()
+		p.scan(r, out)
+	}()
+	return out.entries, out.errors
+}
+
+// ParseSeq returns an iterator over the results of parsing r: each entry
+// with a nil error, and each error that Parse would report with a nil
+// entry, in input order. Parsing happens in the loop's own goroutine, and
+// breaking out of the loop stops it. Each entry yielded belongs to the loop
+// body, which may return it with Release.
+func (p *JSONParser) ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error] {
+	return func(yield func(*LogEntry, error) bool) {
+		p.scan(r, &seqOutput{yield: yield})
+	}
+}
+
+// scan parses r, handing the results to out.
+func (p *JSONParser) scan(r io.Reader, out sink) {
+	scanJSON(r, p.ReadOptions, out, nil)
+}
+
+// scanJSON parses newline-delimited JSON from r with opts, handing the
+// results to out. When normalize is not nil each decoded entry is replaced
+// by the one it returns for the entry and its line.
+func scanJSON(r io.Reader, opts ReadOptions, out sink, normalize func(*LogEntry, []byte) *LogEntry) {
+	err := scanLines(r, opts, func(lineNum int, offset int64, raw []byte) error {
+		if out.cancelled() {
+			return errStop
+		}
+		line := bytes.TrimSpace(raw)
+		if len(line) == 0 {
+			return nil
+		}
+
+		entry := newEntry()
+		var rest []byte
+		if err := entry.decode(line, opts.Numbers); err != nil {
+			Release(entry)
+			// A JSON line followed by lines that are not, such as a
+			// stack trace, keeps them in its message.
+			var first []byte
+			if first, rest = cutRecord(line); len(rest) == 0 {
+				return opts.malformed(lineNum, offset, raw, err, out)
+			}
+			line = bytes.TrimSpace(first)
+			entry = newEntry()
+			if entry.decode(line, opts.Numbers) != nil {
+				Release(entry)
+				return opts.malformed(lineNum, offset, raw, err, out)
+			}
+		}
+		if normalize != nil {
+			entry = normalize(entry, line)
+		}
+		if len(rest) > 0 {
+			appendLines(entry, bytes.TrimRightFunc(rest, unicode.IsSpace))
+		}
+		opts.position(entry, lineNum, offset)
+
+		return out.emit(entry)
+	}, out.report)
+	if err != nil {
+		out.report(fmt.Errorf("reading input: %w", err))
+	}
+}
+
+// LogfmtParser parses logfmt-formatted log entries.
+// Logfmt is a simple key=value format popularized by Heroku and the Go
+// ecosystem (e.g. github.com/kr/logfmt).
+type LogfmtParser struct {
+	ReadOptions
+}
+
+// NewLogfmtParser returns a new LogfmtParser.
+func NewLogfmtParser() *LogfmtParser {
+	return &LogfmtParser{}
+}
+
+// Parse reads logfmt lines from r, emitting each successfully parsed line
+// as a LogEntry. Lines that fail to parse are handled according to the
+// OnError policy, and lines longer than MaxLineSize according to the
+// Oversize policy.
+func (p *LogfmtParser) Parse(r io.Reader) (<-chan *LogEntry, <-chan error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse, stopping early when ctx is done.
+func (p *LogfmtParser) ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error) {
+	out := newOutput(ctx)
+	go func() {
+		defer out.close()
+		p.scan(r, out)
+	}()
+	return out.entries, out.errors
+}
+
+// ParseSeq returns an iterator over the results of parsing r: each entry
+// with a nil error, and each error that Parse would report with a nil
+// entry, in input order. Parsing happens in the loop's own goroutine, and
+// breaking out of the loop stops it. Each entry yielded belongs to the loop
+// body, which may return it with Release.
+func (p *LogfmtParser) ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error] {
+	return func(yield func(*LogEntry, error) bool) {
+		p.scan(r, &seqOutput{yield: yield})
+	}
+}
+
+// scan parses r, handing the results to out.
+func (p *LogfmtParser) scan(r io.Reader, out sink) {
+	err := scanLines(r, p.ReadOptions, func(lineNum int, offset int64, raw []byte) error {
+		if out.cancelled() {
+			return errStop
+		}
+		// Trim trailing space only, so that leading space counts towards
+		// the columns of syntax errors.
+		first, rest := cutRecord(raw)
+		line := strings.TrimRightFunc(string(first), unicode.IsSpace)
+		if strings.TrimSpace(line) == "" && len(rest) == 0 {
+			return nil
+		}
+
+		parse := parseLogfmt
+		if p.StrictLogfmt {
+			parse = parseLogfmtStrict
+		}
+		entry, dups, err := parse(line, p.Duplicates)
+		if err != nil {
+			return p.malformed(lineNum, offset, raw, err, out)
+		}
+		if len(dups) > 0 && p.ReportDuplicates {
+			out.report(&LineError{Line: lineNum, Err: duplicateError(dups)})
+		}
+		if len(rest) > 0 {
+			appendLines(entry, bytes.TrimRightFunc(rest, unicode.IsSpace))
+		}
+		p.position(entry, lineNum, offset)
+
+		return out.emit(entry)
+	}, out.report)
+	if err != nil {
+		out.report(fmt.Errorf("reading input: %w", err))
+	}
+}
+
+// FuncParser parses each line of its input with a function of the caller's
+// choosing, applying ReadOptions to line lengths and malformed lines just as
+// the built-in parsers do. It lets callers add formats of their own.
+type FuncParser struct {
+	ReadOptions
+	// ParseLine parses one non-blank line, passed without its terminator
+	// and valid only for the duration of the call. A non-nil error marks
+	// the line as malformed. The entry returned is sent to the consumer,
+	// which takes ownership of it.
+	ParseLine func(line []byte) (*LogEntry, error)
+}
+
+// Parse reads lines from r, emitting each one ParseLine accepts as a
+// LogEntry. Lines it rejects are handled according to the OnError policy,
+// and lines longer than MaxLineSize according to the Oversize policy.
+func (p *FuncParser) Parse(r io.Reader) (<-chan *LogEntry, <-chan error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse, stopping early when ctx is done.
+func (p *FuncParser) ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error) {
+	out := newOutput(ctx)
+	go func() {
+		defer out.close()
+		p.scan(r, out)
+	}()
+	return out.entries, out.errors
+}
+
+// ParseSeq is the iterator form of Parse; see JSONParser.ParseSeq.
+func (p *FuncParser) ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error] {
+	return func(yield func(*LogEntry, error) bool) {
+		p.scan(r, &seqOutput{yield: yield})
+	}
+}
+
+// scan parses r, handing the results to out.
+func (p *FuncParser) scan(r io.Reader, out sink) {
+	err := scanLines(r, p.ReadOptions, func(lineNum int, offset int64, raw []byte) error {
+		if out.cancelled() {
+			return errStop
+		}
+		if len(bytes.TrimSpace(raw)) == 0 {
+			return nil
+		}
+
+		entry, err := p.ParseLine(raw)
+		if err != nil {
+			return p.malformed(lineNum, offset, raw, err, out)
+		}
+		p.position(entry, lineNum, offset)
+
+		return out.emit(entry)
+	}, out.report)
+	if err != nil {
+		out.report(fmt.Errorf("reading input: %w", err))
+	}
+}
+
+// ParseLogfmt parses a single logfmt line into a LogEntry. It is what
+// LogfmtParser applies to each line of its input, exposed for callers that
+// already have the line in hand.
+//
+// The logfmt format consists of space-separated key=value pairs. Values may
+// be unquoted tokens or double-quoted strings, in which \", \\, \n, \r and
+// \t are unescaped.
+// A bare key with no '=' is stored with a boolean true value.
+func ParseLogfmt(line string) (*LogEntry, error) {
+	entry, _, err := parseLogfmt(line, DuplicateLast)
+	return entry, err
+}
+
+// parseLogfmt is ParseLogfmt with a policy for repeated keys. It also
+// returns the keys that were repeated, in order of first repetition.
+func parseLogfmt(line string, duplicates DuplicatePolicy) (*LogEntry, []string, error) {
+	b := &logfmtBuilder{entry: newEntry(), duplicates: duplicates}
+	remaining := line
+
+	for remaining != "" {
+		remaining = strings.TrimSpace(remaining)
+		if remaining == "" {
+			break
+		}
+
+		eqIdx := strings.IndexByte(remaining, '=')
+		if eqIdx == -1 {
+			// Bare key with no value — treat as a boolean flag.
+			b.set(remaining, true)
+			break
+		}
+
+		key := remaining[:eqIdx]
+		remaining = remaining[eqIdx+1:]
+
+		var value string
+		if strings.HasPrefix(remaining, `"`) {
+			var n int
+			var ok bool
+			value, n, ok = unquoteLogfmt(remaining)
+			if !ok {
+				Release(b.entry)
+				return nil, nil, fmt.Errorf("unterminated string value")
+			}
+			remaining = remaining[n:]
+		} else {
+			// Unquoted value: ends at the next space.
+			spaceIdx := strings.IndexByte(remaining, ' ')
+			if spaceIdx == -1 {
+				value = remaining
+				remaining = ""
+			} else {
+				value = remaining[:spaceIdx]
+				remaining = remaining[spaceIdx+1:]
+			}
+		}
+		b.set(key, value)
+	}
+	entry, dups := b.finish()
+	return entry, dups, nil
+}
+
+// SyntaxError describes where a line breaks the logfmt, syslog or CSV
+// syntax. Parsers with ReadOptions.StrictLogfmt set, and the syslog and CSV
+// parsers, report it, wrapped in a LineError, for each line they reject.
+type SyntaxError struct {
+	Column int    // 1-based byte offset of the problem within the line.
+	Msg    string // What is wrong there.
+}
+
+// Error implements the error interface as "column N: <msg>".
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// parseLogfmtStrict is parseLogfmt for well-formed logfmt only: a line of
+// key=value pairs separated by spaces or tabs, in which every key is a
+// non-empty run of printable characters other than '=' and '"' and every
+// value is empty, a quoted string, or a run of characters other than '='
+// and '"'. Anything else is reported as a *SyntaxError.
+func parseLogfmtStrict(line string, duplicates DuplicatePolicy) (*LogEntry, []string, error) {
+	b := &logfmtBuilder{entry: newEntry(), duplicates: duplicates}
+	fail := func(i int, format string, args ...any) (*LogEntry, []string, error) {
+		Release(b.entry)
+		return nil, nil, &SyntaxError{Column: i + 1, Msg: fmt.Sprintf(format, args...)}
+	}
+	isSpace := func(i int) bool { return line[i] == ' ' || line[i] == '\t' }
+
+	i := 0
+	for {
+		for i < len(line) && isSpace(i) {
+			i++
+		}
+		if i == len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] > ' ' && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+		key := line[start:i]
+		switch {
+		case i == len(line) || isSpace(i):
+			return fail(start, "key %q has no value", key)
+		case line[i] != '=':
+			return fail(i, "unexpected %q in key", line[i])
+		case key == "":
+			return fail(i, "missing key before '='")
+		}
+		i++
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			v, n, ok := unquoteLogfmt(line[i:])
+			if !ok {
+				return fail(i, "unterminated quoted value")
+			}
+			value = v
+			i += n
+			if i < len(line) && !isSpace(i) {
+				return fail(i, "unexpected %q after quoted value", line[i])
+			}
+		} else {
+			vstart := i
+			for ; i < len(line) && !isSpace(i); i++ {
+				if line[i] == '"' || line[i] == '=' {
+					return fail(i, "unexpected %q in unquoted value", line[i])
+				}
+			}
+			value = line[vstart:i]
+		}
+		b.set(key, value)
+	}
+	entry, dups := b.finish()
+	return entry, dups, nil
+}
+
+// logfmtBuilder collects the fields of a logfmt line into an entry,
+// resolving repeated keys by its policy.
+type logfmtBuilder struct {
+	entry      *LogEntry
+	keys, dups []string
+	duplicates DuplicatePolicy
+}
+
+// set records value for key.
+func (b *logfmtBuilder) set(key string, value any) {
+	old, dup := b.entry.Fields[key]
+	if !dup {
+		b.keys = append(b.keys, key)
+		b.entry.Fields[key] = value
+		return
+	}
+	if !slices.Contains(b.dups, key) {
+		b.dups = append(b.dups, key)
+		if b.duplicates == DuplicateCollect {
+			old = []any{old}
+		}
+	}
+	switch b.duplicates {
+	case DuplicateFirst:
+	case DuplicateCollect:
+		b.entry.Fields[key] = append(old.([]any), value)
+	default:
+		b.entry.Fields[key] = value
+	}
+}
+
+// finish returns the entry, with its key order recorded, and the keys that
+// were repeated, in order of first repetition.
+func (b *logfmtBuilder) finish() (*LogEntry, []string) {
+	b.entry.setKeys(b.keys)
+	return b.entry, b.dups
+}
+
+// unquoteLogfmt decodes the double-quoted value at the start of s, which
+// must begin with '"'. It returns the value, the length of its quoted form
+// and whether the closing quote was found. The escapes \", \\, \n, \r and
+// \t are decoded; any other backslash is kept as it is.
+func unquoteLogfmt(s string) (string, int, bool) {
+	end := strings.IndexAny(s[1:], `"\`) + 1
+	if end == 0 {
+		return "", 0, false
+	}
+	if s[end] == '"' {
+		// No escapes: the value is a substring of the line.
+		return s[1:end], end + 1, true
+	}
+	var b strings.Builder
+	b.WriteString(s[1:end])
+	for i := end; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return b.String(), i + 1, true
+		case c != '\\' || i+1 == len(s):
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case '"', '\\':
+			b.WriteByte(s[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, false
+}
+
+// duplicateError returns the error reported for a line repeating keys.
+func duplicateError(keys []string) error {
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		quoted[i] = strconv.Quote(k)
+	}
+	return fmt.Errorf("%w %s", ErrDuplicateKey, strings.Join(quoted, ", "))
+}
@@ -0,0 +1,1076 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collectEntries drains both channels concurrently and returns all entries and errors.
+func collectEntries(t *testing.T, entries <-chan *LogEntry, errors <-chan error) ([]*LogEntry, []error) {
+	t.Helper()
+	var got []*LogEntry
+	var errs []error
+
+	errsDone := make(chan struct{})
+	go func() {
+		defer close(errsDone)
+		for err := range errors {
+			errs = append(errs, err)
+		}
+	}()
+
+	for entry := range entries {
+		got = append(got, entry)
+	}
+	<-errsDone
+	return got, errs
+}
+
+// r is a convenience helper to create a *strings.Reader.
+func r(s string) *strings.Reader {
+	return strings.NewReader(s)
+}
+
+// =============================================================================
+// JSONParser
+// =============================================================================
+
+func TestJSONParser_SingleValidEntry(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(`{"level":"info","msg":"hello"}`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Fields["level"] != "info" {
+		t.Errorf("level: got %v, want info", got[0].Fields["level"])
+	}
+	if got[0].Fields["msg"] != "hello" {
+		t.Errorf("msg: got %v, want hello", got[0].Fields["msg"])
+	}
+}
+
+func TestJSONParser_MultipleEntries(t *testing.T) {
+	input := `{"level":"info","msg":"first"}
+{"level":"error","msg":"second"}
+{"level":"warn","msg":"third"}`
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(got))
+	}
+	if got[0].Fields["msg"] != "first" {
+		t.Errorf("entry 0 msg: got %v, want first", got[0].Fields["msg"])
+	}
+	if got[2].Fields["msg"] != "third" {
+		t.Errorf("entry 2 msg: got %v, want third", got[2].Fields["msg"])
+	}
+}
+
+func TestJSONParser_EmptyReader(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(""))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected 0 entries, got %d", len(got))
+	}
+}
+
+func TestJSONParser_SkipsEmptyLines(t *testing.T) {
+	input := `{"level":"info","msg":"a"}
+
+{"level":"error","msg":"b"}
+
+`
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+}
+
+func TestJSONParser_SkipsWhitespaceOnlyLines(t *testing.T) {
+	input := "   \n{\"level\":\"info\"}\n   \n"
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+}
+
+func TestJSONParser_InvalidJSON_ProducesError(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r("not json at all"))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(gotErrs), gotErrs)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected 0 entries, got %d", len(got))
+	}
+}
+
+func TestJSONParser_ErrorMessageContainsLineNumber(t *testing.T) {
+	input := `{"valid":"yes"}
+not json`
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(input))
+	_, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(gotErrs))
+	}
+	if !strings.Contains(gotErrs[0].Error(), "line 2") {
+		t.Errorf("expected error to contain line number, got: %v", gotErrs[0])
+	}
+}
+
+func TestJSONParser_MixedValidAndInvalid(t *testing.T) {
+	input := `{"level":"info","msg":"valid"}
+not json
+{"level":"error","msg":"also valid"}`
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(gotErrs))
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+}
+
+func TestJSONParser_NumericValues_KeepTheirText(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(`{"count":42,"ratio":3.14,"id":1704067200123456789}`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Fields["count"] != json.Number("42") {
+		t.Errorf("count: got %v (%T), want json.Number(42)", got[0].Fields["count"], got[0].Fields["count"])
+	}
+	if got[0].Fields["ratio"] != json.Number("3.14") {
+		t.Errorf("ratio: got %v, want 3.14", got[0].Fields["ratio"])
+	}
+	// Beyond 2^53, a float64 would round this to 1704067200123456768.
+	if id, _ := got[0].Fields["id"].(json.Number).Int64(); id != 1704067200123456789 {
+		t.Errorf("id: got %v, want 1704067200123456789", got[0].Fields["id"])
+	}
+}
+
+func TestJSONParser_NumberFloat_DecodesFloat64(t *testing.T) {
+	p := &JSONParser{ReadOptions: ReadOptions{Numbers: NumberFloat}}
+	entries, errs := p.Parse(r(`{"count":42,"ratio":3.14}`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 || len(got) != 1 {
+		t.Fatalf("got %d entries and errors %v, want 1 entry", len(got), gotErrs)
+	}
+	if got[0].Fields["count"] != float64(42) {
+		t.Errorf("count: got %v (%T), want float64(42)", got[0].Fields["count"], got[0].Fields["count"])
+	}
+	if got[0].Fields["ratio"] != float64(3.14) {
+		t.Errorf("ratio: got %v, want 3.14", got[0].Fields["ratio"])
+	}
+}
+
+func TestJSONParser_TrailingData_IsMalformed(t *testing.T) {
+	for _, numbers := range []NumberMode{NumberExact, NumberFloat} {
+		p := &JSONParser{ReadOptions: ReadOptions{Numbers: numbers}}
+		entries, errs := p.Parse(r(`{"a":1} {"b":2}` + "\n" + `{"a":1} junk`))
+		got, gotErrs := collectEntries(t, entries, errs)
+		if len(got) != 0 || len(gotErrs) != 2 {
+			t.Errorf("%v: got %d entries and %d errors, want 0 and 2", numbers, len(got), len(gotErrs))
+		}
+	}
+}
+
+func TestJSONParser_BooleanValues_Preserved(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(`{"ok":true,"fail":false}`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if got[0].Fields["ok"] != true {
+		t.Errorf("ok: got %v, want true", got[0].Fields["ok"])
+	}
+	if got[0].Fields["fail"] != false {
+		t.Errorf("fail: got %v, want false", got[0].Fields["fail"])
+	}
+}
+
+func TestJSONParser_NullValue_Preserved(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(`{"key":null}`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Fields["key"] != nil {
+		t.Errorf("key: got %v, want nil", got[0].Fields["key"])
+	}
+}
+
+func TestJSONParser_NestedObject_Preserved(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(`{"level":"info","meta":{"host":"srv1"}}`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if _, ok := got[0].Fields["meta"]; !ok {
+		t.Error("expected meta field to be present")
+	}
+}
+
+func TestJSONParser_AllFieldsPreserved(t *testing.T) {
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(`{"a":"1","b":"2","c":"3"}`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if got[0].Len() != 3 {
+		t.Errorf("expected 3 fields, got %d: %v", got[0].Len(), got[0])
+	}
+}
+
+func TestJSONParser_MultipleErrors_AllReported(t *testing.T) {
+	input := "bad1\nbad2\nbad3"
+	p := NewJSONParser()
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(got) != 0 {
+		t.Fatalf("expected 0 entries, got %d", len(got))
+	}
+	// The errors channel has buffer 1, but our collectEntries consumer drains it
+	// concurrently so the producer goroutine is never permanently blocked; all
+	// three errors must be delivered.
+	if len(gotErrs) != 3 {
+		t.Fatalf("expected 3 errors, got %d: %v", len(gotErrs), gotErrs)
+	}
+}
+
+func TestJSONParser_ErrorRaw_EmitsLineInPlace(t *testing.T) {
+	input := `{"n":1}` + "\npanic: boom\n\tmain.go:12\n" + `{"n":2}` + "\n"
+	p := NewJSONParser()
+	p.OnError = ErrorRaw
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(got))
+	}
+	if got[1].Fields[RawField] != "panic: boom" || got[2].Fields[RawField] != "\tmain.go:12" {
+		t.Errorf("raw entries = %v, %v", got[1], got[2])
+	}
+	if got[3].Fields["n"] != json.Number("2") {
+		t.Errorf("last entry = %v", got[3])
+	}
+}
+
+func TestJSONParser_KeepRaw_ReportsAndEmitsLine(t *testing.T) {
+	input := `{"n":1}` + "\nnot json\n" + `{"n":2}` + "\n"
+	p := NewJSONParser()
+	p.KeepRaw = true
+	p.Source = "app.log"
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 1 {
+		t.Fatalf("expected 1 error, got %v", gotErrs)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(got))
+	}
+	if got[1].Fields[RawField] != "not json" || got[1].Fields[SourceField] != "app.log" {
+		t.Errorf("raw entry = %v", got[1])
+	}
+	if keys := got[1].Keys(); len(keys) != 2 || keys[0] != RawField {
+		t.Errorf("raw entry keys = %v, want _raw first", keys)
+	}
+}
+
+func TestJSONParser_KeepRawWithErrorFail_EmitsLineThenStops(t *testing.T) {
+	input := "bad\n" + `{"n":1}` + "\n"
+	p := NewJSONParser()
+	p.KeepRaw = true
+	p.OnError = ErrorFail
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 1 {
+		t.Fatalf("expected 1 error, got %v", gotErrs)
+	}
+	if len(got) != 1 || got[0].Fields[RawField] != "bad" {
+		t.Fatalf("entries = %v, want only the raw line", got)
+	}
+}
+
+func TestJSONParser_Positions(t *testing.T) {
+	input := "\xEF\xBB\xBF" + `{"n":1}` + "\r\n\nbad\n" + `{"n":2}`
+	for name, rd := range oversizeInputs(input) {
+		p := NewJSONParser()
+		p.Positions = true
+		p.OnError = ErrorRaw
+		entries, errs := p.Parse(rd)
+		got, _ := collectEntries(t, entries, errs)
+		if len(got) != 3 {
+			t.Fatalf("%s: expected 3 entries, got %d", name, len(got))
+		}
+		for i, want := range [][2]int{{1, 3}, {3, 13}, {4, 17}} {
+			if got[i].Fields[LineField] != want[0] || got[i].Fields[OffsetField] != want[1] {
+				t.Errorf("%s: entry %d at line %v, offset %v, want %d, %d", name, i, got[i].Fields[LineField], got[i].Fields[OffsetField], want[0], want[1])
+			}
+		}
+	}
+}
+
+func TestJSONParser_ErrorFail_EndsAtFirstMalformedLine(t *testing.T) {
+	input := `{"n":1}` + "\nbad\n" + `{"n":2}` + "\nbad\n"
+	p := NewJSONParser()
+	p.OnError = ErrorFail
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if len(gotErrs) != 1 || !strings.Contains(gotErrs[0].Error(), "line 2") {
+		t.Fatalf("expected 1 error for line 2, got %v", gotErrs)
+	}
+}
+
+// =============================================================================
+// LogfmtParser
+// =============================================================================
+
+func TestLogfmtParser_EmptyReader(t *testing.T) {
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r(""))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected 0 entries, got %d", len(got))
+	}
+}
+
+func TestLogfmtParser_Positions(t *testing.T) {
+	p := NewLogfmtParser()
+	p.Positions = true
+	entries, errs := p.Parse(r("a=1\nb=2\n"))
+	got, _ := collectEntries(t, entries, errs)
+	if len(got) != 2 || got[1].Fields[LineField] != 2 || got[1].Fields[OffsetField] != 4 {
+		t.Errorf("entries = %v, want the second at line 2, offset 4", got)
+	}
+	if keys := got[1].Keys(); keys[len(keys)-2] != LineField || keys[len(keys)-1] != OffsetField {
+		t.Errorf("keys = %v, want the positions last", keys)
+	}
+}
+
+func TestLogfmtParser_SkipsEmptyLines(t *testing.T) {
+	input := "level=info\n\nlevel=error\n"
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+}
+
+func TestLogfmtParser_SingleKeyValueLine(t *testing.T) {
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r("level=info"))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Fields["level"] != "info" {
+		t.Errorf("level: got %v, want info", got[0].Fields["level"])
+	}
+}
+
+func TestLogfmtParser_MultipleKeyValuesOnOneLine(t *testing.T) {
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r("level=info msg=hello"))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Fields["level"] != "info" {
+		t.Errorf("level: got %v, want info", got[0].Fields["level"])
+	}
+	if got[0].Fields["msg"] != "hello" {
+		t.Errorf("msg: got %v, want hello", got[0].Fields["msg"])
+	}
+}
+
+func TestLogfmtParser_MultipleLines(t *testing.T) {
+	input := "level=info msg=first\nlevel=error msg=second\n"
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+	if got[0].Fields["level"] != "info" {
+		t.Errorf("entry 0 level: got %v, want info", got[0].Fields["level"])
+	}
+	if got[1].Fields["level"] != "error" {
+		t.Errorf("entry 1 level: got %v, want error", got[1].Fields["level"])
+	}
+}
+
+func TestLogfmtParser_BooleanFlagLine(t *testing.T) {
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r("verbose"))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Fields["verbose"] != true {
+		t.Errorf("verbose: got %v, want true", got[0].Fields["verbose"])
+	}
+}
+
+func TestLogfmtParser_UnterminatedString_ProducesError(t *testing.T) {
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r(`level="unterminated`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(got) != 0 {
+		t.Fatalf("expected 0 entries, got %d", len(got))
+	}
+	if len(gotErrs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(gotErrs), gotErrs)
+	}
+}
+
+func TestLogfmtParser_ErrorRaw_EmitsLineInPlace(t *testing.T) {
+	input := "a=1\n  b=\"open\nc=3\n"
+	p := NewLogfmtParser()
+	p.OnError = ErrorRaw
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(got))
+	}
+	if got[1].Fields[RawField] != `  b="open` || got[1].Len() != 1 {
+		t.Errorf("raw entry = %v", got[1])
+	}
+}
+
+func TestLogfmtParser_ErrorFail_EndsAtFirstMalformedLine(t *testing.T) {
+	input := "a=1\nb=\"open\nc=3\n"
+	p := NewLogfmtParser()
+	p.OnError = ErrorFail
+	entries, errs := p.Parse(r(input))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if len(gotErrs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(gotErrs), gotErrs)
+	}
+}
+
+func TestLogfmtParser_QuotedValue(t *testing.T) {
+	p := NewLogfmtParser()
+	entries, errs := p.Parse(r(`msg="hello world" level=info`))
+	got, gotErrs := collectEntries(t, entries, errs)
+
+	if len(gotErrs) != 0 {
+		t.Fatalf("expected no errors, got %v", gotErrs)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Fields["msg"] != "hello world" {
+		t.Errorf("msg: got %v, want \"hello world\"", got[0].Fields["msg"])
+	}
+	if got[0].Fields["level"] != "info" {
+		t.Errorf("level: got %v, want info", got[0].Fields["level"])
+	}
+}
+
+// =============================================================================
+// ParseLogfmt (white-box: same package)
+// =============================================================================
+
+func TestParseLogfmt_EmptyString(t *testing.T) {
+	entry, err := ParseLogfmt("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entry.Fields) != 0 {
+		t.Errorf("expected empty entry, got %v", entry)
+	}
+}
+
+func TestParseLogfmt_WhitespaceOnly(t *testing.T) {
+	entry, err := ParseLogfmt("   ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entry.Fields) != 0 {
+		t.Errorf("expected empty entry, got %v", entry)
+	}
+}
+
+func TestParseLogfmt_BooleanFlag_NoEquals(t *testing.T) {
+	entry, err := ParseLogfmt("verbose")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["verbose"] != true {
+		t.Errorf("verbose: got %v, want true", entry.Fields["verbose"])
+	}
+}
+
+func TestParseLogfmt_BooleanFlag_StoresEntireRemaining(t *testing.T) {
+	// When there is no '=' anywhere in the line the whole trimmed string
+	// is stored as a boolean flag (eqIdx == -1 → entry[remaining] = true; break).
+	entry, err := ParseLogfmt("verbose debug")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["verbose debug"] != true {
+		t.Errorf("expected entry[\"verbose debug\"]=true, got: %v", entry)
+	}
+}
+
+func TestParseLogfmt_SingleKeyValue(t *testing.T) {
+	entry, err := ParseLogfmt("key=value")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["key"] != "value" {
+		t.Errorf("key: got %v, want value", entry.Fields["key"])
+	}
+}
+
+func TestParseLogfmt_MultipleKeyValues(t *testing.T) {
+	entry, err := ParseLogfmt("a=1 b=2 c=3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Len() != 3 {
+		t.Errorf("expected 3 fields, got %d: %v", entry.Len(), entry)
+	}
+	if entry.Fields["a"] != "1" {
+		t.Errorf("a: got %v, want 1", entry.Fields["a"])
+	}
+	if entry.Fields["b"] != "2" {
+		t.Errorf("b: got %v, want 2", entry.Fields["b"])
+	}
+	if entry.Fields["c"] != "3" {
+		t.Errorf("c: got %v, want 3", entry.Fields["c"])
+	}
+}
+
+func TestParseLogfmt_QuotedValue(t *testing.T) {
+	entry, err := ParseLogfmt(`msg="hello world" level=info`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["msg"] != "hello world" {
+		t.Errorf("msg: got %v, want \"hello world\"", entry.Fields["msg"])
+	}
+	if entry.Fields["level"] != "info" {
+		t.Errorf("level: got %v, want info", entry.Fields["level"])
+	}
+}
+
+func TestParseLogfmt_QuotedValueOnly(t *testing.T) {
+	entry, err := ParseLogfmt(`msg="just quoted"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["msg"] != "just quoted" {
+		t.Errorf("msg: got %v, want \"just quoted\"", entry.Fields["msg"])
+	}
+}
+
+func TestParseLogfmt_UnterminatedString_ReturnsError(t *testing.T) {
+	_, err := ParseLogfmt(`msg="unterminated`)
+	if err == nil {
+		t.Error("expected error for unterminated string value, got nil")
+	}
+}
+
+func TestParseLogfmt_QuotedValueWithEscapedQuote(t *testing.T) {
+	entry, err := ParseLogfmt(`msg="say \"hello\"" level=info`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["msg"] != `say "hello"` {
+		t.Errorf("msg: got %v, want %q", entry.Fields["msg"], `say "hello"`)
+	}
+	if entry.Fields["level"] != "info" {
+		t.Errorf("level: got %v, want info", entry.Fields["level"])
+	}
+}
+
+func TestParseLogfmt_QuotedValueEscapes(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`msg="a\\b"`, `a\b`},
+		{`msg="ends with \\"`, `ends with \`},
+		{`msg="line one\nline two"`, "line one\nline two"},
+		{`msg="col\tcol\r"`, "col\tcol\r"},
+		{`msg="C:\dir"`, `C:\dir`}, // unknown escapes are kept
+		{`msg=C:\dir`, `C:\dir`},   // unquoted values are never unescaped
+	}
+	for _, tt := range tests {
+		entry, err := ParseLogfmt(tt.line)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.line, err)
+			continue
+		}
+		if entry.Fields["msg"] != tt.want {
+			t.Errorf("%s: msg = %q, want %q", tt.line, entry.Fields["msg"], tt.want)
+		}
+	}
+}
+
+func TestParseLogfmt_EscapedClosingQuote_IsUnterminated(t *testing.T) {
+	for _, line := range []string{`msg="open \"`, `msg="open \`} {
+		if _, err := ParseLogfmt(line); err == nil {
+			t.Errorf("%s: expected error for unterminated string value", line)
+		}
+	}
+}
+
+func TestParseLogfmt_LeadingAndTrailingSpaces(t *testing.T) {
+	entry, err := ParseLogfmt("  level=info  msg=hello  ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["level"] != "info" {
+		t.Errorf("level: got %v, want info", entry.Fields["level"])
+	}
+	if entry.Fields["msg"] != "hello" {
+		t.Errorf("msg: got %v, want hello", entry.Fields["msg"])
+	}
+}
+
+func TestParseLogfmt_EmptyValue(t *testing.T) {
+	// "key=" — value is empty string (no chars before next space or end).
+	entry, err := ParseLogfmt("key=")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Fields["key"] != "" {
+		t.Errorf("key: got %v, want empty string", entry.Fields["key"])
+	}
+}
+
+// =============================================================================
+// FuncParser
+// =============================================================================
+
+// splitLine parses "key value" lines for the FuncParser tests.
+func splitLine(line []byte) (*LogEntry, error) {
+	k, v, ok := strings.Cut(string(line), " ")
+	if !ok {
+		return nil, errors.New("no space")
+	}
+	return NewEntry(map[string]any{k: v}), nil
+}
+
+func TestFuncParser_ParsesLinesAndSkipsBlank(t *testing.T) {
+	p := &FuncParser{ParseLine: splitLine}
+	entries, errors := p.Parse(r("a 1\n\n  \nb 2\n"))
+	got, errs := collectEntries(t, entries, errors)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(got) != 2 || got[0].Fields["a"] != "1" || got[1].Fields["b"] != "2" {
+		t.Errorf("entries = %v", got)
+	}
+}
+
+func TestFuncParser_MalformedLinesFollowPolicy(t *testing.T) {
+	p := &FuncParser{ReadOptions: ReadOptions{OnError: ErrorRaw}, ParseLine: splitLine}
+	entries, errors := p.Parse(r("a 1\nbad\n"))
+	got, errs := collectEntries(t, entries, errors)
+	if len(errs) != 0 || len(got) != 2 || got[1].Fields[RawField] != "bad" {
+		t.Errorf("entries = %v, errors = %v", got, errs)
+	}
+
+	p.OnError = ErrorSkip
+	entries, errors = p.Parse(r("bad\n"))
+	_, errs = collectEntries(t, entries, errors)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 1: no space") {
+		t.Errorf("errors = %v", errs)
+	}
+}
+
+// =============================================================================
+// ParseContext
+// =============================================================================
+
+// waitClosed fails the test unless both channels are closed within a second,
+// discarding anything still sent on them.
+func waitClosed(t *testing.T, entries <-chan *LogEntry, errors <-chan error) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for entries != nil || errors != nil {
+		select {
+		case _, ok := <-entries:
+			if !ok {
+				entries = nil
+			}
+		case _, ok := <-errors:
+			if !ok {
+				errors = nil
+			}
+		case <-timeout:
+			t.Fatal("parser did not stop after cancellation")
+		}
+	}
+}
+
+func TestParseContext_CancelStopsParser(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     ContextParser
+		input string
+	}{
+		{"json", NewJSONParser(), strings.Repeat(`{"level":"info"}`+"\n", 10000)},
+		{"logfmt", NewLogfmtParser(), strings.Repeat("level=info\n", 10000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			entries, errs := tt.p.ParseContext(ctx, r(tt.input))
+			if _, ok := <-entries; !ok {
+				t.Fatal("no entry before cancellation")
+			}
+			cancel()
+			n := 0
+			for range entries {
+				n++
+			}
+			for range errs {
+			}
+			if n >= 9999 {
+				t.Errorf("received all %d remaining entries after cancellation", n)
+			}
+		})
+	}
+}
+
+func TestParseContext_CancelUnblocksErrorReport(t *testing.T) {
+	// Nobody reads errs: the parser blocks reporting the second bad line
+	// until ctx is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errs := NewJSONParser().ParseContext(ctx, r("bad\nbad\nbad\n"))
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	waitClosed(t, entries, errs)
+}
+
+func TestParseContext_CancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries, errs := NewLogfmtParser().ParseContext(ctx, r("a=1\nb=2\n"))
+	waitClosed(t, entries, errs)
+}
+
+func TestParseContext_Background_MatchesParse(t *testing.T) {
+	entries, errors := NewJSONParser().ParseContext(context.Background(), r(`{"a":1}`+"\n"+`{"a":2}`+"\n"))
+	got, errs := collectEntries(t, entries, errors)
+	if len(got) != 2 || len(errs) != 0 {
+		t.Errorf("got %d entries and %v, want 2 entries and no errors", len(got), errs)
+	}
+}
+
+// =============================================================================
+// ParseSeq
+// =============================================================================
+
+func TestParseSeq_EntriesAndErrorsInOrder(t *testing.T) {
+	p := &JSONParser{ReadOptions: ReadOptions{KeepRaw: true}}
+	var got []string
+	for entry, err := range p.ParseSeq(r(`{"n":1}` + "\nbad\n" + `{"n":2}` + "\n")) {
+		switch {
+		case err != nil:
+			got = append(got, "error")
+		case entry.Fields[RawField] != nil:
+			got = append(got, "raw")
+		default:
+			got = append(got, "entry")
+		}
+	}
+	want := []string{"entry", "raw", "error", "entry"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseSeq_BreakStopsParsing(t *testing.T) {
+	var seen []string
+	lines := 0
+	p := NewLogfmtParser()
+	for entry, err := range p.ParseSeq(r("a=1\nb=2\nc=3\n")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines++
+		seen = append(seen, entry.Keys()...)
+		if lines == 2 {
+			break
+		}
+	}
+	if strings.Join(seen, ",") != "a,b" {
+		t.Errorf("keys seen = %v, want [a b]", seen)
+	}
+}
+
+func TestParseSeq_BreakOnError(t *testing.T) {
+	n := 0
+	for _, err := range NewJSONParser().ParseSeq(r("bad\nbad\nbad\n")) {
+		if err == nil {
+			t.Fatal("expected only errors")
+		}
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("loop ran %d times, want 1", n)
+	}
+}
+
+func TestParseSeq_ErrorFailStops(t *testing.T) {
+	p := &LogfmtParser{ReadOptions: ReadOptions{OnError: ErrorFail}}
+	var entries, errs int
+	for _, err := range p.ParseSeq(r("a=1\nb=\"open\nc=3\n")) {
+		if err != nil {
+			errs++
+		} else {
+			entries++
+		}
+	}
+	if entries != 1 || errs != 1 {
+		t.Errorf("got %d entries and %d errors, want 1 and 1", entries, errs)
+	}
+}
+
+// =============================================================================
+// Duplicate logfmt keys
+// =============================================================================
+
+func TestParseLogfmt_DuplicateKey_KeepsLast(t *testing.T) {
+	entry, err := ParseLogfmt("tag=a tag=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Fields["tag"] != "b" {
+		t.Errorf("tag = %v, want b", entry.Fields["tag"])
+	}
+}
+
+func TestLogfmtParser_Duplicates_Policies(t *testing.T) {
+	tests := []struct {
+		policy DuplicatePolicy
+		want   string
+	}{
+		{DuplicateLast, "c"},
+		{DuplicateFirst, "a"},
+		{DuplicateCollect, "[a b c]"},
+	}
+	for _, tt := range tests {
+		p := &LogfmtParser{ReadOptions: ReadOptions{Duplicates: tt.policy}}
+		entries, errors := p.Parse(r("tag=a x=1 tag=b tag=c\n"))
+		got, errs := collectEntries(t, entries, errors)
+		if len(got) != 1 || len(errs) != 0 {
+			t.Fatalf("%v: got %d entries, errors %v", tt.policy, len(got), errs)
+		}
+		if v := fmt.Sprint(got[0].Fields["tag"]); v != tt.want {
+			t.Errorf("%v: tag = %s, want %s", tt.policy, v, tt.want)
+		}
+		if keys := strings.Join(got[0].Keys(), ","); keys != "tag,x" {
+			t.Errorf("%v: keys = %s, want tag,x", tt.policy, keys)
+		}
+	}
+}
+
+func TestLogfmtParser_Duplicates_CollectBareKey(t *testing.T) {
+	p := &LogfmtParser{ReadOptions: ReadOptions{Duplicates: DuplicateCollect}}
+	entries, errors := p.Parse(r("debug=no debug\n"))
+	got, _ := collectEntries(t, entries, errors)
+	if v := fmt.Sprint(got[0].Fields["debug"]); v != "[no true]" {
+		t.Errorf("debug = %s, want [no true]", v)
+	}
+}
+
+func TestLogfmtParser_ReportDuplicates(t *testing.T) {
+	p := &LogfmtParser{ReadOptions: ReadOptions{ReportDuplicates: true}}
+	entries, errc := p.Parse(r("a=1\nb=1 c=2 b=3 c=4 b=5\n"))
+	got, errs := collectEntries(t, entries, errc)
+	if len(got) != 2 {
+		t.Errorf("got %d entries, want 2 (duplicates are still emitted)", len(got))
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrDuplicateKey) {
+		t.Fatalf("errors = %v, want one ErrDuplicateKey", errs)
+	}
+	if errs[0].Error() != `line 2: duplicate key "b", "c"` {
+		t.Errorf("error = %q", errs[0].Error())
+	}
+}
+
+// =============================================================================
+// Strict logfmt
+// =============================================================================
+
+func TestParseLogfmtStrict_WellFormed(t *testing.T) {
+	entry, _, err := parseLogfmtStrict(`  level=info msg="a \"b\"" empty=	path=/a/b k.v-2=ok`, DuplicateLast)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"level": "info", "msg": `a "b"`, "empty": "", "path": "/a/b", "k.v-2": "ok"}
+	if entry.Len() != len(want) {
+		t.Errorf("entry = %v, want %v", entry, want)
+	}
+	for k, v := range want {
+		if entry.Fields[k] != v {
+			t.Errorf("%s = %q, want %q", k, entry.Fields[k], v)
+		}
+	}
+	if got := strings.Join(entry.Keys(), ","); got != "level,msg,empty,path,k.v-2" {
+		t.Errorf("Keys() = %s", got)
+	}
+}
+
+func TestParseLogfmtStrict_Errors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"verbose debug", `column 1: key "verbose" has no value`},
+		{"a=1 verbose", `column 5: key "verbose" has no value`},
+		{"  =1", "column 3: missing key before '='"},
+		{`a=1 k"ey=2`, `column 6: unexpected '"' in key`},
+		{"a=1 b=x=y", `column 8: unexpected '=' in unquoted value`},
+		{`a=it"s`, `column 5: unexpected '"' in unquoted value`},
+		{`a="x"y b=1`, `column 6: unexpected 'y' after quoted value`},
+		{`a=1 b="open`, "column 7: unterminated quoted value"},
+		{"a=1 k\x01=2", `column 6: unexpected '\x01' in key`},
+	}
+	for _, tt := range tests {
+		_, _, err := parseLogfmtStrict(tt.line, DuplicateLast)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%q: error = %v, want a *SyntaxError", tt.line, err)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("%q: error = %q, want %q", tt.line, err.Error(), tt.want)
+		}
+	}
+}
+
+func TestLogfmtParser_StrictLogfmt(t *testing.T) {
+	input := "a=1\n  verbose debug\nb=2 c=\"x\"\n"
+
+	lenient := &LogfmtParser{}
+	entries, errc := lenient.Parse(r(input))
+	if got, errs := collectEntries(t, entries, errc); len(got) != 3 || len(errs) != 0 {
+		t.Errorf("lenient: %d entries, errors %v; want 3 and none", len(got), errs)
+	}
+
+	strict := &LogfmtParser{ReadOptions: ReadOptions{StrictLogfmt: true}}
+	entries, errc = strict.Parse(r(input))
+	got, errs := collectEntries(t, entries, errc)
+	if len(got) != 2 {
+		t.Errorf("strict: %d entries, want 2", len(got))
+	}
+	if len(errs) != 1 || errs[0].Error() != `line 2: column 3: key "verbose" has no value` {
+		t.Fatalf("strict: errors = %v", errs)
+	}
+	var se *SyntaxError
+	if !errors.As(errs[0], &se) || se.Column != 3 {
+		t.Errorf("strict: error does not carry column 3: %#v", errs[0])
+	}
+}
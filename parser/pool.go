@@ -0,0 +1,40 @@
+package parser
+
+import "sync"
+
+// Entry ownership
+//
+// Every LogEntry a parser sends on its channel is owned by the receiver
+// from that point on; the parser keeps no reference to it. A receiver that
+// has finished with an entry — it has been filtered out, formatted, or
+// counted, and nothing retains it — may hand it back with Release so
+// that a later parse can reuse its map instead of allocating a new one.
+// Releasing is optional: entries that are never released are simply
+// garbage-collected. An entry must not be read, written or released again
+// after it has been released.
+
+// maxPooledFields bounds the entries kept for reuse. Go maps never shrink,
+// so recycling an unusually wide entry would pin its memory indefinitely.
+const maxPooledFields = 64
+
+var entryPool = sync.Pool{
+	New: func() any { return &LogEntry{Fields: make(map[string]any, 16)} },
+}
+
+// newEntry returns an empty, unordered entry, reusing a released one when
+// available.
+func newEntry() *LogEntry {
+	return entryPool.Get().(*LogEntry)
+}
+
+// Release clears entry and makes it available for reuse by the parsers. The
+// caller must own entry (see the ownership rules above) and must not use it
+// afterwards. Releasing a nil entry is a no-op.
+func Release(entry *LogEntry) {
+	if entry == nil || entry.Fields == nil || len(entry.Fields) > maxPooledFields {
+		return
+	}
+	clear(entry.Fields)
+	entry.keys = nil
+	entryPool.Put(entry)
+}
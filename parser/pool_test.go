@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelease_Nil(t *testing.T) {
+	Release(nil) // must not panic
+}
+
+func TestRelease_ClearsEntry(t *testing.T) {
+	e := NewEntry(map[string]any{"level": "info", "msg": "hi"})
+	Release(e)
+	if len(e.Fields) != 0 {
+		t.Errorf("released entry still has %d fields", len(e.Fields))
+	}
+}
+
+func TestNewEntry_Empty(t *testing.T) {
+	e := newEntry()
+	Release(NewEntry(map[string]any{"stale": true}))
+	e2 := newEntry()
+	if len(e.Fields) != 0 || len(e2.Fields) != 0 {
+		t.Errorf("newEntry returned non-empty entries: %v, %v", e, e2)
+	}
+}
+
+func TestRelease_ReusedEntriesHaveNoStaleFields(t *testing.T) {
+	input := `{"level":"info","msg":"first","extra":1}` + "\n" + `{"msg":"second"}` + "\n"
+	entries, errs := NewJSONParser().Parse(strings.NewReader(input))
+	go func() {
+		for range errs {
+		}
+	}()
+	first := <-entries
+	if first.Fields["msg"] != "first" {
+		t.Fatalf("first entry = %v", first)
+	}
+	Release(first)
+	second := <-entries
+	for range entries {
+	}
+	if second.Len() != 1 || second.Fields["msg"] != "second" {
+		t.Errorf("second entry = %v, want only msg=second", second)
+	}
+	if got := strings.Join(second.Keys(), ","); got != "msg" {
+		t.Errorf("Keys() = %s, want msg", got)
+	}
+}
+
+func TestRelease_LogfmtReusedEntriesHaveNoStaleFields(t *testing.T) {
+	first, err := ParseLogfmt("a=1 b=2 c=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Release(first)
+	second, err := ParseLogfmt("d=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(second.Keys(), ","); got != "d" {
+		t.Errorf("Keys() = %s, want d", got)
+	}
+}
@@ -0,0 +1,309 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyslogParser parses syslog messages in the RFC 5424 format, one per
+// line, as rsyslog and syslog-ng write them to files:
+//
+//	<165>1 2024-01-15T10:00:00.003Z web1 checkout 4123 ID47 [req@32473 id="r1"] payment failed
+//
+// Each message becomes an entry with these fields, in this order, leaving
+// out those the message gives as "-":
+//
+//   - time, the timestamp as written;
+//   - level, the name of the severity, such as "error" for 3 or "notice"
+//     for 5;
+//   - facility, the name of the facility, such as "local4";
+//   - host, app, procid and msgid;
+//   - a field for each parameter of the structured data, named after its
+//     element and itself, as in "req@32473.id", or, for an element without
+//     parameters, a field named after the element set to true;
+//   - msg, the free-form message, without the byte order mark that may
+//     start it.
+//
+// Lines that do not follow the format are malformed, and are reported as a
+// *SyntaxError giving the column of the problem.
+type SyslogParser struct {
+	ReadOptions
+}
+
+// NewSyslogParser returns a new SyslogParser.
+func NewSyslogParser() *SyslogParser {
+	return &SyslogParser{}
+}
+
+// Parse reads syslog messages from r, one per line, emitting each as a
+// LogEntry. Lines that fail to parse are handled according to the OnError
+// policy, and lines longer than MaxLineSize according to the Oversize
+// policy.
+func (p *SyslogParser) Parse(r io.Reader) (<-chan *LogEntry, <-chan error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse, stopping early when ctx is done.
+func (p *SyslogParser) ParseContext(ctx context.Context, r io.Reader) (<-chan *LogEntry, <-chan error) {
+	out := newOutput(ctx)
+	go func() {
+		defer out.close()
+		p.scan(r, out)
+	}()
+	return out.entries, out.errors
+}
+
+// ParseSeq is the iterator form of Parse; see JSONParser.ParseSeq.
+func (p *SyslogParser) ParseSeq(r io.Reader) iter.Seq2[*LogEntry, error] {
+	return func(yield func(*LogEntry, error) bool) {
+		p.scan(r, &seqOutput{yield: yield})
+	}
+}
+
+// scan parses r, handing the results to out.
+func (p *SyslogParser) scan(r io.Reader, out sink) {
+	err := scanLines(r, p.ReadOptions, func(lineNum int, offset int64, raw []byte) error {
+		if out.cancelled() {
+			return errStop
+		}
+		first, rest := cutRecord(raw)
+		line := strings.TrimRight(string(first), "\r")
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+
+		entry, err := ParseSyslog(line)
+		if err != nil {
+			return p.malformed(lineNum, offset, raw, err, out)
+		}
+		if len(rest) > 0 {
+			appendLines(entry, bytes.TrimRight(rest, "\r\n"))
+		}
+		p.position(entry, lineNum, offset)
+
+		return out.emit(entry)
+	}, out.report)
+	if err != nil {
+		out.report(fmt.Errorf("reading input: %w", err))
+	}
+}
+
+// syslogSeverities names the syslog severities, indexed by their numbers.
+var syslogSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// syslogFacilities names the syslog facilities, indexed by their numbers.
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// ParseSyslog parses a single RFC 5424 syslog message into a LogEntry with
+// the fields described for SyslogParser. It is what SyslogParser applies
+// to each line of its input, exposed for callers that receive messages one
+// at a time. An error is a *SyntaxError.
+func ParseSyslog(line string) (*LogEntry, error) {
+	s := &syslogScanner{line: line}
+	entry := NewOrderedEntry()
+	if err := s.header(entry); err != nil {
+		Release(entry)
+		return nil, err
+	}
+	if err := s.structuredData(entry); err != nil {
+		Release(entry)
+		return nil, err
+	}
+	if s.pos < len(line) {
+		if line[s.pos] != ' ' {
+			Release(entry)
+			return nil, s.fail("expected a space before the message")
+		}
+		if msg := strings.TrimPrefix(line[s.pos+1:], "\ufeff"); msg != "" {
+			entry.Set("msg", msg)
+		}
+	}
+	return entry, nil
+}
+
+// syslogScanner walks an RFC 5424 message from left to right.
+type syslogScanner struct {
+	line string
+	pos  int
+}
+
+// fail returns a *SyntaxError at the current position.
+func (s *syslogScanner) fail(format string, args ...any) error {
+	return &SyntaxError{Column: s.pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// header reads the priority, version, timestamp, hostname, app-name,
+// procid and msgid, and the space after them, into entry.
+func (s *syslogScanner) header(entry *LogEntry) error {
+	if !strings.HasPrefix(s.line, "<") {
+		return s.fail("expected '<' starting the priority")
+	}
+	pri, err := s.priority()
+	if err != nil {
+		return err
+	}
+
+	version, err := s.token("version")
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(version); err != nil || n < 1 || version[0] == '+' {
+		s.pos -= len(version) + 1
+		return s.fail("invalid version %q", version)
+	}
+
+	ts, err := s.token("timestamp")
+	if err != nil {
+		return err
+	}
+	if ts != "-" {
+		if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+			s.pos -= len(ts) + 1
+			return s.fail("invalid timestamp %q", ts)
+		}
+		entry.Set("time", ts)
+	}
+	setPriority(entry, pri)
+
+	for _, field := range []string{"host", "app", "procid", "msgid"} {
+		v, err := s.token(field)
+		if err != nil {
+			return err
+		}
+		if v != "-" {
+			entry.Set(field, v)
+		}
+	}
+	return nil
+}
+
+// priority reads the priority at the start of the line, "<", a number from
+// 0 to 191 and ">", and returns the number.
+func (s *syslogScanner) priority() (int, error) {
+	end := strings.IndexByte(s.line, '>')
+	if end < 2 || end > 4 {
+		s.pos = 1
+		return 0, s.fail("expected a priority of 1 to 3 digits closed by '>'")
+	}
+	pri, err := strconv.Atoi(s.line[1:end])
+	if err != nil || pri > 191 || s.line[1] == '+' || s.line[1] == '-' {
+		s.pos = 1
+		return 0, s.fail("invalid priority %q", s.line[1:end])
+	}
+	s.pos = end + 1
+	return pri, nil
+}
+
+// setPriority sets the level and facility fields of entry to the names of
+// the severity and facility that make up pri.
+func setPriority(entry *LogEntry, pri int) {
+	entry.Set("level", syslogSeverities[pri%8])
+	entry.Set("facility", syslogFacilities[pri/8])
+}
+
+// token returns the run of characters other than spaces at the current
+// position, which must be followed by a space, and moves past the space.
+func (s *syslogScanner) token(name string) (string, error) {
+	rest := s.line[s.pos:]
+	end := strings.IndexByte(rest, ' ')
+	if end < 0 {
+		s.pos = len(s.line)
+		return "", s.fail("missing %s", name)
+	}
+	if end == 0 {
+		return "", s.fail("empty %s", name)
+	}
+	s.pos += end + 1
+	return rest[:end], nil
+}
+
+// structuredData reads the structured data at the current position, "-"
+// or a run of elements, into entry.
+func (s *syslogScanner) structuredData(entry *LogEntry) error {
+	if strings.HasPrefix(s.line[s.pos:], "-") {
+		s.pos++
+		return nil
+	}
+	if !strings.HasPrefix(s.line[s.pos:], "[") {
+		return s.fail("expected '-' or '[' starting the structured data")
+	}
+	for s.pos < len(s.line) && s.line[s.pos] == '[' {
+		s.pos++
+		id := s.name()
+		if id == "" {
+			return s.fail("expected the name of a structured data element")
+		}
+		params := 0
+		for s.pos < len(s.line) && s.line[s.pos] == ' ' {
+			s.pos++
+			param := s.name()
+			if param == "" {
+				return s.fail("expected a parameter name")
+			}
+			if !strings.HasPrefix(s.line[s.pos:], `="`) {
+				return s.fail(`expected '="' after parameter %q`, param)
+			}
+			s.pos += 2
+			value, err := s.value()
+			if err != nil {
+				return err
+			}
+			entry.Set(id+"."+param, value)
+			params++
+		}
+		if s.pos >= len(s.line) || s.line[s.pos] != ']' {
+			return s.fail("expected ']' closing element %q", id)
+		}
+		s.pos++
+		if params == 0 {
+			entry.Set(id, true)
+		}
+	}
+	return nil
+}
+
+// name returns the structured data name at the current position: printable
+// ASCII characters other than '=', ' ', ']' and '"'.
+func (s *syslogScanner) name() string {
+	start := s.pos
+	for s.pos < len(s.line) {
+		c := s.line[s.pos]
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			break
+		}
+		s.pos++
+	}
+	return s.line[start:s.pos]
+}
+
+// value returns the parameter value at the current position, up to its
+// closing quote, with the escapes \", \\ and \] resolved; a backslash
+// before anything else is kept, as RFC 5424 requires.
+func (s *syslogScanner) value() (string, error) {
+	var b strings.Builder
+	for s.pos < len(s.line) {
+		c := s.line[s.pos]
+		switch {
+		case c == '"':
+			s.pos++
+			return b.String(), nil
+		case c == '\\' && s.pos+1 < len(s.line) && strings.IndexByte(`"\]`, s.line[s.pos+1]) >= 0:
+			b.WriteByte(s.line[s.pos+1])
+			s.pos += 2
+		default:
+			b.WriteByte(c)
+			s.pos++
+		}
+	}
+	return "", s.fail("unterminated parameter value")
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// syslogJSON parses each line with ParseSyslog and returns the entry as
+// JSON.
+func syslogJSON(t *testing.T, line string) string {
+	t.Helper()
+	entry, err := ParseSyslog(line)
+	if err != nil {
+		t.Fatalf("ParseSyslog(%q): %v", line, err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseSyslog_AllFields(t *testing.T) {
+	got := syslogJSON(t, `<165>1 2024-01-15T10:00:00.003Z web1 checkout 4123 ID47 [req@32473 id="r1" user="u\"1\]"][canary@32473] payment failed`)
+	want := `{"time":"2024-01-15T10:00:00.003Z","level":"notice","facility":"local4","host":"web1","app":"checkout","procid":"4123","msgid":"ID47",` +
+		`"req@32473.id":"r1","req@32473.user":"u\"1]","canary@32473":true,"msg":"payment failed"}`
+	if got != want {
+		t.Errorf("entry =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseSyslog_NilValues(t *testing.T) {
+	got := syslogJSON(t, "<11>1 - - - - - -")
+	if want := `{"level":"error","facility":"user"}`; got != want {
+		t.Errorf("entry = %s, want %s", got, want)
+	}
+}
+
+func TestParseSyslog_MessageByteOrderMark(t *testing.T) {
+	got := syslogJSON(t, "<14>1 2024-01-15T10:00:00+02:00 h a - - - \ufeffstarted \\d")
+	if !strings.HasSuffix(got, `"msg":"started \\d"}`) {
+		t.Errorf("entry = %s, want the message without its byte order mark", got)
+	}
+}
+
+func TestParseSyslog_Malformed(t *testing.T) {
+	tests := []struct {
+		line   string
+		column int
+	}{
+		{"Jan 15 10:00:00 web1 app: hello", 1},
+		{"<192>1 - - - - - -", 2},
+		{"<1a>1 - - - - - -", 2},
+		{"<14>0 - - - - - -", 5},
+		{"<14>1 yesterday h a - - -", 7},
+		{"<14>1 - h a - -", 16},
+		{"<14>1 - h a - - x", 17},
+		{`<14>1 - h a - - [id p=1]`, 22},
+		{`<14>1 - h a - - [id p="1`, 25},
+		{`<14>1 - h a - - [id p="1"]x`, 27},
+	}
+	for _, tt := range tests {
+		_, err := ParseSyslog(tt.line)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseSyslog(%q) error = %v, want a *SyntaxError", tt.line, err)
+			continue
+		}
+		if syntaxErr.Column != tt.column {
+			t.Errorf("ParseSyslog(%q) error = %v, want column %d", tt.line, err, tt.column)
+		}
+	}
+}
+
+func TestSyslogParser_Parse(t *testing.T) {
+	input := "<14>1 - h a - - - one\r\n\nnot syslog\n<12>1 - h a - - - two\n"
+	p := NewSyslogParser()
+	p.Positions = true
+	entries, errs := p.Parse(r(input))
+	got, parseErrs := collectEntries(t, entries, errs)
+	if len(got) != 2 || got[0].Fields["msg"] != "one" || got[1].Fields["msg"] != "two" || got[1].Fields["level"] != "warning" {
+		t.Errorf("entries = %v", got)
+	}
+	if len(got) == 2 && got[1].Fields[LineField] != 4 {
+		t.Errorf("second entry line = %v, want 4", got[1].Fields[LineField])
+	}
+	if len(parseErrs) != 1 || !strings.Contains(parseErrs[0].Error(), "line 3") {
+		t.Errorf("errors = %v, want one for line 3", parseErrs)
+	}
+}
+
+func TestSyslogParser_ParseSeq(t *testing.T) {
+	var got []string
+	for e, err := range NewSyslogParser().ParseSeq(r("<14>1 - h a - - - a\n")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.Fields["msg"].(string))
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Errorf("messages = %v, want [a]", got)
+	}
+}
@@ -0,0 +1,42 @@
+package parser
+
+import "time"
+
+// zonedLayouts and naiveLayouts are the timestamp forms ParseTime accepts,
+// with and without a UTC offset. time.Parse also accepts fractional seconds
+// after the seconds field of any of them.
+var (
+	zonedLayouts = []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05Z0700",
+	}
+	naiveLayouts = []string{
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+)
+
+// ParseTime parses s as an RFC 3339 timestamp, also accepting a space in
+// place of the "T", an offset without a colon, no offset at all, or a date
+// alone. A timestamp without an offset is taken to be in loc, or in UTC
+// when loc is nil; zoned reports whether s carried an offset of its own.
+// ok is false when s is not a timestamp in any of these forms.
+func ParseTime(s string, loc *time.Location) (t time.Time, zoned, ok bool) {
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true, true
+		}
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range naiveLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, false, true
+		}
+	}
+	return time.Time{}, false, false
+}
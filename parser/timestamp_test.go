@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime_Forms(t *testing.T) {
+	utc := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339Nano, s)
+		return t
+	}
+	tests := []struct {
+		in    string
+		want  time.Time
+		zoned bool
+	}{
+		{"2024-01-15T10:00:00Z", utc("2024-01-15T10:00:00Z"), true},
+		{"2024-01-15T12:00:00.25+02:00", utc("2024-01-15T10:00:00.25Z"), true},
+		{"2024-01-15T05:00:00-0500", utc("2024-01-15T10:00:00Z"), true},
+		{"2024-01-15 10:00:00+00:00", utc("2024-01-15T10:00:00Z"), true},
+		{"2024-01-15T10:00:00.123", utc("2024-01-15T10:00:00.123Z"), false},
+		{"2024-01-15 10:00:00", utc("2024-01-15T10:00:00Z"), false},
+		{"2024-01-15", utc("2024-01-15T00:00:00Z"), false},
+	}
+	for _, tt := range tests {
+		got, zoned, ok := ParseTime(tt.in, nil)
+		if !ok || !got.Equal(tt.want) || zoned != tt.zoned {
+			t.Errorf("ParseTime(%q) = %v, %v, %v; want %v, %v, true", tt.in, got, zoned, ok, tt.want, tt.zoned)
+		}
+	}
+}
+
+func TestParseTime_NaiveUsesLocation(t *testing.T) {
+	loc := time.FixedZone("", 2*60*60)
+	got, _, _ := ParseTime("2024-01-15 12:00:00", loc)
+	if want := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("naive time = %v, want %v", got, want)
+	}
+	got, _, _ = ParseTime("2024-01-15T12:00:00Z", loc)
+	if want := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("zoned time = %v, want %v; its own offset must win", got, want)
+	}
+}
+
+func TestParseTime_NotATimestamp(t *testing.T) {
+	for _, s := range []string{"", "1704067200", "yesterday", "2024-13-01", "10:00:00"} {
+		if _, _, ok := ParseTime(s, nil); ok {
+			t.Errorf("ParseTime(%q) ok, want not a timestamp", s)
+		}
+	}
+}